@@ -1,22 +1,82 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
 
+	"gopresence/internal/annotations"
+	"gopresence/internal/apiversion"
 	"gopresence/internal/auth"
 	"gopresence/internal/config"
+	"gopresence/internal/connlimit"
+	"gopresence/internal/contacts"
+	"gopresence/internal/drain"
+	"gopresence/internal/events"
+	"gopresence/internal/gateway"
+	"gopresence/internal/grpcserver"
 	"gopresence/internal/handlers"
+	"gopresence/internal/i18n"
+	"gopresence/internal/index"
+	"gopresence/internal/logging"
 	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+	"gopresence/internal/privacy"
+	"gopresence/internal/quota"
+	"gopresence/internal/ratelimit"
+	"gopresence/internal/recovery"
+	"gopresence/internal/requestid"
+	"gopresence/internal/resultcache"
+	"gopresence/internal/schema"
 	"gopresence/internal/service"
+	"gopresence/internal/sinks"
+	"gopresence/internal/stream"
+	"gopresence/internal/subscriptions"
+	"gopresence/internal/timing"
+	"gopresence/internal/version"
+	"gopresence/internal/webhooks"
+	"gopresence/internal/writebehind"
 )
 
 func main(){
+	bootstrapOnly := flag.Bool("bootstrap-only", false, "declare the JetStream buckets, streams and consumers of the configuration, then exit")
+	flag.Parse()
 	cfg, err := config.Load()
 	if err != nil { log.Fatalf("config load: %v", err) }
+	// Structured logging; the standard log package is routed through it too.
+	// Repeats of a record, such as the errors of a flapping NATS connection,
+	// are counted per window rather than logged.
+	var logSampler *logging.Sampler
+	if window, _ := cfg.Logging.GetSampleWindow(); window > 0 {
+		logSampler = logging.NewSampler(window, cfg.Logging.SampleBurst)
+	}
+	logLevel := logging.Setup(cfg.Logging.Format, cfg.Logging.Level, logSampler)
+	// Provisioning pipelines declare the JetStream resources ahead of the nodes
+	if *bootstrapOnly {
+		if err := service.NewServiceBuilder(cfg).Bootstrap(context.Background()); err != nil { log.Fatalf("bootstrap: %v", err) }
+		log.Printf("JetStream resources declared")
+		return
+	}
+	// Deployment statuses and transitions, consulted by every status check
+	machine, err := cfg.Presence.GetStateMachine()
+	if err != nil { log.Fatalf("invalid presence state machine: %v", err) }
+	models.SetStateMachine(machine)
+
+	// W3C trace context on incoming HTTP requests; KV writes carry it to watchers
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 
 	// Build service
 	builder := service.NewServiceBuilder(cfg)
@@ -24,19 +84,279 @@ func main(){
 	if err != nil { log.Fatalf("service build: %v", err) }
 	defer svc.Close()
 
+	// Fan out KV changes to streaming subscribers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	coalesceWindow, err := cfg.Stream.GetCoalesceWindow()
+	if err != nil { log.Fatalf("invalid STREAM_COALESCE_WINDOW: %v", err) }
+	hub := events.NewHub(events.WithCoalesceWindow(coalesceWindow))
+	// In-memory presence index, expiring entries with the KV bucket TTL
+	kvTTL, err := cfg.NATS.GetKVTTL()
+	if err != nil { log.Fatalf("invalid NATS_KV_TTL: %v", err) }
+	idx := index.New(kvTTL)
+	go idx.Run(ctx, time.Minute)
+	// Contacts and stats responses reused for a short window; contacts' until one of them changes
+	resultWindow, err := cfg.API.GetResultCacheWindow()
+	if err != nil { log.Fatalf("invalid API_RESULT_CACHE_WINDOW: %v", err) }
+	var results *resultcache.Cache
+	if resultWindow > 0 {
+		results = resultcache.New(resultWindow)
+		go results.Run(ctx, time.Minute)
+	}
+	// Never-seen-user fast path, rebuilt periodically to drop expired users
+	if cfg.Cache.BloomEnabled {
+		interval, err := cfg.Cache.GetBloomRebuildInterval()
+		if err != nil { log.Fatalf("invalid BLOOM_REBUILD_INTERVAL: %v", err) }
+		if err := svc.EnableSeenFilter(cfg.Cache.BloomExpectedUsers, cfg.Cache.BloomFPRate); err != nil { log.Fatalf("seen filter: %v", err) }
+		go svc.RunSeenFilter(ctx, interval)
+	}
+	// Sampled cache-vs-KV comparison; caches are per node, so every node runs its own
+	verifyInterval, _ := cfg.Cache.GetVerifyInterval()
+	if verifyInterval > 0 {
+		verifyGrace, _ := cfg.Cache.GetVerifyGrace()
+		go svc.RunCacheVerifier(ctx, verifyInterval, cfg.Cache.VerifySample, verifyGrace)
+	}
+	// Automatic away/offline changes; leaves share the center's bucket, so only centers scan it
+	transitionInterval, _ := cfg.Presence.GetTransitionInterval()
+	if transitionInterval > 0 && cfg.Service.NodeType == "center" {
+		awayAfter, _ := cfg.Presence.GetAwayAfter()
+		go svc.RunPresenceTransitions(ctx, transitionInterval, awayAfter)
+	}
+	// Heartbeat refreshes held back from KV, one write per user per interval
+	if writeCoalesce, _ := cfg.Presence.GetWriteCoalesce(); writeCoalesce > 0 {
+		svc.EnableWriteCoalescing(writeCoalesce)
+		go svc.RunWriteCoalescing(ctx)
+	}
+	// Offline write-behind: accept writes while the center is unreachable
+	if cfg.WriteBehind.Enabled {
+		replayInterval, err := cfg.WriteBehind.GetReplayInterval()
+		if err != nil { log.Fatalf("invalid WRITE_BEHIND_REPLAY_INTERVAL: %v", err) }
+		queue, err := writebehind.Open(cfg.WriteBehind.Path)
+		if err != nil { log.Fatalf("write-behind queue: %v", err) }
+		defer queue.Close()
+		svc.EnableWriteBehind(queue)
+		go svc.RunWriteBehind(ctx, replayInterval)
+	}
+	// Bucket mirror/replica lag for kv_sync_* metrics and /health/details; proxies have no bucket to poll
+	healthInterval, err := cfg.NATS.GetHealthInterval()
+	if err != nil { log.Fatalf("invalid NATS_HEALTH_INTERVAL: %v", err) }
+	if healthInterval > 0 && cfg.Service.NodeType != nats.NodeTypeProxy {
+		go svc.RunStoreHealth(ctx, healthInterval)
+		go svc.RunConsumerLag(ctx, healthInterval)
+	}
+	// Warm standby: take over from the primary center once it stays unreachable
+	if cfg.NATS.PrimaryURL != "" {
+		failoverAfter, _ := cfg.NATS.GetFailoverAfter()
+		go svc.RunFailover(ctx, time.Second, failoverAfter)
+	}
+	// Summaries of the repeats the log sampler dropped, once their window is over
+	if logSampler != nil {
+		window, _ := cfg.Logging.GetSampleWindow()
+		go logSampler.Run(ctx, window)
+	}
+	if err := svc.Watch(ctx, func(we nats.WatchEvent) {
+		svc.ObserveWatchEvent(we)
+		// A promotion's replay only moves revisions, so subscribers aren't told
+		if we.Replay { idx.Apply(events.FromWatchEvent(we)); return }
+		// Duplicate and out-of-order revisions stop at the hub
+		if ev := events.FromWatchEvent(we); hub.Publish(ev) {
+			idx.Apply(ev)
+			if results != nil { results.Invalidate(ev.UserID) }
+		}
+	}); err != nil { log.Fatalf("watch: %v", err) }
+	// Load the stored presences into the index behind the watch; readiness waits for it
+	go svc.RunIndexResync(ctx, idx, 5*time.Second)
+	// Store requests of proxy nodes, each answered by one of the nodes holding the bucket
+	if cfg.NATS.ProxyResponder && cfg.Service.NodeType != nats.NodeTypeProxy {
+		if err := svc.ServeProxy(ctx); err != nil { log.Fatalf("proxy responder: %v", err) }
+	}
+	// Orderly drain on SIGTERM or POST /api/v2/admin/drain; steps are added below
+	drainTimeout, _ := cfg.Service.GetDrainTimeout()
+	drainDelay, _ := cfg.Service.GetDrainDelay()
+	drainer := drain.New(drainTimeout)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		drainer.Start()
+	}()
+	// Forward changes to event sinks, each consumed once across the fleet;
+	// stopped on drain so other nodes take over durable consumers
+	sinkCtx, stopSinks := context.WithCancel(ctx)
+	defer stopSinks()
+	sinkConfigs, err := cfg.Sinks.GetSinks()
+	if err != nil { log.Fatalf("invalid EVENT_SINKS: %v", err) }
+	var backfiller *sinks.Backfiller
+	if len(sinkConfigs) > 0 {
+		bus, err := svc.EventBus()
+		if err != nil { log.Fatalf("event sinks: %v", err) }
+		specs := make([]sinks.Spec, 0, len(sinkConfigs))
+		for _, sc := range sinkConfigs {
+			spec := sinks.Spec{Name: sc.Name, Kind: sc.Kind, Target: sc.Target, Mode: sinks.Mode(sc.Mode), Version: sc.Version}
+			if spec.Kind == sinks.KindNATS {
+				spec.Target = cfg.NATS.ScopedSubject(spec.Target)
+			}
+			if err := sinks.Start(sinkCtx, bus, spec); err != nil { log.Fatalf("event sink %s: %v", sc.Name, err) }
+			specs = append(specs, spec)
+		}
+		// Legacy history is backfilled into the streams of at-least-once NATS sinks
+		backfiller = sinks.NewBackfiller(bus, specs)
+	}
+	// Signed presence-change webhooks, retried with backoff; shares the
+	// sinks' lifetime so a draining node hands dispatch over
+	hookConfigs, _ := cfg.Webhooks.GetEndpoints()
+	if len(hookConfigs) > 0 {
+		bus, err := svc.EventBus()
+		if err != nil { log.Fatalf("webhooks: %v", err) }
+		endpoints := make([]webhooks.Endpoint, 0, len(hookConfigs))
+		for _, hc := range hookConfigs {
+			endpoints = append(endpoints, webhooks.Endpoint{Name: hc.Name, URL: hc.URL, Secret: hc.Secret})
+		}
+		backoff, _ := cfg.Webhooks.GetBackoff()
+		maxBackoff, _ := cfg.Webhooks.GetMaxBackoff()
+		hookTimeout, _ := cfg.Webhooks.GetTimeout()
+		policy := webhooks.Policy{MaxAttempts: cfg.Webhooks.MaxAttempts, Backoff: backoff, MaxBackoff: maxBackoff, Timeout: hookTimeout}
+		if err := webhooks.New(endpoints, policy).Run(sinkCtx, bus); err != nil { log.Fatalf("webhooks: %v", err) }
+	}
+
 	// Router
 	r := mux.NewRouter()
 	// Metrics endpoint
 	r.Handle("/metrics", metrics.Handler())
+	// Build info, also reported as the build_info metric and X-Node-Version
+	build := version.Get()
+	metrics.SetBuildInfo(build)
+	r.HandleFunc("/version", handlers.Version).Methods(http.MethodGet)
 
 	// Health routes
-	hh := handlers.NewHealthHandler(svc)
+	hh := handlers.NewHealthHandler(svc, drainer, idx)
 	r.HandleFunc("/health/liveness", hh.Liveness).Methods(http.MethodGet)
 	r.HandleFunc("/health/readiness", hh.Readiness).Methods(http.MethodGet)
+	r.HandleFunc("/health/details", hh.Details).Methods(http.MethodGet)
 
 	// API routes (instrumented)
-	ph := handlers.NewPresenceHandler(svc)
-	r.Handle("/api/v2/presence/{user_id}", metrics.Middleware("presence.user", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+	node := models.NodeInfo{ID: cfg.Service.NodeID, Type: cfg.Service.NodeType, Region: cfg.Service.Region, Version: build.Version}
+	phOpts := []handlers.Option{handlers.WithNode(node), handlers.WithNDJSONChunkSize(cfg.API.NDJSONChunkSize), handlers.WithIndex(idx)}
+	var ihOpts []handlers.IndexOption
+	if results != nil {
+		phOpts = append(phOpts, handlers.WithResultCache(results))
+		ihOpts = append(ihOpts, handlers.WithStatsCache(results))
+	}
+	wsOpts := []stream.Option{stream.WithNodeID(node.ID)}
+	grpcOpts := []grpcserver.Option{grpcserver.WithWatchBuffer(cfg.GRPC.WatchBuffer), grpcserver.WithNode(node)}
+	subOpts := []subscriptions.Option{subscriptions.WithNodeID(node.ID)}
+	if cfg.Privacy.Pseudonymize {
+		p, err := privacy.NewPseudonymizer(cfg.Privacy.PseudonymKey)
+		if err != nil { log.Fatalf("pseudonymizer: %v", err) }
+		phOpts = append(phOpts, handlers.WithPseudonymizer(p))
+		wsOpts = append(wsOpts, stream.WithPseudonymizer(p))
+		grpcOpts = append(grpcOpts, grpcserver.WithPseudonymizer(p))
+		subOpts = append(subOpts, subscriptions.WithPseudonymizer(p))
+	}
+	// Presence subscriptions: rosters registered once, then pushed over SSE, the stream or webhooks
+	if cfg.Subscriptions.Enabled {
+		defaultTTL, _ := cfg.Subscriptions.GetDefaultTTL()
+		maxTTL, _ := cfg.Subscriptions.GetMaxTTL()
+		if cfg.Subscriptions.Webhooks {
+			schemaName, _ := events.PayloadSchema(events.DefaultPayloadVersion)
+			guard := subscriptions.NewWebhookGuard(cfg.Subscriptions.GetWebhookHosts())
+			client := guard.Client()
+			subOpts = append(subOpts, subscriptions.WithWebhookGuard(guard),
+				subscriptions.WithWebhooks(func(url string) sinks.Sink { return sinks.NewWebhookClient(url, schemaName, client) }))
+		}
+		subs := subscriptions.NewRegistry(subscriptions.Limits{MaxPerOwner: cfg.Subscriptions.MaxPerUser, MaxUsers: cfg.Subscriptions.MaxUsers, DefaultTTL: defaultTTL, MaxTTL: maxTTL}, subOpts...)
+		go subs.Run(ctx, hub)
+		phOpts = append(phOpts, handlers.WithSubscriptions(subs))
+		wsOpts = append(wsOpts, stream.WithRosters(subs))
+	}
+	// Contact lists from the directory service, for the one-call "my contacts" read
+	if cfg.Contacts.URL != "" {
+		contactsTimeout, _ := cfg.Contacts.GetTimeout()
+		source, err := contacts.NewHTTPSource(cfg.Contacts.URL, cfg.Contacts.MaxContacts, contactsTimeout)
+		if err != nil { log.Fatalf("contacts: %v", err) }
+		phOpts = append(phOpts, handlers.WithContacts(source))
+	}
+	// Annotations trusted services attach to presences, kept apart from what users write and merged into reads
+	if namespaces := cfg.Annotations.GetNamespaces(); len(namespaces) > 0 {
+		bucket, err := svc.OpenAnnotations(ctx, cfg.NATS.Scoped(cfg.Annotations.Bucket))
+		if err != nil { log.Fatalf("annotation bucket: %v", err) }
+		notes, err := annotations.New(bucket, namespaces, annotations.Limits{MaxKeys: cfg.Annotations.MaxKeys, MaxBytes: cfg.Annotations.MaxBytes})
+		if err != nil { log.Fatalf("annotations: %v", err) }
+		if err := notes.Run(ctx); err != nil { log.Fatalf("annotations: %v", err) }
+		svc.EnableAnnotations(notes)
+		phOpts = append(phOpts, handlers.WithAnnotations(notes))
+	}
+	if backfiller != nil && len(backfiller.Sinks()) > 0 {
+		phOpts = append(phOpts, handlers.WithBackfiller(backfiller))
+	}
+	ph := handlers.NewPresenceHandler(svc, phOpts...)
+	var jwtOpts []auth.Option
+	// RS256 and ES256 tokens of the identity provider, validated with its published keys
+	if cfg.Auth.JWKSURL != "" {
+		jwks := auth.NewJWKS(cfg.Auth.JWKSURL)
+		if err := jwks.Refresh(ctx); err != nil { log.Printf("jwks: %v; retrying as tokens arrive", err) }
+		jwksRefresh, _ := cfg.Auth.GetJWKSRefresh()
+		go jwks.Run(ctx, jwksRefresh)
+		jwtOpts = append(jwtOpts, auth.WithJWKS(jwks))
+	}
+	// Scopes granted by the roles of tokens from identity providers that can't issue scopes
+	if roles, _ := cfg.Auth.GetRoles(); len(roles) > 0 {
+		jwtOpts = append(jwtOpts, auth.WithRoles(cfg.Auth.RolesClaim, roles))
+	}
+	// Token checks for routes that require authentication; every other route authenticates optionally
+	jwtmw := auth.NewJWTMiddleware(cfg.Auth.JWTSecret, cfg.Auth.JWTIssuer, jwtOpts...)
+	// Authorization of presence and admin routes: none, owner-only, scope-based or an external policy service
+	authzTimeout, err := cfg.Auth.GetAuthorizerTimeout()
+	if err != nil { log.Fatalf("invalid AUTHZ_TIMEOUT: %v", err) }
+	authorizer, err := auth.NewAuthorizer(cfg.Auth.Authorizer, cfg.Auth.AuthorizerURL, authzTimeout, cfg.Auth.GetServiceAccounts())
+	if err != nil { log.Fatalf("authorizer: %v", err) }
+	// Callers set only their own presence unless they are admins or trusted services
+	if cfg.Auth.SelfWrites { authorizer = auth.SelfWrites{Next: authorizer, ServiceAccounts: cfg.Auth.GetServiceAccounts()} }
+	readAll := func(*http.Request) (string, string) { return auth.ActionRead, "" }
+	targetUser := func(r *http.Request) (string, string) {
+		if r.Method == http.MethodPut {
+			return auth.ActionWrite, mux.Vars(r)["user_id"]
+		}
+		return auth.ActionRead, mux.Vars(r)["user_id"]
+	}
+	writeAll := func(*http.Request) (string, string) { return auth.ActionWrite, "" }
+	adminOf := func(r *http.Request) (string, string) { return auth.ActionAdmin, mux.Vars(r)["user_id"] }
+
+	// Caps on the WebSocket and SSE connections each user and tenant hold open
+	connLimit := func(h http.Handler) http.Handler { return h }
+	if cfg.Stream.MaxConnectionsPerUser > 0 || cfg.Stream.MaxConnectionsPerTenant > 0 {
+		connLimit = connlimit.New(connlimit.Limits{PerUser: cfg.Stream.MaxConnectionsPerUser, PerTenant: cfg.Stream.MaxConnectionsPerTenant}).Middleware
+	}
+
+	// WebSocket stream (registered ahead of the {user_id} routes)
+	pingInterval, err := cfg.Stream.GetPingInterval()
+	if err != nil { log.Fatalf("invalid STREAM_PING_INTERVAL: %v", err) }
+	resumeWindow, err := cfg.Stream.GetResumeWindow()
+	if err != nil { log.Fatalf("invalid STREAM_RESUME_WINDOW: %v", err) }
+	if cfg.Stream.ImplicitPresence {
+		implicitTTL, _ := cfg.Stream.GetImplicitTTL()
+		offlineDebounce, _ := cfg.Stream.GetOfflineDebounce()
+		wsOpts = append(wsOpts, stream.WithImplicitPresence(svc, implicitTTL, offlineDebounce))
+	}
+	ws := stream.NewHandler(hub, svc, stream.Config{
+		MaxSubscriptions: cfg.Stream.MaxSubscriptions,
+		SendBuffer:       cfg.Stream.SendBuffer,
+		PingInterval:     pingInterval,
+		ResumeWindow:     resumeWindow,
+		ResumeBuffer:     cfg.Stream.ResumeBuffer,
+	}, wsOpts...)
+	r.Handle("/api/v2/stream/ws", auth.Authorize(authorizer, readAll, connLimit(ws))).Methods(http.MethodGet)
+
+	// Index-backed queries (registered ahead of the {user_id} routes)
+	ih := handlers.NewIndexHandler(idx, ihOpts...)
+	r.Handle("/api/v2/presence/stats", auth.Authorize(authorizer, readAll, http.HandlerFunc(ih.Stats))).Methods(http.MethodGet)
+	r.Handle("/api/v2/presence/online", auth.Authorize(authorizer, readAll, http.HandlerFunc(ih.Online))).Methods(http.MethodGet)
+	r.Handle("/api/v2/presence/list", auth.Authorize(authorizer, readAll, http.HandlerFunc(ih.List))).Methods(http.MethodGet)
+	r.Handle("/api/v2/presence/status/{status}", auth.Authorize(authorizer, readAll, http.HandlerFunc(ih.ByStatus))).Methods(http.MethodGet)
+
+	// Presence REST routes: hand-written handlers, or the grpc-gateway mapping
+	// generated from proto/presence/v1/presence.proto
+	var userRoute http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
 		switch r.Method {
 		case http.MethodGet:
 			ph.GetPresence(w, r)
@@ -47,20 +367,243 @@ func main(){
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
-	}), svc.Cache())).Methods(http.MethodGet, http.MethodPut, http.MethodOptions)
-	r.Handle("/api/v2/presence", metrics.Middleware("presence.multi", http.HandlerFunc(ph.GetMultiplePresences), svc.Cache())).Methods(http.MethodGet, http.MethodOptions)
-	r.Handle("/api/v2/presence/batch", metrics.Middleware("presence.batch", http.HandlerFunc(ph.BatchPresence), svc.Cache())).Methods(http.MethodPost, http.MethodOptions)
+	})
+	var multiRoute, batchRoute http.Handler = http.HandlerFunc(ph.GetMultiplePresences), http.HandlerFunc(ph.BatchPresence)
+	if cfg.GRPC.Gateway {
+		gw, err := gateway.NewHandler(ctx, grpcserver.NewServer(svc, hub, grpcOpts...))
+		if err != nil { log.Fatalf("grpc-gateway: %v", err) }
+		// Dry runs and conditional writes have no gateway mapping and are always served by hand
+		byHand := userRoute
+		userRoute = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if r.URL.Query().Has("dry_run") || r.Header.Get("If-Match") != "" {
+				byHand.ServeHTTP(w, r)
+				return
+			}
+			gw.ServeHTTP(w, r)
+		})
+		multiRoute, batchRoute = gw, gw
+	}
+	schemas, err := schema.NewRegistry()
+	if err != nil { log.Fatalf("schemas: %v", err) }
+	r.Handle("/api/v2/schemas", schemas.Handler()).Methods(http.MethodGet)
+	r.Handle("/api/v2/schemas/{name}", schemas.Handler()).Methods(http.MethodGet)
+	userRoute = schemas.ValidateBody(schema.SetPresenceRequest, userRoute)
+	batchRoute = schemas.ValidateBody(schema.BatchPresenceRequest, batchRoute)
+	// Batch writes have no gateway mapping and are always served by hand
+	var batchSetRoute http.Handler = schemas.ValidateBody(schema.BatchSetRequest, http.HandlerFunc(ph.BatchSetPresence))
+	userRoute = auth.Authorize(authorizer, targetUser, userRoute)
+	multiRoute = auth.Authorize(authorizer, readAll, multiRoute)
+	batchRoute = auth.Authorize(authorizer, readAll, batchRoute)
+	batchSetRoute = auth.Authorize(authorizer, writeAll, batchSetRoute)
+	// Per-client token buckets, keyed by user ID or IP, turn write storms away before they reach NATS
+	limit := func(route string, h http.Handler) http.Handler { return h }
+	if cfg.RateLimit.Enabled {
+		var limitOpts []ratelimit.Option
+		if cfg.RateLimit.TrustForwarded {
+			limitOpts = append(limitOpts, ratelimit.WithTrustedProxy())
+		}
+		limiter := ratelimit.New(ratelimit.Limits{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst}, limitOpts...)
+		go limiter.Run(ctx, time.Minute)
+		limit = limiter.Middleware
+	}
+	// Per-tenant daily/monthly quotas, counted in KV and reported for billing
+	instrument := func(route string, h http.Handler) http.Handler { return metrics.Middleware(route, limit(route, h), svc.Cache()) }
+	var quotas *quota.Tracker
+	if cfg.Quota.Enabled {
+		routeLimits, err := cfg.Quota.GetRouteDailyLimits()
+		if err != nil { log.Fatalf("invalid QUOTA_ROUTE_DAILY_LIMITS: %v", err) }
+		flushInterval, err := cfg.Quota.GetFlushInterval()
+		if err != nil { log.Fatalf("invalid QUOTA_FLUSH_INTERVAL: %v", err) }
+		counters, err := svc.OpenCounters(ctx, cfg.NATS.Scoped(cfg.Quota.Bucket))
+		if err != nil { log.Fatalf("quota counters: %v", err) }
+		quotas = quota.NewTracker(counters, quota.Limits{Daily: cfg.Quota.DailyLimit, Monthly: cfg.Quota.MonthlyLimit, RouteDaily: routeLimits})
+		go quotas.Run(ctx, flushInterval)
+		instrument = func(route string, h http.Handler) http.Handler { return metrics.Middleware(route, limit(route, quotas.Middleware(route, h)), svc.Cache()) }
+		r.HandleFunc("/api/v2/quota/usage", handlers.NewQuotaHandler(quotas).Usage).Methods(http.MethodGet)
+	}
+	// The caller's own presence, resolved from the token (registered ahead of {user_id})
+	r.Handle("/api/v2/presence/me/contacts", jwtmw.Authenticate(instrument("presence.contacts", auth.Authorize(authorizer, readAll, http.HandlerFunc(ph.GetContacts))))).Methods(http.MethodGet)
+	r.Handle("/api/v2/presence/{user_id}/annotations/{namespace}", jwtmw.Authenticate(instrument("presence.annotations", http.HandlerFunc(ph.SetAnnotations)))).Methods(http.MethodPut)
+	r.Handle("/api/v2/presence/{user_id}/annotations/{namespace}", jwtmw.Authenticate(instrument("presence.annotations", http.HandlerFunc(ph.ClearAnnotations)))).Methods(http.MethodDelete)
+	// Keep-alives that refresh a presence without resending it
+	heartbeatRoute := auth.Authorize(authorizer, func(r *http.Request) (string, string) { return auth.ActionWrite, mux.Vars(r)["user_id"] }, http.HandlerFunc(ph.Heartbeat))
+	r.Handle("/api/v2/presence/{user_id}/heartbeat", instrument("presence.heartbeat", heartbeatRoute)).Methods(http.MethodPost)
+	// Partial updates that merge into the stored presence; no gateway mapping, so always served by hand
+	patchRoute := auth.Authorize(authorizer, func(r *http.Request) (string, string) { return auth.ActionWrite, mux.Vars(r)["user_id"] }, http.HandlerFunc(ph.PatchPresence))
+	r.Handle("/api/v2/presence/{user_id}", instrument("presence.patch", schemas.ValidateBody(schema.PatchPresenceRequest, patchRoute))).Methods(http.MethodPatch)
+	r.Handle("/api/v2/presence/me", jwtmw.Authenticate(instrument("presence.me", handlers.Self(userRoute)))).Methods(http.MethodGet, http.MethodPut)
+	// Desired-state sync of a user ID namespace, audited and marked source=sync
+	reconcileRoute := auth.Authorize(authorizer, writeAll, http.HandlerFunc(ph.Reconcile))
+	r.Handle("/api/v2/presence/reconcile", jwtmw.RequireScope(auth.ScopeAdmin, instrument("presence.reconcile", reconcileRoute))).Methods(http.MethodPost)
+	r.Handle("/api/v2/presence/{user_id}", instrument("presence.user", userRoute)).Methods(http.MethodGet, http.MethodPut, http.MethodOptions)
+	r.Handle("/api/v2/presence", instrument("presence.multi", multiRoute)).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/api/v2/presence/batch", instrument("presence.batch", batchRoute)).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/api/v2/presence/batch-set", instrument("presence.batch_set", batchSetRoute)).Methods(http.MethodPost, http.MethodOptions)
+	// Presence subscriptions of the caller, held by the node that created them
+	subscriptionRoute := func(h http.HandlerFunc) http.Handler { return jwtmw.Authenticate(instrument("subscriptions", auth.Authorize(authorizer, readAll, h))) }
+	r.Handle("/api/v2/subscriptions", subscriptionRoute(ph.CreateSubscription)).Methods(http.MethodPost)
+	r.Handle("/api/v2/subscriptions", subscriptionRoute(ph.ListSubscriptions)).Methods(http.MethodGet)
+	r.Handle("/api/v2/subscriptions/{subscription_id}", subscriptionRoute(ph.GetSubscription)).Methods(http.MethodGet)
+	r.Handle("/api/v2/subscriptions/{subscription_id}", subscriptionRoute(ph.DeleteSubscription)).Methods(http.MethodDelete)
+	r.Handle("/api/v2/subscriptions/{subscription_id}/renew", subscriptionRoute(ph.RenewSubscription)).Methods(http.MethodPost)
+	r.Handle("/api/v2/subscriptions/{subscription_id}/events", subscriptionRoute(connLimit(ws.Track(http.HandlerFunc(ph.SubscriptionEvents))).ServeHTTP)).Methods(http.MethodGet)
+	// Admin override of another user's presence, audited and marked source=admin
+	adminRoute := auth.Authorize(authorizer, adminOf, schemas.ValidateBody(schema.SetPresenceRequest, http.HandlerFunc(ph.AdminSetPresence)))
+	r.Handle("/api/v2/admin/presence/{user_id}", jwtmw.RequireScope(auth.ScopeAdmin, instrument("presence.admin", adminRoute))).Methods(http.MethodPut)
+	adminDeleteRoute := auth.Authorize(authorizer, adminOf, http.HandlerFunc(ph.AdminDeletePresence))
+	r.Handle("/api/v2/admin/presence/{user_id}", jwtmw.RequireScope(auth.ScopeAdmin, instrument("presence.admin", adminDeleteRoute))).Methods(http.MethodDelete)
+	// Every live presence, paged from the fleet-wide index
+	presencesRoute := auth.Authorize(authorizer, func(*http.Request) (string, string) { return auth.ActionAdmin, "presences" }, http.HandlerFunc(ih.Presences))
+	r.Handle("/api/v2/admin/presences", jwtmw.RequireScope(auth.ScopeAdmin, instrument("admin.presences", presencesRoute))).Methods(http.MethodGet)
+	// Cache and store status of this node, and a cache flush
+	nah := handlers.NewNodeAdminHandler(svc, nil)
+	nodeAdminRoute := func(h http.HandlerFunc) http.Handler {
+		target := func(*http.Request) (string, string) { return auth.ActionAdmin, "node" }
+		return jwtmw.RequireScope(auth.ScopeAdmin, auth.Authorize(authorizer, target, instrument("admin.node", h)))
+	}
+	r.Handle("/api/v2/admin/status", nodeAdminRoute(nah.Status)).Methods(http.MethodGet)
+	r.Handle("/api/v2/admin/cache/flush", nodeAdminRoute(nah.FlushCache)).Methods(http.MethodPost)
+	// Junk keys in the bucket, reported and optionally repaired or deleted in the background
+	kah := handlers.NewKeyAuditHandler(svc, nil)
+	keyAuditRoute := func(h http.HandlerFunc) http.Handler {
+		target := func(*http.Request) (string, string) { return auth.ActionAdmin, "keys" }
+		return jwtmw.RequireScope(auth.ScopeAdmin, auth.Authorize(authorizer, target, instrument("admin.keys", h)))
+	}
+	r.Handle("/api/v2/admin/keys/audit", keyAuditRoute(kah.Report)).Methods(http.MethodGet)
+	r.Handle("/api/v2/admin/keys/audit", keyAuditRoute(kah.Start)).Methods(http.MethodPost)
+	// Lag of durable change consumers, such as at-least-once event sinks
+	consumersRoute := auth.Authorize(authorizer, func(*http.Request) (string, string) { return auth.ActionAdmin, "consumers" }, http.HandlerFunc(handlers.NewConsumersHandler(svc).Lag))
+	r.Handle("/api/v2/admin/consumers", jwtmw.RequireScope(auth.ScopeAdmin, instrument("admin.consumers", consumersRoute))).Methods(http.MethodGet)
+	// Status changes from a legacy system, backfilled into event sink streams during a migration
+	backfillRoute := auth.Authorize(authorizer, func(*http.Request) (string, string) { return auth.ActionAdmin, "history" }, http.HandlerFunc(ph.Backfill))
+	r.Handle("/api/v2/admin/history/backfill", jwtmw.RequireScope(auth.ScopeAdmin, instrument("admin.backfill", backfillRoute))).Methods(http.MethodPost)
+	// Presences a node last wrote, from the fleet-wide index
+	nodeRoute := auth.Authorize(authorizer, func(*http.Request) (string, string) { return auth.ActionAdmin, "nodes" }, http.HandlerFunc(ih.ByNode))
+	r.Handle("/api/v2/admin/nodes/{node_id}/presences", jwtmw.RequireScope(auth.ScopeAdmin, instrument("admin.nodes", nodeRoute))).Methods(http.MethodGet)
+	// Stream sessions on this node, listed and force-closed by admins
+	sh := handlers.NewSessionsHandler(ws, nil)
+	sessionsRoute := func(h http.HandlerFunc) http.Handler {
+		target := func(*http.Request) (string, string) { return auth.ActionAdmin, "sessions" }
+		return jwtmw.RequireScope(auth.ScopeAdmin, auth.Authorize(authorizer, target, instrument("admin.sessions", h)))
+	}
+	r.Handle("/api/v2/admin/sessions", sessionsRoute(sh.List)).Methods(http.MethodGet)
+	r.Handle("/api/v2/admin/sessions", sessionsRoute(sh.Disconnect)).Methods(http.MethodDelete)
+	r.Handle("/api/v2/admin/sessions/{session_id}", sessionsRoute(sh.Disconnect)).Methods(http.MethodDelete)
+	// Node drain, started by admins ahead of a deploy
+	dh := handlers.NewDrainHandler(drainer, nil)
+	drainRoute := func(h http.HandlerFunc) http.Handler {
+		target := func(*http.Request) (string, string) { return auth.ActionAdmin, "drain" }
+		return jwtmw.RequireScope(auth.ScopeAdmin, auth.Authorize(authorizer, target, instrument("admin.drain", h)))
+	}
+	r.Handle("/api/v2/admin/drain", drainRoute(dh.Status)).Methods(http.MethodGet)
+	r.Handle("/api/v2/admin/drain", drainRoute(dh.Start)).Methods(http.MethodPost)
+	// Runtime log level, raised by admins during an incident and reverted automatically
+	logOverride, _ := cfg.Logging.GetOverrideDuration()
+	lh := handlers.NewLogLevelHandler(logLevel, logOverride, nil)
+	logLevelRoute := func(h http.HandlerFunc) http.Handler {
+		target := func(*http.Request) (string, string) { return auth.ActionAdmin, "loglevel" }
+		return jwtmw.RequireScope(auth.ScopeAdmin, auth.Authorize(authorizer, target, instrument("admin.loglevel", h)))
+	}
+	r.Handle("/api/v2/admin/loglevel", logLevelRoute(lh.Get)).Methods(http.MethodGet)
+	r.Handle("/api/v2/admin/loglevel", logLevelRoute(lh.Set)).Methods(http.MethodPut)
+	r.Handle("/api/v2/admin/loglevel", logLevelRoute(lh.Reset)).Methods(http.MethodDelete)
+	r.NotFoundHandler = metrics.NotFound(svc.Cache())
+
+	// Drain steps, run in order once readiness starts failing
+	drainer.Add("wait for load balancers", drain.Wait(drainDelay))
+	drainer.Add("close stream sessions", ws.Drain)
+	drainer.Add("stop event sinks", func(context.Context) error { stopSinks(); return nil })
+	drainer.Add("flush write-behind queue", func(ctx context.Context) error { _, err := svc.ReplayWriteBehind(ctx); return err })
+	if quotas != nil {
+		drainer.Add("flush quota counters", quotas.Flush)
+	}
+
+	// Optional gRPC surface on its own port
+	if cfg.GRPC.Enabled {
+		grpcAddr := net.JoinHostPort(cfg.Service.Host, strconv.Itoa(cfg.GRPC.Port))
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil { log.Fatalf("grpc listen: %v", err) }
+		gs := grpc.NewServer()
+		// The gateway's calls were authorized as REST requests; direct calls are authorized here
+		grpcserver.NewServer(svc, hub, append(grpcOpts, grpcserver.WithAuthorization(jwtmw, authorizer))...).Register(gs)
+		defer gs.Stop()
+		// Watch streams never end on their own: past the drain deadline, stop waiting for them
+		drainer.Add("stop gRPC server", func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() { gs.GracefulStop(); close(stopped) }()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				gs.Stop()
+				return ctx.Err()
+			}
+		})
+		go func() {
+			log.Printf("starting gRPC server on %s", grpcAddr)
+			if err := gs.Serve(lis); err != nil { log.Printf("grpc serve: %v", err) }
+		}()
+	}
 
-	// Middlewares: CORS -> Auth (example uses optional auth for demonstration)
+	// Error message catalogs beyond the built-in languages, or overriding their messages
+	if cfg.API.LocalesDir != "" {
+		if err := i18n.LoadDir(cfg.API.LocalesDir); err != nil { log.Fatalf("error message catalogs: %v", err) }
+	}
+	// Per-client default response shapes, e.g. flat arrays for legacy consumers
+	profileMap, err := cfg.API.GetResponseProfiles()
+	if err != nil { log.Fatalf("invalid API_RESPONSE_PROFILES: %v", err) }
+	profiles, err := handlers.NewResponseProfiles(profileMap)
+	if err != nil { log.Fatalf("response profiles: %v", err) }
+
+	// API version negotiation by path or Accept media type, with retirement headers of deprecated versions
+	deprecations, err := cfg.API.GetDeprecations()
+	if err != nil { log.Fatalf("invalid API_DEPRECATIONS: %v", err) }
+	retirements := map[string]apiversion.Retirement{}
+	for _, d := range deprecations {
+		retirements[d.Version] = apiversion.Retirement{Deprecated: d.Deprecated, Sunset: d.Sunset, Link: d.Link}
+	}
+	versions, err := apiversion.New([]string{"v2"}, retirements)
+	if err != nil { log.Fatalf("api versions: %v", err) }
+
+	// Panics become 500s, and go to the error tracker when one is configured
+	var panicReporter recovery.Reporter
+	if cfg.Service.ErrorReportURL != "" {
+		reportTimeout, _ := cfg.Service.GetErrorReportTimeout()
+		panicReporter = recovery.NewHTTPReporter(cfg.Service.ErrorReportURL, reportTimeout, node.ID)
+	}
+
+	// Middlewares: node headers -> Request ID -> panic recovery -> Auth -> response profiles -> CORS -> debug timings -> API version (example uses optional auth for demonstration)
 	var handler http.Handler = r
+	handler = versions.Middleware(handler)
+	handler = timing.Middleware(handler)
 	handler = handlers.CORSMiddleware(handler)
-	jwtmw := auth.NewJWTMiddleware(cfg.Auth.JWTSecret, cfg.Auth.JWTIssuer)
+	handler = profiles.Middleware(handler)
 	handler = jwtmw.OptionalAuthenticate(handler)
+	handler = recovery.Middleware(panicReporter, handler)
+	handler = requestid.Middleware(handler)
+	handler = handlers.NodeHeaders(node, handler)
 
-	port := os.Getenv("SERVICE_PORT")
-	if port == "" { port = "8080" }
-	log.Printf("starting presence-service on :%s", port)
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
+	addr := cfg.Service.ListenAddr()
+	// TLS termination, with client certificates required when SERVICE_CLIENT_CA is set
+	tlsConfig, err := cfg.Service.GetTLSConfig()
+	if err != nil { log.Fatalf("tls: %v", err) }
+	srv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+	serveErr := make(chan error, 1)
+	if tlsConfig != nil {
+		log.Printf("starting presence-service on %s (TLS, client certificates required: %t)", addr, tlsConfig.ClientCAs != nil)
+		go func() { serveErr <- srv.ListenAndServeTLS("", "") }()
+	} else {
+		log.Printf("starting presence-service on %s", addr)
+		go func() { serveErr <- srv.ListenAndServe() }()
+	}
+	select {
+	case err := <-serveErr:
 		log.Fatalf("listen: %v", err)
+	case <-drainer.Done():
 	}
+	// Drained: finish in-flight requests by the drain deadline, then exit through the deferred closes
+	shutdownCtx, cancelShutdown := context.WithDeadline(context.Background(), drainer.Deadline())
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil { log.Printf("http shutdown: %v", err) }
+	log.Printf("presence-service drained, exiting")
 }
\ No newline at end of file
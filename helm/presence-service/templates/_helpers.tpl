@@ -99,6 +99,8 @@ Generate environment variables for the service
   value: {{ .Values.service.nodeType | quote }}
 - name: NODE_ID
   value: {{ .Values.service.nodeId | quote }}
+- name: NODE_REGION
+  value: {{ .Values.service.region | quote }}
 - name: NATS_EMBEDDED
   value: {{ .Values.nats.embedded | quote }}
 - name: NATS_SERVER_URL
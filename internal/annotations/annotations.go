@@ -0,0 +1,192 @@
+// Package annotations keeps the annotations trusted services attach to
+// users' presences, such as pager:on-call=true. They are stored in their own
+// KV bucket, apart from the presence users write, so users can't overwrite
+// them. Every node holds all of them in memory, fed by a watch of the
+// bucket, and merges them into presences as they are read.
+package annotations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sync"
+)
+
+// Scope returns the token scope that grants writes to namespace
+func Scope(namespace string) string { return "annotations:" + namespace }
+
+// Bucket stores the annotations of a user in a namespace as one entry;
+// *nats.Annotations implements it
+type Bucket interface {
+	Put(ctx context.Context, namespace, userID string, value []byte) error
+	Delete(ctx context.Context, namespace, userID string) error
+	// Watch delivers the stored entries before returning, then each change
+	// until ctx is done; value is nil for deleted entries
+	Watch(ctx context.Context, callback func(namespace, userID string, value []byte)) error
+}
+
+// Limits bound the annotations of one user in one namespace
+type Limits struct {
+	MaxKeys  int // Annotations
+	MaxBytes int // Size of the keys and values together
+}
+
+// DefaultLimits are the limits of New when none are given
+var DefaultLimits = Limits{MaxKeys: 16, MaxBytes: 1024}
+
+var (
+	// ErrUnknownNamespace is returned for writes to a namespace that isn't configured
+	ErrUnknownNamespace = errors.New("unknown annotation namespace")
+	// ErrInvalid is returned for annotations that are malformed or over the limits
+	ErrInvalid = errors.New("invalid annotations")
+)
+
+// namePattern is the syntax of namespaces and annotation keys
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// Store serves the annotations of the configured namespaces
+type Store struct {
+	bucket     Bucket
+	namespaces map[string]bool
+	limits     Limits
+
+	mu     sync.RWMutex
+	byUser map[string]map[string]map[string]string // user ID -> namespace -> key -> value
+	merged map[string]map[string]string            // user ID -> "namespace:key" -> value
+}
+
+// New returns a store of the annotations in namespaces; zero fields of
+// limits take their DefaultLimits values
+func New(bucket Bucket, namespaces []string, limits Limits) (*Store, error) {
+	if limits.MaxKeys <= 0 {
+		limits.MaxKeys = DefaultLimits.MaxKeys
+	}
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultLimits.MaxBytes
+	}
+	s := &Store{
+		bucket:     bucket,
+		namespaces: make(map[string]bool, len(namespaces)),
+		limits:     limits,
+		byUser:     map[string]map[string]map[string]string{},
+		merged:     map[string]map[string]string{},
+	}
+	for _, ns := range namespaces {
+		if !namePattern.MatchString(ns) {
+			return nil, fmt.Errorf("invalid annotation namespace %q", ns)
+		}
+		s.namespaces[ns] = true
+	}
+	return s, nil
+}
+
+// Run loads the stored annotations and keeps them current until ctx is done.
+// It returns once they are loaded.
+func (s *Store) Run(ctx context.Context) error {
+	return s.bucket.Watch(ctx, func(namespace, userID string, value []byte) {
+		var values map[string]string
+		if value != nil {
+			if err := json.Unmarshal(value, &values); err != nil {
+				return
+			}
+		}
+		s.apply(namespace, userID, values)
+	})
+}
+
+// Lookup returns userID's annotations keyed "namespace:key", nil if it has
+// none. The map is shared and must not be modified.
+func (s *Store) Lookup(userID string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.merged[userID]
+}
+
+// Set replaces userID's annotations in namespace with values; empty values
+// clear them
+func (s *Store) Set(ctx context.Context, userID, namespace string, values map[string]string) error {
+	if !s.namespaces[namespace] {
+		return fmt.Errorf("%w %q", ErrUnknownNamespace, namespace)
+	}
+	if len(values) == 0 {
+		return s.Clear(ctx, userID, namespace)
+	}
+	if err := s.validate(values); err != nil {
+		return err
+	}
+	value, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := s.bucket.Put(ctx, namespace, userID, value); err != nil {
+		return err
+	}
+	// Apply right away rather than waiting for the watch, so this node reads its own write
+	s.apply(namespace, userID, maps.Clone(values))
+	return nil
+}
+
+// Clear removes userID's annotations in namespace
+func (s *Store) Clear(ctx context.Context, userID, namespace string) error {
+	if !s.namespaces[namespace] {
+		return fmt.Errorf("%w %q", ErrUnknownNamespace, namespace)
+	}
+	if err := s.bucket.Delete(ctx, namespace, userID); err != nil {
+		return err
+	}
+	s.apply(namespace, userID, nil)
+	return nil
+}
+
+func (s *Store) validate(values map[string]string) error {
+	if len(values) > s.limits.MaxKeys {
+		return fmt.Errorf("%w: %d annotations, at most %d allowed", ErrInvalid, len(values), s.limits.MaxKeys)
+	}
+	size := 0
+	for k, v := range values {
+		if !namePattern.MatchString(k) {
+			return fmt.Errorf("%w: key %q must be lowercase letters, digits, '-' or '_', starting with a letter", ErrInvalid, k)
+		}
+		size += len(k) + len(v)
+	}
+	if size > s.limits.MaxBytes {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", ErrInvalid, size, s.limits.MaxBytes)
+	}
+	return nil
+}
+
+// apply records userID's annotations in namespace, nil values removing them.
+// Entries of namespaces no longer configured are dropped.
+func (s *Store) apply(namespace, userID string, values map[string]string) {
+	if !s.namespaces[namespace] {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byNamespace := s.byUser[userID]
+	if len(values) == 0 {
+		delete(byNamespace, namespace)
+	} else {
+		if byNamespace == nil {
+			byNamespace = map[string]map[string]string{}
+			s.byUser[userID] = byNamespace
+		}
+		byNamespace[namespace] = values
+	}
+	if len(byNamespace) == 0 {
+		delete(s.byUser, userID)
+		delete(s.merged, userID)
+		return
+	}
+	// Rebuild rather than patch: Lookup's callers may still hold the old map
+	merged := map[string]string{}
+	for ns, kv := range byNamespace {
+		for k, v := range kv {
+			merged[ns+":"+k] = v
+		}
+	}
+	s.merged[userID] = merged
+}
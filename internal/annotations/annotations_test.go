@@ -0,0 +1,89 @@
+package annotations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// memBucket is a Bucket that records writes and replays entries on Watch
+type memBucket struct {
+	entries map[string][]byte
+	watch   func(namespace, userID string, value []byte)
+}
+
+func (b *memBucket) Put(_ context.Context, namespace, userID string, value []byte) error {
+	b.entries[namespace+"."+userID] = value
+	return nil
+}
+
+func (b *memBucket) Delete(_ context.Context, namespace, userID string) error {
+	delete(b.entries, namespace+"."+userID)
+	return nil
+}
+
+func (b *memBucket) Watch(_ context.Context, callback func(namespace, userID string, value []byte)) error {
+	for key, value := range b.entries {
+		namespace, userID, _ := strings.Cut(key, ".")
+		callback(namespace, userID, value)
+	}
+	b.watch = callback
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	if _, err := New(&memBucket{}, []string{"Pager"}, Limits{}); err == nil {
+		t.Fatal("expected an invalid namespace to be rejected")
+	}
+	bucket := &memBucket{entries: map[string][]byte{
+		"pager.alice": []byte(`{"on-call":"true"}`),
+		"retired.bob": []byte(`{"x":"y"}`),
+	}}
+	s, err := New(bucket, []string{"pager", "ci"}, Limits{MaxKeys: 2, MaxBytes: 32})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := s.Lookup("alice"); got["pager:on-call"] != "true" {
+		t.Fatalf("expected stored annotations to load, got %v", got)
+	}
+	if got := s.Lookup("bob"); got != nil {
+		t.Fatalf("expected entries of unconfigured namespaces to be dropped, got %v", got)
+	}
+
+	if err := s.Set(ctx, "alice", "ci", map[string]string{"build": "red"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := s.Lookup("alice"); len(got) != 2 || got["ci:build"] != "red" {
+		t.Fatalf("expected namespaces to merge, got %v", got)
+	}
+
+	for name, values := range map[string]map[string]string{
+		"too many keys": {"a": "1", "b": "2", "c": "3"},
+		"too large":     {"a": strings.Repeat("x", 40)},
+		"bad key":       {"On Call": "true"},
+	} {
+		if err := s.Set(ctx, "alice", "pager", values); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+	if err := s.Set(ctx, "alice", "hr", map[string]string{"a": "1"}); !errors.Is(err, ErrUnknownNamespace) {
+		t.Fatalf("expected ErrUnknownNamespace, got %v", err)
+	}
+
+	// A change from another node arrives through the watch
+	bucket.watch("pager", "alice", nil)
+	if got := s.Lookup("alice"); len(got) != 1 || got["ci:build"] != "red" {
+		t.Fatalf("expected the watched delete to apply, got %v", got)
+	}
+	if err := s.Set(ctx, "alice", "ci", nil); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := s.Lookup("alice"); got != nil || bucket.entries["ci.alice"] != nil {
+		t.Fatalf("expected empty annotations to clear the namespace, got %v", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Package apiversion negotiates the API version of each request, either from
+// the /api/vN path prefix or from an Accept media type such as
+// application/vnd.presence.v2+json, and announces the retirement of
+// deprecated versions with Deprecation and Sunset headers.
+package apiversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopresence/internal/i18n"
+)
+
+// Header names the version a response was served in
+const Header = "API-Version"
+
+// Error codes of refused requests
+const (
+	CodeUnsupportedVersion = "unsupported_version" // 406: Accept asks for an unknown version, or one other than the path's
+	CodeVersionRetired     = "version_retired"     // 410: the version's sunset has passed
+)
+
+const (
+	apiPrefix   = "/api/"
+	mediaPrefix = "application/vnd.presence."
+	mediaSuffix = "+json"
+)
+
+// Retirement schedules the end of a version
+type Retirement struct {
+	Deprecated time.Time // When the version was deprecated; may be announced ahead
+	Sunset     time.Time // When the version stops being served; zero if not scheduled
+	Link       string    // Migration guide, if any
+}
+
+// Negotiator resolves request versions among the served ones
+type Negotiator struct {
+	versions    map[string]bool
+	latest      string
+	retirements map[string]Retirement
+	now         func() time.Time
+}
+
+// New returns a negotiator of versions, oldest first, such as "v2";
+// requests that name no version get the last one. retirements are keyed by
+// version and must name served ones.
+func New(versions []string, retirements map[string]Retirement) (*Negotiator, error) {
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("at least one API version is required")
+	}
+	n := &Negotiator{versions: map[string]bool{}, latest: versions[len(versions)-1], retirements: retirements, now: time.Now}
+	for _, v := range versions {
+		if !IsVersion(v) {
+			return nil, fmt.Errorf("invalid API version %q", v)
+		}
+		n.versions[v] = true
+	}
+	for v := range retirements {
+		if !n.versions[v] {
+			return nil, fmt.Errorf("cannot retire unknown API version %q", v)
+		}
+	}
+	return n, nil
+}
+
+// IsVersion reports whether s names a version: "v" followed by a number
+func IsVersion(s string) bool {
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "v"))
+	return strings.HasPrefix(s, "v") && err == nil && n > 0 && !strings.HasPrefix(s, "v0")
+}
+
+// Middleware resolves the version of /api/ requests. A version in Accept
+// routes unversioned paths, e.g. /api/presence/alice, to that version's
+// handlers and must agree with the version of a versioned path; requests
+// naming no version get the latest. The vendor media type is replaced by
+// application/json, parameters such as profile kept, so handlers see a
+// plain JSON request.
+func (n *Negotiator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathVersion, rest, ok := splitPath(r.URL.Path)
+		if !ok || (pathVersion != "" && !n.versions[pathVersion]) {
+			// Not the API, or a version the router will answer 404 for
+			next.ServeHTTP(w, r)
+			return
+		}
+		accept, acceptVersion := rewriteAccept(r.Header.Get("Accept"))
+		w.Header().Add("Vary", "Accept")
+		switch {
+		case acceptVersion != "" && !n.versions[acceptVersion]:
+			writeError(w, r, http.StatusNotAcceptable, CodeUnsupportedVersion, CodeUnsupportedVersion, acceptVersion)
+			return
+		case acceptVersion != "" && pathVersion != "" && acceptVersion != pathVersion:
+			writeError(w, r, http.StatusNotAcceptable, CodeUnsupportedVersion, CodeUnsupportedVersion+".mismatch", acceptVersion, pathVersion)
+			return
+		}
+		version := pathVersion
+		if version == "" {
+			version = acceptVersion
+		}
+		if version == "" {
+			version = n.latest
+		}
+		w.Header().Set(Header, version)
+		if ret, ok := n.retirements[version]; ok {
+			setRetirementHeaders(w.Header(), ret)
+			if !ret.Sunset.IsZero() && !n.now().Before(ret.Sunset) {
+				writeError(w, r, http.StatusGone, CodeVersionRetired, CodeVersionRetired, version, ret.Sunset.UTC().Format(time.DateOnly))
+				return
+			}
+		}
+
+		if pathVersion == "" || acceptVersion != "" {
+			r = r.Clone(r.Context())
+			if pathVersion == "" {
+				r.URL.Path = apiPrefix + version + "/" + rest
+				r.URL.RawPath = ""
+			}
+			if acceptVersion != "" {
+				r.Header.Set("Accept", accept)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitPath splits an /api/ path into its version, if any, and the rest
+func splitPath(path string) (version, rest string, ok bool) {
+	after, ok := strings.CutPrefix(path, apiPrefix)
+	if !ok {
+		return "", "", false
+	}
+	first, tail, _ := strings.Cut(after, "/")
+	if IsVersion(first) {
+		return first, tail, true
+	}
+	return "", after, true
+}
+
+// rewriteAccept replaces vendor media types in an Accept value with
+// application/json and returns the version the first one names
+func rewriteAccept(accept string) (string, string) {
+	if !strings.Contains(accept, mediaPrefix) {
+		return accept, ""
+	}
+	version := ""
+	parts := strings.Split(accept, ",")
+	for i, part := range parts {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || !strings.HasPrefix(mt, mediaPrefix) || !strings.HasSuffix(mt, mediaSuffix) {
+			continue
+		}
+		if version == "" {
+			version = strings.TrimSuffix(strings.TrimPrefix(mt, mediaPrefix), mediaSuffix)
+		}
+		parts[i] = mime.FormatMediaType("application/json", params)
+	}
+	return strings.Join(parts, ","), version
+}
+
+// setRetirementHeaders announces ret: Deprecation (RFC 9745) as a
+// structured date, Sunset (RFC 8594) as an HTTP date, and Link to the
+// migration guide
+func setRetirementHeaders(h http.Header, ret Retirement) {
+	if !ret.Deprecated.IsZero() {
+		h.Set("Deprecation", "@"+strconv.FormatInt(ret.Deprecated.Unix(), 10))
+	}
+	if !ret.Sunset.IsZero() {
+		h.Set("Sunset", ret.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if ret.Link != "" {
+		h.Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", ret.Link))
+	}
+}
+
+// writeError answers with code and the message of key, localized to the
+// caller's Accept-Language
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, key string, args ...interface{}) {
+	message := i18n.Localize(w, r, key, args...)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
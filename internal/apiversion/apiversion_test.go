@@ -0,0 +1,89 @@
+package apiversion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Negotiation(t *testing.T) {
+	n, err := New([]string{"v2", "v3"}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var path, accept string
+	h := n.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, accept = r.URL.Path, r.Header.Get("Accept")
+	}))
+	serve := func(target, acceptHeader string) *httptest.ResponseRecorder {
+		path, accept = "", ""
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if acceptHeader != "" {
+			req.Header.Set("Accept", acceptHeader)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cases := []struct {
+		name, target, accept string
+		wantCode             int
+		wantPath, wantAccept string
+		wantVersion          string
+	}{
+		{"path version", "/api/v2/presence/alice", "", http.StatusOK, "/api/v2/presence/alice", "", "v2"},
+		{"accept routes unversioned path", "/api/presence/alice", "application/vnd.presence.v2+json; profile=flat", http.StatusOK, "/api/v2/presence/alice", "application/json; profile=flat", "v2"},
+		{"latest by default", "/api/presence/alice", "", http.StatusOK, "/api/v3/presence/alice", "", "v3"},
+		{"accept agrees with path", "/api/v3/presence", "application/x-protobuf, application/vnd.presence.v3+json", http.StatusOK, "/api/v3/presence", "application/x-protobuf,application/json", "v3"},
+		{"accept disagrees with path", "/api/v2/presence", "application/vnd.presence.v3+json", http.StatusNotAcceptable, "", "", ""},
+		{"unknown accept version", "/api/presence", "application/vnd.presence.v9+json", http.StatusNotAcceptable, "", "", ""},
+		{"unknown path version left to the router", "/api/v9/presence", "", http.StatusOK, "/api/v9/presence", "", ""},
+		{"outside the API", "/health/liveness", "application/vnd.presence.v9+json", http.StatusOK, "/health/liveness", "application/vnd.presence.v9+json", ""},
+	}
+	for _, tc := range cases {
+		rec := serve(tc.target, tc.accept)
+		if rec.Code != tc.wantCode || path != tc.wantPath || accept != tc.wantAccept || rec.Header().Get(Header) != tc.wantVersion {
+			t.Errorf("%s: got %d path=%q accept=%q version=%q", tc.name, rec.Code, path, accept, rec.Header().Get(Header))
+		}
+	}
+}
+
+func TestMiddleware_Retirement(t *testing.T) {
+	deprecated := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC)
+	n, err := New([]string{"v2", "v3"}, map[string]Retirement{"v2": {Deprecated: deprecated, Sunset: sunset, Link: "https://docs.example.com/v3"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	h := n.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := serve("/api/v2/presence/alice")
+	if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "@1788220800" ||
+		rec.Header().Get("Sunset") != "Mon, 01 Mar 2027 00:00:00 GMT" || rec.Header().Get("Link") != `<https://docs.example.com/v3>; rel="deprecation"` {
+		t.Fatalf("expected retirement headers, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := serve("/api/v3/presence/alice"); rec.Header().Get("Deprecation") != "" {
+		t.Fatalf("expected no retirement headers on v3, got %v", rec.Header())
+	}
+
+	now = sunset
+	if rec := serve("/api/v2/presence/alice"); rec.Code != http.StatusGone {
+		t.Fatalf("expected 410 once the sunset has passed, got %d", rec.Code)
+	}
+
+	if _, err := New([]string{"v2"}, map[string]Retirement{"v1": {}}); err == nil {
+		t.Fatal("expected retiring an unknown version to be rejected")
+	}
+	if _, err := New([]string{"2"}, nil); err == nil {
+		t.Fatal("expected an invalid version to be rejected")
+	}
+}
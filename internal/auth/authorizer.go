@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Actions authorized on presence resources
+const (
+	ActionRead  = "presence.read"  // Read a user's presence; resource is the user ID, empty for multi-user reads
+	ActionWrite = "presence.write" // Set a user's presence; resource is the user ID
+	ActionAdmin = "admin"          // Use the admin API; resource is the target, e.g. a user ID
+)
+
+// Authorizer modes
+const (
+	AuthorizerNone  = "none"  // Every request is allowed
+	AuthorizerOwner = "owner" // OwnerOnly
+	AuthorizerScope = "scope" // ScopeBased with DefaultActionScopes
+	AuthorizerHTTP  = "http"  // HTTPAuthorizer, e.g. an OPA server
+	AuthorizerOPA   = "opa"   // HTTPAuthorizer querying the bundled Rego policy on an OPA server
+)
+
+// OPAPolicyPath is the decision of the bundled Rego policy (policies/presence)
+// under an OPA server's data API
+const OPAPolicyPath = "/v1/data/presence/authz/allow"
+
+// Subject is the caller an authorization decision is made for
+type Subject struct {
+	ID     string   `json:"id"` // Empty for anonymous callers
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// SubjectFromContext returns the authenticated caller of ctx
+func SubjectFromContext(ctx context.Context) Subject {
+	scopes, _ := ctx.Value(scopesContextKey).([]string)
+	s := Subject{ID: GetUserIDFromContext(ctx), Scopes: scopes}
+	if tenant, ok := ctx.Value(tenantContextKey).(string); ok {
+		s.Tenant = tenant
+	}
+	return s
+}
+
+func (s Subject) hasScope(scope string) bool {
+	for _, sc := range s.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// writesForOthers reports whether s may set presence other than its own:
+// admins, holders of ScopeService and the listed service accounts
+func (s Subject) writesForOthers(serviceAccounts []string) bool {
+	return s.hasScope(ScopeAdmin) || s.hasScope(ScopeService) || (s.ID != "" && slices.Contains(serviceAccounts, s.ID))
+}
+
+// Authorizer decides whether subject may perform action on resource. An
+// error means no decision could be made, and the request is refused.
+type Authorizer interface {
+	Authorize(ctx context.Context, subject Subject, action, resource string) (bool, error)
+}
+
+// NewAuthorizer returns the authorizer of mode; url and timeout configure
+// AuthorizerHTTP, where url is the policy endpoint, and AuthorizerOPA, where
+// it is the OPA server's base URL. serviceAccounts may set anyone's presence
+// under AuthorizerOwner.
+func NewAuthorizer(mode, url string, timeout time.Duration, serviceAccounts []string) (Authorizer, error) {
+	switch mode {
+	case AuthorizerNone, "":
+		return AllowAll{}, nil
+	case AuthorizerOwner:
+		return OwnerOnly{ServiceAccounts: serviceAccounts}, nil
+	case AuthorizerScope:
+		return ScopeBased{Scopes: DefaultActionScopes}, nil
+	case AuthorizerHTTP:
+		if url == "" {
+			return nil, fmt.Errorf("the http authorizer needs a URL")
+		}
+		return NewHTTPAuthorizer(url, timeout), nil
+	case AuthorizerOPA:
+		if url == "" {
+			return nil, fmt.Errorf("the opa authorizer needs the OPA server URL")
+		}
+		return NewHTTPAuthorizer(strings.TrimRight(url, "/")+OPAPolicyPath, timeout), nil
+	}
+	return nil, fmt.Errorf("unknown authorizer %q", mode)
+}
+
+// AllowAll allows every request
+type AllowAll struct{}
+
+// Authorize implements Authorizer
+func (AllowAll) Authorize(context.Context, Subject, string, string) (bool, error) { return true, nil }
+
+// OwnerOnly lets authenticated subjects read anyone's presence but change
+// only their own. The admin scope allows everything, and is required for
+// the admin API. The service scope and ServiceAccounts allow changing
+// anyone's presence.
+type OwnerOnly struct {
+	ServiceAccounts []string // JWT subjects of trusted services
+}
+
+// Authorize implements Authorizer
+func (a OwnerOnly) Authorize(_ context.Context, s Subject, action, resource string) (bool, error) {
+	switch {
+	case s.ID == "":
+		return false, nil
+	case s.hasScope(ScopeAdmin):
+		return true, nil
+	case action == ActionRead:
+		return true, nil
+	case action == ActionWrite:
+		return resource == s.ID || s.writesForOthers(a.ServiceAccounts), nil
+	}
+	return false, nil
+}
+
+// SelfWrites refuses subjects setting presence other than their own,
+// including batch writes, unless they may write for others, and leaves every
+// other decision to Next. Anonymous callers have no presence of their own,
+// so all their writes are refused.
+type SelfWrites struct {
+	Next            Authorizer
+	ServiceAccounts []string // JWT subjects of trusted services
+}
+
+// Authorize implements Authorizer
+func (a SelfWrites) Authorize(ctx context.Context, s Subject, action, resource string) (bool, error) {
+	if action == ActionWrite && (s.ID == "" || resource != s.ID && !s.writesForOthers(a.ServiceAccounts)) {
+		return false, nil
+	}
+	return a.Next.Authorize(ctx, s, action, resource)
+}
+
+// DefaultActionScopes are the scopes ScopeBased requires by default
+var DefaultActionScopes = map[string]string{
+	ActionRead:  ScopeRead,
+	ActionWrite: ScopeWrite,
+	ActionAdmin: ScopeAdmin,
+}
+
+// ScopeBased requires the scope mapped to each action; actions without a
+// scope are denied. Tokens carry the scopes their scopes imply, so with
+// DefaultActionScopes presence:write also reads and presence:admin, like
+// admin, does everything.
+type ScopeBased struct {
+	Scopes map[string]string // Action to required scope
+}
+
+// Authorize implements Authorizer
+func (a ScopeBased) Authorize(_ context.Context, s Subject, action, _ string) (bool, error) {
+	scope, ok := a.Scopes[action]
+	return ok && s.hasScope(scope), nil
+}
+
+// HTTPAuthorizer asks an external policy service. It POSTs
+// {"input": {"subject", "action", "resource", "route", "target_user"}},
+// where route and target_user describe the HTTP request being authorized,
+// and expects
+// {"result": true} to allow, the request and response shape of OPA's data
+// API (POST /v1/data/<policy path>). A missing or non-boolean result denies.
+type HTTPAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPAuthorizer returns an authorizer querying url, each decision bounded
+// by timeout
+func NewHTTPAuthorizer(url string, timeout time.Duration) *HTTPAuthorizer {
+	return &HTTPAuthorizer{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+type policyInput struct {
+	Subject  Subject `json:"subject"`
+	Action   string  `json:"action"`
+	Resource string  `json:"resource"`
+	requestInfo
+}
+
+// requestInfo describes the HTTP request being authorized to policies
+type requestInfo struct {
+	Route      string `json:"route,omitempty"`       // Method and path template, e.g. "PUT /api/v2/presence/{user_id}"
+	TargetUser string `json:"target_user,omitempty"` // The {user_id} of the path
+}
+
+const requestInfoContextKey contextKey = "authz_request"
+
+// requestInfoOf describes r; the route is matched by gorilla/mux
+func requestInfoOf(r *http.Request) requestInfo {
+	info := requestInfo{Route: r.Method + " " + r.URL.Path, TargetUser: mux.Vars(r)["user_id"]}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			info.Route = r.Method + " " + tmpl
+		}
+	}
+	return info
+}
+
+// Authorize implements Authorizer
+func (a *HTTPAuthorizer) Authorize(ctx context.Context, s Subject, action, resource string) (bool, error) {
+	info, _ := ctx.Value(requestInfoContextKey).(requestInfo)
+	body, err := json.Marshal(map[string]policyInput{"input": {Subject: s, Action: action, Resource: resource, requestInfo: info}})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("policy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return false, fmt.Errorf("policy service returned %s", resp.Status)
+	}
+	var decision struct {
+		Result any `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, fmt.Errorf("invalid policy response: %w", err)
+	}
+	allowed, _ := decision.Result.(bool)
+	return allowed, nil
+}
+
+// Authorize is a middleware that asks a for a decision on each request;
+// target names the action and resource of a request. Denied anonymous
+// callers are answered 401, other denials 403, and requests the authorizer
+// can't decide 503. CORS preflights pass through.
+func Authorize(a Authorizer, target func(*http.Request) (action, resource string), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		action, resource := target(r)
+		subject := SubjectFromContext(r.Context())
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, requestInfoOf(r))
+		allowed, err := a.Authorize(ctx, subject, action, resource)
+		switch {
+		case err != nil:
+			log.Printf("authorizer failed on %s %s: %v", action, resource, err)
+			writeErrorResponse(w, http.StatusServiceUnavailable, "authorization unavailable")
+		case allowed:
+			next.ServeHTTP(w, r)
+		case subject.ID == "":
+			writeErrorResponse(w, http.StatusUnauthorized, "authentication required")
+		default:
+			writeErrorResponse(w, http.StatusForbidden, strings.TrimSpace(fmt.Sprintf("not allowed to %s %s", action, resource)))
+		}
+	})
+}
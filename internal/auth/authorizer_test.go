@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBuiltinAuthorizers(t *testing.T) {
+	alice := Subject{ID: "alice", Scopes: []string{"presence:read"}}
+	admin := Subject{ID: "ops", Scopes: []string{ScopeAdmin}}
+	anon := Subject{}
+	chat := Subject{ID: "chat-backend"}
+	service := Subject{ID: "svc", Scopes: []string{ScopeService}}
+	selfWrites := SelfWrites{Next: AllowAll{}, ServiceAccounts: []string{"chat-backend"}}
+
+	cases := []struct {
+		name     string
+		a        Authorizer
+		subject  Subject
+		action   string
+		resource string
+		want     bool
+	}{
+		{"allow all", AllowAll{}, anon, ActionWrite, "bob", true},
+		{"owner reads others", OwnerOnly{}, alice, ActionRead, "bob", true},
+		{"owner writes own", OwnerOnly{}, alice, ActionWrite, "alice", true},
+		{"owner writes others", OwnerOnly{}, alice, ActionWrite, "bob", false},
+		{"owner anonymous", OwnerOnly{}, anon, ActionRead, "bob", false},
+		{"owner admin api", OwnerOnly{}, alice, ActionAdmin, "bob", false},
+		{"owner admin scope", OwnerOnly{}, admin, ActionWrite, "bob", true},
+		{"owner service scope", OwnerOnly{}, service, ActionWrite, "bob", true},
+		{"owner service account", OwnerOnly{ServiceAccounts: []string{"chat-backend"}}, chat, ActionWrite, "bob", true},
+		{"owner service account admin api", OwnerOnly{ServiceAccounts: []string{"chat-backend"}}, chat, ActionAdmin, "bob", false},
+		{"self writes own", selfWrites, alice, ActionWrite, "alice", true},
+		{"self writes others", selfWrites, alice, ActionWrite, "bob", false},
+		{"self writes batch", selfWrites, alice, ActionWrite, "", false},
+		{"self writes reads others", selfWrites, alice, ActionRead, "bob", true},
+		{"self writes anonymous", selfWrites, anon, ActionWrite, "bob", false},
+		{"self writes anonymous read", selfWrites, anon, ActionRead, "bob", true},
+		{"self writes admin", selfWrites, admin, ActionWrite, "bob", true},
+		{"self writes service scope", selfWrites, service, ActionWrite, "", true},
+		{"self writes service account", selfWrites, chat, ActionWrite, "bob", true},
+		{"self writes defers to next", SelfWrites{Next: ScopeBased{Scopes: DefaultActionScopes}}, alice, ActionWrite, "alice", false},
+		{"scope granted", ScopeBased{Scopes: DefaultActionScopes}, alice, ActionRead, "bob", true},
+		{"scope missing", ScopeBased{Scopes: DefaultActionScopes}, alice, ActionWrite, "alice", false},
+		{"scope unmapped action", ScopeBased{Scopes: DefaultActionScopes}, admin, "presence.delete", "bob", false},
+	}
+	for _, tc := range cases {
+		got, err := tc.a.Authorize(context.Background(), tc.subject, tc.action, tc.resource)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %v %v, want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestHTTPAuthorizer(t *testing.T) {
+	var input policyInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input policyInput `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		input = body.Input
+		switch body.Input.Resource {
+		case "bob":
+			w.Write([]byte(`{"result": true}`))
+		case "carol":
+			w.Write([]byte(`{}`)) // OPA's answer for an undefined decision
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	a, err := NewAuthorizer(AuthorizerHTTP, srv.URL, time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewAuthorizer: %v", err)
+	}
+	alice := Subject{ID: "alice", Scopes: []string{"presence:write"}, Tenant: "acme"}
+	if ok, err := a.Authorize(context.Background(), alice, ActionWrite, "bob"); !ok || err != nil {
+		t.Fatalf("expected allow, got %v %v", ok, err)
+	}
+	if input.Subject.ID != "alice" || input.Subject.Tenant != "acme" || input.Action != ActionWrite {
+		t.Fatalf("unexpected policy input %+v", input)
+	}
+	if ok, err := a.Authorize(context.Background(), alice, ActionWrite, "carol"); ok || err != nil {
+		t.Fatalf("expected an undefined decision to deny, got %v %v", ok, err)
+	}
+	if _, err := a.Authorize(context.Background(), alice, ActionWrite, "dave"); err == nil {
+		t.Fatal("expected a policy service failure to be an error")
+	}
+
+	if _, err := NewAuthorizer(AuthorizerHTTP, "", time.Second, nil); err == nil {
+		t.Fatal("expected the http authorizer to need a URL")
+	}
+	if _, err := NewAuthorizer("rbac", "", time.Second, nil); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+}
+
+type authorizerFunc func(Subject, string, string) (bool, error)
+
+func (f authorizerFunc) Authorize(_ context.Context, s Subject, action, resource string) (bool, error) {
+	return f(s, action, resource)
+}
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	var failing bool
+	a := authorizerFunc(func(s Subject, action, resource string) (bool, error) {
+		if failing {
+			return false, context.DeadlineExceeded
+		}
+		return OwnerOnly{}.Authorize(context.Background(), s, action, resource)
+	})
+	h := Authorize(a, func(r *http.Request) (string, string) { return ActionWrite, "alice" }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(method, user string) int {
+		req := httptest.NewRequest(method, "/api/v2/presence/alice", nil)
+		if user != "" {
+			req = req.WithContext(SetUserIDInContext(req.Context(), user))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, tc := range []struct {
+		method, user string
+		want         int
+	}{
+		{http.MethodPut, "alice", http.StatusNoContent},
+		{http.MethodPut, "bob", http.StatusForbidden},
+		{http.MethodPut, "", http.StatusUnauthorized},
+		{http.MethodOptions, "", http.StatusNoContent},
+	} {
+		if got := serve(tc.method, tc.user); got != tc.want {
+			t.Errorf("%s as %q: expected %d, got %d", tc.method, tc.user, tc.want, got)
+		}
+	}
+	failing = true
+	if got := serve(http.MethodPut, "alice"); got != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when the authorizer fails, got %d", got)
+	}
+}
+
+func TestOPAAuthorizer_SendsRouteAndTargetUser(t *testing.T) {
+	var path string
+	var input policyInput
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input policyInput `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		path, input = r.URL.Path, body.Input
+		w.Write([]byte(`{"result": true}`))
+	}))
+	defer opa.Close()
+
+	a, err := NewAuthorizer(AuthorizerOPA, opa.URL+"/", time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewAuthorizer: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Handle("/api/v2/presence/{user_id}", Authorize(a, func(r *http.Request) (string, string) {
+		return ActionWrite, mux.Vars(r)["user_id"]
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v2/presence/alice", nil)
+	req = req.WithContext(SetUserIDInContext(req.Context(), "alice"))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if path != OPAPolicyPath {
+		t.Fatalf("expected the bundled policy decision %s, got %s", OPAPolicyPath, path)
+	}
+	if input.Route != "PUT /api/v2/presence/{user_id}" || input.TargetUser != "alice" || input.Subject.ID != "alice" {
+		t.Fatalf("unexpected policy input %+v", input)
+	}
+}
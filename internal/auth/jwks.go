@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksFetchTimeout bounds one fetch of the key set
+const jwksFetchTimeout = 10 * time.Second
+
+// jwksMinRefresh spaces the refetches triggered by tokens signed with an
+// unknown key, so forged key IDs can't hammer the identity provider
+const jwksMinRefresh = 30 * time.Second
+
+// JWKS holds the public keys of an identity provider's JSON Web Key Set,
+// keyed by key ID. Tokens signed with a key it doesn't hold trigger a
+// refetch, so rotated keys are picked up before the next scheduled refresh.
+type JWKS struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	fetchMu sync.Mutex // Serializes fetches
+
+	mu      sync.RWMutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+// NewJWKS returns a key set fetched from url on first use
+func NewJWKS(url string) *JWKS {
+	return &JWKS{url: url, client: &http.Client{Timeout: jwksFetchTimeout}, now: time.Now, keys: map[string]interface{}{}}
+}
+
+// Refresh fetches the key set, replacing the keys held; keys the provider
+// no longer publishes stop validating tokens
+func (k *JWKS) Refresh(ctx context.Context) error {
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+	return k.fetch(ctx)
+}
+
+// Run refreshes the key set every interval until ctx is done
+func (k *JWKS) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.Refresh(ctx); err != nil {
+				log.Printf("jwks refresh failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Key returns the public key of kid, refetching the key set if it isn't
+// held. Tokens without a key ID are accepted when the set holds one key.
+func (k *JWKS) Key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+	// Another request may have fetched the key while this one waited
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	k.mu.RLock()
+	fetched := k.fetched
+	k.mu.RUnlock()
+	if k.now().Sub(fetched) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if err := k.fetch(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (k *JWKS) lookup(kid string) (interface{}, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// fetch reads the key set; callers hold fetchMu
+func (k *JWKS) fetch(ctx context.Context) error {
+	k.mu.Lock()
+	k.fetched = k.now()
+	k.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build jwks request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch jwks: status %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		key, err := raw.publicKey()
+		if err != nil {
+			// One malformed or unsupported key doesn't invalidate the others
+			log.Printf("jwks: skipping key %q: %v", raw.Kid, err)
+			continue
+		}
+		keys[raw.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("jwks holds no usable signing keys")
+	}
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// jwk is one JSON Web Key (RFC 7517) of an RSA or EC public key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j jwk) publicKey() (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on %s", j.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
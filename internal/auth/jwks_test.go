@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWKSServer publishes the public halves of keys, keyed by key ID
+type testJWKSServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	keys map[string]interface{}
+}
+
+func newTestJWKSServer(t *testing.T) *testJWKSServer {
+	s := &testJWKSServer{keys: map[string]interface{}{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var set []map[string]string
+		for kid, key := range s.keys {
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				set = append(set, map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+					"n": b64(key.N), "e": b64(big.NewInt(int64(key.E)))})
+			case *ecdsa.PrivateKey:
+				set = append(set, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+					"x": b64(key.X), "y": b64(key.Y)})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": set})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJWKSServer) publish(kid string, key interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = key
+}
+
+func (s *testJWKSServer) revoke(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, kid)
+}
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func signedToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"sub": "user1",
+		"iss": "idp",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return s
+}
+
+func TestJWTMiddleware_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	server := newTestJWKSServer(t)
+	server.publish("rsa-1", rsaKey)
+	server.publish("ec-1", ecKey)
+
+	keys := NewJWKS(server.URL)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	keys.now = func() time.Time { return now }
+	m := NewJWTMiddleware(testSecret, "idp", WithJWKS(keys))
+	handler := m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUserIDFromContext(r.Context())))
+	}))
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for name, token := range map[string]string{
+		"RS256": signedToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey),
+		"ES256": signedToken(t, jwt.SigningMethodES256, "ec-1", ecKey),
+		"HS256": signedToken(t, jwt.SigningMethodHS256, "", []byte(testSecret)),
+	} {
+		if rr := serve(token); rr.Code != http.StatusOK || rr.Body.String() != "user1" {
+			t.Errorf("%s: expected user1 to be authenticated, got %d %s", name, rr.Code, rr.Body.String())
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("expected the key set to be fetched once, got %d", got)
+	}
+
+	// A key signed as ECDSA but published as RSA is refused
+	forged := signedToken(t, jwt.SigningMethodES256, "rsa-1", ecKey)
+	if rr := serve(forged); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a key type mismatch to be refused, got %d", rr.Code)
+	}
+
+	// A rotated key is fetched once the minimum refresh interval has passed
+	rotated, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server.publish("rsa-2", rotated)
+	token := signedToken(t, jwt.SigningMethodRS256, "rsa-2", rotated)
+	if rr := serve(token); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the refetch to wait for the minimum interval, got %d", rr.Code)
+	}
+	now = now.Add(jwksMinRefresh)
+	if rr := serve(token); rr.Code != http.StatusOK {
+		t.Fatalf("expected the rotated key to be picked up, got %d", rr.Code)
+	}
+
+	// Keys the provider stops publishing stop validating tokens
+	server.revoke("rsa-1")
+	if err := keys.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if rr := serve(signedToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked key to be refused, got %d", rr.Code)
+	}
+}
+
+func TestJWTMiddleware_AsymmetricWithoutJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	m := NewJWTMiddleware(testSecret, "idp")
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+signedToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	if _, err := m.validateToken(req); err == nil {
+		t.Fatal("expected RS256 tokens to be refused without a key set")
+	}
+
+	// Without a secret, HMAC tokens are refused rather than checked against an empty key
+	m = NewJWTMiddleware("", "idp", WithJWKS(NewJWKS("http://127.0.0.1:0")))
+	req.Header.Set("Authorization", "Bearer "+signedToken(t, jwt.SigningMethodHS256, "", []byte("")))
+	if _, err := m.validateToken(req); err == nil {
+		t.Fatal("expected HS256 tokens to be refused without a secret")
+	}
+}
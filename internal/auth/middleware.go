@@ -13,20 +13,74 @@ import (
 // contextKey is used for storing values in context
 type contextKey string
 
-const userIDContextKey contextKey = "user_id"
+const (
+	userIDContextKey contextKey = "user_id"
+	scopesContextKey contextKey = "scopes"
+	tenantContextKey contextKey = "tenant"
+)
+
+// ScopeAdmin grants access to the admin API, such as forcing another user's presence
+const ScopeAdmin = "admin"
+
+// Presence scopes, checked by ScopeBased. Each grants the scopes below it,
+// so a dashboard can be issued a read-only token while writers need not
+// list presence:read as well. ScopePresenceAdmin is ScopeAdmin under the
+// presence namespace; either grants the other.
+const (
+	ScopeRead          = "presence:read"
+	ScopeWrite         = "presence:write"
+	ScopePresenceAdmin = "presence:admin"
+)
+
+// impliedScopes are granted along with each scope
+var impliedScopes = map[string][]string{
+	ScopeAdmin:         {ScopePresenceAdmin, ScopeWrite, ScopeRead},
+	ScopePresenceAdmin: {ScopeAdmin, ScopeWrite, ScopeRead},
+	ScopeWrite:         {ScopeRead},
+}
+
+// ScopeService marks trusted services, such as a chat backend, that set
+// presence on behalf of any user
+const ScopeService = "presence:service"
 
 // JWTMiddleware handles JWT authentication
 type JWTMiddleware struct {
 	secretKey string
 	issuer    string
+	jwks      *JWKS
+
+	rolesClaim string              // Dotted path of the roles claim, e.g. "realm_access.roles"
+	roles      map[string][]string // Role to the scopes it grants
 }
 
-// NewJWTMiddleware creates a new JWT middleware
-func NewJWTMiddleware(secretKey, issuer string) *JWTMiddleware {
-	return &JWTMiddleware{
+// Option configures a JWTMiddleware
+type Option func(*JWTMiddleware)
+
+// WithJWKS accepts RS256 and ES256 tokens, and the rest of the RSA and
+// ECDSA families, signed with a key of keys
+func WithJWKS(keys *JWKS) Option {
+	return func(m *JWTMiddleware) { m.jwks = keys }
+}
+
+// WithRoles grants the scopes of roles to tokens holding a role in claim, a
+// list or space-separated string. A dotted claim, such as
+// "realm_access.roles", reaches into nested objects, for identity providers
+// that can't issue scopes.
+func WithRoles(claim string, roles map[string][]string) Option {
+	return func(m *JWTMiddleware) { m.rolesClaim, m.roles = claim, roles }
+}
+
+// NewJWTMiddleware creates a new JWT middleware. HMAC tokens are validated
+// with secretKey; an empty secretKey refuses them.
+func NewJWTMiddleware(secretKey, issuer string, opts ...Option) *JWTMiddleware {
+	m := &JWTMiddleware{
 		secretKey: secretKey,
 		issuer:    issuer,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Authenticate is a middleware that requires valid JWT authentication
@@ -51,12 +105,28 @@ func (m *JWTMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		// Add user ID to context
+		// Add user ID and scopes to context
 		ctx := SetUserIDInContext(r.Context(), userID)
+		ctx = SetScopesInContext(ctx, m.grantedScopes(claims))
+		if tenant, ok := claims["tenant"].(string); ok && tenant != "" {
+			ctx = SetTenantInContext(ctx, tenant)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// RequireScope is a middleware that requires valid JWT authentication with
+// the given scope; authenticated callers without it are answered 403
+func (m *JWTMiddleware) RequireScope(scope string, next http.Handler) http.Handler {
+	return m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasScope(r.Context(), scope) {
+			writeErrorResponse(w, http.StatusForbidden, fmt.Sprintf("missing required scope %q", scope))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
 // OptionalAuthenticate is a middleware that allows both authenticated and unauthenticated requests
 func (m *JWTMiddleware) OptionalAuthenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -72,6 +142,10 @@ func (m *JWTMiddleware) OptionalAuthenticate(next http.Handler) http.Handler {
 		if ok {
 			if userID, ok := claims["sub"].(string); ok && userID != "" {
 				ctx := SetUserIDInContext(r.Context(), userID)
+				ctx = SetScopesInContext(ctx, m.grantedScopes(claims))
+				if tenant, ok := claims["tenant"].(string); ok && tenant != "" {
+					ctx = SetTenantInContext(ctx, tenant)
+				}
 				r = r.WithContext(ctx)
 			}
 		}
@@ -80,10 +154,37 @@ func (m *JWTMiddleware) OptionalAuthenticate(next http.Handler) http.Handler {
 	})
 }
 
+// AuthenticateHeader validates authorization, the value of an Authorization
+// header, and returns ctx carrying its caller, for transports other than
+// HTTP such as gRPC metadata
+func (m *JWTMiddleware) AuthenticateHeader(ctx context.Context, authorization string) (context.Context, error) {
+	token, err := m.parseToken(ctx, authorization)
+	if err != nil {
+		return ctx, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ctx, fmt.Errorf("invalid token claims")
+	}
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return ctx, fmt.Errorf("missing or invalid user ID in token")
+	}
+	ctx = SetUserIDInContext(ctx, userID)
+	ctx = SetScopesInContext(ctx, m.grantedScopes(claims))
+	if tenant, ok := claims["tenant"].(string); ok && tenant != "" {
+		ctx = SetTenantInContext(ctx, tenant)
+	}
+	return ctx, nil
+}
+
 // validateToken extracts and validates the JWT token from the request
 func (m *JWTMiddleware) validateToken(r *http.Request) (*jwt.Token, error) {
-	// Extract token from Authorization header
-	authHeader := r.Header.Get("Authorization")
+	return m.parseToken(r.Context(), r.Header.Get("Authorization"))
+}
+
+// parseToken validates the bearer token of authHeader
+func (m *JWTMiddleware) parseToken(ctx context.Context, authHeader string) (*jwt.Token, error) {
 	if authHeader == "" {
 		return nil, fmt.Errorf("missing authorization header")
 	}
@@ -101,11 +202,20 @@ func (m *JWTMiddleware) validateToken(r *http.Request) (*jwt.Token, error) {
 
 	// Parse and validate token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		// Validate signing method: HMAC with the shared secret, RSA and
+		// ECDSA with the identity provider's published keys
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if m.secretKey != "" {
+				return []byte(m.secretKey), nil
+			}
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+			if m.jwks != nil {
+				kid, _ := token.Header["kid"].(string)
+				return m.jwks.Key(ctx, kid)
+			}
 		}
-		return []byte(m.secretKey), nil
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	})
 
 	if err != nil {
@@ -132,10 +242,83 @@ func (m *JWTMiddleware) validateToken(r *http.Request) (*jwt.Token, error) {
 	return token, nil
 }
 
+// grantedScopes returns the scopes of claims, those of its roles and the
+// scopes they imply
+func (m *JWTMiddleware) grantedScopes(claims jwt.MapClaims) []string {
+	scopes := tokenScopes(claims)
+	if m.rolesClaim != "" {
+		for _, role := range claimStrings(nestedClaim(claims, m.rolesClaim)) {
+			scopes = append(scopes, m.roles[role]...)
+		}
+	}
+	return expandScopes(scopes)
+}
+
+// tokenScopes reads the granted scopes from the OAuth-style space-separated
+// "scope" claim or a "scp" list
+func tokenScopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return claimStrings(claims["scp"])
+}
+
+// nestedClaim returns the claim at path, whose dots separate nested objects
+func nestedClaim(claims jwt.MapClaims, path string) interface{} {
+	var v interface{} = map[string]interface{}(claims)
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+// claimStrings reads a list of strings or a space-separated string
+func claimStrings(v interface{}) []string {
+	if s, ok := v.(string); ok {
+		return strings.Fields(s)
+	}
+	list, _ := v.([]interface{})
+	values := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// expandScopes adds the scopes implied by scopes, once each
+func expandScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	expanded := make([]string, 0, len(scopes))
+	add := func(scope string) {
+		if !seen[scope] {
+			seen[scope] = true
+			expanded = append(expanded, scope)
+		}
+	}
+	for _, scope := range scopes {
+		add(scope)
+		for _, implied := range impliedScopes[scope] {
+			add(implied)
+		}
+	}
+	return expanded
+}
+
 // writeUnauthorizedResponse writes an unauthorized error response
 func (m *JWTMiddleware) writeUnauthorizedResponse(w http.ResponseWriter, message string) {
+	writeErrorResponse(w, http.StatusUnauthorized, message)
+}
+
+// writeErrorResponse writes a JSON error response
+func writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(statusCode)
 
 	response := map[string]interface{}{
 		"success": false,
@@ -157,3 +340,33 @@ func GetUserIDFromContext(ctx context.Context) string {
 	}
 	return ""
 }
+
+// SetScopesInContext adds the caller's granted scopes to the context
+func SetScopesInContext(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesContextKey, scopes)
+}
+
+// HasScope reports whether the caller was granted scope
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, _ := ctx.Value(scopesContextKey).([]string)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTenantInContext adds the caller's tenant to the context
+func SetTenantInContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenant)
+}
+
+// GetTenantFromContext returns the caller's tenant: the token's "tenant"
+// claim, or its subject when the token names no tenant
+func GetTenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantContextKey).(string); ok {
+		return tenant
+	}
+	return GetUserIDFromContext(ctx)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -273,3 +274,119 @@ func TestOptionalJWTMiddleware(t *testing.T) {
 		t.Errorf("Expected 'authenticated:user1', got '%s'", rr.Body.String())
 	}
 }
+
+func TestJWTMiddleware_RequireScope(t *testing.T) {
+	middleware := NewJWTMiddleware(testSecret, "presence-service")
+	handler := middleware.RequireScope(ScopeAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("admin:" + GetUserIDFromContext(r.Context())))
+	}))
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["sub"] = "admin1"
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		claims["iss"] = "presence-service"
+		s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		return s
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"no scope", sign(jwt.MapClaims{}), http.StatusForbidden},
+		{"other scopes", sign(jwt.MapClaims{"scope": "presence:read presence:write"}), http.StatusForbidden},
+		{"scope claim", sign(jwt.MapClaims{"scope": "presence:read admin"}), http.StatusOK},
+		{"scp list", sign(jwt.MapClaims{"scp": []string{"admin"}}), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/test", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d", tt.want, rr.Code)
+			}
+			if tt.want == http.StatusOK && rr.Body.String() != "admin:admin1" {
+				t.Errorf("Expected 'admin:admin1', got '%s'", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTenantFromContext(t *testing.T) {
+	middleware := NewJWTMiddleware(testSecret, "presence-service")
+	handler := middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetTenantFromContext(r.Context())))
+	}))
+
+	for _, tt := range []struct {
+		claims jwt.MapClaims
+		want   string
+	}{
+		{jwt.MapClaims{"sub": "user1", "tenant": "acme"}, "acme"},
+		{jwt.MapClaims{"sub": "user1"}, "user1"},
+	} {
+		tt.claims["iss"] = "presence-service"
+		tokenString, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString([]byte(testSecret))
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Body.String() != tt.want {
+			t.Errorf("Expected tenant '%s', got '%s'", tt.want, rr.Body.String())
+		}
+	}
+}
+
+func TestJWTMiddleware_GrantedScopes(t *testing.T) {
+	middleware := NewJWTMiddleware(testSecret, "presence-service", WithRoles("realm_access.roles", map[string][]string{
+		"dashboard": {ScopeRead},
+		"support":   {ScopePresenceAdmin},
+	}))
+	var got []string
+	handler := middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = SubjectFromContext(r.Context()).Scopes
+	}))
+	serve := func(claims jwt.MapClaims) {
+		got = nil
+		claims["sub"] = "user1"
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		claims["iss"] = "presence-service"
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{"read only", jwt.MapClaims{"scope": "presence:read"}, []string{ScopeRead}},
+		{"write implies read", jwt.MapClaims{"scope": "presence:write"}, []string{ScopeWrite, ScopeRead}},
+		{"presence admin is admin", jwt.MapClaims{"scp": []string{"presence:admin"}}, []string{ScopePresenceAdmin, ScopeAdmin, ScopeWrite, ScopeRead}},
+		{"dashboard role", jwt.MapClaims{"realm_access": map[string]interface{}{"roles": []string{"dashboard", "unknown"}}}, []string{ScopeRead}},
+		{"role and scope", jwt.MapClaims{"scope": "presence:service", "realm_access": map[string]interface{}{"roles": "support"}}, []string{ScopeService, ScopePresenceAdmin, ScopeAdmin, ScopeWrite, ScopeRead}},
+		{"roles claim elsewhere", jwt.MapClaims{"roles": []string{"support"}}, []string{}},
+	}
+	for _, tt := range tests {
+		serve(tt.claims)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: expected scopes %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// A read-only token is refused writes and the admin API
+	ctx := SetScopesInContext(context.Background(), expandScopes([]string{ScopeRead}))
+	s := SubjectFromContext(ctx)
+	for action, want := range map[string]bool{ActionRead: true, ActionWrite: false, ActionAdmin: false} {
+		if allowed, _ := (ScopeBased{Scopes: DefaultActionScopes}).Authorize(ctx, s, action, "alice"); allowed != want {
+			t.Errorf("read-only token on %s: expected %v, got %v", action, want, allowed)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// Filter is a fixed-size bloom filter over strings, safe for concurrent use.
+// MayContain never returns false for an added key.
+type Filter struct {
+	bits []atomic.Uint64
+	m    uint64 // number of bits
+	k    uint64 // number of hash functions
+}
+
+// New sizes a filter for n keys at the target false-positive rate
+func New(n int, fpRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	words := (m + 63) / 64
+	return &Filter{bits: make([]atomic.Uint64, words), m: words * 64, k: k}
+}
+
+// Add inserts a key
+func (f *Filter) Add(key string) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// MayContain reports whether key may have been added
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives the two base hashes for Kirsch-Mitzenmacher double hashing
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31
+	h2 ^= 0x9e3779b97f4a7c15
+	return h1, h2 | 1
+}
@@ -0,0 +1,35 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter_NoFalseNegatives(t *testing.T) {
+	f := New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add(fmt.Sprintf("user-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !f.MayContain(fmt.Sprintf("user-%d", i)) {
+			t.Fatalf("false negative for user-%d", i)
+		}
+	}
+}
+
+func TestFilter_FalsePositiveRate(t *testing.T) {
+	f := New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add(fmt.Sprintf("user-%d", i))
+	}
+	fp := 0
+	const probes = 100000
+	for i := 0; i < probes; i++ {
+		if f.MayContain(fmt.Sprintf("other-%d", i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / probes; rate > 0.03 {
+		t.Fatalf("false positive rate %.4f well above target", rate)
+	}
+}
@@ -1,10 +1,16 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"gopresence/internal/models"
 )
 
 // Config holds the application configuration
@@ -14,6 +20,20 @@ type Config struct {
 	Cache   CacheConfig   `yaml:"cache"`
 	Auth    AuthConfig    `yaml:"auth"`
 	Logging LoggingConfig `yaml:"logging"`
+	Privacy PrivacyConfig `yaml:"privacy"`
+	Stream  StreamConfig  `yaml:"stream"`
+	GRPC    GRPCConfig    `yaml:"grpc"`
+	API     APIConfig     `yaml:"api"`
+	Quota   QuotaConfig   `yaml:"quota"`
+
+	WriteBehind   WriteBehindConfig   `yaml:"write_behind"`
+	Sinks         SinksConfig         `yaml:"sinks"`
+	Presence      PresenceConfig      `yaml:"presence"`
+	Subscriptions SubscriptionsConfig `yaml:"subscriptions"`
+	Contacts      ContactsConfig      `yaml:"contacts"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+	Annotations   AnnotationsConfig   `yaml:"annotations"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
 }
 
 // ServiceConfig holds service-level configuration
@@ -21,8 +41,20 @@ type ServiceConfig struct {
 	Name     string `yaml:"name"`
 	Version  string `yaml:"version"`
 	Port     int    `yaml:"port"`
-	NodeType string `yaml:"node_type"` // "center" or "leaf"
+	Host     string `yaml:"host"` // Listen address, e.g. "127.0.0.1" for sidecars; empty binds all interfaces
+	NodeType string `yaml:"node_type"` // "center", "leaf" or "proxy"
 	NodeID   string `yaml:"node_id"`
+	Region   string `yaml:"region"` // Optional deployment region, reported in responses
+
+	DrainTimeout string `yaml:"drain_timeout"` // Deadline for draining the node before it exits
+	DrainDelay   string `yaml:"drain_delay"`   // Pause after readiness fails, before connections close
+
+	TLSCert  string `yaml:"tls_cert"`  // PEM certificate chain of the HTTP listener ("" serves plaintext)
+	TLSKey   string `yaml:"tls_key"`   // PEM private key of TLSCert
+	ClientCA string `yaml:"client_ca"` // PEM CA bundle HTTP clients must present a certificate from ("" skips mTLS)
+
+	ErrorReportURL     string `yaml:"error_report_url"`     // Endpoint panics are reported to ("" only logs them)
+	ErrorReportTimeout string `yaml:"error_report_timeout"` // Bound on one panic report
 }
 
 // NATSConfig holds NATS configuration
@@ -33,11 +65,37 @@ type NATSConfig struct {
 	JetStreamMaxMemory int64  `yaml:"jetstream_max_memory"`
 	JetStreamMaxStore  int64  `yaml:"jetstream_max_store"`
 	KVBucket           string `yaml:"kv_bucket"`
+	Environment        string `yaml:"environment"` // Logical environment sharing the cluster; prefixes bucket, stream and subject names
 	KVTTL              string `yaml:"kv_ttl"`
+	KVReplicas         int    `yaml:"kv_replicas"` // Copies of every declared bucket and stream across the cluster
+	KVHistory          int    `yaml:"kv_history"`  // Values the presence bucket keeps per key (1-64)
 	CenterURL          string `yaml:"center_url"`   // URL of center node (for leaf nodes)
 	LeafPort           int    `yaml:"leaf_port"`    // Port for leaf connections (for center nodes)
 	ClusterPort        int    `yaml:"cluster_port"` // Port for cluster connections
+	ClusterRoutes      string `yaml:"cluster_routes"` // Comma-separated route URLs of the other cluster members
+	JetStreamDomain    string `yaml:"jetstream_domain"` // JetStream domain of an embedded center, required for a standby pair
+	PrimaryURL         string `yaml:"primary_url"`      // Leaf URL of the primary center this center stands by for ("" disables)
+	PrimaryDomain      string `yaml:"primary_domain"`   // JetStream domain of the primary center
+	FailoverAfter      string `yaml:"failover_after"`   // How long a standby waits on a lost primary before taking over
 	StartTimeout       string `yaml:"start_timeout"` // Startup wait duration (e.g., 30s)
+	ReconnectWait      string `yaml:"reconnect_wait"`     // Initial reconnect delay, doubled per attempt with jitter
+	ReconnectMaxWait   string `yaml:"reconnect_max_wait"` // Reconnect delay cap
+	MaxReconnects      int    `yaml:"max_reconnects"`     // Reconnect attempts before giving up (<= 0: unlimited)
+	ServerDebug        bool   `yaml:"server_debug"`       // Forward embedded server debug logs
+	ServerTrace        bool   `yaml:"server_trace"`       // Forward embedded server protocol traces
+	ReadTimeout        string `yaml:"read_timeout"`       // Bound on a single KV read
+	ReadConcurrency    int    `yaml:"read_concurrency"`   // KV reads a multi-user lookup runs at once
+	FormerKeyPrefixes  string `yaml:"former_key_prefixes"` // Comma-separated key prefixes older versions stored presences under
+	WriteTimeout       string `yaml:"write_timeout"`      // Bound on a single KV write or delete
+	WatchTimeout       string `yaml:"watch_timeout"`      // Bound on setting up the KV watch
+	HealthInterval     string `yaml:"health_interval"`    // How often to poll bucket mirror/replica lag ("0" disables)
+	WatchBuffer        int    `yaml:"watch_buffer"`       // Events buffered per watch callback (0: deliver synchronously)
+	WatchOverflow      string `yaml:"watch_overflow"`     // Full watch buffer policy: drop-oldest, coalesce or block
+	ProxyResponder     bool   `yaml:"proxy_responder"`    // Answer the store requests of proxy nodes from this node's bucket
+
+	ShadowURL        string  `yaml:"shadow_url"`         // Candidate store compared on reads during a migration ("" disables)
+	ShadowBucket     string  `yaml:"shadow_bucket"`      // Candidate KV bucket (default: KVBucket)
+	ShadowSampleRate float64 `yaml:"shadow_sample_rate"` // Fraction of store reads compared
 }
 
 // CacheConfig holds cache configuration
@@ -49,6 +107,15 @@ type CacheConfig struct {
 	NumCounters int64  `yaml:"num_counters"` // Ristretto: Number of counters for TinyLFU
 	BufferItems int64  `yaml:"buffer_items"` // Ristretto: Buffer size for async operations
 	Metrics     bool   `yaml:"metrics"`      // Ristretto: Enable cache metrics
+
+	BloomEnabled         bool    `yaml:"bloom_enabled"`          // Short-circuit lookups for never-seen users
+	BloomExpectedUsers   int     `yaml:"bloom_expected_users"`   // Bloom filter sizing
+	BloomFPRate          float64 `yaml:"bloom_fp_rate"`          // Target false-positive rate
+	BloomRebuildInterval string  `yaml:"bloom_rebuild_interval"` // How often to rebuild from KV keys, e.g., "10m"
+
+	VerifyInterval string `yaml:"verify_interval"` // How often to compare sampled cache entries with KV ("0" disables)
+	VerifySample   int    `yaml:"verify_sample"`   // Cache entries compared per run
+	VerifyGrace    string `yaml:"verify_grace"`    // Age a newer KV write must reach before the cache counts as stale
 }
 
 // AuthConfig holds authentication configuration
@@ -56,12 +123,170 @@ type AuthConfig struct {
 	JWTSecret string `yaml:"jwt_secret"`
 	JWTIssuer string `yaml:"jwt_issuer"`
 	JWTTTL    string `yaml:"jwt_ttl"`
+
+	JWKSURL     string `yaml:"jwks_url"`     // JSON Web Key Set of the identity provider; enables RS256 and ES256 tokens
+	JWKSRefresh string `yaml:"jwks_refresh"` // Interval between scheduled key set refreshes
+
+	Authorizer        string `yaml:"authorizer"`         // "none", "owner", "scope", "http" or "opa"
+	AuthorizerURL     string `yaml:"authorizer_url"`     // Policy endpoint of the http authorizer, or the OPA server of the opa authorizer
+	AuthorizerTimeout string `yaml:"authorizer_timeout"` // Bound on one http authorizer decision
+	SelfWrites        bool   `yaml:"self_writes"`        // Refuse callers setting presence other than their own, and anonymous writes, whatever the authorizer
+	ServiceAccounts   string `yaml:"service_accounts"`   // Comma-separated JWT subjects that may set anyone's presence
+	Roles             string `yaml:"roles"`              // role,scope[,scope...] entries separated by semicolons
+	RolesClaim        string `yaml:"roles_claim"`        // Dotted path of the JWT claim listing the caller's roles
 }
 
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
+
+	OverrideDuration string `yaml:"override_duration"` // How long a runtime level change lasts by default
+
+	SampleWindow string `yaml:"sample_window"` // Window in which repeats of a record are counted rather than logged; 0 logs every record
+	SampleBurst  int    `yaml:"sample_burst"`  // Occurrences of a record logged per window
+}
+
+// PrivacyConfig holds data-protection configuration
+type PrivacyConfig struct {
+	Pseudonymize bool   `yaml:"pseudonymize"`  // HMAC user IDs before storage/event emission
+	PseudonymKey string `yaml:"pseudonym_key"` // HMAC key, held only by the API layer
+}
+
+// GRPCConfig holds gRPC server configuration
+type GRPCConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	Port        int  `yaml:"port"`
+	WatchBuffer int  `yaml:"watch_buffer"` // Buffered deltas per WatchPresence stream
+	Gateway     bool `yaml:"gateway"`      // Serve the /api/v2 presence routes via grpc-gateway
+}
+
+// APIConfig holds REST API presentation configuration
+type APIConfig struct {
+	ResponseProfiles  string `yaml:"response_profiles"`   // Comma-separated subject=profile defaults, e.g. "legacy-crm=flat"
+	BatchReadBudget   int    `yaml:"batch_read_budget"`   // Max projected store reads per batch read; 0 disables
+	NDJSONChunkSize   int    `yaml:"ndjson_chunk_size"`   // Users resolved per store read in streamed NDJSON reads
+	Deprecations      string `yaml:"deprecations"`        // Semicolon-separated version,deprecated[,sunset[,link]] entries, dates as YYYY-MM-DD
+	LocalesDir        string `yaml:"locales_dir"`         // Directory of <language>.json error message catalogs added to the built-in ones
+	ResultCacheWindow string `yaml:"result_cache_window"` // How long contacts and stats responses are reused; 0 disables
+}
+
+// DeprecationConfig schedules the retirement of an API version
+type DeprecationConfig struct {
+	Version    string
+	Deprecated time.Time
+	Sunset     time.Time // Zero if not scheduled
+	Link       string
+}
+
+// QuotaConfig holds per-tenant request quota configuration
+type QuotaConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	DailyLimit       int64  `yaml:"daily_limit"`        // Requests per tenant per UTC day (0: unlimited)
+	MonthlyLimit     int64  `yaml:"monthly_limit"`      // Requests per tenant per UTC month (0: unlimited)
+	RouteDailyLimits string `yaml:"route_daily_limits"` // Comma-separated route=limit, e.g. "presence.batch=1000"
+	Bucket           string `yaml:"bucket"`             // KV bucket holding the usage counters
+	FlushInterval    string `yaml:"flush_interval"`     // How often each node flushes its counts to KV
+	Retention        string `yaml:"retention"`          // How long usage counters are kept
+}
+
+// RateLimitConfig holds the per-client request rate limits
+type RateLimitConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	Rate           float64 `yaml:"rate"`            // Requests per second per client
+	Burst          int     `yaml:"burst"`           // Requests allowed at once after an idle period
+	TrustForwarded bool    `yaml:"trust_forwarded"` // Key anonymous clients by X-Forwarded-For, behind a proxy that sets it
+}
+
+// WriteBehindConfig holds offline write-behind configuration, for leaf nodes
+// with unreliable links to the center
+type WriteBehindConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Path           string `yaml:"path"`            // Journal file of queued writes
+	ReplayInterval string `yaml:"replay_interval"` // How often queued writes are replayed while connected
+}
+
+// SinksConfig holds the event sinks presence changes are forwarded to
+type SinksConfig struct {
+	Specs string `yaml:"specs"` // Semicolon-separated name,kind,target[,mode[,version]] entries
+}
+
+// PresenceConfig holds the deployment's presence state machine and
+// automatic transitions
+type PresenceConfig struct {
+	Statuses           string `yaml:"statuses"`            // Comma-separated statuses accepted on top of the core ones
+	Transitions        string `yaml:"transitions"`         // Comma-separated from=to|to rules; statuses without one may change to any
+	TransitionInterval string `yaml:"transition_interval"` // How often center nodes scan for automatic away/offline changes ("0" disables)
+	AwayAfter          string `yaml:"away_after"`          // Idle time before an online user is marked away ("0" disables)
+	WriteCoalesce      string `yaml:"write_coalesce"`      // Hold a user's refreshes back from KV for this long after a write ("0" disables)
+}
+
+// SubscriptionsConfig holds presence subscription settings
+type SubscriptionsConfig struct {
+	Enabled      bool   `yaml:"enabled"`       // Serve /api/v2/subscriptions
+	MaxPerUser   int    `yaml:"max_per_user"`  // Live subscriptions per caller
+	MaxUsers     int    `yaml:"max_users"`     // Watched users per subscription
+	DefaultTTL   string `yaml:"default_ttl"`   // Lifetime when none is requested
+	MaxTTL       string `yaml:"max_ttl"`       // Longest lifetime, on creation or renewal
+	Webhooks     bool   `yaml:"webhooks"`      // Let subscriptions name a webhook URL
+	WebhookHosts string `yaml:"webhook_hosts"` // Comma-separated hosts webhooks may name ("" allows any public host)
+}
+
+// ContactsConfig holds the contact directory behind /api/v2/presence/me/contacts
+type ContactsConfig struct {
+	URL         string `yaml:"url"`          // Contact list endpoint with a {user_id} placeholder ("" disables)
+	Timeout     string `yaml:"timeout"`      // Bound on one contact lookup
+	MaxContacts int    `yaml:"max_contacts"` // Longest contact list served
+}
+
+// AnnotationsConfig holds the annotations trusted services attach to presences
+type AnnotationsConfig struct {
+	Namespaces string `yaml:"namespaces"` // Comma-separated namespaces services may write ("" disables)
+	Bucket     string `yaml:"bucket"`     // KV bucket of the annotations
+	MaxKeys    int    `yaml:"max_keys"`   // Annotations per user and namespace
+	MaxBytes   int    `yaml:"max_bytes"`  // Size of a user's keys and values per namespace
+}
+
+// WebhooksConfig holds the signed presence-change webhooks
+type WebhooksConfig struct {
+	Endpoints   string `yaml:"endpoints"`    // Semicolon-separated name,url[,secret] entries
+	Secret      string `yaml:"secret"`       // HMAC secret of endpoints without their own
+	MaxAttempts int    `yaml:"max_attempts"` // Delivery attempts per change before it is dead-lettered
+	Backoff     string `yaml:"backoff"`      // Delay before the first retry, doubled for each further one
+	MaxBackoff  string `yaml:"max_backoff"`  // Retry delay cap
+	Timeout     string `yaml:"timeout"`      // Bound on one delivery attempt
+}
+
+// WebhookConfig describes one webhook endpoint
+type WebhookConfig struct {
+	Name   string
+	URL    string
+	Secret string
+}
+
+// SinkConfig describes one event sink
+type SinkConfig struct {
+	Name    string
+	Kind    string // "webhook" or "nats"
+	Target  string // Webhook URL or NATS subject
+	Mode    string // "at-most-once" (default) or "at-least-once"
+	Version string // Event payload version, "v1" (default) or "v2"
+}
+
+// StreamConfig holds WebSocket streaming configuration
+type StreamConfig struct {
+	MaxSubscriptions int    `yaml:"max_subscriptions"` // Max watched user IDs per connection
+	SendBuffer       int    `yaml:"send_buffer"`       // Buffered outbound messages per connection
+	PingInterval     string `yaml:"ping_interval"`     // Keepalive ping interval (e.g., 30s)
+	ResumeWindow     string `yaml:"resume_window"`     // How long a dropped session can be resumed
+	ResumeBuffer     int    `yaml:"resume_buffer"`     // Max events retained for replay on resume
+	CoalesceWindow   string `yaml:"coalesce_window"`   // Window for merging a user's rapid changes before fan-out ("0" disables)
+	ImplicitPresence bool   `yaml:"implicit_presence"` // Mark authenticated stream callers online while connected
+	ImplicitTTL      string `yaml:"implicit_ttl"`      // TTL of implicit presences, refreshed every half TTL
+	OfflineDebounce  string `yaml:"offline_debounce"`  // Grace period after the last disconnect before going offline
+
+	MaxConnectionsPerUser   int `yaml:"max_connections_per_user"`   // Open WebSocket and SSE connections per user on a node (0: unlimited)
+	MaxConnectionsPerTenant int `yaml:"max_connections_per_tenant"` // Open WebSocket and SSE connections per tenant on a node (0: unlimited)
 }
 
 // Load loads configuration from environment variables with defaults
@@ -71,8 +296,20 @@ func Load() (*Config, error) {
 			Name:     getEnvOrDefault("SERVICE_NAME", "presence-service"),
 			Version:  getEnvOrDefault("SERVICE_VERSION", "v2"),
 			Port:     getEnvIntOrDefault("SERVICE_PORT", 8080),
+			Host:     getEnvOrDefault("SERVICE_HOST", ""),
 			NodeType: getEnvOrDefault("NODE_TYPE", "center"),
 			NodeID:   getEnvOrDefault("NODE_ID", "node-1"),
+			Region:   getEnvOrDefault("NODE_REGION", ""),
+
+			DrainTimeout: getEnvOrDefault("SERVICE_DRAIN_TIMEOUT", "30s"),
+			DrainDelay:   getEnvOrDefault("SERVICE_DRAIN_DELAY", "5s"),
+
+			TLSCert:  getEnvOrDefault("SERVICE_TLS_CERT", ""),
+			TLSKey:   getEnvOrDefault("SERVICE_TLS_KEY", ""),
+			ClientCA: getEnvOrDefault("SERVICE_CLIENT_CA", ""),
+
+			ErrorReportURL:     getEnvOrDefault("ERROR_REPORT_URL", ""),
+			ErrorReportTimeout: getEnvOrDefault("ERROR_REPORT_TIMEOUT", "5s"),
 		},
 		NATS: NATSConfig{
 			Embedded:           getEnvBoolOrDefault("NATS_EMBEDDED", true),
@@ -81,11 +318,37 @@ func Load() (*Config, error) {
 			JetStreamMaxMemory: getEnvInt64OrDefault("NATS_JETSTREAM_MAX_MEMORY", 64*1024*1024),  // 64MB
 			JetStreamMaxStore:  getEnvInt64OrDefault("NATS_JETSTREAM_MAX_STORE", 1024*1024*1024), // 1GB
 			KVBucket:           getEnvOrDefault("NATS_KV_BUCKET", "presence"),
+			Environment:        getEnvOrDefault("NATS_ENVIRONMENT", ""),
 			KVTTL:              getEnvOrDefault("NATS_KV_TTL", "3600s"),
+			KVReplicas:         getEnvIntOrDefault("NATS_KV_REPLICAS", 1),
+			KVHistory:          getEnvIntOrDefault("NATS_KV_HISTORY", 1),
 			CenterURL:          getEnvOrDefault("NATS_CENTER_URL", ""),
 			LeafPort:           getEnvIntOrDefault("NATS_LEAF_PORT", 7422),
 			ClusterPort:        getEnvIntOrDefault("NATS_CLUSTER_PORT", 6222),
+			ClusterRoutes:      getEnvOrDefault("NATS_CLUSTER_ROUTES", ""),
+			JetStreamDomain:    getEnvOrDefault("NATS_JETSTREAM_DOMAIN", ""),
+			PrimaryURL:         getEnvOrDefault("NATS_PRIMARY_URL", ""),
+			PrimaryDomain:      getEnvOrDefault("NATS_PRIMARY_DOMAIN", ""),
+			FailoverAfter:      getEnvOrDefault("NATS_FAILOVER_AFTER", "15s"),
 			StartTimeout:       getEnvOrDefault("NATS_START_TIMEOUT", "30s"),
+			ReconnectWait:      getEnvOrDefault("NATS_RECONNECT_WAIT", "500ms"),
+			ReconnectMaxWait:   getEnvOrDefault("NATS_RECONNECT_MAX_WAIT", "30s"),
+			MaxReconnects:      getEnvIntOrDefault("NATS_MAX_RECONNECTS", -1),
+			ServerDebug:        getEnvBoolOrDefault("NATS_SERVER_DEBUG", false),
+			ServerTrace:        getEnvBoolOrDefault("NATS_SERVER_TRACE", false),
+			ReadTimeout:        getEnvOrDefault("NATS_READ_TIMEOUT", "2s"),
+			ReadConcurrency:    getEnvIntOrDefault("NATS_READ_CONCURRENCY", 16),
+			FormerKeyPrefixes:  getEnvOrDefault("NATS_FORMER_KEY_PREFIXES", ""),
+			WriteTimeout:       getEnvOrDefault("NATS_WRITE_TIMEOUT", "3s"),
+			WatchTimeout:       getEnvOrDefault("NATS_WATCH_TIMEOUT", "10s"),
+			HealthInterval:     getEnvOrDefault("NATS_HEALTH_INTERVAL", "15s"),
+			WatchBuffer:        getEnvIntOrDefault("NATS_WATCH_BUFFER", 1024),
+			WatchOverflow:      getEnvOrDefault("NATS_WATCH_OVERFLOW", "coalesce"),
+			ProxyResponder:     getEnvBoolOrDefault("NATS_PROXY_RESPONDER", true),
+
+			ShadowURL:        getEnvOrDefault("NATS_SHADOW_URL", ""),
+			ShadowBucket:     getEnvOrDefault("NATS_SHADOW_KV_BUCKET", ""),
+			ShadowSampleRate: getEnvFloatOrDefault("NATS_SHADOW_SAMPLE_RATE", 1),
 		},
 		Cache: CacheConfig{
 			Type:        getEnvOrDefault("CACHE_TYPE", "ristretto"),
@@ -95,43 +358,903 @@ func Load() (*Config, error) {
 			NumCounters: getEnvInt64OrDefault("CACHE_NUM_COUNTERS", 100000),
 			BufferItems: getEnvInt64OrDefault("CACHE_BUFFER_ITEMS", 64),
 			Metrics:     getEnvBoolOrDefault("CACHE_METRICS", true),
+
+			BloomEnabled:         getEnvBoolOrDefault("BLOOM_ENABLED", false),
+			BloomExpectedUsers:   getEnvIntOrDefault("BLOOM_EXPECTED_USERS", 1000000),
+			BloomFPRate:          getEnvFloatOrDefault("BLOOM_FP_RATE", 0.01),
+			BloomRebuildInterval: getEnvOrDefault("BLOOM_REBUILD_INTERVAL", "10m"),
+
+			VerifyInterval: getEnvOrDefault("CACHE_VERIFY_INTERVAL", "0"),
+			VerifySample:   getEnvIntOrDefault("CACHE_VERIFY_SAMPLE", 100),
+			VerifyGrace:    getEnvOrDefault("CACHE_VERIFY_GRACE", "5s"),
 		},
 		Auth: AuthConfig{
 			JWTSecret: getEnvOrDefault("JWT_SECRET", ""),
 			JWTIssuer: getEnvOrDefault("JWT_ISSUER", "presence-service"),
 			JWTTTL:    getEnvOrDefault("JWT_TTL", "24h"),
+
+			JWKSURL:     getEnvOrDefault("JWT_JWKS_URL", ""),
+			JWKSRefresh: getEnvOrDefault("JWT_JWKS_REFRESH", "1h"),
+
+			Authorizer:        getEnvOrDefault("AUTHZ_MODE", "none"),
+			AuthorizerURL:     getEnvOrDefault("AUTHZ_URL", ""),
+			AuthorizerTimeout: getEnvOrDefault("AUTHZ_TIMEOUT", "2s"),
+			SelfWrites:        getEnvBoolOrDefault("AUTHZ_SELF_WRITES", true),
+			ServiceAccounts:   getEnvOrDefault("AUTHZ_SERVICE_ACCOUNTS", ""),
+			Roles:             getEnvOrDefault("AUTHZ_ROLES", ""),
+			RolesClaim:        getEnvOrDefault("AUTHZ_ROLES_CLAIM", "roles"),
 		},
 		Logging: LoggingConfig{
 			Level:  getEnvOrDefault("LOG_LEVEL", "info"),
 			Format: getEnvOrDefault("LOG_FORMAT", "json"),
+
+			OverrideDuration: getEnvOrDefault("LOG_LEVEL_OVERRIDE_DURATION", "15m"),
+
+			SampleWindow: getEnvOrDefault("LOG_SAMPLE_WINDOW", "1m"),
+			SampleBurst:  getEnvIntOrDefault("LOG_SAMPLE_BURST", 1),
+		},
+		Privacy: PrivacyConfig{
+			Pseudonymize: getEnvBoolOrDefault("PRIVACY_PSEUDONYMIZE", false),
+			PseudonymKey: getEnvOrDefault("PRIVACY_PSEUDONYM_KEY", ""),
+		},
+		Stream: StreamConfig{
+			MaxSubscriptions: getEnvIntOrDefault("STREAM_MAX_SUBSCRIPTIONS", 500),
+			SendBuffer:       getEnvIntOrDefault("STREAM_SEND_BUFFER", 256),
+			PingInterval:     getEnvOrDefault("STREAM_PING_INTERVAL", "30s"),
+			ResumeWindow:     getEnvOrDefault("STREAM_RESUME_WINDOW", "2m"),
+			ResumeBuffer:     getEnvIntOrDefault("STREAM_RESUME_BUFFER", 256),
+			CoalesceWindow:   getEnvOrDefault("STREAM_COALESCE_WINDOW", "0"),
+			ImplicitPresence: getEnvBoolOrDefault("STREAM_IMPLICIT_PRESENCE", false),
+			ImplicitTTL:      getEnvOrDefault("STREAM_IMPLICIT_TTL", "60s"),
+			OfflineDebounce:  getEnvOrDefault("STREAM_OFFLINE_DEBOUNCE", "10s"),
+
+			MaxConnectionsPerUser:   getEnvIntOrDefault("STREAM_MAX_CONNECTIONS_PER_USER", 0),
+			MaxConnectionsPerTenant: getEnvIntOrDefault("STREAM_MAX_CONNECTIONS_PER_TENANT", 0),
+		},
+		GRPC: GRPCConfig{
+			Enabled:     getEnvBoolOrDefault("GRPC_ENABLED", false),
+			Port:        getEnvIntOrDefault("GRPC_PORT", 9090),
+			WatchBuffer: getEnvIntOrDefault("GRPC_WATCH_BUFFER", 256),
+			Gateway:     getEnvBoolOrDefault("GRPC_GATEWAY_ENABLED", false),
+		},
+		Quota: QuotaConfig{
+			Enabled:          getEnvBoolOrDefault("QUOTA_ENABLED", false),
+			DailyLimit:       getEnvInt64OrDefault("QUOTA_DAILY_LIMIT", 0),
+			MonthlyLimit:     getEnvInt64OrDefault("QUOTA_MONTHLY_LIMIT", 0),
+			RouteDailyLimits: getEnvOrDefault("QUOTA_ROUTE_DAILY_LIMITS", ""),
+			Bucket:           getEnvOrDefault("QUOTA_BUCKET", "presence_quota"),
+			FlushInterval:    getEnvOrDefault("QUOTA_FLUSH_INTERVAL", "10s"),
+			Retention:        getEnvOrDefault("QUOTA_RETENTION", "2208h"), // 92 days
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:        getEnvBoolOrDefault("RATE_LIMIT_ENABLED", false),
+			Rate:           getEnvFloatOrDefault("RATE_LIMIT_RATE", 10),
+			Burst:          getEnvIntOrDefault("RATE_LIMIT_BURST", 20),
+			TrustForwarded: getEnvBoolOrDefault("RATE_LIMIT_TRUST_FORWARDED", false),
+		},
+		WriteBehind: WriteBehindConfig{
+			Enabled:        getEnvBoolOrDefault("WRITE_BEHIND_ENABLED", false),
+			Path:           getEnvOrDefault("WRITE_BEHIND_PATH", "./write-behind/queue.log"),
+			ReplayInterval: getEnvOrDefault("WRITE_BEHIND_REPLAY_INTERVAL", "5s"),
+		},
+		Sinks: SinksConfig{
+			Specs: getEnvOrDefault("EVENT_SINKS", ""),
+		},
+		Presence: PresenceConfig{
+			Statuses:           getEnvOrDefault("PRESENCE_STATUSES", ""),
+			Transitions:        getEnvOrDefault("PRESENCE_TRANSITIONS", ""),
+			TransitionInterval: getEnvOrDefault("PRESENCE_TRANSITION_INTERVAL", "0"),
+			AwayAfter:          getEnvOrDefault("PRESENCE_AWAY_AFTER", "5m"),
+			WriteCoalesce:      getEnvOrDefault("PRESENCE_WRITE_COALESCE", "0"),
+		},
+		Subscriptions: SubscriptionsConfig{
+			Enabled:      getEnvBoolOrDefault("SUBSCRIPTIONS_ENABLED", false),
+			MaxPerUser:   getEnvIntOrDefault("SUBSCRIPTIONS_MAX_PER_USER", 10),
+			MaxUsers:     getEnvIntOrDefault("SUBSCRIPTIONS_MAX_USERS", 500),
+			DefaultTTL:   getEnvOrDefault("SUBSCRIPTIONS_DEFAULT_TTL", "1h"),
+			MaxTTL:       getEnvOrDefault("SUBSCRIPTIONS_MAX_TTL", "24h"),
+			Webhooks:     getEnvBoolOrDefault("SUBSCRIPTIONS_WEBHOOKS", false),
+			WebhookHosts: getEnvOrDefault("SUBSCRIPTIONS_WEBHOOK_HOSTS", ""),
+		},
+		Webhooks: WebhooksConfig{
+			Endpoints:   getEnvOrDefault("WEBHOOKS", ""),
+			Secret:      getEnvOrDefault("WEBHOOKS_SECRET", ""),
+			MaxAttempts: getEnvIntOrDefault("WEBHOOKS_MAX_ATTEMPTS", 5),
+			Backoff:     getEnvOrDefault("WEBHOOKS_BACKOFF", "1s"),
+			MaxBackoff:  getEnvOrDefault("WEBHOOKS_MAX_BACKOFF", "1m"),
+			Timeout:     getEnvOrDefault("WEBHOOKS_TIMEOUT", "10s"),
+		},
+		Annotations: AnnotationsConfig{
+			Namespaces: getEnvOrDefault("ANNOTATIONS_NAMESPACES", ""),
+			Bucket:     getEnvOrDefault("ANNOTATIONS_BUCKET", "presence_annotations"),
+			MaxKeys:    getEnvIntOrDefault("ANNOTATIONS_MAX_KEYS", 16),
+			MaxBytes:   getEnvIntOrDefault("ANNOTATIONS_MAX_BYTES", 1024),
+		},
+		Contacts: ContactsConfig{
+			URL:         getEnvOrDefault("CONTACTS_URL", ""),
+			Timeout:     getEnvOrDefault("CONTACTS_TIMEOUT", "2s"),
+			MaxContacts: getEnvIntOrDefault("CONTACTS_MAX_CONTACTS", 1000),
+		},
+		API: APIConfig{
+			ResponseProfiles:  getEnvOrDefault("API_RESPONSE_PROFILES", ""),
+			BatchReadBudget:   getEnvIntOrDefault("API_BATCH_READ_BUDGET", 1000),
+			NDJSONChunkSize:   getEnvIntOrDefault("API_NDJSON_CHUNK_SIZE", 100),
+			Deprecations:      getEnvOrDefault("API_DEPRECATIONS", ""),
+			LocalesDir:        getEnvOrDefault("API_LOCALES_DIR", ""),
+			ResultCacheWindow: getEnvOrDefault("API_RESULT_CACHE_WINDOW", "5s"),
 		},
 	}
 
 	// Validate required fields
-	if config.Auth.JWTSecret == "" {
+	if config.Service.Port < 1 || config.Service.Port > 65535 {
+		return nil, fmt.Errorf("SERVICE_PORT must be between 1 and 65535, got %d", config.Service.Port)
+	}
+	if config.NATS.Environment != "" && !validSinkName(config.NATS.Environment) {
+		return nil, fmt.Errorf("NATS_ENVIRONMENT %q must be letters, digits, '-' or '_'", config.NATS.Environment)
+	}
+	if config.NATS.KVReplicas < 1 || config.NATS.KVReplicas > 5 {
+		return nil, fmt.Errorf("NATS_KV_REPLICAS must be between 1 and 5, got %d", config.NATS.KVReplicas)
+	}
+	if config.NATS.KVHistory < 1 || config.NATS.KVHistory > 64 {
+		return nil, fmt.Errorf("NATS_KV_HISTORY must be between 1 and 64, got %d", config.NATS.KVHistory)
+	}
+	if config.Service.NodeType == "proxy" {
+		if config.NATS.Embedded {
+			return nil, fmt.Errorf("NODE_TYPE=proxy runs no NATS server; set NATS_EMBEDDED=false")
+		}
+		if config.NATS.ServerURL == "" && config.NATS.CenterURL == "" {
+			return nil, fmt.Errorf("NODE_TYPE=proxy requires NATS_SERVER_URL or NATS_CENTER_URL")
+		}
+	}
+	if config.NATS.PrimaryURL != "" {
+		if !config.NATS.Embedded || (config.Service.NodeType != "" && config.Service.NodeType != "center") {
+			return nil, fmt.Errorf("NATS_PRIMARY_URL requires an embedded center node")
+		}
+		if config.NATS.JetStreamDomain == "" || config.NATS.PrimaryDomain == "" || config.NATS.JetStreamDomain == config.NATS.PrimaryDomain {
+			return nil, fmt.Errorf("NATS_PRIMARY_URL requires NATS_JETSTREAM_DOMAIN and NATS_PRIMARY_DOMAIN, set to different domains")
+		}
+		if after, err := config.NATS.GetFailoverAfter(); err != nil || after <= 0 {
+			return nil, fmt.Errorf("NATS_FAILOVER_AFTER must be a positive duration, got %q", config.NATS.FailoverAfter)
+		}
+	}
+	if (config.Service.TLSCert == "") != (config.Service.TLSKey == "") {
+		return nil, fmt.Errorf("SERVICE_TLS_CERT and SERVICE_TLS_KEY must be set together")
+	}
+	if config.Service.ClientCA != "" && config.Service.TLSCert == "" {
+		return nil, fmt.Errorf("SERVICE_CLIENT_CA requires SERVICE_TLS_CERT and SERVICE_TLS_KEY")
+	}
+	if _, err := config.Service.GetTLSConfig(); err != nil {
+		return nil, err
+	}
+	if config.Auth.JWTSecret == "" && config.Auth.JWKSURL == "" {
 		return nil, fmt.Errorf("JWT_SECRET environment variable is required")
 	}
+	if config.Auth.JWKSURL != "" {
+		if refresh, err := config.Auth.GetJWKSRefresh(); err != nil || refresh <= 0 {
+			return nil, fmt.Errorf("JWT_JWKS_REFRESH must be a positive duration, got %q", config.Auth.JWKSRefresh)
+		}
+	}
+	switch config.Auth.Authorizer {
+	case "none", "owner", "scope":
+	case "http", "opa":
+		if config.Auth.AuthorizerURL == "" {
+			return nil, fmt.Errorf("AUTHZ_URL is required when AUTHZ_MODE is %s", config.Auth.Authorizer)
+		}
+	default:
+		return nil, fmt.Errorf("AUTHZ_MODE must be none, owner, scope, http or opa, got %q", config.Auth.Authorizer)
+	}
+	if roles, err := config.Auth.GetRoles(); err != nil {
+		return nil, fmt.Errorf("invalid AUTHZ_ROLES: %w", err)
+	} else if len(roles) > 0 && config.Auth.RolesClaim == "" {
+		return nil, fmt.Errorf("AUTHZ_ROLES_CLAIM is required when AUTHZ_ROLES is set")
+	}
+	if config.Privacy.Pseudonymize && config.Privacy.PseudonymKey == "" {
+		return nil, fmt.Errorf("PRIVACY_PSEUDONYM_KEY is required when PRIVACY_PSEUDONYMIZE is enabled")
+	}
+	if config.RateLimit.Enabled && (config.RateLimit.Rate <= 0 || config.RateLimit.Burst < 1) {
+		return nil, fmt.Errorf("RATE_LIMIT_RATE must be positive and RATE_LIMIT_BURST at least 1, got %v and %d", config.RateLimit.Rate, config.RateLimit.Burst)
+	}
+	if _, err := config.Quota.GetRouteDailyLimits(); err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_ROUTE_DAILY_LIMITS: %w", err)
+	}
+	if config.API.BatchReadBudget < 0 {
+		return nil, fmt.Errorf("API_BATCH_READ_BUDGET must not be negative")
+	}
+	if config.API.NDJSONChunkSize < 1 {
+		return nil, fmt.Errorf("API_NDJSON_CHUNK_SIZE must be positive")
+	}
+	if d, err := config.API.GetResultCacheWindow(); err != nil || d < 0 {
+		return nil, fmt.Errorf("API_RESULT_CACHE_WINDOW must be a non-negative duration, got %q", config.API.ResultCacheWindow)
+	}
+	if config.NATS.ReadConcurrency < 1 {
+		return nil, fmt.Errorf("NATS_READ_CONCURRENCY must be positive, got %d", config.NATS.ReadConcurrency)
+	}
+	if _, err := config.NATS.GetFormerKeyPrefixes(); err != nil {
+		return nil, fmt.Errorf("invalid NATS_FORMER_KEY_PREFIXES: %w", err)
+	}
+	if _, err := config.API.GetResponseProfiles(); err != nil {
+		return nil, fmt.Errorf("invalid API_RESPONSE_PROFILES: %w", err)
+	}
+	if _, err := config.API.GetDeprecations(); err != nil {
+		return nil, fmt.Errorf("invalid API_DEPRECATIONS: %w", err)
+	}
+	if _, err := config.Sinks.GetSinks(); err != nil {
+		return nil, fmt.Errorf("invalid EVENT_SINKS: %w", err)
+	}
+	if d, err := config.Service.GetDrainTimeout(); err != nil || d <= 0 {
+		return nil, fmt.Errorf("SERVICE_DRAIN_TIMEOUT must be a positive duration, got %q", config.Service.DrainTimeout)
+	}
+	if d, err := config.Service.GetDrainDelay(); err != nil || d < 0 {
+		return nil, fmt.Errorf("SERVICE_DRAIN_DELAY must be a non-negative duration, got %q", config.Service.DrainDelay)
+	}
+	if d, err := config.Service.GetErrorReportTimeout(); err != nil || d <= 0 {
+		return nil, fmt.Errorf("ERROR_REPORT_TIMEOUT must be a positive duration, got %q", config.Service.ErrorReportTimeout)
+	}
+	if d, err := config.Logging.GetOverrideDuration(); err != nil || d <= 0 || d > 24*time.Hour {
+		return nil, fmt.Errorf("LOG_LEVEL_OVERRIDE_DURATION must be a positive duration of at most 24h, got %q", config.Logging.OverrideDuration)
+	}
+	if d, err := config.Logging.GetSampleWindow(); err != nil || d < 0 {
+		return nil, fmt.Errorf("LOG_SAMPLE_WINDOW must be a non-negative duration, got %q", config.Logging.SampleWindow)
+	} else if d > 0 && config.Logging.SampleBurst < 1 {
+		return nil, fmt.Errorf("LOG_SAMPLE_BURST must be at least 1, got %d", config.Logging.SampleBurst)
+	}
+	if d, err := config.Cache.GetVerifyInterval(); err != nil || d < 0 {
+		return nil, fmt.Errorf("CACHE_VERIFY_INTERVAL must be a non-negative duration, got %q", config.Cache.VerifyInterval)
+	} else if d > 0 {
+		if config.Cache.VerifySample <= 0 {
+			return nil, fmt.Errorf("CACHE_VERIFY_SAMPLE must be positive, got %d", config.Cache.VerifySample)
+		}
+		if g, err := config.Cache.GetVerifyGrace(); err != nil || g < 0 {
+			return nil, fmt.Errorf("CACHE_VERIFY_GRACE must be a non-negative duration, got %q", config.Cache.VerifyGrace)
+		}
+	}
+	if config.NATS.ShadowURL != "" && (config.NATS.ShadowSampleRate <= 0 || config.NATS.ShadowSampleRate > 1) {
+		return nil, fmt.Errorf("NATS_SHADOW_SAMPLE_RATE must be in (0, 1], got %v", config.NATS.ShadowSampleRate)
+	}
+	if _, err := config.Presence.GetStateMachine(); err != nil {
+		return nil, fmt.Errorf("invalid PRESENCE_STATUSES or PRESENCE_TRANSITIONS: %w", err)
+	}
+	if d, err := config.Presence.GetTransitionInterval(); err != nil || d < 0 {
+		return nil, fmt.Errorf("PRESENCE_TRANSITION_INTERVAL must be a non-negative duration, got %q", config.Presence.TransitionInterval)
+	}
+	if d, err := config.Presence.GetAwayAfter(); err != nil || d < 0 {
+		return nil, fmt.Errorf("PRESENCE_AWAY_AFTER must be a non-negative duration, got %q", config.Presence.AwayAfter)
+	}
+	if d, err := config.Presence.GetWriteCoalesce(); err != nil || d < 0 {
+		return nil, fmt.Errorf("PRESENCE_WRITE_COALESCE must be a non-negative duration, got %q", config.Presence.WriteCoalesce)
+	}
+	if config.Subscriptions.Enabled {
+		if config.Subscriptions.MaxPerUser < 1 || config.Subscriptions.MaxUsers < 1 {
+			return nil, fmt.Errorf("SUBSCRIPTIONS_MAX_PER_USER and SUBSCRIPTIONS_MAX_USERS must be positive")
+		}
+		def, err := config.Subscriptions.GetDefaultTTL()
+		if err != nil || def <= 0 {
+			return nil, fmt.Errorf("SUBSCRIPTIONS_DEFAULT_TTL must be a positive duration, got %q", config.Subscriptions.DefaultTTL)
+		}
+		if d, err := config.Subscriptions.GetMaxTTL(); err != nil || d < def {
+			return nil, fmt.Errorf("SUBSCRIPTIONS_MAX_TTL must be a duration of at least SUBSCRIPTIONS_DEFAULT_TTL, got %q", config.Subscriptions.MaxTTL)
+		}
+	}
+	if hooks, err := config.Webhooks.GetEndpoints(); err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOKS: %w", err)
+	} else if len(hooks) > 0 {
+		if config.Webhooks.MaxAttempts < 1 {
+			return nil, fmt.Errorf("WEBHOOKS_MAX_ATTEMPTS must be positive")
+		}
+		backoff, err := config.Webhooks.GetBackoff()
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("WEBHOOKS_BACKOFF must be a positive duration, got %q", config.Webhooks.Backoff)
+		}
+		if d, err := config.Webhooks.GetMaxBackoff(); err != nil || d < backoff {
+			return nil, fmt.Errorf("WEBHOOKS_MAX_BACKOFF must be a duration of at least WEBHOOKS_BACKOFF, got %q", config.Webhooks.MaxBackoff)
+		}
+		// An attempt must end before the webhook's consumer gives the change to another node
+		if d, err := config.Webhooks.GetTimeout(); err != nil || d <= 0 || d >= 30*time.Second {
+			return nil, fmt.Errorf("WEBHOOKS_TIMEOUT must be a positive duration under 30s, got %q", config.Webhooks.Timeout)
+		}
+	}
+	if config.Contacts.URL != "" {
+		if !strings.Contains(config.Contacts.URL, "{user_id}") {
+			return nil, fmt.Errorf("CONTACTS_URL must contain a {user_id} placeholder, got %q", config.Contacts.URL)
+		}
+		if d, err := config.Contacts.GetTimeout(); err != nil || d <= 0 {
+			return nil, fmt.Errorf("CONTACTS_TIMEOUT must be a positive duration, got %q", config.Contacts.Timeout)
+		}
+		if config.Contacts.MaxContacts < 1 {
+			return nil, fmt.Errorf("CONTACTS_MAX_CONTACTS must be positive")
+		}
+	}
+	if len(config.Annotations.GetNamespaces()) > 0 {
+		if config.Annotations.Bucket == "" {
+			return nil, fmt.Errorf("ANNOTATIONS_BUCKET is required with ANNOTATIONS_NAMESPACES")
+		}
+		if config.Annotations.MaxKeys < 1 || config.Annotations.MaxBytes < 1 {
+			return nil, fmt.Errorf("ANNOTATIONS_MAX_KEYS and ANNOTATIONS_MAX_BYTES must be positive")
+		}
+	}
+	if config.Stream.ImplicitPresence {
+		if ttl, err := config.Stream.GetImplicitTTL(); err != nil || ttl < 2*time.Second {
+			return nil, fmt.Errorf("STREAM_IMPLICIT_TTL must be a duration of at least 2s, got %q", config.Stream.ImplicitTTL)
+		}
+		if d, err := config.Stream.GetOfflineDebounce(); err != nil || d < 0 {
+			return nil, fmt.Errorf("STREAM_OFFLINE_DEBOUNCE must be a non-negative duration, got %q", config.Stream.OfflineDebounce)
+		}
+	}
+	if config.Stream.MaxConnectionsPerUser < 0 || config.Stream.MaxConnectionsPerTenant < 0 {
+		return nil, fmt.Errorf("STREAM_MAX_CONNECTIONS_PER_USER and STREAM_MAX_CONNECTIONS_PER_TENANT must not be negative")
+	}
 
 	return config, nil
 }
 
+// ListenAddr returns the HTTP listen address, e.g. ":8080" or "127.0.0.1:8080"
+func (c *ServiceConfig) ListenAddr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// GetTLSConfig loads the HTTP listener's certificate, and the client CA
+// when mTLS is on; nil means plaintext
+func (c *ServiceConfig) GetTLSConfig() (*tls.Config, error) {
+	if c.TLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVICE_TLS_CERT or SERVICE_TLS_KEY: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCA == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(c.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVICE_CLIENT_CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("invalid SERVICE_CLIENT_CA: no PEM certificates in %s", c.ClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
+// GetDrainTimeout returns the node drain deadline as duration
+func (c *ServiceConfig) GetDrainTimeout() (time.Duration, error) {
+	return time.ParseDuration(c.DrainTimeout)
+}
+
+// GetDrainDelay returns the pause between failing readiness and closing
+// connections during a drain as duration
+func (c *ServiceConfig) GetDrainDelay() (time.Duration, error) {
+	return time.ParseDuration(c.DrainDelay)
+}
+
+// GetErrorReportTimeout returns the bound on one panic report as duration
+func (c *ServiceConfig) GetErrorReportTimeout() (time.Duration, error) {
+	return time.ParseDuration(c.ErrorReportTimeout)
+}
+
+// GetOverrideDuration returns how long a runtime log level change lasts
+// unless the request says otherwise as duration
+func (c *LoggingConfig) GetOverrideDuration() (time.Duration, error) {
+	return time.ParseDuration(c.OverrideDuration)
+}
+
+// GetSampleWindow returns the log sampling window as duration
+func (c *LoggingConfig) GetSampleWindow() (time.Duration, error) {
+	return time.ParseDuration(c.SampleWindow)
+}
+
 // GetCacheTTL returns cache TTL as duration
 func (c *CacheConfig) GetCacheTTL() (time.Duration, error) {
 	return time.ParseDuration(c.TTL)
 }
 
+// GetBloomRebuildInterval returns the seen-filter rebuild interval as duration
+func (c *CacheConfig) GetBloomRebuildInterval() (time.Duration, error) {
+	return time.ParseDuration(c.BloomRebuildInterval)
+}
+
+// GetVerifyInterval returns the cache verification interval as duration (0
+// disables)
+func (c *CacheConfig) GetVerifyInterval() (time.Duration, error) {
+	return time.ParseDuration(c.VerifyInterval)
+}
+
+// GetVerifyGrace returns how old a newer KV write must be before the cached
+// copy counts as stale, as duration
+func (c *CacheConfig) GetVerifyGrace() (time.Duration, error) {
+	return time.ParseDuration(c.VerifyGrace)
+}
+
 // Note: GetCleanupInterval removed as Ristretto handles cleanup automatically
 
 // GetKVTTL returns KV TTL as duration
 func (c *NATSConfig) GetKVTTL() (time.Duration, error) {
+	if c.KVTTL == "" {
+		return 0, nil
+	}
 	return time.ParseDuration(c.KVTTL)
 }
 
+// GetReconnectWait returns the initial NATS reconnect delay as duration (0 if unset)
+func (c *NATSConfig) GetReconnectWait() (time.Duration, error) {
+	if c.ReconnectWait == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.ReconnectWait)
+}
+
+// GetShadowBucket returns the candidate store's KV bucket, defaulting to
+// the primary's
+func (c *NATSConfig) GetShadowBucket() string {
+	if c.ShadowBucket != "" {
+		return c.ShadowBucket
+	}
+	return c.KVBucket
+}
+
+// Scoped returns the bucket or stream name in the configured environment,
+// "<environment>_<name>", or name itself when no environment is set
+func (c *NATSConfig) Scoped(name string) string {
+	if c.Environment == "" {
+		return name
+	}
+	return c.Environment + "_" + name
+}
+
+// ScopedSubject returns subject in the configured environment,
+// "<environment>.<subject>", or subject itself when no environment is set
+func (c *NATSConfig) ScopedSubject(subject string) string {
+	if c.Environment == "" {
+		return subject
+	}
+	return c.Environment + "." + subject
+}
+
+// GetHealthInterval returns the bucket health polling interval as duration (0 if unset)
+func (c *NATSConfig) GetHealthInterval() (time.Duration, error) {
+	if c.HealthInterval == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.HealthInterval)
+}
+
+// GetFailoverAfter returns how long a standby center waits on a lost
+// primary before taking over, as duration (0 if unset)
+func (c *NATSConfig) GetFailoverAfter() (time.Duration, error) {
+	if c.FailoverAfter == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.FailoverAfter)
+}
+
+// GetReconnectMaxWait returns the NATS reconnect delay cap as duration (0 if unset)
+func (c *NATSConfig) GetReconnectMaxWait() (time.Duration, error) {
+	if c.ReconnectMaxWait == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.ReconnectMaxWait)
+}
+
+// GetOpTimeouts returns the KV read, write and watch-setup timeouts as
+// durations (0 if unset)
+func (c *NATSConfig) GetOpTimeouts() (read, write, watch time.Duration, err error) {
+	for _, t := range []struct {
+		value string
+		out   *time.Duration
+	}{{c.ReadTimeout, &read}, {c.WriteTimeout, &write}, {c.WatchTimeout, &watch}} {
+		if t.value == "" {
+			continue
+		}
+		if *t.out, err = time.ParseDuration(t.value); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return read, write, watch, nil
+}
+
+// GetClusterRoutes returns the configured cluster route URLs
+func (c *NATSConfig) GetClusterRoutes() []string {
+	var routes []string
+	for _, r := range strings.Split(c.ClusterRoutes, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// GetFormerKeyPrefixes returns the key prefixes older versions stored
+// presences under. Each must end in "." and differ from the current "user."
+// prefix.
+func (c *NATSConfig) GetFormerKeyPrefixes() ([]string, error) {
+	var prefixes []string
+	for _, p := range strings.Split(c.FormerKeyPrefixes, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if !strings.HasSuffix(p, ".") || p == "." || p == "user." || strings.ContainsAny(p, " *>") {
+			return nil, fmt.Errorf("%q is not a key prefix ending in \".\" other than \"user.\"", p)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// GetResponseProfiles returns the default response profile of each client,
+// keyed by JWT subject
+func (c *APIConfig) GetResponseProfiles() (map[string]string, error) {
+	profiles := map[string]string{}
+	for _, pair := range strings.Split(c.ResponseProfiles, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		client, profile, ok := strings.Cut(pair, "=")
+		client, profile = strings.TrimSpace(client), strings.TrimSpace(profile)
+		if !ok || client == "" || profile == "" {
+			return nil, fmt.Errorf("expected subject=profile, got %q", pair)
+		}
+		profiles[client] = profile
+	}
+	return profiles, nil
+}
+
+// GetResultCacheWindow returns how long query results are reused as duration
+func (c *APIConfig) GetResultCacheWindow() (time.Duration, error) {
+	return time.ParseDuration(c.ResultCacheWindow)
+}
+
+// GetDeprecations returns the scheduled API version retirements
+func (c *APIConfig) GetDeprecations() ([]DeprecationConfig, error) {
+	var deps []DeprecationConfig
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(c.Deprecations, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if len(fields) < 2 || len(fields) > 4 || fields[0] == "" {
+			return nil, fmt.Errorf("expected version,deprecated[,sunset[,link]], got %q", entry)
+		}
+		d := DeprecationConfig{Version: fields[0]}
+		if seen[d.Version] {
+			return nil, fmt.Errorf("duplicate deprecation of %q", d.Version)
+		}
+		seen[d.Version] = true
+		var err error
+		if d.Deprecated, err = time.Parse(time.DateOnly, fields[1]); err != nil {
+			return nil, fmt.Errorf("%s: invalid deprecation date %q", d.Version, fields[1])
+		}
+		if len(fields) >= 3 && fields[2] != "" {
+			if d.Sunset, err = time.Parse(time.DateOnly, fields[2]); err != nil {
+				return nil, fmt.Errorf("%s: invalid sunset date %q", d.Version, fields[2])
+			}
+			if !d.Sunset.After(d.Deprecated) {
+				return nil, fmt.Errorf("%s: sunset must be after the deprecation", d.Version)
+			}
+		}
+		if len(fields) == 4 {
+			d.Link = fields[3]
+		}
+		deps = append(deps, d)
+	}
+	return deps, nil
+}
+
+// GetSinks returns the configured event sinks
+func (c *SinksConfig) GetSinks() ([]SinkConfig, error) {
+	var sinks []SinkConfig
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(c.Specs, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if len(fields) < 3 || len(fields) > 5 || fields[2] == "" {
+			return nil, fmt.Errorf("expected name,kind,target[,mode[,version]], got %q", entry)
+		}
+		sc := SinkConfig{Name: fields[0], Kind: fields[1], Target: fields[2], Mode: "at-most-once", Version: "v1"}
+		if len(fields) >= 4 && fields[3] != "" {
+			sc.Mode = fields[3]
+		}
+		if len(fields) == 5 && fields[4] != "" {
+			sc.Version = fields[4]
+		}
+		if !validSinkName(sc.Name) {
+			return nil, fmt.Errorf("sink name %q must be letters, digits, '-' or '_'", sc.Name)
+		}
+		if seen[sc.Name] {
+			return nil, fmt.Errorf("duplicate sink name %q", sc.Name)
+		}
+		seen[sc.Name] = true
+		if sc.Kind != "webhook" && sc.Kind != "nats" {
+			return nil, fmt.Errorf("sink %q: unknown kind %q", sc.Name, sc.Kind)
+		}
+		if sc.Mode != "at-most-once" && sc.Mode != "at-least-once" {
+			return nil, fmt.Errorf("sink %q: unknown delivery mode %q", sc.Name, sc.Mode)
+		}
+		if sc.Version != "v1" && sc.Version != "v2" {
+			return nil, fmt.Errorf("sink %q: unknown event payload version %q", sc.Name, sc.Version)
+		}
+		sinks = append(sinks, sc)
+	}
+	return sinks, nil
+}
+
+// validSinkName reports whether name can name a NATS consumer
+func validSinkName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// GetStateMachine returns the presence state machine described by the
+// configured statuses and transitions
+func (c *PresenceConfig) GetStateMachine() (*models.StateMachine, error) {
+	var statuses []models.PresenceStatus
+	for _, s := range strings.Split(c.Statuses, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			statuses = append(statuses, models.PresenceStatus(s))
+		}
+	}
+	transitions := map[models.PresenceStatus][]models.PresenceStatus{}
+	for _, rule := range strings.Split(c.Transitions, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(rule, "=")
+		from = strings.TrimSpace(from)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("expected from=to|to, got %q", rule)
+		}
+		if _, dup := transitions[models.PresenceStatus(from)]; dup {
+			return nil, fmt.Errorf("duplicate transition rule for %q", from)
+		}
+		targets := []models.PresenceStatus{}
+		for _, t := range strings.Split(to, "|") {
+			if t = strings.TrimSpace(t); t != "" {
+				targets = append(targets, models.PresenceStatus(t))
+			}
+		}
+		transitions[models.PresenceStatus(from)] = targets
+	}
+	return models.NewStateMachine(statuses, transitions)
+}
+
+// GetTransitionInterval returns how often to scan for automatic presence
+// transitions (0 disables them)
+func (c *PresenceConfig) GetTransitionInterval() (time.Duration, error) {
+	return time.ParseDuration(c.TransitionInterval)
+}
+
+// GetAwayAfter returns how long an online user may be idle before being
+// marked away (0 disables the away transition)
+func (c *PresenceConfig) GetAwayAfter() (time.Duration, error) {
+	return time.ParseDuration(c.AwayAfter)
+}
+
+// GetWriteCoalesce returns how long refreshes of a user are held back from
+// KV after a write (0 disables coalescing)
+func (c *PresenceConfig) GetWriteCoalesce() (time.Duration, error) {
+	return time.ParseDuration(c.WriteCoalesce)
+}
+
+// GetDefaultTTL returns the lifetime of subscriptions created without one
+func (c *SubscriptionsConfig) GetDefaultTTL() (time.Duration, error) {
+	return time.ParseDuration(c.DefaultTTL)
+}
+
+// GetMaxTTL returns the longest subscription lifetime
+func (c *SubscriptionsConfig) GetMaxTTL() (time.Duration, error) {
+	return time.ParseDuration(c.MaxTTL)
+}
+
+// GetWebhookHosts returns the hosts subscription webhooks may name; none
+// allows any public host
+func (c *SubscriptionsConfig) GetWebhookHosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(c.WebhookHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// GetEndpoints parses the configured webhooks; endpoints without a secret
+// of their own use Secret, and one must be set
+func (c *WebhooksConfig) GetEndpoints() ([]WebhookConfig, error) {
+	var hooks []WebhookConfig
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(c.Endpoints, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if len(fields) < 2 || len(fields) > 3 || fields[1] == "" {
+			return nil, fmt.Errorf("expected name,url[,secret], got %q", entry)
+		}
+		hook := WebhookConfig{Name: fields[0], URL: fields[1], Secret: c.Secret}
+		if len(fields) == 3 && fields[2] != "" {
+			hook.Secret = fields[2]
+		}
+		if !validSinkName(hook.Name) {
+			return nil, fmt.Errorf("webhook name %q must be letters, digits, '-' or '_'", hook.Name)
+		}
+		if seen[hook.Name] {
+			return nil, fmt.Errorf("duplicate webhook name %q", hook.Name)
+		}
+		seen[hook.Name] = true
+		if !strings.HasPrefix(hook.URL, "http://") && !strings.HasPrefix(hook.URL, "https://") {
+			return nil, fmt.Errorf("webhook %q: URL must be http or https, got %q", hook.Name, hook.URL)
+		}
+		if hook.Secret == "" {
+			return nil, fmt.Errorf("webhook %q has no secret and WEBHOOKS_SECRET is not set", hook.Name)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// GetBackoff returns the delay before the first webhook retry
+func (c *WebhooksConfig) GetBackoff() (time.Duration, error) {
+	return time.ParseDuration(c.Backoff)
+}
+
+// GetMaxBackoff returns the webhook retry delay cap
+func (c *WebhooksConfig) GetMaxBackoff() (time.Duration, error) {
+	return time.ParseDuration(c.MaxBackoff)
+}
+
+// GetTimeout returns the bound on one webhook delivery attempt
+func (c *WebhooksConfig) GetTimeout() (time.Duration, error) {
+	return time.ParseDuration(c.Timeout)
+}
+
+// GetTimeout returns the bound on one contact lookup
+func (c *ContactsConfig) GetTimeout() (time.Duration, error) {
+	return time.ParseDuration(c.Timeout)
+}
+
+// GetNamespaces returns the annotation namespaces services may write
+func (c *AnnotationsConfig) GetNamespaces() []string {
+	var namespaces []string
+	for _, ns := range strings.Split(c.Namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// GetRouteDailyLimits returns the daily request limit of each route
+func (c *QuotaConfig) GetRouteDailyLimits() (map[string]int64, error) {
+	limits := map[string]int64{}
+	for _, pair := range strings.Split(c.RouteDailyLimits, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(pair, "=")
+		limit, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !ok || strings.TrimSpace(route) == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("expected route=limit, got %q", pair)
+		}
+		limits[strings.TrimSpace(route)] = limit
+	}
+	return limits, nil
+}
+
+// GetFlushInterval returns the quota counter flush interval as duration
+func (c *QuotaConfig) GetFlushInterval() (time.Duration, error) {
+	return time.ParseDuration(c.FlushInterval)
+}
+
+// GetRetention returns how long quota counters are kept as duration
+func (c *QuotaConfig) GetRetention() (time.Duration, error) {
+	return time.ParseDuration(c.Retention)
+}
+
+// GetReplayInterval returns the write-behind replay interval as duration
+func (c *WriteBehindConfig) GetReplayInterval() (time.Duration, error) {
+	return time.ParseDuration(c.ReplayInterval)
+}
+
+// GetPingInterval returns the WebSocket keepalive interval as duration
+func (c *StreamConfig) GetPingInterval() (time.Duration, error) {
+	return time.ParseDuration(c.PingInterval)
+}
+
+// GetCoalesceWindow returns the event coalescing window as duration
+func (c *StreamConfig) GetCoalesceWindow() (time.Duration, error) {
+	return time.ParseDuration(c.CoalesceWindow)
+}
+
+// GetResumeWindow returns the WebSocket session resume window as duration
+func (c *StreamConfig) GetResumeWindow() (time.Duration, error) {
+	return time.ParseDuration(c.ResumeWindow)
+}
+
+// GetImplicitTTL returns the TTL of connection-implied presences as duration
+func (c *StreamConfig) GetImplicitTTL() (time.Duration, error) {
+	return time.ParseDuration(c.ImplicitTTL)
+}
+
+// GetOfflineDebounce returns the grace period before a disconnected caller
+// is marked offline as duration
+func (c *StreamConfig) GetOfflineDebounce() (time.Duration, error) {
+	return time.ParseDuration(c.OfflineDebounce)
+}
+
+// GetAuthorizerTimeout returns the http authorizer decision timeout as duration
+func (c *AuthConfig) GetAuthorizerTimeout() (time.Duration, error) {
+	return time.ParseDuration(c.AuthorizerTimeout)
+}
+
+// GetServiceAccounts returns the JWT subjects that may set anyone's presence
+func (c *AuthConfig) GetServiceAccounts() []string {
+	var accounts []string
+	for _, a := range strings.Split(c.ServiceAccounts, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			accounts = append(accounts, a)
+		}
+	}
+	return accounts
+}
+
+// GetRoles returns the scopes granted by each role of AUTHZ_ROLES
+func (c *AuthConfig) GetRoles() (map[string][]string, error) {
+	roles := map[string][]string{}
+	for _, entry := range strings.Split(c.Roles, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ",")
+		role := strings.TrimSpace(fields[0])
+		if role == "" || len(fields) < 2 {
+			return nil, fmt.Errorf("expected role,scope[,scope...], got %q", entry)
+		}
+		if _, ok := roles[role]; ok {
+			return nil, fmt.Errorf("duplicate role %q", role)
+		}
+		var scopes []string
+		for _, scope := range fields[1:] {
+			if scope = strings.TrimSpace(scope); scope == "" {
+				return nil, fmt.Errorf("%s: empty scope", role)
+			}
+			scopes = append(scopes, scope)
+		}
+		roles[role] = scopes
+	}
+	return roles, nil
+}
+
 // GetJWTTTL returns JWT TTL as duration
 func (c *AuthConfig) GetJWTTTL() (time.Duration, error) {
 	return time.ParseDuration(c.JWTTTL)
 }
 
+// GetJWKSRefresh returns the key set refresh interval as duration
+func (c *AuthConfig) GetJWKSRefresh() (time.Duration, error) {
+	return time.ParseDuration(c.JWKSRefresh)
+}
+
 // Helper functions for environment variable parsing
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -158,6 +1281,15 @@ func getEnvInt64OrDefault(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBoolOrDefault(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
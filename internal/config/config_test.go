@@ -1,7 +1,17 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -92,3 +102,766 @@ func TestLoad_MissingJWTSecret(t *testing.T) {
 		t.Fatalf("expected error when JWT_SECRET missing")
 	}
 }
+
+func TestLoad_PseudonymizeRequiresKey(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("PRIVACY_PSEUDONYMIZE", "true")
+	t.Setenv("PRIVACY_PSEUDONYM_KEY", "")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error when pseudonymization enabled without key")
+	}
+
+	t.Setenv("PRIVACY_PSEUDONYM_KEY", "hmac-key")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.Privacy.Pseudonymize || cfg.Privacy.PseudonymKey != "hmac-key" {
+		t.Fatalf("privacy config not loaded: %+v", cfg.Privacy)
+	}
+}
+
+func TestLoad_ListenAddr(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("SERVICE_PORT", "9001")
+	t.Setenv("SERVICE_HOST", "")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := cfg.Service.ListenAddr(); got != ":9001" {
+		t.Fatalf("expected :9001, got %q", got)
+	}
+
+	t.Setenv("SERVICE_HOST", "127.0.0.1")
+	if cfg, err = Load(); err != nil || cfg.Service.ListenAddr() != "127.0.0.1:9001" {
+		t.Fatalf("expected loopback bind, got %v %v", cfg, err)
+	}
+	t.Setenv("SERVICE_HOST", "::1")
+	if cfg, err = Load(); err != nil || cfg.Service.ListenAddr() != "[::1]:9001" {
+		t.Fatalf("expected bracketed IPv6 bind, got %v %v", cfg, err)
+	}
+
+	t.Setenv("SERVICE_PORT", "70000")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for out-of-range SERVICE_PORT")
+	}
+}
+
+func TestLoad_ResponseProfiles(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("API_RESPONSE_PROFILES", " legacy-crm=flat, reports = flat ,")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	profiles, err := cfg.API.GetResponseProfiles()
+	if err != nil || len(profiles) != 2 || profiles["legacy-crm"] != "flat" || profiles["reports"] != "flat" {
+		t.Fatalf("unexpected profiles %v %v", profiles, err)
+	}
+
+	t.Setenv("API_RESPONSE_PROFILES", "legacy-crm")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for a pair without a profile")
+	}
+}
+
+func TestLoad_BatchReadBudget(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil || cfg.API.BatchReadBudget != 1000 {
+		t.Fatalf("expected default budget 1000, got %v %v", cfg, err)
+	}
+
+	t.Setenv("API_BATCH_READ_BUDGET", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for a negative budget")
+	}
+}
+
+func TestLoad_NDJSONChunkSize(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil || cfg.API.NDJSONChunkSize != 100 {
+		t.Fatalf("expected default chunk size 100, got %v %v", cfg, err)
+	}
+
+	t.Setenv("API_NDJSON_CHUNK_SIZE", "0")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for a zero chunk size")
+	}
+}
+
+func TestLoad_ResultCacheWindow(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if window, _ := cfg.API.GetResultCacheWindow(); window != 5*time.Second {
+		t.Fatalf("expected a default window of 5s, got %v", window)
+	}
+
+	t.Setenv("API_RESULT_CACHE_WINDOW", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for a negative window")
+	}
+}
+
+func TestLoad_WatchBuffer(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.NATS.WatchBuffer != 1024 || cfg.NATS.WatchOverflow != "coalesce" {
+		t.Fatalf("unexpected watch buffer defaults %d %q", cfg.NATS.WatchBuffer, cfg.NATS.WatchOverflow)
+	}
+}
+
+func TestLoad_ReadConcurrency(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.NATS.ReadConcurrency != 16 {
+		t.Fatalf("unexpected read concurrency default %d", cfg.NATS.ReadConcurrency)
+	}
+	t.Setenv("NATS_READ_CONCURRENCY", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for a zero read concurrency")
+	}
+}
+
+func TestLoad_FormerKeyPrefixes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("NATS_FORMER_KEY_PREFIXES", "presence., v1.user.")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p, _ := cfg.NATS.GetFormerKeyPrefixes(); len(p) != 2 || p[0] != "presence." || p[1] != "v1.user." {
+		t.Fatalf("unexpected former key prefixes %v", p)
+	}
+	for _, bad := range []string{"presence", "user.", "a.*."} {
+		t.Setenv("NATS_FORMER_KEY_PREFIXES", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for former key prefix %q", bad)
+		}
+	}
+}
+
+func TestLoad_Standby(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("NATS_EMBEDDED", "true")
+	t.Setenv("NATS_PRIMARY_URL", "nats://east:7422")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for a standby without JetStream domains")
+	}
+	t.Setenv("NATS_JETSTREAM_DOMAIN", "west")
+	t.Setenv("NATS_PRIMARY_DOMAIN", "east")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d, err := cfg.NATS.GetFailoverAfter(); err != nil || d != 15*time.Second {
+		t.Fatalf("expected 15s failover delay, got %v %v", d, err)
+	}
+	for env, bad := range map[string]string{"NATS_PRIMARY_DOMAIN": "west", "NATS_FAILOVER_AFTER": "0s", "NODE_TYPE": "leaf"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, bad)
+			if _, err := Load(); err == nil {
+				t.Errorf("expected error for %s=%s", env, bad)
+			}
+		})
+	}
+}
+
+func TestLoad_ConnectionLimits(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("STREAM_MAX_CONNECTIONS_PER_USER", "5")
+	t.Setenv("STREAM_MAX_CONNECTIONS_PER_TENANT", "500")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Stream.MaxConnectionsPerUser != 5 || cfg.Stream.MaxConnectionsPerTenant != 500 {
+		t.Fatalf("unexpected connection limits %+v", cfg.Stream)
+	}
+	t.Setenv("STREAM_MAX_CONNECTIONS_PER_TENANT", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for a negative connection limit")
+	}
+}
+
+func TestLoad_WriteBehind(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("WRITE_BEHIND_ENABLED", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.WriteBehind.Enabled || cfg.WriteBehind.Path == "" {
+		t.Fatalf("unexpected write-behind config %+v", cfg.WriteBehind)
+	}
+	if d, err := cfg.WriteBehind.GetReplayInterval(); err != nil || d != 5*time.Second {
+		t.Fatalf("expected 5s replay interval, got %v %v", d, err)
+	}
+}
+
+func TestLoad_QuotaRouteLimits(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("QUOTA_ROUTE_DAILY_LIMITS", "presence.batch=1000, presence.multi = 5000")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	limits, err := cfg.Quota.GetRouteDailyLimits()
+	if err != nil || limits["presence.batch"] != 1000 || limits["presence.multi"] != 5000 {
+		t.Fatalf("unexpected limits %v %v", limits, err)
+	}
+
+	t.Setenv("QUOTA_ROUTE_DAILY_LIMITS", "presence.batch=lots")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for a non-numeric limit")
+	}
+}
+
+func TestLoad_EventSinks(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("EVENT_SINKS", "crm, webhook, https://crm.example/hook ; audit,nats,presence.audit,at-least-once;bi,webhook,https://bi.example,,v2")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	sinks, err := cfg.Sinks.GetSinks()
+	if err != nil || len(sinks) != 3 {
+		t.Fatalf("unexpected sinks %v %v", sinks, err)
+	}
+	if sinks[0] != (SinkConfig{Name: "crm", Kind: "webhook", Target: "https://crm.example/hook", Mode: "at-most-once", Version: "v1"}) {
+		t.Fatalf("unexpected webhook sink %+v", sinks[0])
+	}
+	if sinks[1] != (SinkConfig{Name: "audit", Kind: "nats", Target: "presence.audit", Mode: "at-least-once", Version: "v1"}) {
+		t.Fatalf("unexpected nats sink %+v", sinks[1])
+	}
+	if sinks[2].Mode != "at-most-once" || sinks[2].Version != "v2" {
+		t.Fatalf("expected a v2 sink with the default mode, got %+v", sinks[2])
+	}
+
+	for _, bad := range []string{"crm,webhook", "crm,kafka,topic", "crm,nats,x,exactly-once", "c.rm,nats,x", "a,nats,x;a,nats,y", "a,nats,x,at-most-once,v3"} {
+		t.Setenv("EVENT_SINKS", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoad_Authorizer(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil || cfg.Auth.Authorizer != "none" {
+		t.Fatalf("expected authorizer none by default, got %v %v", cfg, err)
+	}
+	if d, err := cfg.Auth.GetAuthorizerTimeout(); err != nil || d != 2*time.Second {
+		t.Fatalf("expected 2s authorizer timeout, got %v %v", d, err)
+	}
+	if !cfg.Auth.SelfWrites || cfg.Auth.GetServiceAccounts() != nil {
+		t.Fatalf("expected self writes without service accounts by default, got %+v", cfg.Auth)
+	}
+	t.Setenv("AUTHZ_SERVICE_ACCOUNTS", " chat-backend, ,crm ")
+	if cfg, err := Load(); err != nil || strings.Join(cfg.Auth.GetServiceAccounts(), "|") != "chat-backend|crm" {
+		t.Fatalf("expected two service accounts, got %v %v", cfg.Auth.GetServiceAccounts(), err)
+	}
+
+	t.Setenv("AUTHZ_MODE", "http")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected the http authorizer to require AUTHZ_URL")
+	}
+	t.Setenv("AUTHZ_URL", "http://opa:8181/v1/data/presence/allow")
+	if cfg, err := Load(); err != nil || cfg.Auth.AuthorizerURL == "" {
+		t.Fatalf("Load failed: %v", err)
+	}
+	t.Setenv("AUTHZ_MODE", "opa")
+	t.Setenv("AUTHZ_URL", "http://opa:8181")
+	if _, err := Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	t.Setenv("AUTHZ_MODE", "rbac")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an unknown authorizer to be rejected")
+	}
+}
+
+func TestLoad_ImplicitPresence(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil || cfg.Stream.ImplicitPresence {
+		t.Fatalf("expected implicit presence off by default, got %v %v", cfg, err)
+	}
+	if d, err := cfg.Stream.GetImplicitTTL(); err != nil || d != time.Minute {
+		t.Fatalf("expected 60s implicit TTL, got %v %v", d, err)
+	}
+	if d, err := cfg.Stream.GetOfflineDebounce(); err != nil || d != 10*time.Second {
+		t.Fatalf("expected 10s offline debounce, got %v %v", d, err)
+	}
+
+	t.Setenv("STREAM_IMPLICIT_PRESENCE", "true")
+	t.Setenv("STREAM_IMPLICIT_TTL", "1s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a TTL under 2s to be rejected")
+	}
+	t.Setenv("STREAM_IMPLICIT_TTL", "30s")
+	t.Setenv("STREAM_OFFLINE_DEBOUNCE", "soon")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an invalid debounce to be rejected")
+	}
+	t.Setenv("STREAM_OFFLINE_DEBOUNCE", "0s")
+	if _, err := Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+}
+
+func TestLoad_PresenceStateMachine(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("PRESENCE_STATUSES", "in-call, on-break")
+	t.Setenv("PRESENCE_TRANSITIONS", "in-call=online|busy, on-break=online")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	m, err := cfg.Presence.GetStateMachine()
+	if err != nil || !m.Known("on-break") || m.Allows("in-call", "away") || !m.Allows("in-call", "busy") {
+		t.Fatalf("unexpected state machine %+v (%v)", m, err)
+	}
+
+	for _, transitions := range []string{"in-call", "in-call=sleeping", "in-call=online,in-call=busy"} {
+		t.Setenv("PRESENCE_TRANSITIONS", transitions)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected %q to be rejected", transitions)
+		}
+	}
+	t.Setenv("PRESENCE_TRANSITIONS", "")
+	t.Setenv("PRESENCE_STATUSES", "Busy Bee")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an invalid status name to be rejected")
+	}
+}
+
+func TestLoad_Drain(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d, err := cfg.Service.GetDrainTimeout(); err != nil || d != 30*time.Second {
+		t.Fatalf("expected 30s drain timeout, got %v %v", d, err)
+	}
+	if d, err := cfg.Service.GetDrainDelay(); err != nil || d != 5*time.Second {
+		t.Fatalf("expected 5s drain delay, got %v %v", d, err)
+	}
+	t.Setenv("SERVICE_DRAIN_TIMEOUT", "0s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero drain timeout to be rejected")
+	}
+	t.Setenv("SERVICE_DRAIN_TIMEOUT", "1m")
+	t.Setenv("SERVICE_DRAIN_DELAY", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a negative drain delay to be rejected")
+	}
+}
+
+func TestLoad_LogLevelOverrideDuration(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d, err := cfg.Logging.GetOverrideDuration(); err != nil || d != 15*time.Minute {
+		t.Fatalf("expected 15m override duration, got %v %v", d, err)
+	}
+	t.Setenv("LOG_LEVEL_OVERRIDE_DURATION", "48h")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an override duration over 24h to be rejected")
+	}
+}
+
+func TestLoad_ShadowReads(t *testing.T) {
+	t.Setenv("NATS_KV_BUCKET", "presence")
+	t.Setenv("NATS_SHADOW_URL", "nats://candidate:4222")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.NATS.GetShadowBucket() != "presence" || cfg.NATS.ShadowSampleRate != 1 {
+		t.Fatalf("expected the primary bucket, fully sampled, got %q %v", cfg.NATS.GetShadowBucket(), cfg.NATS.ShadowSampleRate)
+	}
+	t.Setenv("NATS_SHADOW_SAMPLE_RATE", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero sample rate to be rejected")
+	}
+}
+
+func TestLoad_CacheVerify(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d, err := cfg.Cache.GetVerifyInterval(); err != nil || d != 0 {
+		t.Fatalf("expected verification off by default, got %v %v", d, err)
+	}
+	t.Setenv("CACHE_VERIFY_INTERVAL", "1m")
+	t.Setenv("CACHE_VERIFY_SAMPLE", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero sample to be rejected")
+	}
+}
+
+func TestLoad_PresenceTransitions(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d, err := cfg.Presence.GetTransitionInterval(); err != nil || d != 0 {
+		t.Fatalf("expected automatic transitions off by default, got %v %v", d, err)
+	}
+	if d, err := cfg.Presence.GetAwayAfter(); err != nil || d != 5*time.Minute {
+		t.Fatalf("expected a 5m away window, got %v %v", d, err)
+	}
+	t.Setenv("PRESENCE_AWAY_AFTER", "-1m")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a negative away window to be rejected")
+	}
+}
+
+func TestLoad_WriteCoalesce(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d, err := cfg.Presence.GetWriteCoalesce(); err != nil || d != 0 {
+		t.Fatalf("expected write coalescing off by default, got %v %v", d, err)
+	}
+	t.Setenv("PRESENCE_WRITE_COALESCE", "soon")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an invalid coalescing interval to be rejected")
+	}
+}
+
+func TestLoad_Subscriptions(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Subscriptions.Enabled || cfg.Subscriptions.MaxPerUser != 10 || cfg.Subscriptions.MaxUsers != 500 {
+		t.Fatalf("unexpected defaults %+v", cfg.Subscriptions)
+	}
+	t.Setenv("SUBSCRIPTIONS_ENABLED", "true")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected the defaults to validate, got %v", err)
+	}
+	t.Setenv("SUBSCRIPTIONS_MAX_TTL", "30m")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a max TTL below the default to be rejected")
+	}
+}
+
+func TestLoad_Contacts(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Contacts.URL != "" || cfg.Contacts.MaxContacts != 1000 {
+		t.Fatalf("unexpected defaults %+v", cfg.Contacts)
+	}
+	t.Setenv("CONTACTS_URL", "http://directory/users/contacts")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a URL without {user_id} to be rejected")
+	}
+	t.Setenv("CONTACTS_URL", "http://directory/users/{user_id}/contacts")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected the URL to validate, got %v", err)
+	}
+}
+
+func TestLoad_ProxyNode(t *testing.T) {
+	t.Setenv("NODE_TYPE", "proxy")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a proxy node with an embedded server to be rejected")
+	}
+	t.Setenv("NATS_EMBEDDED", "false")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a proxy node without a NATS URL to be rejected")
+	}
+	t.Setenv("NATS_CENTER_URL", "nats://center:4222")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected the proxy node to validate, got %v", err)
+	}
+}
+
+func TestLoad_Annotations(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Annotations.GetNamespaces() != nil || cfg.Annotations.MaxKeys != 16 || cfg.Annotations.MaxBytes != 1024 {
+		t.Fatalf("unexpected defaults %+v", cfg.Annotations)
+	}
+	t.Setenv("ANNOTATIONS_NAMESPACES", "pager, ci,")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if ns := cfg.Annotations.GetNamespaces(); len(ns) != 2 || ns[1] != "ci" {
+		t.Fatalf("unexpected namespaces %v", ns)
+	}
+	t.Setenv("ANNOTATIONS_MAX_BYTES", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero size limit to be rejected")
+	}
+}
+
+func TestLoad_Webhooks(t *testing.T) {
+	t.Setenv("WEBHOOKS", "crm,https://crm.example.com/hooks,crm-secret; audit,https://audit.example.com")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an endpoint without a secret to be rejected")
+	}
+	t.Setenv("WEBHOOKS_SECRET", "shared")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	hooks, _ := cfg.Webhooks.GetEndpoints()
+	if len(hooks) != 2 || hooks[0].Secret != "crm-secret" || hooks[1].Secret != "shared" || hooks[1].URL != "https://audit.example.com" {
+		t.Fatalf("unexpected endpoints %+v", hooks)
+	}
+	for _, bad := range []string{"crm", "crm,ftp://example.com", "a,https://x;a,https://y", "bad name,https://x"} {
+		t.Setenv("WEBHOOKS", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected WEBHOOKS=%q to be rejected", bad)
+		}
+	}
+	t.Setenv("WEBHOOKS", "crm,https://crm.example.com")
+	t.Setenv("WEBHOOKS_MAX_BACKOFF", "100ms")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a max backoff below the backoff to be rejected")
+	}
+}
+
+// writeSelfSigned writes a self-signed certificate and its key as PEM files
+func writeSelfSigned(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "presence-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestLoad_TLS(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tlsConfig, err := cfg.Service.GetTLSConfig(); tlsConfig != nil || err != nil {
+		t.Fatalf("expected plaintext by default, got %v (%v)", tlsConfig, err)
+	}
+
+	certFile, keyFile := writeSelfSigned(t)
+	t.Setenv("SERVICE_TLS_CERT", certFile)
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a certificate without a key to be rejected")
+	}
+	t.Setenv("SERVICE_TLS_KEY", keyFile)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	tlsConfig, _ := cfg.Service.GetTLSConfig()
+	if tlsConfig == nil || len(tlsConfig.Certificates) != 1 || tlsConfig.ClientAuth != tls.NoClientCert {
+		t.Fatalf("unexpected TLS config %+v", tlsConfig)
+	}
+
+	t.Setenv("SERVICE_CLIENT_CA", keyFile)
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a client CA without certificates to be rejected")
+	}
+	t.Setenv("SERVICE_CLIENT_CA", certFile)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tlsConfig, _ := cfg.Service.GetTLSConfig(); tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert || tlsConfig.ClientCAs == nil {
+		t.Fatalf("expected client certificates to be required, got %+v", tlsConfig)
+	}
+
+	t.Setenv("SERVICE_TLS_KEY", filepath.Join(t.TempDir(), "missing.pem"))
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a missing key file to be rejected")
+	}
+}
+
+func TestLoad_KVReplicasAndHistory(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.NATS.KVReplicas != 1 || cfg.NATS.KVHistory != 1 {
+		t.Fatalf("unexpected defaults replicas=%d history=%d", cfg.NATS.KVReplicas, cfg.NATS.KVHistory)
+	}
+	t.Setenv("NATS_KV_REPLICAS", "3")
+	t.Setenv("NATS_KV_HISTORY", "5")
+	if cfg, err = Load(); err != nil || cfg.NATS.KVReplicas != 3 || cfg.NATS.KVHistory != 5 {
+		t.Fatalf("unexpected replicas/history %+v, %v", cfg.NATS, err)
+	}
+	t.Setenv("NATS_KV_HISTORY", "65")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a history above 64 to be rejected")
+	}
+	t.Setenv("NATS_KV_HISTORY", "1")
+	t.Setenv("NATS_KV_REPLICAS", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected zero replicas to be rejected")
+	}
+}
+
+func TestLoad_Environment(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.NATS.Scoped("presence") != "presence" || cfg.NATS.ScopedSubject("presence.audit") != "presence.audit" {
+		t.Fatal("expected names to be unchanged without an environment")
+	}
+	t.Setenv("NATS_ENVIRONMENT", "canary")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := cfg.NATS.Scoped("presence"); got != "canary_presence" {
+		t.Fatalf("Scoped = %q", got)
+	}
+	if got := cfg.NATS.ScopedSubject("presence.audit"); got != "canary.presence.audit" {
+		t.Fatalf("ScopedSubject = %q", got)
+	}
+	t.Setenv("NATS_ENVIRONMENT", "prod.canary")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an environment with a dot to be rejected")
+	}
+}
+
+func TestLoad_RateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ENABLED", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.RateLimit.Rate != 10 || cfg.RateLimit.Burst != 20 || cfg.RateLimit.TrustForwarded {
+		t.Fatalf("unexpected defaults %+v", cfg.RateLimit)
+	}
+	t.Setenv("RATE_LIMIT_BURST", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero burst to be rejected")
+	}
+}
+
+func TestLoad_Deprecations(t *testing.T) {
+	t.Setenv("API_DEPRECATIONS", "v1,2026-01-01,2026-07-01,https://docs.example.com/v2; v2,2026-09-01")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	deps, err := cfg.API.GetDeprecations()
+	if err != nil || len(deps) != 2 {
+		t.Fatalf("unexpected deprecations %+v, %v", deps, err)
+	}
+	if deps[0].Version != "v1" || deps[0].Sunset.Format(time.DateOnly) != "2026-07-01" || deps[0].Link != "https://docs.example.com/v2" {
+		t.Fatalf("unexpected v1 retirement %+v", deps[0])
+	}
+	if deps[1].Version != "v2" || deps[1].Deprecated.Format(time.DateOnly) != "2026-09-01" || !deps[1].Sunset.IsZero() {
+		t.Fatalf("unexpected v2 retirement %+v", deps[1])
+	}
+	for _, bad := range []string{"v1", "v1,01/01/2026", "v1,2026-07-01,2026-01-01", "v1,2026-01-01;v1,2026-02-01"} {
+		t.Setenv("API_DEPRECATIONS", bad)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLoad_JWKS(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_JWKS_URL", "https://idp.example.com/.well-known/jwks.json")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected a key set to stand in for the secret: %v", err)
+	}
+	if refresh, _ := cfg.Auth.GetJWKSRefresh(); refresh != time.Hour {
+		t.Fatalf("expected an hourly refresh by default, got %v", refresh)
+	}
+	t.Setenv("JWT_JWKS_REFRESH", "0s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero refresh interval to be rejected")
+	}
+}
+
+func TestLoad_Roles(t *testing.T) {
+	t.Setenv("AUTHZ_ROLES", "dashboard,presence:read; support, presence:read, presence:admin")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	roles, _ := cfg.Auth.GetRoles()
+	if len(roles) != 2 || len(roles["dashboard"]) != 1 || roles["support"][1] != "presence:admin" {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+	for _, invalid := range []string{"dashboard", "dashboard,presence:read;dashboard,presence:write", "support,,admin"} {
+		t.Setenv("AUTHZ_ROLES", invalid)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestLoad_LogSampling(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if window, _ := cfg.Logging.GetSampleWindow(); window != time.Minute || cfg.Logging.SampleBurst != 1 {
+		t.Fatalf("expected a 1m window and a burst of 1 by default, got %v and %d", window, cfg.Logging.SampleBurst)
+	}
+	t.Setenv("LOG_SAMPLE_BURST", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero burst to be rejected")
+	}
+	t.Setenv("LOG_SAMPLE_WINDOW", "0")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected sampling to be disabled without a burst check: %v", err)
+	}
+}
+
+func TestLoad_ErrorReportTimeout(t *testing.T) {
+	t.Setenv("ERROR_REPORT_TIMEOUT", "0s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a zero report timeout to be rejected")
+	}
+}
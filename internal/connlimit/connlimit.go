@@ -0,0 +1,83 @@
+// Package connlimit caps the streaming connections, WebSocket sessions and
+// server-sent event streams, each user and each tenant hold open at once, so
+// one integration reconnecting in a loop can't exhaust the node's file
+// descriptors. Connections are counted per node.
+package connlimit
+
+import (
+	"errors"
+	"sync"
+)
+
+// Limits configure the caps; 0 leaves a cap off
+type Limits struct {
+	PerUser   int // Open connections of one user
+	PerTenant int // Open connections of all users of one tenant
+}
+
+// Errors of a connection over a cap
+var (
+	ErrUserLimit   = errors.New("too many open connections for this user")
+	ErrTenantLimit = errors.New("too many open connections for this tenant")
+)
+
+// Limiter counts the open connections of each user and tenant
+type Limiter struct {
+	limits Limits
+
+	mu      sync.Mutex
+	users   map[string]int
+	tenants map[string]int
+}
+
+// New returns a limiter of limits
+func New(limits Limits) *Limiter {
+	return &Limiter{limits: limits, users: map[string]int{}, tenants: map[string]int{}}
+}
+
+// Acquire counts a new connection of user in tenant and returns the func
+// that releases it when the connection closes. Empty keys aren't counted.
+// A connection over either cap is refused with ErrUserLimit or
+// ErrTenantLimit, and counts against neither.
+func (l *Limiter) Acquire(user, tenant string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if user != "" && l.limits.PerUser > 0 && l.users[user] >= l.limits.PerUser {
+		return nil, ErrUserLimit
+	}
+	if tenant != "" && l.limits.PerTenant > 0 && l.tenants[tenant] >= l.limits.PerTenant {
+		return nil, ErrTenantLimit
+	}
+	if user != "" {
+		l.users[user]++
+	}
+	if tenant != "" {
+		l.tenants[tenant]++
+	}
+	var once sync.Once
+	return func() { once.Do(func() { l.release(user, tenant) }) }, nil
+}
+
+func (l *Limiter) release(user, tenant string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range []struct {
+		counts map[string]int
+		key    string
+	}{{l.users, user}, {l.tenants, tenant}} {
+		if c.key == "" {
+			continue
+		}
+		// Drop keys at zero so the maps only hold connected callers
+		if c.counts[c.key]--; c.counts[c.key] <= 0 {
+			delete(c.counts, c.key)
+		}
+	}
+}
+
+// Open returns the open connections of user and of tenant
+func (l *Limiter) Open(user, tenant string) (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.users[user], l.tenants[tenant]
+}
@@ -0,0 +1,88 @@
+package connlimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopresence/internal/auth"
+)
+
+func TestLimiter_Caps(t *testing.T) {
+	l := New(Limits{PerUser: 2, PerTenant: 3})
+
+	alice1, err := l.Acquire("alice", "acme")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := l.Acquire("alice", "acme"); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := l.Acquire("alice", "acme"); !errors.Is(err, ErrUserLimit) {
+		t.Fatalf("expected the user cap, got %v", err)
+	}
+	if _, err := l.Acquire("bob", "acme"); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := l.Acquire("carol", "acme"); !errors.Is(err, ErrTenantLimit) {
+		t.Fatalf("expected the tenant cap, got %v", err)
+	}
+	if _, err := l.Acquire("carol", "other"); err != nil {
+		t.Fatalf("expected other tenants unaffected, got %v", err)
+	}
+	if users, tenants := l.Open("carol", "acme"); users != 1 || tenants != 3 {
+		t.Fatalf("expected the refused connection not counted, got %d and %d", users, tenants)
+	}
+
+	// Releasing twice frees one slot only
+	alice1()
+	alice1()
+	if users, tenants := l.Open("alice", "acme"); users != 1 || tenants != 2 {
+		t.Fatalf("expected one slot freed, got %d and %d", users, tenants)
+	}
+	if _, err := l.Acquire("alice", "acme"); err != nil {
+		t.Fatalf("expected a freed slot to be reused, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New(Limits{PerUser: 1})
+	entered, hold := make(chan struct{}), make(chan struct{})
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-hold
+	}))
+	serve := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/stream/ws", nil)
+		if userID != "" {
+			req = req.WithContext(auth.SetUserIDInContext(req.Context(), userID))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	done := make(chan struct{})
+	go func() {
+		serve("alice")
+		close(done)
+	}()
+	<-entered
+	rr := serve("alice")
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), CodeUserLimit) {
+		t.Fatalf("expected 429 %s, got %d: %s", CodeUserLimit, rr.Code, rr.Body.String())
+	}
+
+	// Anonymous callers aren't counted
+	go serve("")
+	<-entered
+	hold <- struct{}{}
+
+	hold <- struct{}{}
+	<-done
+	if users, _ := l.Open("alice", ""); users != 0 {
+		t.Fatalf("expected the closed connection released, got %d", users)
+	}
+}
@@ -0,0 +1,54 @@
+package connlimit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/i18n"
+	"gopresence/internal/metrics"
+)
+
+// Error codes of refused connections
+const (
+	CodeUserLimit   = "user_connection_limit"
+	CodeTenantLimit = "tenant_connection_limit"
+)
+
+// Middleware holds a connection slot of the caller for as long as next
+// serves the request, and answers 429 with code user_connection_limit or
+// tenant_connection_limit when the caller is at a cap. It must run inside
+// the authentication middleware; anonymous callers aren't counted.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := auth.GetUserIDFromContext(r.Context())
+		if user == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, err := l.Acquire(user, auth.GetTenantFromContext(r.Context()))
+		if err != nil {
+			writeLimited(w, r, err, l.limits)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeLimited(w http.ResponseWriter, r *http.Request, err error, limits Limits) {
+	scope, code, limit := "user", CodeUserLimit, limits.PerUser
+	if errors.Is(err, ErrTenantLimit) {
+		scope, code, limit = "tenant", CodeTenantLimit, limits.PerTenant
+	}
+	metrics.ObserveConnectionLimited(scope)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   i18n.Localize(w, r, code),
+		"code":    code,
+		"limit":   limit,
+	})
+}
@@ -0,0 +1,78 @@
+// Package contacts looks up users' contact lists in the directory service
+// that owns them, so "my contacts" reads can be answered in one request
+// instead of a roster lookup followed by a batch presence read.
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UserIDPlaceholder marks where the user ID goes in a source URL
+const UserIDPlaceholder = "{user_id}"
+
+// ErrTooMany is returned for contact lists longer than the source's limit
+var ErrTooMany = errors.New("contact list exceeds the limit")
+
+// Source returns the user IDs of a user's contacts
+type Source interface {
+	Contacts(ctx context.Context, userID string) ([]string, error)
+}
+
+// HTTPSource asks a directory service over HTTP. It GETs its URL with
+// UserIDPlaceholder replaced by the path-escaped user ID and expects
+// {"contacts": ["bob", "carol"]}. A 404 means the user has no contacts.
+type HTTPSource struct {
+	url    string
+	max    int
+	client *http.Client
+}
+
+// NewHTTPSource returns a source querying urlTemplate, each lookup bounded by
+// timeout; lists of more than max contacts fail with ErrTooMany
+func NewHTTPSource(urlTemplate string, max int, timeout time.Duration) (*HTTPSource, error) {
+	if !strings.Contains(urlTemplate, UserIDPlaceholder) {
+		return nil, fmt.Errorf("contacts URL %q has no %s placeholder", urlTemplate, UserIDPlaceholder)
+	}
+	return &HTTPSource{url: urlTemplate, max: max, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// Contacts implements Source
+func (s *HTTPSource) Contacts(ctx context.Context, userID string) ([]string, error) {
+	target := strings.ReplaceAll(s.url, UserIDPlaceholder, url.PathEscape(userID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacts request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("contacts service returned %s", resp.Status)
+	}
+	var list struct {
+		Contacts []string `json:"contacts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid contacts response: %w", err)
+	}
+	if s.max > 0 && len(list.Contacts) > s.max {
+		return nil, fmt.Errorf("%w: %d contacts, at most %d", ErrTooMany, len(list.Contacts), s.max)
+	}
+	return list.Contacts, nil
+}
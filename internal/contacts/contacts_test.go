@@ -0,0 +1,48 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/users/alice%20a/contacts":
+			w.Write([]byte(`{"contacts":["bob","carol"]}`))
+		case "/users/big/contacts":
+			w.Write([]byte(`{"contacts":["a","b","c","d"]}`))
+		case "/users/broken/contacts":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTPSource(srv.URL+"/contacts", 3, time.Second); err == nil {
+		t.Fatal("expected a URL without the placeholder to be rejected")
+	}
+	s, err := NewHTTPSource(srv.URL+"/users/{user_id}/contacts", 3, time.Second)
+	if err != nil {
+		t.Fatalf("NewHTTPSource: %v", err)
+	}
+	ctx := context.Background()
+
+	if got, err := s.Contacts(ctx, "alice a"); err != nil || len(got) != 2 || got[0] != "bob" {
+		t.Fatalf("Contacts: %v (%v)", got, err)
+	}
+	if got, err := s.Contacts(ctx, "nobody"); err != nil || len(got) != 0 {
+		t.Fatalf("expected a 404 to mean no contacts, got %v (%v)", got, err)
+	}
+	if _, err := s.Contacts(ctx, "big"); !errors.Is(err, ErrTooMany) {
+		t.Fatalf("expected ErrTooMany, got %v", err)
+	}
+	if _, err := s.Contacts(ctx, "broken"); err == nil {
+		t.Fatal("expected a server error to fail the lookup")
+	}
+}
@@ -0,0 +1,167 @@
+// Package drain takes a node out of service in order: it stops taking new
+// work, hands shared work to other nodes and flushes what it holds, so the
+// process can exit without losing writes during a rolling deploy.
+package drain
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrDraining is reported by Ready once a drain has started
+var ErrDraining = errors.New("node is draining")
+
+// Drain states
+const (
+	StateServing  = "serving"
+	StateDraining = "draining"
+	StateDrained  = "drained"
+)
+
+// StepStatus reports the outcome of one drain step
+type StepStatus struct {
+	Name       string `json:"name"`
+	Done       bool   `json:"done"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// Status describes the node's drain progress
+type Status struct {
+	State     string       `json:"state"`
+	StartedAt time.Time    `json:"started_at,omitzero"`
+	Steps     []StepStatus `json:"steps"`
+}
+
+type step struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Drainer runs the registered steps once, in order, when a drain starts
+type Drainer struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	steps   []step
+	status  Status
+	started bool
+	done    chan struct{}
+}
+
+// New creates a Drainer whose steps share a deadline of timeout
+func New(timeout time.Duration) *Drainer {
+	return &Drainer{
+		timeout: timeout,
+		status:  Status{State: StateServing, Steps: []StepStatus{}},
+		done:    make(chan struct{}),
+	}
+}
+
+// Add registers a step. Steps run in the order added; a failing step is
+// recorded and the drain carries on with the next one.
+func (d *Drainer) Add(name string, run func(ctx context.Context) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.steps = append(d.steps, step{name: name, run: run})
+	d.status.Steps = append(d.status.Steps, StepStatus{Name: name})
+}
+
+// Start begins draining in the background. It reports false if a drain had
+// already started.
+func (d *Drainer) Start() bool {
+	d.mu.Lock()
+	if d.started {
+		d.mu.Unlock()
+		return false
+	}
+	d.started = true
+	d.status.State = StateDraining
+	d.status.StartedAt = time.Now().UTC()
+	steps := append([]step(nil), d.steps...)
+	d.mu.Unlock()
+
+	go d.run(steps)
+	return true
+}
+
+func (d *Drainer) run(steps []step) {
+	ctx, cancel := context.WithDeadline(context.Background(), d.Deadline())
+	defer cancel()
+	for i, s := range steps {
+		start := time.Now()
+		err := s.run(ctx)
+		if err != nil {
+			log.Printf("drain: %s: %v", s.name, err)
+		}
+
+		d.mu.Lock()
+		d.status.Steps[i].Done = true
+		d.status.Steps[i].DurationMS = time.Since(start).Milliseconds()
+		if err != nil {
+			d.status.Steps[i].Error = err.Error()
+		}
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	d.status.State = StateDrained
+	d.mu.Unlock()
+	close(d.done)
+}
+
+// Deadline is when the drain's time is up: its start plus the timeout, or
+// zero before it starts. Work that has to finish after the steps, such as
+// in-flight requests, shares it, so the whole drain fits the timeout.
+func (d *Drainer) Deadline() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.started {
+		return time.Time{}
+	}
+	return d.status.StartedAt.Add(d.timeout)
+}
+
+// Done is closed once every step has run
+func (d *Drainer) Done() <-chan struct{} { return d.done }
+
+// Draining reports whether a drain has started
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.started
+}
+
+// Ready fails with ErrDraining once a drain has started, so load balancers
+// stop routing to the node
+func (d *Drainer) Ready(ctx context.Context) error {
+	if d.Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// Status returns the node's drain progress
+func (d *Drainer) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.status
+	s.Steps = append([]StepStatus(nil), d.status.Steps...)
+	return s
+}
+
+// Wait is a step that pauses for delay, e.g. so load balancers notice the
+// failing readiness check before connections are closed
+func Wait(delay time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		select {
+		case <-time.After(delay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainer_RunsStepsInOrderOnce(t *testing.T) {
+	d := New(time.Second)
+	var order []string
+	d.Add("first", func(context.Context) error { order = append(order, "first"); return nil })
+	d.Add("failing", func(context.Context) error { order = append(order, "failing"); return errors.New("boom") })
+	d.Add("last", func(context.Context) error { order = append(order, "last"); return nil })
+
+	if err := d.Ready(context.Background()); err != nil || d.Status().State != StateServing {
+		t.Fatalf("expected a serving node to be ready, got %v", err)
+	}
+	if !d.Deadline().IsZero() {
+		t.Fatal("expected no deadline before the drain")
+	}
+	if !d.Start() || d.Start() {
+		t.Fatal("expected only the first Start to begin a drain")
+	}
+	if err := d.Ready(context.Background()); !errors.Is(err, ErrDraining) {
+		t.Fatalf("expected ErrDraining, got %v", err)
+	}
+	select {
+	case <-d.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain did not finish")
+	}
+
+	// A failing step doesn't stop the ones after it
+	if len(order) != 3 || order[0] != "first" || order[2] != "last" {
+		t.Fatalf("unexpected step order %v", order)
+	}
+	st := d.Status()
+	if st.State != StateDrained || st.StartedAt.IsZero() || len(st.Steps) != 3 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	// Work after the steps shares the drain's deadline
+	if !d.Deadline().Equal(st.StartedAt.Add(time.Second)) {
+		t.Fatalf("expected the deadline a second after the start, got %s", d.Deadline())
+	}
+	if !st.Steps[1].Done || st.Steps[1].Error != "boom" || st.Steps[2].Error != "" {
+		t.Fatalf("unexpected step status %+v", st.Steps)
+	}
+}
+
+func TestWait_StopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Wait(time.Minute)(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to cut the wait short, got %v", err)
+	}
+	if err := Wait(0)(context.Background()); err != nil {
+		t.Fatalf("Wait(0): %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package errors defines the errors shared by the store, service and API
+// layers. Callers classify them with errors.Is/As (or the helpers here)
+// rather than by matching message text.
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound matches any error reporting a missing presence
+	ErrNotFound = stderrors.New("not found")
+	// ErrTimeout matches any error reporting an operation past its deadline
+	ErrTimeout = stderrors.New("timed out")
+	// ErrBudgetExceeded matches any error rejecting a request projected to
+	// cost more store reads than allowed
+	ErrBudgetExceeded = stderrors.New("read budget exceeded")
+	// ErrInvalidTransition matches any error rejecting a status change the
+	// configured state machine does not allow
+	ErrInvalidTransition = stderrors.New("status transition not allowed")
+	// ErrRevisionMismatch matches any error rejecting a conditional write
+	// against an entry that has changed since the expected revision
+	ErrRevisionMismatch = stderrors.New("presence changed since the expected revision")
+)
+
+// NotFoundError reports that a user has no stored presence
+type NotFoundError struct {
+	UserID string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("presence not found for user %s", e.UserID)
+}
+
+// Is makes errors.Is(err, ErrNotFound) match
+func (e *NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// NotFound returns a NotFoundError for userID
+func NotFound(userID string) error {
+	return &NotFoundError{UserID: userID}
+}
+
+// BudgetExceededError reports a batch read projected to need more store
+// reads than the per-request budget, with the batch size that would fit
+type BudgetExceededError struct {
+	Users          int // Distinct users requested
+	EstimatedReads int // Projected store reads
+	Budget         int // Store reads allowed per request
+	MaxBatchSize   int // Largest batch projected to fit the budget
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("batch of %d users is projected to need %d store reads, over the budget of %d; use batches of at most %d users",
+		e.Users, e.EstimatedReads, e.Budget, e.MaxBatchSize)
+}
+
+// Is makes errors.Is(err, ErrBudgetExceeded) match
+func (e *BudgetExceededError) Is(target error) bool { return target == ErrBudgetExceeded }
+
+// TransitionError reports a status change the state machine does not allow
+type TransitionError struct {
+	UserID string
+	From   string
+	To     string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("status of user %s cannot change from %s to %s", e.UserID, e.From, e.To)
+}
+
+// Is makes errors.Is(err, ErrInvalidTransition) match
+func (e *TransitionError) Is(target error) bool { return target == ErrInvalidTransition }
+
+// IsNotFound reports whether err is or wraps a not-found error
+func IsNotFound(err error) bool {
+	return stderrors.Is(err, ErrNotFound)
+}
+
+// IsTimeout reports whether err is or wraps a timeout error
+func IsTimeout(err error) bool {
+	return stderrors.Is(err, ErrTimeout)
+}
+
+// IsBudgetExceeded reports whether err is or wraps a budget-exceeded error
+func IsBudgetExceeded(err error) bool {
+	return stderrors.Is(err, ErrBudgetExceeded)
+}
+
+// IsInvalidTransition reports whether err is or wraps a rejected status change
+func IsInvalidTransition(err error) bool {
+	return stderrors.Is(err, ErrInvalidTransition)
+}
+
+// IsRevisionMismatch reports whether err is or wraps a rejected conditional
+// write
+func IsRevisionMismatch(err error) bool {
+	return stderrors.Is(err, ErrRevisionMismatch)
+}
@@ -0,0 +1,51 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+)
+
+func TestNotFound_MatchesThroughWrapping(t *testing.T) {
+	err := fmt.Errorf("lookup: %w", NotFound("u1"))
+	if !IsNotFound(err) || IsTimeout(err) {
+		t.Fatalf("expected wrapped not-found to match only ErrNotFound")
+	}
+	var nf *NotFoundError
+	if !stderrors.As(err, &nf) || nf.UserID != "u1" {
+		t.Fatalf("expected NotFoundError for u1, got %v", err)
+	}
+	if err.Error() != "lookup: presence not found for user u1" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	if IsNotFound(stderrors.New("user not found")) {
+		t.Fatalf("message text alone must not classify an error")
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	if !IsTimeout(fmt.Errorf("get: %w", ErrTimeout)) || IsTimeout(nil) {
+		t.Fatalf("unexpected IsTimeout result")
+	}
+}
+
+func TestBudgetExceeded_MatchesThroughWrapping(t *testing.T) {
+	err := fmt.Errorf("batch: %w", &BudgetExceededError{Users: 10000, EstimatedReads: 8000, Budget: 1000, MaxBatchSize: 1250})
+	if !IsBudgetExceeded(err) || IsNotFound(err) || IsTimeout(err) {
+		t.Fatalf("expected wrapped budget error to match only ErrBudgetExceeded")
+	}
+	var be *BudgetExceededError
+	if !stderrors.As(err, &be) || be.MaxBatchSize != 1250 {
+		t.Fatalf("expected BudgetExceededError, got %v", err)
+	}
+}
+
+func TestTransitionError_MatchesThroughWrapping(t *testing.T) {
+	err := fmt.Errorf("set: %w", &TransitionError{UserID: "u1", From: "in-call", To: "away"})
+	if !IsInvalidTransition(err) || IsNotFound(err) || IsBudgetExceeded(err) {
+		t.Fatalf("expected wrapped transition error to match only ErrInvalidTransition")
+	}
+	if err.Error() != "set: status of user u1 cannot change from in-call to away" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+}
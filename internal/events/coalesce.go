@@ -0,0 +1,52 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"gopresence/internal/metrics"
+)
+
+// HubOption configures optional Hub behavior
+type HubOption func(*Hub)
+
+// WithCoalesceWindow holds each user's changes for window before fanning
+// them out, delivering only the latest: a burst of updates to one user, such
+// as typing heartbeats, reaches subscribers as a single event no more than
+// window after it began. Zero delivers every change immediately.
+func WithCoalesceWindow(window time.Duration) HubOption {
+	return func(h *Hub) {
+		if window > 0 {
+			h.coalescer = &coalescer{window: window, pending: map[string]*Event{}, publish: h.fanOut}
+		}
+	}
+}
+
+// coalescer keeps the latest pending event per user until its window ends
+type coalescer struct {
+	window  time.Duration
+	publish func(Event)
+
+	mu      sync.Mutex
+	pending map[string]*Event
+}
+
+func (c *coalescer) add(ev Event) {
+	c.mu.Lock()
+	if p, ok := c.pending[ev.UserID]; ok {
+		*p = ev
+		c.mu.Unlock()
+		metrics.ObserveEventCoalesced()
+		return
+	}
+	c.pending[ev.UserID] = &ev
+	c.mu.Unlock()
+
+	time.AfterFunc(c.window, func() {
+		c.mu.Lock()
+		latest := *c.pending[ev.UserID]
+		delete(c.pending, ev.UserID)
+		c.mu.Unlock()
+		c.publish(latest)
+	})
+}
@@ -0,0 +1,142 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+// EventType represents the kind of presence change
+type EventType string
+
+const (
+	EventUpdated EventType = "presence.updated"
+	EventDeleted EventType = "presence.deleted"
+)
+
+// Event is a presence change fanned out to stream subscribers
+type Event struct {
+	Type      EventType        `json:"type"`
+	UserID    string           `json:"user_id"`
+	Presence  *models.Presence `json:"presence,omitempty"`
+	Revision  uint64           `json:"revision,omitempty"` // KV revision of the change, also set for deletes
+	Timestamp time.Time        `json:"timestamp"`
+	RequestID string           `json:"request_id,omitempty"` // X-Request-ID of the API call that made the change, if known
+}
+
+// FromWatchEvent converts a KV watch event into a hub event
+func FromWatchEvent(we nats.WatchEvent) Event {
+	ev := Event{
+		UserID:    strings.TrimPrefix(we.Key, "user."),
+		Presence:  we.Presence,
+		Revision:  we.Revision,
+		Timestamp: time.Now().UTC(),
+		RequestID: we.RequestID,
+	}
+	if we.Type == nats.WatchEventDelete {
+		ev.Type = EventDeleted
+		ev.Presence = nil
+	} else {
+		ev.Type = EventUpdated
+	}
+	return ev
+}
+
+// Hub fans out presence events to any number of subscribers.
+// Publish never blocks: events are dropped for subscribers whose buffer is full.
+// Each user's events reach subscribers in increasing revision order, without
+// duplicates.
+type Hub struct {
+	mu        sync.RWMutex
+	subs      map[*Subscription]struct{}
+	coalescer *coalescer // optional per-user coalescing ahead of fan-out
+	sequencer *Sequencer
+}
+
+// NewHub creates a new event hub
+func NewHub(opts ...HubOption) *Hub {
+	h := &Hub{subs: make(map[*Subscription]struct{}), sequencer: NewSequencer()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Subscription receives events published to the hub
+type Subscription struct {
+	hub     *Hub
+	ch      chan Event
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// Subscribe registers a new subscription with the given buffer size
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	sub := &Subscription{hub: h, ch: make(chan Event, buffer)}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Publish delivers an event to every subscriber, after the coalescing
+// window if one is configured. It reports whether the event was accepted:
+// one at or below the last revision published for its user is dropped.
+func (h *Hub) Publish(ev Event) bool {
+	if !h.sequencer.Accept(ev) {
+		return false
+	}
+	if h.coalescer != nil {
+		h.coalescer.add(ev)
+		return true
+	}
+	h.fanOut(ev)
+	return true
+}
+
+func (h *Hub) fanOut(ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// PublishWatchEvent is a nats.KVStore watch callback feeding the hub
+func (h *Hub) PublishWatchEvent(we nats.WatchEvent) {
+	h.Publish(FromWatchEvent(we))
+}
+
+// Subscribers returns the number of active subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Events returns the channel events are delivered on; it is closed by Close
+func (s *Subscription) Events() <-chan Event { return s.ch }
+
+// Dropped returns the number of events dropped because the buffer was full
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+// Close unregisters the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.ch)
+	})
+}
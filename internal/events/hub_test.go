@@ -0,0 +1,185 @@
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(4)
+	defer sub.Close()
+
+	h.PublishWatchEvent(nats.WatchEvent{Key: "user.u1", Type: nats.WatchEventPut, Presence: &models.Presence{UserID: "u1", Status: models.StatusOnline}})
+	h.PublishWatchEvent(nats.WatchEvent{Key: "user.u1", Type: nats.WatchEventDelete})
+
+	ev := <-sub.Events()
+	if ev.Type != EventUpdated || ev.UserID != "u1" || ev.Presence == nil {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	ev = <-sub.Events()
+	if ev.Type != EventDeleted || ev.Presence != nil {
+		t.Fatalf("unexpected delete event: %+v", ev)
+	}
+}
+
+func TestHub_DropsWhenFullAndClose(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(1)
+	h.Publish(Event{UserID: "a"})
+	h.Publish(Event{UserID: "b"})
+	if sub.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", sub.Dropped())
+	}
+	if h.Subscribers() != 1 {
+		t.Fatalf("expected 1 subscriber")
+	}
+	sub.Close()
+	sub.Close() // idempotent
+	if h.Subscribers() != 0 {
+		t.Fatalf("expected 0 subscribers after close")
+	}
+	<-sub.Events()
+	if _, ok := <-sub.Events(); ok {
+		t.Fatal("expected channel closed")
+	}
+}
+
+func TestHub_CoalescesPerUser(t *testing.T) {
+	h := NewHub(WithCoalesceWindow(50 * time.Millisecond))
+	sub := h.Subscribe(8)
+	defer sub.Close()
+
+	for _, status := range []models.PresenceStatus{models.StatusOnline, models.StatusAway, models.StatusBusy} {
+		h.Publish(Event{Type: EventUpdated, UserID: "u1", Presence: &models.Presence{Status: status}})
+	}
+	h.Publish(Event{Type: EventUpdated, UserID: "u2", Presence: &models.Presence{Status: models.StatusOnline}})
+
+	got := map[string]models.PresenceStatus{}
+	for len(got) < 2 {
+		select {
+		case ev := <-sub.Events():
+			if _, dup := got[ev.UserID]; dup {
+				t.Fatalf("expected one event per user, got a second for %s", ev.UserID)
+			}
+			got[ev.UserID] = ev.Presence.Status
+		case <-time.After(time.Second):
+			t.Fatalf("timed out with %v", got)
+		}
+	}
+	if got["u1"] != models.StatusBusy || got["u2"] != models.StatusOnline {
+		t.Fatalf("expected the latest state per user, got %v", got)
+	}
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("unexpected extra event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEncodePayload_V2(t *testing.T) {
+	changed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	emitted := changed.Add(time.Second)
+	p := models.Presence{UserID: "u1", Status: models.StatusAway, UpdatedAt: changed}
+	data, err := EncodePayload(Event{Type: EventUpdated, UserID: "u1", Presence: &p, Revision: 12, Timestamp: emitted}, PayloadV2)
+	if err != nil {
+		t.Fatalf("EncodePayload: %v", err)
+	}
+	var v2 EventV2
+	if err := json.Unmarshal(data, &v2); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if v2.ID != "u1:12" || !v2.OccurredAt.Equal(changed) || !v2.EmittedAt.Equal(emitted) || v2.Presence == nil {
+		t.Fatalf("unexpected v2 payload %+v", v2)
+	}
+
+	// Without a revision, changes of a user still get distinct IDs
+	ids := map[string]bool{}
+	for i := range 2 {
+		p := models.Presence{UserID: "u1", Status: models.StatusAway, UpdatedAt: changed.Add(time.Duration(i))}
+		data, _ := EncodePayload(Event{Type: EventUpdated, UserID: "u1", Presence: &p, Timestamp: emitted}, PayloadV2)
+		json.Unmarshal(data, &v2)
+		ids[v2.ID] = true
+	}
+	if want := "u1:at:" + strconv.FormatInt(changed.UnixNano(), 10); len(ids) != 2 || !ids[want] {
+		t.Fatalf("expected distinct IDs by change time, got %v", ids)
+	}
+	if _, err := EncodePayload(Event{}, "v0"); err == nil {
+		t.Fatal("expected an unknown version to be rejected")
+	}
+}
+
+func TestEncodeBackfillPayload(t *testing.T) {
+	changed := time.Date(2019, 6, 1, 8, 30, 0, 0, time.UTC)
+	p := models.Presence{UserID: "u1", Status: models.StatusBusy, UpdatedAt: changed}
+	data, err := EncodeBackfillPayload(Event{Type: EventUpdated, UserID: "u1", Presence: &p, Timestamp: time.Now()}, PayloadV2)
+	if err != nil {
+		t.Fatalf("EncodeBackfillPayload: %v", err)
+	}
+	var v2 EventV2
+	if err := json.Unmarshal(data, &v2); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := "u1:backfill:" + strconv.FormatInt(changed.UnixNano(), 10); v2.ID != want || !v2.OccurredAt.Equal(changed) {
+		t.Fatalf("expected ID %s at the original time, got %+v", want, v2)
+	}
+}
+
+func TestHub_DropsDuplicateAndStaleRevisions(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(8)
+	defer sub.Close()
+
+	publish := []struct {
+		user     string
+		revision uint64
+		accepted bool
+	}{
+		{"u1", 5, true},
+		{"u1", 5, false}, // Redelivered
+		{"u2", 3, true},  // Revisions are compared per user
+		{"u1", 4, false}, // Older than the last u1 change
+		{"u1", 9, true},
+		{"u1", 0, true}, // No revision to order by
+	}
+	for _, p := range publish {
+		if got := h.Publish(Event{Type: EventUpdated, UserID: p.user, Revision: p.revision}); got != p.accepted {
+			t.Fatalf("Publish(%s@%d) = %v, want %v", p.user, p.revision, got, p.accepted)
+		}
+	}
+	var got []uint64
+	for len(sub.Events()) > 0 {
+		got = append(got, (<-sub.Events()).Revision)
+	}
+	if len(got) != 4 || got[0] != 5 || got[1] != 3 || got[2] != 9 || got[3] != 0 {
+		t.Fatalf("expected revisions 5 3 9 0, got %v", got)
+	}
+}
+
+func TestSequencer_ForgetsEndedPresences(t *testing.T) {
+	s := NewSequencer()
+	live := &models.Presence{UserID: "u1", Status: models.StatusOnline, TTL: time.Hour}
+	s.Accept(Event{Type: EventUpdated, UserID: "u1", Presence: live, Revision: 1})
+	s.Accept(Event{Type: EventUpdated, UserID: "u2", Presence: live, Revision: 2})
+	s.Accept(Event{Type: EventDeleted, UserID: "u2", Revision: 3})
+	if s.Accept(Event{Type: EventUpdated, UserID: "u2", Presence: live, Revision: 2}) {
+		t.Fatal("expected a replay older than the delete rejected")
+	}
+
+	// Past the grace, the deleted user is forgotten but the live one kept
+	s.mu.Lock()
+	s.prune(time.Now().Add(sequenceGrace + time.Second))
+	n := len(s.last)
+	s.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected only u1 held, got %d users", n)
+	}
+	if s.Accept(Event{Type: EventUpdated, UserID: "u1", Presence: live, Revision: 1}) {
+		t.Fatal("expected u1's sequence kept while its presence lives")
+	}
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+// Payload versions of events sent to external consumers. A version's shape
+// never changes once published; new shapes get a new version, and each
+// consumer picks the version it understands.
+const (
+	// PayloadV1 is Event as sent on the WebSocket stream
+	PayloadV1 = "v1"
+	// PayloadV2 adds a stable event ID, the time of the change itself and
+	// the name of its JSON Schema
+	PayloadV2 = "v2"
+	// DefaultPayloadVersion is sent to consumers that don't pick a version
+	DefaultPayloadVersion = PayloadV1
+)
+
+// payloadSchemas names the published JSON Schema of each payload version
+var payloadSchemas = map[string]string{
+	PayloadV1: "presence-event",
+	PayloadV2: "presence-event-v2",
+}
+
+// EventV2 is the v2 event payload
+type EventV2 struct {
+	Schema     string           `json:"schema"`
+	ID         string           `json:"id"` // user_id:revision, the same on every redelivery; see eventID
+	Type       EventType        `json:"type"`
+	UserID     string           `json:"user_id"`
+	Revision   uint64           `json:"revision"`
+	OccurredAt time.Time        `json:"occurred_at"` // When the presence changed; emitted_at for deletes
+	EmittedAt  time.Time        `json:"emitted_at"`
+	Presence   *models.Presence `json:"presence,omitempty"`
+	RequestID  string           `json:"request_id,omitempty"` // X-Request-ID of the API call that made the change, if known
+}
+
+// PayloadSchema returns the JSON Schema name of a payload version, and
+// whether the version is known
+func PayloadSchema(version string) (string, bool) {
+	name, ok := payloadSchemas[version]
+	return name, ok
+}
+
+// EncodePayload encodes ev in the given payload version
+func EncodePayload(ev Event, version string) ([]byte, error) {
+	switch version {
+	case PayloadV1:
+		return json.Marshal(ev)
+	case PayloadV2:
+		return json.Marshal(eventV2(ev, eventID(ev)))
+	}
+	return nil, fmt.Errorf("unknown event payload version %q", version)
+}
+
+// eventID is the v2 ID of ev: "<user_id>:<revision>". Events relayed over
+// core NATS carry no revision, and "<user_id>:0" would be shared by every
+// change of the user, so those fall back to the presence's own revision, and
+// without one to "<user_id>:at:<occurred_at in Unix nanoseconds>".
+func eventID(ev Event) string {
+	revision := ev.Revision
+	if revision == 0 && ev.Presence != nil {
+		revision = ev.Presence.Revision
+	}
+	if revision != 0 {
+		return ev.UserID + ":" + strconv.FormatUint(revision, 10)
+	}
+	occurred := ev.Timestamp
+	if ev.Presence != nil && !ev.Presence.UpdatedAt.IsZero() {
+		occurred = ev.Presence.UpdatedAt
+	}
+	return ev.UserID + ":at:" + strconv.FormatInt(occurred.UnixNano(), 10)
+}
+
+// EncodeBackfillPayload encodes ev, a change replayed from another system's
+// history, in the given payload version. It has no revision, so v2 payloads
+// identify it as "<user_id>:backfill:<occurred_at in Unix nanoseconds>".
+func EncodeBackfillPayload(ev Event, version string) ([]byte, error) {
+	if version != PayloadV2 {
+		return EncodePayload(ev, version)
+	}
+	v2 := eventV2(ev, "")
+	v2.ID = ev.UserID + ":backfill:" + strconv.FormatInt(v2.OccurredAt.UnixNano(), 10)
+	return json.Marshal(v2)
+}
+
+// eventV2 is ev as a v2 payload with the given ID
+func eventV2(ev Event, id string) EventV2 {
+	v2 := EventV2{
+		Schema:     payloadSchemas[PayloadV2],
+		ID:         id,
+		Type:       ev.Type,
+		UserID:     ev.UserID,
+		Revision:   ev.Revision,
+		OccurredAt: ev.Timestamp,
+		EmittedAt:  ev.Timestamp,
+		Presence:   ev.Presence,
+		RequestID:  ev.RequestID,
+	}
+	if ev.Presence != nil && !ev.Presence.UpdatedAt.IsZero() {
+		v2.OccurredAt = ev.Presence.UpdatedAt
+	}
+	return v2
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"gopresence/internal/metrics"
+)
+
+// sequenceGrace is how long a user's last revision is kept past the point
+// no later event can refer to an earlier one: after a delete, or after the
+// presence's TTL ran out. It covers redeliveries and late arrivals.
+const sequenceGrace = time.Minute
+
+// Sequencer enforces per-user event order. KV revisions increase with every
+// write to the bucket, so each user's revisions form a strictly increasing
+// sequence; an event at or below the last revision seen for its user is a
+// duplicate or arrived out of order, and is rejected. Users are forgotten
+// sequenceGrace after their presence was deleted or its TTL ran out, so
+// the sequencer doesn't grow with every user ever seen.
+type Sequencer struct {
+	mu       sync.Mutex
+	last     map[string]sequence // user ID -> highest revision accepted
+	prunedAt time.Time
+}
+
+type sequence struct {
+	revision uint64
+	forget   time.Time // When the user may be forgotten
+}
+
+// NewSequencer creates an empty sequencer
+func NewSequencer() *Sequencer {
+	return &Sequencer{last: make(map[string]sequence), prunedAt: time.Now()}
+}
+
+// Accept reports whether ev advances its user's sequence, recording it if
+// so. Events without a revision are always accepted.
+func (s *Sequencer) Accept(ev Event) bool {
+	if ev.Revision == 0 {
+		return true
+	}
+	now := time.Now()
+	s.mu.Lock()
+	last := s.last[ev.UserID].revision
+	if ev.Revision > last {
+		forget := now.Add(sequenceGrace)
+		// A presence without a TTL has no known end; it is forgotten after
+		// the grace like a deleted one, at worst accepting a replay older
+		// than that
+		if ev.Type != EventDeleted && ev.Presence != nil && ev.Presence.TTL > 0 {
+			forget = forget.Add(ev.Presence.TTL)
+		}
+		s.last[ev.UserID] = sequence{revision: ev.Revision, forget: forget}
+	}
+	if now.Sub(s.prunedAt) >= sequenceGrace {
+		s.prune(now)
+	}
+	s.mu.Unlock()
+
+	switch {
+	case ev.Revision == last:
+		metrics.ObserveEventRejected("duplicate")
+		return false
+	case ev.Revision < last:
+		metrics.ObserveEventRejected("stale")
+		return false
+	}
+	return true
+}
+
+// prune forgets the users due; callers hold s.mu
+func (s *Sequencer) prune(now time.Time) {
+	s.prunedAt = now
+	for userID, seq := range s.last {
+		if now.After(seq.forget) {
+			delete(s.last, userID)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	presencev1 "gopresence/internal/pb/presence/v1"
+)
+
+// NewHandler returns an http.Handler serving the /api/v2 presence routes
+// generated from the google.api.http options in presence.proto. Requests are
+// dispatched in-process to server, so REST and gRPC share one implementation.
+func NewHandler(ctx context.Context, server presencev1.PresenceServiceServer) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &responseMarshaler{
+			JSONPb: runtime.JSONPb{
+				MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true},
+				UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+			},
+		}),
+		runtime.WithMarshalerOption(presencev1.ContentTypeProtobuf, &protoMarshaler{}),
+		runtime.WithErrorHandler(errorHandler),
+	)
+	if err := presencev1.RegisterPresenceServiceHandlerServer(ctx, mux, server); err != nil {
+		return nil, fmt.Errorf("failed to register gateway handlers: %w", err)
+	}
+	return legacyUsersParam(mux), nil
+}
+
+// responseMarshaler decodes requests with protojson but encodes
+// PresenceResponse through models.PresenceResponse, so the gateway emits
+// exactly the JSON shape of the hand-written handlers (e.g. numeric ttl)
+type responseMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *responseMarshaler) Marshal(v interface{}) ([]byte, error) {
+	if resp, ok := v.(*presencev1.PresenceResponse); ok {
+		return json.Marshal(presencev1.ToResponse(resp))
+	}
+	return m.JSONPb.Marshal(v)
+}
+
+// protoMarshaler is the binary codec option, labelled with its own media type
+type protoMarshaler struct {
+	runtime.ProtoMarshaller
+}
+
+func (*protoMarshaler) ContentType(_ interface{}) string {
+	return presencev1.ContentTypeProtobuf
+}
+
+// errorHandler writes gRPC errors as the API's {"success":false,"error":...}
+// envelope, in whichever encoding the request negotiated
+func errorHandler(ctx context.Context, _ *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	st := status.Convert(err)
+	body, merr := m.Marshal(&presencev1.PresenceResponse{Success: false, Error: st.Message()})
+	if merr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", m.ContentType(nil))
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+	w.Write(body)
+}
+
+// legacyUsersParam rewrites GET /api/v2/presence?users=a,b into the
+// repeated user_ids query parameter the gateway binds
+func legacyUsersParam(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if users := q.Get("users"); users != "" && r.Method == http.MethodGet {
+			q.Del("users")
+			for _, id := range strings.Split(users, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					q.Add("user_ids", id)
+				}
+			}
+			r.URL.RawQuery = q.Encode()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/events"
+	"gopresence/internal/grpcserver"
+	"gopresence/internal/models"
+	presencev1 "gopresence/internal/pb/presence/v1"
+)
+
+type memService struct {
+	presences map[string]models.Presence
+}
+
+func (m *memService) GetPresence(ctx context.Context, userID string) (models.Presence, error) {
+	if p, ok := m.presences[userID]; ok {
+		return p, nil
+	}
+	return models.Presence{}, apperrors.NotFound(userID)
+}
+
+func (m *memService) SetPresence(ctx context.Context, userID string, p models.Presence) error {
+	m.presences[userID] = p
+	return nil
+}
+
+func (m *memService) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	out := make(map[string]models.Presence)
+	for _, id := range userIDs {
+		if p, ok := m.presences[id]; ok {
+			out[id] = p
+		}
+	}
+	return out, nil
+}
+
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	svc := &memService{presences: map[string]models.Presence{
+		"u1": {UserID: "u1", Status: models.StatusOnline, NodeID: "n1", TTL: time.Minute},
+		"u2": {UserID: "u2", Status: models.StatusAway, NodeID: "n1"},
+	}}
+	h, err := NewHandler(context.Background(), grpcserver.NewServer(svc, events.NewHub()))
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	return h
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string) (*httptest.ResponseRecorder, models.PresenceResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var resp models.PresenceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s %s: %v (%s)", method, target, err, w.Body.String())
+	}
+	return w, resp
+}
+
+func TestGateway_GetPresenceMatchesHandlerJSON(t *testing.T) {
+	h := newTestHandler(t)
+
+	w, resp := do(t, h, http.MethodGet, "/api/v2/presence/u1", "")
+	if w.Code != http.StatusOK || !resp.Success || resp.Data["u1"].Status != models.StatusOnline {
+		t.Fatalf("unexpected response %d %+v", w.Code, resp)
+	}
+	// ttl is a JSON number of nanoseconds, as in the hand-written handlers
+	if !strings.Contains(w.Body.String(), `"ttl":60000000000`) || !strings.Contains(w.Body.String(), `"user_id":"u1"`) {
+		t.Fatalf("unexpected JSON shape: %s", w.Body.String())
+	}
+
+	w, resp = do(t, h, http.MethodGet, "/api/v2/presence/missing", "")
+	if w.Code != http.StatusNotFound || resp.Success || resp.Error == "" {
+		t.Fatalf("expected 404 envelope, got %d %+v", w.Code, resp)
+	}
+}
+
+func TestGateway_SetPresence(t *testing.T) {
+	h := newTestHandler(t)
+
+	w, resp := do(t, h, http.MethodPut, "/api/v2/presence/u3", `{"status":"busy","message":"meeting","ttl":30}`)
+	if w.Code != http.StatusOK || resp.Data["u3"].Status != models.StatusBusy || resp.Data["u3"].TTL != 30*time.Second {
+		t.Fatalf("unexpected set response %d %+v", w.Code, resp)
+	}
+
+	w, resp = do(t, h, http.MethodPut, "/api/v2/presence/u3", `{"status":"bogus"}`)
+	if w.Code != http.StatusBadRequest || resp.Error != "invalid status" {
+		t.Fatalf("expected 400 invalid status, got %d %+v", w.Code, resp)
+	}
+}
+
+func TestGateway_MultipleAndBatch(t *testing.T) {
+	h := newTestHandler(t)
+
+	w, resp := do(t, h, http.MethodGet, "/api/v2/presence?users=u1,%20u2,nope", "")
+	if w.Code != http.StatusOK || len(resp.Data) != 2 {
+		t.Fatalf("unexpected multi response %d %+v", w.Code, resp)
+	}
+
+	w, resp = do(t, h, http.MethodPost, "/api/v2/presence/batch", `{"user_ids":["u2"]}`)
+	if w.Code != http.StatusOK || len(resp.Data) != 1 || resp.Data["u2"].Status != models.StatusAway {
+		t.Fatalf("unexpected batch response %d %+v", w.Code, resp)
+	}
+
+	w, _ = do(t, h, http.MethodPost, "/api/v2/presence/batch", `{"user_ids":[]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty batch, got %d", w.Code)
+	}
+}
+
+func TestGateway_BinaryCodec(t *testing.T) {
+	h := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/presence/u1", nil)
+	req.Header.Set("Accept", presencev1.ContentTypeProtobuf)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != presencev1.ContentTypeProtobuf {
+		t.Fatalf("expected protobuf response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var resp presencev1.PresenceResponse
+	if err := proto.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.GetData()["u1"].GetStatus() != "online" {
+		t.Fatalf("unexpected protobuf body: %v %v", &resp, err)
+	}
+}
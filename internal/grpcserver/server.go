@@ -0,0 +1,383 @@
+package grpcserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gopresence/internal/auth"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	presencev1 "gopresence/internal/pb/presence/v1"
+	"gopresence/internal/privacy"
+)
+
+// PresenceService defines the presence operations backing the gRPC surface
+type PresenceService interface {
+	GetPresence(ctx context.Context, userID string) (models.Presence, error)
+	SetPresence(ctx context.Context, userID string, presence models.Presence) error
+	GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error)
+}
+
+// Server implements presencev1.PresenceServiceServer
+type Server struct {
+	presencev1.UnimplementedPresenceServiceServer
+
+	service       PresenceService
+	hub           *events.Hub
+	watchBuffer   int
+	pseudonymizer *privacy.Pseudonymizer
+	node          models.NodeInfo
+	authenticator Authenticator
+	authorizer    auth.Authorizer
+}
+
+// Authenticator reads the caller of a call from the value of its
+// authorization metadata, a bearer token as in the REST API's header
+type Authenticator interface {
+	AuthenticateHeader(ctx context.Context, authorization string) (context.Context, error)
+}
+
+// Option configures optional Server behavior
+type Option func(*Server)
+
+// WithPseudonymizer maps user IDs to pseudonyms, matching the REST handlers
+func WithPseudonymizer(p *privacy.Pseudonymizer) Option {
+	return func(s *Server) { s.pseudonymizer = p }
+}
+
+// WithNode sets the node recorded on written presences and reported in
+// response header metadata
+func WithNode(node models.NodeInfo) Option {
+	return func(s *Server) { s.node = node }
+}
+
+// WithAuthorization has authz decide on presence writes, as on the REST
+// API, for callers authenticated by authn from their authorization metadata.
+// Calls without it are anonymous; calls with an invalid token are refused.
+func WithAuthorization(authn Authenticator, authz auth.Authorizer) Option {
+	return func(s *Server) { s.authenticator, s.authorizer = authn, authz }
+}
+
+// WithWatchBuffer sets the per-stream event buffer size for WatchPresence
+func WithWatchBuffer(n int) Option {
+	return func(s *Server) { s.watchBuffer = n }
+}
+
+// NewServer creates a new gRPC presence server
+func NewServer(service PresenceService, hub *events.Hub, opts ...Option) *Server {
+	s := &Server{
+		service:     service,
+		hub:         hub,
+		watchBuffer: 256,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers the server on a grpc.Server
+func (s *Server) Register(gs *grpc.Server) {
+	presencev1.RegisterPresenceServiceServer(gs, s)
+}
+
+// GetPresence implements presencev1.PresenceServiceServer
+func (s *Server) GetPresence(ctx context.Context, req *presencev1.GetPresenceRequest) (*presencev1.PresenceResponse, error) {
+	userID := req.GetUserId()
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	s.sendNodeHeader(ctx)
+
+	presence, err := s.service.GetPresence(ctx, s.storeID(userID))
+	if err != nil {
+		if apperrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "presence not found for user %s", userID)
+		}
+		return nil, storeError(err, "failed to get presence")
+	}
+	presence.UserID = userID
+
+	return &presencev1.PresenceResponse{
+		Success: true,
+		Data:    map[string]*presencev1.Presence{userID: presencev1.FromModel(presence)},
+	}, nil
+}
+
+// SetPresence implements presencev1.PresenceServiceServer
+func (s *Server) SetPresence(ctx context.Context, req *presencev1.SetPresenceRequest) (*presencev1.PresenceResponse, error) {
+	userID := req.GetUserId()
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	st := models.PresenceStatus(req.GetStatus())
+	if !st.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "invalid status")
+	}
+	if req.GetTtl() > models.MaxTTLSeconds {
+		return nil, status.Error(codes.InvalidArgument, "invalid ttl")
+	}
+	client := presencev1.ToClientInfo(req.GetClient())
+	if client != nil {
+		if err := client.Validate(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid client: %v", err)
+		}
+	}
+	if err := models.ValidateTimeZone(req.GetTimeZone()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := models.ValidateCorrelationID(req.GetCorrelationId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.authorize(ctx, auth.ActionWrite, userID); err != nil {
+		return nil, err
+	}
+	s.sendNodeHeader(ctx)
+
+	now := time.Now().UTC()
+	presence := models.Presence{
+		UserID:        s.storeID(userID),
+		Status:        st,
+		Message:       req.GetMessage(),
+		LastSeen:      now,
+		UpdatedAt:     now,
+		NodeID:        s.node.ID,
+		Client:        client,
+		TimeZone:      req.GetTimeZone(),
+		CorrelationID: req.GetCorrelationId(),
+	}
+	if req.GetTtl() > 0 {
+		presence.TTL = time.Duration(req.GetTtl()) * time.Second
+	}
+
+	if err := s.service.SetPresence(ctx, presence.UserID, presence); err != nil {
+		return nil, storeError(err, "failed to set presence")
+	}
+	presence.UserID = userID
+
+	return &presencev1.PresenceResponse{
+		Success: true,
+		Data:    map[string]*presencev1.Presence{userID: presencev1.FromModel(presence)},
+	}, nil
+}
+
+// GetMultiplePresences implements presencev1.PresenceServiceServer
+func (s *Server) GetMultiplePresences(ctx context.Context, req *presencev1.GetMultiplePresencesRequest) (*presencev1.PresenceResponse, error) {
+	if len(req.GetUserIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_ids is required")
+	}
+	s.sendNodeHeader(ctx)
+
+	ids, reverse := s.storeIDs(req.GetUserIds())
+	presences, err := s.service.GetMultiplePresences(ctx, ids)
+	if err != nil {
+		return nil, storeError(err, "failed to get presences")
+	}
+
+	data := make(map[string]*presencev1.Presence, len(presences))
+	for id, presence := range presences {
+		if userID, ok := reverse[id]; ok {
+			presence.UserID = userID
+			data[userID] = presencev1.FromModel(presence)
+		}
+	}
+	return &presencev1.PresenceResponse{Success: true, Data: data}, nil
+}
+
+// WatchPresence implements presencev1.PresenceServiceServer.
+// Deltas are sent in hub order with a per-stream sequence number; if the
+// consumer falls too far behind the stream is aborted with ResourceExhausted
+// so it can reconnect and re-read current state.
+func (s *Server) WatchPresence(req *presencev1.WatchPresenceRequest, stream presencev1.PresenceService_WatchPresenceServer) error {
+	mask := req.GetFieldMask()
+	if mask != nil && len(mask.GetPaths()) > 0 {
+		if !mask.IsValid(&presencev1.Presence{}) {
+			return status.Error(codes.InvalidArgument, "invalid field_mask")
+		}
+		mask.Normalize()
+	} else {
+		mask = nil
+	}
+
+	var filter map[string]string
+	if len(req.GetUserIds()) > 0 {
+		_, filter = s.storeIDs(req.GetUserIds())
+	}
+
+	if md := s.nodeMetadata(); md.Len() > 0 {
+		if err := stream.SendHeader(md); err != nil {
+			return err
+		}
+	}
+
+	sub := s.hub.Subscribe(s.watchBuffer)
+	defer sub.Close()
+
+	var seq uint64
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if sub.Dropped() > 0 {
+				return status.Error(codes.ResourceExhausted, "watch consumer too slow")
+			}
+
+			userID := ev.UserID
+			if filter != nil {
+				var watched bool
+				if userID, watched = filter[ev.UserID]; !watched {
+					continue
+				}
+			}
+
+			seq++
+			delta := &presencev1.PresenceDelta{
+				Sequence:  seq,
+				Type:      presencev1.PresenceDelta_TYPE_UPDATED,
+				UserId:    userID,
+				Timestamp: timestamppb.New(ev.Timestamp),
+				Revision:  ev.Revision,
+			}
+			if ev.Type == events.EventDeleted {
+				delta.Type = presencev1.PresenceDelta_TYPE_DELETED
+			} else if ev.Presence != nil {
+				p := *ev.Presence
+				p.UserID = userID
+				delta.Presence = applyFieldMask(presencev1.FromModel(p), mask)
+			}
+
+			if err := stream.Send(delta); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Header metadata keys identifying the serving node
+const (
+	MetadataNodeID      = "x-node-id"
+	MetadataNodeType    = "x-node-type"
+	MetadataNodeRegion  = "x-node-region"
+	MetadataNodeVersion = "x-node-version"
+)
+
+func (s *Server) nodeMetadata() metadata.MD {
+	md := metadata.MD{}
+	if s.node.ID != "" {
+		md.Set(MetadataNodeID, s.node.ID)
+	}
+	if s.node.Type != "" {
+		md.Set(MetadataNodeType, s.node.Type)
+	}
+	if s.node.Region != "" {
+		md.Set(MetadataNodeRegion, s.node.Region)
+	}
+	if s.node.Version != "" {
+		md.Set(MetadataNodeVersion, s.node.Version)
+	}
+	return md
+}
+
+// sendNodeHeader attaches the node metadata to a unary response; it is best
+// effort since the header only aids debugging
+func (s *Server) sendNodeHeader(ctx context.Context) {
+	if md := s.nodeMetadata(); md.Len() > 0 {
+		_ = grpc.SetHeader(ctx, md)
+	}
+}
+
+// storeError maps a failed store operation to DeadlineExceeded if the store
+// timed out, FailedPrecondition for a disallowed status change, otherwise
+// Internal with message
+func storeError(err error, message string) error {
+	if apperrors.IsBudgetExceeded(err) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if apperrors.IsInvalidTransition(err) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if apperrors.IsTimeout(err) {
+		return status.Error(codes.DeadlineExceeded, "presence store timed out")
+	}
+	return status.Error(codes.Internal, message)
+}
+
+// applyFieldMask returns a copy of p holding only the masked top-level fields
+func applyFieldMask(p *presencev1.Presence, mask *fieldmaskpb.FieldMask) *presencev1.Presence {
+	if mask == nil {
+		return p
+	}
+	src := p.ProtoReflect()
+	out := &presencev1.Presence{}
+	dst := out.ProtoReflect()
+	fields := src.Descriptor().Fields()
+	for _, path := range mask.GetPaths() {
+		name, _, _ := strings.Cut(path, ".")
+		if fd := fields.ByName(protoreflect.Name(name)); fd != nil && src.Has(fd) {
+			dst.Set(fd, src.Get(fd))
+		}
+	}
+	return out
+}
+
+// authorize has the authorizer decide whether the caller of ctx may perform
+// action on resource, answering Unauthenticated for anonymous callers it
+// refuses and PermissionDenied for the rest
+func (s *Server) authorize(ctx context.Context, action, resource string) error {
+	if s.authorizer == nil {
+		return nil
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && s.authenticator != nil {
+		if values := md.Get("authorization"); len(values) > 0 {
+			var err error
+			if ctx, err = s.authenticator.AuthenticateHeader(ctx, values[0]); err != nil {
+				return status.Error(codes.Unauthenticated, err.Error())
+			}
+		}
+	}
+	subject := auth.SubjectFromContext(ctx)
+	allowed, err := s.authorizer.Authorize(ctx, subject, action, resource)
+	switch {
+	case err != nil:
+		return status.Error(codes.Unavailable, "authorization unavailable")
+	case allowed:
+		return nil
+	case subject.ID == "":
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	return status.Errorf(codes.PermissionDenied, "not allowed to %s %s", action, resource)
+}
+
+func (s *Server) storeID(userID string) string {
+	if s.pseudonymizer == nil {
+		return userID
+	}
+	return s.pseudonymizer.Pseudonymize(userID)
+}
+
+// storeIDs returns store IDs for the given user IDs and a store ID -> user ID mapping
+func (s *Server) storeIDs(userIDs []string) ([]string, map[string]string) {
+	if s.pseudonymizer != nil {
+		return s.pseudonymizer.PseudonymizeAll(userIDs)
+	}
+	reverse := make(map[string]string, len(userIDs))
+	for _, userID := range userIDs {
+		reverse[userID] = userID
+	}
+	return userIDs, reverse
+}
@@ -0,0 +1,209 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"gopresence/internal/auth"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	presencev1 "gopresence/internal/pb/presence/v1"
+)
+
+type memService struct {
+	presences map[string]models.Presence
+}
+
+func (m *memService) GetPresence(ctx context.Context, userID string) (models.Presence, error) {
+	if p, ok := m.presences[userID]; ok {
+		return p, nil
+	}
+	return models.Presence{}, apperrors.NotFound(userID)
+}
+
+func (m *memService) SetPresence(ctx context.Context, userID string, p models.Presence) error {
+	m.presences[userID] = p
+	return nil
+}
+
+func (m *memService) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	out := make(map[string]models.Presence)
+	for _, id := range userIDs {
+		if p, ok := m.presences[id]; ok {
+			out[id] = p
+		}
+	}
+	return out, nil
+}
+
+func startServer(t *testing.T, srv *Server) presencev1.PresenceServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	srv.Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return presencev1.NewPresenceServiceClient(conn)
+}
+
+func TestServer_UnaryRPCs(t *testing.T) {
+	svc := &memService{presences: map[string]models.Presence{}}
+	client := startServer(t, NewServer(svc, events.NewHub()))
+	ctx := context.Background()
+
+	if _, err := client.SetPresence(ctx, &presencev1.SetPresenceRequest{UserId: "u1", Status: "bogus"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if _, err := client.SetPresence(ctx, &presencev1.SetPresenceRequest{UserId: "u1", Status: "online", Ttl: models.MaxTTLSeconds + 1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an overflowing TTL, got %v", err)
+	}
+	if _, err := client.SetPresence(ctx, &presencev1.SetPresenceRequest{UserId: "u1", Status: "online", Client: &presencev1.ClientInfo{Capabilities: []string{"Video!"}}}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a malformed capability, got %v", err)
+	}
+	resp, err := client.SetPresence(ctx, &presencev1.SetPresenceRequest{UserId: "u1", Status: "online", Ttl: 60, Client: &presencev1.ClientInfo{Platform: "ios", Capabilities: []string{"video-capable"}}})
+	if err != nil || !resp.GetSuccess() || resp.GetData()["u1"].GetTtl() != int64(time.Minute) {
+		t.Fatalf("set failed: %v %v", resp, err)
+	}
+	if got := resp.GetData()["u1"].GetClient(); got.GetPlatform() != "ios" || len(got.GetCapabilities()) != 1 {
+		t.Fatalf("expected the client info back, got %v", got)
+	}
+
+	resp, err = client.GetPresence(ctx, &presencev1.GetPresenceRequest{UserId: "u1"})
+	if err != nil || resp.GetData()["u1"].GetStatus() != "online" {
+		t.Fatalf("get failed: %v %v", resp, err)
+	}
+	if _, err := client.GetPresence(ctx, &presencev1.GetPresenceRequest{UserId: "nope"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	resp, err = client.GetMultiplePresences(ctx, &presencev1.GetMultiplePresencesRequest{UserIds: []string{"u1", "u2"}})
+	if err != nil || len(resp.GetData()) != 1 {
+		t.Fatalf("multi failed: %v %v", resp, err)
+	}
+}
+
+func TestServer_AuthorizesWrites(t *testing.T) {
+	svc := &memService{presences: map[string]models.Presence{}}
+	authz := auth.SelfWrites{Next: auth.AllowAll{}}
+	client := startServer(t, NewServer(svc, events.NewHub(), WithAuthorization(auth.NewJWTMiddleware("secret", ""), authz)))
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+	asU1 := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+
+	if _, err := client.SetPresence(context.Background(), &presencev1.SetPresenceRequest{UserId: "u1", Status: "online"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for an anonymous write, got %v", err)
+	}
+	bad := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+	if _, err := client.SetPresence(bad, &presencev1.SetPresenceRequest{UserId: "u1", Status: "online"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for an invalid token, got %v", err)
+	}
+	if _, err := client.SetPresence(asU1, &presencev1.SetPresenceRequest{UserId: "u2", Status: "online"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for another user's presence, got %v", err)
+	}
+	if _, err := client.SetPresence(asU1, &presencev1.SetPresenceRequest{UserId: "u1", Status: "online"}); err != nil {
+		t.Fatalf("expected the caller's own write allowed, got %v", err)
+	}
+	if len(svc.presences) != 1 {
+		t.Fatalf("expected only the caller's own presence written, got %v", svc.presences)
+	}
+}
+
+func TestServer_ReportsServingNode(t *testing.T) {
+	svc := &memService{presences: map[string]models.Presence{}}
+	node := models.NodeInfo{ID: "center-1", Type: "center", Region: "us-east", Version: "v2.1.0"}
+	client := startServer(t, NewServer(svc, events.NewHub(), WithNode(node)))
+
+	var header metadata.MD
+	if _, err := client.SetPresence(context.Background(), &presencev1.SetPresenceRequest{UserId: "u1", Status: "online"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if svc.presences["u1"].NodeID != "center-1" {
+		t.Fatalf("expected configured node id, got %q", svc.presences["u1"].NodeID)
+	}
+	if got := header.Get(MetadataNodeID); len(got) != 1 || got[0] != "center-1" {
+		t.Fatalf("expected node id header, got %v", header)
+	}
+	if got := header.Get(MetadataNodeRegion); len(got) != 1 || got[0] != "us-east" {
+		t.Fatalf("expected region header, got %v", header)
+	}
+	if got := header.Get(MetadataNodeVersion); len(got) != 1 || got[0] != "v2.1.0" {
+		t.Fatalf("expected version header, got %v", header)
+	}
+
+	stream, err := client.WatchPresence(context.Background(), &presencev1.WatchPresenceRequest{})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	if header, err = stream.Header(); err != nil || len(header.Get(MetadataNodeType)) != 1 {
+		t.Fatalf("expected node type on watch header, got %v %v", header, err)
+	}
+}
+
+func TestServer_WatchPresenceWithFilterAndMask(t *testing.T) {
+	hub := events.NewHub()
+	client := startServer(t, NewServer(&memService{presences: map[string]models.Presence{}}, hub))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := mustRecvErr(client.WatchPresence(ctx, &presencev1.WatchPresenceRequest{FieldMask: &fieldmaskpb.FieldMask{Paths: []string{"nope"}}})); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for bad mask, got %v", err)
+	}
+
+	stream, err := client.WatchPresence(ctx, &presencev1.WatchPresenceRequest{
+		UserIds:   []string{"u1"},
+		FieldMask: &fieldmaskpb.FieldMask{Paths: []string{"status"}},
+	})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	// Wait for the server-side subscription before publishing
+	for hub.Subscribers() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u2", Presence: &models.Presence{UserID: "u2", Status: models.StatusBusy}})
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1", Presence: &models.Presence{UserID: "u1", Status: models.StatusAway, Message: "lunch"}})
+	hub.Publish(events.Event{Type: events.EventDeleted, UserID: "u1", Revision: 12})
+
+	d, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("recv: %v", err)
+	}
+	if d.GetSequence() != 1 || d.GetUserId() != "u1" || d.GetPresence().GetStatus() != "away" {
+		t.Fatalf("unexpected delta: %v", d)
+	}
+	if d.GetPresence().GetMessage() != "" || d.GetPresence().GetUserId() != "" {
+		t.Fatalf("expected masked fields to be cleared: %v", d.GetPresence())
+	}
+	d, err = stream.Recv()
+	if err != nil || d.GetSequence() != 2 || d.GetType() != presencev1.PresenceDelta_TYPE_DELETED || d.GetPresence() != nil || d.GetRevision() != 12 {
+		t.Fatalf("unexpected delete delta: %v %v", d, err)
+	}
+}
+
+func mustRecvErr(stream presencev1.PresenceService_WatchPresenceClient, err error) (*presencev1.PresenceDelta, error) {
+	if err != nil {
+		return nil, err
+	}
+	return stream.Recv()
+}
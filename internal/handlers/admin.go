@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/requestid"
+)
+
+// PresenceDeleter is implemented by services that can remove a presence
+// outright, rather than set it offline
+type PresenceDeleter interface {
+	DeletePresence(ctx context.Context, userID string) error
+}
+
+// WithAuditLogger sets the logger that admin actions are recorded to,
+// slog's default logger unless set
+func WithAuditLogger(logger *slog.Logger) Option {
+	return func(h *PresenceHandler) { h.audit = logger }
+}
+
+// AdminSetPresence handles PUT /api/v2/admin/presence/{user_id}, letting an
+// admin force another user's presence, e.g. a stuck agent to offline. The
+// route must be guarded by auth.RequireScope(auth.ScopeAdmin, ...); the
+// write is marked source=admin and the acting admin is recorded in the
+// audit log whether or not it succeeds.
+func (h *PresenceHandler) AdminSetPresence(w http.ResponseWriter, r *http.Request) {
+	admin := auth.GetUserIDFromContext(r.Context())
+	if admin == "" || !auth.HasScope(r.Context(), auth.ScopeAdmin) {
+		writeErrorResponse(w, r, http.StatusForbidden, CodeAdminScopeRequired)
+		return
+	}
+	userID, req, ok := readSetPresence(w, r)
+	if !ok {
+		return
+	}
+
+	// Best effort: the previous status only enriches the audit record
+	var previous models.PresenceStatus
+	if p, err := h.service.GetPresence(r.Context(), h.storeID(userID)); err == nil {
+		previous = p.Status
+	}
+
+	ok = h.setPresence(w, r, userID, req, models.SourceAdmin)
+	dry, _ := parseDryRun(r)
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin presence override",
+		slog.String("audit", "presence.admin_set"),
+		slog.String("admin", admin),
+		slog.String("user_id", userID),
+		slog.String("status", string(req.Status)),
+		slog.String("previous_status", string(previous)),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+		slog.Bool("dry_run", dry),
+		slog.Bool("success", ok),
+	)
+}
+
+// AdminDeletePresence handles DELETE /api/v2/admin/presence/{user_id},
+// removing a user's presence from the store, e.g. one left behind by a
+// client that will never come back. The route must be guarded like
+// AdminSetPresence, and every attempt is audited the same way.
+func (h *PresenceHandler) AdminDeletePresence(w http.ResponseWriter, r *http.Request) {
+	admin := auth.GetUserIDFromContext(r.Context())
+	if admin == "" || !auth.HasScope(r.Context(), auth.ScopeAdmin) {
+		writeErrorResponse(w, r, http.StatusForbidden, CodeAdminScopeRequired)
+		return
+	}
+	userID := mux.Vars(r)["user_id"]
+	if userID == "" {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUserIDRequired)
+		return
+	}
+	deleter, ok := h.service.(PresenceDeleter)
+	if !ok {
+		writeErrorResponse(w, r, http.StatusNotImplemented, CodeDeleteFailed)
+		return
+	}
+
+	var previous models.PresenceStatus
+	p, err := h.service.GetPresence(r.Context(), h.storeID(userID))
+	switch {
+	case err == nil:
+		previous = p.Status
+	case apperrors.IsNotFound(err):
+		writeErrorResponse(w, r, http.StatusNotFound, CodePresenceNotFound, userID)
+		return
+	}
+
+	err = deleter.DeletePresence(r.Context(), h.storeID(userID))
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin presence delete",
+		slog.String("audit", "presence.admin_delete"),
+		slog.String("admin", admin),
+		slog.String("user_id", userID),
+		slog.String("previous_status", string(previous)),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+		slog.Bool("success", err == nil),
+	)
+	if err != nil {
+		writeStoreError(w, r, err, CodeDeleteFailed)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, models.PresenceResponse{Success: true})
+}
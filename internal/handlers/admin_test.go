@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/models"
+)
+
+func TestAdminSetPresence(t *testing.T) {
+	svc := newMockPresenceService()
+	svc.presences["agent1"] = models.Presence{UserID: "agent1", Status: models.StatusBusy, LastSeen: time.Now(), UpdatedAt: time.Now(), NodeID: "n1"}
+	var audit bytes.Buffer
+	h := NewPresenceHandler(svc, WithAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil))))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v2/admin/presence/agent1", strings.NewReader(`{"status":"offline"}`))
+	req = mux.SetURLVars(req, map[string]string{"user_id": "agent1"})
+	ctx := auth.SetScopesInContext(auth.SetUserIDInContext(req.Context(), "desk1"), []string{auth.ScopeAdmin})
+	rr := httptest.NewRecorder()
+	h.AdminSetPresence(rr, req.WithContext(ctx))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if p := svc.presences["agent1"]; p.Status != models.StatusOffline || p.Source != models.SourceAdmin {
+		t.Fatalf("expected offline presence with source admin, got %+v", p)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("audit log: %v (%q)", err, audit.String())
+	}
+	for k, want := range map[string]interface{}{"admin": "desk1", "user_id": "agent1", "status": "offline", "previous_status": "busy", "success": true} {
+		if entry[k] != want {
+			t.Errorf("audit %s: expected %v, got %v", k, want, entry[k])
+		}
+	}
+}
+
+func TestAdminSetPresence_RequiresAdminScope(t *testing.T) {
+	svc := newMockPresenceService()
+	var audit bytes.Buffer
+	h := NewPresenceHandler(svc, WithAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil))))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v2/admin/presence/agent1", strings.NewReader(`{"status":"offline"}`))
+	req = mux.SetURLVars(req, map[string]string{"user_id": "agent1"})
+	rr := httptest.NewRecorder()
+	h.AdminSetPresence(rr, req.WithContext(auth.SetUserIDInContext(context.Background(), "user1")))
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if len(svc.presences) != 0 || audit.Len() != 0 {
+		t.Fatal("expected no write and no audit record")
+	}
+}
+
+// deletingService is a mock presence service that can delete presences
+type deletingService struct {
+	*mockPresenceService
+}
+
+func (d deletingService) DeletePresence(ctx context.Context, userID string) error {
+	delete(d.presences, userID)
+	return nil
+}
+
+func TestAdminDeletePresence(t *testing.T) {
+	svc := deletingService{newMockPresenceService()}
+	svc.presences["agent1"] = models.Presence{UserID: "agent1", Status: models.StatusBusy, LastSeen: time.Now(), UpdatedAt: time.Now(), NodeID: "n1"}
+	var audit bytes.Buffer
+	h := NewPresenceHandler(svc, WithAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil))))
+	serve := func(userID string, scopes ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v2/admin/presence/"+userID, nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": userID})
+		ctx := auth.SetScopesInContext(auth.SetUserIDInContext(req.Context(), "desk1"), scopes)
+		rr := httptest.NewRecorder()
+		h.AdminDeletePresence(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	if rr := serve("agent1"); rr.Code != http.StatusForbidden || len(svc.presences) != 1 {
+		t.Fatalf("expected 403 without the admin scope, got %d", rr.Code)
+	}
+	if rr := serve("agent1", auth.ScopeAdmin); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, ok := svc.presences["agent1"]; ok {
+		t.Fatal("expected agent1's presence to be deleted")
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("audit log: %v (%q)", err, audit.String())
+	}
+	for k, want := range map[string]interface{}{"audit": "presence.admin_delete", "admin": "desk1", "user_id": "agent1", "previous_status": "busy", "success": true} {
+		if entry[k] != want {
+			t.Errorf("audit %s: expected %v, got %v", k, want, entry[k])
+		}
+	}
+
+	rr := serve("agent1", auth.ScopeAdmin)
+	var resp models.PresenceResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusNotFound || resp.Code != CodePresenceNotFound {
+		t.Fatalf("expected 404 presence_not_found for a missing presence, got %d %+v", rr.Code, resp)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/annotations"
+	"gopresence/internal/auth"
+	"gopresence/internal/requestid"
+)
+
+// AnnotationStore stores the annotations trusted services attach to users
+type AnnotationStore interface {
+	Set(ctx context.Context, userID, namespace string, values map[string]string) error
+	Clear(ctx context.Context, userID, namespace string) error
+}
+
+// SetAnnotationsRequest is the body of PUT
+// /api/v2/presence/{user_id}/annotations/{namespace}
+type SetAnnotationsRequest struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// AnnotationsResponse answers annotation writes with the namespace's
+// annotations as stored
+type AnnotationsResponse struct {
+	Success bool              `json:"success"`
+	Data    map[string]string `json:"data,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// WithAnnotations serves the annotation routes from store
+func WithAnnotations(store AnnotationStore) Option {
+	return func(h *PresenceHandler) { h.annotations = store }
+}
+
+// SetAnnotations handles PUT /api/v2/presence/{user_id}/annotations/{namespace},
+// replacing the user's annotations in the namespace; an empty set clears
+// them. The caller needs the namespace's scope, annotations.Scope(namespace),
+// and every write is recorded in the audit log.
+func (h *PresenceHandler) SetAnnotations(w http.ResponseWriter, r *http.Request) {
+	userID, namespace, ok := h.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+	var req SetAnnotationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AnnotationsResponse{Error: "invalid JSON body"})
+		return
+	}
+	err := h.annotations.Set(r.Context(), h.storeID(userID), namespace, req.Annotations)
+	h.auditAnnotations(r, userID, namespace, len(req.Annotations), err)
+	if err != nil {
+		writeAnnotationError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, AnnotationsResponse{Success: true, Data: req.Annotations})
+}
+
+// ClearAnnotations handles DELETE /api/v2/presence/{user_id}/annotations/{namespace}
+func (h *PresenceHandler) ClearAnnotations(w http.ResponseWriter, r *http.Request) {
+	userID, namespace, ok := h.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+	err := h.annotations.Clear(r.Context(), h.storeID(userID), namespace)
+	h.auditAnnotations(r, userID, namespace, 0, err)
+	if err != nil {
+		writeAnnotationError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, AnnotationsResponse{Success: true})
+}
+
+// annotationTarget checks that the caller may write the route's namespace
+func (h *PresenceHandler) annotationTarget(w http.ResponseWriter, r *http.Request) (userID, namespace string, ok bool) {
+	if h.annotations == nil {
+		writeJSON(w, http.StatusNotFound, AnnotationsResponse{Error: "annotations are disabled"})
+		return "", "", false
+	}
+	vars := mux.Vars(r)
+	userID, namespace = vars["user_id"], vars["namespace"]
+	if userID == "" || namespace == "" {
+		writeJSON(w, http.StatusBadRequest, AnnotationsResponse{Error: "user_id and namespace are required"})
+		return "", "", false
+	}
+	if auth.GetUserIDFromContext(r.Context()) == "" {
+		writeJSON(w, http.StatusUnauthorized, AnnotationsResponse{Error: "authentication required"})
+		return "", "", false
+	}
+	if !auth.HasScope(r.Context(), annotations.Scope(namespace)) {
+		writeJSON(w, http.StatusForbidden, AnnotationsResponse{Error: "missing required scope \"" + annotations.Scope(namespace) + "\""})
+		return "", "", false
+	}
+	return userID, namespace, true
+}
+
+func (h *PresenceHandler) auditAnnotations(r *http.Request, userID, namespace string, keys int, err error) {
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "presence annotations written",
+		slog.String("audit", "presence.annotations"),
+		slog.String("service", auth.GetUserIDFromContext(r.Context())),
+		slog.String("user_id", userID),
+		slog.String("namespace", namespace),
+		slog.Int("keys", keys),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+		slog.Bool("success", err == nil),
+	)
+}
+
+func writeAnnotationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, annotations.ErrUnknownNamespace):
+		writeJSON(w, http.StatusNotFound, AnnotationsResponse{Error: err.Error()})
+	case errors.Is(err, annotations.ErrInvalid):
+		writeJSON(w, http.StatusBadRequest, AnnotationsResponse{Error: err.Error()})
+	default:
+		writeStoreError(w, r, err, CodeAnnotationsFailed)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/annotations"
+	"gopresence/internal/auth"
+)
+
+// annotationLog is an AnnotationStore that records what it was asked to store
+type annotationLog map[string]map[string]string
+
+func (l annotationLog) Set(_ context.Context, userID, namespace string, values map[string]string) error {
+	if namespace != "pager" {
+		return fmt.Errorf("%w %q", annotations.ErrUnknownNamespace, namespace)
+	}
+	if len(values) > 2 {
+		return fmt.Errorf("%w: too many", annotations.ErrInvalid)
+	}
+	l[namespace+"/"+userID] = values
+	return nil
+}
+
+func (l annotationLog) Clear(_ context.Context, userID, namespace string) error {
+	delete(l, namespace+"/"+userID)
+	return nil
+}
+
+func TestAnnotations(t *testing.T) {
+	store := annotationLog{}
+	var audit bytes.Buffer
+	h := NewPresenceHandler(newMockPresenceService(), WithAnnotations(store), WithAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil))))
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}/annotations/{namespace}", h.SetAnnotations).Methods(http.MethodPut)
+	r.HandleFunc("/api/v2/presence/{user_id}/annotations/{namespace}", h.ClearAnnotations).Methods(http.MethodDelete)
+
+	call := func(method, namespace, body string, scopes ...string) int {
+		req := httptest.NewRequest(method, "/api/v2/presence/alice/annotations/"+namespace, strings.NewReader(body))
+		req = req.WithContext(auth.SetScopesInContext(auth.SetUserIDInContext(req.Context(), "pager-bridge"), scopes))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call(http.MethodPut, "pager", `{"annotations":{"on-call":"true"}}`, annotations.Scope("pager")); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if store["pager/alice"]["on-call"] != "true" {
+		t.Fatalf("expected the annotations to be stored, got %v", store)
+	}
+	if !strings.Contains(audit.String(), `"service":"pager-bridge"`) {
+		t.Fatalf("expected an audit record naming the service, got %q", audit.String())
+	}
+
+	for _, tc := range []struct {
+		namespace, body string
+		scopes          []string
+		want            int
+	}{
+		{"pager", `{"annotations":{"on-call":"false"}}`, []string{annotations.Scope("ci")}, http.StatusForbidden},
+		{"pager", `{"annotations":{"on-call":"false"}}`, []string{auth.ScopeAdmin}, http.StatusForbidden},
+		{"pager", `{"annotations":{"a":"1","b":"2","c":"3"}}`, []string{annotations.Scope("pager")}, http.StatusBadRequest},
+		{"pager", `not json`, []string{annotations.Scope("pager")}, http.StatusBadRequest},
+		{"hr", `{"annotations":{"a":"1"}}`, []string{annotations.Scope("hr")}, http.StatusNotFound},
+	} {
+		if code := call(http.MethodPut, tc.namespace, tc.body, tc.scopes...); code != tc.want {
+			t.Errorf("%s %s %v: expected %d, got %d", tc.namespace, tc.body, tc.scopes, tc.want, code)
+		}
+	}
+	if store["pager/alice"]["on-call"] != "true" {
+		t.Fatalf("expected rejected writes to leave the annotations, got %v", store)
+	}
+
+	if code := call(http.MethodDelete, "pager", "", annotations.Scope("pager")); code != http.StatusOK || store["pager/alice"] != nil {
+		t.Fatalf("expected the annotations to be cleared, got %d %v", code, store)
+	}
+
+	rr := httptest.NewRecorder()
+	NewPresenceHandler(newMockPresenceService()).SetAnnotations(rr, httptest.NewRequest(http.MethodPut, "/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with annotations disabled, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	"gopresence/internal/requestid"
+)
+
+// MaxBackfillEvents caps the events of one backfill call
+const MaxBackfillEvents = 1000
+
+// HistoryBackfiller publishes changes from another system's history to the
+// streams of event sinks, without touching current presences
+type HistoryBackfiller interface {
+	// Sinks returns the names of the sinks that can be backfilled
+	Sinks() []string
+	// Backfill publishes evs to the sink's stream in order and returns how
+	// many were stored
+	Backfill(ctx context.Context, sink string, evs []events.Event) (int, error)
+}
+
+// BackfillEvent is one historical status change of a user
+type BackfillEvent struct {
+	UserID     string                `json:"user_id"`
+	Status     models.PresenceStatus `json:"status"`
+	Message    string                `json:"message,omitempty"`
+	OccurredAt time.Time             `json:"occurred_at"`
+}
+
+// BackfillRequest is the history a backfill call publishes to one sink
+type BackfillRequest struct {
+	Sink   string          `json:"sink"`
+	Events []BackfillEvent `json:"events"`
+}
+
+// BackfillResponse reports how many events a backfill call published, or on
+// a dry run would have
+type BackfillResponse struct {
+	Success   bool   `json:"success"`
+	DryRun    bool   `json:"dry_run,omitempty"`
+	Sink      string `json:"sink"`
+	Published int    `json:"published"`
+}
+
+// WithBackfiller lets admins backfill history into the streams of b's sinks
+func WithBackfiller(b HistoryBackfiller) Option {
+	return func(h *PresenceHandler) { h.backfiller = b }
+}
+
+// Backfill handles POST /api/v2/admin/history/backfill, publishing status
+// changes recorded by a legacy system, with their original times, to the
+// stream of an at-least-once NATS event sink. The changes are published as
+// presence.updated events with source=sync and no revision, oldest first.
+// They never reach the bucket, so current presences, watchers and the other
+// sinks are left alone. Every change must be older than the user's current
+// presence, if any, so a consumer taking the newest event per user as the
+// current state is never misled; one that isn't fails the whole call. With
+// ?dry_run=true the changes are checked but not published. Like the admin
+// routes, it needs the admin scope, and every call is recorded in the audit
+// log.
+func (h *PresenceHandler) Backfill(w http.ResponseWriter, r *http.Request) {
+	admin := auth.GetUserIDFromContext(r.Context())
+	if admin == "" || !auth.HasScope(r.Context(), auth.ScopeAdmin) {
+		writeErrorResponse(w, r, http.StatusForbidden, CodeAdminScopeRequired)
+		return
+	}
+	if h.backfiller == nil {
+		writeErrorResponse(w, r, http.StatusNotImplemented, CodeBackfillUnavailable)
+		return
+	}
+	dry, err := parseDryRun(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	var req BackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return
+	}
+	if !slices.Contains(h.backfiller.Sinks(), req.Sink) {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUnknownBackfillSink, req.Sink)
+		return
+	}
+	if len(req.Events) == 0 {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeEventsRequired)
+		return
+	}
+	if len(req.Events) > MaxBackfillEvents {
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, CodeBatchTooLarge, MaxBackfillEvents)
+		return
+	}
+	now := time.Now().UTC()
+	users := make(map[string]bool)
+	for i, ev := range req.Events {
+		switch {
+		case !validKeyID(ev.UserID):
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidUserID)
+			return
+		case !ev.Status.IsValid():
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidStatus)
+			return
+		case ev.OccurredAt.IsZero() || ev.OccurredAt.After(now):
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidOccurredAt, i)
+			return
+		}
+		users[ev.UserID] = true
+	}
+
+	// History must end before the current state begins
+	userIDs := make([]string, 0, len(users))
+	for userID := range users {
+		userIDs = append(userIDs, userID)
+	}
+	current, _, err := h.getMultiple(r.Context(), userIDs, 0)
+	if err != nil {
+		writeStoreError(w, r, err, CodeGetMultipleFailed)
+		return
+	}
+	for _, ev := range req.Events {
+		if p, ok := current[ev.UserID]; ok && !ev.OccurredAt.Before(p.UpdatedAt) {
+			writeErrorResponse(w, r, http.StatusConflict, CodeBackfillAfterCurrent, ev.UserID, ev.OccurredAt.Format(time.RFC3339Nano))
+			return
+		}
+	}
+
+	sort.SliceStable(req.Events, func(i, j int) bool { return req.Events[i].OccurredAt.Before(req.Events[j].OccurredAt) })
+	evs := make([]events.Event, len(req.Events))
+	for i, ev := range req.Events {
+		at := ev.OccurredAt.UTC()
+		presence := models.Presence{
+			UserID:    h.storeID(ev.UserID),
+			Status:    ev.Status,
+			Message:   ev.Message,
+			LastSeen:  at,
+			UpdatedAt: at,
+			NodeID:    h.node.ID,
+			Source:    models.SourceSync,
+		}
+		evs[i] = events.Event{Type: events.EventUpdated, UserID: presence.UserID, Presence: &presence, Timestamp: now, RequestID: requestid.FromContext(r.Context())}
+	}
+
+	resp := BackfillResponse{DryRun: dry, Sink: req.Sink, Published: len(evs)}
+	if !dry {
+		resp.Published, err = h.backfiller.Backfill(r.Context(), req.Sink, evs)
+		h.audit.LogAttrs(r.Context(), slog.LevelInfo, "history backfill",
+			slog.String("audit", "history.backfill"),
+			slog.String("admin", admin),
+			slog.String("sink", req.Sink),
+			slog.Int("events", len(evs)),
+			slog.Int("published", resp.Published),
+			slog.String("request_id", requestid.FromContext(r.Context())),
+			slog.Bool("success", err == nil),
+		)
+		if err != nil {
+			status, e := storeErrorStatus(err, CodeBackfillFailed)
+			if e.Code == CodeBackfillFailed {
+				e.Args = []any{resp.Published}
+			}
+			writeErrorResponse(w, r, status, e.Code, e.Args...)
+			return
+		}
+	}
+	resp.Success = true
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+// fakeBackfiller records the events backfilled into its one sink
+type fakeBackfiller struct {
+	published []events.Event
+	err       error
+}
+
+func (f *fakeBackfiller) Sinks() []string { return []string{"history"} }
+
+func (f *fakeBackfiller) Backfill(ctx context.Context, sink string, evs []events.Event) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.published = append(f.published, evs...)
+	return len(evs), nil
+}
+
+func backfillRequest(h *PresenceHandler, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/admin/history/backfill"+query, strings.NewReader(body))
+	ctx := auth.SetScopesInContext(auth.SetUserIDInContext(req.Context(), "ops"), []string{auth.ScopeAdmin})
+	rr := httptest.NewRecorder()
+	h.Backfill(rr, req.WithContext(ctx))
+	return rr
+}
+
+func TestBackfill(t *testing.T) {
+	svc := newMockPresenceService()
+	now := time.Now().UTC()
+	svc.presences["alice"] = models.Presence{UserID: "alice", Status: models.StatusOnline, UpdatedAt: now.Add(-time.Minute)}
+	fb := &fakeBackfiller{}
+	var audit bytes.Buffer
+	h := NewPresenceHandler(svc, WithBackfiller(fb), WithAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil))))
+
+	at := func(d time.Duration) string { return now.Add(-d).Format(time.RFC3339Nano) }
+	body := `{"sink":"history","events":[` +
+		`{"user_id":"alice","status":"away","occurred_at":"` + at(time.Hour) + `"},` +
+		`{"user_id":"alice","status":"online","message":"back","occurred_at":"` + at(2*time.Hour) + `"},` +
+		`{"user_id":"bob","status":"busy","occurred_at":"` + at(time.Hour) + `"}]}`
+
+	rr := backfillRequest(h, "?dry_run=true", body)
+	if rr.Code != http.StatusOK || len(fb.published) != 0 || audit.Len() != 0 {
+		t.Fatalf("dry run must only validate, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = backfillRequest(h, "", body)
+	var resp BackfillResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK || !resp.Success || resp.Published != 3 {
+		t.Fatalf("expected 3 events published, got %d: %s", rr.Code, rr.Body.String())
+	}
+	first := fb.published[0]
+	if first.Type != events.EventUpdated || first.Presence.Message != "back" || first.Presence.Source != models.SourceSync || !first.Presence.UpdatedAt.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("expected the oldest change first with its original time, got %+v", first.Presence)
+	}
+	if svc.presences["alice"].Status != models.StatusOnline || len(svc.presences) != 1 {
+		t.Fatalf("backfill must not change current presences, got %+v", svc.presences)
+	}
+	if !strings.Contains(audit.String(), `"audit":"history.backfill"`) {
+		t.Fatalf("expected an audit record, got %s", audit.String())
+	}
+}
+
+func TestBackfill_Rejects(t *testing.T) {
+	svc := newMockPresenceService()
+	now := time.Now().UTC()
+	svc.presences["alice"] = models.Presence{UserID: "alice", Status: models.StatusOnline, UpdatedAt: now.Add(-time.Hour)}
+	fb := &fakeBackfiller{}
+	h := NewPresenceHandler(svc, WithBackfiller(fb))
+	event := func(userID, status string, at time.Time) string {
+		return `{"sink":"history","events":[{"user_id":"` + userID + `","status":"` + status + `","occurred_at":"` + at.Format(time.RFC3339Nano) + `"}]}`
+	}
+
+	for name, tc := range map[string]struct {
+		body   string
+		status int
+		code   string
+	}{
+		"unknown sink":  {`{"sink":"audit","events":[]}`, http.StatusBadRequest, CodeUnknownBackfillSink},
+		"no events":     {`{"sink":"history","events":[]}`, http.StatusBadRequest, CodeEventsRequired},
+		"bad status":    {event("bob", "asleep", now.Add(-time.Hour)), http.StatusBadRequest, CodeInvalidStatus},
+		"future":        {event("bob", "away", now.Add(time.Hour)), http.StatusBadRequest, CodeInvalidOccurredAt},
+		"after current": {event("alice", "away", now.Add(-time.Minute)), http.StatusConflict, CodeBackfillAfterCurrent},
+		"bad user id":   {event("a b", "away", now.Add(-time.Hour)), http.StatusBadRequest, CodeInvalidUserID},
+	} {
+		rr := backfillRequest(h, "", tc.body)
+		if rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Errorf("%s: expected %d %s, got %d: %s", name, tc.status, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+	if len(fb.published) != 0 {
+		t.Fatalf("rejected calls must not publish, got %d events", len(fb.published))
+	}
+
+	fb.err = errors.New("stream unavailable")
+	if rr := backfillRequest(h, "", event("bob", "away", now.Add(-time.Hour))); rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), CodeBackfillFailed) {
+		t.Fatalf("expected a failed backfill, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := backfillRequest(NewPresenceHandler(svc), "", event("bob", "away", now.Add(-time.Hour))); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without a backfiller, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopresence/internal/models"
+)
+
+// OrderRequest is the ?order= value that returns a multi-user read as an
+// array in request order
+const OrderRequest = "request"
+
+// OrderedPresenceResponse is a multi-user read in request order: one entry
+// per distinct known user, in the order the IDs were first requested
+type OrderedPresenceResponse struct {
+	Success bool              `json:"success"`
+	Data    []models.Presence `json:"data"`
+	Error   string            `json:"error,omitempty"`
+	Meta    *models.BatchMeta `json:"meta,omitempty"`
+}
+
+// normalizeUserIDs drops invalid and repeated IDs, keeping the first
+// occurrence of each in request order. IDs must be valid store keys unless
+// they are pseudonymized first, in which case only empty IDs are invalid.
+func normalizeUserIDs(userIDs []string, pseudonymized bool) ([]string, models.BatchMeta) {
+	meta := models.BatchMeta{Requested: len(userIDs)}
+	seen := make(map[string]struct{}, len(userIDs))
+	ids := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id == "" || (!pseudonymized && !validKeyID(id)) {
+			meta.Invalid++
+			continue
+		}
+		if _, dup := seen[id]; dup {
+			meta.Deduplicated++
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	return ids, meta
+}
+
+// validKeyID reports whether id can be part of a KV key: the characters
+// [-/_=.a-zA-Z0-9], without empty dot-separated tokens
+func validKeyID(id string) bool {
+	if strings.HasPrefix(id, ".") || strings.HasSuffix(id, ".") || strings.Contains(id, "..") {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-/_=.", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// setBatchMeta reports skipped IDs in headers, which every encoding of a
+// multi-user read carries, and returns meta for the JSON envelope if any
+// were skipped
+func setBatchMeta(w http.ResponseWriter, meta models.BatchMeta) *models.BatchMeta {
+	if meta.Deduplicated == 0 && meta.Invalid == 0 {
+		return nil
+	}
+	w.Header().Set("X-Deduplicated-IDs", strconv.Itoa(meta.Deduplicated))
+	w.Header().Set("X-Invalid-IDs", strconv.Itoa(meta.Invalid))
+	return &meta
+}
+
+// orderedResponse lists presences in the order of userIDs
+func orderedResponse(userIDs []string, presences map[string]models.Presence, meta *models.BatchMeta) OrderedPresenceResponse {
+	out := OrderedPresenceResponse{Success: true, Data: make([]models.Presence, 0, len(presences)), Meta: meta}
+	for _, userID := range userIDs {
+		if presence, ok := presences[userID]; ok {
+			presence.UserID = userID
+			out.Data = append(out.Data, presence)
+		}
+	}
+	return out
+}
+
+// parseOrder reads ?order=, which is empty or OrderRequest
+func parseOrder(r *http.Request) (string, bool) {
+	order := r.URL.Query().Get("order")
+	return order, order == "" || order == OrderRequest
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopresence/internal/models"
+)
+
+func TestNormalizeUserIDs(t *testing.T) {
+	ids, meta := normalizeUserIDs([]string{"b", "a", "", "b", "a@x", ".a", "c.d", "b"}, false)
+	if strings.Join(ids, ",") != "b,a,c.d" {
+		t.Fatalf("unexpected IDs %v", ids)
+	}
+	if meta != (models.BatchMeta{Requested: 8, Deduplicated: 2, Invalid: 3}) {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+
+	// Pseudonymized IDs never reach the store as-is
+	ids, meta = normalizeUserIDs([]string{"a@x", "", "a@x"}, true)
+	if len(ids) != 1 || meta.Invalid != 1 || meta.Deduplicated != 1 {
+		t.Fatalf("unexpected result %v %+v", ids, meta)
+	}
+}
+
+func TestGetMultiplePresences_RequestOrder(t *testing.T) {
+	svc := newMockPresenceService()
+	for _, id := range []string{"u1", "u2", "u3"} {
+		svc.presences[id] = models.Presence{UserID: id, Status: models.StatusOnline}
+	}
+	h := NewPresenceHandler(svc)
+
+	req := httptest.NewRequest("GET", "/api/v2/presence?users=u3,u9,u1,u3,bad%20id&order=request", nil)
+	rr := httptest.NewRecorder()
+	h.GetMultiplePresences(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp OrderedPresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].UserID != "u3" || resp.Data[1].UserID != "u1" {
+		t.Fatalf("expected u3, u1 in request order, got %+v", resp.Data)
+	}
+	if resp.Meta == nil || *resp.Meta != (models.BatchMeta{Requested: 5, Deduplicated: 1, Invalid: 1}) {
+		t.Fatalf("unexpected meta %+v", resp.Meta)
+	}
+
+	// The default map shape reports the same counts
+	req = httptest.NewRequest("GET", "/api/v2/presence?users=u1,u1", nil)
+	rr = httptest.NewRecorder()
+	h.GetMultiplePresences(rr, req)
+	var m models.PresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil || m.Meta == nil || m.Meta.Deduplicated != 1 {
+		t.Fatalf("expected deduplicated count in meta, got %s", rr.Body.String())
+	}
+
+	for _, q := range []string{"users=u1&order=sorted", "users=,%20"} {
+		rr = httptest.NewRecorder()
+		h.GetMultiplePresences(rr, httptest.NewRequest("GET", "/api/v2/presence?"+q, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/i18n"
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+)
+
+// MaxBatchSetItems caps the number of presences one batch-set call writes
+const MaxBatchSetItems = 500
+
+// BatchSetItem is one presence write of a batch-set call
+type BatchSetItem struct {
+	UserID string `json:"user_id"`
+	SetPresenceRequest
+}
+
+// BatchSetRequest represents the request body for batch presence writes
+type BatchSetRequest struct {
+	Presences []BatchSetItem `json:"presences"`
+}
+
+// BatchSetResult is the outcome of one batch-set item. Status is the HTTP
+// status the same write would have been answered with on its own.
+type BatchSetResult struct {
+	UserID   string           `json:"user_id"`
+	Success  bool             `json:"success"`
+	Status   int              `json:"status"`
+	Presence *models.Presence `json:"presence,omitempty"`
+	Previous *models.Presence `json:"previous,omitempty"` // Current presence, on dry runs
+	Changes  []string         `json:"changes,omitempty"`  // Fields the write would change, on dry runs
+	Error    string           `json:"error,omitempty"`
+	Code     string           `json:"code,omitempty"`
+}
+
+// BatchSetResponse lists the batch-set results in request order. Success is
+// true only if every item was written, or on a dry run would have been.
+type BatchSetResponse struct {
+	Success   bool             `json:"success"`
+	DryRun    bool             `json:"dry_run,omitempty"`
+	Results   []BatchSetResult `json:"results"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+// BatchSetPresence handles POST /api/v2/presence/batch-set. Items are
+// written in order, each on its own: a failed item doesn't stop the rest.
+// With ?dry_run=true every item is checked and answered but none is stored.
+func (h *PresenceHandler) BatchSetPresence(w http.ResponseWriter, r *http.Request) {
+	dry, err := parseDryRun(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	var req BatchSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return
+	}
+	if len(req.Presences) == 0 {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodePresencesRequired)
+		return
+	}
+	if len(req.Presences) > MaxBatchSetItems {
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, CodeBatchTooLarge, MaxBatchSetItems)
+		return
+	}
+	metrics.ObserveBatchSize(r.Context(), len(req.Presences))
+
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	resp := BatchSetResponse{DryRun: dry, Results: make([]BatchSetResult, 0, len(req.Presences))}
+	for _, item := range req.Presences {
+		res, failure := h.batchSetItem(r, item, dry)
+		if failure != nil {
+			res.Code, res.Error = failure.Code, i18n.Message(lang, failure.Code, failure.Args...)
+		}
+		if res.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	if resp.Failed > 0 {
+		i18n.SetContentLanguage(w, lang)
+	}
+	resp.Success = resp.Failed == 0
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// batchSetItem writes one batch-set item, or only checks it on a dry run,
+// returning the error of a failed one for the caller to localize
+func (h *PresenceHandler) batchSetItem(r *http.Request, item BatchSetItem, dry bool) (BatchSetResult, *i18n.Error) {
+	res := BatchSetResult{UserID: item.UserID, Status: http.StatusBadRequest}
+	switch {
+	case item.UserID == "" || (h.pseudonymizer == nil && !validKeyID(item.UserID)):
+		return res, i18n.Errorf(CodeInvalidUserID)
+	case !item.Status.IsValid():
+		return res, i18n.Errorf(CodeInvalidStatus)
+	case !validTTL(item.TTL):
+		return res, i18n.Errorf(CodeInvalidTTL)
+	}
+	if err := validateClient(item.Client); err != nil {
+		return res, err
+	}
+	if err := models.ValidateTimeZone(item.TimeZone); err != nil {
+		return res, i18n.Errorf(CodeInvalidTimeZone, item.TimeZone)
+	}
+	if err := models.ValidateCorrelationID(item.CorrelationID); err != nil {
+		return res, i18n.Errorf(CodeInvalidCorrelationID, models.MaxCorrelationIDLength)
+	}
+
+	presence := h.newPresence(item.UserID, item.SetPresenceRequest, models.SourceAPI)
+	if dry {
+		next, previous, err := h.dryRun(r.Context(), presence)
+		if err != nil {
+			var failure *i18n.Error
+			res.Status, failure = storeErrorStatus(err, CodeSetFailed)
+			return res, failure
+		}
+		res.Changes = presenceChanges(previous, next)
+		next.UserID = item.UserID
+		if previous != nil {
+			previous.UserID = item.UserID
+		}
+		res.Success, res.Status, res.Presence, res.Previous = true, http.StatusOK, &next, previous
+		return res, nil
+	}
+	if err := h.service.SetPresence(r.Context(), presence.UserID, presence); err != nil {
+		var failure *i18n.Error
+		res.Status, failure = storeErrorStatus(err, CodeSetFailed)
+		return res, failure
+	}
+	presence.UserID = item.UserID
+	res.Success, res.Status, res.Presence = true, http.StatusOK, &presence
+	return res, nil
+}
+
+// storeErrorStatus maps a failed write to the status and error
+// writeStoreError would answer with; code reports other failures
+func storeErrorStatus(err error, code string) (int, *i18n.Error) {
+	var transition *apperrors.TransitionError
+	switch {
+	case errors.As(err, &transition):
+		return http.StatusConflict, i18n.Errorf(CodeInvalidTransition, transition.UserID, transition.From, transition.To)
+	case apperrors.IsRevisionMismatch(err):
+		return http.StatusPreconditionFailed, i18n.Errorf(CodePresenceModified)
+	case apperrors.IsTimeout(err):
+		return http.StatusGatewayTimeout, i18n.Errorf(CodeStoreTimeout)
+	}
+	return http.StatusInternalServerError, i18n.Errorf(code)
+}
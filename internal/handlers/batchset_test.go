@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+type transitionService struct{ *mockPresenceService }
+
+func (s transitionService) SetPresence(ctx context.Context, userID string, p models.Presence) error {
+	if p.Status == models.StatusBusy {
+		return &apperrors.TransitionError{UserID: userID, From: "offline", To: string(p.Status)}
+	}
+	return s.mockPresenceService.SetPresence(ctx, userID, p)
+}
+
+func (s transitionService) CheckPresence(ctx context.Context, userID string, p models.Presence) (models.Presence, error) {
+	if p.Status == models.StatusBusy {
+		return models.Presence{}, &apperrors.TransitionError{UserID: userID, From: "offline", To: string(p.Status)}
+	}
+	return p, nil
+}
+
+func TestBatchSetPresence(t *testing.T) {
+	svc := transitionService{newMockPresenceService()}
+	h := NewPresenceHandler(svc)
+
+	body := `{"presences":[
+		{"user_id":"u1","status":"online","message":"hi","ttl":60},
+		{"user_id":"u2","status":"sleeping"},
+		{"user_id":"u3","status":"busy"},
+		{"user_id":"bad id","status":"away"}
+	]}`
+	rr := httptest.NewRecorder()
+	h.BatchSetPresence(rr, httptest.NewRequest(http.MethodPost, "/api/v2/presence/batch-set", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	var resp BatchSetResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Success || resp.Succeeded != 1 || resp.Failed != 3 || len(resp.Results) != 4 {
+		t.Fatalf("unexpected summary: %+v", resp)
+	}
+	want := []int{http.StatusOK, http.StatusBadRequest, http.StatusConflict, http.StatusBadRequest}
+	for i, res := range resp.Results {
+		if res.Status != want[i] || res.Success != (want[i] == http.StatusOK) {
+			t.Errorf("result %d: expected status %d, got %+v", i, want[i], res)
+		}
+	}
+	if resp.Results[1].Code != CodeInvalidStatus || resp.Results[2].Code != CodeInvalidTransition || resp.Results[3].Code != CodeInvalidUserID {
+		t.Fatalf("expected the failures' codes, got %+v", resp.Results)
+	}
+	if resp.Results[2].Error != "status of user u3 cannot change from offline to busy" {
+		t.Fatalf("unexpected transition message %q", resp.Results[2].Error)
+	}
+	if p := resp.Results[0].Presence; p == nil || p.UserID != "u1" || p.Message != "hi" {
+		t.Fatalf("expected the stored presence of u1, got %+v", p)
+	}
+	if p, ok := svc.presences["u1"]; !ok || p.TTL.Seconds() != 60 || p.Source != models.SourceAPI {
+		t.Fatalf("expected u1 written with its TTL, got %+v", p)
+	}
+	if len(svc.presences) != 1 {
+		t.Fatalf("expected only u1 to be written, got %v", svc.presences)
+	}
+}
+
+func TestBatchSetPresence_RejectsBadRequests(t *testing.T) {
+	h := NewPresenceHandler(newMockPresenceService())
+	items := make([]string, MaxBatchSetItems+1)
+	for i := range items {
+		items[i] = `{"user_id":"u","status":"online"}`
+	}
+	cases := map[string]int{
+		`{bad json`:        http.StatusBadRequest,
+		`{"presences":[]}`: http.StatusBadRequest,
+		`{"presences":[` + strings.Join(items, ",") + `]}`: http.StatusRequestEntityTooLarge,
+	}
+	for body, code := range cases {
+		rr := httptest.NewRecorder()
+		h.BatchSetPresence(rr, httptest.NewRequest(http.MethodPost, "/api/v2/presence/batch-set", strings.NewReader(body)))
+		if rr.Code != code {
+			t.Errorf("expected %d for %.40s, got %d", code, body, rr.Code)
+		}
+	}
+}
+
+func TestSetPresence_DryRun(t *testing.T) {
+	svc := transitionService{newMockPresenceService()}
+	svc.presences["u1"] = models.Presence{UserID: "u1", Status: models.StatusOnline, Message: "hi"}
+	h := NewPresenceHandler(svc)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/presence/{user_id}", h.SetPresence).Methods("PUT")
+	put := func(target, body string) (int, DryRunResponse) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, target, strings.NewReader(body)))
+		var resp DryRunResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	code, resp := put("/api/v2/presence/u1?dry_run=true", `{"status":"away","message":"hi"}`)
+	if code != http.StatusOK || !resp.DryRun || resp.Data["u1"].Status != models.StatusAway || resp.Previous["u1"].Status != models.StatusOnline {
+		t.Fatalf("unexpected dry run %d %+v", code, resp)
+	}
+	if len(resp.Changes) != 1 || resp.Changes[0] != "status" {
+		t.Fatalf("expected only the status to change, got %v", resp.Changes)
+	}
+	if svc.presences["u1"].Status != models.StatusOnline {
+		t.Fatalf("expected the dry run not to write, got %+v", svc.presences["u1"])
+	}
+	if _, resp := put("/api/v2/presence/u2?dry_run=1", `{"status":"online"}`); resp.Previous != nil || len(resp.Changes) != 1 {
+		t.Fatalf("expected a new presence without a previous one, got %+v", resp)
+	}
+	if code, _ := put("/api/v2/presence/u1?dry_run=maybe", `{"status":"away"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid dry_run, got %d", code)
+	}
+}
+
+func TestSetPresence_DryRunNegotiated(t *testing.T) {
+	svc := transitionService{newMockPresenceService()}
+	svc.presences["u1"] = models.Presence{UserID: "u1", Status: models.StatusOnline}
+	h := NewPresenceHandler(svc)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/presence/{user_id}", h.SetPresence).Methods("PUT")
+	put := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v2/presence/u1?dry_run=true", strings.NewReader(`{"status":"away"}`))
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := put("application/json; profile=flat")
+	var flat FlatPresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &flat); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rr.Body.String())
+	}
+	if rr.Code != http.StatusOK || !flat.DryRun || len(flat.Data) != 1 || flat.Data[0].Status != models.StatusAway {
+		t.Fatalf("expected a flat dry run, got %d %+v", rr.Code, flat)
+	}
+	if len(flat.Previous) != 1 || flat.Previous[0].Status != models.StatusOnline || len(flat.Changes) != 1 {
+		t.Fatalf("expected a flat previous presence and the changes, got %+v", flat)
+	}
+
+	if rr := put("application/x-protobuf"); rr.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406 for a protobuf dry run, got %d", rr.Code)
+	}
+	if rr := put("application/x-protobuf, application/json;q=0.5"); rr.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406 when protobuf is preferred, got %d", rr.Code)
+	}
+	if svc.presences["u1"].Status != models.StatusOnline {
+		t.Fatalf("expected the dry runs not to write, got %+v", svc.presences["u1"])
+	}
+}
+
+func TestBatchSetPresence_DryRun(t *testing.T) {
+	svc := transitionService{newMockPresenceService()}
+	h := NewPresenceHandler(svc)
+	body := `{"presences":[{"user_id":"u1","status":"online"},{"user_id":"u2","status":"busy"}]}`
+	rr := httptest.NewRecorder()
+	h.BatchSetPresence(rr, httptest.NewRequest(http.MethodPost, "/api/v2/presence/batch-set?dry_run=true", strings.NewReader(body)))
+	var resp BatchSetResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !resp.DryRun || resp.Succeeded != 1 || resp.Failed != 1 || resp.Results[1].Code != CodeInvalidTransition {
+		t.Fatalf("unexpected dry run summary: %+v", resp)
+	}
+	if p := resp.Results[0].Presence; p == nil || p.UserID != "u1" || len(resp.Results[0].Changes) != 1 {
+		t.Fatalf("expected the presence u1 would get, got %+v", resp.Results[0])
+	}
+	if len(svc.presences) != 0 {
+		t.Fatalf("expected the dry run not to write, got %+v", svc.presences)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/models"
+)
+
+func TestChangedSince_FiltersBatchReads(t *testing.T) {
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	svc := newMockPresenceService()
+	svc.presences["old"] = models.Presence{UserID: "old", Status: models.StatusOnline, UpdatedAt: base}
+	svc.presences["new"] = models.Presence{UserID: "new", Status: models.StatusAway, UpdatedAt: base.Add(time.Minute)}
+	h := NewPresenceHandler(svc)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence", h.GetMultiplePresences).Methods("GET")
+	r.HandleFunc("/api/v2/presence/batch", h.BatchPresence).Methods("POST")
+
+	decode := func(rr *httptest.ResponseRecorder) models.PresenceResponse {
+		var resp models.PresenceResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	// Query parameter on GET
+	since := base.Add(30 * time.Second).Format(time.RFC3339)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence?users=old,new&changed_since="+since, nil))
+	if resp := decode(rr); rr.Code != http.StatusOK || len(resp.Data) != 1 || resp.Data["new"].Status != models.StatusAway {
+		t.Fatalf("expected only the newer user, got %d %+v", rr.Code, resp)
+	}
+	if lm := rr.Header().Get("Last-Modified"); lm != base.Add(time.Minute).Format(http.TimeFormat) {
+		t.Fatalf("unexpected Last-Modified %q", lm)
+	}
+
+	// If-Modified-Since on batch POST
+	req := httptest.NewRequest("POST", "/api/v2/presence/batch", bytes.NewBufferString(`{"user_ids":["old","new"]}`))
+	req.Header.Set("If-Modified-Since", base.Format(http.TimeFormat))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if resp := decode(rr); rr.Code != http.StatusOK || len(resp.Data) != 1 {
+		t.Fatalf("expected one changed user, got %d %+v", rr.Code, resp)
+	}
+
+	// Nothing changed: 304 for the conditional header, empty data for the query form
+	req = httptest.NewRequest("POST", "/api/v2/presence/batch", bytes.NewBufferString(`{"user_ids":["old","new"]}`))
+	req.Header.Set("If-Modified-Since", base.Add(time.Hour).Format(http.TimeFormat))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Fatalf("expected 304 with empty body, got %d %q", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence?users=old,new&changed_since="+base.Add(time.Hour).Format(time.RFC3339), nil))
+	if resp := decode(rr); rr.Code != http.StatusOK || len(resp.Data) != 0 {
+		t.Fatalf("expected empty 200, got %d %+v", rr.Code, resp)
+	}
+
+	// Malformed timestamps are rejected
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence?users=old&changed_since=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+}
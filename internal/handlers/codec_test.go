@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/protobuf/proto"
+
+	"gopresence/internal/models"
+	presencev1 "gopresence/internal/pb/presence/v1"
+)
+
+func TestBinaryCodec_NegotiatedByAccept(t *testing.T) {
+	svc := newMockPresenceService()
+	svc.presences["u1"] = models.Presence{UserID: "u1", Status: models.StatusOnline, NodeID: "n1"}
+	h := NewPresenceHandler(svc)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/api/v2/presence/u1", nil)
+	req.Header.Set("Accept", "application/x-protobuf, application/json;q=0.5")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != presencev1.ContentTypeProtobuf {
+		t.Fatalf("expected protobuf response, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var resp presencev1.PresenceResponse
+	if err := proto.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !resp.GetSuccess() || resp.GetData()["u1"].GetStatus() != "online" {
+		t.Fatalf("unexpected response: %v", &resp)
+	}
+
+	// Errors use the same encoding
+	req = httptest.NewRequest("GET", "/api/v2/presence/missing", nil)
+	req.Header.Set("Accept", "application/x-protobuf")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	resp.Reset()
+	if err := proto.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusNotFound || resp.GetError() == "" {
+		t.Fatalf("expected protobuf 404 envelope, got %d %v %v", rr.Code, &resp, err)
+	}
+
+	// JSON remains the default
+	req = httptest.NewRequest("GET", "/api/v2/presence/u1", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected JSON by default, got %q", rr.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+// Error codes of presence API responses. Codes are stable; the messages
+// reported with them are localized by internal/i18n.
+const (
+	CodeUserIDRequired         = "user_id_required"
+	CodeInvalidUserID          = "invalid_user_id"
+	CodeInvalidJSON            = "invalid_json"
+	CodeInvalidStatus          = "invalid_status"
+	CodeInvalidTTL             = "invalid_ttl"
+	CodeInvalidClient          = "invalid_client"
+	CodeInvalidTimeZone        = "invalid_time_zone"
+	CodeInvalidCorrelationID   = "invalid_correlation_id"
+	CodeInvalidDryRun          = "invalid_dry_run"
+	CodeDryRunJSONOnly         = "dry_run_json_only"
+	CodeInvalidMaxStale        = "invalid_max_stale"
+	CodeInvalidChangedSince    = "invalid_changed_since"
+	CodeInvalidIfModifiedSince = "invalid_if_modified_since"
+	CodeInvalidIfMatch         = "invalid_if_match"
+	CodeInvalidOrder           = "invalid_order"
+	CodeInvalidCapability      = "invalid_capability"
+	CodeUsersRequired          = "users_required"
+	CodeUserIDsRequired        = "user_ids_required"
+	CodeNoValidUserIDs         = "no_valid_user_ids"
+	CodePresencesRequired      = "presences_required"
+	CodeNamespaceRequired      = "namespace_required"
+	CodeUserOutsideNamespace   = "user_outside_namespace"
+	CodeBatchTooLarge          = "batch_too_large"
+	CodeBatchOverBudget        = "batch_over_budget"
+	CodePresenceNotFound       = "presence_not_found"
+	CodePresenceModified       = "presence_modified"
+	CodeConditionalUnavailable = "conditional_write_unavailable"
+	CodePatchUnavailable       = "patch_unavailable"
+	CodeEmptyPatch             = "empty_patch"
+	CodeInvalidTransition      = "invalid_transition"
+	CodeStoreTimeout           = "store_timeout"
+	CodeGetFailed              = "get_failed"
+	CodeGetMultipleFailed      = "get_multiple_failed"
+	CodeSetFailed              = "set_failed"
+	CodeDeleteFailed           = "delete_failed"
+	CodeSnapshotFailed         = "snapshot_failed"
+	CodeAnnotationsFailed      = "annotations_failed"
+	CodeReconcileUnavailable   = "reconcile_unavailable"
+	CodeBackfillUnavailable    = "backfill_unavailable"
+	CodeUnknownBackfillSink    = "unknown_backfill_sink"
+	CodeEventsRequired         = "events_required"
+	CodeInvalidOccurredAt      = "invalid_occurred_at"
+	CodeBackfillAfterCurrent   = "backfill_after_current"
+	CodeBackfillFailed         = "backfill_failed"
+	CodeAuthenticationRequired = "authentication_required"
+	CodeAdminScopeRequired     = "admin_scope_required"
+	CodeInvalidLogLevel        = "invalid_log_level"
+	CodeInvalidDuration        = "invalid_duration"
+	CodeInvalidAuditMode       = "invalid_audit_mode"
+	CodeKeyAuditRunning        = "key_audit_running"
+)
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopresence/internal/i18n"
+	"gopresence/internal/models"
+)
+
+// ConditionalWriter is implemented by services that can write a presence
+// only while it is at a known revision, and report what they stored
+type ConditionalWriter interface {
+	// SetPresenceAtRevision writes presence, if revision is nonzero only while
+	// the user's entry is at that revision, and returns the stored presence
+	SetPresenceAtRevision(ctx context.Context, userID string, presence models.Presence, revision uint64) (models.Presence, error)
+}
+
+// setETag sets the ETag header to presence's store revision, if known
+func setETag(w http.ResponseWriter, presence models.Presence) {
+	if presence.Revision != 0 {
+		w.Header().Set("ETag", `"`+strconv.FormatUint(presence.Revision, 10)+`"`)
+	}
+}
+
+// parseIfMatch reads the If-Match header of a write: the ETag of the
+// presence the caller last read, or 0 if it sent none
+func parseIfMatch(r *http.Request) (uint64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" {
+		return 0, nil
+	}
+	unquoted, ok := strings.CutPrefix(v, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	revision, err := strconv.ParseUint(unquoted, 10, 64)
+	if !ok || !closed || err != nil || revision == 0 {
+		return 0, i18n.Errorf(CodeInvalidIfMatch, v)
+	}
+	return revision, nil
+}
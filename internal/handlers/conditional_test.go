@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// revisionService stores presences with a revision per write, like the KV
+// store, and rejects writes at a stale revision
+type revisionService struct {
+	*mockPresenceService
+	revision uint64
+}
+
+func (s *revisionService) SetPresenceAtRevision(ctx context.Context, userID string, presence models.Presence, revision uint64) (models.Presence, error) {
+	if current, ok := s.presences[userID]; revision != 0 && (!ok || current.Revision != revision) {
+		return models.Presence{}, apperrors.ErrRevisionMismatch
+	}
+	s.revision++
+	presence.Revision = s.revision
+	s.presences[userID] = presence
+	return presence, nil
+}
+
+func TestSetPresence_IfMatch(t *testing.T) {
+	svc := &revisionService{mockPresenceService: newMockPresenceService()}
+	h := NewPresenceHandler(svc)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods(http.MethodGet)
+	router.HandleFunc("/api/v2/presence/{user_id}", h.SetPresence).Methods(http.MethodPut)
+	put := func(query, ifMatch, status string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v2/presence/alice"+query, strings.NewReader(`{"status":"`+status+`"}`))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := put("", "", "online"); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected the write's ETag, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v2/presence/alice", nil))
+	if rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected the read's ETag, got %q", rr.Header().Get("ETag"))
+	}
+
+	// The laptop writes first; the phone, still at revision 1, is turned away
+	if rr := put("", `"1"`, "busy"); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the conditional write, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := put("?dry_run=true", `"1"`, "away"); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected a stale dry run rejected, got %d", rr.Code)
+	}
+	if rr := put("", `"1"`, "away"); rr.Code != http.StatusPreconditionFailed || !strings.Contains(rr.Body.String(), CodePresenceModified) {
+		t.Fatalf("expected 412, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if svc.presences["alice"].Status != models.StatusBusy {
+		t.Fatalf("expected the laptop's write kept, got %s", svc.presences["alice"].Status)
+	}
+
+	for _, v := range []string{"1", `W/"2"`, `"x"`, `"0"`} {
+		if rr := put("", v, "away"); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), CodeInvalidIfMatch) {
+			t.Errorf("If-Match %s: expected 400, got %d", v, rr.Code)
+		}
+	}
+
+	// Services that can't write conditionally refuse rather than ignore If-Match
+	plain := NewPresenceHandler(newMockPresenceService())
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/v2/presence/alice", strings.NewReader(`{"status":"online"}`)), map[string]string{"user_id": "alice"})
+	req.Header.Set("If-Match", `"1"`)
+	rr = httptest.NewRecorder()
+	plain.SetPresence(rr, req)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without conditional writes, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"gopresence/internal/nats"
+)
+
+// LagReporter reports the lag of the durable consumers of presence changes
+type LagReporter interface {
+	ConsumerLag(ctx context.Context) ([]nats.ConsumerLag, error)
+}
+
+// ConsumersResponse is the body of GET /api/v2/admin/consumers
+type ConsumersResponse struct {
+	Success   bool               `json:"success"`
+	Consumers []nats.ConsumerLag `json:"consumers,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// ConsumersHandler serves the lag of event consumers to operators
+type ConsumersHandler struct {
+	lag LagReporter
+}
+
+// NewConsumersHandler creates a new ConsumersHandler
+func NewConsumersHandler(lag LagReporter) *ConsumersHandler {
+	return &ConsumersHandler{lag: lag}
+}
+
+// Lag handles GET /api/v2/admin/consumers, listing every durable consumer
+// of presence changes, such as at-least-once event sinks, most behind
+// first. The route must be guarded by auth.RequireScope(auth.ScopeAdmin, ...).
+func (h *ConsumersHandler) Lag(w http.ResponseWriter, r *http.Request) {
+	lags, err := h.lag.ConsumerLag(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, ConsumersResponse{Error: "failed to read consumer lag"})
+		return
+	}
+	writeJSON(w, http.StatusOK, ConsumersResponse{Success: true, Consumers: lags})
+}
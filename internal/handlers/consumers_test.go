@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopresence/internal/nats"
+)
+
+type lagFunc func(ctx context.Context) ([]nats.ConsumerLag, error)
+
+func (f lagFunc) ConsumerLag(ctx context.Context) ([]nats.ConsumerLag, error) { return f(ctx) }
+
+func TestConsumersHandler_Lag(t *testing.T) {
+	h := NewConsumersHandler(lagFunc(func(ctx context.Context) ([]nats.ConsumerLag, error) {
+		return []nats.ConsumerLag{{Name: "sink_crm", Pending: 40, AckPending: 1, Lag: 41}}, nil
+	}))
+	rr := httptest.NewRecorder()
+	h.Lag(rr, httptest.NewRequest(http.MethodGet, "/api/v2/admin/consumers", nil))
+	var resp ConsumersResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", rr.Code, err)
+	}
+	if !resp.Success || len(resp.Consumers) != 1 || resp.Consumers[0].Name != "sink_crm" || resp.Consumers[0].Lag != 41 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	h = NewConsumersHandler(lagFunc(func(ctx context.Context) ([]nats.ConsumerLag, error) {
+		return nil, errors.New("no responders")
+	}))
+	rr = httptest.NewRecorder()
+	h.Lag(rr, httptest.NewRequest(http.MethodGet, "/api/v2/admin/consumers", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/contacts"
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+	"gopresence/internal/resultcache"
+)
+
+// ContactSource returns the user IDs of a user's contacts
+type ContactSource interface {
+	Contacts(ctx context.Context, userID string) ([]string, error)
+}
+
+// ContactsResponse is the body of GET /api/v2/presence/me/contacts
+type ContactsResponse struct {
+	Success bool                       `json:"success"`
+	Data    map[string]models.Presence `json:"data,omitempty"`
+	Counts  *ContactCounts             `json:"counts,omitempty"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+// ContactCounts rolls up the statuses of a contact list. Contacts without a
+// stored presence count as offline, so the counts always add up to Total.
+type ContactCounts struct {
+	Total    int                           `json:"total"`
+	ByStatus map[models.PresenceStatus]int `json:"by_status"`
+}
+
+// WithContacts serves GET /api/v2/presence/me/contacts from source
+func WithContacts(source ContactSource) Option {
+	return func(h *PresenceHandler) { h.contacts = source }
+}
+
+// WithResultCache reuses contacts responses from results, until a contact's
+// presence changes or the cache's window passes. Invalidating results on
+// watch events is up to the caller.
+func WithResultCache(results *resultcache.Cache) Option {
+	return func(h *PresenceHandler) { h.results = results }
+}
+
+// GetContacts handles GET /api/v2/presence/me/contacts: the presences of the
+// authenticated caller's contacts, looked up in the contact source, with
+// counts per status. Accepts ?max_stale= like the other multi-user reads.
+func (h *PresenceHandler) GetContacts(w http.ResponseWriter, r *http.Request) {
+	if h.contacts == nil {
+		writeJSON(w, http.StatusNotFound, ContactsResponse{Error: "contact lookups are disabled"})
+		return
+	}
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeJSON(w, http.StatusUnauthorized, ContactsResponse{Error: "authentication required"})
+		return
+	}
+	maxStale, err := parseMaxStale(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ContactsResponse{Error: err.Error()})
+		return
+	}
+
+	// Stale-tolerant reads are served from the node's cache anyway
+	useResults := h.results != nil && maxStale == 0
+	if useResults {
+		cached, ok := h.results.Get("contacts:" + userID)
+		metrics.ObserveResultCache(metrics.ResultCacheContacts, ok)
+		if ok {
+			writeJSON(w, http.StatusOK, cached)
+			return
+		}
+	}
+
+	list, err := h.contacts.Contacts(r.Context(), userID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "contact lookup failed", "user_id", userID, "error", err)
+		message := "contact lookup failed"
+		if errors.Is(err, contacts.ErrTooMany) {
+			message = "too many contacts"
+		}
+		writeJSON(w, http.StatusBadGateway, ContactsResponse{Error: message})
+		return
+	}
+	// The directory's invalid and repeated IDs are skipped and counted like
+	// a caller's; a list with contacts but none valid is refused
+	userIDs, meta := normalizeUserIDs(list, h.pseudonymizer != nil)
+	if len(list) > 0 && len(userIDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, ContactsResponse{Error: "no valid user IDs"})
+		return
+	}
+	skipped := setBatchMeta(w, meta)
+
+	presences := map[string]models.Presence{}
+	if len(userIDs) > 0 {
+		var age time.Duration
+		presences, age, err = h.getMultiple(r.Context(), userIDs, maxStale)
+		if err != nil {
+			writeStoreError(w, r, err, CodeGetMultipleFailed)
+			return
+		}
+		if maxStale > 0 {
+			setAge(w, age)
+		}
+	}
+	resp := ContactsResponse{Success: true, Data: presences, Counts: countStatuses(userIDs, presences)}
+	// A cached response would be served without the skipped-ID headers
+	if useResults && skipped == nil {
+		h.cacheContacts(userID, userIDs, resp)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// cacheContacts keeps the contacts response of userID until a contact's
+// presence changes or, since expiry emits no event, the first one lapses
+func (h *PresenceHandler) cacheContacts(userID string, contactIDs []string, resp ContactsResponse) {
+	var until time.Time
+	for _, p := range resp.Data {
+		if at := p.ExpiresAt(); !at.IsZero() && (until.IsZero() || at.Before(until)) {
+			until = at
+		}
+	}
+	members := make([]string, len(contactIDs))
+	for i, id := range contactIDs {
+		members[i] = h.storeID(id)
+	}
+	h.results.Set("contacts:"+userID, resp, until, members...)
+}
+
+// countStatuses counts userIDs by the status of their presence; the core
+// statuses are always present, custom ones only when in use
+func countStatuses(userIDs []string, presences map[string]models.Presence) *ContactCounts {
+	counts := &ContactCounts{Total: len(userIDs), ByStatus: map[models.PresenceStatus]int{
+		models.StatusOnline:  0,
+		models.StatusAway:    0,
+		models.StatusBusy:    0,
+		models.StatusOffline: 0,
+	}}
+	for _, userID := range userIDs {
+		if p, ok := presences[userID]; ok {
+			counts.ByStatus[p.Status]++
+		} else {
+			counts.ByStatus[models.StatusOffline]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/contacts"
+	"gopresence/internal/models"
+	"gopresence/internal/resultcache"
+)
+
+// contactBook is a ContactSource backed by a map
+type contactBook map[string][]string
+
+func (b contactBook) Contacts(_ context.Context, userID string) ([]string, error) {
+	if userID == "mallory" {
+		return nil, fmt.Errorf("%w: 9000 contacts", contacts.ErrTooMany)
+	}
+	return b[userID], nil
+}
+
+func TestGetContacts(t *testing.T) {
+	service := newMockPresenceService()
+	service.presences["bob"] = models.Presence{UserID: "bob", Status: models.StatusOnline}
+	service.presences["carol"] = models.Presence{UserID: "carol", Status: models.StatusBusy}
+	h := NewPresenceHandler(service, WithContacts(contactBook{"alice": {"bob", "carol", "dave", "bob"}, "eve": {"a b", ""}}))
+
+	get := func(userID string) (int, ContactsResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/presence/me/contacts", nil)
+		if userID != "" {
+			req = req.WithContext(auth.SetUserIDInContext(req.Context(), userID))
+		}
+		rr := httptest.NewRecorder()
+		h.GetContacts(rr, req)
+		var resp ContactsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid body %q", rr.Body.String())
+		}
+		return rr.Code, resp
+	}
+
+	code, resp := get("alice")
+	if code != http.StatusOK || len(resp.Data) != 2 || resp.Data["carol"].Status != models.StatusBusy {
+		t.Fatalf("unexpected response %d %+v", code, resp)
+	}
+	want := map[models.PresenceStatus]int{models.StatusOnline: 1, models.StatusAway: 0, models.StatusBusy: 1, models.StatusOffline: 1}
+	if resp.Counts.Total != 3 || fmt.Sprint(resp.Counts.ByStatus) != fmt.Sprint(want) {
+		t.Fatalf("unexpected counts %+v", resp.Counts)
+	}
+
+	if code, resp := get("nobody"); code != http.StatusOK || resp.Counts.Total != 0 || len(resp.Data) != 0 {
+		t.Fatalf("expected an empty contact list to succeed, got %d %+v", code, resp)
+	}
+	if code, resp := get("eve"); code != http.StatusBadRequest || resp.Error != "no valid user IDs" {
+		t.Fatalf("expected 400 for a contact list without valid IDs, got %d %+v", code, resp)
+	}
+	if code, _ := get(""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for anonymous callers, got %d", code)
+	}
+	if code, resp := get("mallory"); code != http.StatusBadGateway || resp.Error != "too many contacts" {
+		t.Fatalf("expected 502 for an oversized list, got %d %+v", code, resp)
+	}
+
+	rr := httptest.NewRecorder()
+	NewPresenceHandler(service).GetContacts(rr, httptest.NewRequest(http.MethodGet, "/api/v2/presence/me/contacts", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a contact source, got %d", rr.Code)
+	}
+}
+
+func TestGetContacts_ResultCache(t *testing.T) {
+	service := newMockPresenceService()
+	service.presences["bob"] = models.Presence{UserID: "bob", Status: models.StatusOnline}
+	results := resultcache.New(time.Minute)
+	h := NewPresenceHandler(service, WithContacts(contactBook{"alice": {"bob", "carol"}}), WithResultCache(results))
+	get := func() ContactsResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/presence/me/contacts", nil)
+		rr := httptest.NewRecorder()
+		h.GetContacts(rr, req.WithContext(auth.SetUserIDInContext(req.Context(), "alice")))
+		var resp ContactsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid body %q", rr.Body.String())
+		}
+		return resp
+	}
+
+	if resp := get(); resp.Counts.ByStatus[models.StatusOnline] != 1 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	// Within the window the computed response is reused
+	service.presences["carol"] = models.Presence{UserID: "carol", Status: models.StatusOnline}
+	if resp := get(); resp.Counts.ByStatus[models.StatusOnline] != 1 {
+		t.Fatalf("expected the cached response, got %+v", resp)
+	}
+	// A change to a contact's presence drops it
+	results.Invalidate("carol")
+	if resp := get(); resp.Counts.ByStatus[models.StatusOnline] != 2 {
+		t.Fatalf("expected a recomputed response after carol changed, got %+v", resp)
+	}
+}
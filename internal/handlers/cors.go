@@ -25,7 +25,7 @@ func loadCORSConfigFromEnv() CORSConfig {
 		}
 	}
 	origins := strings.Split(getEnvDefault("CORS_ALLOWED_ORIGINS", "*"), ",")
-	methods := strings.Split(getEnvDefault("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS"), ",")
+	methods := strings.Split(getEnvDefault("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"), ",")
 	headers := strings.Split(getEnvDefault("CORS_ALLOWED_HEADERS", "Authorization,Content-Type"), ",")
 	allowCreds := false
 	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
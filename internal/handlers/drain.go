@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/drain"
+	"gopresence/internal/requestid"
+)
+
+// NodeDrainer starts and reports an orderly drain of this node
+type NodeDrainer interface {
+	Start() bool
+	Status() drain.Status
+}
+
+// DrainResponse is the body of the /api/v2/admin/drain routes
+type DrainResponse struct {
+	Success bool `json:"success"`
+	drain.Status
+}
+
+// DrainHandler lets admins drain the node serving the request ahead of a
+// deploy. The node is named in X-Node-ID.
+type DrainHandler struct {
+	drainer NodeDrainer
+	audit   *slog.Logger
+}
+
+// NewDrainHandler creates a new DrainHandler; drains are recorded to audit,
+// slog's default logger if nil
+func NewDrainHandler(drainer NodeDrainer, audit *slog.Logger) *DrainHandler {
+	if audit == nil {
+		audit = slog.Default()
+	}
+	return &DrainHandler{drainer: drainer, audit: audit}
+}
+
+// Start handles POST /api/v2/admin/drain. The drain runs in the background
+// and the process exits once it completes; repeating the call reports the
+// drain already under way.
+func (h *DrainHandler) Start(w http.ResponseWriter, r *http.Request) {
+	started := h.drainer.Start()
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin node drain",
+		slog.String("audit", "node.drain"),
+		slog.String("admin", auth.GetUserIDFromContext(r.Context())),
+		slog.Bool("started", started),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+	)
+	writeJSON(w, http.StatusAccepted, DrainResponse{Success: true, Status: h.drainer.Status()})
+}
+
+// Status handles GET /api/v2/admin/drain
+func (h *DrainHandler) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, DrainResponse{Success: true, Status: h.drainer.Status()})
+}
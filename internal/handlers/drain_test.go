@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopresence/internal/drain"
+)
+
+func TestDrainHandler_StartAndStatus(t *testing.T) {
+	d := drain.New(0)
+	block := make(chan struct{})
+	d.Add("hold", func(context.Context) error { <-block; return nil })
+	defer close(block)
+	h := NewDrainHandler(d, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rr := httptest.NewRecorder()
+	h.Status(rr, httptest.NewRequest(http.MethodGet, "/api/v2/admin/drain", nil))
+	var resp DrainResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.State != drain.StateServing {
+		t.Fatalf("expected serving, got %s (%v)", rr.Body, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr = httptest.NewRecorder()
+		h.Start(rr, httptest.NewRequest(http.MethodPost, "/api/v2/admin/drain", nil))
+		resp = DrainResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusAccepted || resp.State != drain.StateDraining {
+			t.Fatalf("expected 202 draining, got %d %s", rr.Code, rr.Body)
+		}
+	}
+
+	// Readiness fails while the node drains
+	rr = httptest.NewRecorder()
+	NewHealthHandler(&okChecker{}, d).Readiness(rr, httptest.NewRequest(http.MethodGet, "/health/readiness", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/i18n"
+	"gopresence/internal/models"
+	presencev1 "gopresence/internal/pb/presence/v1"
+)
+
+// DryRunner is implemented by services that can check a presence write
+// without storing it
+type DryRunner interface {
+	// CheckPresence runs the checks of SetPresence and returns the presence
+	// it would store
+	CheckPresence(ctx context.Context, userID string, presence models.Presence) (models.Presence, error)
+}
+
+// DryRunResponse is the body of a dry-run write: the presence that would be
+// stored, the current one if any, and the fields the write would change
+type DryRunResponse struct {
+	Success  bool                       `json:"success"`
+	DryRun   bool                       `json:"dry_run"`
+	Data     map[string]models.Presence `json:"data"`
+	Previous map[string]models.Presence `json:"previous,omitempty"`
+	Changes  []string                   `json:"changes"`
+}
+
+// writeDryRun answers a dry-run write with resp, in the caller's response
+// profile shape if any, and reports whether it could. The protobuf envelope
+// has no room for previous and changes, so protobuf callers get 406.
+func writeDryRun(w http.ResponseWriter, r *http.Request, resp DryRunResponse) bool {
+	if presencev1.WantsProtobuf(r.Header.Get("Accept")) {
+		writeErrorResponse(w, r, http.StatusNotAcceptable, CodeDryRunJSONOnly)
+		return false
+	}
+	response := models.PresenceResponse{Success: resp.Success, Data: resp.Data, DryRun: resp.DryRun, Previous: resp.Previous, Changes: resp.Changes}
+	writeNegotiated(w, r, http.StatusOK, response, resp)
+	return true
+}
+
+// parseDryRun reads ?dry_run=, which asks a write to be checked and
+// answered but not stored
+func parseDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dry, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, i18n.Errorf(CodeInvalidDryRun, v)
+	}
+	return dry, nil
+}
+
+// dryRun checks presence, keyed by its store ID, the way the service would
+// before storing it. It returns the presence the write would store and the
+// current one, nil if the user has none. Services that can't dry-run only
+// get the handler's own checks.
+func (h *PresenceHandler) dryRun(ctx context.Context, presence models.Presence) (models.Presence, *models.Presence, error) {
+	var previous *models.Presence
+	current, err := h.service.GetPresence(ctx, presence.UserID)
+	switch {
+	case err == nil:
+		previous = &current
+	case !apperrors.IsNotFound(err):
+		return models.Presence{}, nil, err
+	}
+	if dr, ok := h.service.(DryRunner); ok {
+		if presence, err = dr.CheckPresence(ctx, presence.UserID, presence); err != nil {
+			return models.Presence{}, nil, err
+		}
+	}
+	return presence, previous, nil
+}
+
+// presenceChanges lists the JSON names of the client-set fields that differ
+// between previous, nil for a new presence, and next
+func presenceChanges(previous *models.Presence, next models.Presence) []string {
+	var prev models.Presence
+	if previous != nil {
+		prev = *previous
+	}
+	changes := []string{}
+	for _, f := range []struct {
+		name    string
+		changed bool
+	}{
+		{"status", previous == nil || prev.Status != next.Status},
+		{"message", prev.Message != next.Message},
+		{"ttl", prev.TTL != next.TTL},
+		{"client", !reflect.DeepEqual(prev.Client, next.Client)},
+		{"time_zone", prev.TimeZone != next.TimeZone},
+		{"correlation_id", prev.CorrelationID != next.CorrelationID},
+	} {
+		if f.changed {
+			changes = append(changes, f.name)
+		}
+	}
+	return changes
+}
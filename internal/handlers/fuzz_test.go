@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// FuzzSetPresence sends arbitrary user IDs and bodies to the PUT handler.
+// It must not panic, must answer 200 or 400, and may only store presences
+// with a known status and a non-negative TTL.
+func FuzzSetPresence(f *testing.F) {
+	f.Add("u1", []byte(`{"status":"online","message":"hi","ttl":60}`))
+	f.Add("u1", []byte(`{"status":"sleeping"}`))
+	f.Add("u1", []byte(`{"status":"away","ttl":-5}`))
+	f.Add("u1", []byte(`{"status":"busy","ttl":9223372037}`))
+	f.Add("", []byte(`{"status":"online"}`))
+	f.Add("u1", []byte(`{"status":1}`))
+	f.Add("u1", []byte(`not json`))
+	f.Fuzz(func(t *testing.T, userID string, body []byte) {
+		svc := newMockPresenceService()
+		h := NewPresenceHandler(svc)
+		req := httptest.NewRequest(http.MethodPut, "/api/v2/presence/x", bytes.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"user_id": userID})
+		rr := httptest.NewRecorder()
+		h.SetPresence(rr, req)
+
+		switch rr.Code {
+		case http.StatusOK:
+			p, ok := svc.presences[userID]
+			if !ok {
+				t.Fatalf("200 without storing %q", userID)
+			}
+			if !p.Status.IsValid() || p.TTL < 0 || p.UserID != userID {
+				t.Fatalf("stored invalid presence %+v for body %q", p, body)
+			}
+		case http.StatusBadRequest:
+			if len(svc.presences) != 0 {
+				t.Fatalf("400 but stored %v", svc.presences)
+			}
+		default:
+			t.Fatalf("unexpected status %d for body %q", rr.Code, body)
+		}
+	})
+}
+
+// FuzzNormalizeUserIDs checks the invariants of multi-user ID cleanup: every
+// ID is kept, counted invalid or counted as a repeat; kept IDs are distinct,
+// in request order, and usable as KV keys unless pseudonymized.
+func FuzzNormalizeUserIDs(f *testing.F) {
+	f.Add("u1,u2,u1", false)
+	f.Add("a..b,.x,y.,ok", false)
+	f.Add(",,é,u 1", true)
+	f.Add("user.alice,user/bob,=", false)
+	f.Fuzz(func(t *testing.T, joined string, pseudonymized bool) {
+		var input []string
+		for _, id := range bytes.Split([]byte(joined), []byte(",")) {
+			input = append(input, string(id))
+		}
+		ids, meta := normalizeUserIDs(input, pseudonymized)
+
+		if meta.Requested != len(input) || len(ids)+meta.Invalid+meta.Deduplicated != len(input) {
+			t.Fatalf("counts don't add up: %d kept, %+v for %q", len(ids), meta, input)
+		}
+		seen := make(map[string]bool)
+		next := 0
+		for _, id := range ids {
+			if seen[id] {
+				t.Fatalf("repeated ID %q in %q", id, ids)
+			}
+			seen[id] = true
+			if id == "" || (!pseudonymized && !validKeyID(id)) {
+				t.Fatalf("kept invalid ID %q", id)
+			}
+			// Kept IDs appear in request order
+			for next < len(input) && input[next] != id {
+				next++
+			}
+			if next == len(input) {
+				t.Fatalf("ID %q out of request order in %q", id, ids)
+			}
+		}
+	})
+}
@@ -3,14 +3,24 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/protobuf/proto"
 
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/i18n"
+	"gopresence/internal/index"
+	"gopresence/internal/metrics"
 	"gopresence/internal/models"
+	presencev1 "gopresence/internal/pb/presence/v1"
+	"gopresence/internal/privacy"
+	"gopresence/internal/resultcache"
 )
 
 // PresenceService defines the interface for presence operations
@@ -20,20 +30,23 @@ type PresenceService interface {
 	GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error)
 }
 
-// PresenceNotFoundError represents an error when a presence is not found
-type PresenceNotFoundError struct {
-	UserID string
+// StaleReader is implemented by services that support stale-while-revalidate
+// reads; it returns the presences and the age of the oldest cached one served
+type StaleReader interface {
+	GetMultiplePresencesStale(ctx context.Context, userIDs []string, maxStale time.Duration) (map[string]models.Presence, time.Duration, error)
 }
 
-func (e *PresenceNotFoundError) Error() string {
-	return fmt.Sprintf("presence not found for user %s", e.UserID)
-}
+// PresenceNotFoundError represents an error when a presence is not found
+type PresenceNotFoundError = apperrors.NotFoundError
 
 // SetPresenceRequest represents the request body for setting presence
 type SetPresenceRequest struct {
-	Status  models.PresenceStatus `json:"status"`
-	Message string                `json:"message,omitempty"`
-	TTL     int64                 `json:"ttl,omitempty"`
+	Status        models.PresenceStatus `json:"status"`
+	Message       string                `json:"message,omitempty"`
+	TTL           int64                 `json:"ttl,omitempty"`
+	Client        *models.ClientInfo    `json:"client,omitempty"`
+	TimeZone      string                `json:"time_zone,omitempty"`
+	CorrelationID string                `json:"correlation_id,omitempty"` // Opaque, stored with the presence and echoed in its events
 }
 
 // BatchPresenceRequest represents the request body for batch presence queries
@@ -43,14 +56,39 @@ type BatchPresenceRequest struct {
 
 // PresenceHandler handles HTTP requests for presence operations
 type PresenceHandler struct {
-	service PresenceService
+	service       PresenceService
+	pseudonymizer *privacy.Pseudonymizer
+	node          models.NodeInfo
+	audit         *slog.Logger
+	ndjsonChunk   int
+	subscriptions SubscriptionRegistry // nil unless presence subscriptions are on
+	contacts      ContactSource        // nil unless contact lookups are configured
+	annotations   AnnotationStore      // nil unless annotations are enabled
+	index         *index.Index         // nil unless the presence index is on
+	backfiller    HistoryBackfiller    // nil unless history backfills are on
+	results       *resultcache.Cache   // nil unless query results are cached
+}
+
+// Option configures optional PresenceHandler behavior
+type Option func(*PresenceHandler)
+
+// WithPseudonymizer enables pseudonymized mode: user IDs are HMAC-hashed
+// before reaching the service, and mapped back to the caller's IDs in responses
+func WithPseudonymizer(p *privacy.Pseudonymizer) Option {
+	return func(h *PresenceHandler) { h.pseudonymizer = p }
 }
 
 // NewPresenceHandler creates a new PresenceHandler
-func NewPresenceHandler(service PresenceService) *PresenceHandler {
-	return &PresenceHandler{
-		service: service,
+func NewPresenceHandler(service PresenceService, opts ...Option) *PresenceHandler {
+	h := &PresenceHandler{
+		service:     service,
+		audit:       slog.Default(),
+		ndjsonChunk: DefaultNDJSONChunkSize,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // GetPresence handles GET /api/v2/presence/{user_id}
@@ -59,25 +97,35 @@ func (h *PresenceHandler) GetPresence(w http.ResponseWriter, r *http.Request) {
 	userID := vars["user_id"]
 
 	if userID == "" {
-		h.writeErrorResponse(w, http.StatusBadRequest, "user_id is required")
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUserIDRequired)
 		return
 	}
 
-	presence, err := h.service.GetPresence(r.Context(), userID)
+	maxStale, err := parseMaxStale(r)
 	if err != nil {
-		// Check for PresenceNotFoundError from different packages
-		if _, ok := err.(*PresenceNotFoundError); ok {
-			h.writeErrorResponse(w, http.StatusNotFound, err.Error())
-			return
-		}
-		// Also check by error message content
-		if strings.Contains(err.Error(), "not found") {
-			h.writeErrorResponse(w, http.StatusNotFound, err.Error())
+		writeBadRequest(w, r, err)
+		return
+	}
+	if maxStale > 0 {
+		metrics.ObserveFeature(r.Context(), metrics.FeatureStaleRead)
+	}
+	if sr, ok := h.service.(StaleReader); ok && maxStale > 0 {
+		h.getPresenceStale(w, r, sr, userID, maxStale)
+		return
+	}
+
+	presence, err := h.service.GetPresence(r.Context(), h.storeID(userID))
+	if err != nil {
+		if apperrors.IsNotFound(err) {
+			// Report the caller's ID rather than any pseudonym
+			writeErrorResponse(w, r, http.StatusNotFound, CodePresenceNotFound, userID)
 			return
 		}
-		h.writeErrorResponse(w, http.StatusInternalServerError, "failed to get presence")
+		writeStoreError(w, r, err, CodeGetFailed)
 		return
 	}
+	presence.UserID = userID
+	setETag(w, presence)
 
 	response := models.PresenceResponse{
 		Success: true,
@@ -86,50 +134,148 @@ func (h *PresenceHandler) GetPresence(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, response)
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// getPresenceStale serves a single presence that may be up to maxStale old
+func (h *PresenceHandler) getPresenceStale(w http.ResponseWriter, r *http.Request, sr StaleReader, userID string, maxStale time.Duration) {
+	storeID := h.storeID(userID)
+	presences, age, err := sr.GetMultiplePresencesStale(r.Context(), []string{storeID}, maxStale)
+	if err != nil {
+		writeStoreError(w, r, err, CodeGetFailed)
+		return
+	}
+	presence, ok := presences[storeID]
+	if !ok {
+		writeErrorResponse(w, r, http.StatusNotFound, CodePresenceNotFound, userID)
+		return
+	}
+	presence.UserID = userID
+
+	setAge(w, age)
+	setETag(w, presence)
+	writeResponse(w, r, http.StatusOK, models.PresenceResponse{
+		Success: true,
+		Data:    map[string]models.Presence{userID: presence},
+	})
 }
 
 // SetPresence handles PUT /api/v2/presence/{user_id}
 func (h *PresenceHandler) SetPresence(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := readSetPresence(w, r)
+	if !ok {
+		return
+	}
+	h.setPresence(w, r, userID, req, models.SourceAPI)
+}
+
+// readSetPresence reads and validates the target user and body of a presence
+// write, answering 400 and reporting false if either is invalid
+func readSetPresence(w http.ResponseWriter, r *http.Request) (string, SetPresenceRequest, bool) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
 
 	if userID == "" {
-		h.writeErrorResponse(w, http.StatusBadRequest, "user_id is required")
-		return
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUserIDRequired)
+		return "", SetPresenceRequest{}, false
 	}
 
 	var req SetPresenceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, "invalid JSON")
-		return
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return "", SetPresenceRequest{}, false
 	}
 
 	// Validate status
 	if !req.Status.IsValid() {
-		h.writeErrorResponse(w, http.StatusBadRequest, "invalid status")
-		return
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidStatus)
+		return "", SetPresenceRequest{}, false
 	}
-
-	// Create presence object
-	now := time.Now().UTC()
-	presence := models.Presence{
-		UserID:    userID,
-		Status:    req.Status,
-		Message:   req.Message,
-		LastSeen:  now,
-		UpdatedAt: now,
-		NodeID:    "current-node", // This would be set from config in real implementation
+	if !validTTL(req.TTL) {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidTTL)
+		return "", SetPresenceRequest{}, false
+	}
+	if err := validateClient(req.Client); err != nil {
+		writeBadRequest(w, r, err)
+		return "", SetPresenceRequest{}, false
+	}
+	if err := models.ValidateTimeZone(req.TimeZone); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidTimeZone, req.TimeZone)
+		return "", SetPresenceRequest{}, false
 	}
+	if err := models.ValidateCorrelationID(req.CorrelationID); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidCorrelationID, models.MaxCorrelationIDLength)
+		return "", SetPresenceRequest{}, false
+	}
+	return userID, req, true
+}
 
-	if req.TTL > 0 {
-		presence.TTL = time.Duration(req.TTL) * time.Second
+// validTTL reports whether a TTL in seconds is non-negative and fits a
+// time.Duration
+func validTTL(secs int64) bool { return secs >= 0 && secs <= models.MaxTTLSeconds }
+
+// validateClient checks the optional client info of a presence write
+func validateClient(client *models.ClientInfo) *i18n.Error {
+	if client == nil {
+		return nil
 	}
+	if err := client.Validate(); err != nil {
+		return i18n.Errorf(CodeInvalidClient, err)
+	}
+	return nil
+}
 
-	if err := h.service.SetPresence(r.Context(), userID, presence); err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, "failed to set presence")
-		return
+// setPresence writes userID's presence from req, attributed to source, and
+// answers with the stored presence. It reports whether the write succeeded.
+// With ?dry_run=true the write is checked and answered but not stored.
+func (h *PresenceHandler) setPresence(w http.ResponseWriter, r *http.Request, userID string, req SetPresenceRequest, source models.PresenceSource) bool {
+	dry, err := parseDryRun(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return false
 	}
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return false
+	}
+	presence := h.newPresence(userID, req, source)
+	if dry {
+		next, previous, err := h.dryRun(r.Context(), presence)
+		if err != nil {
+			writeStoreError(w, r, err, CodeSetFailed)
+			return false
+		}
+		if ifMatch != 0 && (previous == nil || previous.Revision != ifMatch) {
+			writeErrorResponse(w, r, http.StatusPreconditionFailed, CodePresenceModified)
+			return false
+		}
+		resp := DryRunResponse{Success: true, DryRun: true, Changes: presenceChanges(previous, next)}
+		next.UserID = userID
+		resp.Data = map[string]models.Presence{userID: next}
+		if previous != nil {
+			previous.UserID = userID
+			resp.Previous = map[string]models.Presence{userID: *previous}
+		}
+		return writeDryRun(w, r, resp)
+	}
+	// Services that report the stored revision answer with its ETag
+	cw, ok := h.service.(ConditionalWriter)
+	switch {
+	case ok:
+		presence, err = cw.SetPresenceAtRevision(r.Context(), presence.UserID, presence, ifMatch)
+	case ifMatch != 0:
+		writeErrorResponse(w, r, http.StatusNotImplemented, CodeConditionalUnavailable)
+		return false
+	default:
+		err = h.service.SetPresence(r.Context(), presence.UserID, presence)
+	}
+	if err != nil {
+		writeStoreError(w, r, err, CodeSetFailed)
+		return false
+	}
+	presence.UserID = userID
+	setETag(w, presence)
 
 	response := models.PresenceResponse{
 		Success: true,
@@ -138,14 +284,36 @@ func (h *PresenceHandler) SetPresence(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, response)
+	writeResponse(w, r, http.StatusOK, response)
+	return true
+}
+
+// newPresence builds the presence req writes for userID, keyed by its store ID
+func (h *PresenceHandler) newPresence(userID string, req SetPresenceRequest, source models.PresenceSource) models.Presence {
+	now := time.Now().UTC()
+	presence := models.Presence{
+		UserID:        h.storeID(userID),
+		Status:        req.Status,
+		Message:       req.Message,
+		LastSeen:      now,
+		UpdatedAt:     now,
+		NodeID:        h.node.ID,
+		Source:        source,
+		Client:        req.Client,
+		TimeZone:      req.TimeZone,
+		CorrelationID: req.CorrelationID,
+	}
+	if req.TTL > 0 {
+		presence.TTL = time.Duration(req.TTL) * time.Second
+	}
+	return presence
 }
 
 // GetMultiplePresences handles GET /api/v2/presence?users=user1,user2,user3
 func (h *PresenceHandler) GetMultiplePresences(w http.ResponseWriter, r *http.Request) {
 	usersParam := r.URL.Query().Get("users")
 	if usersParam == "" {
-		h.writeErrorResponse(w, http.StatusBadRequest, "users parameter is required")
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUsersRequired)
 		return
 	}
 
@@ -154,59 +322,280 @@ func (h *PresenceHandler) GetMultiplePresences(w http.ResponseWriter, r *http.Re
 		userIDs[i] = strings.TrimSpace(userID)
 	}
 
-	presences, err := h.service.GetMultiplePresences(r.Context(), userIDs)
-	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, "failed to get presences")
-		return
-	}
-
-	response := models.PresenceResponse{
-		Success: true,
-		Data:    presences,
-	}
-
-	h.writeJSONResponse(w, http.StatusOK, response)
+	h.serveMultiple(w, r, userIDs)
 }
 
 // BatchPresence handles POST /api/v2/presence/batch
 func (h *PresenceHandler) BatchPresence(w http.ResponseWriter, r *http.Request) {
 	var req BatchPresenceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, "invalid JSON")
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
 		return
 	}
 
 	if len(req.UserIDs) == 0 {
-		h.writeErrorResponse(w, http.StatusBadRequest, "user_ids is required")
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUserIDsRequired)
+		return
+	}
+
+	h.serveMultiple(w, r, req.UserIDs)
+}
+
+// serveMultiple writes the presences of userIDs, honoring the stale-read,
+// changed-since and ordering options shared by the multi-user read endpoints.
+// Invalid and repeated IDs are skipped and counted.
+func (h *PresenceHandler) serveMultiple(w http.ResponseWriter, r *http.Request, userIDs []string) {
+	order, ok := parseOrder(r)
+	if !ok {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidOrder)
+		return
+	}
+	userIDs, meta := normalizeUserIDs(userIDs, h.pseudonymizer != nil)
+	if len(userIDs) == 0 {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeNoValidUserIDs)
 		return
 	}
+	skipped := setBatchMeta(w, meta)
 
-	presences, err := h.service.GetMultiplePresences(r.Context(), req.UserIDs)
+	maxStale, err := parseMaxStale(r)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, "failed to get presences")
+		writeBadRequest(w, r, err)
+		return
+	}
+	since, conditional, err := parseChangedSince(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	observeMultipleRead(r, meta.Requested, order, maxStale, since)
+	if wantsNDJSON(r.Header.Get("Accept")) {
+		metrics.ObserveEncoding(r.Context(), metrics.EncodingNDJSON)
+		h.streamMultiple(w, r, userIDs, maxStale, since)
+		return
+	}
+
+	presences, age, err := h.getMultiple(r.Context(), userIDs, maxStale)
+	if err != nil {
+		writeStoreError(w, r, err, CodeGetMultipleFailed)
+		return
+	}
+	if maxStale > 0 {
+		setAge(w, age)
+	}
+
+	if !since.IsZero() {
+		var lastModified time.Time
+		for userID, presence := range presences {
+			if presence.UpdatedAt.After(lastModified) {
+				lastModified = presence.UpdatedAt
+			}
+			if !presence.UpdatedAt.After(since) {
+				delete(presences, userID)
+			}
+		}
+		if !lastModified.IsZero() {
+			w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+		if conditional && len(presences) == 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if order == OrderRequest && !presencev1.WantsProtobuf(r.Header.Get("Accept")) {
+		metrics.ObserveEncoding(r.Context(), metrics.EncodingJSON)
+		writeJSON(w, http.StatusOK, orderedResponse(userIDs, presences, skipped))
 		return
 	}
 
 	response := models.PresenceResponse{
 		Success: true,
 		Data:    presences,
+		Meta:    skipped,
+	}
+
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// observeMultipleRead counts the batch size and optional features of a
+// multi-user read
+func observeMultipleRead(r *http.Request, requested int, order string, maxStale time.Duration, since time.Time) {
+	ctx := r.Context()
+	metrics.ObserveBatchSize(ctx, requested)
+	if order == OrderRequest {
+		metrics.ObserveFeature(ctx, metrics.FeatureRequestOrder)
+	}
+	if maxStale > 0 {
+		metrics.ObserveFeature(ctx, metrics.FeatureStaleRead)
+	}
+	if !since.IsZero() {
+		metrics.ObserveFeature(ctx, metrics.FeatureChangedSince)
+	}
+}
+
+// parseChangedSince reads ?changed_since=<RFC3339> or If-Modified-Since.
+// conditional reports whether the HTTP header was used, in which case an
+// empty result is answered with 304 Not Modified.
+func parseChangedSince(r *http.Request) (since time.Time, conditional bool, err error) {
+	if v := r.URL.Query().Get("changed_since"); v != "" {
+		since, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, false, i18n.Errorf(CodeInvalidChangedSince)
+		}
+		return since, false, nil
+	}
+	if v := r.Header.Get("If-Modified-Since"); v != "" {
+		since, err = http.ParseTime(v)
+		if err != nil {
+			return time.Time{}, false, i18n.Errorf(CodeInvalidIfModifiedSince)
+		}
+		return since, true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// storeID returns the ID under which a user's presence is stored
+func (h *PresenceHandler) storeID(userID string) string {
+	if h.pseudonymizer == nil {
+		return userID
+	}
+	return h.pseudonymizer.Pseudonymize(userID)
+}
+
+// getMultiple fetches presences keyed by the caller's user IDs, translating
+// to and from pseudonyms when pseudonymized mode is enabled. A positive
+// maxStale allows cached presences up to that age; the returned duration is
+// the age of the oldest one served.
+func (h *PresenceHandler) getMultiple(ctx context.Context, userIDs []string, maxStale time.Duration) (map[string]models.Presence, time.Duration, error) {
+	ids, reverse := userIDs, map[string]string(nil)
+	if h.pseudonymizer != nil {
+		ids, reverse = h.pseudonymizer.PseudonymizeAll(userIDs)
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, response)
+	var presences map[string]models.Presence
+	var age time.Duration
+	var err error
+	if sr, ok := h.service.(StaleReader); ok && maxStale > 0 {
+		presences, age, err = sr.GetMultiplePresencesStale(ctx, ids, maxStale)
+	} else {
+		presences, err = h.service.GetMultiplePresences(ctx, ids)
+	}
+	if err != nil || reverse == nil {
+		return presences, age, err
+	}
+
+	result := make(map[string]models.Presence, len(presences))
+	for id, presence := range presences {
+		if userID, ok := reverse[id]; ok {
+			presence.UserID = userID
+			result[userID] = presence
+		}
+	}
+	return result, age, nil
 }
 
-// writeJSONResponse writes a JSON response
-func (h *PresenceHandler) writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+// parseMaxStale reads the client's staleness tolerance from ?max_stale=
+// (seconds or a duration such as 10s) or Cache-Control: max-stale=<seconds>.
+// Zero means the client wants the regular read path.
+func parseMaxStale(r *http.Request) (time.Duration, error) {
+	if v := r.URL.Query().Get("max_stale"); v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, nil
+		}
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d, nil
+		}
+		return 0, i18n.Errorf(CodeInvalidMaxStale)
+	}
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-stale") {
+			continue
+		}
+		secs, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || secs < 0 {
+			return 0, i18n.Errorf(CodeInvalidMaxStale)
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	return 0, nil
+}
+
+// setAge reports how stale a stale-tolerant response is, in whole seconds
+func setAge(w http.ResponseWriter, age time.Duration) {
+	w.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+}
+
+// writeResponse writes a JSON response, or a protobuf PresenceResponse when
+// the client asks for the binary codec via Accept: application/x-protobuf.
+// JSON responses take the caller's response profile shape, if any.
+func writeResponse(w http.ResponseWriter, r *http.Request, statusCode int, response models.PresenceResponse) {
+	writeNegotiated(w, r, statusCode, response, response)
+}
+
+// writeNegotiated writes response like writeResponse, but with body as the
+// JSON of the default shape
+func writeNegotiated(w http.ResponseWriter, r *http.Request, statusCode int, response models.PresenceResponse, body any) {
+	if presencev1.WantsProtobuf(r.Header.Get("Accept")) {
+		body, err := proto.Marshal(presencev1.FromResponse(response))
+		if err == nil {
+			metrics.ObserveEncoding(r.Context(), metrics.EncodingProtobuf)
+			w.Header().Set("Content-Type", presencev1.ContentTypeProtobuf)
+			w.WriteHeader(statusCode)
+			w.Write(body)
+			return
+		}
+	}
+	metrics.ObserveEncoding(r.Context(), metrics.EncodingJSON)
+	if shape := responseShape(r); shape != nil {
+		metrics.ObserveFeature(r.Context(), metrics.FeatureResponseProfile)
+		writeJSON(w, statusCode, shape(response))
+		return
+	}
+	writeJSON(w, statusCode, body)
+}
+
+// writeJSON writes any value as a JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(data)
 }
 
-// writeErrorResponse writes an error response
-func (h *PresenceHandler) writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+// writeStoreError reports a failed store operation: 413 if a batch was
+// refused as too expensive, 409 if the state machine rejected the status
+// change, 412 if a conditional write found a newer revision, 504 if the
+// store timed out, otherwise 500 with message
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, code string) {
+	var budget *apperrors.BudgetExceededError
+	if errors.As(err, &budget) {
+		w.Header().Set("X-Max-Batch-Size", strconv.Itoa(budget.MaxBatchSize))
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, CodeBatchOverBudget,
+			budget.Users, budget.EstimatedReads, budget.Budget, budget.MaxBatchSize)
+		return
+	}
+	status, e := storeErrorStatus(err, code)
+	writeErrorResponse(w, r, status, e.Code, e.Args...)
+}
+
+// writeBadRequest answers 400 with the code of err, an *i18n.Error returned
+// by a request parser or validator; other errors are reported as is
+func writeBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	var e *i18n.Error
+	if !errors.As(err, &e) {
+		writeResponse(w, r, http.StatusBadRequest, models.PresenceResponse{Error: err.Error()})
+		return
+	}
+	writeErrorResponse(w, r, http.StatusBadRequest, e.Code, e.Args...)
+}
+
+// writeErrorResponse answers with code and its message, localized to the
+// caller's Accept-Language
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, code string, args ...interface{}) {
 	response := models.PresenceResponse{
 		Success: false,
-		Error:   message,
+		Error:   i18n.Localize(w, r, code, args...),
+		Code:    code,
 	}
-	h.writeJSONResponse(w, statusCode, response)
+	writeResponse(w, r, statusCode, response)
 }
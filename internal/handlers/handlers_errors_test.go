@@ -3,7 +3,9 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,7 +13,9 @@ import (
 
 	"github.com/gorilla/mux"
 
+	apperrors "gopresence/internal/errors"
 	"gopresence/internal/models"
+	"gopresence/internal/nats"
 )
 
 type errSvc struct{}
@@ -86,3 +90,85 @@ func TestHandlers_ErrorBranches(t *testing.T) {
 		t.Fatalf("expected 400 for empty user_ids, got %d", rr.Code)
 	}
 }
+
+type timeoutSvc struct{ errSvc }
+
+func (s *timeoutSvc) GetPresence(ctx context.Context, userID string) (models.Presence, error) {
+	return models.Presence{}, fmt.Errorf("failed to get presence: %w", &nats.TimeoutError{Op: "get", Err: context.DeadlineExceeded})
+}
+func (s *timeoutSvc) SetPresence(ctx context.Context, userID string, presence models.Presence) error {
+	return fmt.Errorf("failed to store presence: %w", &nats.TimeoutError{Op: "set", Err: context.DeadlineExceeded})
+}
+
+func TestHandlers_StoreTimeoutIs504(t *testing.T) {
+	h := NewPresenceHandler(&timeoutSvc{})
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
+	r.HandleFunc("/api/v2/presence/{user_id}", h.SetPresence).Methods("PUT")
+
+	req := httptest.NewRequest("GET", "/api/v2/presence/u1", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusGatewayTimeout || !strings.Contains(rr.Body.String(), "timed out") {
+		t.Fatalf("expected 504 for get timeout, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("PUT", "/api/v2/presence/u1", bytes.NewBufferString(`{"status":"online"}`))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504 for set timeout, got %d", rr.Code)
+	}
+}
+
+type budgetSvc struct{ errSvc }
+
+func (s *budgetSvc) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	return nil, &apperrors.BudgetExceededError{Users: len(userIDs), EstimatedReads: len(userIDs), Budget: 2, MaxBatchSize: 2}
+}
+
+func TestHandlers_BatchOverBudgetIs413(t *testing.T) {
+	h := NewPresenceHandler(&budgetSvc{})
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/batch", h.BatchPresence).Methods("POST")
+
+	req := httptest.NewRequest("POST", "/api/v2/presence/batch", strings.NewReader(`{"user_ids":["a","b","c"]}`))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge || rr.Header().Get("X-Max-Batch-Size") != "2" {
+		t.Fatalf("expected 413 with max batch size 2, got %d %v", rr.Code, rr.Header())
+	}
+	if !strings.Contains(rr.Body.String(), "at most 2 users") {
+		t.Fatalf("expected batch size guidance, got %s", rr.Body.String())
+	}
+}
+
+func TestErrorResponse_Localized(t *testing.T) {
+	h := NewPresenceHandler(newMockPresenceService())
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
+
+	get := func(acceptLanguage string) (*httptest.ResponseRecorder, models.PresenceResponse) {
+		req := httptest.NewRequest("GET", "/api/v2/presence/ghost", nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		var resp models.PresenceResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return rr, resp
+	}
+
+	rr, resp := get("de-DE, en;q=0.5")
+	if rr.Code != http.StatusNotFound || resp.Code != CodePresenceNotFound || resp.Error != "Keine Präsenz für Benutzer ghost gefunden" {
+		t.Fatalf("expected a German not-found error, got %d %+v", rr.Code, resp)
+	}
+	if rr.Header().Get("Content-Language") != "de" {
+		t.Fatalf("expected Content-Language de, got %q", rr.Header().Get("Content-Language"))
+	}
+	// The code is the same whatever the language
+	if _, resp := get("sv"); resp.Code != CodePresenceNotFound || resp.Error != "presence not found for user ghost" {
+		t.Fatalf("expected the English fallback, got %+v", resp)
+	}
+}
@@ -9,21 +9,31 @@ import (
 
 	"github.com/gorilla/mux"
 
+	apperrors "gopresence/internal/errors"
 	"gopresence/internal/models"
 )
 
-type notFoundSvc struct{ mockPresenceService }
-func (n *notFoundSvc) GetPresence(ctx context.Context, userID string) (models.Presence, error) { return models.Presence{}, fmt.Errorf("%s not found in store", userID) }
+type notFoundSvc struct{ mockPresenceService; err error }
+func (n *notFoundSvc) GetPresence(ctx context.Context, userID string) (models.Presence, error) { return models.Presence{}, n.err }
 
-func TestGetPresence_StringBasedNotFound(t *testing.T) {
-	service := &notFoundSvc{mockPresenceService{}}
-	h := NewPresenceHandler(service)
-	r := mux.NewRouter()
-	r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
-	req := httptest.NewRequest("GET", "/api/v2/presence/u1", nil)
-	rr := httptest.NewRecorder()
-	r.ServeHTTP(rr, req)
-	if rr.Code != http.StatusNotFound {
-		t.Fatalf("expected 404 for string-based not found, got %d", rr.Code)
+func TestGetPresence_WrappedNotFound(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("lookup: %w", apperrors.NotFound("u1")), http.StatusNotFound},
+		// Message text alone no longer decides the status
+		{fmt.Errorf("u1 not found in store"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		h := NewPresenceHandler(&notFoundSvc{mockPresenceService{}, tc.err})
+		r := mux.NewRouter()
+		r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
+		req := httptest.NewRequest("GET", "/api/v2/presence/u1", nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != tc.code {
+			t.Fatalf("%v: expected %d, got %d", tc.err, tc.code, rr.Code)
+		}
 	}
 }
@@ -183,6 +183,43 @@ func TestSetPresenceHandler_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestSetPresenceHandler_ClientInfoAndTimeZone(t *testing.T) {
+	service := newMockPresenceService()
+	handler := NewPresenceHandler(service)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/presence/{user_id}", handler.SetPresence).Methods("PUT")
+
+	put := func(body string) int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", "/api/v2/presence/user1", strings.NewReader(body)))
+		return rr.Code
+	}
+
+	if code := put(`{"status":"online","client":{"app_version":"3.0.1","platform":"web","capabilities":["video-capable"]}}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if p := service.presences["user1"]; p.Client == nil || p.Client.Platform != "web" || !p.HasCapabilities([]string{"video-capable"}) {
+		t.Fatalf("expected client info to be stored, got %+v", p.Client)
+	}
+	if code := put(`{"status":"online","time_zone":"Europe/Berlin"}`); code != http.StatusOK || service.presences["user1"].TimeZone != "Europe/Berlin" {
+		t.Fatalf("expected the time zone to be stored, got %d %+v", code, service.presences["user1"])
+	}
+	if code := put(`{"status":"online","correlation_id":"evt-42"}`); code != http.StatusOK || service.presences["user1"].CorrelationID != "evt-42" {
+		t.Fatalf("expected the correlation ID to be stored, got %d %+v", code, service.presences["user1"])
+	}
+
+	for _, body := range []string{
+		`{"status":"online","client":{"capabilities":["Video!"]}}`,
+		`{"status":"online","client":{"platform":"` + strings.Repeat("x", models.MaxClientFieldLength+1) + `"}}`,
+		`{"status":"online","time_zone":"Mars/Base"}`,
+		`{"status":"online","correlation_id":"` + strings.Repeat("x", models.MaxCorrelationIDLength+1) + `"}`,
+	} {
+		if code := put(body); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, code)
+		}
+	}
+}
+
 func TestGetMultiplePresencesHandler(t *testing.T) {
 	service := newMockPresenceService()
 	handler := NewPresenceHandler(service)
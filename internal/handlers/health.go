@@ -12,11 +12,35 @@ type ReadinessChecker interface {
 	Ready(ctx context.Context) error
 }
 
+// DetailsProvider reports dependency detail, such as KV replication lag,
+// for /health/details
+type DetailsProvider interface {
+	HealthDetails(ctx context.Context) any
+}
+
 type HealthHandler struct {
 	checker ReadinessChecker
+	gates   []ReadinessChecker // checked ahead of checker, e.g. a node drain
 }
 
-func NewHealthHandler(checker ReadinessChecker) *HealthHandler { return &HealthHandler{checker: checker} }
+// NewHealthHandler creates a HealthHandler; readiness also fails while any
+// of gates is not ready
+func NewHealthHandler(checker ReadinessChecker, gates ...ReadinessChecker) *HealthHandler {
+	return &HealthHandler{checker: checker, gates: gates}
+}
+
+// ready checks the gates, then the checker
+func (h *HealthHandler) ready(ctx context.Context) error {
+	for _, g := range h.gates {
+		if err := g.Ready(ctx); err != nil {
+			return err
+		}
+	}
+	if h.checker != nil {
+		return h.checker.Ready(ctx)
+	}
+	return nil
+}
 
 func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request){
 	w.Header().Set("Content-Type","application/json")
@@ -27,12 +51,29 @@ func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request){
 	w.Header().Set("Content-Type","application/json")
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
-	if h.checker != nil {
-		if err := h.checker.Ready(ctx); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_ = json.NewEncoder(w).Encode(map[string]any{"status":"unready","error": err.Error()})
-			return
-		}
+	if err := h.ready(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]any{"status":"unready","error": err.Error()})
+		return
 	}
 	_ = json.NewEncoder(w).Encode(map[string]any{"status":"ready","ts": time.Now().UTC()})
 }
+
+// Details handles GET /health/details: readiness plus the checker's
+// dependency details when it implements DetailsProvider
+func (h *HealthHandler) Details(w http.ResponseWriter, r *http.Request){
+	w.Header().Set("Content-Type","application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	resp := map[string]any{"status":"ready","ts": time.Now().UTC()}
+	code := http.StatusOK
+	if err := h.ready(ctx); err != nil {
+		resp["status"], resp["error"] = "unready", err.Error()
+		code = http.StatusServiceUnavailable
+	}
+	if dp, ok := h.checker.(DetailsProvider); ok {
+		resp["details"] = dp.HealthDetails(ctx)
+	}
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
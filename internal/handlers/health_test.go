@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +38,22 @@ func TestHealth_Readiness_Fail(t *testing.T){
 	h.Readiness(rw, r)
 	if rw.Code != http.StatusServiceUnavailable { t.Fatalf("expected 503, got %d", rw.Code) }
 }
+
+type detailsChecker struct{ errChecker }
+func (d *detailsChecker) HealthDetails(ctx context.Context) any { return map[string]any{"lag": 3} }
+
+func TestHealth_Details(t *testing.T){
+	rw := httptest.NewRecorder()
+	NewHealthHandler(&detailsChecker{}).Details(rw, httptest.NewRequest(http.MethodGet, "/health/details", nil))
+	if rw.Code != http.StatusServiceUnavailable { t.Fatalf("expected 503, got %d", rw.Code) }
+	var body struct {
+		Status  string         `json:"status"`
+		Details map[string]any `json:"details"`
+	}
+	if err := json.NewDecoder(rw.Body).Decode(&body); err != nil { t.Fatalf("decode: %v", err) }
+	if body.Status != "unready" || body.Details["lag"] != float64(3) { t.Fatalf("unexpected body: %+v", body) }
+
+	rw = httptest.NewRecorder()
+	NewHealthHandler(&okChecker{}).Details(rw, httptest.NewRequest(http.MethodGet, "/health/details", nil))
+	if rw.Code != http.StatusOK || strings.Contains(rw.Body.String(), "details") { t.Fatalf("expected plain ready, got %d %s", rw.Code, rw.Body) }
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// Heartbeater is implemented by services that refresh a presence without a
+// full write; others get a read followed by a write
+type Heartbeater interface {
+	Heartbeat(ctx context.Context, userID string, ttl time.Duration) (models.Presence, error)
+}
+
+// HeartbeatRequest is the optional body of a heartbeat
+type HeartbeatRequest struct {
+	TTL int64 `json:"ttl,omitempty"` // New TTL in seconds; 0 keeps the current one
+}
+
+// Heartbeat handles POST /api/v2/presence/{user_id}/heartbeat, a keep-alive
+// that moves the user's last_seen to now, and replaces the TTL if the body
+// sets one, without resending the status or message. A user without a live
+// presence gets 404: after a lapse, clients set their presence again.
+func (h *PresenceHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	if userID == "" {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUserIDRequired)
+		return
+	}
+	var req HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return
+	}
+	if !validTTL(req.TTL) {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidTTL)
+		return
+	}
+
+	presence, err := h.heartbeat(r.Context(), h.storeID(userID), time.Duration(req.TTL)*time.Second)
+	if err != nil {
+		if apperrors.IsNotFound(err) {
+			writeErrorResponse(w, r, http.StatusNotFound, CodePresenceNotFound, userID)
+			return
+		}
+		writeStoreError(w, r, err, CodeSetFailed)
+		return
+	}
+	presence.UserID = userID
+	setETag(w, presence)
+	writeResponse(w, r, http.StatusOK, models.PresenceResponse{
+		Success: true,
+		Data:    map[string]models.Presence{userID: presence},
+	})
+}
+
+// heartbeat refreshes the presence stored under storeID, through the
+// service's Heartbeat if it has one
+func (h *PresenceHandler) heartbeat(ctx context.Context, storeID string, ttl time.Duration) (models.Presence, error) {
+	if hb, ok := h.service.(Heartbeater); ok {
+		return hb.Heartbeat(ctx, storeID, ttl)
+	}
+	presence, err := h.service.GetPresence(ctx, storeID)
+	if err != nil {
+		return models.Presence{}, err
+	}
+	now := time.Now().UTC()
+	presence.LastSeen, presence.UpdatedAt = now, now
+	presence.NodeID, presence.Source = h.node.ID, models.SourceHeartbeat
+	presence.CorrelationID, presence.Annotations = "", nil
+	presence.Revision, presence.StoredAt = 0, time.Time{}
+	if ttl > 0 {
+		presence.TTL = ttl
+	}
+	if err := h.service.SetPresence(ctx, storeID, presence); err != nil {
+		return models.Presence{}, err
+	}
+	return presence, nil
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/models"
+)
+
+func heartbeatRequest(h *PresenceHandler, userID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/presence/"+userID+"/heartbeat", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"user_id": userID})
+	rr := httptest.NewRecorder()
+	h.Heartbeat(rr, req)
+	return rr
+}
+
+func TestHeartbeat(t *testing.T) {
+	svc := newMockPresenceService()
+	seen := time.Now().UTC().Add(-time.Minute)
+	svc.presences["alice"] = models.Presence{UserID: "alice", Status: models.StatusAway, Message: "lunch", LastSeen: seen, UpdatedAt: seen, TTL: time.Hour}
+	h := NewPresenceHandler(svc)
+
+	rr := heartbeatRequest(h, "alice", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp models.PresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	p := resp.Data["alice"]
+	if p.Status != models.StatusAway || p.Message != "lunch" || p.TTL != time.Hour || p.Source != models.SourceHeartbeat || !p.LastSeen.After(seen) {
+		t.Fatalf("unexpected heartbeat presence %+v", p)
+	}
+	if stored := svc.presences["alice"]; !stored.LastSeen.Equal(p.LastSeen) {
+		t.Fatalf("expected the refresh stored, got %+v", stored)
+	}
+
+	if rr = heartbeatRequest(h, "alice", `{"ttl":30}`); rr.Code != http.StatusOK || svc.presences["alice"].TTL != 30*time.Second {
+		t.Fatalf("expected the TTL replaced, got %d: %+v", rr.Code, svc.presences["alice"])
+	}
+	for body, code := range map[string]string{`{"ttl":-1}`: CodeInvalidTTL, `{`: CodeInvalidJSON} {
+		if rr = heartbeatRequest(h, "alice", body); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), code) {
+			t.Errorf("%s: expected 400 %s, got %d: %s", body, code, rr.Code, rr.Body.String())
+		}
+	}
+	if rr = heartbeatRequest(h, "bob", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a user without a presence, got %d", rr.Code)
+	}
+}
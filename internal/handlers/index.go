@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/i18n"
+	"gopresence/internal/index"
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+	"gopresence/internal/resultcache"
+)
+
+// StatsResponse is the body of GET /api/v2/presence/stats
+type StatsResponse struct {
+	Success bool `json:"success"`
+	index.Stats
+}
+
+// Online listing page size bounds
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// ListResponse is a page of presences in a stable order
+type ListResponse struct {
+	Success    bool              `json:"success"`
+	Data       []models.Presence `json:"data"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// IndexHandler serves presence queries from the watch-maintained index
+type IndexHandler struct {
+	index   *index.Index
+	results *resultcache.Cache // nil unless query results are cached
+}
+
+// IndexOption configures optional IndexHandler behavior
+type IndexOption func(*IndexHandler)
+
+// WithStatsCache reuses stats responses from results for the cache's
+// window. They cover every presence, so changes don't invalidate them: the
+// window bounds how far behind the counts can be.
+func WithStatsCache(results *resultcache.Cache) IndexOption {
+	return func(h *IndexHandler) { h.results = results }
+}
+
+// NewIndexHandler creates a new IndexHandler
+func NewIndexHandler(idx *index.Index, opts ...IndexOption) *IndexHandler {
+	h := &IndexHandler{index: idx}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Stats handles GET /api/v2/presence/stats
+func (h *IndexHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	if h.results == nil {
+		writeJSON(w, http.StatusOK, StatsResponse{Success: true, Stats: h.index.Stats()})
+		return
+	}
+	cached, ok := h.results.Get("stats")
+	metrics.ObserveResultCache(metrics.ResultCacheStats, ok)
+	if !ok {
+		cached = StatsResponse{Success: true, Stats: h.index.Stats()}
+		h.results.Set("stats", cached, time.Time{})
+	}
+	writeJSON(w, http.StatusOK, cached)
+}
+
+// ByStatus handles GET /api/v2/presence/status/{status}.
+// In pseudonymized mode the keys are the stored pseudonyms.
+func (h *IndexHandler) ByStatus(w http.ResponseWriter, r *http.Request) {
+	status := models.PresenceStatus(mux.Vars(r)["status"])
+	if !status.IsValid() {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidStatus)
+		return
+	}
+
+	capabilities, err := parseCapabilities(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	presences := h.index.ByStatus(status, capabilities...)
+	data := make(map[string]models.Presence, len(presences))
+	for _, p := range presences {
+		data[p.UserID] = p
+	}
+	writeResponse(w, r, http.StatusOK, models.PresenceResponse{Success: true, Data: data})
+}
+
+// Online handles GET /api/v2/presence/online?cursor=...&limit=...&capability=...
+// Pages are ordered by user ID; pass next_cursor back to continue.
+func (h *IndexHandler) Online(w http.ResponseWriter, r *http.Request) {
+	capabilities, err := parseCapabilities(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: err.Error()})
+		return
+	}
+	h.servePage(w, r, func(after string, limit int) ([]models.Presence, bool) {
+		return h.index.Page(models.StatusOnline, after, limit, capabilities...)
+	})
+}
+
+// List handles GET /api/v2/presence/list?status=...&node=...&capability=...&q=...&cursor=...&limit=...,
+// paging through the live presences in user ID order. Every filter is
+// optional; q takes the syntax of index.Query.
+func (h *IndexHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := index.Filter{Status: models.PresenceStatus(q.Get("status")), NodeID: q.Get("node")}
+	if f.Status != "" && !f.Status.IsValid() {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: "invalid status"})
+		return
+	}
+	capabilities, err := parseCapabilities(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: err.Error()})
+		return
+	}
+	f.Capabilities = capabilities
+	if f.Query, err = parseQuery(r); err != nil {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: err.Error()})
+		return
+	}
+	h.servePage(w, r, func(after string, limit int) ([]models.Presence, bool) {
+		return h.index.List(f, after, limit)
+	})
+}
+
+// parseCapabilities reads the capabilities a presence query requires from
+// ?capability=, repeated or comma-separated
+func parseCapabilities(r *http.Request) ([]string, error) {
+	var capabilities []string
+	for _, v := range r.URL.Query()["capability"] {
+		for _, c := range strings.Split(v, ",") {
+			c = strings.TrimSpace(c)
+			if !models.ValidCapability(c) {
+				return nil, i18n.Errorf(CodeInvalidCapability, c)
+			}
+			capabilities = append(capabilities, c)
+		}
+	}
+	return capabilities, nil
+}
+
+// parseQuery reads the optional filter in ?q=, for support staff looking for
+// users by message, client or activity
+func parseQuery(r *http.Request) (*index.Query, error) {
+	v := r.URL.Query().Get("q")
+	if v == "" {
+		return nil, nil
+	}
+	query, err := index.ParseQuery(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	metrics.ObserveFeature(r.Context(), metrics.FeatureQuery)
+	return query, nil
+}
+
+// ByNode handles GET /api/v2/admin/nodes/{node_id}/presences?cursor=...&limit=...,
+// paging through the presences a node last wrote, e.g. to re-verify its
+// users after it misbehaved
+func (h *IndexHandler) ByNode(w http.ResponseWriter, r *http.Request) {
+	nodeID := mux.Vars(r)["node_id"]
+	if nodeID == "" {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: "node_id is required"})
+		return
+	}
+	h.servePage(w, r, func(after string, limit int) ([]models.Presence, bool) {
+		return h.index.PageByNode(nodeID, after, limit)
+	})
+}
+
+// Presences handles GET /api/v2/admin/presences?status=...&q=...&cursor=...&limit=...,
+// paging through every live presence in user ID order, or those with status
+// that q selects
+func (h *IndexHandler) Presences(w http.ResponseWriter, r *http.Request) {
+	status := models.PresenceStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.IsValid() {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: "invalid status"})
+		return
+	}
+	query, err := parseQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: err.Error()})
+		return
+	}
+	h.servePage(w, r, func(after string, limit int) ([]models.Presence, bool) {
+		switch {
+		case query != nil:
+			return h.index.List(index.Filter{Status: status, Query: query}, after, limit)
+		case status == "":
+			return h.index.PageAll(after, limit)
+		}
+		return h.index.Page(status, after, limit)
+	})
+}
+
+// servePage answers with one page of presences from the limit and cursor
+// query parameters
+func (h *IndexHandler) servePage(w http.ResponseWriter, r *http.Request, page func(after string, limit int) ([]models.Presence, bool)) {
+	q := r.URL.Query()
+	limit := defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, ListResponse{Error: "invalid limit"})
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+	after, err := decodeCursor(q.Get("cursor"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ListResponse{Error: "invalid cursor"})
+		return
+	}
+
+	data, more := page(after, limit)
+	resp := ListResponse{Success: true, Data: data}
+	if more {
+		resp.NextCursor = encodeCursor(data[len(data)-1].UserID)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Cursors are opaque to clients: the last user ID of the previous page
+func encodeCursor(userID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(userID))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(b), err
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/events"
+	"gopresence/internal/index"
+	"gopresence/internal/models"
+	"gopresence/internal/resultcache"
+)
+
+func TestIndexHandler_StatsCache(t *testing.T) {
+	idx := index.New(0)
+	idx.Apply(events.Event{Type: events.EventUpdated, UserID: "u1", Presence: &models.Presence{UserID: "u1", Status: models.StatusOnline, UpdatedAt: time.Now()}})
+	h := NewIndexHandler(idx, WithStatsCache(resultcache.New(time.Minute)))
+	total := func() int {
+		rr := httptest.NewRecorder()
+		h.Stats(rr, httptest.NewRequest("GET", "/api/v2/presence/stats", nil))
+		var stats StatsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return stats.Total
+	}
+
+	if n := total(); n != 1 {
+		t.Fatalf("expected 1 presence, got %d", n)
+	}
+	// Changes show once the window has passed
+	idx.Apply(events.Event{Type: events.EventUpdated, UserID: "u2", Presence: &models.Presence{UserID: "u2", Status: models.StatusAway, UpdatedAt: time.Now()}})
+	if n := total(); n != 1 {
+		t.Fatalf("expected the cached stats within the window, got %d", n)
+	}
+}
+
+func TestIndexHandler_StatsAndByStatus(t *testing.T) {
+	idx := index.New(0)
+	for id, st := range map[string]models.PresenceStatus{"u1": models.StatusOnline, "u2": models.StatusOnline, "u3": models.StatusAway} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: st, UpdatedAt: time.Now()}})
+	}
+	h := NewIndexHandler(idx)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/stats", h.Stats).Methods("GET")
+	r.HandleFunc("/api/v2/presence/status/{status}", h.ByStatus).Methods("GET")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence/stats", nil))
+	var stats StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !stats.Success || stats.Total != 3 || stats.ByStatus[models.StatusOnline] != 2 {
+		t.Fatalf("unexpected stats: %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence/status/online", nil))
+	var resp models.PresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Data["u1"].Status != models.StatusOnline {
+		t.Fatalf("unexpected status query response: %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence/status/sleeping", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid status, got %d", rr.Code)
+	}
+}
+
+func TestIndexHandler_OnlinePagination(t *testing.T) {
+	idx := index.New(0)
+	for _, id := range []string{"u1", "u2", "u3"} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: models.StatusOnline, UpdatedAt: time.Now()}})
+	}
+	idx.Apply(events.Event{Type: events.EventUpdated, UserID: "away", Presence: &models.Presence{UserID: "away", Status: models.StatusAway, UpdatedAt: time.Now()}})
+	h := NewIndexHandler(idx)
+
+	get := func(target string) (int, ListResponse) {
+		rr := httptest.NewRecorder()
+		h.Online(rr, httptest.NewRequest("GET", target, nil))
+		var resp ListResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return rr.Code, resp
+	}
+
+	var seen []string
+	target := "/api/v2/presence/online?limit=2"
+	for {
+		code, resp := get(target)
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		for _, p := range resp.Data {
+			seen = append(seen, p.UserID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		target = "/api/v2/presence/online?limit=2&cursor=" + resp.NextCursor
+	}
+	if len(seen) != 3 || seen[0] != "u1" || seen[2] != "u3" {
+		t.Fatalf("expected u1..u3 across pages, got %v", seen)
+	}
+
+	if code, _ := get("/api/v2/presence/online?limit=0"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad limit, got %d", code)
+	}
+	if code, _ := get("/api/v2/presence/online?cursor=***"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad cursor, got %d", code)
+	}
+}
+
+func TestIndexHandler_CapabilityFilter(t *testing.T) {
+	idx := index.New(0)
+	clients := map[string]*models.ClientInfo{
+		"video":  {Capabilities: []string{"video-capable", "screen-share"}},
+		"audio":  {Capabilities: []string{"screen-share"}},
+		"legacy": nil,
+	}
+	for id, client := range clients {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: models.StatusOnline, UpdatedAt: time.Now(), Client: client}})
+	}
+	h := NewIndexHandler(idx)
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/status/{status}", h.ByStatus).Methods("GET")
+	r.HandleFunc("/api/v2/presence/online", h.Online).Methods("GET")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence/status/online?capability=screen-share", nil))
+	var resp models.PresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Data["legacy"].UserID != "" {
+		t.Fatalf("expected video and audio, got %+v", resp.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/presence/online?capability=screen-share&capability=video-capable", nil))
+	var page ListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(page.Data) != 1 || page.Data[0].UserID != "video" || page.Data[0].Client == nil {
+		t.Fatalf("expected only video, got %+v", page.Data)
+	}
+
+	for _, target := range []string{"/api/v2/presence/online?capability=Video", "/api/v2/presence/status/online?capability=a,,b"} {
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestIndexHandler_ByNode(t *testing.T) {
+	idx := index.New(0)
+	for id, node := range map[string]string{"u1": "n1", "u2": "n2", "u3": "n1"} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: models.StatusOnline, NodeID: node, UpdatedAt: time.Now()}})
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/admin/nodes/{node_id}/presences", NewIndexHandler(idx).ByNode)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/admin/nodes/n1/presences?limit=1", nil))
+	var resp ListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%v)", rr.Code, err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].UserID != "u1" || resp.NextCursor == "" {
+		t.Fatalf("unexpected first page %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/admin/nodes/n1/presences?cursor="+resp.NextCursor, nil))
+	resp = ListResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0].UserID != "u3" || resp.NextCursor != "" {
+		t.Fatalf("unexpected last page %+v", resp)
+	}
+}
+
+func TestIndexHandler_Presences(t *testing.T) {
+	idx := index.New(0)
+	for id, status := range map[string]models.PresenceStatus{"u1": models.StatusOnline, "u2": models.StatusAway, "u3": models.StatusOnline} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: status, UpdatedAt: time.Now()}})
+	}
+	h := NewIndexHandler(idx)
+	list := func(target string) (int, ListResponse) {
+		rr := httptest.NewRecorder()
+		h.Presences(rr, httptest.NewRequest("GET", target, nil))
+		var resp ListResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	if code, resp := list("/api/v2/admin/presences?limit=2"); code != http.StatusOK || len(resp.Data) != 2 || resp.Data[1].UserID != "u2" || resp.NextCursor == "" {
+		t.Fatalf("unexpected first page %d %+v", code, resp)
+	}
+	if _, resp := list("/api/v2/admin/presences?status=away"); len(resp.Data) != 1 || resp.Data[0].UserID != "u2" || resp.NextCursor != "" {
+		t.Fatalf("unexpected away page %+v", resp)
+	}
+	if code, _ := list("/api/v2/admin/presences?status=sleeping"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid status, got %d", code)
+	}
+	if _, resp := list("/api/v2/admin/presences?status=online&q=" + url.QueryEscape("user_id!=u1")); len(resp.Data) != 1 || resp.Data[0].UserID != "u3" {
+		t.Fatalf("expected the query to narrow the status, got %+v", resp)
+	}
+	if code, resp := list("/api/v2/admin/presences?q=" + url.QueryEscape("mesage~x")); code != http.StatusBadRequest || !strings.Contains(resp.Error, `unknown field "mesage"`) {
+		t.Fatalf("expected 400 for an invalid query, got %d %+v", code, resp)
+	}
+}
+
+func TestIndexHandler_List(t *testing.T) {
+	idx := index.New(0)
+	for id, node := range map[string]string{"u1": "n1", "u2": "n2", "u3": "n1"} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: models.StatusOnline, NodeID: node, UpdatedAt: time.Now()}})
+	}
+	h := NewIndexHandler(idx)
+	list := func(target string) (int, ListResponse) {
+		rr := httptest.NewRecorder()
+		h.List(rr, httptest.NewRequest("GET", target, nil))
+		var resp ListResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	code, resp := list("/api/v2/presence/list?status=online&node=n1&limit=1")
+	if code != http.StatusOK || len(resp.Data) != 1 || resp.Data[0].UserID != "u1" || resp.NextCursor == "" {
+		t.Fatalf("unexpected first page %d %+v", code, resp)
+	}
+	if _, resp := list("/api/v2/presence/list?status=online&node=n1&limit=1&cursor=" + resp.NextCursor); len(resp.Data) != 1 || resp.Data[0].UserID != "u3" || resp.NextCursor != "" {
+		t.Fatalf("unexpected second page %+v", resp)
+	}
+	if _, resp := list("/api/v2/presence/list?status=away"); len(resp.Data) != 0 {
+		t.Fatalf("expected no away presences, got %+v", resp)
+	}
+	if code, _ := list("/api/v2/presence/list?status=sleeping"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid status, got %d", code)
+	}
+}
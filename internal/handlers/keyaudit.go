@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/nats"
+	"gopresence/internal/requestid"
+)
+
+// KeyAuditor scans the bucket for keys reads skip
+type KeyAuditor interface {
+	AuditKeys(ctx context.Context, mode string) (nats.KeyAudit, error)
+}
+
+// KeyAuditResponse is the body of the /api/v2/admin/keys/audit routes: the
+// report of the last finished audit, nil if none has run on this node
+type KeyAuditResponse struct {
+	Success bool           `json:"success"`
+	Running bool           `json:"running"`
+	Report  *nats.KeyAudit `json:"report"`
+}
+
+// KeyAuditHandler lets admins find, repair and delete junk keys in the
+// bucket, such as entries left by older versions. An audit runs in the
+// background on the node serving the request, named in X-Node-ID, and its
+// report is kept there until the next one finishes.
+type KeyAuditHandler struct {
+	auditor KeyAuditor
+	audit   *slog.Logger
+
+	mu      sync.Mutex
+	running bool
+	report  *nats.KeyAudit
+}
+
+// NewKeyAuditHandler creates a new KeyAuditHandler; audits are recorded to
+// audit, slog's default logger if nil
+func NewKeyAuditHandler(auditor KeyAuditor, audit *slog.Logger) *KeyAuditHandler {
+	if audit == nil {
+		audit = slog.Default()
+	}
+	return &KeyAuditHandler{auditor: auditor, audit: audit}
+}
+
+// Start handles POST /api/v2/admin/keys/audit?mode=, starting an audit that
+// only reports problem keys (mode=report, the default), also repairs them
+// (repair), or also deletes those it can't repair (delete). Only one audit
+// runs at a time: starting another while one runs gets 409.
+func (h *KeyAuditHandler) Start(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = nats.AuditReport
+	}
+	if !nats.ValidAuditMode(mode) {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidAuditMode, mode)
+		return
+	}
+	h.mu.Lock()
+	if h.running {
+		h.mu.Unlock()
+		writeErrorResponse(w, r, http.StatusConflict, CodeKeyAuditRunning)
+		return
+	}
+	h.running = true
+	report := h.report
+	h.mu.Unlock()
+
+	admin := auth.GetUserIDFromContext(r.Context())
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin key audit",
+		slog.String("audit", "keys.audit"),
+		slog.String("admin", admin),
+		slog.String("mode", mode),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+	)
+	// The audit outlives the request, keeping its values for tracing
+	go h.run(context.WithoutCancel(r.Context()), mode, admin)
+	writeJSON(w, http.StatusAccepted, KeyAuditResponse{Success: true, Running: true, Report: report})
+}
+
+// Report handles GET /api/v2/admin/keys/audit
+func (h *KeyAuditHandler) Report(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	resp := KeyAuditResponse{Success: true, Running: h.running, Report: h.report}
+	h.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// run audits the keys and keeps the report, recording what changed
+func (h *KeyAuditHandler) run(ctx context.Context, mode, admin string) {
+	report, err := h.auditor.AuditKeys(ctx, mode)
+	if err != nil && report.Error == "" {
+		report.Error = err.Error()
+	}
+	h.audit.LogAttrs(ctx, slog.LevelInfo, "admin key audit finished",
+		slog.String("audit", "keys.audit_finished"),
+		slog.String("admin", admin),
+		slog.String("mode", mode),
+		slog.Int("scanned", report.Scanned),
+		slog.Int("repaired", report.Repaired),
+		slog.Int("deleted", report.Deleted),
+		slog.Int("failed", report.Failed),
+		slog.String("error", report.Error),
+		slog.String("request_id", requestid.FromContext(ctx)),
+	)
+	h.mu.Lock()
+	h.running, h.report = false, &report
+	h.mu.Unlock()
+}
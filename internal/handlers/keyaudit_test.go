@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/nats"
+)
+
+// blockingAuditor audits once release is closed
+type blockingAuditor struct {
+	release chan struct{}
+	modes   chan string
+}
+
+func (a blockingAuditor) AuditKeys(ctx context.Context, mode string) (nats.KeyAudit, error) {
+	a.modes <- mode
+	<-a.release
+	return nats.KeyAudit{Mode: mode, Scanned: 3, Problems: map[string]int{nats.KeyUndecodable: 1}}, nil
+}
+
+func TestKeyAuditHandler(t *testing.T) {
+	auditor := blockingAuditor{release: make(chan struct{}), modes: make(chan string, 1)}
+	h := NewKeyAuditHandler(auditor, nil)
+
+	rr := httptest.NewRecorder()
+	h.Start(rr, httptest.NewRequest(http.MethodPost, "/api/v2/admin/keys/audit?mode=repair", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if mode := <-auditor.modes; mode != nats.AuditRepair {
+		t.Fatalf("expected a repair, got %q", mode)
+	}
+	rr = httptest.NewRecorder()
+	h.Start(rr, httptest.NewRequest(http.MethodPost, "/api/v2/admin/keys/audit", nil))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), CodeKeyAuditRunning) {
+		t.Fatalf("expected 409 while an audit runs, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	close(auditor.release)
+	var resp KeyAuditResponse
+	for deadline := time.Now().Add(time.Second); ; {
+		rr = httptest.NewRecorder()
+		h.Report(rr, httptest.NewRequest(http.MethodGet, "/api/v2/admin/keys/audit", nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !resp.Running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if resp.Running || resp.Report == nil || resp.Report.Mode != nats.AuditRepair || resp.Report.Scanned != 3 {
+		t.Fatalf("expected the finished repair's report, got %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	h.Start(rr, httptest.NewRequest(http.MethodPost, "/api/v2/admin/keys/audit?mode=purge", nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), CodeInvalidAuditMode) {
+		t.Fatalf("expected 400 for an unknown mode, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/logging"
+	"gopresence/internal/requestid"
+)
+
+// MaxLogLevelDuration caps how long a runtime log level change lasts
+const MaxLogLevelDuration = 24 * time.Hour
+
+// LogLevelRequest is the body of PUT /api/v2/admin/loglevel. Duration is a
+// Go duration such as "10m"; the handler's default applies if it is empty.
+type LogLevelRequest struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// LogLevelResponse is the body of the /api/v2/admin/loglevel routes
+type LogLevelResponse struct {
+	Success bool `json:"success"`
+	logging.LevelStatus
+}
+
+// LogLevelHandler lets admins change this node's log level for a while,
+// e.g. to capture debug logs during an incident without a restart
+type LogLevelHandler struct {
+	level    *logging.Level
+	duration time.Duration
+	audit    *slog.Logger
+}
+
+// NewLogLevelHandler creates a new LogLevelHandler; changes last duration
+// unless the request says otherwise, and are recorded to audit, slog's
+// default logger if nil
+func NewLogLevelHandler(level *logging.Level, duration time.Duration, audit *slog.Logger) *LogLevelHandler {
+	if audit == nil {
+		audit = slog.Default()
+	}
+	return &LogLevelHandler{level: level, duration: duration, audit: audit}
+}
+
+// Get handles GET /api/v2/admin/loglevel
+func (h *LogLevelHandler) Get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LogLevelResponse{Success: true, LevelStatus: h.level.Status()})
+}
+
+// Set handles PUT /api/v2/admin/loglevel
+func (h *LogLevelHandler) Set(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return
+	}
+	level, ok := logging.LookupLevel(req.Level)
+	if !ok {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidLogLevel)
+		return
+	}
+	d := h.duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 || d > MaxLogLevelDuration {
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidDuration, MaxLogLevelDuration)
+			return
+		}
+	}
+	if err := h.level.Override(level, d); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	h.record(r, "loglevel.set", slog.String("level", logging.LevelName(level)), slog.Duration("duration", d))
+	writeJSON(w, http.StatusOK, LogLevelResponse{Success: true, LevelStatus: h.level.Status()})
+}
+
+// Reset handles DELETE /api/v2/admin/loglevel, restoring the configured
+// level ahead of the revert
+func (h *LogLevelHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	h.level.Reset()
+	h.record(r, "loglevel.reset")
+	writeJSON(w, http.StatusOK, LogLevelResponse{Success: true, LevelStatus: h.level.Status()})
+}
+
+// record writes an audit entry for a level change
+func (h *LogLevelHandler) record(r *http.Request, action string, attrs ...slog.Attr) {
+	attrs = append([]slog.Attr{
+		slog.String("audit", action),
+		slog.String("admin", auth.GetUserIDFromContext(r.Context())),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+	}, attrs...)
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin log level change", attrs...)
+}
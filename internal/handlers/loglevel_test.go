@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/logging"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	var audit bytes.Buffer
+	lv := logging.NewLevel(slog.LevelInfo)
+	h := NewLogLevelHandler(lv, 15*time.Minute, slog.New(slog.NewTextHandler(&audit, nil)))
+
+	put := func(body string) (*httptest.ResponseRecorder, LogLevelResponse) {
+		rr := httptest.NewRecorder()
+		h.Set(rr, httptest.NewRequest(http.MethodPut, "/api/v2/admin/loglevel", strings.NewReader(body)))
+		var resp LogLevelResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	for _, body := range []string{`{bad`, `{"level":"verbose"}`, `{"level":"debug","duration":"-1m"}`, `{"level":"debug","duration":"48h"}`} {
+		if rr, _ := put(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, rr.Code)
+		}
+	}
+
+	rr, resp := put(`{"level":"debug"}`)
+	if rr.Code != http.StatusOK || resp.Level != "debug" || resp.Base != "info" || resp.RevertAt == nil {
+		t.Fatalf("expected debug override, got %d %s", rr.Code, rr.Body)
+	}
+	if left := time.Until(*resp.RevertAt); left <= 14*time.Minute || left > 15*time.Minute {
+		t.Fatalf("expected the default duration, reverting in %s", left)
+	}
+	if lv.Level() != slog.LevelDebug || !strings.Contains(audit.String(), "audit=loglevel.set") {
+		t.Fatalf("expected level applied and audited, got %v %q", lv.Level(), audit.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.Reset(rr, httptest.NewRequest(http.MethodDelete, "/api/v2/admin/loglevel", nil))
+	resp = LogLevelResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Level != "info" || resp.RevertAt != nil {
+		t.Fatalf("expected reset to info, got %s", rr.Body)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopresence/internal/i18n"
+)
+
+// ContentTypeNDJSON is the media type of streamed multi-user reads: one
+// JSON presence per line
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// DefaultNDJSONChunkSize is the number of users resolved per store read when
+// streaming NDJSON
+const DefaultNDJSONChunkSize = 100
+
+// BudgetChecker is implemented by services that refuse batch reads over a
+// store read budget. Streamed reads are split into several reads, so the
+// whole batch is checked once up front.
+type BudgetChecker interface {
+	CheckBatchBudget(userIDs []string) error
+}
+
+// WithNDJSONChunkSize sets how many users a streamed NDJSON read resolves
+// per store read; each chunk is written and flushed before the next is read
+func WithNDJSONChunkSize(n int) Option {
+	return func(h *PresenceHandler) {
+		if n > 0 {
+			h.ndjsonChunk = n
+		}
+	}
+}
+
+// ndjsonError is the last line of a stream that failed after it started
+type ndjsonError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// wantsNDJSON reports whether the Accept header asks for an NDJSON stream
+func wantsNDJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == ContentTypeNDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// streamMultiple writes the presences of userIDs as NDJSON, in request order
+// with unknown users omitted; userIDs must already be deduplicated. Users are resolved in chunks so
+// the first lines go out before the whole batch is read and only one chunk
+// is held in memory. Errors before the first chunk get a regular error
+// response; later ones end the stream with an {"error": ...} line.
+func (h *PresenceHandler) streamMultiple(w http.ResponseWriter, r *http.Request, userIDs []string, maxStale time.Duration, since time.Time) {
+	if bc, ok := h.service.(BudgetChecker); ok {
+		if err := bc.CheckBatchBudget(userIDs); err != nil {
+			writeStoreError(w, r, err, CodeGetMultipleFailed)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	started := false
+	for start := 0; start < len(userIDs); start += h.ndjsonChunk {
+		chunk := userIDs[start:min(start+h.ndjsonChunk, len(userIDs))]
+		presences, _, err := h.getMultiple(r.Context(), chunk, maxStale)
+		if err != nil {
+			if !started {
+				writeStoreError(w, r, err, CodeGetMultipleFailed)
+				return
+			}
+			lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+			enc.Encode(ndjsonError{Error: i18n.Message(lang, CodeGetMultipleFailed), Code: CodeGetMultipleFailed})
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		for _, userID := range chunk {
+			presence, ok := presences[userID]
+			if !ok || (!since.IsZero() && !presence.UpdatedAt.After(since)) {
+				continue
+			}
+			presence.UserID = userID
+			if err := enc.Encode(presence); err != nil {
+				return // Client went away
+			}
+		}
+		rc.Flush()
+	}
+}
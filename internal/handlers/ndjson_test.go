@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// chunkSvc records the batches it is asked for and fails from call failAt on
+type chunkSvc struct {
+	*mockPresenceService
+	calls  [][]string
+	failAt int
+	budget error
+}
+
+func (s *chunkSvc) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	s.calls = append(s.calls, userIDs)
+	if s.failAt > 0 && len(s.calls) >= s.failAt {
+		return nil, errors.New("db failed")
+	}
+	return s.mockPresenceService.GetMultiplePresences(ctx, userIDs)
+}
+
+func (s *chunkSvc) CheckBatchBudget(userIDs []string) error { return s.budget }
+
+func newChunkSvc() *chunkSvc {
+	s := &chunkSvc{mockPresenceService: newMockPresenceService()}
+	for _, id := range []string{"u1", "u2", "u3", "u5"} {
+		s.presences[id] = models.Presence{UserID: id, Status: models.StatusOnline}
+	}
+	return s
+}
+
+func batchNDJSON(h *PresenceHandler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/v2/presence/batch", strings.NewReader(body))
+	req.Header.Set("Accept", ContentTypeNDJSON)
+	rr := httptest.NewRecorder()
+	h.BatchPresence(rr, req)
+	return rr
+}
+
+func TestBatchPresence_NDJSON(t *testing.T) {
+	svc := newChunkSvc()
+	h := NewPresenceHandler(svc, WithNDJSONChunkSize(2))
+
+	rr := batchNDJSON(h, `{"user_ids":["u3","u1","u1","u4","u5","u2"]}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != ContentTypeNDJSON {
+		t.Fatalf("expected 200 NDJSON, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var got []string
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var p models.Presence
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatalf("bad line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, p.UserID)
+	}
+	if strings.Join(got, ",") != "u3,u1,u5,u2" {
+		t.Fatalf("expected request order without duplicates or unknown users, got %v", got)
+	}
+	if len(svc.calls) != 3 || strings.Join(svc.calls[1], ",") != "u4,u5" {
+		t.Fatalf("expected 3 chunked reads of the deduplicated IDs, got %v", svc.calls)
+	}
+	if rr.Header().Get("X-Deduplicated-IDs") != "1" {
+		t.Fatalf("expected the repeated ID to be counted, got %v", rr.Header())
+	}
+}
+
+func TestBatchPresence_NDJSONErrors(t *testing.T) {
+	// A failure before anything is written gets a regular error response
+	svc := newChunkSvc()
+	svc.failAt = 1
+	rr := batchNDJSON(NewPresenceHandler(svc, WithNDJSONChunkSize(2)), `{"user_ids":["u1","u2","u3"]}`)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+
+	// A later failure ends the stream with an error line
+	svc = newChunkSvc()
+	svc.failAt = 2
+	rr = batchNDJSON(NewPresenceHandler(svc, WithNDJSONChunkSize(2)), `{"user_ids":["u1","u2","u3"]}`)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if rr.Code != http.StatusOK || len(lines) != 3 || !strings.Contains(lines[2], `"error"`) {
+		t.Fatalf("expected two presences and an error line, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// The budget covers the whole batch, not each chunk
+	svc = newChunkSvc()
+	svc.budget = &apperrors.BudgetExceededError{Users: 3, EstimatedReads: 3, Budget: 2, MaxBatchSize: 2}
+	rr = batchNDJSON(NewPresenceHandler(svc, WithNDJSONChunkSize(2)), `{"user_ids":["u1","u2","u3"]}`)
+	if rr.Code != http.StatusRequestEntityTooLarge || len(svc.calls) != 0 {
+		t.Fatalf("expected 413 before any read, got %d after %d reads", rr.Code, len(svc.calls))
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gopresence/internal/models"
+)
+
+// Response headers identifying the serving node
+const (
+	HeaderNodeID      = "X-Node-ID"
+	HeaderNodeType    = "X-Node-Type"
+	HeaderNodeRegion  = "X-Node-Region"
+	HeaderNodeVersion = "X-Node-Version"
+)
+
+// WithNode sets the node recorded on presences written through the handler
+func WithNode(node models.NodeInfo) Option {
+	return func(h *PresenceHandler) { h.node = node }
+}
+
+// NodeHeaders returns middleware that reports the serving node on every
+// response, so callers can tell which center or leaf answered them
+func NodeHeaders(node models.NodeInfo, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setNodeHeaders(w.Header(), node)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setNodeHeaders(h http.Header, node models.NodeInfo) {
+	if node.ID != "" {
+		h.Set(HeaderNodeID, node.ID)
+	}
+	if node.Type != "" {
+		h.Set(HeaderNodeType, node.Type)
+	}
+	if node.Region != "" {
+		h.Set(HeaderNodeRegion, node.Region)
+	}
+	if node.Version != "" {
+		h.Set(HeaderNodeVersion, node.Version)
+	}
+}
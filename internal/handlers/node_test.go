@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/models"
+)
+
+func TestNodeHeadersAndSetPresenceNodeID(t *testing.T) {
+	node := models.NodeInfo{ID: "leaf-eu-1", Type: "leaf", Region: "eu-west", Version: "v2.1.0"}
+	svc := newMockPresenceService()
+	h := NewPresenceHandler(svc, WithNode(node))
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}", h.SetPresence).Methods("PUT")
+
+	req := httptest.NewRequest("PUT", "/api/v2/presence/u1", strings.NewReader(`{"status":"online"}`))
+	rr := httptest.NewRecorder()
+	NodeHeaders(node, r).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := svc.presences["u1"].NodeID; got != node.ID {
+		t.Fatalf("expected stored node id %q, got %q", node.ID, got)
+	}
+	if rr.Header().Get(HeaderNodeID) != node.ID || rr.Header().Get(HeaderNodeType) != "leaf" || rr.Header().Get(HeaderNodeRegion) != "eu-west" || rr.Header().Get(HeaderNodeVersion) != "v2.1.0" {
+		t.Fatalf("unexpected node headers: %v", rr.Header())
+	}
+
+	// Unset fields are omitted rather than sent empty
+	rr = httptest.NewRecorder()
+	NodeHeaders(models.NodeInfo{ID: "n1"}, http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if _, ok := rr.Header()[HeaderNodeRegion]; ok || rr.Header().Get(HeaderNodeID) != "n1" {
+		t.Fatalf("unexpected node headers: %v", rr.Header())
+	}
+}
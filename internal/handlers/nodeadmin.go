@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/requestid"
+)
+
+// NodeOperator flushes this node's cache and reports its status
+type NodeOperator interface {
+	FlushCache() int
+	Status(ctx context.Context) any
+}
+
+// NodeStatusResponse is the body of GET /api/v2/admin/status
+type NodeStatusResponse struct {
+	Success bool `json:"success"`
+	Node    any  `json:"node"`
+}
+
+// CacheFlushResponse is the body of POST /api/v2/admin/cache/flush
+type CacheFlushResponse struct {
+	Success bool `json:"success"`
+	Flushed int  `json:"flushed"` // Entries the cache held, approximately
+}
+
+// NodeAdminHandler lets admins inspect and flush the node serving the
+// request, named in X-Node-ID
+type NodeAdminHandler struct {
+	node  NodeOperator
+	audit *slog.Logger
+}
+
+// NewNodeAdminHandler creates a new NodeAdminHandler; flushes are recorded
+// to audit, slog's default logger if nil
+func NewNodeAdminHandler(node NodeOperator, audit *slog.Logger) *NodeAdminHandler {
+	if audit == nil {
+		audit = slog.Default()
+	}
+	return &NodeAdminHandler{node: node, audit: audit}
+}
+
+// Status handles GET /api/v2/admin/status: the node's NATS connection,
+// cache and write-behind queue, and the bucket's cluster and replication
+// state read afresh
+func (h *NodeAdminHandler) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, NodeStatusResponse{Success: true, Node: h.node.Status(r.Context())})
+}
+
+// FlushCache handles POST /api/v2/admin/cache/flush, emptying the node's
+// cache so every presence is read from the store again, e.g. after
+// repairing the bucket by hand
+func (h *NodeAdminHandler) FlushCache(w http.ResponseWriter, r *http.Request) {
+	n := h.node.FlushCache()
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin cache flush",
+		slog.String("audit", "cache.flush"),
+		slog.String("admin", auth.GetUserIDFromContext(r.Context())),
+		slog.Int("flushed", n),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+	)
+	writeJSON(w, http.StatusOK, CacheFlushResponse{Success: true, Flushed: n})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopresence/internal/auth"
+)
+
+type fakeNode struct {
+	flushes int
+}
+
+func (n *fakeNode) FlushCache() int { n.flushes++; return 42 }
+
+func (n *fakeNode) Status(ctx context.Context) any {
+	return map[string]any{"node_id": "n1", "connected": true}
+}
+
+func TestNodeAdminHandler(t *testing.T) {
+	node := &fakeNode{}
+	var audit bytes.Buffer
+	h := NewNodeAdminHandler(node, slog.New(slog.NewJSONHandler(&audit, nil)))
+
+	rr := httptest.NewRecorder()
+	h.Status(rr, httptest.NewRequest(http.MethodGet, "/api/v2/admin/status", nil))
+	var status struct {
+		Success bool           `json:"success"`
+		Node    map[string]any `json:"node"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil || rr.Code != http.StatusOK || !status.Success || status.Node["node_id"] != "n1" {
+		t.Fatalf("unexpected status %d %s", rr.Code, rr.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/admin/cache/flush", nil)
+	rr = httptest.NewRecorder()
+	h.FlushCache(rr, req.WithContext(auth.SetUserIDInContext(req.Context(), "ops1")))
+	var flush CacheFlushResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &flush); err != nil || !flush.Success || flush.Flushed != 42 || node.flushes != 1 {
+		t.Fatalf("unexpected flush %d %s", rr.Code, rr.Body.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil || entry["audit"] != "cache.flush" || entry["admin"] != "ops1" || entry["flushed"] != float64(42) {
+		t.Fatalf("unexpected audit record %q", audit.String())
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// Patcher is implemented by services that can merge a partial update into
+// a stored presence
+type Patcher interface {
+	// PatchPresence merges patch into the user's presence, if revision is
+	// nonzero only while it is at that revision, and returns what it stored
+	PatchPresence(ctx context.Context, userID string, patch models.PresencePatch, revision uint64) (models.Presence, error)
+}
+
+// PatchPresenceRequest is the body of a partial update; fields left out keep
+// their stored value
+type PatchPresenceRequest struct {
+	Status        *models.PresenceStatus `json:"status,omitempty"`
+	Message       *string                `json:"message,omitempty"`
+	TTL           int64                  `json:"ttl,omitempty"` // New TTL in seconds; 0 keeps the current one
+	Client        *models.ClientInfo     `json:"client,omitempty"`
+	TimeZone      *string                `json:"time_zone,omitempty"`
+	CorrelationID *string                `json:"correlation_id,omitempty"`
+}
+
+// patch returns the service-level patch of req
+func (req PatchPresenceRequest) patch() models.PresencePatch {
+	return models.PresencePatch{
+		Status:        req.Status,
+		Message:       req.Message,
+		TTL:           time.Duration(req.TTL) * time.Second,
+		Client:        req.Client,
+		TimeZone:      req.TimeZone,
+		CorrelationID: req.CorrelationID,
+	}
+}
+
+// PatchPresence handles PATCH /api/v2/presence/{user_id}, merging the fields
+// of the body into the user's presence and answering with the result, e.g.
+// {"message":"in a meeting"} changes the message and keeps the status. Unlike
+// a PUT, last_seen and the TTL stay as they were unless the body changes the
+// status or sets a TTL. A user without a live presence gets 404. If-Match
+// and ?dry_run=true work as on PUT.
+func (h *PresenceHandler) PatchPresence(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	if userID == "" {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeUserIDRequired)
+		return
+	}
+	var req PatchPresenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return
+	}
+	patch := req.patch()
+	switch {
+	case patch.IsEmpty():
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeEmptyPatch)
+		return
+	case req.Status != nil && !req.Status.IsValid():
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidStatus)
+		return
+	case !validTTL(req.TTL):
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidTTL)
+		return
+	case req.TimeZone != nil && models.ValidateTimeZone(*req.TimeZone) != nil:
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidTimeZone, *req.TimeZone)
+		return
+	case req.CorrelationID != nil && models.ValidateCorrelationID(*req.CorrelationID) != nil:
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidCorrelationID, models.MaxCorrelationIDLength)
+		return
+	}
+	if err := validateClient(req.Client); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	dry, err := parseDryRun(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	ifMatch, err := parseIfMatch(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	p, ok := h.service.(Patcher)
+	if !ok {
+		writeErrorResponse(w, r, http.StatusNotImplemented, CodePatchUnavailable)
+		return
+	}
+
+	if dry {
+		h.dryRunPatch(w, r, userID, patch, ifMatch)
+		return
+	}
+	presence, err := p.PatchPresence(r.Context(), h.storeID(userID), patch, ifMatch)
+	if err != nil {
+		if apperrors.IsNotFound(err) {
+			writeErrorResponse(w, r, http.StatusNotFound, CodePresenceNotFound, userID)
+			return
+		}
+		writeStoreError(w, r, err, CodeSetFailed)
+		return
+	}
+	presence.UserID = userID
+	setETag(w, presence)
+	writeResponse(w, r, http.StatusOK, models.PresenceResponse{
+		Success: true,
+		Data:    map[string]models.Presence{userID: presence},
+	})
+}
+
+// dryRunPatch answers a dry-run partial update with the presence it would
+// store, merged into the current one
+func (h *PresenceHandler) dryRunPatch(w http.ResponseWriter, r *http.Request, userID string, patch models.PresencePatch, ifMatch uint64) {
+	current, err := h.service.GetPresence(r.Context(), h.storeID(userID))
+	if err != nil {
+		if apperrors.IsNotFound(err) {
+			writeErrorResponse(w, r, http.StatusNotFound, CodePresenceNotFound, userID)
+			return
+		}
+		writeStoreError(w, r, err, CodeGetFailed)
+		return
+	}
+	if ifMatch != 0 && current.Revision != ifMatch {
+		writeErrorResponse(w, r, http.StatusPreconditionFailed, CodePresenceModified)
+		return
+	}
+	next := current
+	patch.Apply(&next, time.Now().UTC())
+	next.NodeID, next.Source = h.node.ID, models.SourceAPI
+	next.Annotations = nil
+	next.Revision, next.StoredAt = 0, time.Time{}
+	if dr, ok := h.service.(DryRunner); ok {
+		checked, err := dr.CheckPresence(r.Context(), next.UserID, next)
+		if err != nil {
+			writeStoreError(w, r, err, CodeSetFailed)
+			return
+		}
+		// The checks are a full write's, which moves last_seen
+		checked.LastSeen = next.LastSeen
+		next = checked
+	}
+
+	next.UserID, current.UserID = userID, userID
+	writeDryRun(w, r, DryRunResponse{
+		Success:  true,
+		DryRun:   true,
+		Data:     map[string]models.Presence{userID: next},
+		Previous: map[string]models.Presence{userID: current},
+		Changes:  presenceChanges(&current, next),
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// patchService merges partial updates like the service, at a revision per write
+type patchService struct {
+	*revisionService
+}
+
+func (s *patchService) PatchPresence(ctx context.Context, userID string, patch models.PresencePatch, revision uint64) (models.Presence, error) {
+	current, ok := s.presences[userID]
+	if !ok {
+		return models.Presence{}, apperrors.NotFound(userID)
+	}
+	patch.Apply(&current, time.Now().UTC())
+	return s.SetPresenceAtRevision(ctx, userID, current, revision)
+}
+
+func TestPatchPresence(t *testing.T) {
+	svc := &patchService{&revisionService{mockPresenceService: newMockPresenceService()}}
+	lastSeen := time.Now().UTC().Add(-time.Minute)
+	svc.presences["alice"] = models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "focus", TTL: time.Hour, LastSeen: lastSeen, Revision: 1}
+	svc.revision = 1
+	h := NewPresenceHandler(svc)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/presence/{user_id}", h.PatchPresence).Methods(http.MethodPatch)
+	patch := func(user, query, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v2/presence/"+user+query, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := patch("alice", "", "", `{"message":"back at 3pm"}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the merged write with its ETag, got %d %q: %s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	var resp models.PresenceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if p := resp.Data["alice"]; p.Status != models.StatusBusy || p.Message != "back at 3pm" || p.TTL != time.Hour || !p.LastSeen.Equal(lastSeen) {
+		t.Fatalf("expected only the message changed, got %+v", p)
+	}
+
+	if rr := patch("alice", "?dry_run=true", "", `{"status":"away"}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"changes":["status"]`) {
+		t.Fatalf("expected a dry run changing the status, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if svc.presences["alice"].Status != models.StatusBusy {
+		t.Fatal("expected the dry run not stored")
+	}
+	if rr := patch("alice", "", `"1"`, `{"status":"away"}`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 at a stale revision, got %d", rr.Code)
+	}
+	if rr := patch("alice", "", `"2"`, `{"status":"away"}`); rr.Code != http.StatusOK || svc.presences["alice"].Status != models.StatusAway {
+		t.Fatalf("expected the write at the current revision, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, tc := range []struct {
+		user, body, code string
+		status           int
+	}{
+		{"alice", `{}`, CodeEmptyPatch, http.StatusBadRequest},
+		{"alice", `{"status":"sleeping"}`, CodeInvalidStatus, http.StatusBadRequest},
+		{"alice", `{"ttl":-1}`, CodeInvalidTTL, http.StatusBadRequest},
+		{"alice", `{"time_zone":"Mars/Olympus"}`, CodeInvalidTimeZone, http.StatusBadRequest},
+		{"alice", `not json`, CodeInvalidJSON, http.StatusBadRequest},
+		{"bob", `{"message":"hi"}`, CodePresenceNotFound, http.StatusNotFound},
+	} {
+		if rr := patch(tc.user, "", "", tc.body); rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Errorf("%s: expected %d %s, got %d: %s", tc.body, tc.status, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Services that can't merge refuse rather than overwrite
+	plain := NewPresenceHandler(newMockPresenceService())
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPatch, "/api/v2/presence/alice", strings.NewReader(`{"message":"hi"}`)), map[string]string{"user_id": "alice"})
+	rr = httptest.NewRecorder()
+	plain.PatchPresence(rr, req)
+	if rr.Code != http.StatusNotImplemented || !strings.Contains(rr.Body.String(), CodePatchUnavailable) {
+		t.Fatalf("expected 501, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
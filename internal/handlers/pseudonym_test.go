@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/models"
+	"gopresence/internal/privacy"
+)
+
+func TestPseudonymizedMode_StoresHashedIDs(t *testing.T) {
+	svc := newMockPresenceService()
+	p, _ := privacy.NewPseudonymizer("test-key")
+	h := NewPresenceHandler(svc, WithPseudonymizer(p))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
+	r.HandleFunc("/api/v2/presence/{user_id}", h.SetPresence).Methods("PUT")
+	r.HandleFunc("/api/v2/presence", h.GetMultiplePresences).Methods("GET")
+
+	req := httptest.NewRequest("PUT", "/api/v2/presence/alice", bytes.NewBufferString(`{"status":"online"}`))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	// The service only ever sees the pseudonym
+	if _, ok := svc.presences["alice"]; ok {
+		t.Fatal("raw user ID must not reach the service")
+	}
+	stored, ok := svc.presences[p.Pseudonymize("alice")]
+	if !ok {
+		t.Fatal("expected presence stored under pseudonym")
+	}
+	if stored.UserID != p.Pseudonymize("alice") {
+		t.Fatalf("expected stored UserID to be pseudonymized, got %s", stored.UserID)
+	}
+
+	// Responses are keyed by the caller's IDs
+	req = httptest.NewRequest("GET", "/api/v2/presence/alice", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var resp models.PresenceResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if got := resp.Data["alice"].UserID; got != "alice" {
+		t.Fatalf("expected user_id alice in response, got %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v2/presence?users=alice,bob", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	resp = models.PresenceResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data["alice"].UserID != "alice" {
+		t.Fatalf("unexpected multi response: %+v", resp.Data)
+	}
+
+	// Not-found errors do not leak the pseudonym
+	req = httptest.NewRequest("GET", "/api/v2/presence/bob", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), p.Pseudonymize("bob")) {
+		t.Fatalf("unexpected not-found response: %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/quota"
+)
+
+// UsageReporter reports a tenant's quota usage on the day and month of at
+type UsageReporter interface {
+	Usage(ctx context.Context, tenant string, at time.Time) (quota.Usage, error)
+}
+
+// UsageResponse is the body of GET /api/v2/quota/usage
+type UsageResponse struct {
+	Success bool         `json:"success"`
+	Usage   *quota.Usage `json:"usage,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// QuotaHandler serves quota usage for billing
+type QuotaHandler struct {
+	usage UsageReporter
+}
+
+// NewQuotaHandler creates a new QuotaHandler
+func NewQuotaHandler(usage UsageReporter) *QuotaHandler {
+	return &QuotaHandler{usage: usage}
+}
+
+// Usage handles GET /api/v2/quota/usage?date=YYYY-MM-DD&tenant=...
+// Callers see their own tenant's usage; ?tenant= needs the admin scope. The
+// date defaults to today (UTC) and selects the day and month reported.
+func (h *QuotaHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	tenant := auth.GetTenantFromContext(r.Context())
+	if tenant == "" {
+		writeJSON(w, http.StatusUnauthorized, UsageResponse{Error: "authentication required"})
+		return
+	}
+	q := r.URL.Query()
+	if v := q.Get("tenant"); v != "" && v != tenant {
+		if !auth.HasScope(r.Context(), auth.ScopeAdmin) {
+			writeJSON(w, http.StatusForbidden, UsageResponse{Error: "admin scope required for other tenants"})
+			return
+		}
+		tenant = v
+	}
+	at := time.Now().UTC()
+	if v := q.Get("date"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, UsageResponse{Error: "invalid date: expected YYYY-MM-DD"})
+			return
+		}
+		at = d
+	}
+
+	usage, err := h.usage.Usage(r.Context(), tenant, at)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, UsageResponse{Error: "failed to read quota usage"})
+		return
+	}
+	writeJSON(w, http.StatusOK, UsageResponse{Success: true, Usage: &usage})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/quota"
+)
+
+type fakeUsage struct {
+	tenant string
+	at     time.Time
+}
+
+func (f *fakeUsage) Usage(ctx context.Context, tenant string, at time.Time) (quota.Usage, error) {
+	f.tenant, f.at = tenant, at
+	return quota.Usage{Tenant: tenant, Day: quota.PeriodUsage{Period: at.Format("2006-01-02"), Total: 7}}, nil
+}
+
+func TestQuotaHandler_Usage(t *testing.T) {
+	fu := &fakeUsage{}
+	h := NewQuotaHandler(fu)
+	serve := func(ctx context.Context, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/quota/usage"+query, nil)
+		rr := httptest.NewRecorder()
+		h.Usage(rr, req.WithContext(ctx))
+		return rr
+	}
+	caller := auth.SetTenantInContext(context.Background(), "acme")
+
+	if rr := serve(context.Background(), ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for anonymous caller, got %d", rr.Code)
+	}
+	rr := serve(caller, "?date=2026-09-30")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp UsageResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Usage == nil || resp.Usage.Day.Total != 7 {
+		t.Fatalf("unexpected response %+v %v", resp, err)
+	}
+	if fu.tenant != "acme" || fu.at.Format("2006-01-02") != "2026-09-30" {
+		t.Fatalf("expected acme on 2026-09-30, got %s %v", fu.tenant, fu.at)
+	}
+	if rr := serve(caller, "?date=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad date, got %d", rr.Code)
+	}
+
+	// Other tenants need the admin scope
+	if rr := serve(caller, "?tenant=globex"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if rr := serve(auth.SetScopesInContext(caller, []string{auth.ScopeAdmin}), "?tenant=globex"); rr.Code != http.StatusOK || fu.tenant != "globex" {
+		t.Fatalf("expected admin to read globex, got %d %s", rr.Code, fu.tenant)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/i18n"
+	"gopresence/internal/index"
+	"gopresence/internal/models"
+	"gopresence/internal/requestid"
+)
+
+// MaxReconcileUsers caps the desired state of one reconcile call
+const MaxReconcileUsers = 5000
+
+// Reconcile actions
+const (
+	ReconcileCreated = "created" // The user had no presence
+	ReconcileUpdated = "updated" // The user's status differed
+	ReconcileDeleted = "deleted" // The user was in the namespace but not the desired state
+)
+
+// ReconcileRequest is the desired state of every user in a namespace
+type ReconcileRequest struct {
+	Namespace string                           `json:"namespace"` // Prefix of the user IDs the call owns
+	Presences map[string]models.PresenceStatus `json:"presences"` // Desired status by user ID
+}
+
+// ReconcileResult is the outcome of one change a reconcile call made. Status
+// is the HTTP status the same write or delete would have been answered with
+// on its own.
+type ReconcileResult struct {
+	UserID  string `json:"user_id"`
+	Action  string `json:"action"`
+	Success bool   `json:"success"`
+	Status  int    `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// ReconcileResponse lists the changes of a reconcile call by user ID.
+// Success is true only if every change was applied, or on a dry run would
+// have been.
+type ReconcileResponse struct {
+	Success   bool              `json:"success"`
+	DryRun    bool              `json:"dry_run,omitempty"`
+	Results   []ReconcileResult `json:"results"`
+	Applied   int               `json:"applied"`
+	Failed    int               `json:"failed"`
+	Unchanged int               `json:"unchanged"`
+}
+
+// WithIndex lets the handler reconcile presences against the watch-maintained
+// index of current presences
+func WithIndex(idx *index.Index) Option {
+	return func(h *PresenceHandler) { h.index = idx }
+}
+
+// Reconcile handles POST /api/v2/presence/reconcile, bringing the presences
+// of a namespace, the users whose IDs start with it, in line with a desired
+// state from an external source of truth. Users whose status differs are
+// written with source=sync, users in the namespace but not the desired state
+// are deleted, and the rest are left alone. Current state comes from the
+// index, so nothing is scanned. Each change is applied on its own: a failed
+// one doesn't stop the rest. With ?dry_run=true the changes are checked and
+// listed but none is applied. Like the admin routes, it needs the admin
+// scope, and every applied call is recorded in the audit log.
+func (h *PresenceHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	admin := auth.GetUserIDFromContext(r.Context())
+	if admin == "" || !auth.HasScope(r.Context(), auth.ScopeAdmin) {
+		writeErrorResponse(w, r, http.StatusForbidden, CodeAdminScopeRequired)
+		return
+	}
+	// Namespaces are user ID prefixes, which pseudonyms don't keep
+	deleter, ok := h.service.(PresenceDeleter)
+	if !ok || h.index == nil || h.pseudonymizer != nil {
+		writeErrorResponse(w, r, http.StatusNotImplemented, CodeReconcileUnavailable)
+		return
+	}
+	dry, err := parseDryRun(r)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	var req ReconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON)
+		return
+	}
+	if req.Namespace == "" || !validKeyID(req.Namespace+"x") {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeNamespaceRequired)
+		return
+	}
+	if len(req.Presences) > MaxReconcileUsers {
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, CodeBatchTooLarge, MaxReconcileUsers)
+		return
+	}
+	// The desired state is applied whole or not at all, so any invalid entry fails the call
+	for userID, status := range req.Presences {
+		switch {
+		case !validKeyID(userID):
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidUserID)
+			return
+		case !strings.HasPrefix(userID, req.Namespace):
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeUserOutsideNamespace, userID, req.Namespace)
+			return
+		case !status.IsValid():
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidStatus)
+			return
+		}
+	}
+
+	current := make(map[string]models.PresenceStatus)
+	presences, _ := h.index.List(index.Filter{Prefix: req.Namespace}, "", 0)
+	for _, p := range presences {
+		current[p.UserID] = p.Status
+	}
+	userIDs := make([]string, 0, len(req.Presences)+len(current))
+	for userID := range req.Presences {
+		userIDs = append(userIDs, userID)
+	}
+	for userID := range current {
+		if _, ok := req.Presences[userID]; !ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	resp := ReconcileResponse{DryRun: dry, Results: []ReconcileResult{}}
+	for _, userID := range userIDs {
+		desired, wanted := req.Presences[userID]
+		status, exists := current[userID]
+		res := ReconcileResult{UserID: userID, Status: http.StatusOK}
+		var err error
+		switch {
+		case wanted && exists && status == desired:
+			resp.Unchanged++
+			continue
+		case !wanted:
+			res.Action = ReconcileDeleted
+			if !dry {
+				err = deleter.DeletePresence(r.Context(), userID)
+			}
+		default:
+			res.Action = ReconcileUpdated
+			if !exists {
+				res.Action = ReconcileCreated
+			}
+			presence := h.newPresence(userID, SetPresenceRequest{Status: desired}, models.SourceSync)
+			if !dry {
+				err = h.service.SetPresence(r.Context(), userID, presence)
+			} else if dr, ok := h.service.(DryRunner); ok {
+				_, err = dr.CheckPresence(r.Context(), userID, presence)
+			}
+		}
+		if err != nil {
+			var failure *i18n.Error
+			code := CodeSetFailed
+			if res.Action == ReconcileDeleted {
+				code = CodeDeleteFailed
+			}
+			res.Status, failure = storeErrorStatus(err, code)
+			res.Code, res.Error = failure.Code, i18n.Message(lang, failure.Code, failure.Args...)
+			resp.Failed++
+		} else {
+			res.Success = true
+			resp.Applied++
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	if resp.Failed > 0 {
+		i18n.SetContentLanguage(w, lang)
+	}
+	resp.Success = resp.Failed == 0
+
+	if !dry {
+		h.audit.LogAttrs(r.Context(), slog.LevelInfo, "presence reconcile",
+			slog.String("audit", "presence.reconcile"),
+			slog.String("admin", admin),
+			slog.String("namespace", req.Namespace),
+			slog.Int("applied", resp.Applied),
+			slog.Int("failed", resp.Failed),
+			slog.Int("unchanged", resp.Unchanged),
+			slog.String("request_id", requestid.FromContext(r.Context())),
+		)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+	"gopresence/internal/index"
+	"gopresence/internal/models"
+)
+
+func reconcileRequest(t *testing.T, h *PresenceHandler, query, body string) (*httptest.ResponseRecorder, ReconcileResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/presence/reconcile"+query, strings.NewReader(body))
+	ctx := auth.SetScopesInContext(auth.SetUserIDInContext(req.Context(), "sync1"), []string{auth.ScopeAdmin})
+	rr := httptest.NewRecorder()
+	h.Reconcile(rr, req.WithContext(ctx))
+	var resp ReconcileResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func TestReconcile(t *testing.T) {
+	svc := deletingService{newMockPresenceService()}
+	idx := index.New(0)
+	for id, st := range map[string]models.PresenceStatus{
+		"acme/a": models.StatusOnline, "acme/b": models.StatusAway, "acme/c": models.StatusBusy, "other/d": models.StatusOnline,
+	} {
+		p := models.Presence{UserID: id, Status: st, UpdatedAt: time.Now()}
+		svc.presences[id] = p
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &p})
+	}
+	var audit bytes.Buffer
+	h := NewPresenceHandler(svc, WithIndex(idx), WithAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil))))
+
+	body := `{"namespace":"acme/","presences":{"acme/a":"online","acme/b":"busy","acme/e":"away"}}`
+	rr, resp := reconcileRequest(t, h, "?dry_run=true", body)
+	if rr.Code != http.StatusOK || !resp.Success || !resp.DryRun || resp.Applied != 3 {
+		t.Fatalf("dry run: expected 3 changes, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if svc.presences["acme/b"].Status != models.StatusAway || audit.Len() != 0 {
+		t.Fatal("dry run must not write or audit")
+	}
+
+	rr, resp = reconcileRequest(t, h, "", body)
+	if rr.Code != http.StatusOK || !resp.Success || resp.Applied != 3 || resp.Unchanged != 1 {
+		t.Fatalf("expected 3 applied and 1 unchanged, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := []ReconcileResult{
+		{UserID: "acme/b", Action: ReconcileUpdated, Success: true, Status: http.StatusOK},
+		{UserID: "acme/c", Action: ReconcileDeleted, Success: true, Status: http.StatusOK},
+		{UserID: "acme/e", Action: ReconcileCreated, Success: true, Status: http.StatusOK},
+	}
+	for i, res := range resp.Results {
+		if res != want[i] {
+			t.Errorf("result %d: expected %+v, got %+v", i, want[i], res)
+		}
+	}
+	if p := svc.presences["acme/e"]; p.Status != models.StatusAway || p.Source != models.SourceSync {
+		t.Errorf("expected acme/e away with source sync, got %+v", p)
+	}
+	if _, ok := svc.presences["acme/c"]; ok {
+		t.Error("expected acme/c deleted")
+	}
+	if _, ok := svc.presences["other/d"]; !ok {
+		t.Error("expected other/d outside the namespace kept")
+	}
+	if !strings.Contains(audit.String(), `"namespace":"acme/"`) {
+		t.Errorf("expected an audit record, got %q", audit.String())
+	}
+}
+
+func TestReconcile_Invalid(t *testing.T) {
+	h := NewPresenceHandler(deletingService{newMockPresenceService()}, WithIndex(index.New(0)))
+	for name, tc := range map[string]struct {
+		body string
+		code string
+	}{
+		"no namespace":      {`{"presences":{"acme/a":"online"}}`, CodeNamespaceRequired},
+		"outside namespace": {`{"namespace":"acme/","presences":{"other/a":"online"}}`, CodeUserOutsideNamespace},
+		"bad status":        {`{"namespace":"acme/","presences":{"acme/a":"gone"}}`, CodeInvalidStatus},
+	} {
+		rr, _ := reconcileRequest(t, h, "", tc.body)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Errorf("%s: expected 400 %s, got %d: %s", name, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr, _ := reconcileRequest(t, NewPresenceHandler(deletingService{newMockPresenceService()}), "", `{"namespace":"acme/"}`)
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("without an index: expected 501, got %d", rr.Code)
+	}
+}
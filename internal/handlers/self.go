@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+)
+
+// Self serves /api/v2/presence/me from next, the /api/v2/presence/{user_id}
+// route, with the authenticated caller as the user ID, so clients needn't
+// know the ID their presence is kept under. Both the route variable and the
+// path are rewritten, so hand-written and gateway routes see the same
+// request. Anonymous callers are answered 401.
+func Self(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.GetUserIDFromContext(r.Context())
+		if userID == "" {
+			writeErrorResponse(w, r, http.StatusUnauthorized, CodeAuthenticationRequired)
+			return
+		}
+		r = mux.SetURLVars(r, map[string]string{"user_id": userID})
+		u := *r.URL
+		dir := path.Dir(u.Path)
+		u.Path, u.RawPath = dir+"/"+userID, dir+"/"+url.PathEscape(userID)
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
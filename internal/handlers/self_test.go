@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/models"
+)
+
+func TestSelf(t *testing.T) {
+	service := newMockPresenceService()
+	h := NewPresenceHandler(service)
+	var path string
+	route := Self(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Method == http.MethodPut {
+			h.SetPresence(w, r)
+			return
+		}
+		h.GetPresence(w, r)
+	}))
+	router := mux.NewRouter()
+	router.Handle("/api/v2/presence/me", route).Methods(http.MethodGet, http.MethodPut)
+
+	as := func(userID string, req *http.Request) *httptest.ResponseRecorder {
+		if userID != "" {
+			req = req.WithContext(auth.SetUserIDInContext(req.Context(), userID))
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := as("alice", httptest.NewRequest(http.MethodPut, "/api/v2/presence/me", strings.NewReader(`{"status":"busy"}`)))
+	if rr.Code != http.StatusOK || path != "/api/v2/presence/alice" {
+		t.Fatalf("PUT me: %d at %q: %s", rr.Code, path, rr.Body)
+	}
+	if p, ok := service.presences["alice"]; !ok || p.Status != models.StatusBusy {
+		t.Fatalf("expected alice's presence to be written, got %+v", service.presences)
+	}
+	if rr := as("alice", httptest.NewRequest(http.MethodGet, "/api/v2/presence/me", nil)); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"alice"`) {
+		t.Fatalf("GET me: %d %s", rr.Code, rr.Body)
+	}
+	if rr := as("", httptest.NewRequest(http.MethodGet, "/api/v2/presence/me", nil)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an anonymous caller, got %d", rr.Code)
+	}
+}
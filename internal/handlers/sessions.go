@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/requestid"
+	"gopresence/internal/stream"
+)
+
+// SessionRegistry lists and closes the node's stream sessions
+type SessionRegistry interface {
+	ListSessions(userID string) []stream.SessionInfo
+	Disconnect(id string) bool
+	Revoke(id string) bool
+	DisconnectUser(userID string) int
+}
+
+// SessionsResponse is the body of the /api/v2/admin/sessions routes
+type SessionsResponse struct {
+	Success      bool                 `json:"success"`
+	Sessions     []stream.SessionInfo `json:"sessions,omitempty"`
+	Disconnected int                  `json:"disconnected,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// SessionsHandler lets admins inspect and close stream sessions, e.g. for
+// abuse handling or before draining a node. Sessions are per node: the
+// routes act on the node serving the request, named in X-Node-ID.
+type SessionsHandler struct {
+	registry SessionRegistry
+	audit    *slog.Logger
+}
+
+// NewSessionsHandler creates a new SessionsHandler; disconnects are recorded
+// to audit, slog's default logger if nil
+func NewSessionsHandler(registry SessionRegistry, audit *slog.Logger) *SessionsHandler {
+	if audit == nil {
+		audit = slog.Default()
+	}
+	return &SessionsHandler{registry: registry, audit: audit}
+}
+
+// List handles GET /api/v2/admin/sessions[?user_id=...]
+func (h *SessionsHandler) List(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, SessionsResponse{Success: true, Sessions: h.registry.ListSessions(r.URL.Query().Get("user_id"))})
+}
+
+// Disconnect handles DELETE /api/v2/admin/sessions/{session_id}, and
+// DELETE /api/v2/admin/sessions?user_id=... to close every session of a
+// user. Closed sessions can't be resumed. With ?offline=true a single
+// session is revoked instead, e.g. for a lost device: its user goes offline
+// at once unless connected elsewhere.
+func (h *SessionsHandler) Disconnect(w http.ResponseWriter, r *http.Request) {
+	id, userID := mux.Vars(r)["session_id"], r.URL.Query().Get("user_id")
+	revoke := r.URL.Query().Get("offline") == "true"
+	var n int
+	switch {
+	case id != "" && revoke:
+		if h.registry.Revoke(id) {
+			n = 1
+		}
+	case id != "":
+		if h.registry.Disconnect(id) {
+			n = 1
+		}
+	case userID != "":
+		n = h.registry.DisconnectUser(userID)
+	default:
+		writeJSON(w, http.StatusBadRequest, SessionsResponse{Error: "session_id or user_id is required"})
+		return
+	}
+
+	h.audit.LogAttrs(r.Context(), slog.LevelInfo, "admin stream disconnect",
+		slog.String("audit", "stream.disconnect"),
+		slog.String("admin", auth.GetUserIDFromContext(r.Context())),
+		slog.String("session_id", id),
+		slog.String("user_id", userID),
+		slog.Bool("offline", revoke),
+		slog.Int("disconnected", n),
+		slog.String("request_id", requestid.FromContext(r.Context())),
+	)
+	if id != "" && n == 0 {
+		writeJSON(w, http.StatusNotFound, SessionsResponse{Error: "session not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, SessionsResponse{Success: true, Disconnected: n})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/stream"
+)
+
+type fakeRegistry struct {
+	sessions []stream.SessionInfo
+	closed   []string
+	revoked  []string
+}
+
+func (f *fakeRegistry) ListSessions(userID string) []stream.SessionInfo {
+	var out []stream.SessionInfo
+	for _, s := range f.sessions {
+		if userID == "" || s.UserID == userID {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (f *fakeRegistry) Disconnect(id string) bool {
+	for _, s := range f.sessions {
+		if s.ID == id {
+			f.closed = append(f.closed, id)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeRegistry) Revoke(id string) bool {
+	if !f.Disconnect(id) {
+		return false
+	}
+	f.revoked = append(f.revoked, id)
+	return true
+}
+
+func (f *fakeRegistry) DisconnectUser(userID string) int {
+	n := 0
+	for _, s := range f.ListSessions(userID) {
+		if f.Disconnect(s.ID) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSessionsHandler(t *testing.T) {
+	reg := &fakeRegistry{sessions: []stream.SessionInfo{{ID: "s1", UserID: "alice"}, {ID: "s2", UserID: "alice"}, {ID: "s3", UserID: "bob"}}}
+	h := NewSessionsHandler(reg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/admin/sessions", h.List).Methods(http.MethodGet)
+	router.HandleFunc("/api/v2/admin/sessions", h.Disconnect).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v2/admin/sessions/{session_id}", h.Disconnect).Methods(http.MethodDelete)
+	serve := func(method, target string) (int, SessionsResponse) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		var resp SessionsResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+
+	if code, resp := serve(http.MethodGet, "/api/v2/admin/sessions?user_id=alice"); code != http.StatusOK || len(resp.Sessions) != 2 {
+		t.Fatalf("expected alice's 2 sessions, got %d %+v", code, resp)
+	}
+	if code, resp := serve(http.MethodDelete, "/api/v2/admin/sessions/s3"); code != http.StatusOK || resp.Disconnected != 1 {
+		t.Fatalf("expected s3 closed, got %d %+v", code, resp)
+	}
+	if code, resp := serve(http.MethodDelete, "/api/v2/admin/sessions/s2?offline=true"); code != http.StatusOK || resp.Disconnected != 1 || len(reg.revoked) != 1 || reg.revoked[0] != "s2" {
+		t.Fatalf("expected s2 revoked, got %d %+v %v", code, resp, reg.revoked)
+	}
+	if code, _ := serve(http.MethodDelete, "/api/v2/admin/sessions/nope"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown session, got %d", code)
+	}
+	if code, resp := serve(http.MethodDelete, "/api/v2/admin/sessions?user_id=alice"); code != http.StatusOK || resp.Disconnected != 2 {
+		t.Fatalf("expected alice's sessions closed, got %d %+v", code, resp)
+	}
+	if code, _ := serve(http.MethodDelete, "/api/v2/admin/sessions"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a target, got %d", code)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/models"
+)
+
+// Shape renders a presence response in an alternative JSON payload, for
+// consumers that can't take the default map keyed by user ID
+type Shape func(models.PresenceResponse) any
+
+// Built-in profiles
+const (
+	// ShapeFlat returns presences as an array
+	ShapeFlat = "flat"
+	// ShapeCamel is the default shape with camelCase field names
+	ShapeCamel = "camel"
+	// ShapeResults returns presences as a top-level results array with
+	// camelCase field names
+	ShapeResults = "results"
+)
+
+var (
+	shapesMu sync.RWMutex
+	shapes   = map[string]Shape{
+		ShapeFlat:    flatShape,
+		ShapeCamel:   CamelCase(defaultShape),
+		ShapeResults: CamelCase(resultsShape),
+	}
+)
+
+// RegisterShape makes a response shape available as profile name,
+// replacing any shape already registered under it
+func RegisterShape(name string, shape Shape) {
+	shapesMu.Lock()
+	defer shapesMu.Unlock()
+	shapes[name] = shape
+}
+
+func lookupShape(name string) Shape {
+	shapesMu.RLock()
+	defer shapesMu.RUnlock()
+	return shapes[name]
+}
+
+// FlatPresenceResponse is the flat profile: presences as an array ordered by
+// user ID instead of a map keyed by it
+type FlatPresenceResponse struct {
+	Success  bool              `json:"success"`
+	Data     []models.Presence `json:"data"`
+	Error    string            `json:"error,omitempty"`
+	Code     string            `json:"code,omitempty"`
+	Meta     *models.BatchMeta `json:"meta,omitempty"`
+	DryRun   bool              `json:"dry_run,omitempty"`
+	Previous []models.Presence `json:"previous,omitempty"`
+	Changes  []string          `json:"changes,omitempty"`
+}
+
+func flatShape(resp models.PresenceResponse) any {
+	data := flatPresences(resp.Data)
+	if data == nil {
+		data = []models.Presence{}
+	}
+	return FlatPresenceResponse{Success: resp.Success, Error: resp.Error, Code: resp.Code, Meta: resp.Meta, Data: data,
+		DryRun: resp.DryRun, Previous: flatPresences(resp.Previous), Changes: resp.Changes}
+}
+
+// flatPresences lists presences ordered by user ID; nil stays nil
+func flatPresences(presences map[string]models.Presence) []models.Presence {
+	if presences == nil {
+		return nil
+	}
+	out := make([]models.Presence, 0, len(presences))
+	for userID, presence := range presences {
+		presence.UserID = userID
+		out = append(out, presence)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UserID < out[j].UserID })
+	return out
+}
+
+func defaultShape(resp models.PresenceResponse) any { return resp }
+
+// ResultsPresenceResponse is the envelope of the results profile, before its
+// field names are camelCased: presences ordered by user ID under results
+type ResultsPresenceResponse struct {
+	Success  bool              `json:"success"`
+	Results  []models.Presence `json:"results"`
+	Error    string            `json:"error,omitempty"`
+	Code     string            `json:"code,omitempty"`
+	Meta     *models.BatchMeta `json:"meta,omitempty"`
+	DryRun   bool              `json:"dry_run,omitempty"`
+	Previous []models.Presence `json:"previous,omitempty"`
+	Changes  []string          `json:"changes,omitempty"`
+}
+
+func resultsShape(resp models.PresenceResponse) any {
+	flat := flatShape(resp).(FlatPresenceResponse)
+	return ResultsPresenceResponse{Success: flat.Success, Results: flat.Data, Error: flat.Error, Code: flat.Code, Meta: flat.Meta,
+		DryRun: flat.DryRun, Previous: flat.Previous, Changes: flat.Changes}
+}
+
+// keyedByData names the objects whose keys are data, user IDs and
+// annotation names, rather than field names; CamelCase keeps their keys
+var keyedByData = map[string]bool{"data": true, "previous": true, "annotations": true}
+
+// CamelCase renders shape with camelCase field names, e.g. userId for
+// user_id, for consumers whose conventions differ from the API's
+func CamelCase(shape Shape) Shape {
+	return func(resp models.PresenceResponse) any {
+		v := shape(resp)
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return v
+		}
+		var tree any
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&tree); err != nil {
+			return v
+		}
+		return camelKeys(tree, false)
+	}
+}
+
+// camelKeys camelCases the object keys of a decoded JSON tree; keepKeys
+// keeps the keys of v itself
+func camelKeys(v any, keepKeys bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			name := k
+			if !keepKeys {
+				name = camelName(k)
+			}
+			out[name] = camelKeys(child, !keepKeys && keyedByData[k])
+		}
+		return out
+	case []any:
+		for i, child := range v {
+			v[i] = camelKeys(child, false)
+		}
+	}
+	return v
+}
+
+// camelName converts a snake_case field name to camelCase
+func camelName(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+type profileContextKey struct{}
+
+// ResponseProfiles assigns default response profiles to clients, identified
+// by their authenticated JWT subject
+type ResponseProfiles struct {
+	byClient map[string]string
+}
+
+// NewResponseProfiles returns the profile assignment byClient (JWT subject
+// to profile name), rejecting profiles with no registered shape
+func NewResponseProfiles(byClient map[string]string) (*ResponseProfiles, error) {
+	for client, profile := range byClient {
+		if lookupShape(profile) == nil {
+			return nil, fmt.Errorf("unknown response profile %q for client %q", profile, client)
+		}
+	}
+	return &ResponseProfiles{byClient: byClient}, nil
+}
+
+// Middleware records the caller's assigned profile for writeResponse. It must
+// run inside the authentication middleware so the caller is known.
+func (p *ResponseProfiles) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if profile, ok := p.byClient[auth.GetUserIDFromContext(r.Context())]; ok {
+			r = r.WithContext(context.WithValue(r.Context(), profileContextKey{}, profile))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseShape returns the shape a JSON response to r should take, or nil
+// for the default. A profile parameter in Accept, e.g.
+// "application/json; profile=flat", overrides the caller's assigned profile;
+// unknown profiles fall back to the default shape.
+func responseShape(r *http.Request) Shape {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || (mt != "application/json" && mt != "*/*") {
+			continue
+		}
+		if profile, ok := params["profile"]; ok {
+			return lookupShape(profile)
+		}
+	}
+	if profile, ok := r.Context().Value(profileContextKey{}).(string); ok {
+		return lookupShape(profile)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/models"
+)
+
+func newShapeTestHandler() http.Handler {
+	svc := newMockPresenceService()
+	now := time.Now()
+	for _, id := range []string{"u2", "u1"} {
+		svc.presences[id] = models.Presence{UserID: id, Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	}
+	return http.HandlerFunc(NewPresenceHandler(svc).GetMultiplePresences)
+}
+
+func TestResponseShape_AcceptProfile(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/presence?users=u1,u2", nil)
+	req.Header.Set("Accept", "application/json; profile=flat")
+	rr := httptest.NewRecorder()
+	newShapeTestHandler().ServeHTTP(rr, req)
+
+	var resp FlatPresenceResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !resp.Success || len(resp.Data) != 2 || resp.Data[0].UserID != "u1" || resp.Data[1].UserID != "u2" {
+		t.Fatalf("expected flat presences ordered by user ID, got %+v", resp)
+	}
+}
+
+func TestResponseShape_ClientProfile(t *testing.T) {
+	profiles, err := NewResponseProfiles(map[string]string{"legacy-crm": ShapeFlat})
+	if err != nil {
+		t.Fatalf("NewResponseProfiles: %v", err)
+	}
+	h := profiles.Middleware(newShapeTestHandler())
+
+	get := func(client, accept string) map[string]json.RawMessage {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/presence?users=u1,u2", nil)
+		req = req.WithContext(auth.SetUserIDInContext(req.Context(), client))
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body
+	}
+	if data := get("legacy-crm", ""); data["data"][0] != '[' {
+		t.Fatalf("expected array data for assigned client, got %s", data["data"])
+	}
+	if data := get("other", ""); data["data"][0] != '{' {
+		t.Fatalf("expected map data for unassigned client, got %s", data["data"])
+	}
+	// An explicit (even unknown) profile in Accept overrides the assignment
+	if data := get("legacy-crm", "application/json; profile=default"); data["data"][0] != '{' {
+		t.Fatalf("expected map data when Accept overrides the profile, got %s", data["data"])
+	}
+
+	if _, err := NewResponseProfiles(map[string]string{"c": "nope"}); err == nil {
+		t.Fatal("expected error for an unknown profile")
+	}
+}
+
+func TestResponseShape_CamelCaseProfiles(t *testing.T) {
+	svc := newMockPresenceService()
+	now := time.Now()
+	for _, id := range []string{"user_2", "user_1"} {
+		svc.presences[id] = models.Presence{UserID: id, Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1",
+			Annotations: map[string]string{"crm:account_tier": "gold"}}
+	}
+	h := http.HandlerFunc(NewPresenceHandler(svc).GetMultiplePresences)
+	get := func(profile string) map[string]any {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/presence?users=user_1,user_2", nil)
+		req.Header.Set("Accept", "application/json; profile="+profile)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		var body map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body
+	}
+
+	// User IDs and annotation names are data and keep their spelling
+	data, _ := get(ShapeCamel)["data"].(map[string]any)
+	p, _ := data["user_1"].(map[string]any)
+	if p == nil || p["userId"] != "user_1" || p["nodeId"] != "n1" || p["user_id"] != nil || p["lastSeen"] == nil {
+		t.Fatalf("expected camelCase fields keyed by user ID, got %v", data)
+	}
+	if notes, _ := p["annotations"].(map[string]any); notes["crm:account_tier"] != "gold" {
+		t.Fatalf("expected annotation names to be kept, got %v", p["annotations"])
+	}
+
+	body := get(ShapeResults)
+	results, _ := body["results"].([]any)
+	if body["success"] != true || body["data"] != nil || len(results) != 2 {
+		t.Fatalf("expected a top-level results array, got %v", body)
+	}
+	if first, _ := results[0].(map[string]any); first["userId"] != "user_1" || first["updatedAt"] == nil {
+		t.Fatalf("expected camelCase presences ordered by user ID, got %v", results)
+	}
+}
+
+func TestCamelName(t *testing.T) {
+	for in, want := range map[string]string{"user_id": "userId", "ttl": "ttl", "expires_at": "expiresAt", "a__b": "aB"} {
+		if got := camelName(in); got != want {
+			t.Errorf("camelName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
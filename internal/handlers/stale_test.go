@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/models"
+)
+
+type staleService struct {
+	*mockPresenceService
+	maxStale time.Duration
+}
+
+func (s *staleService) GetMultiplePresencesStale(ctx context.Context, userIDs []string, maxStale time.Duration) (map[string]models.Presence, time.Duration, error) {
+	s.maxStale = maxStale
+	presences, err := s.GetMultiplePresences(ctx, userIDs)
+	return presences, 7 * time.Second, err
+}
+
+func TestStaleReads_AgeHeader(t *testing.T) {
+	svc := &staleService{mockPresenceService: newMockPresenceService()}
+	svc.presences["u1"] = models.Presence{UserID: "u1", Status: models.StatusOnline}
+	h := NewPresenceHandler(svc)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/presence/{user_id}", h.GetPresence).Methods("GET")
+	r.HandleFunc("/api/v2/presence", h.GetMultiplePresences).Methods("GET")
+
+	tests := []struct {
+		name     string
+		target   string
+		header   string
+		code     int
+		maxStale time.Duration
+		age      string
+	}{
+		{"query seconds", "/api/v2/presence/u1?max_stale=10", "", http.StatusOK, 10 * time.Second, "7"},
+		{"query duration", "/api/v2/presence?users=u1&max_stale=15s", "", http.StatusOK, 15 * time.Second, "7"},
+		{"cache-control", "/api/v2/presence/u1", "no-cache, max-stale=20", http.StatusOK, 20 * time.Second, "7"},
+		{"not found", "/api/v2/presence/nope?max_stale=10", "", http.StatusNotFound, 10 * time.Second, ""},
+		{"invalid", "/api/v2/presence/u1?max_stale=soon", "", http.StatusBadRequest, 0, ""},
+		{"fresh read", "/api/v2/presence/u1", "", http.StatusOK, 0, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc.maxStale = 0
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.header != "" {
+				req.Header.Set("Cache-Control", tc.header)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tc.code {
+				t.Fatalf("expected %d, got %d", tc.code, rr.Code)
+			}
+			if svc.maxStale != tc.maxStale {
+				t.Fatalf("expected maxStale %v, got %v", tc.maxStale, svc.maxStale)
+			}
+			if got := rr.Header().Get("Age"); got != tc.age {
+				t.Fatalf("expected Age %q, got %q", tc.age, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/models"
+	"gopresence/internal/subscriptions"
+)
+
+const (
+	// sseBuffer is the number of events an SSE stream may fall behind by
+	// before it is closed
+	sseBuffer = 256
+	// sseKeepAlive is the interval between SSE keep-alive comments
+	sseKeepAlive = 30 * time.Second
+)
+
+// SubscriptionRegistry stores presence subscriptions and their listeners
+type SubscriptionRegistry interface {
+	Create(owner string, userIDs []string, ttl time.Duration, webhookURL string) (subscriptions.Subscription, error)
+	Get(id, owner string) (subscriptions.Subscription, error)
+	List(owner string) []subscriptions.Subscription
+	Renew(id, owner string, ttl time.Duration) (subscriptions.Subscription, error)
+	Delete(id, owner string) error
+	Listen(id, owner string, buffer int) (*subscriptions.Listener, error)
+}
+
+// SubscriptionRequest is the body of POST /api/v2/subscriptions, and of a
+// renewal, which only reads ttl
+type SubscriptionRequest struct {
+	UserIDs    []string `json:"user_ids"`
+	TTL        int64    `json:"ttl,omitempty"` // Seconds; the default lifetime if 0
+	WebhookURL string   `json:"webhook_url,omitempty"`
+}
+
+// SubscriptionResponse is the body of the /api/v2/subscriptions routes
+type SubscriptionResponse struct {
+	Success       bool                         `json:"success"`
+	Subscription  *subscriptions.Subscription  `json:"subscription,omitempty"`
+	Subscriptions []subscriptions.Subscription `json:"subscriptions,omitempty"`
+	Error         string                       `json:"error,omitempty"`
+}
+
+// WithSubscriptions serves the /api/v2/subscriptions routes from registry
+func WithSubscriptions(registry SubscriptionRegistry) Option {
+	return func(h *PresenceHandler) { h.subscriptions = registry }
+}
+
+// CreateSubscription handles POST /api/v2/subscriptions. The subscription
+// belongs to the authenticated caller; only they can read, renew, delete or
+// listen to it.
+func (h *PresenceHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.subscriptionOwner(w, r)
+	if !ok {
+		return
+	}
+	var req SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, SubscriptionResponse{Error: "invalid JSON"})
+		return
+	}
+	for _, id := range req.UserIDs {
+		if id == "" || (h.pseudonymizer == nil && !validKeyID(id)) {
+			writeJSON(w, http.StatusBadRequest, SubscriptionResponse{Error: fmt.Sprintf("invalid user_id %q", id)})
+			return
+		}
+	}
+	if !validTTL(req.TTL) {
+		writeJSON(w, http.StatusBadRequest, SubscriptionResponse{Error: "invalid ttl"})
+		return
+	}
+	sub, err := h.subscriptions.Create(owner, req.UserIDs, time.Duration(req.TTL)*time.Second, req.WebhookURL)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, SubscriptionResponse{Success: true, Subscription: &sub})
+}
+
+// ListSubscriptions handles GET /api/v2/subscriptions, listing the caller's
+// subscriptions on this node
+func (h *PresenceHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.subscriptionOwner(w, r)
+	if !ok {
+		return
+	}
+	subs := h.subscriptions.List(owner)
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Success: true, Subscriptions: subs})
+}
+
+// GetSubscription handles GET /api/v2/subscriptions/{subscription_id}
+func (h *PresenceHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.subscriptionOwner(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.subscriptions.Get(mux.Vars(r)["subscription_id"], owner)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Success: true, Subscription: &sub})
+}
+
+// RenewSubscription handles POST /api/v2/subscriptions/{subscription_id}/renew.
+// The body is optional; without a ttl the subscription gets the default
+// lifetime from now.
+func (h *PresenceHandler) RenewSubscription(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.subscriptionOwner(w, r)
+	if !ok {
+		return
+	}
+	var req SubscriptionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, SubscriptionResponse{Error: "invalid JSON"})
+			return
+		}
+	}
+	if !validTTL(req.TTL) {
+		writeJSON(w, http.StatusBadRequest, SubscriptionResponse{Error: "invalid ttl"})
+		return
+	}
+	sub, err := h.subscriptions.Renew(mux.Vars(r)["subscription_id"], owner, time.Duration(req.TTL)*time.Second)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Success: true, Subscription: &sub})
+}
+
+// DeleteSubscription handles DELETE /api/v2/subscriptions/{subscription_id}
+func (h *PresenceHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.subscriptionOwner(w, r)
+	if !ok {
+		return
+	}
+	if err := h.subscriptions.Delete(mux.Vars(r)["subscription_id"], owner); err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Success: true})
+}
+
+// SubscriptionEvents handles GET /api/v2/subscriptions/{subscription_id}/events,
+// a server-sent event stream. It opens with a "snapshot" event holding the
+// current presences of the roster, followed by each change as a
+// "presence.updated" or "presence.deleted" event whose id is the change's
+// revision. The stream ends when the subscription does, or if the client
+// falls too far behind; reconnecting starts from a fresh snapshot.
+func (h *PresenceHandler) SubscriptionEvents(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.subscriptionOwner(w, r)
+	if !ok {
+		return
+	}
+	l, err := h.subscriptions.Listen(mux.Vars(r)["subscription_id"], owner, sseBuffer)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	defer l.Close()
+
+	// Listening before the snapshot loads means no change is missed; the
+	// ones the snapshot already covers are skipped below
+	storeIDs := make([]string, 0, len(l.Users))
+	for storeID := range l.Users {
+		storeIDs = append(storeIDs, storeID)
+	}
+	presences, err := h.service.GetMultiplePresences(r.Context(), storeIDs)
+	if err != nil {
+		writeStoreError(w, r, err, CodeSnapshotFailed)
+		return
+	}
+	snapshot := make(map[string]models.Presence, len(presences))
+	seen := make(map[string]uint64, len(presences))
+	for storeID, p := range presences {
+		if userID, ok := l.Users[storeID]; ok {
+			p.UserID = userID
+			snapshot[userID] = p
+			seen[userID] = p.Revision
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if writeSSE(w, "snapshot", "", snapshot) != nil {
+		return
+	}
+	rc.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev, ok := <-l.Events():
+			if !ok {
+				return
+			}
+			if ev.Revision != 0 && ev.Revision <= seen[ev.UserID] {
+				continue
+			}
+			if writeSSE(w, string(ev.Type), strconv.FormatUint(ev.Revision, 10), ev) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		rc.Flush()
+	}
+}
+
+// subscriptionOwner returns the authenticated caller, who owns the
+// subscriptions the request creates or reaches. It answers 404 when
+// subscriptions are disabled and 401 for anonymous callers, who would
+// otherwise all share the subscriptions of the empty owner.
+func (h *PresenceHandler) subscriptionOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.subscriptions == nil {
+		writeJSON(w, http.StatusNotFound, SubscriptionResponse{Error: "presence subscriptions are disabled"})
+		return "", false
+	}
+	owner := auth.GetUserIDFromContext(r.Context())
+	if owner == "" {
+		writeJSON(w, http.StatusUnauthorized, SubscriptionResponse{Error: subscriptions.ErrNoOwner.Error()})
+		return "", false
+	}
+	return owner, true
+}
+
+// writeSSE writes one server-sent event with a JSON payload
+func writeSSE(w http.ResponseWriter, event, id string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" && id != "0" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// writeSubscriptionError maps registry errors: 404 for unknown
+// subscriptions, 429 at the per-caller limit, 401 without an owner, 400 for
+// invalid requests
+func writeSubscriptionError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, subscriptions.ErrNoOwner):
+		status = http.StatusUnauthorized
+	case errors.Is(err, subscriptions.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subscriptions.ErrTooMany):
+		status = http.StatusTooManyRequests
+	}
+	writeJSON(w, status, SubscriptionResponse{Error: err.Error()})
+}
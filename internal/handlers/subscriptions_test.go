@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	"gopresence/internal/subscriptions"
+)
+
+// newSubscriptionRouter serves the subscription routes to caller, as if
+// authenticated; an empty caller is anonymous
+func newSubscriptionRouter(service PresenceService, registry *subscriptions.Registry, caller string) http.Handler {
+	h := NewPresenceHandler(service, WithSubscriptions(registry))
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/subscriptions", h.CreateSubscription).Methods(http.MethodPost)
+	r.HandleFunc("/api/v2/subscriptions", h.ListSubscriptions).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/subscriptions/{subscription_id}", h.GetSubscription).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/subscriptions/{subscription_id}", h.DeleteSubscription).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v2/subscriptions/{subscription_id}/renew", h.RenewSubscription).Methods(http.MethodPost)
+	r.HandleFunc("/api/v2/subscriptions/{subscription_id}/events", h.SubscriptionEvents).Methods(http.MethodGet)
+	if caller == "" {
+		return r
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(auth.SetUserIDInContext(req.Context(), caller)))
+	})
+}
+
+func doSubscription(t *testing.T, router http.Handler, method, path, body string) (int, SubscriptionResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var resp SubscriptionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: invalid body %q", method, path, rr.Body.String())
+	}
+	return rr.Code, resp
+}
+
+func TestSubscriptionHandlers(t *testing.T) {
+	registry := subscriptions.NewRegistry(subscriptions.Limits{MaxPerOwner: 1, MaxUsers: 2})
+	router := newSubscriptionRouter(newMockPresenceService(), registry, "alice")
+
+	for body, want := range map[string]int{
+		`{`:                           http.StatusBadRequest,
+		`{"user_ids":[]}`:             http.StatusBadRequest,
+		`{"user_ids":["a b"]}`:        http.StatusBadRequest,
+		`{"user_ids":["a","b","c"]}`:  http.StatusBadRequest,
+		`{"user_ids":["a"],"ttl":-1}`: http.StatusBadRequest,
+		`{"user_ids":["a"],"webhook_url":"https://example.com"}`: http.StatusBadRequest,
+	} {
+		if code, _ := doSubscription(t, router, http.MethodPost, "/api/v2/subscriptions", body); code != want {
+			t.Errorf("%s: expected %d, got %d", body, want, code)
+		}
+	}
+
+	code, resp := doSubscription(t, router, http.MethodPost, "/api/v2/subscriptions", `{"user_ids":["bob","carol"],"ttl":600}`)
+	if code != http.StatusCreated || resp.Subscription == nil || len(resp.Subscription.UserIDs) != 2 {
+		t.Fatalf("create: %d %+v", code, resp)
+	}
+	id := resp.Subscription.ID
+	if code, _ := doSubscription(t, router, http.MethodPost, "/api/v2/subscriptions", `{"user_ids":["bob"]}`); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past the limit, got %d", code)
+	}
+
+	if code, resp := doSubscription(t, router, http.MethodGet, "/api/v2/subscriptions", ""); code != http.StatusOK || len(resp.Subscriptions) != 1 {
+		t.Fatalf("list: %d %+v", code, resp)
+	}
+	if code, resp := doSubscription(t, router, http.MethodGet, "/api/v2/subscriptions/"+id, ""); code != http.StatusOK || resp.Subscription.ID != id {
+		t.Fatalf("get: %d %+v", code, resp)
+	}
+	if code, resp := doSubscription(t, router, http.MethodPost, "/api/v2/subscriptions/"+id+"/renew", ""); code != http.StatusOK || resp.Subscription.ExpiresAt.Before(time.Now().Add(50*time.Minute)) {
+		t.Fatalf("renew: %d %+v", code, resp)
+	}
+	if code, _ := doSubscription(t, router, http.MethodDelete, "/api/v2/subscriptions/"+id, ""); code != http.StatusOK {
+		t.Fatalf("delete: %d", code)
+	}
+	if code, _ := doSubscription(t, router, http.MethodGet, "/api/v2/subscriptions/"+id, ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", code)
+	}
+
+	// Anonymous callers can't create or reach subscriptions
+	anonymous := newSubscriptionRouter(newMockPresenceService(), registry, "")
+	if code, _ := doSubscription(t, anonymous, http.MethodPost, "/api/v2/subscriptions", `{"user_ids":["bob"]}`); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 creating anonymously, got %d", code)
+	}
+	if code, _ := doSubscription(t, anonymous, http.MethodGet, "/api/v2/subscriptions", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 listing anonymously, got %d", code)
+	}
+}
+
+func TestSubscriptionHandlers_Disabled(t *testing.T) {
+	h := NewPresenceHandler(newMockPresenceService())
+	rr := httptest.NewRecorder()
+	h.CreateSubscription(rr, httptest.NewRequest(http.MethodPost, "/api/v2/subscriptions", strings.NewReader(`{"user_ids":["a"]}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a registry, got %d", rr.Code)
+	}
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	service := newMockPresenceService()
+	service.presences["bob"] = models.Presence{UserID: "bob", Status: models.StatusOnline, Revision: 5}
+	registry := subscriptions.NewRegistry(subscriptions.Limits{})
+	sub, err := registry.Create("alice", []string{"bob", "carol"}, 0, "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	srv := httptest.NewServer(newSubscriptionRouter(service, registry, "alice"))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v2/subscriptions/" + sub.ID + "/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("stream ended: %v", lines.Err())
+		}
+		return lines.Text()
+	}
+
+	if ev, data := next(), next(); ev != "event: snapshot" || !strings.Contains(data, `"bob":{"user_id":"bob","status":"online"`) {
+		t.Fatalf("expected the snapshot, got %q %q", ev, data)
+	}
+	next()
+
+	// A change the snapshot already covers is skipped
+	registry.Publish(events.Event{Type: events.EventUpdated, UserID: "bob", Revision: 5, Presence: &models.Presence{UserID: "bob", Status: models.StatusOnline}})
+	registry.Publish(events.Event{Type: events.EventUpdated, UserID: "carol", Revision: 6, Presence: &models.Presence{UserID: "carol", Status: models.StatusBusy}})
+	if id, ev, data := next(), next(), next(); id != "id: 6" || ev != "event: presence.updated" || !strings.Contains(data, `"user_id":"carol"`) {
+		t.Fatalf("expected carol's change, got %q %q %q", id, ev, data)
+	}
+
+	// The stream ends with the subscription
+	next()
+	if err := registry.Delete(sub.ID, "alice"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if lines.Scan() {
+		t.Fatalf("expected the stream to end, got %q", lines.Text())
+	}
+}
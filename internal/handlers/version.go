@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gopresence/internal/version"
+)
+
+// Version handles GET /version with the running build's version, commit,
+// build date and Go version
+func Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopresence/internal/version"
+)
+
+func TestVersion(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Version(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var got version.Info
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != version.Get() {
+		t.Fatalf("expected %+v, got %+v", version.Get(), got)
+	}
+}
@@ -0,0 +1,190 @@
+// Package i18n localizes user-facing error messages. Responses keep a
+// stable machine-readable code; the message is looked up by that code in the
+// catalog of the language negotiated from Accept-Language, falling back to
+// English. Messages are fmt formats whose explicit argument indexes, e.g.
+// %[1]s, let translations reorder arguments.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is served when Accept-Language names no language with a
+// catalog, and fills in messages a catalog lacks
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]map[string]string{}
+)
+
+func init() {
+	entries, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := locales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		if err := register(entry.Name(), data); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds messages, keyed by code, to the catalog of lang, e.g. "de"
+// or "pt-BR", replacing the messages it already has for those codes
+func Register(lang string, messages map[string]string) {
+	lang = strings.ToLower(lang)
+	mu.Lock()
+	defer mu.Unlock()
+	catalog, ok := catalogs[lang]
+	if !ok {
+		catalog = map[string]string{}
+		catalogs[lang] = catalog
+	}
+	for code, message := range messages {
+		catalog[code] = message
+	}
+}
+
+// LoadDir registers the catalogs of dir: one JSON object of code to message
+// per language, named after it, e.g. de.json or pt-BR.json
+func LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := register(filepath.Base(path), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func register(name string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("catalog %s: %w", name, err)
+	}
+	Register(strings.TrimSuffix(name, ".json"), messages)
+	return nil
+}
+
+// Languages returns the languages with a catalog, sorted
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Negotiate returns the language of acceptLanguage, an Accept-Language
+// value, with the highest weight and a catalog. A regional tag such as
+// "de-AT" falls back to its language's catalog.
+func Negotiate(acceptLanguage string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		// Earlier entries win ties
+		if q <= bestQ {
+			continue
+		}
+		if lang, ok := match(strings.ToLower(strings.TrimSpace(tag))); ok {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// match returns the catalog language of tag; callers hold mu
+func match(tag string) (string, bool) {
+	if tag == "*" {
+		return DefaultLanguage, true
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag, true
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	_, ok := catalogs[base]
+	return base, ok
+}
+
+// Message formats the message of code in lang, or in DefaultLanguage if
+// lang has none. Codes without a message are returned as is.
+func Message(lang, code string, args ...interface{}) string {
+	mu.RLock()
+	format, ok := catalogs[lang][code]
+	if !ok {
+		format, ok = catalogs[DefaultLanguage][code]
+	}
+	mu.RUnlock()
+	if !ok {
+		return code
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Localize returns the message of code in the language r accepts, and
+// announces that language on w with Content-Language
+func Localize(w http.ResponseWriter, r *http.Request, code string, args ...interface{}) string {
+	lang := Negotiate(r.Header.Get("Accept-Language"))
+	SetContentLanguage(w, lang)
+	return Message(lang, code, args...)
+}
+
+// SetContentLanguage announces on w that its messages are in lang, which
+// was negotiated from Accept-Language
+func SetContentLanguage(w http.ResponseWriter, lang string) {
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+}
+
+// Error is an error reported by code, with the arguments of its message
+type Error struct {
+	Code string
+	Args []interface{}
+}
+
+// Errorf returns an Error of code with the arguments of its message
+func Errorf(code string, args ...interface{}) *Error {
+	return &Error{Code: code, Args: args}
+}
+
+// Error returns the message in DefaultLanguage
+func (e *Error) Error() string { return Message(DefaultLanguage, e.Code, e.Args...) }
@@ -0,0 +1,108 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                           DefaultLanguage,
+		"de":                         "de",
+		"de-AT, en;q=0.8":            "de",
+		"FR-ca":                      "fr",
+		"sv, ja;q=0.5, es;q=0.7":     "es",
+		"ja;q=0.5, fr;q=0.5":         "ja",
+		"de;q=0, fr;q=0.1":           "fr",
+		"sv, *;q=0.1":                DefaultLanguage,
+		"zh-Hant-TW, de;q=bogus, es": "es",
+	}
+	for accept, want := range cases {
+		if got := Negotiate(accept); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	if got := Message("de", "presence_not_found", "alice"); got != "Keine Präsenz für Benutzer alice gefunden" {
+		t.Fatalf("unexpected German message %q", got)
+	}
+	if got := Message("ja", "quota_exceeded.route_daily", 100, "presence.user"); got != "presence.user の 1 日のリクエスト上限 (100 件) を超えました" {
+		t.Fatalf("expected reordered arguments, got %q", got)
+	}
+	if got := Message("sv", "invalid_json"); got != "invalid JSON" {
+		t.Fatalf("expected the English fallback, got %q", got)
+	}
+	if got := Message("de", "no_such_code"); got != "no_such_code" {
+		t.Fatalf("expected unknown codes as is, got %q", got)
+	}
+	if err := Errorf("invalid_ttl"); err.Error() != "invalid ttl" {
+		t.Fatalf("expected errors to read in English, got %q", err.Error())
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "es-MX")
+	if got := Localize(w, r, "invalid_status"); got != "estado no válido" {
+		t.Fatalf("unexpected message %q", got)
+	}
+	if w.Header().Get("Content-Language") != "es" || w.Header().Get("Vary") != "Accept-Language" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+}
+
+// Every built-in catalog translates every English message with the same arguments
+func TestCatalogs_Complete(t *testing.T) {
+	verbs := regexp.MustCompile(`%\[\d+\][a-z]`)
+	argsOf := func(format string) []string {
+		args := verbs.FindAllString(format, -1)
+		sort.Strings(args)
+		return args
+	}
+	english := catalogs[DefaultLanguage]
+	for _, lang := range []string{"de", "es", "fr", "ja"} {
+		catalog := catalogs[lang]
+		if len(catalog) != len(english) {
+			t.Errorf("%s: %d messages, English has %d", lang, len(catalog), len(english))
+		}
+		for code, format := range english {
+			translated, ok := catalog[code]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, code)
+				continue
+			}
+			if got, want := argsOf(translated), argsOf(format); !slices.Equal(got, want) {
+				t.Errorf("%s: %s takes %v, English takes %v", lang, code, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "pt-BR.json"), []byte(`{"invalid_json": "JSON inválido"}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"invalid_ttl": "TTL ungültig"}`), 0o644)
+	if err := LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	if got := Message(Negotiate("pt-BR"), "invalid_json"); got != "JSON inválido" {
+		t.Fatalf("expected the added catalog, got %q", got)
+	}
+	if Message("de", "invalid_ttl") != "TTL ungültig" || Message("de", "invalid_json") != "Ungültiges JSON" {
+		t.Fatal("expected the built-in catalog to be overridden message by message")
+	}
+
+	os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`not json`), 0o644)
+	if err := LoadDir(dir); err == nil {
+		t.Fatal("expected a malformed catalog to be rejected")
+	}
+}
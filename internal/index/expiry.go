@@ -0,0 +1,87 @@
+package index
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiries orders the entries that expire by when they do, so pruning
+// removes the due entries without scanning the live ones. Each user has at
+// most one item, moved in place when their entry is rewritten.
+type expiries struct {
+	items []expiryItem
+	pos   map[string]int // User ID -> index in items
+}
+
+type expiryItem struct {
+	userID string
+	at     time.Time
+}
+
+func newExpiries() *expiries {
+	return &expiries{pos: make(map[string]int)}
+}
+
+// set records when userID's entry expires; the zero time means never
+func (e *expiries) set(userID string, at time.Time) {
+	if at.IsZero() {
+		e.remove(userID)
+		return
+	}
+	if n, ok := e.pos[userID]; ok {
+		e.items[n].at = at
+		heap.Fix(e, n)
+		return
+	}
+	heap.Push(e, expiryItem{userID: userID, at: at})
+}
+
+// remove forgets userID's expiry
+func (e *expiries) remove(userID string) {
+	if n, ok := e.pos[userID]; ok {
+		heap.Remove(e, n)
+	}
+}
+
+// next returns the earliest expiry, or the zero time if none is recorded
+func (e *expiries) next() time.Time {
+	if len(e.items) == 0 {
+		return time.Time{}
+	}
+	return e.items[0].at
+}
+
+// due removes and returns the users whose entries expired before now
+func (e *expiries) due(now time.Time) []string {
+	var out []string
+	for len(e.items) > 0 && now.After(e.items[0].at) {
+		out = append(out, heap.Pop(e).(expiryItem).userID)
+	}
+	return out
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface
+
+func (e *expiries) Len() int { return len(e.items) }
+
+func (e *expiries) Less(a, b int) bool { return e.items[a].at.Before(e.items[b].at) }
+
+func (e *expiries) Swap(a, b int) {
+	e.items[a], e.items[b] = e.items[b], e.items[a]
+	e.pos[e.items[a].userID] = a
+	e.pos[e.items[b].userID] = b
+}
+
+func (e *expiries) Push(x any) {
+	item := x.(expiryItem)
+	e.pos[item.userID] = len(e.items)
+	e.items = append(e.items, item)
+}
+
+func (e *expiries) Pop() any {
+	last := len(e.items) - 1
+	item := e.items[last]
+	e.items = e.items[:last]
+	delete(e.pos, item.userID)
+	return item
+}
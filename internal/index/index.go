@@ -0,0 +1,309 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+// Index is an in-memory view of every current presence, kept in sync from
+// KV watch events. It answers status queries and stats without touching KV.
+type Index struct {
+	maxAge time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]models.Presence
+	synced  bool
+	// Counts of the entries, kept as they change so stats don't scan them
+	byStatus map[models.PresenceStatus]int
+	byNode   map[string]int
+	// When each entry stops being live; stats prune once the earliest has
+	// passed, so their counts exclude expired entries
+	expiring *expiries
+	// Revisions of the deletes applied while a resync runs, so presences
+	// the resync read before they were deleted aren't brought back
+	deleted map[string]uint64
+}
+
+// ErrNotSynced is the readiness error of an index whose startup resync
+// hasn't completed
+var ErrNotSynced = errors.New("presence index is resyncing")
+
+// Stats summarizes the indexed presences
+type Stats struct {
+	Total    int                           `json:"total"`
+	ByStatus map[models.PresenceStatus]int `json:"by_status"`
+	ByNode   map[string]int                `json:"by_node"` // By node of the last write
+}
+
+// New creates an empty index. maxAge mirrors the KV bucket TTL: entries not
+// updated within it are treated as gone, since bucket expiry emits no watch
+// event. Zero disables the age check.
+func New(maxAge time.Duration) *Index {
+	return &Index{
+		maxAge:   maxAge,
+		entries:  make(map[string]models.Presence),
+		deleted:  make(map[string]uint64),
+		byStatus: make(map[models.PresenceStatus]int),
+		byNode:   make(map[string]int),
+		expiring: newExpiries(),
+	}
+}
+
+// Apply updates the index from a presence event
+func (i *Index) Apply(ev events.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	switch ev.Type {
+	case events.EventUpdated:
+		if ev.Presence != nil {
+			i.put(ev.UserID, *ev.Presence)
+		}
+	case events.EventDeleted:
+		i.remove(ev.UserID)
+		if !i.synced {
+			i.deleted[ev.UserID] = max(i.deleted[ev.UserID], ev.Revision)
+		}
+	}
+}
+
+// Load adds presences read from KV during a resync. Watch events applied
+// meanwhile win: a presence is skipped if its entry is already at the same
+// or a later revision, or was deleted at a later one.
+func (i *Index) Load(presences map[string]models.Presence) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for userID, p := range presences {
+		if cur, ok := i.entries[userID]; ok && cur.Revision >= p.Revision {
+			continue
+		}
+		if rev, ok := i.deleted[userID]; ok && rev >= p.Revision {
+			continue
+		}
+		i.put(userID, p)
+	}
+}
+
+// put stores p as the entry of userID and updates the counts; callers hold
+// i.mu for writing
+func (i *Index) put(userID string, p models.Presence) {
+	i.remove(userID)
+	i.entries[userID] = p
+	i.count(p, 1)
+	i.expiring.set(userID, i.expiry(p))
+}
+
+// remove drops the entry of userID and updates the counts; callers hold
+// i.mu for writing
+func (i *Index) remove(userID string) {
+	if old, ok := i.entries[userID]; ok {
+		delete(i.entries, userID)
+		i.count(old, -1)
+		i.expiring.remove(userID)
+	}
+}
+
+func (i *Index) count(p models.Presence, delta int) {
+	if i.byStatus[p.Status] += delta; i.byStatus[p.Status] == 0 {
+		delete(i.byStatus, p.Status)
+	}
+	if p.NodeID == "" {
+		return
+	}
+	if i.byNode[p.NodeID] += delta; i.byNode[p.NodeID] == 0 {
+		delete(i.byNode, p.NodeID)
+	}
+}
+
+// MarkSynced ends the startup resync; the index is ready from then on
+func (i *Index) MarkSynced() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.synced = true
+	i.deleted = nil
+}
+
+// Ready implements the readiness gate of the health handler: it fails with
+// ErrNotSynced until the startup resync completes, so a restarted node
+// takes no traffic while its stats are partial
+func (i *Index) Ready(ctx context.Context) error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if !i.synced {
+		return ErrNotSynced
+	}
+	return nil
+}
+
+// Get returns the indexed presence of a user
+func (i *Index) Get(userID string) (models.Presence, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	p, ok := i.entries[userID]
+	if !ok || !i.live(p, time.Now()) {
+		return models.Presence{}, false
+	}
+	return p, true
+}
+
+// ByStatus returns the live presences with the given status whose client
+// reported every one of capabilities, ordered by user ID
+func (i *Index) ByStatus(status models.PresenceStatus, capabilities ...string) []models.Presence {
+	now := time.Now()
+	i.mu.RLock()
+	out := make([]models.Presence, 0)
+	for _, p := range i.entries {
+		if p.Status == status && p.HasCapabilities(capabilities) && i.live(p, now) {
+			out = append(out, p)
+		}
+	}
+	i.mu.RUnlock()
+
+	sort.Slice(out, func(a, b int) bool { return out[a].UserID < out[b].UserID })
+	return out
+}
+
+// Page returns up to limit live presences with the given status and every
+// one of capabilities whose user IDs sort after the given one, in user ID
+// order, and whether more remain. Keyset paging keeps cursors stable while
+// users come and go.
+func (i *Index) Page(status models.PresenceStatus, after string, limit int, capabilities ...string) ([]models.Presence, bool) {
+	return i.page(func(p models.Presence) bool { return p.Status == status && p.HasCapabilities(capabilities) }, after, limit)
+}
+
+// Filter selects presences; zero fields match everything
+type Filter struct {
+	Status       models.PresenceStatus
+	NodeID       string   // Node of the last write
+	Capabilities []string // Every one is required
+	Prefix       string   // Of the user ID
+	Query        *Query   // Further conditions, if set
+}
+
+func (f Filter) matches(p models.Presence) bool {
+	return strings.HasPrefix(p.UserID, f.Prefix) &&
+		(f.Status == "" || p.Status == f.Status) &&
+		(f.NodeID == "" || p.NodeID == f.NodeID) &&
+		p.HasCapabilities(f.Capabilities) &&
+		(f.Query == nil || f.Query.Match(p))
+}
+
+// List pages through the live presences f selects, like Page
+func (i *Index) List(f Filter, after string, limit int) ([]models.Presence, bool) {
+	return i.page(f.matches, after, limit)
+}
+
+// PageAll pages through every live presence, whatever its status, like Page
+func (i *Index) PageAll(after string, limit int) ([]models.Presence, bool) {
+	return i.page(func(models.Presence) bool { return true }, after, limit)
+}
+
+// PageByNode pages through the live presences last written by nodeID, like
+// Page
+func (i *Index) PageByNode(nodeID, after string, limit int) ([]models.Presence, bool) {
+	return i.page(func(p models.Presence) bool { return p.NodeID == nodeID }, after, limit)
+}
+
+func (i *Index) page(match func(models.Presence) bool, after string, limit int) ([]models.Presence, bool) {
+	now := time.Now()
+	i.mu.RLock()
+	out := make([]models.Presence, 0)
+	for userID, p := range i.entries {
+		if userID > after && match(p) && i.live(p, now) {
+			out = append(out, p)
+		}
+	}
+	i.mu.RUnlock()
+
+	sort.Slice(out, func(a, b int) bool { return out[a].UserID < out[b].UserID })
+	if limit > 0 && len(out) > limit {
+		return out[:limit], true
+	}
+	return out, false
+}
+
+// Stats counts live presences by status and node from counts kept as the
+// index changes. Expired entries are pruned first, if any. The core statuses
+// are always present, custom ones only when in use.
+func (i *Index) Stats() Stats {
+	i.mu.RLock()
+	next := i.expiring.next()
+	i.mu.RUnlock()
+	due := !next.IsZero() && time.Now().After(next)
+	if due {
+		i.Prune()
+	}
+
+	stats := Stats{ByStatus: map[models.PresenceStatus]int{
+		models.StatusOnline:  0,
+		models.StatusAway:    0,
+		models.StatusBusy:    0,
+		models.StatusOffline: 0,
+	}, ByNode: make(map[string]int)}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	stats.Total = len(i.entries)
+	for status, n := range i.byStatus {
+		stats.ByStatus[status] = n
+	}
+	for node, n := range i.byNode {
+		stats.ByNode[node] = n
+	}
+	return stats
+}
+
+// Prune drops expired entries and returns how many were removed. Only the
+// due entries are visited, in expiry order, so it costs little however many
+// presences are live.
+func (i *Index) Prune() int {
+	now := time.Now()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	due := i.expiring.due(now)
+	for _, userID := range due {
+		i.remove(userID)
+	}
+	return len(due)
+}
+
+// Run prunes expired entries every interval until ctx is done
+func (i *Index) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			i.Prune()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// live reports whether p is still current. Callers must hold i.mu.
+func (i *Index) live(p models.Presence, now time.Time) bool {
+	if p.IsExpired() {
+		return false
+	}
+	return i.maxAge <= 0 || now.Sub(p.UpdatedAt) <= i.maxAge
+}
+
+// expiry returns when p stops being live, or the zero time if it never does
+func (i *Index) expiry(p models.Presence) time.Time {
+	var at time.Time
+	if p.TTL > 0 {
+		at = p.UpdatedAt.Add(p.TTL)
+	}
+	if i.maxAge > 0 {
+		if aged := p.UpdatedAt.Add(i.maxAge); at.IsZero() || aged.Before(at) {
+			at = aged
+		}
+	}
+	return at
+}
@@ -0,0 +1,233 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+func put(idx *Index, userID string, status models.PresenceStatus, updated time.Time, ttl time.Duration) {
+	idx.Apply(events.Event{
+		Type:     events.EventUpdated,
+		UserID:   userID,
+		Presence: &models.Presence{UserID: userID, Status: status, UpdatedAt: updated, TTL: ttl},
+	})
+}
+
+func TestIndex_ApplyAndQuery(t *testing.T) {
+	idx := New(time.Hour)
+	now := time.Now()
+	put(idx, "carol", models.StatusOnline, now, 0)
+	put(idx, "alice", models.StatusOnline, now, 0)
+	put(idx, "bob", models.StatusAway, now, 0)
+
+	online := idx.ByStatus(models.StatusOnline)
+	if len(online) != 2 || online[0].UserID != "alice" || online[1].UserID != "carol" {
+		t.Fatalf("expected alice, carol in order, got %+v", online)
+	}
+
+	// Status change moves the user between buckets
+	put(idx, "carol", models.StatusBusy, now, 0)
+	if got := idx.ByStatus(models.StatusOnline); len(got) != 1 {
+		t.Fatalf("expected 1 online after status change, got %d", len(got))
+	}
+
+	idx.Apply(events.Event{Type: events.EventDeleted, UserID: "bob"})
+	if _, ok := idx.Get("bob"); ok {
+		t.Fatal("expected bob removed on delete")
+	}
+
+	stats := idx.Stats()
+	if stats.Total != 2 || stats.ByStatus[models.StatusOnline] != 1 || stats.ByStatus[models.StatusBusy] != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestIndex_ExpiryAndPrune(t *testing.T) {
+	idx := New(time.Hour)
+	now := time.Now()
+	put(idx, "fresh", models.StatusOnline, now, 0)
+	put(idx, "ttl-expired", models.StatusOnline, now.Add(-2*time.Minute), time.Minute)
+	put(idx, "bucket-expired", models.StatusOnline, now.Add(-2*time.Hour), 0)
+
+	if got := idx.ByStatus(models.StatusOnline); len(got) != 1 || got[0].UserID != "fresh" {
+		t.Fatalf("expected only fresh presence, got %+v", got)
+	}
+	if removed := idx.Prune(); removed != 2 {
+		t.Fatalf("expected 2 pruned, got %d", removed)
+	}
+
+	// Stats prune entries that expired since the last prune
+	put(idx, "ttl-expired", models.StatusOnline, now.Add(-2*time.Minute), time.Minute)
+	if stats := idx.Stats(); stats.Total != 1 || stats.ByStatus[models.StatusOnline] != 1 {
+		t.Fatalf("expected expired entries excluded from stats, got %+v", stats)
+	}
+	if removed := idx.Prune(); removed != 0 {
+		t.Fatalf("expected stats to have pruned the expired entry, got %d more pruned", removed)
+	}
+}
+
+func TestIndex_PruneOnlyDueEntries(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	for n := 0; n < 1000; n++ {
+		put(idx, fmt.Sprintf("live-%d", n), models.StatusOnline, now, time.Duration(n+1)*time.Hour)
+	}
+	put(idx, "forever", models.StatusOnline, now.Add(-time.Hour), 0)
+	put(idx, "refreshed", models.StatusOnline, now.Add(-2*time.Minute), time.Minute)
+	put(idx, "refreshed", models.StatusAway, now, time.Minute)
+	put(idx, "deleted", models.StatusOnline, now.Add(-2*time.Minute), time.Minute)
+	idx.Apply(events.Event{Type: events.EventDeleted, UserID: "deleted"})
+	put(idx, "expired", models.StatusBusy, now.Add(-2*time.Minute), time.Minute)
+
+	if removed := idx.Prune(); removed != 1 {
+		t.Fatalf("expected only the expired entry pruned, got %d", removed)
+	}
+	if _, ok := idx.Get("refreshed"); !ok {
+		t.Fatal("expected the refreshed entry to be kept")
+	}
+	if got := idx.expiring.Len(); got != 1001 {
+		t.Fatalf("expected an expiry per expiring entry, got %d", got)
+	}
+	if stats := idx.Stats(); stats.Total != 1002 || stats.ByStatus[models.StatusBusy] != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestIndex_StatsByNode(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	for id, node := range map[string]string{"u1": "n1", "u2": "n2", "u3": "n1"} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: models.StatusOnline, NodeID: node, UpdatedAt: now}})
+	}
+	// A write through another node moves the user's count
+	idx.Apply(events.Event{Type: events.EventUpdated, UserID: "u3", Presence: &models.Presence{UserID: "u3", Status: models.StatusAway, NodeID: "n2", UpdatedAt: now}})
+	idx.Apply(events.Event{Type: events.EventDeleted, UserID: "u1"})
+
+	stats := idx.Stats()
+	if stats.Total != 2 || stats.ByNode["n2"] != 2 || len(stats.ByNode) != 1 {
+		t.Fatalf("unexpected node counts: %+v", stats)
+	}
+	if stats.ByStatus[models.StatusOnline] != 1 || stats.ByStatus[models.StatusAway] != 1 || stats.ByStatus[models.StatusOffline] != 0 || len(stats.ByStatus) != 4 {
+		t.Fatalf("unexpected status counts: %+v", stats)
+	}
+}
+
+func TestIndex_PageIsStableAcrossChanges(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		put(idx, id, models.StatusOnline, now, 0)
+	}
+
+	page, more := idx.Page(models.StatusOnline, "", 2)
+	if len(page) != 2 || page[1].UserID != "b" || !more {
+		t.Fatalf("unexpected first page: %+v more=%v", page, more)
+	}
+
+	// A user joining before the cursor and one leaving after it don't shift the next page
+	put(idx, "aa", models.StatusOnline, now, 0)
+	idx.Apply(events.Event{Type: events.EventDeleted, UserID: "d"})
+	page, more = idx.Page(models.StatusOnline, "b", 2)
+	if len(page) != 2 || page[0].UserID != "c" || page[1].UserID != "e" || more {
+		t.Fatalf("unexpected second page: %+v more=%v", page, more)
+	}
+}
+
+func TestIndex_PageByNode(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	for id, node := range map[string]string{"u1": "n1", "u2": "n2", "u3": "n1", "u4": "n1"} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: models.StatusAway, NodeID: node, UpdatedAt: now}})
+	}
+	page, more := idx.PageByNode("n1", "", 2)
+	if len(page) != 2 || page[0].UserID != "u1" || page[1].UserID != "u3" || !more {
+		t.Fatalf("unexpected first page: %+v more=%v", page, more)
+	}
+	page, more = idx.PageByNode("n1", "u3", 2)
+	if len(page) != 1 || page[0].UserID != "u4" || more {
+		t.Fatalf("unexpected second page: %+v more=%v", page, more)
+	}
+	if page, _ := idx.PageByNode("n9", "", 10); len(page) != 0 {
+		t.Fatalf("expected no presences for an unknown node, got %+v", page)
+	}
+}
+
+func TestIndex_ResyncKeepsNewerWatchEvents(t *testing.T) {
+	idx := New(time.Hour)
+	now := time.Now()
+	if err := idx.Ready(context.Background()); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("expected a new index not to be ready, got %v", err)
+	}
+
+	// Changes watched while the resync reads KV
+	idx.Apply(events.Event{Type: events.EventUpdated, UserID: "alice", Revision: 9,
+		Presence: &models.Presence{UserID: "alice", Status: models.StatusBusy, UpdatedAt: now, Revision: 9}})
+	idx.Apply(events.Event{Type: events.EventDeleted, UserID: "bob", Revision: 8})
+
+	idx.Load(map[string]models.Presence{
+		"alice": {UserID: "alice", Status: models.StatusOnline, UpdatedAt: now, Revision: 5},
+		"bob":   {UserID: "bob", Status: models.StatusOnline, UpdatedAt: now, Revision: 6},
+		"carol": {UserID: "carol", Status: models.StatusAway, UpdatedAt: now, Revision: 7},
+	})
+	idx.MarkSynced()
+
+	if err := idx.Ready(context.Background()); err != nil {
+		t.Fatalf("expected a synced index to be ready, got %v", err)
+	}
+	if p, _ := idx.Get("alice"); p.Status != models.StatusBusy {
+		t.Fatalf("expected the newer watched presence to win, got %+v", p)
+	}
+	if _, ok := idx.Get("bob"); ok {
+		t.Fatal("expected a presence deleted during the resync to stay deleted")
+	}
+	if stats := idx.Stats(); stats.Total != 2 || stats.ByStatus[models.StatusAway] != 1 {
+		t.Fatalf("unexpected stats after resync: %+v", stats)
+	}
+}
+
+func TestIndex_PageAll(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	for id, status := range map[string]models.PresenceStatus{"u1": models.StatusOnline, "u2": models.StatusAway, "u3": models.StatusBusy} {
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: id, Presence: &models.Presence{UserID: id, Status: status, UpdatedAt: now}})
+	}
+	page, more := idx.PageAll("", 2)
+	if len(page) != 2 || page[0].UserID != "u1" || page[1].UserID != "u2" || !more {
+		t.Fatalf("unexpected first page: %+v more=%v", page, more)
+	}
+	page, more = idx.PageAll("u2", 2)
+	if len(page) != 1 || page[0].UserID != "u3" || more {
+		t.Fatalf("unexpected second page: %+v more=%v", page, more)
+	}
+}
+
+func TestIndex_List(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	for _, p := range []models.Presence{
+		{UserID: "u1", Status: models.StatusOnline, NodeID: "n1"},
+		{UserID: "u2", Status: models.StatusOnline, NodeID: "n2"},
+		{UserID: "u3", Status: models.StatusAway, NodeID: "n1"},
+		{UserID: "u4", Status: models.StatusOnline, NodeID: "n1"},
+	} {
+		p.UpdatedAt = now
+		idx.Apply(events.Event{Type: events.EventUpdated, UserID: p.UserID, Presence: &p})
+	}
+	page, more := idx.List(Filter{Status: models.StatusOnline, NodeID: "n1"}, "", 1)
+	if len(page) != 1 || page[0].UserID != "u1" || !more {
+		t.Fatalf("unexpected first page: %+v more=%v", page, more)
+	}
+	page, more = idx.List(Filter{Status: models.StatusOnline, NodeID: "n1"}, "u1", 1)
+	if len(page) != 1 || page[0].UserID != "u4" || more {
+		t.Fatalf("unexpected second page: %+v more=%v", page, more)
+	}
+	if page, _ := idx.List(Filter{}, "", 10); len(page) != 4 {
+		t.Fatalf("expected an empty filter to list every presence, got %+v", page)
+	}
+}
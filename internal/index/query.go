@@ -0,0 +1,419 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopresence/internal/models"
+)
+
+// Query size limits, keeping the cost of matching every indexed presence
+// bounded
+const (
+	MaxQueryLength     = 1024 // Bytes
+	MaxQueryConditions = 32
+)
+
+// Query is a parsed presence filter, such as
+//
+//	status=online AND message~"meeting" AND updated_at>2026-10-16T09:00:00Z
+//
+// A condition compares a field with a value. Conditions combine with AND, OR
+// and NOT, and group with parentheses; AND binds tighter than OR. Values
+// with spaces or operator characters are quoted, with \" and \\ escapes.
+//
+// String fields are user_id, status, message, node, source, platform,
+// app_version and time_zone. They take = and !=, and ~ and !~ for a
+// case-insensitive substring. capability takes = and != for whether the
+// client reported it. updated_at and last_seen take <, <=, > and >=
+// against an RFC 3339 time, or a duration such as 15m meaning that long ago.
+type Query struct {
+	root  queryNode
+	input string
+}
+
+// ParseQuery parses a filter in the syntax described on Query
+func ParseQuery(input string) (*Query, error) {
+	if len(input) > MaxQueryLength {
+		return nil, &QueryError{Msg: fmt.Sprintf("longer than %d bytes", MaxQueryLength)}
+	}
+	p := &queryParser{lex: queryLexer{input: input}, now: time.Now()}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Query{root: root, input: input}, nil
+}
+
+// Match reports whether q selects p
+func (q *Query) Match(p models.Presence) bool { return q.root.match(&p) }
+
+// String returns the query as parsed
+func (q *Query) String() string { return q.input }
+
+// QueryError reports why a query failed to parse and where
+type QueryError struct {
+	Pos int // Byte offset into the query
+	Msg string
+}
+
+func (e *QueryError) Error() string { return fmt.Sprintf("at offset %d: %s", e.Pos, e.Msg) }
+
+type queryNode interface {
+	match(p *models.Presence) bool
+}
+
+type allOf []queryNode
+
+func (n allOf) match(p *models.Presence) bool {
+	for _, c := range n {
+		if !c.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+type anyOf []queryNode
+
+func (n anyOf) match(p *models.Presence) bool {
+	for _, c := range n {
+		if c.match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+type notOf struct{ queryNode }
+
+func (n notOf) match(p *models.Presence) bool { return !n.queryNode.match(p) }
+
+// stringCond compares a string field
+type stringCond struct {
+	field func(*models.Presence) string
+	op    string
+	value string // Lowercased for ~ and !~
+}
+
+func (c stringCond) match(p *models.Presence) bool {
+	v := c.field(p)
+	switch c.op {
+	case "=":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case "~":
+		return strings.Contains(strings.ToLower(v), c.value)
+	default: // !~
+		return !strings.Contains(strings.ToLower(v), c.value)
+	}
+}
+
+// capabilityCond checks a capability the client reported
+type capabilityCond struct {
+	capability string
+	has        bool
+}
+
+func (c capabilityCond) match(p *models.Presence) bool {
+	return p.HasCapabilities([]string{c.capability}) == c.has
+}
+
+// timeCond compares a time field
+type timeCond struct {
+	field func(*models.Presence) time.Time
+	op    string
+	value time.Time
+}
+
+func (c timeCond) match(p *models.Presence) bool {
+	v := c.field(p)
+	switch c.op {
+	case "<":
+		return v.Before(c.value)
+	case "<=":
+		return !v.After(c.value)
+	case ">":
+		return v.After(c.value)
+	default: // >=
+		return !v.Before(c.value)
+	}
+}
+
+func clientField(get func(*models.ClientInfo) string) func(*models.Presence) string {
+	return func(p *models.Presence) string {
+		if p.Client == nil {
+			return ""
+		}
+		return get(p.Client)
+	}
+}
+
+var stringFields = map[string]func(*models.Presence) string{
+	"user_id":     func(p *models.Presence) string { return p.UserID },
+	"status":      func(p *models.Presence) string { return string(p.Status) },
+	"message":     func(p *models.Presence) string { return p.Message },
+	"node":        func(p *models.Presence) string { return p.NodeID },
+	"source":      func(p *models.Presence) string { return string(p.Source) },
+	"time_zone":   func(p *models.Presence) string { return p.TimeZone },
+	"platform":    clientField(func(c *models.ClientInfo) string { return c.Platform }),
+	"app_version": clientField(func(c *models.ClientInfo) string { return c.AppVersion }),
+}
+
+var timeFields = map[string]func(*models.Presence) time.Time{
+	"updated_at": func(p *models.Presence) time.Time { return p.UpdatedAt },
+	"last_seen":  func(p *models.Presence) time.Time { return p.LastSeen },
+}
+
+type queryParser struct {
+	lex        queryLexer
+	tok        queryToken
+	now        time.Time
+	conditions int
+}
+
+func (p *queryParser) next() { p.tok = p.lex.next() }
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return &QueryError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// keyword reports whether the current token is the unquoted keyword kw
+func (p *queryParser) keyword(kw string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var terms anyOf
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.keyword("OR") {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var terms allOf
+	for {
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.keyword("AND") {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	switch {
+	case p.keyword("NOT"):
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notOf{n}, nil
+	case p.tok.kind == tokLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *queryParser) parseCondition() (queryNode, error) {
+	if p.tok.kind != tokWord || p.keyword("AND") || p.keyword("OR") {
+		return nil, p.errorf("expected a field but found %s", p.tok)
+	}
+	if p.conditions++; p.conditions > MaxQueryConditions {
+		return nil, p.errorf("more than %d conditions", MaxQueryConditions)
+	}
+	field, fieldPos := strings.ToLower(p.tok.text), p.tok.pos
+	p.next()
+	if p.tok.kind != tokOp {
+		return nil, p.errorf("expected an operator after %s but found %s", field, p.tok)
+	}
+	op := p.tok.text
+	p.next()
+	if p.tok.kind != tokWord && p.tok.kind != tokString {
+		return nil, p.errorf("expected a value after %s%s but found %s", field, op, p.tok)
+	}
+	value, valuePos := p.tok.text, p.tok.pos
+	p.next()
+	badOp := &QueryError{Pos: valuePos, Msg: fmt.Sprintf("%s does not take %s", field, op)}
+
+	if get, ok := stringFields[field]; ok {
+		switch op {
+		case "=", "!=":
+			if field == "status" && !models.PresenceStatus(value).IsValid() {
+				return nil, &QueryError{Pos: valuePos, Msg: fmt.Sprintf("unknown status %q", value)}
+			}
+			return stringCond{field: get, op: op, value: value}, nil
+		case "~", "!~":
+			return stringCond{field: get, op: op, value: strings.ToLower(value)}, nil
+		}
+		return nil, badOp
+	}
+	if get, ok := timeFields[field]; ok {
+		switch op {
+		case "<", "<=", ">", ">=":
+		default:
+			return nil, badOp
+		}
+		at, err := p.parseTime(value)
+		if err != nil {
+			return nil, &QueryError{Pos: valuePos, Msg: err.Error()}
+		}
+		return timeCond{field: get, op: op, value: at}, nil
+	}
+	if field == "capability" {
+		if op != "=" && op != "!=" {
+			return nil, badOp
+		}
+		if !models.ValidCapability(value) {
+			return nil, &QueryError{Pos: valuePos, Msg: fmt.Sprintf("invalid capability %q", value)}
+		}
+		return capabilityCond{capability: value, has: op == "="}, nil
+	}
+	return nil, &QueryError{Pos: fieldPos, Msg: fmt.Sprintf("unknown field %q", field)}
+}
+
+// parseTime reads an RFC 3339 time, or a duration meaning that long ago
+func (p *queryParser) parseTime(value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return at, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return p.now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokError
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("%q", t.text)
+	case tokError:
+		return t.text
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+type queryLexer struct {
+	input string
+	pos   int
+}
+
+// operator characters, which end unquoted words
+const opChars = "=!~<>"
+
+func (l *queryLexer) next() queryToken {
+	for l.pos < len(l.input) && unicode.IsSpace(rune(l.input[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if start >= len(l.input) {
+		return queryToken{kind: tokEOF, pos: start}
+	}
+	switch c := l.input[start]; {
+	case c == '(':
+		l.pos++
+		return queryToken{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		l.pos++
+		return queryToken{kind: tokRParen, text: ")", pos: start}
+	case c == '"':
+		return l.quoted()
+	case strings.IndexByte(opChars, c) >= 0:
+		for _, op := range []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"} {
+			if strings.HasPrefix(l.input[start:], op) {
+				l.pos += len(op)
+				return queryToken{kind: tokOp, text: op, pos: start}
+			}
+		}
+		l.pos++
+		return queryToken{kind: tokError, text: fmt.Sprintf("stray '%c'", c), pos: start}
+	}
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if unicode.IsSpace(rune(c)) || c == '(' || c == ')' || c == '"' || strings.IndexByte(opChars, c) >= 0 {
+			break
+		}
+		l.pos++
+	}
+	return queryToken{kind: tokWord, text: l.input[start:l.pos], pos: start}
+}
+
+// quoted reads a double-quoted string with \" and \\ escapes
+func (l *queryLexer) quoted() queryToken {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.input); l.pos++ {
+		switch c := l.input[l.pos]; c {
+		case '"':
+			l.pos++
+			return queryToken{kind: tokString, text: b.String(), pos: start}
+		case '\\':
+			if l.pos+1 < len(l.input) && (l.input[l.pos+1] == '"' || l.input[l.pos+1] == '\\') {
+				l.pos++
+				b.WriteByte(l.input[l.pos])
+				continue
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return queryToken{kind: tokError, text: "unterminated string", pos: start}
+}
@@ -0,0 +1,81 @@
+package index
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestParseQuery_Match(t *testing.T) {
+	now := time.Now()
+	alice := models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "In a Meeting", NodeID: "n1", Source: models.SourceAPI,
+		UpdatedAt: now.Add(-time.Minute), LastSeen: now.Add(-time.Minute), Client: &models.ClientInfo{Platform: "ios", Capabilities: []string{"video-capable"}}}
+	bob := models.Presence{UserID: "bob", Status: models.StatusOnline, NodeID: "n2", Source: models.SourceHeartbeat,
+		UpdatedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-2 * time.Hour)}
+
+	for query, want := range map[string][2]bool{
+		`status=busy`:                                             {true, false},
+		`message~"meeting"`:                                       {true, false},
+		`message!~meeting AND node=n2`:                            {false, true},
+		`status=online OR platform=ios`:                           {true, true},
+		`status=online or platform=ios and node=n2`:               {false, true},
+		`(status=online OR platform=ios) AND node=n2`:             {false, true},
+		`NOT capability=video-capable`:                            {false, true},
+		`updated_at>30m`:                                          {true, false},
+		`last_seen<=1h AND source=heartbeat`:                      {false, true},
+		`updated_at>=` + now.Add(-time.Hour).Format(time.RFC3339): {true, false},
+		`user_id="bob"`:                                           {false, true},
+	} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		if got := [2]bool{q.Match(alice), q.Match(bob)}; got != want {
+			t.Errorf("%s: expected %v for alice and bob, got %v", query, want, got)
+		}
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	for query, want := range map[string]string{
+		``:                      "expected a field",
+		`mesage=hi`:             `at offset 0: unknown field "mesage"`,
+		`status=sleeping`:       `unknown status "sleeping"`,
+		`status<online`:         "status does not take <",
+		`updated_at>yesterday`:  "neither an RFC 3339 time nor a duration",
+		`status=online AND`:     "expected a field but found end of query",
+		`(status=online`:        "expected ) but found end of query",
+		`message="open`:         "unterminated string",
+		`status=online node=n1`: "unexpected 'node'",
+		`capability=Video`:      `invalid capability "Video"`,
+		strings.Repeat("status=online OR ", MaxQueryConditions) + "status=away": "more than 32 conditions",
+	} {
+		_, err := ParseQuery(query)
+		var qe *QueryError
+		if !errors.As(err, &qe) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected an error containing %q, got %v", query, want, err)
+		}
+	}
+	if _, err := ParseQuery(strings.Repeat("x", MaxQueryLength+1)); err == nil {
+		t.Fatal("expected an overlong query to be rejected")
+	}
+}
+
+func TestIndex_ListWithQuery(t *testing.T) {
+	idx := New(0)
+	now := time.Now()
+	put(idx, "u1", models.StatusOnline, now, 0)
+	put(idx, "u2", models.StatusAway, now, 0)
+	put(idx, "u3", models.StatusOnline, now.Add(-time.Hour), 0)
+	q, err := ParseQuery("updated_at>10m")
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	if page, _ := idx.List(Filter{Status: models.StatusOnline, Query: q}, "", 10); len(page) != 1 || page[0].UserID != "u1" {
+		t.Fatalf("expected only the recently updated online user, got %+v", page)
+	}
+}
@@ -0,0 +1,211 @@
+// Package logging builds the service's structured logger.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopresence/internal/requestid"
+)
+
+// LevelTrace is below debug, for protocol-level traces such as the embedded
+// NATS server's
+const LevelTrace = slog.Level(-8)
+
+// ParseLevel maps a LOG_LEVEL value to a slog level, defaulting to info
+func ParseLevel(level string) slog.Level {
+	if l, ok := LookupLevel(level); ok {
+		return l
+	}
+	return slog.LevelInfo
+}
+
+// LookupLevel maps a level name (trace, debug, info, warn or error) to a
+// slog level, reporting false for any other name
+func LookupLevel(level string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "trace":
+		return LevelTrace, true
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return 0, false
+}
+
+// LevelName is the LOG_LEVEL name of level
+func LevelName(level slog.Level) string {
+	if level == LevelTrace {
+		return "trace"
+	}
+	return strings.ToLower(level.String())
+}
+
+// Level is a logger level that can be raised or lowered at runtime, for a
+// while: an override reverts to the configured level when it expires
+type Level struct {
+	v slog.LevelVar
+
+	mu       sync.Mutex
+	base     slog.Level
+	revertAt time.Time
+	timer    *time.Timer
+	gen      uint64
+}
+
+// LevelStatus describes the current level and any override of it
+type LevelStatus struct {
+	Level    string     `json:"level"`
+	Base     string     `json:"base"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// NewLevel returns a Level set to base
+func NewLevel(base slog.Level) *Level {
+	l := &Level{base: base}
+	l.v.Set(base)
+	return l
+}
+
+// Level implements slog.Leveler
+func (l *Level) Level() slog.Level { return l.v.Level() }
+
+// Override sets the level for d, replacing any earlier override, then
+// reverts to the configured level
+func (l *Level) Override(level slog.Level, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("override duration must be positive, got %s", d)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopLocked()
+	l.v.Set(level)
+	l.revertAt = time.Now().UTC().Add(d)
+	gen := l.gen
+	l.timer = time.AfterFunc(d, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.gen == gen {
+			l.resetLocked()
+		}
+	})
+	return nil
+}
+
+// Reset ends any override, restoring the configured level
+func (l *Level) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resetLocked()
+}
+
+func (l *Level) resetLocked() {
+	l.stopLocked()
+	l.v.Set(l.base)
+	l.revertAt = time.Time{}
+}
+
+// stopLocked cancels the pending revert; the generation bump keeps a timer
+// that already fired from reverting a newer override
+func (l *Level) stopLocked() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.gen++
+}
+
+// Status reports the current level and when an override reverts
+func (l *Level) Status() LevelStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := LevelStatus{Level: LevelName(l.v.Level()), Base: LevelName(l.base)}
+	if !l.revertAt.IsZero() {
+		at := l.revertAt
+		st.RevertAt = &at
+	}
+	return st
+}
+
+// New returns a logger writing to w in the given format ("json" or "text")
+// at the given level
+func New(w io.Writer, format, level string) *slog.Logger {
+	return newLogger(w, format, ParseLevel(level), nil)
+}
+
+// newLogger builds the logger; a nil sampler logs every record
+func newLogger(w io.Writer, format string, level slog.Leveler, sampler *Sampler) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}
+	var h slog.Handler = slog.NewJSONHandler(w, opts)
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	}
+	if sampler != nil {
+		h = samplingHandler{Handler: h, sampler: sampler}
+	}
+	return slog.New(contextHandler{h})
+}
+
+// requestIDKey is the attribute carrying the request ID of a record logged
+// with a request's context
+const requestIDKey = "request_id"
+
+// contextHandler adds the request ID of the context a record is logged with,
+// unless the record already has one
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" && !hasAttr(r, requestIDKey) {
+		r = r.Clone()
+		r.AddAttrs(slog.String(requestIDKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func hasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
+
+// Setup builds the service logger on stderr and installs it as the slog
+// default, which also routes the standard library log package through it.
+// The returned Level adjusts the logger at runtime. A non-nil sampler
+// deduplicates repeated records.
+func Setup(format, level string, sampler *Sampler) *Level {
+	lv := NewLevel(ParseLevel(level))
+	slog.SetDefault(newLogger(os.Stderr, format, lv, sampler))
+	return lv
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/requestid"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"trace": LevelTrace,
+		"DEBUG": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+		"bogus": slog.LevelInfo,
+	}
+	for in, want := range cases {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestNew_FormatAndLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "trace")
+	logger.Log(context.Background(), LevelTrace, "wire", "k", "v")
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("expected JSON record: %v (%s)", err, buf.String())
+	}
+	if rec["level"] != "TRACE" || rec["msg"] != "wire" || rec["k"] != "v" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+
+	buf.Reset()
+	logger = New(&buf, "text", "warn")
+	logger.Info("dropped")
+	logger.Warn("kept")
+	if out := buf.String(); strings.Contains(out, "dropped") || !strings.Contains(out, "msg=kept") {
+		t.Fatalf("unexpected text output %q", out)
+	}
+}
+
+func TestNew_AddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "info")
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	logger.InfoContext(ctx, "tagged")
+	logger.InfoContext(ctx, "explicit", "request_id", "req-2")
+	logger.Info("untagged")
+
+	var got []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec map[string]any
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("expected JSON records: %v", err)
+		}
+		id, _ := rec["request_id"].(string)
+		got = append(got, id)
+	}
+	if strings.Join(got, ",") != "req-1,req-2," {
+		t.Fatalf("unexpected request IDs %q (%s)", got, buf.String())
+	}
+}
+
+func TestLevel_OverrideReverts(t *testing.T) {
+	var buf bytes.Buffer
+	lv := NewLevel(slog.LevelInfo)
+	logger := newLogger(&buf, "text", lv, nil)
+
+	if _, ok := LookupLevel("verbose"); ok {
+		t.Fatal("expected unknown level name to be rejected")
+	}
+	if err := lv.Override(slog.LevelDebug, 0); err == nil {
+		t.Fatal("expected a non-positive duration to be rejected")
+	}
+	if err := lv.Override(slog.LevelDebug, time.Hour); err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+	logger.Debug("incident")
+	if !strings.Contains(buf.String(), "msg=incident") {
+		t.Fatalf("expected debug record while overridden, got %q", buf.String())
+	}
+	if st := lv.Status(); st.Level != "debug" || st.Base != "info" || st.RevertAt == nil {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// A shorter override replaces the first and reverts on its own
+	if err := lv.Override(LevelTrace, 20*time.Millisecond); err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for lv.Level() != slog.LevelInfo {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected revert to info, still at %v", lv.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if st := lv.Status(); st.Level != "info" || st.RevertAt != nil {
+		t.Fatalf("unexpected status after revert %+v", st)
+	}
+}
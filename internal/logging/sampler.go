@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attributes of the summary a Sampler logs for the repeats it dropped
+const (
+	suppressedKey = "suppressed"       // Repeats dropped since the window started
+	sinceKey      = "suppressed_since" // Start of the window
+)
+
+// Sampler deduplicates repeated log records, such as the identical errors
+// of a flapping NATS connection. The first Burst occurrences of a record in
+// each window are logged; later ones are counted, and reported as one
+// summary record, the first occurrence with a "suppressed" count, once the
+// window is over. Records are identical when their level, message and
+// attributes are, so request-scoped records, which carry a request ID, are
+// never merged. Debug and trace records are not sampled.
+type Sampler struct {
+	window time.Duration
+	burst  int
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*sampleEntry
+}
+
+// sampleEntry tracks one distinct record in the current window
+type sampleEntry struct {
+	handler    slog.Handler // Handler of the first occurrence, which the summary goes to
+	record     slog.Record  // First occurrence
+	start      time.Time
+	seen       int
+	suppressed int
+}
+
+// NewSampler returns a Sampler logging the first burst occurrences of a
+// record per window
+func NewSampler(window time.Duration, burst int) *Sampler {
+	return &Sampler{window: window, burst: max(burst, 1), now: time.Now, entries: map[string]*sampleEntry{}}
+}
+
+// Flush logs the summaries of the windows that are over and forgets their
+// records
+func (s *Sampler) Flush(ctx context.Context) {
+	now := s.now()
+	var due []*sampleEntry
+	s.mu.Lock()
+	for key, e := range s.entries {
+		if now.Sub(e.start) >= s.window {
+			delete(s.entries, key)
+			if e.suppressed > 0 {
+				due = append(due, e)
+			}
+		}
+	}
+	s.mu.Unlock()
+	for _, e := range due {
+		s.summarize(ctx, e, now)
+	}
+}
+
+// Run flushes the sampler every interval until ctx is done
+func (s *Sampler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush(ctx)
+		case <-ctx.Done():
+			s.Flush(context.Background())
+			return
+		}
+	}
+}
+
+// allow reports whether r, logged through h, is within the burst of its
+// window, and returns the entry of the previous window if it ended with
+// repeats to summarize
+func (s *Sampler) allow(h slog.Handler, key string, r slog.Record) (bool, *sampleEntry) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	var ended *sampleEntry
+	if ok && now.Sub(e.start) >= s.window {
+		if e.suppressed > 0 {
+			ended = e
+		}
+		ok = false
+	}
+	if !ok {
+		s.entries[key] = &sampleEntry{handler: h, record: r.Clone(), start: now, seen: 1}
+		return true, ended
+	}
+	e.seen++
+	if e.seen <= s.burst {
+		return true, nil
+	}
+	e.suppressed++
+	return false, nil
+}
+
+func (s *Sampler) summarize(ctx context.Context, e *sampleEntry, now time.Time) {
+	r := slog.NewRecord(now, e.record.Level, e.record.Message, e.record.PC)
+	e.record.Attrs(func(a slog.Attr) bool {
+		r.AddAttrs(a)
+		return true
+	})
+	r.AddAttrs(slog.Int(suppressedKey, e.suppressed), slog.Time(sinceKey, e.start))
+	_ = e.handler.Handle(ctx, r)
+}
+
+// samplingHandler drops the records its Sampler has seen too often. scope
+// identifies the attributes and groups added with With, which are part of
+// every record's identity.
+type samplingHandler struct {
+	slog.Handler
+	sampler *Sampler
+	scope   string
+}
+
+func (h samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelInfo {
+		return h.Handler.Handle(ctx, r)
+	}
+	allowed, ended := h.sampler.allow(h.Handler, h.key(r), r)
+	if ended != nil {
+		h.sampler.summarize(ctx, ended, r.Time)
+	}
+	if !allowed {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h samplingHandler) key(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(r.Level.String())
+	b.WriteByte(0)
+	b.WriteString(h.scope)
+	b.WriteByte(0)
+	b.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteByte(0)
+		b.WriteString(a.String())
+		return true
+	})
+	return b.String()
+}
+
+func (h samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scope := h.scope
+	for _, a := range attrs {
+		scope += "\x00" + a.String()
+	}
+	return samplingHandler{Handler: h.Handler.WithAttrs(attrs), sampler: h.sampler, scope: scope}
+}
+
+func (h samplingHandler) WithGroup(name string) slog.Handler {
+	return samplingHandler{Handler: h.Handler.WithGroup(name), sampler: h.sampler, scope: h.scope + "\x00group:" + name}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gopresence/internal/requestid"
+)
+
+func TestSampler_DedupesRepeats(t *testing.T) {
+	var buf bytes.Buffer
+	sampler := NewSampler(time.Minute, 1)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	sampler.now = func() time.Time { return now }
+	logger := newLogger(&buf, "json", slog.LevelDebug, sampler)
+	records := func() []map[string]any {
+		var out []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var rec map[string]any
+			if line != "" && json.Unmarshal([]byte(line), &rec) == nil {
+				out = append(out, rec)
+			}
+		}
+		buf.Reset()
+		return out
+	}
+
+	// The standard log package, which most errors go through, is sampled too
+	std := slog.NewLogLogger(logger.Handler(), slog.LevelError)
+	for range 5 {
+		std.Print("nats disconnected: connection refused")
+	}
+	logger.Error("store health check failed", "bucket", "presence")
+	logger.Error("store health check failed", "bucket", "other")
+	logger.Debug("traced")
+	logger.Debug("traced")
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	logger.InfoContext(ctx, "request failed")
+	logger.InfoContext(requestid.NewContext(context.Background(), "req-2"), "request failed")
+	if got := records(); len(got) != 7 {
+		t.Fatalf("expected first occurrences, debug records and distinct requests to be logged, got %d: %v", len(got), got)
+	}
+
+	// Nothing is reported before the window is over
+	sampler.Flush(context.Background())
+	if got := records(); len(got) != 0 {
+		t.Fatalf("expected no summary within the window, got %v", got)
+	}
+	now = now.Add(time.Minute)
+	sampler.Flush(context.Background())
+	got := records()
+	if len(got) != 1 || got[0]["msg"] != "nats disconnected: connection refused" || got[0][suppressedKey] != float64(4) || got[0]["level"] != "ERROR" {
+		t.Fatalf("expected one summary of 4 suppressed repeats, got %v", got)
+	}
+
+	// A repeat in a later window is logged again, after the summary of the previous one
+	for range 3 {
+		std.Print("nats disconnected: connection refused")
+	}
+	now = now.Add(time.Minute)
+	std.Print("nats disconnected: connection refused")
+	got = records()
+	if len(got) != 3 || got[1][suppressedKey] != float64(2) || got[2][suppressedKey] != nil {
+		t.Fatalf("expected the first repeat, the summary and the new window's first occurrence, got %v", got)
+	}
+}
+
+func TestSampler_Burst(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "text", slog.LevelInfo, NewSampler(time.Minute, 3))
+	for range 10 {
+		logger.Warn("flapping")
+	}
+	if n := strings.Count(buf.String(), "msg=flapping"); n != 3 {
+		t.Fatalf("expected 3 records within the burst, got %d", n)
+	}
+}
@@ -1,11 +1,16 @@
 package metrics
 
 import (
+	"context"
 	"net/http"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"gopresence/internal/version"
 )
 
 var (
@@ -41,10 +46,303 @@ var (
 			Help: "Approximate number of items in cache",
 		},
 	)
+
+	kvOpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kv_operation_duration_seconds",
+			Help:    "NATS KV operation duration in seconds",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+		[]string{"op", "bucket", "outcome"},
+	)
+
+	kvSyncLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kv_sync_lag_messages",
+			Help: "Messages a KV bucket mirror, source or replica is behind",
+		},
+		[]string{"bucket", "kind", "peer"},
+	)
+
+	kvSyncLastActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kv_sync_last_active_timestamp_seconds",
+			Help: "Unix time of the last activity of a KV bucket mirror, source or replica",
+		},
+		[]string{"bucket", "kind", "peer"},
+	)
+
+	kvBucketLastUpdate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kv_bucket_last_update_timestamp_seconds",
+			Help: "Unix time of the last write to a KV bucket as seen by this node",
+		},
+		[]string{"bucket"},
+	)
+
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "Always 1; labeled with the running build's version, commit, build date and Go version",
+		},
+		[]string{"version", "commit", "build_date", "go_version"},
+	)
+
+	quotaRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quota_rejections_total",
+			Help: "Requests rejected because the caller's tenant used up a quota",
+		},
+		[]string{"route", "scope"},
+	)
+
+	rateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_rejections_total",
+			Help: "Requests rejected because the client's rate limit bucket was empty",
+		},
+		[]string{"route", "key"},
+	)
+
+	connectionLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "stream_connection_rejections_total",
+			Help: "Streaming connections refused because the caller's user or tenant was at its connection cap",
+		},
+		[]string{"scope"},
+	)
+
+	panics = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "http_panics_total",
+			Help: "HTTP requests whose handler panicked, answered 500 by the recovery middleware",
+		},
+	)
+
+	seenFilterSkips = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "presence_seen_filter_skips_total",
+			Help: "Lookups answered as not found by the never-seen-user bloom filter",
+		},
+	)
+
+	watchDrops = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kv_watch_events_dropped_total",
+			Help: "KV watch events discarded because a callback's buffer was full, by overflow policy and reason (overflow, coalesced)",
+		},
+		[]string{"policy", "reason"},
+	)
+
+	eventsRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "presence_events_rejected_total",
+			Help: "Presence events dropped before fan-out for repeating (duplicate) or preceding (stale) the last revision seen for their user",
+		},
+		[]string{"reason"},
+	)
+
+	eventsCoalesced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "presence_events_coalesced_total",
+			Help: "Presence events superseded by a later change to the same user within the coalescing window",
+		},
+	)
+
+	sinkDeliveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_sink_deliveries_total",
+			Help: "Presence event delivery attempts to event sinks, by sink, delivery mode and outcome (ok, error)",
+		},
+		[]string{"sink", "mode", "outcome"},
+	)
+
+	sinkRedeliveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_sink_redeliveries_total",
+			Help: "At-least-once deliveries of an event that was delivered before, which the sink may see as duplicates",
+		},
+		[]string{"sink"},
+	)
+
+	consumerPending = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_consumer_pending_messages",
+			Help: "Bucket changes not yet delivered to a durable consumer, such as an at-least-once event sink",
+		},
+		[]string{"consumer"},
+	)
+
+	consumerAckPending = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_consumer_ack_pending_messages",
+			Help: "Bucket changes delivered to a durable consumer but not yet acknowledged",
+		},
+		[]string{"consumer"},
+	)
+
+	consumerRedelivered = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_consumer_redelivered_messages",
+			Help: "Unacknowledged bucket changes delivered to a durable consumer more than once",
+		},
+		[]string{"consumer"},
+	)
+
+	consumerCheckpointAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_consumer_checkpoint_age_seconds",
+			Help: "Time since a durable consumer that is behind last acknowledged a change; 0 when caught up",
+		},
+		[]string{"consumer"},
+	)
+
+	writeBehindDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "presence_write_behind_queue_depth",
+			Help: "Presence writes queued locally while the store is unreachable, awaiting replay",
+		},
+	)
+
+	writeBehindReplays = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "presence_write_behind_replays_total",
+			Help: "Queued presence writes replayed to the store, by result (applied, conflict, expired)",
+		},
+		[]string{"result"},
+	)
+
+	cacheChecks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_integrity_checks_total",
+			Help: "Sampled cache entries compared against KV, by result (match, stale, orphaned, conflict)",
+		},
+		[]string{"result"},
+	)
+
+	cacheStaleness = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cache_integrity_max_stale_seconds",
+			Help: "How long the stalest cache entry of the last verification run had been superseded in KV",
+		},
+	)
+
+	shadowReads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "store_shadow_reads_total",
+			Help: "Users read from the primary store and compared against the candidate store of a migration, by result (match, mismatch, missing, unexpected, error, skipped)",
+		},
+		[]string{"result"},
+	)
+
+	sharedReads = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "store_shared_reads_total",
+			Help: "Presence lookups that missed the cache and shared another lookup's store read of the same user",
+		},
+	)
+
+	centerPrimaryConnected = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "center_primary_connected",
+			Help: "Whether a standby center's leaf link to its primary is up (1) or down (0)",
+		},
+	)
+
+	centerPromotions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "center_promotions_total",
+			Help: "Times this standby center took over from its primary",
+		},
+	)
+
+	coalescedWrites = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "presence_writes_coalesced_total",
+			Help: "Presence refreshes held back from the store and merged into the user's next write",
+		},
+	)
+
+	resultCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "query_result_cache_requests_total",
+			Help: "Contacts and stats queries answered from the result cache (hit) or computed (miss), by query",
+		},
+		[]string{"query", "result"},
+	)
+
+	presenceTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "presence_auto_transitions_total",
+			Help: "Presences changed automatically, by new status (away after the idle window, offline once the TTL lapsed)",
+		},
+		[]string{"status"},
+	)
+
+	subscriptionsActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "presence_subscriptions",
+			Help: "Live presence subscriptions registered on this node",
+		},
+	)
+
+	subscriptionWebhooks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "subscription_webhook_deliveries_total",
+			Help: "Subscription webhook deliveries by result (delivered, failed, dropped when the webhook fell behind)",
+		},
+		[]string{"result"},
+	)
+
+	webhookDeliveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_deliveries_total",
+			Help: "Presence change webhook delivery attempts, by webhook and result (delivered, failed)",
+		},
+		[]string{"webhook", "result"},
+	)
+
+	webhookDeadLetters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_dead_letters_total",
+			Help: "Presence changes a webhook never accepted: out of attempts, refused for good, or dropped with its queue full",
+		},
+		[]string{"webhook"},
+	)
+
+	featureRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_feature_requests_total",
+			Help: "Requests using an optional API feature, by route and feature (changed_since, stale_read, request_order, response_profile)",
+		},
+		[]string{"route", "feature"},
+	)
+
+	responseEncodings = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_response_encodings_total",
+			Help: "Presence responses by route and encoding (json, protobuf, ndjson)",
+		},
+		[]string{"route", "encoding"},
+	)
+
+	batchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_batch_size",
+			Help:    "User IDs requested or presences set per multi-user request, by route",
+			Buckets: []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+		},
+		[]string{"route"},
+	)
 )
 
 func init() {
-	Registry.MustRegister(reqTotal, reqInFlight, reqDuration, cacheItems)
+	Registry.MustRegister(reqTotal, reqInFlight, reqDuration, cacheItems, kvOpDuration,
+		kvSyncLag, kvSyncLastActive, kvBucketLastUpdate, buildInfo, quotaRejections, rateLimited, connectionLimited, panics, seenFilterSkips,
+		watchDrops, eventsRejected, eventsCoalesced, sinkDeliveries, sinkRedeliveries,
+		consumerPending, consumerAckPending, consumerRedelivered, consumerCheckpointAge, writeBehindDepth, writeBehindReplays,
+		cacheChecks, cacheStaleness, shadowReads, sharedReads, coalescedWrites, resultCacheRequests, centerPrimaryConnected, centerPromotions, presenceTransitions, subscriptionsActive, subscriptionWebhooks,
+		webhookDeliveries, webhookDeadLetters, featureRequests, responseEncodings, batchSize)
 }
 
 // CacheSizer provides ability to get cache size
@@ -57,8 +355,283 @@ func UpdateCacheItems(c CacheSizer) {
 	cacheItems.Set(float64(c.Size()))
 }
 
-// Middleware instruments HTTP requests
+// ObserveKVOperation records the latency of a KV operation by outcome
+func ObserveKVOperation(op, bucket, outcome string, d time.Duration) {
+	kvOpDuration.WithLabelValues(op, bucket, outcome).Observe(d.Seconds())
+}
+
+// KVSync is the sync state of one mirror, source or replica of a bucket
+type KVSync struct {
+	Kind     string
+	Peer     string
+	Lag      uint64
+	LastSync time.Time // zero if there has been no activity
+}
+
+// ObserveKVSync replaces the sync gauges of bucket, dropping peers that are
+// no longer reported
+func ObserveKVSync(bucket string, lastUpdate time.Time, peers []KVSync) {
+	kvSyncLag.DeletePartialMatch(prometheus.Labels{"bucket": bucket})
+	kvSyncLastActive.DeletePartialMatch(prometheus.Labels{"bucket": bucket})
+	for _, p := range peers {
+		kvSyncLag.WithLabelValues(bucket, p.Kind, p.Peer).Set(float64(p.Lag))
+		if !p.LastSync.IsZero() {
+			kvSyncLastActive.WithLabelValues(bucket, p.Kind, p.Peer).Set(float64(p.LastSync.UnixNano()) / 1e9)
+		}
+	}
+	if !lastUpdate.IsZero() {
+		kvBucketLastUpdate.WithLabelValues(bucket).Set(float64(lastUpdate.UnixNano()) / 1e9)
+	}
+}
+
+// SetBuildInfo reports the running build, replacing any earlier report
+func SetBuildInfo(info version.Info) {
+	buildInfo.Reset()
+	buildInfo.WithLabelValues(info.Version, info.Commit, info.BuildDate, info.GoVersion).Set(1)
+}
+
+// ObserveQuotaRejection counts a request rejected for quota on route;
+// scope is the quota that was used up
+func ObserveQuotaRejection(route, scope string) {
+	quotaRejections.WithLabelValues(routeLabel(route), scope).Inc()
+}
+
+// ObserveRateLimited counts a request rejected by the rate limiter on route;
+// key is "user" or "ip", what the client was keyed by
+func ObserveRateLimited(route, key string) {
+	rateLimited.WithLabelValues(routeLabel(route), key).Inc()
+}
+
+// ObserveConnectionLimited counts a streaming connection refused at the
+// connection cap of scope, "user" or "tenant"
+func ObserveConnectionLimited(scope string) { connectionLimited.WithLabelValues(scope).Inc() }
+
+// ObservePanic counts a request whose handler panicked
+func ObservePanic() { panics.Inc() }
+
+// ObserveSeenFilterSkip counts a lookup short-circuited by the seen filter
+func ObserveSeenFilterSkip() { seenFilterSkips.Inc() }
+
+// ObserveWatchDrop counts a watch event discarded by a full buffer; reason
+// is "coalesced" if a later change to the same key replaced it
+func ObserveWatchDrop(policy, reason string) { watchDrops.WithLabelValues(policy, reason).Inc() }
+
+// ObserveEventRejected counts an event dropped as a duplicate or stale
+func ObserveEventRejected(reason string) { eventsRejected.WithLabelValues(reason).Inc() }
+
+// ObserveEventCoalesced counts an event superseded before fan-out
+func ObserveEventCoalesced() { eventsCoalesced.Inc() }
+
+// ObserveSinkDelivery counts a delivery attempt to an event sink
+func ObserveSinkDelivery(sink, mode string, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	sinkDeliveries.WithLabelValues(sink, mode, outcome).Inc()
+}
+
+// ObserveSinkRedelivery counts an event delivered to a sink again
+func ObserveSinkRedelivery(sink string) { sinkRedeliveries.WithLabelValues(sink).Inc() }
+
+// EventConsumer is the lag of one durable consumer of the bucket
+type EventConsumer struct {
+	Name          string
+	Pending       uint64
+	AckPending    int
+	Redelivered   int
+	CheckpointAge time.Duration // Since the consumer, while behind, last acknowledged a change
+}
+
+// ObserveConsumerLag replaces the event_consumer_* gauges, dropping
+// consumers that are no longer reported
+func ObserveConsumerLag(consumers []EventConsumer) {
+	consumerPending.Reset()
+	consumerAckPending.Reset()
+	consumerRedelivered.Reset()
+	consumerCheckpointAge.Reset()
+	for _, c := range consumers {
+		consumerPending.WithLabelValues(c.Name).Set(float64(c.Pending))
+		consumerAckPending.WithLabelValues(c.Name).Set(float64(c.AckPending))
+		consumerRedelivered.WithLabelValues(c.Name).Set(float64(c.Redelivered))
+		consumerCheckpointAge.WithLabelValues(c.Name).Set(c.CheckpointAge.Seconds())
+	}
+}
+
+// SetWriteBehindDepth reports the number of queued presence writes
+func SetWriteBehindDepth(n int) { writeBehindDepth.Set(float64(n)) }
+
+// ObserveWriteBehindReplay counts a queued write replayed with result
+func ObserveWriteBehindReplay(result string) { writeBehindReplays.WithLabelValues(result).Inc() }
+
+// ObserveCacheCheck counts a sampled cache entry compared against KV
+func ObserveCacheCheck(result string) { cacheChecks.WithLabelValues(result).Inc() }
+
+// SetCacheStaleness reports the staleness of the stalest sampled entry
+func SetCacheStaleness(d time.Duration) { cacheStaleness.Set(d.Seconds()) }
+
+// ObserveShadowRead counts n users compared against the candidate store
+// with result
+func ObserveShadowRead(result string, n int) { shadowReads.WithLabelValues(result).Add(float64(n)) }
+
+// ObserveSharedRead counts a lookup served by another lookup's store read
+func ObserveSharedRead() { sharedReads.Inc() }
+
+// ObserveCoalescedWrite counts a presence refresh held back from the store
+func ObserveCoalescedWrite() { coalescedWrites.Inc() }
+
+// Queries whose results are cached, as reported to ObserveResultCache
+const (
+	ResultCacheContacts = "contacts"
+	ResultCacheStats    = "stats"
+)
+
+// ObserveResultCache counts a query answered from the result cache, or
+// computed if hit is false
+func ObserveResultCache(query string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	resultCacheRequests.WithLabelValues(query, result).Inc()
+}
+
+// SetCenterPrimaryConnected reports whether a standby's primary is reachable
+func SetCenterPrimaryConnected(connected bool) {
+	if connected {
+		centerPrimaryConnected.Set(1)
+	} else {
+		centerPrimaryConnected.Set(0)
+	}
+}
+
+// ObserveCenterPromotion counts a standby center taking over from its primary
+func ObserveCenterPromotion() { centerPromotions.Inc() }
+
+// ObservePresenceTransition counts a presence changed automatically to status
+func ObservePresenceTransition(status string) { presenceTransitions.WithLabelValues(status).Inc() }
+
+// SetSubscriptions gauges the live presence subscriptions
+func SetSubscriptions(n int) { subscriptionsActive.Set(float64(n)) }
+
+// ObserveSubscriptionWebhook counts a subscription webhook delivery by result
+func ObserveSubscriptionWebhook(result string) { subscriptionWebhooks.WithLabelValues(result).Inc() }
+
+// ObserveWebhookDelivery counts a webhook delivery attempt by result
+func ObserveWebhookDelivery(webhook, result string) { webhookDeliveries.WithLabelValues(webhook, result).Inc() }
+
+// ObserveWebhookDeadLetter counts a change a webhook never accepted
+func ObserveWebhookDeadLetter(webhook string) { webhookDeadLetters.WithLabelValues(webhook).Inc() }
+
+// Optional API features counted by api_feature_requests_total
+const (
+	FeatureChangedSince    = "changed_since"    // Delta reads: ?changed_since= or If-Modified-Since
+	FeatureStaleRead       = "stale_read"       // ?max_stale= or Cache-Control: max-stale
+	FeatureRequestOrder    = "request_order"    // ?order=request
+	FeatureResponseProfile = "response_profile" // A response shape other than the default
+	FeatureQuery           = "query"            // ?q= filters of index listings
+)
+
+// Response encodings counted by api_response_encodings_total
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+	EncodingNDJSON   = "ndjson"
+)
+
+// LabelOther replaces feature and encoding label values outside the known set
+const LabelOther = "other"
+
+var (
+	knownFeatures  = map[string]bool{FeatureChangedSince: true, FeatureStaleRead: true, FeatureRequestOrder: true, FeatureResponseProfile: true, FeatureQuery: true}
+	knownEncodings = map[string]bool{EncodingJSON: true, EncodingProtobuf: true, EncodingNDJSON: true}
+)
+
+// ObserveFeature counts a request using feature, under the route of ctx
+func ObserveFeature(ctx context.Context, feature string) {
+	if !knownFeatures[feature] {
+		feature = LabelOther
+	}
+	featureRequests.WithLabelValues(RouteFromContext(ctx), feature).Inc()
+}
+
+// ObserveEncoding counts a response written in encoding, under the route of ctx
+func ObserveEncoding(ctx context.Context, encoding string) {
+	if !knownEncodings[encoding] {
+		encoding = LabelOther
+	}
+	responseEncodings.WithLabelValues(RouteFromContext(ctx), encoding).Inc()
+}
+
+// ObserveBatchSize records the size of a multi-user request, under the route of ctx
+func ObserveBatchSize(ctx context.Context, n int) {
+	batchSize.WithLabelValues(RouteFromContext(ctx)).Observe(float64(n))
+}
+
+type routeContextKey struct{}
+
+// RouteFromContext returns the route label Middleware instrumented the
+// request under, or RouteOther outside an instrumented route
+func RouteFromContext(ctx context.Context) string {
+	if route, ok := ctx.Value(routeContextKey{}).(string); ok {
+		return route
+	}
+	return RouteOther
+}
+
+// RouteOther is the route label for unknown routes and routes past the cap
+const RouteOther = "other"
+
+// MaxRouteLabels caps the number of distinct route label values
+const MaxRouteLabels = 64
+
+var (
+	routeNameRe = regexp.MustCompile(`^[a-z0-9_.]{1,64}$`)
+
+	routesMu sync.Mutex
+	routes   = map[string]struct{}{}
+)
+
+// routeLabel guards the route label against unbounded cardinality: names
+// that don't look like route names, and any new route past MaxRouteLabels,
+// are reported as RouteOther
+func routeLabel(route string) string {
+	if !routeNameRe.MatchString(route) {
+		return RouteOther
+	}
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	if _, ok := routes[route]; ok {
+		return route
+	}
+	if len(routes) >= MaxRouteLabels {
+		return RouteOther
+	}
+	routes[route] = struct{}{}
+	return route
+}
+
+// methodLabel maps non-standard methods to a single label value
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// NotFound instruments unmatched requests under RouteOther, so scanners
+// probing random paths share one series
+func NotFound(sizer CacheSizer) http.Handler {
+	return Middleware(RouteOther, http.NotFoundHandler(), sizer)
+}
+
+// Middleware instruments HTTP requests. route should be a short static name
+// such as "presence.user", not a request path. Handlers find it with
+// RouteFromContext to label their own metrics.
 func Middleware(route string, next http.Handler, sizer CacheSizer) http.Handler {
+	route = routeLabel(route)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		reqInFlight.Inc()
@@ -66,11 +639,12 @@ func Middleware(route string, next http.Handler, sizer CacheSizer) http.Handler
 
 		// Capture status code
 		rw := &statusRecorder{ResponseWriter: w, status: 200}
-		next.ServeHTTP(rw, r)
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), routeContextKey{}, route)))
 
 		dur := time.Since(start).Seconds()
-		reqDuration.WithLabelValues(r.Method, route).Observe(dur)
-		reqTotal.WithLabelValues(r.Method, route, http.StatusText(rw.status)).Inc()
+		method := methodLabel(r.Method)
+		reqDuration.WithLabelValues(method, route).Observe(dur)
+		reqTotal.WithLabelValues(method, route, http.StatusText(rw.status)).Inc()
 
 		// Update cache items gauge opportunistically
 		UpdateCacheItems(sizer)
@@ -87,5 +661,9 @@ func (s *statusRecorder) WriteHeader(code int) {
 	s.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
 // Handler returns a promhttp handler for the Registry
 func Handler() http.Handler { return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}) }
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopresence/internal/version"
+)
+
+func resetRoutes() {
+	routesMu.Lock()
+	routes = map[string]struct{}{}
+	routesMu.Unlock()
+}
+
+// routeValues returns the distinct route label values of http_requests_total
+func routeValues(t *testing.T) map[string]bool {
+	t.Helper()
+	mfs, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	out := map[string]bool{}
+	for _, mf := range mfs {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "route" {
+					out[l.GetValue()] = true
+				}
+			}
+		}
+	}
+	return out
+}
+
+// metricValue returns the value of the name series with the given labels, or
+// 0 if there is none
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	mfs, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range mf.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue series
+				}
+			}
+			return m.GetCounter().GetValue() + m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// seriesCount returns the number of series of name
+func seriesCount(t *testing.T, name string) int {
+	t.Helper()
+	mfs, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return len(mf.GetMetric())
+		}
+	}
+	return 0
+}
+
+func TestRouteLabel_NormalizesUnknownRoutes(t *testing.T) {
+	resetRoutes()
+	cases := map[string]string{
+		"presence.user":       "presence.user",
+		"":                    RouteOther,
+		"/api/v2/presence/u1": RouteOther,
+		"presence?users=a,b":  RouteOther,
+		"Presence.User":       RouteOther,
+	}
+	for in, want := range cases {
+		if got := routeLabel(in); got != want {
+			t.Errorf("routeLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRouteLabel_CapsDistinctValues(t *testing.T) {
+	resetRoutes()
+	for i := 0; i < MaxRouteLabels; i++ {
+		if got := routeLabel(fmt.Sprintf("route.%d", i)); got == RouteOther {
+			t.Fatalf("route %d under the cap was normalized", i)
+		}
+	}
+	if got := routeLabel("route.overflow"); got != RouteOther {
+		t.Fatalf("expected route past the cap to be %q, got %q", RouteOther, got)
+	}
+	// Routes seen before the cap was reached keep their label
+	if got := routeLabel("route.0"); got != "route.0" {
+		t.Fatalf("expected known route to keep its label, got %q", got)
+	}
+}
+
+func TestNotFound_SharesOneSeries(t *testing.T) {
+	resetRoutes()
+	h := NotFound(nil)
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(fmt.Sprintf("SCAN%d", i), fmt.Sprintf("/random/%d", i), nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	}
+	for route := range routeValues(t) {
+		if route != RouteOther {
+			t.Fatalf("unexpected route label %q", route)
+		}
+	}
+	if methodLabel("SCAN1") != "OTHER" || methodLabel(http.MethodGet) != http.MethodGet {
+		t.Fatalf("unexpected method normalization")
+	}
+}
+
+func TestObserveKVSync_ReplacesPeers(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ObserveKVSync("b1", now, []KVSync{
+		{Kind: "mirror", Peer: "KV_center", Lag: 5, LastSync: now},
+		{Kind: "replica", Peer: "n2", Lag: 1},
+	})
+	if got := metricValue(t, "kv_sync_lag_messages", map[string]string{"bucket": "b1", "kind": "mirror", "peer": "KV_center"}); got != 5 {
+		t.Fatalf("expected mirror lag 5, got %v", got)
+	}
+	if got := metricValue(t, "kv_sync_last_active_timestamp_seconds", map[string]string{"bucket": "b1", "kind": "mirror", "peer": "KV_center"}); got != 1700000000 {
+		t.Fatalf("expected last sync timestamp, got %v", got)
+	}
+	if got := metricValue(t, "kv_bucket_last_update_timestamp_seconds", map[string]string{"bucket": "b1"}); got != 1700000000 {
+		t.Fatalf("expected last update timestamp, got %v", got)
+	}
+
+	// A peer missing from the next report no longer has series
+	ObserveKVSync("b1", now, []KVSync{{Kind: "mirror", Peer: "KV_center"}})
+	if n := seriesCount(t, "kv_sync_lag_messages"); n != 1 {
+		t.Fatalf("expected 1 lag series after replica left, got %d", n)
+	}
+}
+
+func TestSetBuildInfo(t *testing.T) {
+	SetBuildInfo(version.Info{Version: "v2.0.0", Commit: "old", BuildDate: "d", GoVersion: "go1"})
+	SetBuildInfo(version.Info{Version: "v2.1.0", Commit: "abc1234", BuildDate: "d", GoVersion: "go1"})
+	if n := seriesCount(t, "build_info"); n != 1 {
+		t.Fatalf("expected 1 build_info series, got %d", n)
+	}
+	if got := metricValue(t, "build_info", map[string]string{"version": "v2.1.0", "commit": "abc1234", "build_date": "d", "go_version": "go1"}); got != 1 {
+		t.Fatalf("expected build_info 1, got %v", got)
+	}
+}
+
+func TestFeatureMetrics_LabeledByRoute(t *testing.T) {
+	resetRoutes()
+	h := Middleware("presence.multiple", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ObserveFeature(r.Context(), FeatureChangedSince)
+		ObserveFeature(r.Context(), r.URL.Query().Get("feature"))
+		ObserveEncoding(r.Context(), EncodingProtobuf)
+		ObserveBatchSize(r.Context(), 40)
+	}), nil)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v2/presence?feature=fields=a,b", nil))
+
+	if got := metricValue(t, "api_feature_requests_total", map[string]string{"route": "presence.multiple", "feature": FeatureChangedSince}); got != 1 {
+		t.Fatalf("expected 1 changed_since request, got %v", got)
+	}
+	if got := metricValue(t, "api_feature_requests_total", map[string]string{"route": "presence.multiple", "feature": LabelOther}); got != 1 {
+		t.Fatalf("expected unknown features under %q, got %v", LabelOther, got)
+	}
+	if got := metricValue(t, "api_response_encodings_total", map[string]string{"route": "presence.multiple", "encoding": EncodingProtobuf}); got != 1 {
+		t.Fatalf("expected 1 protobuf response, got %v", got)
+	}
+	if n := seriesCount(t, "api_batch_size"); n != 1 {
+		t.Fatalf("expected 1 batch size series, got %d", n)
+	}
+
+	// Outside an instrumented route, observations share the other route
+	ObserveFeature(context.Background(), FeatureStaleRead)
+	if got := metricValue(t, "api_feature_requests_total", map[string]string{"route": RouteOther, "feature": FeatureStaleRead}); got != 1 {
+		t.Fatalf("expected the feature under %q, got %v", RouteOther, got)
+	}
+}
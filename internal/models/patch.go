@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// PresencePatch is a partial presence update: the fields it sets replace the
+// stored ones, and nil fields keep their stored value
+type PresencePatch struct {
+	Status        *PresenceStatus
+	Message       *string
+	TTL           time.Duration // Zero keeps the stored TTL
+	Client        *ClientInfo
+	TimeZone      *string
+	CorrelationID *string
+}
+
+// IsEmpty reports whether the patch sets no field
+func (pp PresencePatch) IsEmpty() bool {
+	return pp.Status == nil && pp.Message == nil && pp.TTL == 0 && pp.Client == nil &&
+		pp.TimeZone == nil && pp.CorrelationID == nil
+}
+
+// Apply merges the patch into p as a change made at now. updated_at always
+// moves to now, but last_seen only does when the patch sets the status:
+// editing a message isn't activity, yet a status change must not be taken
+// for idle. The correlation ID belongs to the write that set it, so it is
+// cleared unless the patch sets one.
+func (pp PresencePatch) Apply(p *Presence, now time.Time) {
+	p.UpdatedAt = now
+	if pp.Status != nil {
+		p.Status = *pp.Status
+		p.LastSeen = now
+	}
+	if pp.Message != nil {
+		p.Message = *pp.Message
+	}
+	if pp.TTL > 0 {
+		p.TTL = pp.TTL
+	}
+	if pp.Client != nil {
+		p.Client = pp.Client
+	}
+	if pp.TimeZone != nil {
+		p.TimeZone = *pp.TimeZone
+	}
+	p.CorrelationID = ""
+	if pp.CorrelationID != nil {
+		p.CorrelationID = *pp.CorrelationID
+	}
+}
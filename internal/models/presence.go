@@ -1,10 +1,18 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
 	"time"
 )
 
+// MaxTTLSeconds is the longest TTL, in seconds, a time.Duration can hold
+const MaxTTLSeconds = math.MaxInt64 / int64(time.Second)
+
 // PresenceStatus represents the presence status of a user
 type PresenceStatus string
 
@@ -15,25 +23,119 @@ const (
 	StatusOffline PresenceStatus = "offline"
 )
 
-// IsValid checks if the presence status is valid
+// IsValid checks if the presence status is a core status or one the
+// deployment configured with SetStateMachine
 func (ps PresenceStatus) IsValid() bool {
+	return CurrentStateMachine().Known(ps)
+}
+
+// PresenceSource records why a presence was written
+type PresenceSource string
+
+const (
+	SourceAPI        PresenceSource = "api"        // Set by the user through the public API
+	SourceHeartbeat  PresenceSource = "heartbeat"  // Refreshed by a client heartbeat
+	SourceCalendar   PresenceSource = "calendar"   // Derived from a calendar integration
+	SourceAutoAway   PresenceSource = "auto-away"  // Set automatically after inactivity
+	SourceAdmin      PresenceSource = "admin"      // Forced by an administrator
+	SourceConnection PresenceSource = "connection" // Implied by an open stream connection
+	SourceSync       PresenceSource = "sync"       // Reconciled from an external source of truth
+)
+
+// IsValid checks if the presence source is valid
+func (ps PresenceSource) IsValid() bool {
 	switch ps {
-	case StatusOnline, StatusAway, StatusBusy, StatusOffline:
+	case SourceAPI, SourceHeartbeat, SourceCalendar, SourceAutoAway, SourceAdmin, SourceConnection, SourceSync:
 		return true
 	default:
 		return false
 	}
 }
 
+// Client info limits
+const (
+	MaxClientFieldLength = 64 // Max length of app_version and platform
+	MaxCapabilities      = 32 // Max capabilities per client
+)
+
+// MaxCorrelationIDLength bounds the correlation ID of a write, in bytes
+const MaxCorrelationIDLength = 128
+
+// ValidateCorrelationID checks the opaque correlation ID a client attached
+// to a write; the empty ID means none was attached
+func ValidateCorrelationID(id string) error {
+	if len(id) > MaxCorrelationIDLength {
+		return fmt.Errorf("correlation_id must be at most %d bytes", MaxCorrelationIDLength)
+	}
+	return nil
+}
+
+// validCapability restricts capabilities to lowercase slugs, like statuses
+var validCapability = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// ClientInfo describes the client a presence was set from, so callers can
+// pick users whose client supports a feature, e.g. "video-capable"
+type ClientInfo struct {
+	AppVersion   string   `json:"app_version,omitempty"`
+	Platform     string   `json:"platform,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Validate checks the client info against the size and naming limits
+func (c *ClientInfo) Validate() error {
+	if len(c.AppVersion) > MaxClientFieldLength {
+		return fmt.Errorf("app_version must be at most %d bytes", MaxClientFieldLength)
+	}
+	if len(c.Platform) > MaxClientFieldLength {
+		return fmt.Errorf("platform must be at most %d bytes", MaxClientFieldLength)
+	}
+	if len(c.Capabilities) > MaxCapabilities {
+		return fmt.Errorf("at most %d capabilities", MaxCapabilities)
+	}
+	for i, capability := range c.Capabilities {
+		if !ValidCapability(capability) {
+			return fmt.Errorf("capability %q must be a lowercase name of letters, digits, '-' or '_'", capability)
+		}
+		if slices.Contains(c.Capabilities[:i], capability) {
+			return fmt.Errorf("duplicate capability %q", capability)
+		}
+	}
+	return nil
+}
+
+// ValidCapability reports whether name is a well-formed capability
+func ValidCapability(name string) bool { return validCapability.MatchString(name) }
+
+// HasCapabilities reports whether the presence's client reported every one
+// of capabilities
+func (p *Presence) HasCapabilities(capabilities []string) bool {
+	for _, capability := range capabilities {
+		if p.Client == nil || !slices.Contains(p.Client.Capabilities, capability) {
+			return false
+		}
+	}
+	return true
+}
+
 // Presence represents a user's presence information
 type Presence struct {
-	UserID    string         `json:"user_id"`
-	Status    PresenceStatus `json:"status"`
-	Message   string         `json:"message,omitempty"`
-	LastSeen  time.Time      `json:"last_seen"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	NodeID    string         `json:"node_id"`
-	TTL       time.Duration  `json:"ttl,omitempty"`
+	UserID        string         `json:"user_id"`
+	Status        PresenceStatus `json:"status"`
+	Message       string         `json:"message,omitempty"`
+	LastSeen      time.Time      `json:"last_seen"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	NodeID        string         `json:"node_id"`
+	TTL           time.Duration  `json:"ttl,omitempty"`
+	Source        PresenceSource `json:"source,omitempty"`         // Why the presence last changed
+	Client        *ClientInfo    `json:"client,omitempty"`         // Client the presence was set from, if reported
+	TimeZone      string         `json:"time_zone,omitempty"`      // IANA time zone of the user, if reported
+	CorrelationID string         `json:"correlation_id,omitempty"` // Opaque value the client attached to the write, echoed in its events
+	// Annotations attached by trusted services, keyed "<namespace>:<key>";
+	// merged in on reads and never written with the presence
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Store metadata, set on presences read back from the KV store; never persisted
+	Revision uint64    `json:"revision,omitempty"` // KV entry revision, increasing per bucket
+	StoredAt time.Time `json:"stored_at,omitzero"` // Server-side time the revision was written
 }
 
 // Validate validates the presence data
@@ -47,7 +149,21 @@ func (p *Presence) Validate() error {
 	if p.NodeID == "" {
 		return errors.New("node_id is required")
 	}
-	return nil
+	if p.Source != "" && !p.Source.IsValid() {
+		return errors.New("invalid source")
+	}
+	if p.TTL < 0 {
+		return errors.New("ttl must not be negative")
+	}
+	if p.Client != nil {
+		if err := p.Client.Validate(); err != nil {
+			return fmt.Errorf("invalid client: %w", err)
+		}
+	}
+	if err := ValidateCorrelationID(p.CorrelationID); err != nil {
+		return err
+	}
+	return ValidateTimeZone(p.TimeZone)
 }
 
 // IsExpired checks if the presence has expired based on TTL
@@ -58,9 +174,58 @@ func (p *Presence) IsExpired() bool {
 	return time.Since(p.UpdatedAt) > p.TTL
 }
 
+// ExpiresAt returns when the presence lapses to offline, or the zero time if
+// it has no TTL
+func (p *Presence) ExpiresAt() time.Time {
+	if p.TTL <= 0 {
+		return time.Time{}
+	}
+	return p.UpdatedAt.Add(p.TTL)
+}
+
+// MarshalJSON adds the derived expires_at, so clients need not know the TTL
+// semantics to tell how long a presence holds, and local_time, so they can
+// tell it is the middle of the night for the user. Both are ignored when
+// decoding.
+func (p Presence) MarshalJSON() ([]byte, error) {
+	type plain Presence
+	out := struct {
+		plain
+		ExpiresAt time.Time `json:"expires_at,omitzero"`
+		LocalTime string    `json:"local_time,omitempty"`
+	}{plain: plain(p), LocalTime: p.LocalTime(time.Now())}
+	// Times past year 9999 have no RFC 3339 form
+	if exp := p.ExpiresAt(); exp.Year() <= 9999 {
+		out.ExpiresAt = exp
+	}
+	return json.Marshal(out)
+}
+
+// NodeInfo identifies the node serving a request
+type NodeInfo struct {
+	ID      string `json:"node_id"`
+	Type    string `json:"node_type"` // "center" or "leaf"
+	Region  string `json:"region,omitempty"`
+	Version string `json:"version,omitempty"` // Build version, to spot mixed-version fleets
+}
+
 // PresenceResponse represents the API response format
 type PresenceResponse struct {
 	Success bool                `json:"success"`
 	Data    map[string]Presence `json:"data,omitempty"`
 	Error   string              `json:"error,omitempty"`
+	Code    string              `json:"code,omitempty"` // Stable code of Error, which is localized
+	Meta    *BatchMeta          `json:"meta,omitempty"` // Set on multi-user reads that skipped IDs
+	// Set on dry-run writes: Data would be stored, replacing Previous, and
+	// Changes lists the client-set fields that would change
+	DryRun   bool                `json:"dry_run,omitempty"`
+	Previous map[string]Presence `json:"previous,omitempty"`
+	Changes  []string            `json:"changes,omitempty"`
+}
+
+// BatchMeta reports the IDs a multi-user read skipped
+type BatchMeta struct {
+	Requested    int `json:"requested"`    // IDs in the request
+	Deduplicated int `json:"deduplicated"` // Repeats of an earlier ID, read once
+	Invalid      int `json:"invalid"`      // Empty or malformed IDs, not read
 }
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzPresenceJSON decodes arbitrary bytes as a Presence. Decoding must not
+// panic, and a presence that validates must survive a JSON round trip
+// unchanged and still validate.
+func FuzzPresenceJSON(f *testing.F) {
+	f.Add([]byte(`{"user_id":"u1","status":"online","node_id":"n1","ttl":60000000000}`))
+	f.Add([]byte(`{"user_id":"u1","status":"busy","message":"focus","node_id":"n1","last_seen":"2026-01-02T03:04:05Z","updated_at":"2026-01-02T03:04:05.123456789+02:00","source":"api","revision":7}`))
+	f.Add([]byte(`{"user_id":"u1","status":"online","node_id":"n1","ttl":-1}`))
+	f.Add([]byte(`{"user_id":"","status":"sleeping"}`))
+	f.Add([]byte(`{"status":null,"ttl":1e30}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`{"user_id":"u1","status":"online","node_id":"n1","client":{"platform":"ios","capabilities":["video-capable"]}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p Presence
+		if err := json.Unmarshal(data, &p); err != nil {
+			return
+		}
+		if p.Validate() != nil {
+			return
+		}
+		if p.TTL < 0 {
+			t.Fatalf("valid presence with negative TTL %d", p.TTL)
+		}
+		out, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("marshal valid presence: %v", err)
+		}
+		var back Presence
+		if err := json.Unmarshal(out, &back); err != nil {
+			t.Fatalf("unmarshal %s: %v", out, err)
+		}
+		if err := back.Validate(); err != nil {
+			t.Fatalf("round trip invalidated %s: %v", out, err)
+		}
+		if back.UserID != p.UserID || back.Status != p.Status || back.Message != p.Message || back.NodeID != p.NodeID ||
+			back.TTL != p.TTL || back.Source != p.Source || back.Revision != p.Revision ||
+			!back.UpdatedAt.Equal(p.UpdatedAt) || !back.LastSeen.Equal(p.LastSeen) || !back.StoredAt.Equal(p.StoredAt) {
+			t.Fatalf("round trip changed %+v into %+v", p, back)
+		}
+	})
+}
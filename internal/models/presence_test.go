@@ -2,6 +2,8 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -29,6 +31,17 @@ func TestPresenceStatus_IsValid(t *testing.T) {
 	}
 }
 
+func TestPresenceSource_IsValid(t *testing.T) {
+	for _, s := range []PresenceSource{SourceAPI, SourceHeartbeat, SourceCalendar, SourceAutoAway, SourceAdmin, SourceConnection, SourceSync} {
+		if !s.IsValid() {
+			t.Errorf("expected %q to be valid", s)
+		}
+	}
+	if PresenceSource("import").IsValid() || PresenceSource("").IsValid() {
+		t.Error("expected unknown and empty sources to be invalid")
+	}
+}
+
 func TestPresence_Validate(t *testing.T) {
 	now := time.Now()
 
@@ -49,6 +62,18 @@ func TestPresence_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "unknown source",
+			presence: Presence{
+				UserID:    "user123",
+				Status:    StatusOnline,
+				LastSeen:  now,
+				UpdatedAt: now,
+				NodeID:    "node1",
+				Source:    "import",
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty user ID",
 			presence: Presence{
@@ -70,6 +95,54 @@ func TestPresence_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "with client info",
+			presence: Presence{
+				UserID:    "user123",
+				Status:    StatusOnline,
+				LastSeen:  now,
+				UpdatedAt: now,
+				NodeID:    "node1",
+				Client:    &ClientInfo{AppVersion: "1.2.3", Platform: "ios", Capabilities: []string{"video-capable", "screen_share"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "malformed capability",
+			presence: Presence{
+				UserID:    "user123",
+				Status:    StatusOnline,
+				LastSeen:  now,
+				UpdatedAt: now,
+				NodeID:    "node1",
+				Client:    &ClientInfo{Capabilities: []string{"Video Capable"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate capability",
+			presence: Presence{
+				UserID:    "user123",
+				Status:    StatusOnline,
+				LastSeen:  now,
+				UpdatedAt: now,
+				NodeID:    "node1",
+				Client:    &ClientInfo{Capabilities: []string{"video", "video"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "oversized platform",
+			presence: Presence{
+				UserID:    "user123",
+				Status:    StatusOnline,
+				LastSeen:  now,
+				UpdatedAt: now,
+				NodeID:    "node1",
+				Client:    &ClientInfo{Platform: strings.Repeat("x", MaxClientFieldLength+1)},
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty node ID",
 			presence: Presence{
@@ -92,6 +165,26 @@ func TestPresence_Validate(t *testing.T) {
 	}
 }
 
+func TestPresence_HasCapabilities(t *testing.T) {
+	p := Presence{Client: &ClientInfo{Capabilities: []string{"video-capable", "screen-share"}}}
+	if !p.HasCapabilities(nil) || !p.HasCapabilities([]string{"video-capable"}) || !p.HasCapabilities([]string{"screen-share", "video-capable"}) {
+		t.Fatal("expected reported capabilities to match")
+	}
+	if p.HasCapabilities([]string{"video-capable", "dial-in"}) {
+		t.Fatal("expected a missing capability not to match")
+	}
+	if bare := (Presence{}); bare.HasCapabilities([]string{"video-capable"}) || !bare.HasCapabilities(nil) {
+		t.Fatal("expected a presence without client info to match only an empty filter")
+	}
+	many := make([]string, MaxCapabilities+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("cap%d", i)
+	}
+	if err := (&ClientInfo{Capabilities: many}).Validate(); err == nil {
+		t.Fatal("expected too many capabilities to be rejected")
+	}
+}
+
 func TestPresence_IsExpired(t *testing.T) {
 	now := time.Now()
 
@@ -182,6 +275,68 @@ func TestPresence_JSONSerialization(t *testing.T) {
 	}
 }
 
+func TestPresence_ExpiresAt(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	withTTL := Presence{UserID: "u1", Status: StatusOnline, UpdatedAt: now, LastSeen: now, NodeID: "n1", TTL: 5 * time.Minute}
+	if got := withTTL.ExpiresAt(); !got.Equal(now.Add(5 * time.Minute)) {
+		t.Fatalf("expected %s, got %s", now.Add(5*time.Minute), got)
+	}
+
+	data, err := json.Marshal(withTTL)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if fields["expires_at"] != now.Add(5*time.Minute).Format(time.RFC3339) {
+		t.Fatalf("expected expires_at in %s", data)
+	}
+	var back Presence
+	if err := json.Unmarshal(data, &back); err != nil || back.TTL != withTTL.TTL {
+		t.Fatalf("expected expires_at to be ignored on decoding, got %+v (%v)", back, err)
+	}
+
+	noTTL := withTTL
+	noTTL.TTL = 0
+	if data, _ := json.Marshal(noTTL); !noTTL.ExpiresAt().IsZero() || strings.Contains(string(data), "expires_at") {
+		t.Fatalf("expected no expires_at without a TTL, got %s", data)
+	}
+	// An expiry past year 9999 is left out rather than failing the encoding
+	far := withTTL
+	far.UpdatedAt = time.Date(9999, 12, 31, 23, 0, 0, 0, time.UTC)
+	far.TTL = 2 * time.Hour
+	if data, err := json.Marshal(far); err != nil || strings.Contains(string(data), "expires_at") {
+		t.Fatalf("expected no expires_at past year 9999, got %s (%v)", data, err)
+	}
+}
+
+func TestPresence_TimeZone(t *testing.T) {
+	for _, name := range []string{"", "UTC", "Asia/Tokyo", "America/Argentina/Buenos_Aires"} {
+		if err := ValidateTimeZone(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"Local", "Mars/Base", "../etc/passwd"} {
+		if err := ValidateTimeZone(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+
+	p := Presence{UserID: "u1", Status: StatusOnline, NodeID: "n1", TimeZone: "Asia/Tokyo"}
+	if got := p.LocalTime(time.Date(2026, 3, 1, 23, 30, 45, 0, time.UTC)); got != "2026-03-02T08:30:00+09:00" {
+		t.Fatalf("unexpected local time %q", got)
+	}
+	if data, _ := json.Marshal(p); !strings.Contains(string(data), `"time_zone":"Asia/Tokyo"`) || !strings.Contains(string(data), `"local_time":`) {
+		t.Fatalf("expected time_zone and local_time in %s", data)
+	}
+	p.TimeZone = ""
+	if data, _ := json.Marshal(p); strings.Contains(string(data), "local_time") {
+		t.Fatalf("expected no local_time without a time zone, got %s", data)
+	}
+}
+
 func TestPresenceResponse_JSONSerialization(t *testing.T) {
 	now := time.Now().UTC().Truncate(time.Second)
 
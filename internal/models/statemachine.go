@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync/atomic"
+)
+
+// coreStatuses are the statuses every deployment accepts
+var coreStatuses = []PresenceStatus{StatusOnline, StatusAway, StatusBusy, StatusOffline}
+
+// validStatusName restricts configured statuses to lowercase slugs
+var validStatusName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// StateMachine describes the statuses a deployment accepts on top of the
+// core ones and which changes between statuses are allowed
+type StateMachine struct {
+	extra       map[PresenceStatus]bool
+	transitions map[PresenceStatus]map[PresenceStatus]bool // from -> allowed targets
+}
+
+// NewStateMachine builds a state machine accepting the core statuses plus
+// extra. transitions lists the statuses each status may change to; a status
+// without an entry may change to any status. Every status named must be
+// known.
+func NewStateMachine(extra []PresenceStatus, transitions map[PresenceStatus][]PresenceStatus) (*StateMachine, error) {
+	m := &StateMachine{
+		extra:       make(map[PresenceStatus]bool),
+		transitions: make(map[PresenceStatus]map[PresenceStatus]bool),
+	}
+	for _, s := range extra {
+		if !validStatusName.MatchString(string(s)) {
+			return nil, fmt.Errorf("status %q must be a lowercase name of letters, digits, '-' or '_'", s)
+		}
+		if s.isCore() || m.extra[s] {
+			return nil, fmt.Errorf("duplicate status %q", s)
+		}
+		m.extra[s] = true
+	}
+	for from, targets := range transitions {
+		if !m.Known(from) {
+			return nil, fmt.Errorf("transition from unknown status %q", from)
+		}
+		allowed := make(map[PresenceStatus]bool, len(targets))
+		for _, to := range targets {
+			if !m.Known(to) {
+				return nil, fmt.Errorf("transition from %q to unknown status %q", from, to)
+			}
+			allowed[to] = true
+		}
+		m.transitions[from] = allowed
+	}
+	return m, nil
+}
+
+// Known reports whether status is a core or configured status
+func (m *StateMachine) Known(status PresenceStatus) bool {
+	return status.isCore() || (m != nil && m.extra[status])
+}
+
+// Allows reports whether a presence may change from one status to another.
+// Keeping the same status, e.g. to refresh the TTL or change the message, is
+// always allowed.
+func (m *StateMachine) Allows(from, to PresenceStatus) bool {
+	if m == nil || from == to {
+		return true
+	}
+	allowed, ok := m.transitions[from]
+	return !ok || allowed[to]
+}
+
+// Restricted reports whether any transition rules are configured, so
+// callers can skip reading the current status when none are
+func (m *StateMachine) Restricted() bool {
+	return m != nil && len(m.transitions) > 0
+}
+
+// Custom returns the configured statuses in sorted order
+func (m *StateMachine) Custom() []PresenceStatus {
+	if m == nil {
+		return nil
+	}
+	extra := make([]PresenceStatus, 0, len(m.extra))
+	for s := range m.extra {
+		extra = append(extra, s)
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+	return extra
+}
+
+// Statuses returns the core statuses followed by the configured ones
+func (m *StateMachine) Statuses() []PresenceStatus {
+	return append(append([]PresenceStatus(nil), coreStatuses...), m.Custom()...)
+}
+
+func (ps PresenceStatus) isCore() bool {
+	switch ps {
+	case StatusOnline, StatusAway, StatusBusy, StatusOffline:
+		return true
+	default:
+		return false
+	}
+}
+
+// machine is the process-wide state machine consulted by IsValid
+var machine atomic.Pointer[StateMachine]
+
+// SetStateMachine installs m as the process-wide state machine; nil
+// restores the core statuses with unrestricted transitions
+func SetStateMachine(m *StateMachine) {
+	machine.Store(m)
+}
+
+// CurrentStateMachine returns the process-wide state machine, nil when none
+// is configured. The methods of a nil StateMachine describe the core
+// statuses with unrestricted transitions.
+func CurrentStateMachine() *StateMachine {
+	return machine.Load()
+}
@@ -0,0 +1,73 @@
+package models
+
+import "testing"
+
+func TestStateMachine_StatusesAndTransitions(t *testing.T) {
+	m, err := NewStateMachine([]PresenceStatus{"on-break", "in-call"}, map[PresenceStatus][]PresenceStatus{
+		"in-call":     {StatusOnline, StatusBusy},
+		StatusOffline: {StatusOnline},
+	})
+	if err != nil {
+		t.Fatalf("NewStateMachine: %v", err)
+	}
+	want := []PresenceStatus{StatusOnline, StatusAway, StatusBusy, StatusOffline, "in-call", "on-break"}
+	if got := m.Statuses(); len(got) != len(want) || got[4] != want[4] || got[5] != want[5] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	cases := []struct {
+		from, to PresenceStatus
+		allowed  bool
+	}{
+		{"in-call", StatusBusy, true},
+		{"in-call", StatusAway, false},
+		{"in-call", "in-call", true}, // Refreshing keeps the status
+		{StatusOffline, "in-call", false},
+		{StatusOnline, "on-break", true}, // No rule: anything goes
+	}
+	for _, c := range cases {
+		if got := m.Allows(c.from, c.to); got != c.allowed {
+			t.Errorf("Allows(%s, %s) = %v, want %v", c.from, c.to, got, c.allowed)
+		}
+	}
+	if !m.Restricted() {
+		t.Fatal("expected transition rules to restrict the machine")
+	}
+	var none *StateMachine
+	if none.Restricted() || !none.Allows(StatusOffline, StatusBusy) || none.Known("in-call") {
+		t.Fatal("expected a nil machine to allow only the core statuses, freely")
+	}
+}
+
+func TestStateMachine_RejectsBadConfig(t *testing.T) {
+	bad := []struct {
+		extra       []PresenceStatus
+		transitions map[PresenceStatus][]PresenceStatus
+	}{
+		{extra: []PresenceStatus{"In Call"}},
+		{extra: []PresenceStatus{"busy"}},
+		{extra: []PresenceStatus{"dnd", "dnd"}},
+		{transitions: map[PresenceStatus][]PresenceStatus{"in-call": {StatusOnline}}},
+		{transitions: map[PresenceStatus][]PresenceStatus{StatusOnline: {"in-call"}}},
+	}
+	for i, c := range bad {
+		if _, err := NewStateMachine(c.extra, c.transitions); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestPresenceStatus_IsValidWithStateMachine(t *testing.T) {
+	m, err := NewStateMachine([]PresenceStatus{"in-call"}, nil)
+	if err != nil {
+		t.Fatalf("NewStateMachine: %v", err)
+	}
+	if PresenceStatus("in-call").IsValid() {
+		t.Fatal("expected in-call to be unknown before the machine is installed")
+	}
+	SetStateMachine(m)
+	t.Cleanup(func() { SetStateMachine(nil) })
+	if !PresenceStatus("in-call").IsValid() || !StatusAway.IsValid() || PresenceStatus("sleeping").IsValid() {
+		t.Fatal("expected the configured status to be accepted alongside the core ones")
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // Validate zone names the same way whatever the host has installed
+)
+
+// ValidateTimeZone checks that name is an IANA time zone such as
+// "Europe/Berlin"; the empty name means none was reported
+func ValidateTimeZone(name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == "Local" {
+		return fmt.Errorf("time_zone %q is not an IANA time zone", name)
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("unknown time_zone %q", name)
+	}
+	return nil
+}
+
+// LocalTime returns the user's local time at now, RFC 3339 at minute
+// precision, or "" without a valid time zone
+func (p *Presence) LocalTime(now time.Time) string {
+	if p.TimeZone == "" || p.TimeZone == "Local" {
+		return ""
+	}
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return ""
+	}
+	return now.In(loc).Truncate(time.Minute).Format(time.RFC3339)
+}
@@ -0,0 +1,120 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// AnnotationOpener is implemented by stores that can open a bucket of
+// presence annotations alongside the presence bucket
+type AnnotationOpener interface {
+	OpenAnnotations(ctx context.Context, bucket string) (*Annotations, error)
+}
+
+// Annotations is a KV bucket of the annotations trusted services attach to
+// users. Each namespace of a user is its own entry, keyed
+// "<namespace>.<user ID>", so services writing different namespaces never
+// contend. Entries don't expire; services clear what they set.
+type Annotations struct {
+	kv           jetstream.KeyValue
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// OpenAnnotations opens the annotation bucket, which must have been declared
+// in the Resources of the center
+func (s *kvStore) OpenAnnotations(ctx context.Context, bucket string) (*Annotations, error) {
+	if s.js == nil {
+		return nil, nats.ErrConnectionClosed
+	}
+	kv, err := s.js.KeyValue(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open annotation bucket: %w", err)
+	}
+	return &Annotations{kv: kv, readTimeout: s.config.ReadTimeout, writeTimeout: s.config.WriteTimeout}, nil
+}
+
+// Put stores the encoded annotations of userID in namespace, replacing any
+func (a *Annotations) Put(ctx context.Context, namespace, userID string, value []byte) error {
+	ctx, cancel := withTimeout(ctx, a.writeTimeout)
+	defer cancel()
+	if _, err := a.kv.Put(ctx, annotationKey(namespace, userID), value); err != nil {
+		return fmt.Errorf("failed to store annotations: %w", asTimeout(ctx, opSet, err))
+	}
+	return nil
+}
+
+// Delete removes the annotations of userID in namespace
+func (a *Annotations) Delete(ctx context.Context, namespace, userID string) error {
+	ctx, cancel := withTimeout(ctx, a.writeTimeout)
+	defer cancel()
+	err := a.kv.Delete(ctx, annotationKey(namespace, userID))
+	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("failed to delete annotations: %w", asTimeout(ctx, opDelete, err))
+	}
+	return nil
+}
+
+// Watch delivers every stored entry and then each change until ctx is done;
+// value is nil for deleted entries. It returns once the stored entries have
+// been delivered.
+func (a *Annotations) Watch(ctx context.Context, callback func(namespace, userID string, value []byte)) error {
+	setupCtx, cancel := withTimeout(ctx, a.readTimeout)
+	defer cancel()
+	w, err := a.kv.WatchAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to watch annotations: %w", asTimeout(setupCtx, opWatch, err))
+	}
+	deliver := func(entry jetstream.KeyValueEntry) {
+		namespace, userID, ok := strings.Cut(entry.Key(), ".")
+		if !ok {
+			return
+		}
+		if entry.Operation() != jetstream.KeyValuePut {
+			callback(namespace, userID, nil)
+			return
+		}
+		callback(namespace, userID, entry.Value())
+	}
+	// The watcher marks the end of the stored entries with a nil entry
+	for loaded := false; !loaded; {
+		select {
+		case entry := <-w.Updates():
+			if entry == nil {
+				loaded = true
+				continue
+			}
+			deliver(entry)
+		case <-setupCtx.Done():
+			w.Stop()
+			return fmt.Errorf("failed to load annotations: %w", asTimeout(setupCtx, opWatch, setupCtx.Err()))
+		}
+	}
+	go func() {
+		defer w.Stop()
+		for {
+			select {
+			case entry, ok := <-w.Updates():
+				if !ok {
+					return
+				}
+				if entry != nil {
+					deliver(entry)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func annotationKey(namespace, userID string) string {
+	return namespace + "." + userID
+}
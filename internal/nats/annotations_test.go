@@ -0,0 +1,66 @@
+package nats
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAnnotations_PutDeleteWatch(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-annotations", Embedded: true, DataDir: t.TempDir(),
+		Resources: Resources{Buckets: []BucketSpec{{Name: "test-annotations"}}}})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, err := store.(AnnotationOpener).OpenAnnotations(ctx, "test-annotations")
+	if err != nil {
+		t.Fatalf("OpenAnnotations: %v", err)
+	}
+	if err := a.Put(ctx, "pager", "alice", []byte(`{"on-call":"true"}`)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	var mu sync.Mutex
+	seen := map[string]string{}
+	record := func(namespace, userID string, value []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[namespace+"/"+userID] = string(value)
+	}
+	if err := a.Watch(ctx, record); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	mu.Lock()
+	loaded := seen["pager/alice"]
+	mu.Unlock()
+	if loaded != `{"on-call":"true"}` {
+		t.Fatalf("expected stored entries before Watch returns, got %q", loaded)
+	}
+
+	if err := a.Put(ctx, "ci", "bob.b", []byte(`{"build":"red"}`)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := a.Delete(ctx, "pager", "alice"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := a.Delete(ctx, "pager", "nobody"); err != nil {
+		t.Fatalf("expected deleting a missing entry to succeed, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		bob, alice := seen["ci/bob.b"], seen["pager/alice"]
+		mu.Unlock()
+		if bob == `{"build":"red"}` && alice == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the put and delete to be watched, got %v", seen)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,137 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Resources are the JetStream resources a deployment needs. Center nodes
+// declare them at startup, before opening anything; every declaration is
+// create-or-update, so declaring them again is harmless and brings existing
+// resources in line with the configuration.
+type Resources struct {
+	Buckets   []BucketSpec
+	Streams   []StreamSpec
+	Consumers []string // Durable consumers of the presence bucket's changes, as WatchDurable uses them
+}
+
+// BucketSpec declares a KV bucket
+type BucketSpec struct {
+	Name     string
+	TTL      time.Duration // Entry TTL; 0 keeps entries forever
+	History  uint8         // Values kept per key (default 1)
+	Replicas int           // Copies across the cluster (default 1)
+}
+
+// StreamSpec declares a stream capturing Subjects. A stream that already
+// captures the first subject satisfies the spec whatever its name, so
+// streams an operator set up by hand are left alone.
+type StreamSpec struct {
+	Name     string
+	Subjects []string
+	MaxAge   time.Duration // Message retention; 0 keeps messages until the limits of the account
+	Replicas int
+}
+
+// defaultPresenceTTL is the presence bucket's entry TTL when Resources
+// doesn't declare the bucket
+const defaultPresenceTTL = time.Hour
+
+// Bootstrap connects to the server of config, declares its resources and
+// disconnects. Provisioning pipelines use it to set up JetStream ahead of
+// the nodes; nodes of type center do the same when they start.
+func Bootstrap(ctx context.Context, config KVConfig) error {
+	serverURL := config.ServerURL
+	if serverURL == "" {
+		serverURL = nats.DefaultURL
+	}
+	conn, err := nats.Connect(serverURL, connectOptions(config)...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	return declare(ctx, js, config)
+}
+
+// declare creates or updates the resources of config, the presence bucket
+// first so the consumers of its stream can follow
+func declare(ctx context.Context, js jetstream.JetStream, config KVConfig) error {
+	for _, b := range declaredBuckets(config) {
+		kvc := jetstream.KeyValueConfig{
+			Bucket:   b.Name,
+			TTL:      b.TTL,
+			History:  max(b.History, 1),
+			Replicas: max(b.Replicas, 1),
+		}
+		if b.Name == bucketName(config) && config.PrimaryURL != "" {
+			var err error
+			if kvc, err = standbyBucket(ctx, js, config, kvc); err != nil {
+				return err
+			}
+		}
+		if _, err := js.CreateOrUpdateKeyValue(ctx, kvc); err != nil {
+			return fmt.Errorf("failed to declare KV bucket %s: %w", b.Name, err)
+		}
+	}
+	for _, st := range config.Resources.Streams {
+		if len(st.Subjects) == 0 {
+			return fmt.Errorf("stream %s declares no subjects", st.Name)
+		}
+		name, err := js.StreamNameBySubject(ctx, st.Subjects[0])
+		if err == nil && name != "" {
+			continue
+		}
+		if err != nil && !errors.Is(err, jetstream.ErrStreamNotFound) {
+			return fmt.Errorf("failed to look up stream for %s: %w", st.Subjects[0], err)
+		}
+		if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     st.Name,
+			Subjects: st.Subjects,
+			MaxAge:   st.MaxAge,
+			Replicas: max(st.Replicas, 1),
+		}); err != nil {
+			return fmt.Errorf("failed to declare stream %s: %w", st.Name, err)
+		}
+	}
+	bucket := bucketName(config)
+	for _, name := range config.Resources.Consumers {
+		if _, err := js.CreateOrUpdateConsumer(ctx, "KV_"+bucket, durableConsumerConfig(bucket, name)); err != nil {
+			return fmt.Errorf("failed to declare durable consumer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// declaredBuckets is the buckets of config, including the presence bucket
+// when it isn't declared
+func declaredBuckets(config KVConfig) []BucketSpec {
+	presence := bucketName(config)
+	for _, b := range config.Resources.Buckets {
+		if b.Name == presence {
+			return config.Resources.Buckets
+		}
+	}
+	return append([]BucketSpec{{Name: presence, TTL: defaultPresenceTTL}}, config.Resources.Buckets...)
+}
+
+// durableConsumerConfig is the consumer a durable watch of bucket named
+// name reads through
+func durableConsumerConfig(bucket, name string) jetstream.ConsumerConfig {
+	return jetstream.ConsumerConfig{
+		Durable:       name,
+		FilterSubject: "$KV." + bucket + ".>",
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       durableAckWait,
+		MaxAckPending: 1,
+	}
+}
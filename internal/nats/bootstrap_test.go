@@ -0,0 +1,72 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestBootstrap_DeclaresIdempotently(t *testing.T) {
+	config := KVConfig{BucketName: "test-presence-bootstrap", Embedded: true, DataDir: t.TempDir()}
+	store, err := NewKVStore(config)
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	s := store.(*kvStore)
+	ctx := context.Background()
+
+	// A stream set up by hand already captures the second sink's subject
+	if _, err := s.js.CreateStream(ctx, jetstream.StreamConfig{Name: "MANUAL", Subjects: []string{"audit.manual"}}); err != nil {
+		t.Fatalf("CreateStream: %v", err)
+	}
+	config.ServerURL = s.config.ServerURL
+	config.Resources = Resources{
+		Buckets: []BucketSpec{
+			{Name: "test-presence-bootstrap", TTL: 10 * time.Minute, History: 3},
+			{Name: "test-bootstrap-counters", TTL: time.Hour},
+		},
+		Streams: []StreamSpec{
+			{Name: "SINK_audit", Subjects: []string{"audit.events"}},
+			{Name: "SINK_manual", Subjects: []string{"audit.manual"}},
+		},
+		Consumers: []string{"sink_audit"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := Bootstrap(ctx, config); err != nil {
+			t.Fatalf("Bootstrap run %d: %v", i+1, err)
+		}
+	}
+
+	kv, err := s.js.KeyValue(ctx, "test-presence-bootstrap")
+	if err != nil {
+		t.Fatalf("KeyValue: %v", err)
+	}
+	status, err := kv.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.TTL() != 10*time.Minute || status.History() != 3 {
+		t.Fatalf("expected the presence bucket to be updated, got ttl=%v history=%d", status.TTL(), status.History())
+	}
+	if _, err := s.js.KeyValue(ctx, "test-bootstrap-counters"); err != nil {
+		t.Fatalf("expected the counter bucket to be declared: %v", err)
+	}
+	if _, err := s.js.Stream(ctx, "SINK_audit"); err != nil {
+		t.Fatalf("expected the sink stream to be declared: %v", err)
+	}
+	if _, err := s.js.Stream(ctx, "SINK_manual"); err == nil {
+		t.Fatal("expected a subject captured by another stream not to get its own")
+	}
+	if _, err := s.js.Consumer(ctx, "KV_test-presence-bootstrap", "sink_audit"); err != nil {
+		t.Fatalf("expected the durable consumer to be declared: %v", err)
+	}
+	if _, err := s.OpenCounters(ctx, "test-bootstrap-counters"); err != nil {
+		t.Fatalf("OpenCounters: %v", err)
+	}
+	if _, err := s.OpenAnnotations(ctx, "test-undeclared"); err == nil {
+		t.Fatal("expected an undeclared bucket not to be created on open")
+	}
+}
@@ -0,0 +1,32 @@
+//go:build conformance
+
+package nats_test
+
+import (
+	"os"
+	"testing"
+
+	"gopresence/internal/nats"
+	"gopresence/internal/nats/storetest"
+)
+
+// TestExternalStore_Conformance runs the store contract against an external
+// NATS server: go test -tags conformance ./internal/nats/ with
+// STORE_CONFORMANCE_URL (and optionally STORE_CONFORMANCE_BUCKET) set
+func TestExternalStore_Conformance(t *testing.T) {
+	url := os.Getenv("STORE_CONFORMANCE_URL")
+	if url == "" {
+		t.Skip("STORE_CONFORMANCE_URL is not set")
+	}
+	bucket := os.Getenv("STORE_CONFORMANCE_BUCKET")
+	if bucket == "" {
+		bucket = "presence-conformance"
+	}
+	storetest.Run(t, func(t *testing.T) nats.KVStore {
+		s, err := nats.NewKVStore(nats.KVConfig{ServerURL: url, BucketName: bucket, NodeType: "center"})
+		if err != nil {
+			t.Fatalf("NewKVStore(%s): %v", url, err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,24 @@
+package nats_test
+
+import (
+	"testing"
+
+	"gopresence/internal/nats"
+	"gopresence/internal/nats/storetest"
+)
+
+// TestKVStore_Conformance runs the store contract against the KV store on an
+// embedded server
+func TestKVStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) nats.KVStore {
+		s, err := nats.NewKVStore(nats.KVConfig{
+			BucketName: "conformance",
+			Embedded:   true,
+			DataDir:    t.TempDir(),
+		})
+		if err != nil {
+			t.Fatalf("NewKVStore: %v", err)
+		}
+		return s
+	})
+}
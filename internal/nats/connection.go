@@ -0,0 +1,101 @@
+package nats
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ConnectionEventType identifies a NATS connection state change
+type ConnectionEventType string
+
+const (
+	ConnectionConnected    ConnectionEventType = "connected"
+	ConnectionDisconnected ConnectionEventType = "disconnected"
+	ConnectionReconnected  ConnectionEventType = "reconnected"
+	ConnectionClosed       ConnectionEventType = "closed"
+)
+
+// ConnectionEvent describes a NATS connection state change
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	URL  string // Server connected to, for connected/reconnected
+	Err  error  // Cause of a disconnect, if known
+}
+
+// ConnectionObserver is notified of NATS connection state changes.
+// Calls are made from the NATS client's callback goroutine and must not block.
+type ConnectionObserver interface {
+	ConnectionChanged(ConnectionEvent)
+}
+
+// ConnectionObserverFunc adapts a function to ConnectionObserver
+type ConnectionObserverFunc func(ConnectionEvent)
+
+// ConnectionChanged implements ConnectionObserver
+func (f ConnectionObserverFunc) ConnectionChanged(ev ConnectionEvent) { f(ev) }
+
+// Reconnect defaults, used when KVConfig leaves them unset
+const (
+	defaultReconnectWait    = 500 * time.Millisecond
+	defaultReconnectMaxWait = 30 * time.Second
+)
+
+// reconnectBackoff returns an exponential backoff capped at max, with half
+// of each delay randomized so a fleet of nodes doesn't reconnect in lockstep
+func reconnectBackoff(base, max time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		half := d / 2
+		return half + rand.N(half+1)
+	}
+}
+
+// connectOptions builds the reconnect policy and event hooks for config
+func connectOptions(config KVConfig) []nats.Option {
+	base, max := config.ReconnectWait, config.ReconnectMaxWait
+	if base <= 0 {
+		base = defaultReconnectWait
+	}
+	if max < base {
+		max = defaultReconnectMaxWait
+		if max < base {
+			max = base
+		}
+	}
+	maxReconnects := config.MaxReconnects
+	if maxReconnects <= 0 {
+		maxReconnects = -1 // Unlimited
+	}
+
+	opts := []nats.Option{
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(maxReconnects),
+		nats.CustomReconnectDelay(reconnectBackoff(base, max)),
+	}
+
+	if obs := config.Observer; obs != nil {
+		opts = append(opts,
+			nats.ConnectHandler(func(nc *nats.Conn) {
+				obs.ConnectionChanged(ConnectionEvent{Type: ConnectionConnected, URL: nc.ConnectedUrlRedacted()})
+			}),
+			nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+				obs.ConnectionChanged(ConnectionEvent{Type: ConnectionDisconnected, Err: err})
+			}),
+			nats.ReconnectHandler(func(nc *nats.Conn) {
+				obs.ConnectionChanged(ConnectionEvent{Type: ConnectionReconnected, URL: nc.ConnectedUrlRedacted()})
+			}),
+			nats.ClosedHandler(func(nc *nats.Conn) {
+				obs.ConnectionChanged(ConnectionEvent{Type: ConnectionClosed, Err: nc.LastError()})
+			}),
+		)
+	}
+	return opts
+}
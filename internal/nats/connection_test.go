@@ -0,0 +1,61 @@
+package nats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff_GrowsWithJitterAndCaps(t *testing.T) {
+	backoff := reconnectBackoff(100*time.Millisecond, time.Second)
+	for attempt, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			d := backoff(attempt)
+			if d < want/2 || d > want {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+func TestKVStore_ConnectionEvents(t *testing.T) {
+	events := make(chan ConnectionEvent, 8)
+	store, err := NewKVStore(KVConfig{
+		BucketName:    "test-presence-conn",
+		Embedded:      true,
+		DataDir:       t.TempDir(),
+		ReconnectWait: 10 * time.Millisecond,
+		Observer:      ConnectionObserverFunc(func(ev ConnectionEvent) { events <- ev }),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+
+	expect := func(want ConnectionEventType) {
+		t.Helper()
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type == want {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timed out waiting for %s event", want)
+			}
+		}
+	}
+	expect(ConnectionConnected)
+
+	// Shutting the embedded server down drops the client connection
+	ks := store.(*kvStore)
+	ks.server.Shutdown()
+	expect(ConnectionDisconnected)
+
+	store.Close()
+	expect(ConnectionClosed)
+}
@@ -0,0 +1,140 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// maxCounterAttempts bounds the compare-and-set retries of one Add
+const maxCounterAttempts = 10
+
+// CounterOpener is implemented by stores that can open a bucket of shared
+// counters alongside the presence bucket, e.g. for quota accounting
+type CounterOpener interface {
+	OpenCounters(ctx context.Context, bucket string) (*Counters, error)
+}
+
+// Counters is a KV bucket of int64 counters. Every node updates them with
+// compare-and-set, so concurrent additions from any node are never lost.
+type Counters struct {
+	kv           jetstream.KeyValue
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// OpenCounters opens the counter bucket, which must have been declared in
+// the Resources of the center
+func (s *kvStore) OpenCounters(ctx context.Context, bucket string) (*Counters, error) {
+	if s.js == nil {
+		return nil, nats.ErrConnectionClosed
+	}
+	kv, err := s.js.KeyValue(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open counter bucket: %w", err)
+	}
+	return &Counters{kv: kv, readTimeout: s.config.ReadTimeout, writeTimeout: s.config.WriteTimeout}, nil
+}
+
+// Add adds delta to the counter at key, creating it if needed, and returns
+// the new value
+func (c *Counters) Add(ctx context.Context, key string, delta int64) (int64, error) {
+	ctx, cancel := withTimeout(ctx, c.writeTimeout)
+	defer cancel()
+
+	for attempt := 0; attempt < maxCounterAttempts; attempt++ {
+		entry, err := c.kv.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrKeyDeleted) {
+			_, err = c.kv.Create(ctx, key, encodeCounter(delta))
+			if err == nil {
+				return delta, nil
+			}
+			if errors.Is(err, jetstream.ErrKeyExists) {
+				continue
+			}
+			return 0, fmt.Errorf("failed to create counter: %w", asTimeout(ctx, opSet, err))
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read counter: %w", asTimeout(ctx, opGet, err))
+		}
+
+		current, err := decodeCounter(entry.Value())
+		if err != nil {
+			return 0, err
+		}
+		_, err = c.kv.Update(ctx, key, encodeCounter(current+delta), entry.Revision())
+		if err == nil {
+			return current + delta, nil
+		}
+		if !errors.Is(err, jetstream.ErrKeyExists) {
+			return 0, fmt.Errorf("failed to update counter: %w", asTimeout(ctx, opSet, err))
+		}
+	}
+	return 0, fmt.Errorf("failed to update counter %s: too much contention", key)
+}
+
+// Get returns the counter at key, 0 if it doesn't exist
+func (c *Counters) Get(ctx context.Context, key string) (int64, error) {
+	ctx, cancel := withTimeout(ctx, c.readTimeout)
+	defer cancel()
+
+	entry, err := c.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrKeyDeleted) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read counter: %w", asTimeout(ctx, opGet, err))
+	}
+	return decodeCounter(entry.Value())
+}
+
+// List returns the counters whose keys match filter, a KV key pattern such
+// as "tenant.acme.>"
+func (c *Counters) List(ctx context.Context, filter string) (map[string]int64, error) {
+	if err := validateKeyFilter(filter); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, c.readTimeout)
+	defer cancel()
+
+	lister, err := c.kv.ListKeysFiltered(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list counters: %w", asTimeout(ctx, opKeys, err))
+	}
+	defer lister.Stop()
+
+	var keys []string
+	for key := range lister.Keys() {
+		keys = append(keys, key)
+	}
+
+	counts := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		entry, err := c.kv.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrKeyDeleted) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read counter: %w", asTimeout(ctx, opGet, err))
+		}
+		if counts[key], err = decodeCounter(entry.Value()); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func encodeCounter(v int64) []byte { return []byte(strconv.FormatInt(v, 10)) }
+
+func decodeCounter(b []byte) (int64, error) {
+	v, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid counter value %q: %w", b, err)
+	}
+	return v, nil
+}
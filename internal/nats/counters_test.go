@@ -0,0 +1,55 @@
+package nats
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestCounters_AddGetList(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-counters", Embedded: true, DataDir: t.TempDir(),
+		Resources: Resources{Buckets: []BucketSpec{{Name: "test-counters"}}}})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	c, err := store.(CounterOpener).OpenCounters(ctx, "test-counters")
+	if err != nil {
+		t.Fatalf("OpenCounters: %v", err)
+	}
+
+	if v, err := c.Get(ctx, "t.a.total"); err != nil || v != 0 {
+		t.Fatalf("expected missing counter to read 0, got %d %v", v, err)
+	}
+
+	// Concurrent additions all land
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Add(ctx, "t.a.total", 2); err != nil {
+				t.Errorf("Add: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, err := c.Get(ctx, "t.a.total"); err != nil || v != 10 {
+		t.Fatalf("expected 10, got %d %v", v, err)
+	}
+	if v, err := c.Add(ctx, "t.b.total", 3); err != nil || v != 3 {
+		t.Fatalf("expected 3, got %d %v", v, err)
+	}
+
+	counts, err := c.List(ctx, "t.a.>")
+	if err != nil || len(counts) != 1 || counts["t.a.total"] != 10 {
+		t.Fatalf("unexpected listing %v %v", counts, err)
+	}
+	if counts, err := c.List(ctx, "t.none.>"); err != nil || len(counts) != 0 {
+		t.Fatalf("expected empty listing, got %v %v", counts, err)
+	}
+	if _, err := c.List(ctx, "t..>"); err == nil {
+		t.Fatal("expected invalid filter to be rejected")
+	}
+}
@@ -0,0 +1,125 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gopresence/internal/metrics"
+)
+
+// OverflowPolicy decides what a buffered watch does with a new event when
+// its buffer is full
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest discards the oldest buffered event
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowCoalesce replaces a buffered event for the same key, keeping
+	// only the latest change per key; with none buffered it blocks like
+	// OverflowBlock, since dropping an event could lose a key's last change
+	OverflowCoalesce OverflowPolicy = "coalesce"
+	// OverflowBlock holds up the watch until the callback catches up, which
+	// stalls delivery to every callback of the watch but loses nothing
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// DefaultOverflowPolicy keeps the latest change of every key, which is all a
+// presence consumer needs, and never loses it
+const DefaultOverflowPolicy = OverflowCoalesce
+
+// ParseOverflowPolicy validates an overflow policy name; empty selects
+// DefaultOverflowPolicy
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case "":
+		return DefaultOverflowPolicy, nil
+	case OverflowDropOldest, OverflowCoalesce, OverflowBlock:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown watch overflow policy %q", s)
+}
+
+// dispatcher decouples watch callbacks from the consumer: events are
+// buffered and delivered in order on a separate goroutine, so a slow callback
+// only backs up its own buffer
+type dispatcher struct {
+	size    int
+	policy  OverflowPolicy
+	deliver func(WatchEvent)
+
+	mu     sync.Mutex
+	cond   *sync.Cond // Signalled when events are added or taken, and on close
+	queue  []WatchEvent
+	closed bool
+}
+
+func newDispatcher(size int, policy OverflowPolicy, deliver func(WatchEvent)) *dispatcher {
+	d := &dispatcher{size: size, policy: policy, deliver: deliver}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// push buffers ev, applying the overflow policy if the buffer is full
+func (d *dispatcher) push(ev WatchEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.queue) >= d.size && !d.closed {
+		if d.policy == OverflowDropOldest {
+			d.queue = d.queue[1:]
+			metrics.ObserveWatchDrop(string(d.policy), "overflow")
+			break
+		}
+		// Checked again after every wait: the key's buffered event may
+		// have been delivered meanwhile
+		if d.policy == OverflowCoalesce && d.replace(ev) {
+			metrics.ObserveWatchDrop(string(d.policy), "coalesced")
+			return
+		}
+		d.cond.Wait()
+	}
+	if d.closed {
+		return
+	}
+	d.queue = append(d.queue, ev)
+	d.cond.Broadcast()
+}
+
+// replace swaps the buffered event for ev's key, if any, for ev; callers
+// hold d.mu
+func (d *dispatcher) replace(ev WatchEvent) bool {
+	for i := range d.queue {
+		if d.queue[i].Key == ev.Key {
+			d.queue[i] = ev
+			return true
+		}
+	}
+	return false
+}
+
+// run delivers buffered events until ctx is done; events still buffered
+// then are discarded
+func (d *dispatcher) run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		d.mu.Lock()
+		d.closed = true
+		d.cond.Broadcast()
+		d.mu.Unlock()
+	}()
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if d.closed {
+			d.mu.Unlock()
+			return
+		}
+		ev := d.queue[0]
+		d.queue = d.queue[1:]
+		d.cond.Broadcast()
+		d.mu.Unlock()
+		d.deliver(ev)
+	}
+}
@@ -0,0 +1,160 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fill pushes events for keys into a dispatcher whose callback is stuck, so
+// they pile up in the buffer, then releases the callback and returns the keys
+// delivered
+func fill(t *testing.T, policy OverflowPolicy, keys ...string) []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	delivered := make(chan string, len(keys))
+	d := newDispatcher(2, policy, func(ev WatchEvent) {
+		<-release
+		delivered <- ev.Key
+	})
+	go d.run(ctx)
+
+	// The first event is taken by the stuck callback, the rest are buffered
+	d.push(WatchEvent{Key: "first"})
+	for d.pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, k := range keys {
+		d.push(WatchEvent{Key: k})
+	}
+	close(release)
+
+	var got []string
+	for len(got) < 1+min(len(keys), 2) {
+		select {
+		case k := <-delivered:
+			got = append(got, k)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out after %v", got)
+		}
+	}
+	return got
+}
+
+func (d *dispatcher) pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queue)
+}
+
+func TestDispatcher_Overflow(t *testing.T) {
+	if got := strings.Join(fill(t, OverflowDropOldest, "a", "b", "c"), ","); got != "first,b,c" {
+		t.Fatalf("drop-oldest: got %s", got)
+	}
+	if got := strings.Join(fill(t, OverflowCoalesce, "a", "b", "a"), ","); got != "first,a,b" {
+		t.Fatalf("coalesce: got %s", got)
+	}
+}
+
+func TestDispatcher_CoalesceKeepsEveryKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	delivered := make(chan string, 8)
+	d := newDispatcher(2, OverflowCoalesce, func(ev WatchEvent) {
+		<-release
+		delivered <- fmt.Sprintf("%s=%d", ev.Key, ev.Revision)
+	})
+	go d.run(ctx)
+	d.push(WatchEvent{Key: "first"})
+	for d.pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	d.push(WatchEvent{Key: "a", Revision: 1})
+	d.push(WatchEvent{Key: "b", Revision: 1})
+
+	// A full buffer without an event for c holds up the push rather than
+	// dropping a or b, the only change buffered for either
+	pushed := make(chan struct{})
+	go func() {
+		d.push(WatchEvent{Key: "c", Revision: 1})
+		d.push(WatchEvent{Key: "c", Revision: 2})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("expected the push to wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-pushed
+
+	var got []string
+	for len(got) < 4 {
+		select {
+		case k := <-delivered:
+			got = append(got, k)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out after %v", got)
+		}
+	}
+	if last := got[3]; strings.Join(got[:3], ",") != "first=0,a=1,b=1" || (last != "c=2" && last != "c=1") {
+		t.Fatalf("expected every key delivered, got %v", got)
+	}
+	// c's second change either coalesced into its first or followed it
+	if got[3] == "c=1" {
+		select {
+		case k := <-delivered:
+			if k != "c=2" {
+				t.Fatalf("expected c's latest change last, got %s", k)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for c's latest change")
+		}
+	}
+}
+
+func TestDispatcher_BlockLosesNothing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	done := make(chan struct{})
+	d := newDispatcher(1, OverflowBlock, func(ev WatchEvent) {
+		time.Sleep(time.Millisecond)
+		got = append(got, ev.Key)
+		if len(got) == 5 {
+			close(done)
+		}
+	})
+	go d.run(ctx)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		d.push(WatchEvent{Key: k})
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out after %v", got)
+	}
+	if strings.Join(got, ",") != "a,b,c,d,e" {
+		t.Fatalf("expected every event in order, got %v", got)
+	}
+
+	// Closing releases a blocked push
+	cancel()
+	d.push(WatchEvent{Key: "f"})
+	d.push(WatchEvent{Key: "g"})
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	if p, err := ParseOverflowPolicy(""); err != nil || p != DefaultOverflowPolicy {
+		t.Fatalf("expected the default, got %q %v", p, err)
+	}
+	if _, err := ParseOverflowPolicy("drop-newest"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,101 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestServerOptions_AppliesConfig(t *testing.T) {
+	cfg := KVConfig{
+		DataDir:            "/data",
+		LeafPort:           7500,
+		ClusterPort:        6500,
+		ClusterRoutes:      []string{"nats://center-2:6500"},
+		JetStreamMaxMemory: 8 << 20,
+		JetStreamMaxStore:  128 << 20,
+		ServerDebug:        true,
+	}
+	opts, err := cfg.serverOptions("center")
+	if err != nil {
+		t.Fatalf("serverOptions: %v", err)
+	}
+	if !opts.JetStream || opts.StoreDir != "/data" || opts.JetStreamMaxMemory != 8<<20 || opts.JetStreamMaxStore != 128<<20 {
+		t.Fatalf("JetStream settings not applied: %+v", opts)
+	}
+	if opts.LeafNode.Port != 7500 || opts.Cluster.Port != 6500 || len(opts.Routes) != 1 || !opts.Debug {
+		t.Fatalf("ports/logging not applied: leaf=%d cluster=%d debug=%t", opts.LeafNode.Port, opts.Cluster.Port, opts.Debug)
+	}
+
+	// Unset limits fall back to the defaults, and a cluster port without
+	// routes leaves the node standalone
+	opts, _ = KVConfig{ClusterPort: 6500}.serverOptions("center")
+	if opts.JetStreamMaxMemory != defaultJetStreamMaxMemory || opts.JetStreamMaxStore != defaultJetStreamMaxStore {
+		t.Fatalf("expected default limits, got %d/%d", opts.JetStreamMaxMemory, opts.JetStreamMaxStore)
+	}
+	if opts.Cluster.Port != 0 {
+		t.Fatalf("expected no cluster listener without routes, got port %d", opts.Cluster.Port)
+	}
+
+	// Leaf nodes solicit the center and never run JetStream or listen for leafs
+	opts, err = KVConfig{CenterURL: "nats://center:7422", LeafPort: 7422}.serverOptions("leaf")
+	if err != nil {
+		t.Fatalf("leaf serverOptions: %v", err)
+	}
+	if opts.JetStream || opts.LeafNode.Port != 0 || len(opts.LeafNode.Remotes) != 1 {
+		t.Fatalf("unexpected leaf options: %+v", opts.LeafNode)
+	}
+}
+
+func TestServerOptions_Validation(t *testing.T) {
+	cases := map[string]struct {
+		cfg      KVConfig
+		nodeType string
+	}{
+		"node type":     {KVConfig{}, "edge"},
+		"leaf port":     {KVConfig{LeafPort: 70000}, "center"},
+		"cluster port":  {KVConfig{ClusterPort: -2}, "center"},
+		"same ports":    {KVConfig{LeafPort: 7422, ClusterPort: 7422}, "center"},
+		"memory limit":  {KVConfig{JetStreamMaxMemory: -1}, "center"},
+		"storage limit": {KVConfig{JetStreamMaxStore: -1}, "center"},
+		"center url":    {KVConfig{CenterURL: "::://bad-url"}, "leaf"},
+		"routes":        {KVConfig{ClusterPort: 6222, ClusterRoutes: []string{"::bad"}}, "center"},
+	}
+	for name, tc := range cases {
+		if _, err := tc.cfg.serverOptions(tc.nodeType); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestEmbeddedServer_HonorsLimits(t *testing.T) {
+	store, err := NewKVStore(KVConfig{
+		BucketName:         "test-presence-limits",
+		Embedded:           true,
+		DataDir:            t.TempDir(),
+		ClusterPort:        16222,
+		JetStreamMaxMemory: 16 << 20,
+		JetStreamMaxStore:  64 << 20,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+
+	ks := store.(*kvStore)
+	if cfg := ks.server.JetStreamConfig(); cfg == nil || cfg.MaxMemory != 16<<20 || cfg.MaxStore != 64<<20 {
+		t.Fatalf("JetStream limits not applied: %+v", cfg)
+	}
+	if addr := ks.server.ClusterAddr(); addr != nil {
+		t.Fatalf("expected no cluster listener without routes, got %v", addr)
+	}
+
+	// JetStream stays usable on a single node with a cluster port and no routes
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	if err := store.Set(context.Background(), "u1", p, time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+}
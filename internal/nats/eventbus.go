@@ -0,0 +1,149 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// EventBus is implemented by stores whose changes can be consumed once
+// across a fleet of nodes, for event sinks. Every node passing the same
+// group or name shares the work: each change goes to one of them. Values a
+// standby's promotion writes back are not changes, and are skipped.
+type EventBus interface {
+	// SubscribeChanges delivers changes at most once, through a core NATS
+	// queue subscription on the bucket's subjects. Changes written while no
+	// node is subscribed are never delivered, and events carry no revision.
+	SubscribeChanges(ctx context.Context, group string, callback func(WatchEvent)) error
+	// WatchDurable delivers changes at least once, through a durable
+	// JetStream consumer that resumes after the last acknowledged change. A
+	// change is acknowledged when callback returns nil and redelivered with
+	// backoff otherwise, or after the delay of a RetryAfter error; changes
+	// are delivered one at a time, in order.
+	WatchDurable(ctx context.Context, name string, callback func(WatchEvent) error) error
+	// Publish sends data to subject, with the request ID and trace context
+	// of ctx as headers. With acked, it is published to JetStream and
+	// succeeds only once a stream has stored it.
+	Publish(ctx context.Context, subject string, data []byte, acked bool) error
+}
+
+// Redelivery backoff of durable watches, doubled per failed attempt
+const (
+	durableRetryMin = time.Second
+	durableRetryMax = time.Minute
+	durableAckWait  = 30 * time.Second
+)
+
+// SubscribeChanges implements EventBus
+func (s *kvStore) SubscribeChanges(ctx context.Context, group string, callback func(WatchEvent)) error {
+	if s.conn == nil || s.kv == nil {
+		return nats.ErrConnectionClosed
+	}
+	prefix := s.keyPrefix()
+	sub, err := s.conn.QueueSubscribe(prefix+">", group, func(msg *nats.Msg) {
+		event := changeEvent(prefix, msg.Subject, msg.Header, msg.Data)
+		if event.Type != "" && !event.Replay {
+			callback(event)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to changes: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe()
+	}()
+	return nil
+}
+
+// WatchDurable implements EventBus
+func (s *kvStore) WatchDurable(ctx context.Context, name string, callback func(WatchEvent) error) error {
+	if s.js == nil || s.kv == nil {
+		return nats.ErrConnectionClosed
+	}
+	setupCtx, cancel := withTimeout(ctx, s.config.WatchTimeout)
+	defer cancel()
+	cons, err := s.js.CreateOrUpdateConsumer(setupCtx, "KV_"+s.kv.Bucket(), durableConsumerConfig(s.kv.Bucket(), name))
+	if err != nil {
+		return fmt.Errorf("failed to create durable consumer %s: %w", name, asTimeout(setupCtx, opWatch, err))
+	}
+
+	prefix := s.keyPrefix()
+	cc, err := cons.Consume(func(msg jetstream.Msg) {
+		event := watchEvent(prefix, msg)
+		if event.Type == "" || event.Replay {
+			msg.Ack()
+			return
+		}
+		if err := callback(event); err != nil {
+			delay := durableRetryDelay(event.Deliveries)
+			var retry *RetryError
+			if errors.As(err, &retry) {
+				delay = retry.Delay
+			}
+			msg.NakWithDelay(delay)
+			return
+		}
+		msg.Ack()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %w", name, err)
+	}
+	go func() {
+		<-ctx.Done()
+		cc.Stop()
+	}()
+	return nil
+}
+
+// RetryError is a durable watch callback's failure that picks its own
+// redelivery delay
+type RetryError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e *RetryError) Error() string { return e.Err.Error() }
+func (e *RetryError) Unwrap() error { return e.Err }
+
+// RetryAfter has a durable watch redeliver the change that failed with err
+// after delay, instead of the default backoff
+func RetryAfter(err error, delay time.Duration) error {
+	return &RetryError{Err: err, Delay: delay}
+}
+
+// durableRetryDelay is the backoff before redelivering a change that failed
+// on its nth delivery
+func durableRetryDelay(n uint64) time.Duration {
+	d := durableRetryMin
+	for i := uint64(1); i < n && d < durableRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, durableRetryMax)
+}
+
+// Publish implements EventBus
+func (s *kvStore) Publish(ctx context.Context, subject string, data []byte, acked bool) error {
+	if s.conn == nil {
+		return nats.ErrConnectionClosed
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	injectHeaders(ctx, msg.Header)
+	if !acked {
+		return s.conn.PublishMsg(msg)
+	}
+	if s.js == nil {
+		return nats.ErrConnectionClosed
+	}
+	ctx, cancel := withTimeout(ctx, s.config.WriteTimeout)
+	defer cancel()
+	if _, err := s.js.PublishMsg(ctx, msg); err != nil {
+		return asTimeout(ctx, opSet, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestEventBus_Delivery(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-eventbus", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	bus := store.(EventBus)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	atMostOnce := make(chan WatchEvent, 4)
+	if err := bus.SubscribeChanges(ctx, "sink_test", func(e WatchEvent) { atMostOnce <- e }); err != nil {
+		t.Fatalf("SubscribeChanges: %v", err)
+	}
+	atLeastOnce := make(chan WatchEvent, 4)
+	failed := false
+	if err := bus.WatchDurable(ctx, "sink_test", func(e WatchEvent) error {
+		atLeastOnce <- e
+		if !failed {
+			failed = true
+			return errors.New("sink down")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("WatchDurable: %v", err)
+	}
+
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "alice", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	if err := store.Set(ctx, "alice", p, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	select {
+	case e := <-atMostOnce:
+		if e.Key != "user.alice" || e.Presence == nil || e.Presence.Status != models.StatusOnline {
+			t.Fatalf("unexpected core event %+v", e)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the core NATS delivery")
+	}
+
+	// The failed delivery comes back, marked as a redelivery of the same
+	// revision, which webhooks rely on to let receivers discard duplicates
+	var first WatchEvent
+	for i, want := range []uint64{1, 2} {
+		select {
+		case e := <-atLeastOnce:
+			if e.Deliveries != want || e.Revision == 0 || (i == 1 && e.Revision != first.Revision) {
+				t.Fatalf("delivery %d: unexpected event %+v", i, e)
+			}
+			first = e
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for durable delivery %d", want)
+		}
+	}
+
+	if err := bus.Publish(ctx, "presence.events", []byte("{}"), false); err != nil {
+		t.Fatalf("core publish: %v", err)
+	}
+	if err := bus.Publish(ctx, "presence.events", []byte("{}"), true); err == nil {
+		t.Fatal("expected acked publish without a stream to fail")
+	}
+}
+
+func TestDurableRetryDelay(t *testing.T) {
+	for n, want := range map[uint64]time.Duration{0: time.Second, 1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 30: time.Minute} {
+		if got := durableRetryDelay(n); got != want {
+			t.Errorf("delivery %d: expected %v, got %v", n, want, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package nats
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"gopresence/internal/requestid"
+)
+
+// traceContext is the W3C traceparent/tracestate propagator used on NATS
+// headers, independent of the process-wide propagator
+var traceContext = propagation.TraceContext{}
+
+// headerCarrier adapts nats.Header to a propagation.TextMapCarrier. Unlike
+// propagation.HeaderCarrier it matches keys case-insensitively, since NATS
+// header keys are not canonicalized in transit.
+type headerCarrier nats.Header
+
+func (c headerCarrier) Get(key string) string {
+	for k, v := range c {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) { nats.Header(c).Set(key, value) }
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// injectHeaders writes the request ID and trace context of ctx into h
+func injectHeaders(ctx context.Context, h nats.Header) {
+	if id := requestid.FromContext(ctx); id != "" {
+		h.Set(requestid.Header, id)
+	}
+	traceContext.Inject(ctx, headerCarrier(h))
+}
+
+// extractHeaders returns the request ID and remote span context carried by h
+func extractHeaders(h nats.Header) (string, trace.SpanContext) {
+	if h == nil {
+		return "", trace.SpanContext{}
+	}
+	c := headerCarrier(h)
+	ctx := traceContext.Extract(context.Background(), c)
+	return c.Get(requestid.Header), trace.SpanContextFromContext(ctx)
+}
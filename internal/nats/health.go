@@ -0,0 +1,115 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Ways a peer keeps a copy of the bucket in sync
+const (
+	SyncMirror  = "mirror"  // The bucket's stream mirrors another stream
+	SyncSource  = "source"  // The bucket's stream sources from another stream
+	SyncReplica = "replica" // A clustered follower of the bucket's stream
+)
+
+// SyncStatus reports how far one mirror, source or replica is behind
+type SyncStatus struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Lag      uint64    `json:"lag"`                // Messages behind
+	LastSync time.Time `json:"last_sync,omitzero"` // Last activity; zero if there has been none
+	Offline  bool      `json:"offline,omitempty"`
+}
+
+// BucketHealth is a point-in-time view of the bucket's backing stream
+type BucketHealth struct {
+	Bucket       string       `json:"bucket"`
+	Entries      uint64       `json:"entries"`
+	LastRevision uint64       `json:"last_revision"`
+	LastUpdate   time.Time    `json:"last_update,omitzero"`
+	Cluster      string       `json:"cluster,omitempty"` // JetStream cluster of the bucket's stream; empty if not clustered
+	Leader       string       `json:"leader,omitempty"`  // Server leading the bucket's stream
+	Sync         []SyncStatus `json:"sync,omitempty"`
+	CheckedAt    time.Time    `json:"checked_at"`
+}
+
+// HealthReporter is implemented by stores that can describe the
+// replication state of their bucket
+type HealthReporter interface {
+	BucketHealth(ctx context.Context) (BucketHealth, error)
+}
+
+// BucketHealth reads the bucket's stream info, including the lag of any
+// mirror, sources and cluster replicas
+func (s *kvStore) BucketHealth(ctx context.Context) (_ BucketHealth, err error) {
+	ctx, done := s.trace(ctx, opHealth)
+	defer func() { done(err) }()
+	if s.js == nil || s.kv == nil {
+		return BucketHealth{}, nats.ErrConnectionClosed
+	}
+	ctx, cancel := withTimeout(ctx, s.config.ReadTimeout)
+	defer cancel()
+
+	stream, err := s.js.Stream(ctx, "KV_"+s.kv.Bucket())
+	if err != nil {
+		return BucketHealth{}, fmt.Errorf("failed to read bucket stream: %w", asTimeout(ctx, opHealth, err))
+	}
+	return bucketHealth(s.kv.Bucket(), stream.CachedInfo()), nil
+}
+
+func bucketHealth(bucket string, info *jetstream.StreamInfo) BucketHealth {
+	now := info.TimeStamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	h := BucketHealth{
+		Bucket:       bucket,
+		Entries:      info.State.Msgs,
+		LastRevision: info.State.LastSeq,
+		CheckedAt:    now.UTC(),
+	}
+	if !info.State.LastTime.IsZero() {
+		h.LastUpdate = info.State.LastTime.UTC()
+	}
+
+	if info.Mirror != nil {
+		h.Sync = append(h.Sync, sourceStatus(SyncMirror, info.Mirror, now))
+	}
+	for _, src := range info.Sources {
+		h.Sync = append(h.Sync, sourceStatus(SyncSource, src, now))
+	}
+	if info.Cluster != nil {
+		h.Cluster, h.Leader = info.Cluster.Name, info.Cluster.Leader
+		for _, peer := range info.Cluster.Replicas {
+			h.Sync = append(h.Sync, SyncStatus{
+				Kind:     SyncReplica,
+				Name:     peer.Name,
+				Lag:      peer.Lag,
+				LastSync: lastActive(now, peer.Active),
+				Offline:  peer.Offline,
+			})
+		}
+	}
+	return h
+}
+
+func sourceStatus(kind string, src *jetstream.StreamSourceInfo, now time.Time) SyncStatus {
+	return SyncStatus{
+		Kind:     kind,
+		Name:     src.Name,
+		Lag:      src.Lag,
+		LastSync: lastActive(now, src.Active),
+	}
+}
+
+// lastActive converts a "time since last activity" (-1 for never) to a time
+func lastActive(now time.Time, active time.Duration) time.Time {
+	if active < 0 {
+		return time.Time{}
+	}
+	return now.Add(-active).UTC()
+}
@@ -0,0 +1,68 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestBucketHealth_ReportsMirrorSourcesAndReplicas(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	info := &jetstream.StreamInfo{
+		TimeStamp: now,
+		State:     jetstream.StreamState{Msgs: 10, LastSeq: 42, LastTime: now.Add(-time.Second)},
+		Mirror:    &jetstream.StreamSourceInfo{Name: "KV_presence", Lag: 5, Active: 2 * time.Second},
+		Sources:   []*jetstream.StreamSourceInfo{{Name: "KV_eu", Lag: 0, Active: -1}},
+		Cluster: &jetstream.ClusterInfo{Name: "east", Leader: "n1", Replicas: []*jetstream.PeerInfo{
+			{Name: "n2", Current: true, Active: time.Second},
+			{Name: "n3", Offline: true, Lag: 7, Active: time.Minute},
+		}},
+	}
+
+	h := bucketHealth("presence", info)
+	if h.Bucket != "presence" || h.Entries != 10 || h.LastRevision != 42 || !h.LastUpdate.Equal(now.Add(-time.Second)) || h.Cluster != "east" || h.Leader != "n1" {
+		t.Fatalf("unexpected bucket state: %+v", h)
+	}
+	want := []SyncStatus{
+		{Kind: SyncMirror, Name: "KV_presence", Lag: 5, LastSync: now.Add(-2 * time.Second)},
+		{Kind: SyncSource, Name: "KV_eu"},
+		{Kind: SyncReplica, Name: "n2", LastSync: now.Add(-time.Second)},
+		{Kind: SyncReplica, Name: "n3", Lag: 7, LastSync: now.Add(-time.Minute), Offline: true},
+	}
+	if len(h.Sync) != len(want) {
+		t.Fatalf("expected %d sync entries, got %+v", len(want), h.Sync)
+	}
+	for i, w := range want {
+		if got := h.Sync[i]; got.Kind != w.Kind || got.Name != w.Name || got.Lag != w.Lag || !got.LastSync.Equal(w.LastSync) || got.Offline != w.Offline {
+			t.Errorf("sync[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestKVStore_BucketHealth(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-health", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.Set(ctx, "u1", modelsPresence("u1"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	h, err := store.(HealthReporter).BucketHealth(ctx)
+	if err != nil {
+		t.Fatalf("BucketHealth: %v", err)
+	}
+	// A standalone bucket has nothing to sync from
+	if h.Bucket != "test-presence-health" || h.LastRevision != 1 || h.LastUpdate.IsZero() || len(h.Sync) != 0 {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+
+	store.Close()
+	if _, err := store.(HealthReporter).BucketHealth(ctx); err == nil {
+		t.Fatalf("expected error after close")
+	}
+}
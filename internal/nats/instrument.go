@@ -0,0 +1,84 @@
+package nats
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/metrics"
+)
+
+// KV operation names used for span names and metric labels
+const (
+	opGet         = "get"
+	opSet         = "set"
+	opDelete      = "delete"
+	opGetMultiple = "get_multiple"
+	opKeys        = "keys"
+	opWatch       = "watch"
+	opHealth      = "health"
+)
+
+// Operation outcomes
+const (
+	outcomeOK       = "ok"
+	outcomeNotFound = "not_found"
+	outcomeTimeout  = "timeout"
+	outcomeError    = "error"
+)
+
+const tracerName = "gopresence/internal/nats"
+
+// trace starts a span for a KV operation and returns a func that ends it
+// and records the operation latency. Spans go to the global TracerProvider,
+// so they are dropped unless one is installed.
+func (s *kvStore) trace(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	bucket := s.bucket()
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "kv."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs,
+			attribute.String("db.system", "nats"),
+			attribute.String("db.operation", op),
+			attribute.String("nats.kv.bucket", bucket),
+		)...),
+	)
+	start := time.Now()
+
+	return ctx, func(err error) {
+		outcome := outcomeOf(err)
+		metrics.ObserveKVOperation(op, bucket, outcome, time.Since(start))
+		span.SetAttributes(attribute.String("outcome", outcome))
+		if outcome == outcomeError || outcome == outcomeTimeout {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (s *kvStore) bucket() string {
+	if s.kv != nil {
+		return s.kv.Bucket()
+	}
+	return s.config.BucketName
+}
+
+// outcomeOf classifies an operation error; a missing key is expected and
+// not counted as a failure
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return outcomeOK
+	case IsTimeout(err):
+		return outcomeTimeout
+	case apperrors.IsNotFound(err):
+		return outcomeNotFound
+	default:
+		return outcomeError
+	}
+}
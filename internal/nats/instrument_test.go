@@ -0,0 +1,143 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/requestid"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want string
+	}{
+		"nil":       {nil, outcomeOK},
+		"not found": {fmt.Errorf("get: %w", apperrors.NotFound("u1")), outcomeNotFound},
+		"failure":   {errors.New("failed to put presence: timeout"), outcomeError},
+	}
+	for name, tc := range cases {
+		if got := outcomeOf(tc.err); got != tc.want {
+			t.Errorf("%s: outcomeOf = %q, want %q", name, got, tc.want)
+		}
+	}
+}
+
+func TestKVStore_OperationSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(prev)
+
+	// Own bucket and data dir so the delete marker doesn't leak into other tests
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-trace", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	if err := store.Set(ctx, "u1", p, time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := store.Get(ctx, "u1"); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	store.Get(ctx, "missing")
+	if err := store.Delete(ctx, "u1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	var got []string
+	for _, span := range rec.Ended() {
+		var outcome, bucket string
+		for _, kv := range span.Attributes() {
+			switch kv.Key {
+			case "outcome":
+				outcome = kv.Value.AsString()
+			case "nats.kv.bucket":
+				bucket = kv.Value.AsString()
+			}
+		}
+		if bucket == "" {
+			t.Errorf("span %s missing bucket attribute", span.Name())
+		}
+		got = append(got, span.Name()+":"+outcome)
+	}
+	want := []string{"kv.set:ok", "kv.get:ok", "kv.get:not_found", "kv.delete:ok"}
+	if len(got) != len(want) {
+		t.Fatalf("expected spans %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected spans %v, got %v", want, got)
+		}
+	}
+}
+
+func TestKVStore_WatchCarriesRequestAndTraceContext(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-headers", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan WatchEvent, 4)
+	if err := store.Watch(ctx, func(ev WatchEvent) { events <- ev }); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	writeCtx, parent := tp.Tracer("test").Start(requestid.NewContext(ctx, "req-42"), "http.put")
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	if err := store.Set(writeCtx, "u1", p, time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	parent.End()
+
+	select {
+	case ev := <-events:
+		if ev.Key != "user.u1" || ev.Type != WatchEventPut || ev.Presence == nil {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+		if ev.RequestID != "req-42" {
+			t.Fatalf("expected request ID from headers, got %q", ev.RequestID)
+		}
+		if ev.Trace.TraceID() != parent.SpanContext().TraceID() || !ev.Trace.IsRemote() {
+			t.Fatalf("expected writer's trace to propagate, got %v", ev.Trace)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for watch event")
+	}
+
+	if err := store.Delete(requestid.NewContext(ctx, "req-43"), "u1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != WatchEventDelete || ev.RequestID != "req-43" {
+			t.Fatalf("expected delete tagged with its request ID, got %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for delete event")
+	}
+}
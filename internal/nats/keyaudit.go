@@ -0,0 +1,199 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// Problems a key audit finds
+const (
+	KeyUnknown         = "unknown_key"      // Neither a user key nor under a former prefix
+	KeyFormerPrefix    = "former_prefix"    // A user key under a prefix older versions wrote
+	KeyUndecodable     = "undecodable"      // The value is not a presence
+	KeyInvalidPresence = "invalid_presence" // The presence fails validation
+	KeyUserMismatch    = "user_mismatch"    // The presence names another user than its key
+)
+
+// Key audit modes
+const (
+	AuditReport = "report" // Only list problem keys
+	AuditRepair = "repair" // Also fix what can be fixed and compact the bucket
+	AuditDelete = "delete" // Also delete what can't be fixed
+)
+
+// Actions a key audit takes on a problem key
+const (
+	KeyRepaired = "repaired"
+	KeyDeleted  = "deleted"
+	KeyFailed   = "failed"
+)
+
+// MaxKeyAuditIssues caps the problem keys a report lists; the counts cover all
+const MaxKeyAuditIssues = 1000
+
+// KeyIssue is a problem key a key audit found, and what it did about it
+type KeyIssue struct {
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+	Action  string `json:"action,omitempty"` // Empty if the key was left alone
+	Error   string `json:"error,omitempty"`
+}
+
+// KeyAudit is the report of a scan of the bucket's keys
+type KeyAudit struct {
+	Mode       string         `json:"mode"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at,omitzero"`
+	Scanned    int            `json:"scanned"`
+	Problems   map[string]int `json:"problems"` // Problem keys by problem
+	Repaired   int            `json:"repaired"`
+	Deleted    int            `json:"deleted"`
+	Failed     int            `json:"failed"`
+	Compacted  bool           `json:"compacted,omitempty"` // Old delete markers were purged
+	Issues     []KeyIssue     `json:"issues"`
+	Truncated  bool           `json:"truncated,omitempty"` // More than MaxKeyAuditIssues problem keys
+	Error      string         `json:"error,omitempty"`     // Why the scan stopped early, if it did
+}
+
+// KeyAuditor is implemented by stores that can find, and optionally repair
+// or delete, bucket keys the service can't read
+type KeyAuditor interface {
+	AuditKeys(ctx context.Context, mode string) (KeyAudit, error)
+}
+
+// ValidAuditMode reports whether mode is a key audit mode
+func ValidAuditMode(mode string) bool {
+	return mode == AuditReport || mode == AuditRepair || mode == AuditDelete
+}
+
+// AuditKeys scans every key of the bucket for entries reads skip: keys
+// outside the user prefix, values that aren't valid presences, and
+// presences stored under another user's key. Keys under one of
+// KVConfig.FormerKeyPrefixes are moved to the current prefix on repair,
+// unless the user already has a presence there, and presences naming the
+// wrong user are rewritten for their key. Delete mode also deletes every
+// key that can't be repaired. Both end by purging delete markers older than
+// 30 minutes, so the stream no longer keeps the history of removed keys.
+// A scan that fails part way returns the report so far with the error.
+func (s *kvStore) AuditKeys(ctx context.Context, mode string) (KeyAudit, error) {
+	audit := KeyAudit{Mode: mode, StartedAt: time.Now().UTC(), Problems: map[string]int{}, Issues: []KeyIssue{}}
+	if !ValidAuditMode(mode) {
+		return audit, fmt.Errorf("unknown key audit mode %q", mode)
+	}
+	if s.kv == nil {
+		return audit, nats.ErrConnectionClosed
+	}
+	lister, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return audit, fmt.Errorf("failed to list keys: %w", err)
+	}
+	defer lister.Stop()
+
+	for key := range lister.Keys() {
+		audit.Scanned++
+		problem, fix := s.auditKey(ctx, key)
+		if problem == "" {
+			continue
+		}
+		audit.Problems[problem]++
+		issue := KeyIssue{Key: key, Problem: problem}
+		switch {
+		case mode != AuditReport && fix != nil:
+			issue.Action = KeyRepaired
+			err = fix()
+		case mode == AuditDelete:
+			issue.Action = KeyDeleted
+			err = s.kv.Purge(ctx, key)
+		default:
+			err = nil
+		}
+		if err != nil {
+			issue.Action, issue.Error = KeyFailed, err.Error()
+		}
+		switch issue.Action {
+		case KeyRepaired:
+			audit.Repaired++
+		case KeyDeleted:
+			audit.Deleted++
+		case KeyFailed:
+			audit.Failed++
+		}
+		if len(audit.Issues) == MaxKeyAuditIssues {
+			audit.Truncated = true
+			continue
+		}
+		audit.Issues = append(audit.Issues, issue)
+	}
+	if mode != AuditReport {
+		audit.Compacted = s.kv.PurgeDeletes(ctx) == nil
+	}
+	audit.FinishedAt = time.Now().UTC()
+	if err := ctx.Err(); err != nil {
+		audit.Error = err.Error()
+		return audit, err
+	}
+	return audit, nil
+}
+
+// auditKey reads key and returns its problem, if any, and the repair of it,
+// nil if it can't be repaired
+func (s *kvStore) auditKey(ctx context.Context, key string) (string, func() error) {
+	userID, ok := strings.CutPrefix(key, s.presenceKey(""))
+	former := false
+	for _, prefix := range s.config.FormerKeyPrefixes {
+		if ok {
+			break
+		}
+		userID, ok = strings.CutPrefix(key, prefix)
+		former = ok
+	}
+	if !ok || userID == "" {
+		return KeyUnknown, nil
+	}
+
+	entry, err := s.kv.Get(ctx, key)
+	if err != nil {
+		// Deleted or expired since it was listed, or unreadable for now; the
+		// next scan looks again
+		return "", nil
+	}
+	var presence models.Presence
+	if err := json.Unmarshal(entry.Value(), &presence); err != nil {
+		return KeyUndecodable, nil
+	}
+	mismatch := presence.UserID != userID
+	presence.UserID = userID
+	if err := presence.Validate(); err != nil {
+		return KeyInvalidPresence, nil
+	}
+
+	switch {
+	case former:
+		return KeyFormerPrefix, func() error {
+			// A presence under the current prefix is newer than a leftover
+			_, err := s.Get(ctx, userID)
+			if apperrors.IsNotFound(err) {
+				_, err = s.put(ctx, userID, presence)
+			}
+			if err != nil {
+				return err
+			}
+			return s.kv.Purge(ctx, key)
+		}
+	case mismatch:
+		return KeyUserMismatch, func() error {
+			_, err := s.put(ctx, userID, presence, jetstream.WithExpectLastSequencePerSubject(entry.Revision()))
+			return err
+		}
+	}
+	return "", nil
+}
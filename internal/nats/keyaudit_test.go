@@ -0,0 +1,79 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestKVStore_AuditKeys(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-audit", Embedded: true, DataDir: t.TempDir(), FormerKeyPrefixes: []string{"presence."}})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	kv := store.(*kvStore).kv
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	presence := func(userID string) []byte {
+		b, _ := json.Marshal(models.Presence{UserID: userID, Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "node1"})
+		return b
+	}
+	if err := store.Set(ctx, "good", models.Presence{UserID: "good", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "node1"}, time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	for key, value := range map[string][]byte{
+		"presence.moved": presence("moved"),
+		"user.junk":      []byte("not json"),
+		"user.bad":       []byte(`{"user_id":"bad","status":"gone"}`),
+		"user.renamed":   presence("someone-else"),
+		"stats.total":    []byte("42"),
+	} {
+		if _, err := kv.Put(ctx, key, value); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	auditor := store.(KeyAuditor)
+	report, err := auditor.AuditKeys(ctx, AuditReport)
+	if err != nil {
+		t.Fatalf("AuditKeys: %v", err)
+	}
+	want := map[string]int{KeyFormerPrefix: 1, KeyUndecodable: 1, KeyInvalidPresence: 1, KeyUserMismatch: 1, KeyUnknown: 1}
+	if report.Scanned != 6 || len(report.Issues) != 5 || len(report.Problems) != len(want) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for problem, n := range want {
+		if report.Problems[problem] != n {
+			t.Errorf("expected %d %s, got %d", n, problem, report.Problems[problem])
+		}
+	}
+	if _, err := store.Get(ctx, "moved"); err == nil {
+		t.Fatal("a report must not repair keys")
+	}
+
+	report, err = auditor.AuditKeys(ctx, AuditRepair)
+	if err != nil || report.Repaired != 2 || report.Deleted != 0 || !report.Compacted {
+		t.Fatalf("unexpected repair: %+v %v", report, err)
+	}
+	for _, userID := range []string{"moved", "renamed"} {
+		if p, err := store.Get(ctx, userID); err != nil || p.UserID != userID {
+			t.Errorf("expected %s repaired, got %+v %v", userID, p, err)
+		}
+	}
+
+	report, err = auditor.AuditKeys(ctx, AuditDelete)
+	if err != nil || report.Deleted != 3 || report.Failed != 0 {
+		t.Fatalf("unexpected delete: %+v %v", report, err)
+	}
+	if report, _ = auditor.AuditKeys(ctx, AuditReport); len(report.Issues) != 0 || report.Scanned != 3 {
+		t.Fatalf("expected a clean bucket of 3 keys, got %+v", report)
+	}
+	if _, err := auditor.AuditKeys(ctx, "purge"); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,86 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ConsumerLag is how far a durable consumer of the bucket, such as an
+// at-least-once event sink, is behind the bucket's changes
+type ConsumerLag struct {
+	Name        string    `json:"name"`
+	Pending     uint64    `json:"pending"`     // Changes not yet delivered
+	AckPending  int       `json:"ack_pending"` // Changes delivered but not yet acknowledged
+	Redelivered int       `json:"redelivered"` // Unacknowledged changes delivered more than once
+	Lag         uint64    `json:"lag"`         // Pending + AckPending
+	Delivered   uint64    `json:"delivered_revision"`
+	AckFloor    uint64    `json:"ack_floor_revision"` // Every change up to here is acknowledged
+	LastActive  time.Time `json:"last_active,omitzero"`
+	// When the consumer last acknowledged a change, or was created if it
+	// never did; the consumer's position is persisted as of then
+	Checkpoint time.Time `json:"checkpoint,omitzero"`
+}
+
+// LagReporter is implemented by stores that can report the lag of the
+// durable consumers of their bucket
+type LagReporter interface {
+	ConsumerLag(ctx context.Context) ([]ConsumerLag, error)
+}
+
+// ConsumerLag lists the durable consumers of the bucket's stream, most
+// behind first. Ephemeral consumers, such as the ordered consumers behind
+// each node's watch, are left out.
+func (s *kvStore) ConsumerLag(ctx context.Context) ([]ConsumerLag, error) {
+	if s.js == nil || s.kv == nil {
+		return nil, nats.ErrConnectionClosed
+	}
+	ctx, cancel := withTimeout(ctx, s.config.ReadTimeout)
+	defer cancel()
+
+	stream, err := s.js.Stream(ctx, "KV_"+s.kv.Bucket())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bucket stream: %w", asTimeout(ctx, opHealth, err))
+	}
+	lags := []ConsumerLag{}
+	list := stream.ListConsumers(ctx)
+	for info := range list.Info() {
+		if info.Config.Durable != "" {
+			lags = append(lags, consumerLag(info))
+		}
+	}
+	if err := list.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list consumers: %w", asTimeout(ctx, opHealth, err))
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Lag != lags[j].Lag {
+			return lags[i].Lag > lags[j].Lag
+		}
+		return lags[i].Name < lags[j].Name
+	})
+	return lags, nil
+}
+
+func consumerLag(info *jetstream.ConsumerInfo) ConsumerLag {
+	l := ConsumerLag{
+		Name:        info.Name,
+		Pending:     info.NumPending,
+		AckPending:  info.NumAckPending,
+		Redelivered: info.NumRedelivered,
+		Lag:         info.NumPending + uint64(info.NumAckPending),
+		Delivered:   info.Delivered.Stream,
+		AckFloor:    info.AckFloor.Stream,
+	}
+	if info.Delivered.Last != nil {
+		l.LastActive = *info.Delivered.Last
+	}
+	l.Checkpoint = info.Created
+	if info.AckFloor.Last != nil {
+		l.Checkpoint = *info.AckFloor.Last
+	}
+	return l
+}
@@ -0,0 +1,67 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestConsumerLag_ReportsDurableConsumers(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-lag", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The watch's ephemeral consumer is not listed
+	if err := store.Watch(ctx, func(WatchEvent) {}); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	stuck := make(chan struct{}, 8)
+	if err := store.(EventBus).WatchDurable(ctx, "sink_stuck", func(WatchEvent) error {
+		stuck <- struct{}{}
+		return RetryAfter(errors.New("sink down"), time.Minute)
+	}); err != nil {
+		t.Fatalf("WatchDurable: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, id := range []string{"alice", "bob", "carol"} {
+		p := models.Presence{UserID: id, Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+		if err := store.Set(ctx, id, p, time.Minute); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	select {
+	case <-stuck:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the first delivery")
+	}
+
+	lags, err := store.(LagReporter).ConsumerLag(ctx)
+	if err != nil {
+		t.Fatalf("ConsumerLag: %v", err)
+	}
+	if len(lags) != 1 {
+		t.Fatalf("expected only the durable consumer, got %+v", lags)
+	}
+	// The first change is held unacknowledged; the rest wait behind it
+	if l := lags[0]; l.Name != "sink_stuck" || l.AckPending != 1 || l.Pending != 2 || l.Lag != 3 || l.AckFloor != 0 {
+		t.Fatalf("unexpected lag %+v", l)
+	}
+	// Nothing acknowledged yet: the checkpoint is the consumer's creation
+	if l := lags[0]; l.Checkpoint.IsZero() || l.Checkpoint.After(time.Now()) {
+		t.Fatalf("unexpected checkpoint %v", l.Checkpoint)
+	}
+	// RetryAfter's delay replaces the default 1s backoff
+	select {
+	case <-stuck:
+		t.Fatal("expected the change to be held back for a minute")
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
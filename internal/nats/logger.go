@@ -0,0 +1,45 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"gopresence/internal/logging"
+)
+
+// serverLogger adapts a slog.Logger to the embedded server's server.Logger
+type serverLogger struct {
+	l *slog.Logger
+}
+
+var _ server.Logger = serverLogger{}
+
+func newServerLogger(l *slog.Logger) serverLogger {
+	return serverLogger{l: l.With("component", "nats-server")}
+}
+
+func (s serverLogger) log(level slog.Level, format string, v ...any) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.Log(ctx, level, fmt.Sprintf(format, v...))
+}
+
+func (s serverLogger) Noticef(format string, v ...any) { s.log(slog.LevelInfo, format, v...) }
+func (s serverLogger) Warnf(format string, v ...any)   { s.log(slog.LevelWarn, format, v...) }
+func (s serverLogger) Fatalf(format string, v ...any)  { s.log(slog.LevelError, format, v...) }
+func (s serverLogger) Errorf(format string, v ...any)  { s.log(slog.LevelError, format, v...) }
+func (s serverLogger) Debugf(format string, v ...any)  { s.log(slog.LevelDebug, format, v...) }
+func (s serverLogger) Tracef(format string, v ...any)  { s.log(logging.LevelTrace, format, v...) }
+
+// logger returns the configured logger, falling back to the slog default
+func (s *kvStore) logger() *slog.Logger {
+	if s.config.Logger != nil {
+		return s.config.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,33 @@
+package nats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopresence/internal/logging"
+)
+
+func TestServerLogger_ForwardsAtMappedLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := newServerLogger(logging.New(&buf, "text", "debug"))
+
+	l.Noticef("listening on %d", 4222)
+	l.Warnf("slow consumer")
+	l.Debugf("debug %s", "detail")
+	l.Tracef("wire bytes")
+
+	out := buf.String()
+	for _, want := range []string{
+		"level=INFO msg=\"listening on 4222\" component=nats-server",
+		"level=WARN msg=\"slow consumer\"",
+		"level=DEBUG msg=\"debug detail\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "wire bytes") {
+		t.Errorf("trace should be filtered at debug level:\n%s", out)
+	}
+}
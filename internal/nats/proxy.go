@@ -0,0 +1,309 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/trace"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/requestid"
+)
+
+// NodeTypeProxy is the node type of stateless nodes that have no KV bucket
+// and forward every store operation to the nodes that do
+const NodeTypeProxy = "proxy"
+
+// proxyQueue shares proxy requests across the nodes answering them, so each
+// request is answered once
+const proxyQueue = "presence-proxy"
+
+// ProxyServer is implemented by stores that can answer the requests of
+// proxy nodes from their bucket
+type ProxyServer interface {
+	// ServeProxy answers proxy requests until ctx is done
+	ServeProxy(ctx context.Context) error
+}
+
+// proxyOpUpdate is the conditional write of UpdateAtRevision, which the KV
+// operation names count as a set
+const proxyOpUpdate = "update"
+
+// proxyRequest is a store operation; Op is one of the KV operation names or
+// proxyOpUpdate
+type proxyRequest struct {
+	Op       string           `json:"op"`
+	UserID   string           `json:"user_id,omitempty"`
+	UserIDs  []string         `json:"user_ids,omitempty"`
+	Presence *models.Presence `json:"presence,omitempty"`
+	TTL      time.Duration    `json:"ttl,omitempty"`
+	Revision uint64           `json:"revision,omitempty"` // Expected revision of an update
+}
+
+type proxyReply struct {
+	Presence  *models.Presence           `json:"presence,omitempty"`
+	Presences map[string]models.Presence `json:"presences,omitempty"`
+	Revision  uint64                     `json:"revision,omitempty"`
+	NotFound  bool                       `json:"not_found,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+	Code      string                     `json:"code,omitempty"` // Kind of Error, one of the proxyCode values
+}
+
+// Kinds of proxy errors, so a proxy node fails the way the serving node's
+// store did instead of with an opaque error
+const (
+	proxyCodeTimeout          = "timeout"
+	proxyCodeUnavailable      = "unavailable"
+	proxyCodeRevisionMismatch = "revision_mismatch"
+)
+
+// ErrProxyUnavailable reports a proxy request answered by a node whose own
+// store couldn't be reached
+var ErrProxyUnavailable = errors.New("store unavailable on the serving node")
+
+// proxyErrorCode is the proxyCode value of err, "" for other errors
+func proxyErrorCode(err error) string {
+	switch {
+	case apperrors.IsRevisionMismatch(err):
+		return proxyCodeRevisionMismatch
+	case IsTimeout(err):
+		return proxyCodeTimeout
+	case IsUnavailable(err):
+		return proxyCodeUnavailable
+	}
+	return ""
+}
+
+// proxyError is the error a proxy reply reports, matching what the serving
+// node's store failed with
+func proxyError(op string, reply proxyReply) error {
+	err := errors.New(reply.Error)
+	switch reply.Code {
+	case proxyCodeTimeout:
+		return &TimeoutError{Op: op, Err: err}
+	case proxyCodeUnavailable:
+		return fmt.Errorf("proxy %s failed: %v: %w", op, err, ErrProxyUnavailable)
+	case proxyCodeRevisionMismatch:
+		return fmt.Errorf("proxy %s failed: %v: %w", op, err, ErrRevisionMismatch)
+	}
+	return fmt.Errorf("proxy %s failed: %v", op, err)
+}
+
+// proxySubject is the subject proxy requests for bucket are sent on
+func proxySubject(bucket string) string {
+	return "presence.proxy." + bucket
+}
+
+// ServeProxy implements ProxyServer. Requests carry the request ID and trace
+// context of the proxy's caller, so writes made for a proxy are attributed
+// to the original request.
+func (s *kvStore) ServeProxy(ctx context.Context) error {
+	if s.conn == nil || s.kv == nil {
+		return nats.ErrConnectionClosed
+	}
+	sub, err := s.conn.QueueSubscribe(proxySubject(s.bucket()), proxyQueue, func(msg *nats.Msg) {
+		reqCtx := ctx
+		if id, sc := extractHeaders(msg.Header); id != "" || sc.IsValid() {
+			reqCtx = trace.ContextWithRemoteSpanContext(requestid.NewContext(ctx, id), sc)
+		}
+		data, _ := json.Marshal(s.answerProxy(reqCtx, msg.Data))
+		msg.Respond(data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to proxy requests: %w", err)
+	}
+	// Make sure the server has the subscription before reporting success
+	if err := s.conn.Flush(); err != nil {
+		sub.Unsubscribe()
+		return fmt.Errorf("failed to subscribe to proxy requests: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe()
+	}()
+	return nil
+}
+
+func (s *kvStore) answerProxy(ctx context.Context, data []byte) proxyReply {
+	var req proxyRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return proxyReply{Error: "invalid proxy request"}
+	}
+	var reply proxyReply
+	var err error
+	switch req.Op {
+	case opGet:
+		var p models.Presence
+		if p, err = s.Get(ctx, req.UserID); err == nil {
+			reply.Presence = &p
+		}
+	case opGetMultiple:
+		reply.Presences, err = s.GetMultiple(ctx, req.UserIDs)
+	case opSet:
+		if req.Presence == nil {
+			return proxyReply{Error: "presence is required"}
+		}
+		reply.Revision, err = s.SetWithRevision(ctx, req.UserID, *req.Presence, req.TTL)
+	case proxyOpUpdate:
+		if req.Presence == nil {
+			return proxyReply{Error: "presence is required"}
+		}
+		reply.Revision, err = s.UpdateAtRevision(ctx, req.UserID, *req.Presence, req.TTL, req.Revision)
+	case opDelete:
+		err = s.Delete(ctx, req.UserID)
+	default:
+		return proxyReply{Error: fmt.Sprintf("unknown proxy operation %q", req.Op)}
+	}
+	if apperrors.IsNotFound(err) {
+		return proxyReply{NotFound: true}
+	}
+	if err != nil {
+		return proxyReply{Error: err.Error(), Code: proxyErrorCode(err)}
+	}
+	return reply
+}
+
+// proxyStore implements KVStore without a bucket, by sending every
+// operation to the nodes serving proxy requests for it. Changes are watched
+// on the bucket's subjects with a core subscription, so watch events carry
+// no revision and nothing written before the watch is replayed.
+type proxyStore struct {
+	config  KVConfig
+	conn    *nats.Conn
+	subject string
+}
+
+// newProxyStore connects to NATS as a proxy node: no JetStream is used and
+// the bucket need not be reachable from this node's account
+func newProxyStore(config KVConfig) (KVStore, error) {
+	serverURL := config.ServerURL
+	if serverURL == "" {
+		serverURL = config.CenterURL
+	}
+	if serverURL == "" {
+		return nil, fmt.Errorf("proxy nodes must specify a NATS server or center URL")
+	}
+	conn, err := nats.Connect(serverURL, connectOptions(config)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	if config.Observer != nil && conn.IsConnected() {
+		config.Observer.ConnectionChanged(ConnectionEvent{Type: ConnectionConnected, URL: conn.ConnectedUrlRedacted()})
+	}
+	return &proxyStore{config: config, conn: conn, subject: proxySubject(bucketName(config))}, nil
+}
+
+// request sends req and decodes the reply, bounded by timeout
+func (p *proxyStore) request(ctx context.Context, op string, timeout time.Duration, req proxyRequest) (proxyReply, error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	req.Op = op
+	data, err := json.Marshal(req)
+	if err != nil {
+		return proxyReply{}, fmt.Errorf("failed to encode proxy request: %w", err)
+	}
+	msg := nats.NewMsg(p.subject)
+	msg.Data = data
+	injectHeaders(ctx, msg.Header)
+	resp, err := p.conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		return proxyReply{}, fmt.Errorf("proxy %s failed: %w", op, asTimeout(ctx, op, err))
+	}
+	var reply proxyReply
+	if err := json.Unmarshal(resp.Data, &reply); err != nil {
+		return proxyReply{}, fmt.Errorf("invalid proxy reply: %w", err)
+	}
+	if reply.Error != "" {
+		return proxyReply{}, proxyError(op, reply)
+	}
+	return reply, nil
+}
+
+// Get implements KVStore
+func (p *proxyStore) Get(ctx context.Context, userID string) (models.Presence, error) {
+	reply, err := p.request(ctx, opGet, p.config.ReadTimeout, proxyRequest{UserID: userID})
+	if err != nil {
+		return models.Presence{}, err
+	}
+	if reply.NotFound || reply.Presence == nil {
+		return models.Presence{}, apperrors.NotFound(userID)
+	}
+	return *reply.Presence, nil
+}
+
+// Set implements KVStore
+func (p *proxyStore) Set(ctx context.Context, userID string, presence models.Presence, ttl time.Duration) error {
+	_, err := p.SetWithRevision(ctx, userID, presence, ttl)
+	return err
+}
+
+// SetWithRevision implements RevisionSetter
+func (p *proxyStore) SetWithRevision(ctx context.Context, userID string, presence models.Presence, ttl time.Duration) (uint64, error) {
+	reply, err := p.request(ctx, opSet, p.config.WriteTimeout, proxyRequest{UserID: userID, Presence: &presence, TTL: ttl})
+	if err != nil {
+		return 0, err
+	}
+	return reply.Revision, nil
+}
+
+// UpdateAtRevision implements RevisionUpdater
+func (p *proxyStore) UpdateAtRevision(ctx context.Context, userID string, presence models.Presence, ttl time.Duration, revision uint64) (uint64, error) {
+	reply, err := p.request(ctx, proxyOpUpdate, p.config.WriteTimeout, proxyRequest{UserID: userID, Presence: &presence, TTL: ttl, Revision: revision})
+	if err != nil {
+		return 0, err
+	}
+	return reply.Revision, nil
+}
+
+// Delete implements KVStore
+func (p *proxyStore) Delete(ctx context.Context, userID string) error {
+	_, err := p.request(ctx, opDelete, p.config.WriteTimeout, proxyRequest{UserID: userID})
+	return err
+}
+
+// GetMultiple implements KVStore. Even an empty read is a round trip, so it
+// tells whether any node is answering.
+func (p *proxyStore) GetMultiple(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	reply, err := p.request(ctx, opGetMultiple, p.config.ReadTimeout, proxyRequest{UserIDs: userIDs})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Presences == nil {
+		reply.Presences = map[string]models.Presence{}
+	}
+	return reply.Presences, nil
+}
+
+// Watch implements KVStore
+func (p *proxyStore) Watch(ctx context.Context, callback func(WatchEvent)) error {
+	prefix := "$KV." + bucketName(p.config) + "."
+	sub, err := p.conn.Subscribe(prefix+">", func(msg *nats.Msg) {
+		event := changeEvent(prefix, msg.Subject, msg.Header, msg.Data)
+		if event.Type != "" {
+			callback(event)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := p.conn.Flush(); err != nil {
+		sub.Unsubscribe()
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe()
+	}()
+	return nil
+}
+
+// Close implements KVStore
+func (p *proxyStore) Close() error {
+	p.conn.Close()
+	return nil
+}
@@ -0,0 +1,102 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/requestid"
+)
+
+func TestProxyStore(t *testing.T) {
+	center, err := NewKVStore(KVConfig{BucketName: "test-presence-proxy", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer center.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy, err := NewKVStore(KVConfig{
+		NodeType:     NodeTypeProxy,
+		ServerURL:    center.(*kvStore).conn.ConnectedUrl(),
+		BucketName:   "test-presence-proxy",
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("proxy store: %v", err)
+	}
+	defer proxy.Close()
+
+	// Nothing answers until a node serves the bucket
+	if _, err := proxy.GetMultiple(ctx, nil); err == nil || !IsUnavailable(err) {
+		t.Fatalf("expected an unavailable error without a responder, got %v", err)
+	}
+	if err := center.(ProxyServer).ServeProxy(ctx); err != nil {
+		t.Fatalf("ServeProxy: %v", err)
+	}
+
+	events := make(chan WatchEvent, 4)
+	if err := proxy.Watch(ctx, func(ev WatchEvent) { events <- ev }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	p := models.Presence{UserID: "alice", Status: models.StatusAway, LastSeen: now, UpdatedAt: now, NodeID: "edge-1"}
+	rev, err := proxy.(RevisionSetter).SetWithRevision(requestid.NewContext(ctx, "req-42"), "alice", p, 0)
+	if err != nil || rev == 0 {
+		t.Fatalf("SetWithRevision: %d %v", rev, err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != WatchEventPut || ev.Presence == nil || ev.Presence.Status != models.StatusAway || ev.RequestID != "req-42" {
+			t.Fatalf("unexpected watch event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the write to be watched")
+	}
+
+	got, err := proxy.Get(ctx, "alice")
+	if err != nil || got.Status != models.StatusAway || got.Revision != rev {
+		t.Fatalf("Get: %+v %v", got, err)
+	}
+	many, err := proxy.GetMultiple(ctx, []string{"alice", "bob"})
+	if err != nil || len(many) != 1 || many["alice"].NodeID != "edge-1" {
+		t.Fatalf("GetMultiple: %+v %v", many, err)
+	}
+
+	// A conditional write fails on a proxy the way it does on the bucket
+	updater := proxy.(RevisionUpdater)
+	if _, err := updater.UpdateAtRevision(ctx, "alice", p, 0, rev+10); !apperrors.IsRevisionMismatch(err) {
+		t.Fatalf("expected a revision mismatch through the proxy, got %v", err)
+	}
+	if next, err := updater.UpdateAtRevision(ctx, "alice", p, 0, rev); err != nil || next <= rev {
+		t.Fatalf("UpdateAtRevision: %d %v", next, err)
+	}
+
+	if err := proxy.Delete(ctx, "alice"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := proxy.Get(ctx, "alice"); !apperrors.IsNotFound(err) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestProxyError(t *testing.T) {
+	for code, is := range map[string]func(error) bool{
+		proxyCodeTimeout:          apperrors.IsTimeout,
+		proxyCodeUnavailable:      IsUnavailable,
+		proxyCodeRevisionMismatch: apperrors.IsRevisionMismatch,
+	} {
+		err := proxyError(opSet, proxyReply{Error: "failed", Code: code})
+		if !is(err) || proxyErrorCode(err) != code {
+			t.Errorf("%s: error %v doesn't carry its kind", code, err)
+		}
+	}
+	if err := proxyError(opSet, proxyReply{Error: "failed"}); IsUnavailable(err) || apperrors.IsRevisionMismatch(err) || proxyErrorCode(err) != "" {
+		t.Errorf("expected an uncoded error to stay opaque, got %v", err)
+	}
+}
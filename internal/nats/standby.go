@@ -0,0 +1,359 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Center roles
+const (
+	CenterPrimary  = "primary"
+	CenterStandby  = "standby"  // Mirroring its primary's presence bucket
+	CenterPromoted = "promoted" // A standby that took over from its primary
+)
+
+// CenterStatus describes an embedded center node's part in a standby pair
+type CenterStatus struct {
+	Role             string    `json:"role"`
+	Domain           string    `json:"domain,omitempty"`
+	PrimaryConnected bool      `json:"primary_connected"`        // Standby only: the leaf link to the primary is up
+	PrimaryLostAt    time.Time `json:"primary_lost_at,omitzero"` // Standby only: when the link was first seen down
+	PromotedAt       time.Time `json:"promoted_at,omitzero"`
+}
+
+// StandbyCenter is implemented by stores running an embedded center node
+// that can stand by for a primary
+type StandbyCenter interface {
+	// CenterStatus reports the node's role, and false if it is not a center
+	// with a JetStream domain, so has no part in a standby pair
+	CenterStatus() (CenterStatus, bool)
+	// Promote turns a standby's mirror of the presence bucket into the
+	// bucket itself, so the node takes writes; it does nothing on a primary
+	Promote(ctx context.Context) error
+}
+
+// standbyState tracks the leaf link of a standby center to its primary
+type standbyState struct {
+	mu         sync.Mutex
+	promoted   bool
+	lostAt     time.Time // Zero while connected
+	promotedAt time.Time
+}
+
+// ErrPrimaryReachable refuses to promote a standby whose primary still
+// accepts connections: only the leaf link between them is down, and taking
+// writes on both centers would split the pair
+var ErrPrimaryReachable = errors.New("primary center is still reachable")
+
+// primaryProbeTimeout bounds each connection attempt of the fencing check
+// before a promotion
+const primaryProbeTimeout = 2 * time.Second
+
+// replayHeader marks the values a promotion writes back into the bucket.
+// They repeat the mirror's latest values at new revisions, so change
+// subscribers skip them, while watchers still read them as current values.
+const replayHeader = "Presence-Replay"
+
+// kvDenied keeps KV writes from crossing a standby's leaf link, so neither
+// center's bucket captures the other's writes once the standby is promoted.
+// The mirror reads the primary through its JetStream domain instead.
+var kvDenied = []string{"$KV.>"}
+
+// leafRemote is the leaf remote soliciting one of the comma-separated URLs,
+// tried in order
+func leafRemote(urls string) (*server.RemoteLeafOpts, error) {
+	remote := &server.RemoteLeafOpts{NoRandomize: true}
+	for _, raw := range strings.Split(urls, ",") {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid leaf URL %q", raw)
+		}
+		remote.URLs = append(remote.URLs, u)
+	}
+	return remote, nil
+}
+
+// standbyBucket makes kvc, the presence bucket of a standby, a mirror of the
+// primary's bucket, unless this node already took over from the primary
+func standbyBucket(ctx context.Context, js jetstream.JetStream, config KVConfig, kvc jetstream.KeyValueConfig) (jetstream.KeyValueConfig, error) {
+	if err := finishPromotion(ctx, js, kvc.Bucket); err != nil {
+		return kvc, err
+	}
+	stream, err := js.Stream(ctx, "KV_"+kvc.Bucket)
+	switch {
+	case errors.Is(err, jetstream.ErrStreamNotFound):
+	case err != nil:
+		return kvc, fmt.Errorf("failed to read KV bucket %s: %w", kvc.Bucket, err)
+	case stream.CachedInfo().Config.Mirror == nil:
+		// Promoted before a restart; mirroring again would drop the writes since
+		return kvc, nil
+	}
+	// Spelled out: only CreateStream translates StreamSource.Domain
+	kvc.Mirror = &jetstream.StreamSource{Name: kvc.Bucket, External: &jetstream.ExternalStream{APIPrefix: "$JS." + config.PrimaryDomain + ".API"}}
+	return kvc, nil
+}
+
+// resumeStandby marks a standby whose bucket is no longer a mirror as
+// promoted, as it was before a restart
+func (s *kvStore) resumeStandby(ctx context.Context) error {
+	if s.standby == nil {
+		return nil
+	}
+	stream, err := s.js.Stream(ctx, "KV_"+s.bucket())
+	if err != nil {
+		return fmt.Errorf("failed to read KV bucket %s: %w", s.bucket(), err)
+	}
+	s.standby.promoted = stream.CachedInfo().Config.Mirror == nil
+	return nil
+}
+
+// CenterStatus reports whether this node is a primary or a standby center,
+// and for a standby, whether its primary is reachable
+func (s *kvStore) CenterStatus() (CenterStatus, bool) {
+	st := CenterStatus{Role: CenterPrimary, Domain: s.config.Domain}
+	if s.standby == nil {
+		return st, s.config.Domain != "" && s.server != nil
+	}
+	connected := s.primaryConnected()
+
+	s.standby.mu.Lock()
+	defer s.standby.mu.Unlock()
+	switch {
+	case s.standby.promoted:
+		st.Role, st.PromotedAt = CenterPromoted, s.standby.promotedAt
+	case connected:
+		st.Role = CenterStandby
+		s.standby.lostAt = time.Time{}
+	default:
+		st.Role = CenterStandby
+		if s.standby.lostAt.IsZero() {
+			s.standby.lostAt = time.Now().UTC()
+		}
+	}
+	st.PrimaryConnected, st.PrimaryLostAt = connected, s.standby.lostAt
+	return st, true
+}
+
+// primaryConnected reports whether the leaf link this node solicited, the
+// one to its primary, is up. Leaf nodes connecting to this node don't count.
+func (s *kvStore) primaryConnected() bool {
+	if s.server == nil {
+		return false
+	}
+	leafz, err := s.server.Leafz(nil)
+	if err != nil {
+		return false
+	}
+	for _, l := range leafz.Leafs {
+		if l.IsSpoke {
+			return true
+		}
+	}
+	return false
+}
+
+// Promote replaces the mirror a standby keeps of its primary's presence
+// bucket with a writable bucket holding the same entries. A lost leaf link
+// alone doesn't prove the primary is down, so the primary is probed first,
+// and Promote fails with ErrPrimaryReachable while it still accepts
+// connections. NATS can't turn a mirror into a regular stream, so the
+// mirror's latest values are copied into a staging stream, the stream is
+// recreated without the mirror, continuing its revisions, and the values
+// are written back from the staging stream. A node stopped midway finishes
+// the promotion from the staging stream when it restarts. The values come
+// back at new revisions above every revision the primary issued, so readers
+// keep seeing each user's changes in order, but are marked as a replay and
+// not reported as changes. Durable consumers are declared again from the
+// current revision.
+func (s *kvStore) Promote(ctx context.Context) error {
+	if s.standby == nil {
+		return nil
+	}
+	s.standby.mu.Lock()
+	defer s.standby.mu.Unlock()
+	if s.standby.promoted {
+		return nil
+	}
+	if s.primaryReachable(ctx) {
+		return ErrPrimaryReachable
+	}
+
+	bucket := s.bucket()
+	stream, err := s.js.Stream(ctx, "KV_"+bucket)
+	if err != nil {
+		return fmt.Errorf("failed to read mirror: %w", err)
+	}
+	info := stream.CachedInfo()
+	if info.Config.Mirror != nil {
+		if err := s.replaceMirror(ctx, info); err != nil {
+			return err
+		}
+	}
+	s.standby.promoted, s.standby.promotedAt = true, time.Now().UTC()
+	s.logger().Warn("standby center promoted", "bucket", bucket, "revision", info.State.LastSeq)
+	return nil
+}
+
+// primaryReachable reports whether any of the primary's leaf URLs accepts
+// a connection, which the primary's server still does when only the leaf
+// link failed
+func (s *kvStore) primaryReachable(ctx context.Context) bool {
+	remote, err := leafRemote(s.config.PrimaryURL)
+	if err != nil {
+		return false
+	}
+	dialer := net.Dialer{Timeout: primaryProbeTimeout}
+	for _, u := range remote.URLs {
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "7422")
+		}
+		if conn, err := dialer.DialContext(ctx, "tcp", host); err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// replaceMirror recreates the mirror stream of info as a regular KV stream
+// holding the mirror's latest values
+func (s *kvStore) replaceMirror(ctx context.Context, info *jetstream.StreamInfo) error {
+	cfg := info.Config
+	cfg.Mirror, cfg.MirrorDirect = nil, false
+	cfg.Subjects = []string{s.keyPrefix() + ">"}
+	cfg.FirstSeq = info.State.LastSeq + 1
+	bucket := s.bucket()
+	if err := s.stage(ctx, cfg); err != nil {
+		return err
+	}
+	if err := s.js.DeleteStream(ctx, cfg.Name); err != nil {
+		return fmt.Errorf("failed to remove mirror: %w", err)
+	}
+	if err := finishPromotion(ctx, s.js, bucket); err != nil {
+		return err
+	}
+	for _, name := range s.config.Resources.Consumers {
+		if _, err := s.js.CreateOrUpdateConsumer(ctx, cfg.Name, durableConsumerConfig(bucket, name)); err != nil {
+			return fmt.Errorf("failed to declare durable consumer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// stage copies the mirror's latest values into the staging stream, along
+// with cfg, the configuration of the bucket stream replacing the mirror
+func (s *kvStore) stage(ctx context.Context, cfg jetstream.StreamConfig) error {
+	bucket := s.bucket()
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode bucket config: %w", err)
+	}
+	// Left over from an attempt that failed before removing the mirror
+	if err := s.js.DeleteStream(ctx, stagingStream(bucket)); err != nil && !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return fmt.Errorf("failed to remove staging stream: %w", err)
+	}
+	if _, err := s.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:              stagingStream(bucket),
+		Subjects:          []string{stagingPrefix(bucket) + ">"},
+		MaxMsgsPerSubject: 1,
+		Storage:           cfg.Storage,
+		Replicas:          cfg.Replicas,
+		Metadata:          map[string]string{stagingConfigKey: string(encoded)},
+	}); err != nil {
+		return fmt.Errorf("failed to create staging stream: %w", err)
+	}
+
+	lister, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list mirrored keys: %w", err)
+	}
+	for key := range lister.Keys() {
+		entry, err := s.kv.Get(ctx, key)
+		if err != nil {
+			continue // Deleted or expired since it was listed
+		}
+		if _, err := s.js.Publish(ctx, stagingPrefix(bucket)+key, entry.Value()); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// stagingConfigKey is the staging stream metadata holding the configuration
+// of the bucket stream to create
+const stagingConfigKey = "presence_bucket_config"
+
+// stagingStream names the stream holding a promotion's values while the
+// bucket stream is recreated
+func stagingStream(bucket string) string { return "KV_" + bucket + "_PROMOTION" }
+
+// stagingPrefix is the subject prefix of the staged values, followed by
+// their key
+func stagingPrefix(bucket string) string { return "$KVPROMOTION." + bucket + "." }
+
+// finishPromotion completes a promotion whose values are staged: it creates
+// the bucket stream unless it exists, writes the staged values back and
+// removes the staging stream. A staging stream left beside the mirror is
+// from a promotion that failed before replacing it, and is only removed.
+func finishPromotion(ctx context.Context, js jetstream.JetStream, bucket string) error {
+	staging, err := js.Stream(ctx, stagingStream(bucket))
+	switch {
+	case errors.Is(err, jetstream.ErrStreamNotFound):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to read staging stream: %w", err)
+	}
+	stream, err := js.Stream(ctx, "KV_"+bucket)
+	switch {
+	case err == nil && stream.CachedInfo().Config.Mirror != nil:
+		if err := js.DeleteStream(ctx, stagingStream(bucket)); err != nil {
+			return fmt.Errorf("failed to remove staging stream: %w", err)
+		}
+		return nil
+	case errors.Is(err, jetstream.ErrStreamNotFound):
+		var cfg jetstream.StreamConfig
+		if err := json.Unmarshal([]byte(staging.CachedInfo().Config.Metadata[stagingConfigKey]), &cfg); err != nil {
+			return fmt.Errorf("invalid staged bucket config: %w", err)
+		}
+		if _, err := js.CreateStream(ctx, cfg); err != nil {
+			return fmt.Errorf("failed to recreate bucket: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to read KV bucket %s: %w", bucket, err)
+	}
+
+	// Restored values already written by an interrupted attempt are
+	// written again, unchanged
+	state := staging.CachedInfo().State
+	for seq := state.FirstSeq; state.Msgs > 0 && seq <= state.LastSeq; seq++ {
+		msg, err := staging.GetMsg(ctx, seq)
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read staged value: %w", err)
+		}
+		restored := nats.NewMsg("$KV." + bucket + "." + strings.TrimPrefix(msg.Subject, stagingPrefix(bucket)))
+		restored.Data = msg.Data
+		restored.Header.Set(replayHeader, "promotion")
+		if _, err := js.PublishMsg(ctx, restored); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", restored.Subject, err)
+		}
+	}
+	if err := js.DeleteStream(ctx, stagingStream(bucket)); err != nil {
+		return fmt.Errorf("failed to remove staging stream: %w", err)
+	}
+	return nil
+}
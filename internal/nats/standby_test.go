@@ -0,0 +1,255 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(15 * time.Second); !cond(); time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// newStandbyPair starts a primary center and its standby, mirroring
+// bucket. The caller closes both.
+func newStandbyPair(t *testing.T, bucket string) (primary, standby KVStore) {
+	t.Helper()
+	leafPort := freePort(t)
+	primary, err := NewKVStore(KVConfig{BucketName: bucket, Embedded: true, DataDir: t.TempDir(), NodeType: "center", Domain: "east", LeafPort: leafPort})
+	if err != nil {
+		t.Fatalf("primary: %v", err)
+	}
+	standby, err = NewKVStore(KVConfig{BucketName: bucket, Embedded: true, DataDir: t.TempDir(), NodeType: "center",
+		Domain: "west", PrimaryURL: fmt.Sprintf("nats://127.0.0.1:%d", leafPort), PrimaryDomain: "east"})
+	if err != nil {
+		primary.Close()
+		t.Fatalf("standby: %v", err)
+	}
+	return primary, standby
+}
+
+func TestStandbyCenter_MirrorsAndPromotes(t *testing.T) {
+	primary, standby := newStandbyPair(t, "test-standby")
+	defer standby.Close()
+	// A leaf node listing both centers, the primary first
+	centers := primary.(*kvStore).config.ServerURL + "," + standby.(*kvStore).config.ServerURL
+	leaf, err := NewKVStore(KVConfig{BucketName: "test-standby", NodeType: "leaf", CenterURL: centers, ReconnectWait: 10 * time.Millisecond, ReconnectMaxWait: 50 * time.Millisecond})
+	if err != nil {
+		primary.Close()
+		t.Fatalf("leaf: %v", err)
+	}
+	defer leaf.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "alice", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	rev, err := leaf.(RevisionSetter).SetWithRevision(ctx, "alice", p, time.Hour)
+	if err != nil {
+		t.Fatalf("Set through the primary: %v", err)
+	}
+
+	sc := standby.(StandbyCenter)
+	waitFor(t, "the mirror to catch up", func() bool {
+		got, err := standby.Get(ctx, "alice")
+		return err == nil && got.Revision == rev
+	})
+	if st, ok := sc.CenterStatus(); !ok || st.Role != CenterStandby || !st.PrimaryConnected {
+		t.Fatalf("unexpected standby status %+v", st)
+	}
+	if err := standby.Set(ctx, "bob", p, time.Hour); err == nil {
+		t.Fatal("expected a standby to refuse writes")
+	}
+	if st, ok := primary.(StandbyCenter).CenterStatus(); !ok || st.Role != CenterPrimary {
+		t.Fatalf("unexpected primary status %+v", st)
+	}
+
+	changes := make(chan WatchEvent, 4)
+	if err := standby.(EventBus).SubscribeChanges(ctx, "promotion_test", func(we WatchEvent) { changes <- we }); err != nil {
+		t.Fatalf("SubscribeChanges: %v", err)
+	}
+	primary.Close()
+	waitFor(t, "the primary to be seen down", func() bool {
+		st, _ := sc.CenterStatus()
+		return !st.PrimaryConnected && !st.PrimaryLostAt.IsZero()
+	})
+	if err := sc.Promote(ctx); err != nil {
+		t.Fatalf("Promote: %v", err)
+	}
+	if _, err := standby.(*kvStore).js.Stream(ctx, stagingStream("test-standby")); err == nil {
+		t.Fatal("expected the staging stream removed after the promotion")
+	}
+	if st, _ := sc.CenterStatus(); st.Role != CenterPromoted || st.PromotedAt.IsZero() {
+		t.Fatalf("unexpected promoted status %+v", st)
+	}
+	got, err := standby.Get(ctx, "alice")
+	if err != nil || got.Status != models.StatusOnline || got.Revision <= rev {
+		t.Fatalf("expected alice kept at a newer revision than %d, got %+v %v", rev, got, err)
+	}
+	watched := make(chan WatchEvent, 4)
+	if err := standby.Watch(ctx, func(we WatchEvent) { watched <- we }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	select {
+	case we := <-watched:
+		if we.Key != "user.alice" || !we.Replay || we.Revision != got.Revision {
+			t.Fatalf("expected alice's replayed value watched, got %+v", we)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a watch to read the replayed values")
+	}
+	p.UserID = "bob"
+	if err := standby.Set(ctx, "bob", p, time.Hour); err != nil {
+		t.Fatalf("Set after promotion: %v", err)
+	}
+	// Change subscribers see bob's write, not alice's replay
+	select {
+	case we := <-changes:
+		if we.Key != "user.bob" {
+			t.Fatalf("expected only bob's change, got %+v", we)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected bob's change")
+	}
+	if err := sc.Promote(ctx); err != nil {
+		t.Fatalf("a second Promote should do nothing, got %v", err)
+	}
+	if err := standby.(*kvStore).resumeStandby(ctx); err != nil || !standby.(*kvStore).standby.promoted {
+		t.Fatalf("expected a restart to find the bucket promoted, got %v", err)
+	}
+	if _, ok := leaf.(StandbyCenter).CenterStatus(); ok {
+		t.Error("expected a leaf node to have no center status")
+	}
+	waitFor(t, "the leaf to fail over", func() bool {
+		got, err := leaf.Get(ctx, "bob")
+		return err == nil && got.UserID == "bob"
+	})
+	p.UserID = "carol"
+	if err := leaf.Set(ctx, "carol", p, time.Hour); err != nil {
+		t.Fatalf("Set through the promoted standby: %v", err)
+	}
+}
+
+func TestKVConfig_StandbyValidation(t *testing.T) {
+	for name, c := range map[string]KVConfig{
+		"no domains":  {PrimaryURL: "nats://primary:7422"},
+		"same domain": {PrimaryURL: "nats://primary:7422", Domain: "east", PrimaryDomain: "east"},
+		"bad url":     {PrimaryURL: "::", Domain: "west", PrimaryDomain: "east"},
+	} {
+		if _, err := c.serverOptions("center"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := (KVConfig{PrimaryURL: "nats://primary:7422", Domain: "west", PrimaryDomain: "east"}).serverOptions("leaf"); err == nil {
+		t.Error("expected leaf nodes to be refused as standbys")
+	}
+	opts, err := KVConfig{CenterURL: "nats://east:7422, nats://west:7422"}.serverOptions("leaf")
+	if err != nil || len(opts.LeafNode.Remotes) != 1 || len(opts.LeafNode.Remotes[0].URLs) != 2 {
+		t.Fatalf("expected one remote over both centers, got %+v %v", opts, err)
+	}
+}
+
+func TestStandbyCenter_FencedWhilePrimaryAcceptsConnections(t *testing.T) {
+	// Accepts connections but never completes a leaf link, like a primary
+	// whose link alone is broken
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	standby, err := NewKVStore(KVConfig{BucketName: "test-standby-fenced", Embedded: true, DataDir: t.TempDir(), NodeType: "center",
+		Domain: "west", PrimaryURL: "nats://" + l.Addr().String(), PrimaryDomain: "east"})
+	if err != nil {
+		t.Fatalf("standby: %v", err)
+	}
+	defer standby.Close()
+
+	sc := standby.(StandbyCenter)
+	if st, _ := sc.CenterStatus(); st.PrimaryConnected {
+		t.Fatalf("expected no leaf link, got %+v", st)
+	}
+	if err := sc.Promote(context.Background()); !errors.Is(err, ErrPrimaryReachable) {
+		t.Fatalf("expected the promotion fenced, got %v", err)
+	}
+	if st, _ := sc.CenterStatus(); st.Role != CenterStandby {
+		t.Fatalf("expected the node to keep standing by, got %+v", st)
+	}
+}
+
+func TestStandbyCenter_FinishesInterruptedPromotion(t *testing.T) {
+	primary, standby := newStandbyPair(t, "test-standby-resume")
+	defer standby.Close()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "alice", Status: models.StatusBusy, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+	rev, err := primary.(RevisionSetter).SetWithRevision(ctx, "alice", p, time.Hour)
+	if err != nil {
+		t.Fatalf("Set on the primary: %v", err)
+	}
+	waitFor(t, "the mirror to catch up", func() bool {
+		got, err := standby.Get(ctx, "alice")
+		return err == nil && got.Revision == rev
+	})
+	primary.Close()
+
+	// Stop after removing the mirror, before the bucket is recreated
+	s := standby.(*kvStore)
+	stream, err := s.js.Stream(ctx, "KV_test-standby-resume")
+	if err != nil {
+		t.Fatalf("mirror: %v", err)
+	}
+	info := stream.CachedInfo()
+	cfg := info.Config
+	cfg.Mirror, cfg.MirrorDirect = nil, false
+	cfg.Subjects = []string{s.keyPrefix() + ">"}
+	cfg.FirstSeq = info.State.LastSeq + 1
+	if err := s.stage(ctx, cfg); err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	if err := s.js.DeleteStream(ctx, cfg.Name); err != nil {
+		t.Fatalf("delete mirror: %v", err)
+	}
+
+	// Declaring the bucket again on restart finishes the promotion
+	if err := declare(ctx, s.js, s.config); err != nil {
+		t.Fatalf("declare: %v", err)
+	}
+	if err := s.resumeStandby(ctx); err != nil || !s.standby.promoted {
+		t.Fatalf("expected the node promoted, got %v", err)
+	}
+	got, err := standby.Get(ctx, "alice")
+	if err != nil || got.Status != models.StatusBusy || got.Revision <= rev {
+		t.Fatalf("expected alice restored at a newer revision than %d, got %+v %v", rev, got, err)
+	}
+	if _, err := s.js.Stream(ctx, stagingStream("test-standby-resume")); err == nil {
+		t.Fatal("expected the staging stream removed")
+	}
+}
@@ -5,15 +5,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	apperrors "gopresence/internal/errors"
 	"gopresence/internal/models"
 )
 
@@ -27,6 +33,37 @@ type KVStore interface {
 	Close() error
 }
 
+// KeyLister is implemented by stores that can enumerate stored user IDs
+type KeyLister interface {
+	Keys(ctx context.Context) ([]string, error)
+}
+
+// RevisionSetter is implemented by stores that report the revision a write
+// created, matching the Revision later read back for that entry
+type RevisionSetter interface {
+	SetWithRevision(ctx context.Context, userID string, presence models.Presence, ttl time.Duration) (uint64, error)
+}
+
+// RevisionUpdater is implemented by stores that can write a presence only
+// if the entry is still at a known revision, so a background update never
+// clobbers a concurrent write
+type RevisionUpdater interface {
+	// UpdateAtRevision stores presence if userID's entry is at revision and
+	// returns the new revision; it fails with ErrRevisionMismatch otherwise
+	UpdateAtRevision(ctx context.Context, userID string, presence models.Presence, ttl time.Duration, revision uint64) (uint64, error)
+}
+
+// ErrRevisionMismatch reports a conditional write against an entry that has
+// changed since the expected revision
+var ErrRevisionMismatch = apperrors.ErrRevisionMismatch
+
+// KeyWatcher is implemented by stores that can watch a subset of keys.
+// Filters are KV key patterns such as "user.alice" or "user.>"; only
+// matching keys are delivered, so targeted watchers skip unrelated traffic.
+type KeyWatcher interface {
+	WatchKeys(ctx context.Context, filters []string, callback func(WatchEvent)) error
+}
+
 // WatchEventType represents the type of watch event
 type WatchEventType string
 
@@ -40,6 +77,18 @@ type WatchEvent struct {
 	Key      string
 	Type     WatchEventType
 	Presence *models.Presence
+	Revision uint64 // KV revision of the change, also set for deletes
+
+	// Times the change was delivered to this consumer; above 1 for
+	// redeliveries by a durable watch. Zero when unknown.
+	Deliveries uint64
+
+	RequestID string            // ID of the request that made the change, if known
+	Trace     trace.SpanContext // Span that made the change, if traced
+
+	// Replay marks a value a standby's promotion wrote back unchanged at a
+	// new revision: current, but not a change
+	Replay bool
 }
 
 // KVConfig holds configuration for the KV store
@@ -48,13 +97,48 @@ type KVConfig struct {
 	BucketName   string
 	Embedded     bool
 	DataDir      string
-	NodeType     string // "center" or "leaf"
-	CenterURL    string // URL of center node (for leaf nodes)
+	NodeType     string // "center", "leaf" or "proxy"
+	CenterURL    string // URL of center node (for leaf and proxy nodes); leaf nodes take a comma-separated list, tried in order
 	LeafPort     int    // Port for leaf connections (for center nodes)
 	ClusterPort  int    // Port for cluster connections (for center nodes)
 	StartTimeout string // Startup wait duration, e.g., "30s"
+
+	ClusterRoutes []string // Route URLs of the other cluster members; the cluster port only opens with routes
+
+	Domain        string // Embedded center JetStream domain; both centers of a standby pair need one
+	PrimaryURL    string // Leaf URLs of the primary center, comma-separated; makes an embedded center its warm standby
+	PrimaryDomain string // JetStream domain of the primary center, for standbys
+
+	Resources Resources // JetStream resources center nodes declare at startup
+
+	JetStreamMaxMemory int64 // Embedded center JetStream memory limit in bytes (default 64MB)
+	JetStreamMaxStore  int64 // Embedded center JetStream storage limit in bytes (default 1GB)
+
+	ReconnectWait    time.Duration      // Initial reconnect delay, doubled per attempt (default 500ms)
+	ReconnectMaxWait time.Duration      // Reconnect delay cap (default 30s)
+	MaxReconnects    int                // Reconnect attempts before giving up; <= 0 retries forever
+	Observer         ConnectionObserver // Optional connection event hook
+
+	ReadTimeout  time.Duration // Bound on a single Get; <= 0 uses only the caller's context
+	WriteTimeout time.Duration // Bound on a single Set or Delete
+	WatchTimeout time.Duration // Bound on setting up a watch
+
+	ReadConcurrency int // Keys GetMultiple reads at once (default DefaultReadConcurrency)
+
+	FormerKeyPrefixes []string // Key prefixes older versions stored presences under, e.g. "presence."
+
+	WatchBuffer   int            // Events buffered per watch callback; 0 delivers synchronously
+	WatchOverflow OverflowPolicy // What a full watch buffer does (default DefaultOverflowPolicy)
+
+	Logger      *slog.Logger // Embedded server and store logs (default slog.Default())
+	ServerDebug bool         // Forward embedded server debug logs
+	ServerTrace bool         // Forward embedded server protocol traces
 }
 
+// DefaultReadConcurrency is how many keys GetMultiple reads at once unless
+// configured otherwise
+const DefaultReadConcurrency = 16
+
 // kvStore implements KVStore using NATS KV
 type kvStore struct {
 	config KVConfig
@@ -62,13 +146,21 @@ type kvStore struct {
 	conn   *nats.Conn
 	js     jetstream.JetStream
 	kv     jetstream.KeyValue
+
+	standby *standbyState // nil unless a standby center
 }
 
 // NewKVStore creates a new NATS KV store
 func NewKVStore(config KVConfig) (KVStore, error) {
+	if config.NodeType == NodeTypeProxy {
+		return newProxyStore(config)
+	}
 	store := &kvStore{
 		config: config,
 	}
+	if config.PrimaryURL != "" {
+		store.standby = &standbyState{}
+	}
 
 	// Start embedded server if configured
 	if config.Embedded {
@@ -78,7 +170,7 @@ func NewKVStore(config KVConfig) (KVStore, error) {
 	}
 
 	// Connect to NATS
-	serverURL := config.ServerURL
+	serverURL := store.config.ServerURL
 	if serverURL == "" {
 		if config.NodeType == "leaf" && config.CenterURL != "" {
 			// Leaf nodes should connect to center node for KV operations
@@ -88,16 +180,21 @@ func NewKVStore(config KVConfig) (KVStore, error) {
 		}
 	}
 
-	conn, err := nats.Connect(serverURL,
-		nats.RetryOnFailedConnect(true),
-		nats.MaxReconnects(-1),
-		nats.ReconnectWait(time.Second),
-	)
+	opts := connectOptions(config)
+	if serverURL == config.CenterURL {
+		// Fail over down the list of centers, preferring the first
+		opts = append(opts, nats.DontRandomize())
+	}
+	conn, err := nats.Connect(serverURL, opts...)
 	if err != nil {
 		store.cleanup()
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	store.conn = conn
+	// The connect hook only fires for connections established by a retry
+	if config.Observer != nil && conn.IsConnected() {
+		config.Observer.ConnectionChanged(ConnectionEvent{Type: ConnectionConnected, URL: conn.ConnectedUrlRedacted()})
+	}
 
 	// Default to center node if NodeType is not specified (for backward compatibility)
 	nodeType := config.NodeType
@@ -114,35 +211,22 @@ func NewKVStore(config KVConfig) (KVStore, error) {
 		}
 		store.js = js
 
-		// Create or get KV bucket
-		bucketName := config.BucketName
-		if bucketName == "" {
-			bucketName = "presence"
-		}
-
-		// Only center nodes can create KV buckets
+		// Only center nodes declare resources; leaf nodes open the center's as they exist
 		if nodeType == "center" {
-			kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{
-				Bucket: bucketName,
-				TTL:    time.Hour, // Default TTL
-			})
-			if err != nil {
-				// Try to get existing bucket
-				kv, err = js.KeyValue(context.Background(), bucketName)
-				if err != nil {
-					store.cleanup()
-					return nil, fmt.Errorf("failed to create/get KV bucket: %w", err)
-				}
-			}
-			store.kv = kv
-		} else {
-			// Leaf nodes access existing KV bucket
-			kv, err := js.KeyValue(context.Background(), bucketName)
-			if err != nil {
+			if err := declare(context.Background(), js, config); err != nil {
 				store.cleanup()
-				return nil, fmt.Errorf("failed to access KV bucket: %w", err)
+				return nil, err
 			}
-			store.kv = kv
+		}
+		kv, err := js.KeyValue(context.Background(), bucketName(config))
+		if err != nil {
+			store.cleanup()
+			return nil, fmt.Errorf("failed to access KV bucket: %w", err)
+		}
+		store.kv = kv
+		if err := store.resumeStandby(context.Background()); err != nil {
+			store.cleanup()
+			return nil, err
 		}
 	} else {
 		store.cleanup()
@@ -153,23 +237,26 @@ func NewKVStore(config KVConfig) (KVStore, error) {
 }
 
 // Get retrieves a presence from the KV store
-func (s *kvStore) Get(ctx context.Context, userID string) (models.Presence, error) {
+func (s *kvStore) Get(ctx context.Context, userID string) (_ models.Presence, err error) {
+	ctx, done := s.trace(ctx, opGet)
+	defer func() { done(err) }()
+	ctx, cancel := withTimeout(ctx, s.config.ReadTimeout)
+	defer cancel()
+
 	key := s.presenceKey(userID)
 
 	entry, err := s.kv.Get(ctx, key)
 	if err != nil {
-		// Check for various "not found" error types
-		if errors.Is(err, jetstream.ErrKeyNotFound) ||
-			strings.Contains(err.Error(), "not found") ||
-			strings.Contains(err.Error(), "no message found") {
-			return models.Presence{}, fmt.Errorf("presence not found for user %s", userID)
+		err = asTimeout(ctx, opGet, err)
+		if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrKeyDeleted) {
+			return models.Presence{}, apperrors.NotFound(userID)
 		}
 		return models.Presence{}, fmt.Errorf("failed to get presence: %w", err)
 	}
 
 	// Check if the entry is nil or has no data
 	if entry == nil || len(entry.Value()) == 0 {
-		return models.Presence{}, fmt.Errorf("presence not found for user %s", userID)
+		return models.Presence{}, apperrors.NotFound(userID)
 	}
 
 	var presence models.Presence
@@ -179,98 +266,326 @@ func (s *kvStore) Get(ctx context.Context, userID string) (models.Presence, erro
 
 	// Additional validation - check if this is actually a valid presence
 	if err := presence.Validate(); err != nil {
-		return models.Presence{}, fmt.Errorf("presence not found for user %s", userID)
+		return models.Presence{}, apperrors.NotFound(userID)
 	}
+	presence.Revision = entry.Revision()
+	presence.StoredAt = entry.Created().UTC()
 
 	return presence, nil
 }
 
 // Set stores a presence in the KV store
 func (s *kvStore) Set(ctx context.Context, userID string, presence models.Presence, ttl time.Duration) error {
+	_, err := s.SetWithRevision(ctx, userID, presence, ttl)
+	return err
+}
+
+// SetWithRevision stores a presence and returns the revision the write created
+func (s *kvStore) SetWithRevision(ctx context.Context, userID string, presence models.Presence, ttl time.Duration) (_ uint64, err error) {
+	ctx, done := s.trace(ctx, opSet)
+	defer func() { done(err) }()
+	return s.put(ctx, userID, presence)
+}
+
+// UpdateAtRevision stores a presence if the entry is still at revision
+func (s *kvStore) UpdateAtRevision(ctx context.Context, userID string, presence models.Presence, ttl time.Duration, revision uint64) (_ uint64, err error) {
+	ctx, done := s.trace(ctx, opSet)
+	defer func() { done(err) }()
+	rev, err := s.put(ctx, userID, presence, jetstream.WithExpectLastSequencePerSubject(revision))
+	var apiErr *jetstream.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence {
+		return 0, fmt.Errorf("failed to update %s at revision %d: %w", userID, revision, ErrRevisionMismatch)
+	}
+	return rev, err
+}
+
+// put publishes presence to its key's subject and returns the revision the
+// write created
+func (s *kvStore) put(ctx context.Context, userID string, presence models.Presence, opts ...jetstream.PublishOpt) (uint64, error) {
+	ctx, cancel := withTimeout(ctx, s.config.WriteTimeout)
+	defer cancel()
+
 	key := s.presenceKey(userID)
 
-	data, err := json.Marshal(presence)
+	// Store metadata describes the entry, so it is not part of the value
+	presence.Revision, presence.StoredAt = 0, time.Time{}
+	// Nor are the fields Presence.MarshalJSON derives for API responses,
+	// which would go stale in the store
+	type storedPresence models.Presence
+	data, err := json.Marshal(storedPresence(presence))
 	if err != nil {
-		return fmt.Errorf("failed to marshal presence: %w", err)
+		return 0, fmt.Errorf("failed to marshal presence: %w", err)
 	}
 
 	// Note: NATS KV doesn't support per-key TTL easily, so we rely on bucket-level TTL
-	// Individual key TTL would require additional application-level logic
-	_, err = s.kv.Put(ctx, key, data)
+	// Individual key TTL would require additional application-level logic.
+	// Publishing to the key's subject is what kv.Put does, but lets us attach
+	// the request ID and trace context as headers for watchers.
+	if s.js == nil {
+		return 0, fmt.Errorf("failed to put presence: %w", nats.ErrConnectionClosed)
+	}
+	msg := nats.NewMsg(s.keySubject(key))
+	msg.Data = data
+	injectHeaders(ctx, msg.Header)
+	ack, err := s.js.PublishMsg(ctx, msg, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to put presence: %w", err)
+		return 0, fmt.Errorf("failed to put presence: %w", asTimeout(ctx, opSet, err))
 	}
 
-	return nil
+	// A KV revision is the sequence of the entry's message in the bucket stream
+	return ack.Sequence, nil
 }
 
 // Delete removes a presence from the KV store
-func (s *kvStore) Delete(ctx context.Context, userID string) error {
+func (s *kvStore) Delete(ctx context.Context, userID string) (err error) {
+	ctx, done := s.trace(ctx, opDelete)
+	defer func() { done(err) }()
+	ctx, cancel := withTimeout(ctx, s.config.WriteTimeout)
+	defer cancel()
+
 	key := s.presenceKey(userID)
 
-	err := s.kv.Delete(ctx, key)
-	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
-		return fmt.Errorf("failed to delete presence: %w", err)
+	// Like Set, write the delete marker kv.Delete would so it carries the
+	// request ID and trace context
+	if s.js == nil {
+		return fmt.Errorf("failed to delete presence: %w", nats.ErrConnectionClosed)
+	}
+	msg := nats.NewMsg(s.keySubject(key))
+	msg.Header.Set(kvOperationHeader, kvOperationDelete)
+	injectHeaders(ctx, msg.Header)
+	if _, err = s.js.PublishMsg(ctx, msg); err != nil {
+		return fmt.Errorf("failed to delete presence: %w", asTimeout(ctx, opDelete, err))
 	}
 
 	return nil
 }
 
-// GetMultiple retrieves multiple presences from the KV store
-func (s *kvStore) GetMultiple(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
-	result := make(map[string]models.Presence)
+// GetMultiple retrieves multiple presences from the KV store, reading up to
+// ReadConcurrency keys at once so a large roster costs a few round trips'
+// latency rather than one per user
+func (s *kvStore) GetMultiple(ctx context.Context, userIDs []string) (_ map[string]models.Presence, err error) {
+	ctx, done := s.trace(ctx, opGetMultiple, attribute.Int("nats.kv.keys", len(userIDs)))
+	defer func() { done(err) }()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := s.config.ReadConcurrency
+	if workers <= 0 {
+		workers = DefaultReadConcurrency
+	}
+	workers = min(workers, len(userIDs))
 
+	var (
+		mu      sync.Mutex
+		result  = make(map[string]models.Presence, len(userIDs))
+		timeout error
+		wg      sync.WaitGroup
+	)
+	keys := make(chan string)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range keys {
+				presence, err := s.Get(ctx, userID)
+				mu.Lock()
+				switch {
+				case err == nil:
+					result[userID] = presence
+				case IsTimeout(err) && timeout == nil:
+					// Later keys would time out the same way
+					timeout = err
+					cancel()
+				}
+				// Ignore not found errors, just skip those users
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
 	for _, userID := range userIDs {
-		presence, err := s.Get(ctx, userID)
-		if err == nil {
-			result[userID] = presence
+		select {
+		case keys <- userID:
+		case <-ctx.Done():
+			break feed
 		}
-		// Ignore not found errors, just skip those users
 	}
+	close(keys)
+	wg.Wait()
 
+	// The caller's deadline may have passed before any read started
+	if timeout == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		timeout = asTimeout(ctx, opGetMultiple, ctx.Err())
+	}
+	if timeout != nil {
+		return nil, timeout
+	}
 	return result, nil
 }
 
-// Watch watches for changes in the KV store
+// Keys returns the user IDs currently stored in the bucket
+func (s *kvStore) Keys(ctx context.Context) (_ []string, err error) {
+	ctx, done := s.trace(ctx, opKeys)
+	defer func() { done(err) }()
+
+	lister, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	defer lister.Stop()
+
+	var userIDs []string
+	for key := range lister.Keys() {
+		if userID, ok := strings.CutPrefix(key, "user."); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// Watch watches for changes in the KV store. It consumes the bucket's
+// stream directly rather than through a KV watcher so message headers
+// (request ID, trace context) reach the callback.
 func (s *kvStore) Watch(ctx context.Context, callback func(WatchEvent)) error {
-	watcher, err := s.kv.WatchAll(ctx)
+	return s.watch(ctx, []string{">"}, callback)
+}
+
+// WatchKeys is like Watch but only delivers keys matching one of filters
+func (s *kvStore) WatchKeys(ctx context.Context, filters []string, callback func(WatchEvent)) error {
+	if len(filters) == 0 {
+		return fmt.Errorf("at least one key filter is required")
+	}
+	for _, f := range filters {
+		if err := validateKeyFilter(f); err != nil {
+			return err
+		}
+	}
+	return s.watch(ctx, filters, callback)
+}
+
+func (s *kvStore) watch(ctx context.Context, filters []string, callback func(WatchEvent)) error {
+	// Only consumer setup is timed; the watch itself runs for the life of ctx
+	_, done := s.trace(ctx, opWatch, attribute.StringSlice("nats.kv.filters", filters))
+	setupCtx, cancel := withTimeout(ctx, s.config.WatchTimeout)
+	defer cancel()
+	// Deliver within a consumer span joined to the writer's trace
+	deliver := func(event WatchEvent) {
+		cbCtx := trace.ContextWithRemoteSpanContext(ctx, event.Trace)
+		_, span := otel.Tracer(tracerName).Start(cbCtx, "kv.watch.deliver",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("nats.kv.bucket", s.bucket()),
+				attribute.String("nats.kv.key", event.Key),
+			),
+		)
+		callback(event)
+		span.End()
+	}
+	var d *dispatcher
+	if s.config.WatchBuffer > 0 {
+		policy := s.config.WatchOverflow
+		if policy == "" {
+			policy = DefaultOverflowPolicy
+		}
+		d = newDispatcher(s.config.WatchBuffer, policy, deliver)
+		deliver = d.push
+	}
+	cc, err := s.consumeUpdates(setupCtx, filters, func(msg jetstream.Msg) {
+		event := watchEvent(s.keyPrefix(), msg)
+		if event.Type == "" {
+			return
+		}
+		deliver(event)
+	})
+	err = asTimeout(setupCtx, opWatch, err)
+	done(err)
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
+	if d != nil {
+		go d.run(ctx)
+	}
 
 	go func() {
-		defer watcher.Stop()
-
-		for {
-			select {
-			case entry := <-watcher.Updates():
-				if entry == nil {
-					return
-				}
+		<-ctx.Done()
+		cc.Stop()
+	}()
 
-				event := WatchEvent{
-					Key: entry.Key(),
-				}
+	return nil
+}
 
-				if entry.Operation() == jetstream.KeyValuePut {
-					event.Type = WatchEventPut
-					var presence models.Presence
-					if err := json.Unmarshal(entry.Value(), &presence); err == nil {
-						event.Presence = &presence
-					}
-				} else if entry.Operation() == jetstream.KeyValueDelete {
-					event.Type = WatchEventDelete
-				}
+// consumeUpdates starts an ordered consumer delivering the latest value of
+// every key matching filters followed by all subsequent updates, like a KV
+// WatchFiltered
+func (s *kvStore) consumeUpdates(ctx context.Context, filters []string, handler jetstream.MessageHandler) (jetstream.ConsumeContext, error) {
+	if s.js == nil || s.kv == nil {
+		return nil, nats.ErrConnectionClosed
+	}
+	subjects := make([]string, len(filters))
+	for i, f := range filters {
+		subjects[i] = s.keySubject(f)
+	}
+	cons, err := s.js.OrderedConsumer(ctx, "KV_"+s.kv.Bucket(), jetstream.OrderedConsumerConfig{
+		FilterSubjects: subjects,
+		DeliverPolicy:  jetstream.DeliverLastPerSubjectPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cons.Consume(handler)
+}
 
-				callback(event)
+// validateKeyFilter checks a key pattern: dot-separated non-empty tokens,
+// "*" matching one token and a trailing ">" matching the rest
+func validateKeyFilter(filter string) error {
+	tokens := strings.Split(filter, ".")
+	for i, tok := range tokens {
+		switch {
+		case tok == "":
+			return fmt.Errorf("invalid key filter %q: empty token", filter)
+		case tok == ">" && i != len(tokens)-1:
+			return fmt.Errorf("invalid key filter %q: '>' must be the last token", filter)
+		case tok != ">" && tok != "*" && strings.ContainsAny(tok, "*> \t\r\n"):
+			return fmt.Errorf("invalid key filter %q", filter)
+		}
+	}
+	return nil
+}
 
-			case <-ctx.Done():
-				return
-			}
+// watchEvent decodes a KV stream message into a WatchEvent
+func watchEvent(prefix string, msg jetstream.Msg) WatchEvent {
+	event := changeEvent(prefix, msg.Subject(), msg.Headers(), msg.Data())
+	if meta, err := msg.Metadata(); err == nil {
+		event.Revision = meta.Sequence.Stream
+		event.Deliveries = meta.NumDelivered
+		if event.Presence != nil {
+			event.Presence.Revision = meta.Sequence.Stream
+			event.Presence.StoredAt = meta.Timestamp.UTC()
 		}
-	}()
+	}
+	return event
+}
 
-	return nil
+// changeEvent decodes a message written to a key's subject. Stream metadata,
+// such as the revision, is not part of it.
+func changeEvent(prefix, subject string, header nats.Header, data []byte) WatchEvent {
+	event := WatchEvent{
+		Key: strings.TrimPrefix(subject, prefix),
+	}
+	event.RequestID, event.Trace = extractHeaders(header)
+	event.Replay = header.Get(replayHeader) != ""
+
+	switch header.Get(kvOperationHeader) {
+	case "":
+		event.Type = WatchEventPut
+		var presence models.Presence
+		if err := json.Unmarshal(data, &presence); err == nil {
+			event.Presence = &presence
+		}
+	case kvOperationDelete, kvOperationPurge:
+		event.Type = WatchEventDelete
+	}
+	return event
 }
 
 // Close closes the KV store and cleans up resources
@@ -278,17 +593,75 @@ func (s *kvStore) Close() error {
 	return s.cleanup()
 }
 
+// KV stream header marking delete and purge markers
+const (
+	kvOperationHeader = "KV-Operation"
+	kvOperationDelete = "DEL"
+	kvOperationPurge  = "PURGE"
+)
+
+// keyPrefix is the stream subject prefix of the bucket's keys
+func (s *kvStore) keyPrefix() string {
+	return "$KV." + s.bucket() + "."
+}
+
+// keySubject is the stream subject a key is written to
+func (s *kvStore) keySubject(key string) string {
+	return s.keyPrefix() + key
+}
+
+// bucketName is the presence bucket's name, "presence" unless configured
+func bucketName(config KVConfig) string {
+	if config.BucketName == "" {
+		return "presence"
+	}
+	return config.BucketName
+}
+
 // presenceKey generates a KV key for a user presence
 func (s *kvStore) presenceKey(userID string) string {
 	return fmt.Sprintf("user.%s", userID)
 }
 
-// startEmbeddedServer starts an embedded NATS server
-func (s *kvStore) startEmbeddedServer() error {
-	// Default to center node if NodeType is not specified
-	nodeType := s.config.NodeType
-	if nodeType == "" {
-		nodeType = "center"
+// Embedded JetStream limits, used when KVConfig leaves them unset
+const (
+	defaultJetStreamMaxMemory = 64 * 1024 * 1024   // 64MB
+	defaultJetStreamMaxStore  = 1024 * 1024 * 1024 // 1GB
+)
+
+// validateEmbedded checks the embedded server settings before anything is started
+func (c KVConfig) validateEmbedded(nodeType string) error {
+	if nodeType != "center" && nodeType != "leaf" {
+		return fmt.Errorf("invalid node type %q", nodeType)
+	}
+	for name, port := range map[string]int{"leaf port": c.LeafPort, "cluster port": c.ClusterPort} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid %s %d", name, port)
+		}
+	}
+	if nodeType == "center" && c.LeafPort > 0 && c.LeafPort == c.ClusterPort {
+		return fmt.Errorf("leaf port and cluster port must differ (both %d)", c.LeafPort)
+	}
+	if c.PrimaryURL != "" {
+		switch {
+		case nodeType != "center":
+			return fmt.Errorf("only center nodes can stand by for a primary")
+		case c.Domain == "" || c.PrimaryDomain == "":
+			return fmt.Errorf("a standby center and its primary need JetStream domains")
+		case c.Domain == c.PrimaryDomain:
+			return fmt.Errorf("a standby center's JetStream domain must differ from its primary's (both %q)", c.Domain)
+		}
+	}
+	if c.JetStreamMaxMemory < 0 || c.JetStreamMaxStore < 0 {
+		return fmt.Errorf("JetStream limits must not be negative")
+	}
+	return nil
+}
+
+// serverOptions builds the embedded server options for nodeType from config
+func (c KVConfig) serverOptions(nodeType string) (*server.Options, error) {
+	if err := c.validateEmbedded(nodeType); err != nil {
+		return nil, err
 	}
 
 	opts := &server.Options{
@@ -296,78 +669,101 @@ func (s *kvStore) startEmbeddedServer() error {
 		Port:       -1,                   // Random port for client connections
 		JetStream:  nodeType == "center", // Only center nodes have JetStream
 		ServerName: fmt.Sprintf("%s-%d", nodeType, time.Now().UnixNano()),
-	}
-
-	if s.config.DataDir != "" {
-		opts.StoreDir = s.config.DataDir
-		// Ensure directory exists and is writable
-		if err := ensureDirectory(s.config.DataDir); err != nil {
-			return fmt.Errorf("failed to ensure data directory: %w", err)
-		}
+		Debug:      c.ServerDebug,
+		Trace:      c.ServerTrace,
 	}
 
 	// Configure based on node type
 	if nodeType == "center" {
-		// Center node configuration
-		opts.JetStreamMaxMemory = 64 * 1024 * 1024  // 64MB
-		opts.JetStreamMaxStore = 1024 * 1024 * 1024 // 1GB
-		
-		// Enable debug logging for JetStream issues
-		opts.Debug = false  // Set to true for more verbose logging if needed
-		opts.Trace = false  // Set to true for even more verbose logging if needed
+		opts.StoreDir = c.DataDir
+		opts.JetStreamDomain = c.Domain
+		opts.JetStreamMaxMemory = c.JetStreamMaxMemory
+		if opts.JetStreamMaxMemory == 0 {
+			opts.JetStreamMaxMemory = defaultJetStreamMaxMemory
+		}
+		opts.JetStreamMaxStore = c.JetStreamMaxStore
+		if opts.JetStreamMaxStore == 0 {
+			opts.JetStreamMaxStore = defaultJetStreamMaxStore
+		}
 
-		// Setup leaf node connections
-		if s.config.LeafPort > 0 {
+		// Accept leaf node connections
+		if c.LeafPort > 0 {
 			opts.LeafNode.Host = "0.0.0.0"
-			opts.LeafNode.Port = s.config.LeafPort
+			opts.LeafNode.Port = c.LeafPort
 		}
 
-		// Setup cluster if configured
-		if s.config.ClusterPort > 0 {
+		// Join the cluster. A clustered JetStream server refuses to start
+		// without routes, so a port alone leaves the node standalone.
+		if c.ClusterPort > 0 && len(c.ClusterRoutes) > 0 {
 			opts.Cluster.Host = "0.0.0.0"
-			opts.Cluster.Port = s.config.ClusterPort
+			opts.Cluster.Port = c.ClusterPort
 			opts.Cluster.Name = "presence-cluster"
+			for _, route := range c.ClusterRoutes {
+				u, err := url.Parse(strings.TrimSpace(route))
+				if err != nil || u.Host == "" {
+					return nil, fmt.Errorf("invalid cluster route %q", route)
+				}
+				opts.Routes = append(opts.Routes, u)
+			}
 		}
 
-	} else if nodeType == "leaf" {
-		// Leaf node configuration
-		if s.config.CenterURL != "" {
-			centerURL, err := url.Parse(s.config.CenterURL)
+		// A standby solicits its primary to mirror the presence bucket over
+		if c.PrimaryURL != "" {
+			remote, err := leafRemote(c.PrimaryURL)
 			if err != nil {
-				return fmt.Errorf("invalid center URL: %w", err)
-			}
-			opts.LeafNode.Remotes = []*server.RemoteLeafOpts{
-				{
-					URLs: []*url.URL{centerURL},
-				},
+				return nil, fmt.Errorf("invalid primary URL: %w", err)
 			}
+			remote.DenyImports, remote.DenyExports = kvDenied, kvDenied
+			opts.LeafNode.Remotes = []*server.RemoteLeafOpts{remote}
+		}
+	} else if c.CenterURL != "" {
+		// Leaf nodes solicit a connection to the center, failing over down
+		// the list of centers
+		remote, err := leafRemote(c.CenterURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid center URL: %w", err)
 		}
-		// Leaf nodes don't have JetStream
-		opts.JetStream = false
+		opts.LeafNode.Remotes = []*server.RemoteLeafOpts{remote}
 	}
 
-	// Log important startup params - use simplified opts for actual server
-	fmt.Printf("NATS embedded start: nodeType=%s dataDir=%s host=%s jetstream=%t\n", nodeType, s.config.DataDir, "0.0.0.0", nodeType == "center")
-	
-	// Create server with simplified options - basic embedded server
-	simpleOpts := &server.Options{
-		Host:      "0.0.0.0",
-		Port:      -1,
-		JetStream: nodeType == "center",
-		ServerName: fmt.Sprintf("%s-%d", nodeType, time.Now().UnixNano()),
+	return opts, nil
+}
+
+// startEmbeddedServer starts an embedded NATS server
+func (s *kvStore) startEmbeddedServer() error {
+	// Default to center node if NodeType is not specified
+	nodeType := s.config.NodeType
+	if nodeType == "" {
+		nodeType = "center"
 	}
-	
-	if s.config.DataDir != "" && nodeType == "center" {
-		simpleOpts.StoreDir = s.config.DataDir
-		simpleOpts.JetStreamMaxMemory = 32 * 1024 * 1024  // Reduce to 32MB
-		simpleOpts.JetStreamMaxStore = 256 * 1024 * 1024  // Reduce to 256MB
+
+	opts, err := s.config.serverOptions(nodeType)
+	if err != nil {
+		return err
+	}
+	if opts.StoreDir != "" {
+		// Ensure directory exists and is writable
+		if err := ensureDirectory(opts.StoreDir); err != nil {
+			return fmt.Errorf("failed to ensure data directory: %w", err)
+		}
 	}
 
-	ns, err := server.NewServer(simpleOpts)
+	log := s.logger()
+	if nodeType == "center" && s.config.ClusterPort > 0 && len(s.config.ClusterRoutes) == 0 {
+		log.Warn("NATS cluster port ignored: no cluster routes configured", "cluster_port", s.config.ClusterPort)
+	}
+	log.Info("NATS embedded start", "node_type", nodeType, "data_dir", opts.StoreDir, "host", opts.Host, "jetstream", opts.JetStream,
+		"jetstream_max_memory", opts.JetStreamMaxMemory, "jetstream_max_store", opts.JetStreamMaxStore,
+		"leaf_port", opts.LeafNode.Port, "cluster_port", opts.Cluster.Port)
+
+	ns, err := server.NewServer(opts)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
+	// Forward server logs; debug and trace are only emitted when enabled
+	ns.SetLoggerV2(newServerLogger(log), s.config.ServerDebug, s.config.ServerTrace, false)
+
 	// Start server in background
 	go ns.Start()
 
@@ -387,7 +783,7 @@ func (s *kvStore) startEmbeddedServer() error {
 	}
 
 	// Wait for server to be ready with progress logging
-	fmt.Printf("NATS server starting, waiting up to %v for readiness...\n", timeout)
+	log.Info("NATS server starting", "timeout", timeout)
 	
 	startTime := time.Now()
 	ticker := time.NewTicker(5 * time.Second)
@@ -407,7 +803,7 @@ func (s *kvStore) startEmbeddedServer() error {
 		
 		select {
 		case <-ticker.C:
-			fmt.Printf("NATS server still starting... elapsed: %v, JetStream: %t\n", elapsed.Truncate(time.Second), simpleOpts.JetStream)
+			log.Info("NATS server still starting", "elapsed", elapsed.Truncate(time.Second), "jetstream", opts.JetStream)
 		default:
 		}
 		
@@ -418,7 +814,7 @@ func (s *kvStore) startEmbeddedServer() error {
 
 	// Update config with server URL
 	s.config.ServerURL = ns.ClientURL()
-	fmt.Printf("NATS embedded started: url=%s\n", s.config.ServerURL)
+	log.Info("NATS embedded started", "url", s.config.ServerURL)
 
 	return nil
 }
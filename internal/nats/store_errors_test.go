@@ -2,6 +2,7 @@ package nats
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	js "github.com/nats-io/nats.go/jetstream"
@@ -71,3 +72,25 @@ func TestWatch_ErrorWhenClosed(t *testing.T) {
 		t.Fatalf("expected error when watcher cannot be created")
 	}
 }
+
+func TestNewKVStore_LeafDoesNotDeclareTheBucket(t *testing.T) {
+	center, err := NewKVStore(KVConfig{BucketName: "declared", Embedded: true, DataDir: t.TempDir(), NodeType: "center"})
+	if err != nil {
+		t.Fatalf("center: %v", err)
+	}
+	defer center.Close()
+	c := center.(*kvStore)
+
+	// A leaf only opens existing buckets, e.g. for read-only shadow reads
+	if _, err := NewKVStore(KVConfig{BucketName: "undeclared", NodeType: "leaf", CenterURL: c.config.ServerURL}); err == nil {
+		t.Fatal("expected a leaf to fail on a missing bucket")
+	}
+	if _, err := c.js.KeyValue(context.Background(), "undeclared"); !errors.Is(err, js.ErrBucketNotFound) {
+		t.Fatalf("expected the bucket not created, got %v", err)
+	}
+	leaf, err := NewKVStore(KVConfig{BucketName: "declared", NodeType: "leaf", CenterURL: c.config.ServerURL})
+	if err != nil {
+		t.Fatalf("leaf on an existing bucket: %v", err)
+	}
+	leaf.Close()
+}
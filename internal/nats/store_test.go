@@ -2,6 +2,8 @@ package nats
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -61,6 +63,26 @@ func TestKVStore_SetAndGet(t *testing.T) {
 	}
 }
 
+func TestKVStore_StoresNoDerivedFields(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	presence := models.Presence{UserID: "user1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "node1", TTL: time.Hour, TimeZone: "Europe/Paris"}
+	if err := store.Set(ctx, "user1", presence, time.Hour); err != nil {
+		t.Fatalf("Failed to set presence: %v", err)
+	}
+	kv := store.(*kvStore)
+	entry, err := kv.kv.Get(ctx, kv.presenceKey("user1"))
+	if err != nil {
+		t.Fatalf("Failed to read the stored value: %v", err)
+	}
+	if value := string(entry.Value()); strings.Contains(value, "expires_at") || strings.Contains(value, "local_time") || !strings.Contains(value, "Europe/Paris") {
+		t.Fatalf("expected the value stored without derived fields, got %s", value)
+	}
+}
+
 func TestKVStore_TTLExpiration(t *testing.T) {
 	store, cleanup := setupTestStore(t)
 	defer cleanup()
@@ -237,6 +259,44 @@ func TestKVStore_GetMultiple(t *testing.T) {
 	}
 }
 
+func TestKVStore_GetMultipleConcurrent(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-concurrent", Embedded: true, DataDir: t.TempDir(), ReadConcurrency: 4})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	var userIDs []string
+	for i := range 50 {
+		userID := fmt.Sprintf("user%d", i)
+		userIDs = append(userIDs, userID)
+		if i%5 == 0 {
+			continue // Missing users are skipped
+		}
+		if err := store.Set(ctx, userID, models.Presence{UserID: userID, Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "node1"}, time.Hour); err != nil {
+			t.Fatalf("Failed to set presence for %s: %v", userID, err)
+		}
+	}
+
+	results, err := store.GetMultiple(ctx, userIDs)
+	if err != nil {
+		t.Fatalf("Failed to get multiple presences: %v", err)
+	}
+	if len(results) != 40 {
+		t.Fatalf("Expected 40 results, got %d", len(results))
+	}
+	for userID, p := range results {
+		if p.UserID != userID {
+			t.Fatalf("Expected the presence of %s, got %+v", userID, p)
+		}
+	}
+	if results, err := store.GetMultiple(ctx, nil); err != nil || len(results) != 0 {
+		t.Fatalf("Expected an empty lookup to return nothing, got %v %v", results, err)
+	}
+}
+
 func TestKVStore_Watch(t *testing.T) {
 	store, cleanup := setupTestStore(t)
 	defer cleanup()
@@ -0,0 +1,315 @@
+// Package storetest is the conformance suite every presence store must
+// pass. A store implementation runs it from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) nats.KVStore { return openStore(t) })
+//	}
+//
+// The suite only writes user IDs it generates, so it can run against a
+// shared external store.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+// eventTimeout bounds the wait for a watch event
+const eventTimeout = 5 * time.Second
+
+// Run runs the store contract against stores returned by open. open is
+// called once per subtest; the suite closes each store when the subtest
+// ends.
+func Run(t *testing.T, open func(t *testing.T) nats.KVStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s nats.KVStore)
+	}{
+		{"NotFound", testNotFound},
+		{"RoundTrip", testRoundTrip},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"GetMultiple", testGetMultiple},
+		{"TTL", testTTL},
+		{"WatchOrder", testWatchOrder},
+		{"Revisions", testRevisions},
+		{"ConditionalUpdate", testConditionalUpdate},
+		{"Keys", testKeys},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() {
+				if err := s.Close(); err != nil {
+					t.Logf("close store: %v", err)
+				}
+			})
+			tc.fn(t, s)
+		})
+	}
+}
+
+// userID returns a user ID unique to this test run
+func userID(t *testing.T, suffix string) string {
+	name := strings.NewReplacer("/", "-", " ", "-").Replace(t.Name())
+	return fmt.Sprintf("conformance-%d-%s-%s", time.Now().UnixNano(), name, suffix)
+}
+
+func presence(userID string, status models.PresenceStatus, ttl time.Duration) models.Presence {
+	now := time.Now().UTC()
+	return models.Presence{
+		UserID:    userID,
+		Status:    status,
+		Message:   "conformance",
+		LastSeen:  now,
+		UpdatedAt: now,
+		NodeID:    "conformance",
+		TTL:       ttl,
+		Source:    models.SourceAPI,
+	}
+}
+
+func set(t *testing.T, s nats.KVStore, p models.Presence) {
+	t.Helper()
+	if err := s.Set(context.Background(), p.UserID, p, p.TTL); err != nil {
+		t.Fatalf("Set(%s): %v", p.UserID, err)
+	}
+}
+
+// testNotFound: reads of absent users fail with a not-found error, and
+// deleting one is not an error
+func testNotFound(t *testing.T, s nats.KVStore) {
+	id := userID(t, "absent")
+	if _, err := s.Get(context.Background(), id); !apperrors.IsNotFound(err) {
+		t.Fatalf("Get of an absent user: expected a not-found error, got %v", err)
+	}
+	if err := s.Delete(context.Background(), id); err != nil {
+		t.Fatalf("Delete of an absent user: %v", err)
+	}
+}
+
+// testRoundTrip: a stored presence reads back unchanged
+func testRoundTrip(t *testing.T, s nats.KVStore) {
+	want := presence(userID(t, "u"), models.StatusBusy, time.Hour)
+	set(t, s, want)
+	got, err := s.Get(context.Background(), want.UserID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.UserID != want.UserID || got.Status != want.Status || got.Message != want.Message ||
+		got.NodeID != want.NodeID || got.Source != want.Source || got.TTL != want.TTL ||
+		!got.UpdatedAt.Equal(want.UpdatedAt) || !got.LastSeen.Equal(want.LastSeen) {
+		t.Fatalf("read back %+v, want %+v", got, want)
+	}
+}
+
+// testOverwrite: the latest write wins
+func testOverwrite(t *testing.T, s nats.KVStore) {
+	p := presence(userID(t, "u"), models.StatusOnline, time.Hour)
+	set(t, s, p)
+	p.Status, p.Message = models.StatusAway, "later"
+	set(t, s, p)
+	got, err := s.Get(context.Background(), p.UserID)
+	if err != nil || got.Status != models.StatusAway || got.Message != "later" {
+		t.Fatalf("expected the second write, got %+v (%v)", got, err)
+	}
+}
+
+// testDelete: a deleted user reads as not found
+func testDelete(t *testing.T, s nats.KVStore) {
+	p := presence(userID(t, "u"), models.StatusOnline, time.Hour)
+	set(t, s, p)
+	if err := s.Delete(context.Background(), p.UserID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(context.Background(), p.UserID); !apperrors.IsNotFound(err) {
+		t.Fatalf("Get after Delete: expected a not-found error, got %v", err)
+	}
+}
+
+// testGetMultiple: absent users are left out rather than failing the read,
+// and an empty read succeeds (it serves as the readiness probe)
+func testGetMultiple(t *testing.T, s nats.KVStore) {
+	a := presence(userID(t, "a"), models.StatusOnline, time.Hour)
+	b := presence(userID(t, "b"), models.StatusBusy, time.Hour)
+	set(t, s, a)
+	set(t, s, b)
+	absent := userID(t, "absent")
+	got, err := s.GetMultiple(context.Background(), []string{a.UserID, absent, b.UserID})
+	if err != nil {
+		t.Fatalf("GetMultiple: %v", err)
+	}
+	if len(got) != 2 || got[a.UserID].Status != a.Status || got[b.UserID].Status != b.Status {
+		t.Fatalf("expected a and b only, got %v", got)
+	}
+	if got, err := s.GetMultiple(context.Background(), nil); err != nil || len(got) != 0 {
+		t.Fatalf("empty GetMultiple: got %v (%v)", got, err)
+	}
+}
+
+// testTTL: once its TTL has passed, a presence either reads as not found or
+// reads back expired. Stores may evict expired entries but need not.
+func testTTL(t *testing.T, s nats.KVStore) {
+	ttl := 200 * time.Millisecond
+	p := presence(userID(t, "u"), models.StatusOnline, ttl)
+	set(t, s, p)
+	got, err := s.Get(context.Background(), p.UserID)
+	if err != nil || got.IsExpired() {
+		t.Fatalf("expected a live presence right after Set, got %+v (%v)", got, err)
+	}
+	time.Sleep(ttl + 100*time.Millisecond)
+	got, err = s.Get(context.Background(), p.UserID)
+	switch {
+	case apperrors.IsNotFound(err):
+	case err != nil:
+		t.Fatalf("Get after TTL: %v", err)
+	case !got.IsExpired():
+		t.Fatalf("expected the presence to be expired or gone after its TTL, got %+v", got)
+	}
+}
+
+// testWatchOrder: changes made after Watch returns are delivered, each key's
+// in the order they were made with increasing revisions, deletes included
+func testWatchOrder(t *testing.T, s nats.KVStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	id := userID(t, "u")
+	key := "user." + id
+
+	var mu sync.Mutex
+	var events []nats.WatchEvent
+	arrived := make(chan struct{}, 1)
+	err := s.Watch(ctx, func(ev nats.WatchEvent) {
+		if ev.Key != key {
+			return
+		}
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	statuses := []models.PresenceStatus{models.StatusOnline, models.StatusAway, models.StatusBusy, models.StatusOnline}
+	for _, st := range statuses {
+		set(t, s, presence(id, st, time.Hour))
+	}
+	if err := s.Delete(context.Background(), id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	want := len(statuses) + 1
+	deadline := time.After(eventTimeout)
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n >= want {
+			break
+		}
+		select {
+		case <-arrived:
+		case <-deadline:
+			t.Fatalf("expected %d watch events for %s, got %d", want, key, n)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, ev := range events[:want] {
+		if i > 0 && ev.Revision <= events[i-1].Revision {
+			t.Errorf("event %d: revision %d does not follow %d", i, ev.Revision, events[i-1].Revision)
+		}
+		if i < len(statuses) {
+			if ev.Type != nats.WatchEventPut || ev.Presence == nil || ev.Presence.Status != statuses[i] {
+				t.Errorf("event %d: expected PUT %s, got %s %+v", i, statuses[i], ev.Type, ev.Presence)
+			}
+		} else if ev.Type != nats.WatchEventDelete {
+			t.Errorf("event %d: expected DELETE, got %s", i, ev.Type)
+		}
+	}
+}
+
+// testRevisions: stores reporting write revisions report the revision reads
+// return, increasing with each write
+func testRevisions(t *testing.T, s nats.KVStore) {
+	rs, ok := s.(nats.RevisionSetter)
+	if !ok {
+		t.Skip("store does not report write revisions")
+	}
+	p := presence(userID(t, "u"), models.StatusOnline, time.Hour)
+	first, err := rs.SetWithRevision(context.Background(), p.UserID, p, p.TTL)
+	if err != nil {
+		t.Fatalf("SetWithRevision: %v", err)
+	}
+	second, err := rs.SetWithRevision(context.Background(), p.UserID, p, p.TTL)
+	if err != nil {
+		t.Fatalf("SetWithRevision: %v", err)
+	}
+	got, err := s.Get(context.Background(), p.UserID)
+	if err != nil || second <= first || got.Revision != second {
+		t.Fatalf("expected revisions %d < %d read back as %d (%v)", first, second, got.Revision, err)
+	}
+}
+
+// testConditionalUpdate: stores offering conditional writes apply them at
+// the current revision only
+func testConditionalUpdate(t *testing.T, s nats.KVStore) {
+	ru, ok := s.(nats.RevisionUpdater)
+	if !ok {
+		t.Skip("store does not offer conditional writes")
+	}
+	p := presence(userID(t, "u"), models.StatusOnline, time.Hour)
+	set(t, s, p)
+	current, err := s.Get(context.Background(), p.UserID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	p.Status = models.StatusAway
+	rev, err := ru.UpdateAtRevision(context.Background(), p.UserID, p, p.TTL, current.Revision)
+	if err != nil {
+		t.Fatalf("UpdateAtRevision at the current revision: %v", err)
+	}
+	p.Status = models.StatusBusy
+	if _, err := ru.UpdateAtRevision(context.Background(), p.UserID, p, p.TTL, current.Revision); !errors.Is(err, nats.ErrRevisionMismatch) {
+		t.Fatalf("UpdateAtRevision at an old revision: expected ErrRevisionMismatch, got %v", err)
+	}
+	got, err := s.Get(context.Background(), p.UserID)
+	if err != nil || got.Status != models.StatusAway || got.Revision != rev {
+		t.Fatalf("expected the first update at revision %d, got %+v (%v)", rev, got, err)
+	}
+}
+
+// testKeys: stores listing keys include every stored user
+func testKeys(t *testing.T, s nats.KVStore) {
+	kl, ok := s.(nats.KeyLister)
+	if !ok {
+		t.Skip("store does not list keys")
+	}
+	p := presence(userID(t, "u"), models.StatusOnline, time.Hour)
+	set(t, s, p)
+	ids, err := kl.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	for _, id := range ids {
+		if id == p.UserID {
+			return
+		}
+	}
+	t.Fatalf("expected Keys to include %s", p.UserID)
+}
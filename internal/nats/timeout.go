@@ -0,0 +1,70 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	apperrors "gopresence/internal/errors"
+)
+
+// TimeoutError reports a KV operation that ran past its deadline, either the
+// store's per-operation timeout or the caller's context
+type TimeoutError struct {
+	Op  string
+	Err error
+}
+
+func (e *TimeoutError) Error() string { return fmt.Sprintf("kv %s timed out: %v", e.Op, e.Err) }
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// Timeout reports true, matching the net.Error convention
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Is makes errors.Is(err, apperrors.ErrTimeout) match
+func (e *TimeoutError) Is(target error) bool { return target == apperrors.ErrTimeout }
+
+// IsTimeout reports whether err is or wraps a TimeoutError
+func IsTimeout(err error) bool {
+	var te *TimeoutError
+	return errors.As(err, &te)
+}
+
+// IsUnavailable reports whether err means the store couldn't be reached, as
+// opposed to it refusing the operation: a timeout, a closed or disconnected
+// connection, no JetStream responding, or the same on the node serving a
+// proxy
+func IsUnavailable(err error) bool {
+	return IsTimeout(err) || errors.Is(err, ErrProxyUnavailable) ||
+		errors.Is(err, nats.ErrConnectionClosed) ||
+		errors.Is(err, nats.ErrDisconnected) ||
+		errors.Is(err, nats.ErrNoResponders) ||
+		errors.Is(err, jetstream.ErrNoStreamResponse)
+}
+
+// withTimeout derives the context for one KV operation; d <= 0 leaves the
+// caller's deadline as the only bound
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// asTimeout wraps err in a TimeoutError when ctx expired or the client gave up
+func asTimeout(ctx context.Context, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, nats.ErrTimeout) {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestKVStore_OperationTimeouts(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-timeout", Embedded: true, DataDir: t.TempDir(), ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+
+	// A deadline that has already passed stands in for a hung JetStream call
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	if _, err := store.Get(ctx, "u1"); !IsTimeout(err) {
+		t.Fatalf("expected timeout from Get, got %v", err)
+	}
+	if _, err := store.GetMultiple(ctx, []string{"u1", "u2"}); !IsTimeout(err) {
+		t.Fatalf("expected timeout from GetMultiple, got %v", err)
+	}
+	now := time.Now().UTC()
+	err = store.Set(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now}, time.Minute)
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Op != opSet || !te.Timeout() {
+		t.Fatalf("expected set TimeoutError, got %v", err)
+	}
+
+	// Within the deadline a missing key is still just not found
+	if _, err := store.Get(context.Background(), "u1"); err == nil || IsTimeout(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
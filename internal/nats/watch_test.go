@@ -0,0 +1,116 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+func TestKVStore_WatchKeysFiltersUpdates(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-watchkeys", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	kw := store.(KeyWatcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := kw.WatchKeys(ctx, nil, func(WatchEvent) {}); err == nil {
+		t.Fatalf("expected error without filters")
+	}
+	for _, bad := range []string{"user..a", "user.>.a", "user.a b", "user.a*"} {
+		if err := kw.WatchKeys(ctx, []string{bad}, func(WatchEvent) {}); err == nil {
+			t.Fatalf("expected error for filter %q", bad)
+		}
+	}
+
+	events := make(chan WatchEvent, 10)
+	if err := kw.WatchKeys(ctx, []string{"user.alice", "user.bob"}, func(e WatchEvent) { events <- e }); err != nil {
+		t.Fatalf("WatchKeys: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, id := range []string{"carol", "alice", "dave", "bob"} {
+		p := models.Presence{UserID: id, Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1"}
+		if err := store.Set(ctx, id, p, time.Minute); err != nil {
+			t.Fatalf("Set %s: %v", id, err)
+		}
+	}
+	if err := store.Delete(ctx, "carol"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "alice"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	want := []struct {
+		key string
+		typ WatchEventType
+	}{{"user.alice", WatchEventPut}, {"user.bob", WatchEventPut}, {"user.alice", WatchEventDelete}}
+	for _, w := range want {
+		select {
+		case e := <-events:
+			if e.Key != w.key || e.Type != w.typ {
+				t.Fatalf("expected %s %s, got %s %s", w.typ, w.key, e.Type, e.Key)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for %s %s", w.typ, w.key)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event for unwatched key: %+v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestKVStore_RevisionMetadata(t *testing.T) {
+	store, err := NewKVStore(KVConfig{BucketName: "test-presence-revision", Embedded: true, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create test store: %v", err)
+	}
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan WatchEvent, 10)
+	if err := store.Watch(ctx, func(e WatchEvent) { events <- e }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	now := time.Now().UTC()
+	// Stale metadata on the input must not be persisted
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1", Revision: 99}
+	rev1, err := store.(RevisionSetter).SetWithRevision(ctx, "u1", p, time.Minute)
+	if err != nil {
+		t.Fatalf("SetWithRevision: %v", err)
+	}
+	rev2, err := store.(RevisionSetter).SetWithRevision(ctx, "u1", p, time.Minute)
+	if err != nil || rev2 <= rev1 {
+		t.Fatalf("expected increasing revisions, got %d then %d (%v)", rev1, rev2, err)
+	}
+
+	got, err := store.Get(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Revision != rev2 || got.StoredAt.IsZero() || got.StoredAt.Before(now.Add(-time.Second)) {
+		t.Fatalf("expected revision %d with store time, got %d at %v", rev2, got.Revision, got.StoredAt)
+	}
+
+	if err := store.Delete(ctx, "u1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	for _, want := range []uint64{rev1, rev2} {
+		e := <-events
+		if e.Revision != want || e.Presence == nil || e.Presence.Revision != want || e.Presence.StoredAt.IsZero() {
+			t.Fatalf("expected put at revision %d, got %+v", want, e)
+		}
+	}
+	if e := <-events; e.Type != WatchEventDelete || e.Revision <= rev2 {
+		t.Fatalf("expected delete after revision %d, got %+v", rev2, e)
+	}
+}
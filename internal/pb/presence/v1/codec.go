@@ -0,0 +1,20 @@
+package presencev1
+
+import (
+	"mime"
+	"strings"
+)
+
+// ContentTypeProtobuf is the media type of the binary codec option: REST
+// clients sending it in Accept receive a serialized PresenceResponse
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// WantsProtobuf reports whether an Accept header asks for the binary codec
+func WantsProtobuf(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == ContentTypeProtobuf {
+			return true
+		}
+	}
+	return false
+}
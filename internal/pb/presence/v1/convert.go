@@ -0,0 +1,129 @@
+package presencev1
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+// FromModel converts a models.Presence to its protobuf representation
+func FromModel(p models.Presence) *Presence {
+	out := &Presence{
+		UserId:    p.UserID,
+		Status:    string(p.Status),
+		Message:   p.Message,
+		LastSeen:  timestamppb.New(p.LastSeen),
+		UpdatedAt: timestamppb.New(p.UpdatedAt),
+		NodeId:    p.NodeID,
+		Ttl:       int64(p.TTL),
+		Revision:  p.Revision,
+		Source:    string(p.Source),
+	}
+	if !p.StoredAt.IsZero() {
+		out.StoredAt = timestamppb.New(p.StoredAt)
+	}
+	if exp := p.ExpiresAt(); !exp.IsZero() {
+		out.ExpiresAt = timestamppb.New(exp)
+	}
+	out.Client = FromClientInfo(p.Client)
+	out.TimeZone = p.TimeZone
+	out.LocalTime = p.LocalTime(time.Now())
+	out.Annotations = p.Annotations
+	out.CorrelationId = p.CorrelationID
+	return out
+}
+
+// FromClientInfo converts optional client info to its protobuf representation
+func FromClientInfo(c *models.ClientInfo) *ClientInfo {
+	if c == nil {
+		return nil
+	}
+	return &ClientInfo{AppVersion: c.AppVersion, Platform: c.Platform, Capabilities: c.Capabilities}
+}
+
+// ToClientInfo converts optional protobuf client info to models.ClientInfo
+func ToClientInfo(c *ClientInfo) *models.ClientInfo {
+	if c == nil {
+		return nil
+	}
+	return &models.ClientInfo{AppVersion: c.GetAppVersion(), Platform: c.GetPlatform(), Capabilities: c.GetCapabilities()}
+}
+
+// ToModel converts a protobuf Presence to models.Presence
+func ToModel(p *Presence) models.Presence {
+	if p == nil {
+		return models.Presence{}
+	}
+	out := models.Presence{
+		UserID:        p.GetUserId(),
+		Status:        models.PresenceStatus(p.GetStatus()),
+		Message:       p.GetMessage(),
+		NodeID:        p.GetNodeId(),
+		TTL:           time.Duration(p.GetTtl()),
+		Revision:      p.GetRevision(),
+		Source:        models.PresenceSource(p.GetSource()),
+		Client:        ToClientInfo(p.GetClient()),
+		TimeZone:      p.GetTimeZone(),
+		CorrelationID: p.GetCorrelationId(),
+	}
+	if len(p.GetAnnotations()) > 0 {
+		out.Annotations = p.GetAnnotations()
+	}
+	if p.StoredAt != nil {
+		out.StoredAt = p.StoredAt.AsTime()
+	}
+	if p.LastSeen != nil {
+		out.LastSeen = p.LastSeen.AsTime()
+	}
+	if p.UpdatedAt != nil {
+		out.UpdatedAt = p.UpdatedAt.AsTime()
+	}
+	return out
+}
+
+// FromModelMap converts a map of presences keyed by user ID
+func FromModelMap(m map[string]models.Presence) map[string]*Presence {
+	out := make(map[string]*Presence, len(m))
+	for userID, p := range m {
+		out[userID] = FromModel(p)
+	}
+	return out
+}
+
+// FromResponse converts a models.PresenceResponse to its protobuf representation
+func FromResponse(r models.PresenceResponse) *PresenceResponse {
+	out := &PresenceResponse{Success: r.Success, Error: r.Error}
+	if len(r.Data) > 0 {
+		out.Data = FromModelMap(r.Data)
+	}
+	return out
+}
+
+// ToResponse converts a protobuf PresenceResponse to models.PresenceResponse
+func ToResponse(r *PresenceResponse) models.PresenceResponse {
+	out := models.PresenceResponse{Success: r.GetSuccess(), Error: r.GetError()}
+	if len(r.GetData()) > 0 {
+		out.Data = make(map[string]models.Presence, len(r.GetData()))
+		for userID, p := range r.GetData() {
+			out.Data[userID] = ToModel(p)
+		}
+	}
+	return out
+}
+
+// FromEvent converts a hub event to its protobuf representation
+func FromEvent(ev events.Event) *PresenceEvent {
+	out := &PresenceEvent{
+		Type:      string(ev.Type),
+		UserId:    ev.UserID,
+		Timestamp: timestamppb.New(ev.Timestamp),
+		Revision:  ev.Revision,
+	}
+	if ev.Presence != nil {
+		out.Presence = FromModel(*ev.Presence)
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package presencev1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+func TestConvert_RoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	in := models.Presence{
+		UserID:        "u1",
+		Status:        models.StatusBusy,
+		Message:       "focus",
+		LastSeen:      now,
+		UpdatedAt:     now,
+		NodeID:        "n1",
+		TTL:           time.Minute,
+		Revision:      42,
+		StoredAt:      now.Add(time.Millisecond),
+		Source:        models.SourceHeartbeat,
+		TimeZone:      "Asia/Tokyo",
+		Annotations:   map[string]string{"pager:on-call": "true"},
+		CorrelationID: "evt-42",
+	}
+	out := ToModel(FromModel(in))
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip mismatch:\n in=%+v\nout=%+v", in, out)
+	}
+	if !reflect.DeepEqual(ToModel(nil), models.Presence{}) {
+		t.Fatal("expected zero presence for nil")
+	}
+	if m := FromModelMap(map[string]models.Presence{"u1": in}); m["u1"].GetUserId() != "u1" {
+		t.Fatalf("unexpected map conversion: %v", m)
+	}
+}
+
+func TestConvert_ExpiresAt(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, UpdatedAt: now, TTL: time.Minute}
+	if got := FromModel(p).GetExpiresAt().AsTime(); !got.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected expires_at %s, got %s", now.Add(time.Minute), got)
+	}
+	p.TTL = 0
+	if got := FromModel(p).GetExpiresAt(); got != nil {
+		t.Fatalf("expected no expires_at without a TTL, got %v", got)
+	}
+}
+
+func TestConvert_ClientInfo(t *testing.T) {
+	in := models.Presence{UserID: "u1", Status: models.StatusOnline, Client: &models.ClientInfo{
+		AppVersion: "2.1.0", Platform: "android", Capabilities: []string{"video-capable"},
+	}}
+	pb := FromModel(in)
+	if pb.GetClient().GetPlatform() != "android" || len(pb.GetClient().GetCapabilities()) != 1 {
+		t.Fatalf("unexpected client info %+v", pb.GetClient())
+	}
+	out := ToModel(pb).Client
+	if out == nil || out.AppVersion != "2.1.0" || out.Platform != "android" || len(out.Capabilities) != 1 || out.Capabilities[0] != "video-capable" {
+		t.Fatalf("round trip mismatch: %+v", out)
+	}
+	if FromModel(models.Presence{}).Client != nil || ToModel(&Presence{}).Client != nil {
+		t.Fatal("expected no client info when none was reported")
+	}
+}
+
+func TestConvert_ResponseAndEvent(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, UpdatedAt: now, LastSeen: now, NodeID: "n1"}
+
+	resp := models.PresenceResponse{Success: true, Data: map[string]models.Presence{"u1": p}}
+	if got := ToResponse(FromResponse(resp)); !got.Success || !reflect.DeepEqual(got.Data["u1"], p) {
+		t.Fatalf("response round trip mismatch: %+v", got)
+	}
+	if got := FromResponse(models.PresenceResponse{Error: "boom"}); got.GetData() != nil || got.GetError() != "boom" {
+		t.Fatalf("unexpected error response: %v", got)
+	}
+
+	ev := FromEvent(events.Event{Type: events.EventUpdated, UserID: "u1", Presence: &p, Timestamp: now})
+	if ev.GetType() != "presence.updated" || ev.GetPresence().GetNodeId() != "n1" || !ev.GetTimestamp().AsTime().Equal(now) {
+		t.Fatalf("unexpected event: %v", ev)
+	}
+	if del := FromEvent(events.Event{Type: events.EventDeleted, UserID: "u1", Revision: 7}); del.GetPresence() != nil || del.GetRevision() != 7 {
+		t.Fatalf("expected revision and no presence on delete: %v", del)
+	}
+}
+
+func TestProtoJSON_UsesAPIFieldNames(t *testing.T) {
+	b, err := protojson.Marshal(&Presence{UserId: "u1", NodeId: "n1"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := fields["user_id"]; !ok {
+		t.Fatalf("expected snake_case user_id, got %s", b)
+	}
+	if _, ok := fields["node_id"]; !ok {
+		t.Fatalf("expected snake_case node_id, got %s", b)
+	}
+}
+
+func TestWantsProtobuf(t *testing.T) {
+	cases := map[string]bool{
+		"":                       false,
+		"application/json":       false,
+		"application/x-protobuf": true,
+		"text/html, application/x-protobuf;q=0.9": true,
+	}
+	for accept, want := range cases {
+		if got := WantsProtobuf(accept); got != want {
+			t.Errorf("WantsProtobuf(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: presence/v1/models.proto
+
+package presencev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Presence mirrors models.Presence.
+type Presence struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	UserId    string                 `protobuf:"bytes,1,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	Status    string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Message   string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	LastSeen  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_seen,proto3" json:"last_seen,omitempty"`
+	UpdatedAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=updated_at,proto3" json:"updated_at,omitempty"`
+	NodeId    string                 `protobuf:"bytes,6,opt,name=node_id,proto3" json:"node_id,omitempty"`
+	// TTL in nanoseconds, matching the JSON API.
+	Ttl int64 `protobuf:"varint,7,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// KV entry revision; set on presences read back from the store.
+	Revision uint64 `protobuf:"varint,8,opt,name=revision,proto3" json:"revision,omitempty"`
+	// Server-side time the revision was written.
+	StoredAt *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=stored_at,proto3" json:"stored_at,omitempty"`
+	// Why the presence last changed: "api", "heartbeat", "calendar",
+	// "auto-away", "admin", "connection" or "sync".
+	Source string `protobuf:"bytes,10,opt,name=source,proto3" json:"source,omitempty"`
+	// Client the presence was set from; unset when not reported.
+	Client *ClientInfo `protobuf:"bytes,11,opt,name=client,proto3" json:"client,omitempty"`
+	// When the presence lapses to offline: updated_at plus ttl. Unset without
+	// a TTL.
+	ExpiresAt *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=expires_at,proto3" json:"expires_at,omitempty"`
+	// IANA time zone of the user, e.g. "Europe/Berlin"; empty when not reported.
+	TimeZone string `protobuf:"bytes,13,opt,name=time_zone,proto3" json:"time_zone,omitempty"`
+	// The user's current local time, RFC 3339 at minute precision in
+	// time_zone. Computed when the presence is served.
+	LocalTime string `protobuf:"bytes,14,opt,name=local_time,proto3" json:"local_time,omitempty"`
+	// Annotations attached by trusted services, keyed "<namespace>:<key>".
+	// Read-only: writes can't set them.
+	Annotations map[string]string `protobuf:"bytes,15,rep,name=annotations,proto3" json:"annotations,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Opaque value the client attached to its last write, e.g. its own event
+	// ID, echoed so downstream consumers can reconcile.
+	CorrelationId string `protobuf:"bytes,16,opt,name=correlation_id,proto3" json:"correlation_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Presence) Reset() {
+	*x = Presence{}
+	mi := &file_presence_v1_models_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Presence) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Presence) ProtoMessage() {}
+
+func (x *Presence) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_models_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Presence.ProtoReflect.Descriptor instead.
+func (*Presence) Descriptor() ([]byte, []int) {
+	return file_presence_v1_models_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Presence) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Presence) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Presence) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Presence) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *Presence) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Presence) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *Presence) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *Presence) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *Presence) GetStoredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StoredAt
+	}
+	return nil
+}
+
+func (x *Presence) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Presence) GetClient() *ClientInfo {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *Presence) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *Presence) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+func (x *Presence) GetLocalTime() string {
+	if x != nil {
+		return x.LocalTime
+	}
+	return ""
+}
+
+func (x *Presence) GetAnnotations() map[string]string {
+	if x != nil {
+		return x.Annotations
+	}
+	return nil
+}
+
+func (x *Presence) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+// PresenceResponse mirrors models.PresenceResponse. It is also the body of
+// REST responses negotiated with Accept: application/x-protobuf.
+type PresenceResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Data          map[string]*Presence   `protobuf:"bytes,2,rep,name=data,proto3" json:"data,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PresenceResponse) Reset() {
+	*x = PresenceResponse{}
+	mi := &file_presence_v1_models_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PresenceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PresenceResponse) ProtoMessage() {}
+
+func (x *PresenceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_models_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PresenceResponse.ProtoReflect.Descriptor instead.
+func (*PresenceResponse) Descriptor() ([]byte, []int) {
+	return file_presence_v1_models_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PresenceResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *PresenceResponse) GetData() map[string]*Presence {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *PresenceResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// PresenceEvent mirrors events.Event as published on the event hub.
+type PresenceEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "presence.updated" or "presence.deleted".
+	Type   string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	UserId string `protobuf:"bytes,2,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// Presence after the change. Unset for deletes.
+	Presence  *Presence              `protobuf:"bytes,3,opt,name=presence,proto3" json:"presence,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// KV revision of the change, also set for deletes.
+	Revision      uint64 `protobuf:"varint,5,opt,name=revision,proto3" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PresenceEvent) Reset() {
+	*x = PresenceEvent{}
+	mi := &file_presence_v1_models_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PresenceEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PresenceEvent) ProtoMessage() {}
+
+func (x *PresenceEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_models_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PresenceEvent.ProtoReflect.Descriptor instead.
+func (*PresenceEvent) Descriptor() ([]byte, []int) {
+	return file_presence_v1_models_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PresenceEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *PresenceEvent) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PresenceEvent) GetPresence() *Presence {
+	if x != nil {
+		return x.Presence
+	}
+	return nil
+}
+
+func (x *PresenceEvent) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *PresenceEvent) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+// ClientInfo mirrors models.ClientInfo.
+type ClientInfo struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	AppVersion string                 `protobuf:"bytes,1,opt,name=app_version,proto3" json:"app_version,omitempty"`
+	Platform   string                 `protobuf:"bytes,2,opt,name=platform,proto3" json:"platform,omitempty"`
+	// Features the client supports, e.g. "video-capable".
+	Capabilities  []string `protobuf:"bytes,3,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClientInfo) Reset() {
+	*x = ClientInfo{}
+	mi := &file_presence_v1_models_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientInfo) ProtoMessage() {}
+
+func (x *ClientInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_models_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientInfo.ProtoReflect.Descriptor instead.
+func (*ClientInfo) Descriptor() ([]byte, []int) {
+	return file_presence_v1_models_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ClientInfo) GetAppVersion() string {
+	if x != nil {
+		return x.AppVersion
+	}
+	return ""
+}
+
+func (x *ClientInfo) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ClientInfo) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+var File_presence_v1_models_proto protoreflect.FileDescriptor
+
+const file_presence_v1_models_proto_rawDesc = "" +
+	"\n" +
+	"\x18presence/v1/models.proto\x12\vpresence.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc3\x05\n" +
+	"\bPresence\x12\x18\n" +
+	"\auser_id\x18\x01 \x01(\tR\auser_id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x128\n" +
+	"\tlast_seen\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tlast_seen\x12:\n" +
+	"\n" +
+	"updated_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"updated_at\x12\x18\n" +
+	"\anode_id\x18\x06 \x01(\tR\anode_id\x12\x10\n" +
+	"\x03ttl\x18\a \x01(\x03R\x03ttl\x12\x1a\n" +
+	"\brevision\x18\b \x01(\x04R\brevision\x128\n" +
+	"\tstored_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tstored_at\x12\x16\n" +
+	"\x06source\x18\n" +
+	" \x01(\tR\x06source\x12/\n" +
+	"\x06client\x18\v \x01(\v2\x17.presence.v1.ClientInfoR\x06client\x12:\n" +
+	"\n" +
+	"expires_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"expires_at\x12\x1c\n" +
+	"\ttime_zone\x18\r \x01(\tR\ttime_zone\x12\x1e\n" +
+	"\n" +
+	"local_time\x18\x0e \x01(\tR\n" +
+	"local_time\x12H\n" +
+	"\vannotations\x18\x0f \x03(\v2&.presence.v1.Presence.AnnotationsEntryR\vannotations\x12&\n" +
+	"\x0ecorrelation_id\x18\x10 \x01(\tR\x0ecorrelation_id\x1a>\n" +
+	"\x10AnnotationsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xcf\x01\n" +
+	"\x10PresenceResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12;\n" +
+	"\x04data\x18\x02 \x03(\v2'.presence.v1.PresenceResponse.DataEntryR\x04data\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x1aN\n" +
+	"\tDataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12+\n" +
+	"\x05value\x18\x02 \x01(\v2\x15.presence.v1.PresenceR\x05value:\x028\x01\"\xc6\x01\n" +
+	"\rPresenceEvent\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x18\n" +
+	"\auser_id\x18\x02 \x01(\tR\auser_id\x121\n" +
+	"\bpresence\x18\x03 \x01(\v2\x15.presence.v1.PresenceR\bpresence\x128\n" +
+	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1a\n" +
+	"\brevision\x18\x05 \x01(\x04R\brevision\"n\n" +
+	"\n" +
+	"ClientInfo\x12 \n" +
+	"\vapp_version\x18\x01 \x01(\tR\vapp_version\x12\x1a\n" +
+	"\bplatform\x18\x02 \x01(\tR\bplatform\x12\"\n" +
+	"\fcapabilities\x18\x03 \x03(\tR\fcapabilitiesB/Z-gopresence/internal/pb/presence/v1;presencev1b\x06proto3"
+
+var (
+	file_presence_v1_models_proto_rawDescOnce sync.Once
+	file_presence_v1_models_proto_rawDescData []byte
+)
+
+func file_presence_v1_models_proto_rawDescGZIP() []byte {
+	file_presence_v1_models_proto_rawDescOnce.Do(func() {
+		file_presence_v1_models_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_presence_v1_models_proto_rawDesc), len(file_presence_v1_models_proto_rawDesc)))
+	})
+	return file_presence_v1_models_proto_rawDescData
+}
+
+var file_presence_v1_models_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_presence_v1_models_proto_goTypes = []any{
+	(*Presence)(nil),              // 0: presence.v1.Presence
+	(*PresenceResponse)(nil),      // 1: presence.v1.PresenceResponse
+	(*PresenceEvent)(nil),         // 2: presence.v1.PresenceEvent
+	(*ClientInfo)(nil),            // 3: presence.v1.ClientInfo
+	nil,                           // 4: presence.v1.Presence.AnnotationsEntry
+	nil,                           // 5: presence.v1.PresenceResponse.DataEntry
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
+}
+var file_presence_v1_models_proto_depIdxs = []int32{
+	6,  // 0: presence.v1.Presence.last_seen:type_name -> google.protobuf.Timestamp
+	6,  // 1: presence.v1.Presence.updated_at:type_name -> google.protobuf.Timestamp
+	6,  // 2: presence.v1.Presence.stored_at:type_name -> google.protobuf.Timestamp
+	3,  // 3: presence.v1.Presence.client:type_name -> presence.v1.ClientInfo
+	6,  // 4: presence.v1.Presence.expires_at:type_name -> google.protobuf.Timestamp
+	4,  // 5: presence.v1.Presence.annotations:type_name -> presence.v1.Presence.AnnotationsEntry
+	5,  // 6: presence.v1.PresenceResponse.data:type_name -> presence.v1.PresenceResponse.DataEntry
+	0,  // 7: presence.v1.PresenceEvent.presence:type_name -> presence.v1.Presence
+	6,  // 8: presence.v1.PresenceEvent.timestamp:type_name -> google.protobuf.Timestamp
+	0,  // 9: presence.v1.PresenceResponse.DataEntry.value:type_name -> presence.v1.Presence
+	10, // [10:10] is the sub-list for method output_type
+	10, // [10:10] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_presence_v1_models_proto_init() }
+func file_presence_v1_models_proto_init() {
+	if File_presence_v1_models_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_presence_v1_models_proto_rawDesc), len(file_presence_v1_models_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_presence_v1_models_proto_goTypes,
+		DependencyIndexes: file_presence_v1_models_proto_depIdxs,
+		MessageInfos:      file_presence_v1_models_proto_msgTypes,
+	}.Build()
+	File_presence_v1_models_proto = out.File
+	file_presence_v1_models_proto_goTypes = nil
+	file_presence_v1_models_proto_depIdxs = nil
+}
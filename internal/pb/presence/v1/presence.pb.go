@@ -0,0 +1,513 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: presence/v1/presence.proto
+
+package presencev1
+
+import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PresenceDelta_Type int32
+
+const (
+	PresenceDelta_TYPE_UNSPECIFIED PresenceDelta_Type = 0
+	PresenceDelta_TYPE_UPDATED     PresenceDelta_Type = 1
+	PresenceDelta_TYPE_DELETED     PresenceDelta_Type = 2
+)
+
+// Enum value maps for PresenceDelta_Type.
+var (
+	PresenceDelta_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_UPDATED",
+		2: "TYPE_DELETED",
+	}
+	PresenceDelta_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_UPDATED":     1,
+		"TYPE_DELETED":     2,
+	}
+)
+
+func (x PresenceDelta_Type) Enum() *PresenceDelta_Type {
+	p := new(PresenceDelta_Type)
+	*p = x
+	return p
+}
+
+func (x PresenceDelta_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PresenceDelta_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_presence_v1_presence_proto_enumTypes[0].Descriptor()
+}
+
+func (PresenceDelta_Type) Type() protoreflect.EnumType {
+	return &file_presence_v1_presence_proto_enumTypes[0]
+}
+
+func (x PresenceDelta_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PresenceDelta_Type.Descriptor instead.
+func (PresenceDelta_Type) EnumDescriptor() ([]byte, []int) {
+	return file_presence_v1_presence_proto_rawDescGZIP(), []int{4, 0}
+}
+
+type GetPresenceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPresenceRequest) Reset() {
+	*x = GetPresenceRequest{}
+	mi := &file_presence_v1_presence_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPresenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPresenceRequest) ProtoMessage() {}
+
+func (x *GetPresenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_presence_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPresenceRequest.ProtoReflect.Descriptor instead.
+func (*GetPresenceRequest) Descriptor() ([]byte, []int) {
+	return file_presence_v1_presence_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetPresenceRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type SetPresenceRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	UserId  string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Status  string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Message string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	// TTL in seconds.
+	Ttl int64 `protobuf:"varint,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// Client the presence is set from, if reported.
+	Client *ClientInfo `protobuf:"bytes,5,opt,name=client,proto3" json:"client,omitempty"`
+	// IANA time zone of the user, e.g. "Europe/Berlin", if reported.
+	TimeZone string `protobuf:"bytes,6,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	// Opaque value stored with the presence and echoed in its events, e.g. the
+	// client's own event ID.
+	CorrelationId string `protobuf:"bytes,7,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPresenceRequest) Reset() {
+	*x = SetPresenceRequest{}
+	mi := &file_presence_v1_presence_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPresenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPresenceRequest) ProtoMessage() {}
+
+func (x *SetPresenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_presence_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPresenceRequest.ProtoReflect.Descriptor instead.
+func (*SetPresenceRequest) Descriptor() ([]byte, []int) {
+	return file_presence_v1_presence_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SetPresenceRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SetPresenceRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SetPresenceRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *SetPresenceRequest) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *SetPresenceRequest) GetClient() *ClientInfo {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *SetPresenceRequest) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+func (x *SetPresenceRequest) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+type GetMultiplePresencesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserIds       []string               `protobuf:"bytes,1,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMultiplePresencesRequest) Reset() {
+	*x = GetMultiplePresencesRequest{}
+	mi := &file_presence_v1_presence_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMultiplePresencesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMultiplePresencesRequest) ProtoMessage() {}
+
+func (x *GetMultiplePresencesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_presence_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMultiplePresencesRequest.ProtoReflect.Descriptor instead.
+func (*GetMultiplePresencesRequest) Descriptor() ([]byte, []int) {
+	return file_presence_v1_presence_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetMultiplePresencesRequest) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+type WatchPresenceRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Users to watch. Empty watches every user.
+	UserIds []string `protobuf:"bytes,1,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	// Presence fields to include in deltas. Empty includes all fields.
+	FieldMask     *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=field_mask,json=fieldMask,proto3" json:"field_mask,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchPresenceRequest) Reset() {
+	*x = WatchPresenceRequest{}
+	mi := &file_presence_v1_presence_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchPresenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchPresenceRequest) ProtoMessage() {}
+
+func (x *WatchPresenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_presence_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchPresenceRequest.ProtoReflect.Descriptor instead.
+func (*WatchPresenceRequest) Descriptor() ([]byte, []int) {
+	return file_presence_v1_presence_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *WatchPresenceRequest) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+func (x *WatchPresenceRequest) GetFieldMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.FieldMask
+	}
+	return nil
+}
+
+// PresenceDelta is a single change delivered on a WatchPresence stream.
+type PresenceDelta struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Monotonic per-stream sequence number, starting at 1.
+	Sequence uint64             `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Type     PresenceDelta_Type `protobuf:"varint,2,opt,name=type,proto3,enum=presence.v1.PresenceDelta_Type" json:"type,omitempty"`
+	UserId   string             `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Presence after the change, restricted to the requested field mask. Unset for deletes.
+	Presence  *Presence              `protobuf:"bytes,4,opt,name=presence,proto3" json:"presence,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// KV revision of the change, also set for deletes.
+	Revision      uint64 `protobuf:"varint,6,opt,name=revision,proto3" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PresenceDelta) Reset() {
+	*x = PresenceDelta{}
+	mi := &file_presence_v1_presence_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PresenceDelta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PresenceDelta) ProtoMessage() {}
+
+func (x *PresenceDelta) ProtoReflect() protoreflect.Message {
+	mi := &file_presence_v1_presence_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PresenceDelta.ProtoReflect.Descriptor instead.
+func (*PresenceDelta) Descriptor() ([]byte, []int) {
+	return file_presence_v1_presence_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PresenceDelta) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *PresenceDelta) GetType() PresenceDelta_Type {
+	if x != nil {
+		return x.Type
+	}
+	return PresenceDelta_TYPE_UNSPECIFIED
+}
+
+func (x *PresenceDelta) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PresenceDelta) GetPresence() *Presence {
+	if x != nil {
+		return x.Presence
+	}
+	return nil
+}
+
+func (x *PresenceDelta) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *PresenceDelta) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+var File_presence_v1_presence_proto protoreflect.FileDescriptor
+
+const file_presence_v1_presence_proto_rawDesc = "" +
+	"\n" +
+	"\x1apresence/v1/presence.proto\x12\vpresence.v1\x1a\x1cgoogle/api/annotations.proto\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x18presence/v1/models.proto\"-\n" +
+	"\x12GetPresenceRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"\xe6\x01\n" +
+	"\x12SetPresenceRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x10\n" +
+	"\x03ttl\x18\x04 \x01(\x03R\x03ttl\x12/\n" +
+	"\x06client\x18\x05 \x01(\v2\x17.presence.v1.ClientInfoR\x06client\x12\x1b\n" +
+	"\ttime_zone\x18\x06 \x01(\tR\btimeZone\x12%\n" +
+	"\x0ecorrelation_id\x18\a \x01(\tR\rcorrelationId\"8\n" +
+	"\x1bGetMultiplePresencesRequest\x12\x19\n" +
+	"\buser_ids\x18\x01 \x03(\tR\auserIds\"l\n" +
+	"\x14WatchPresenceRequest\x12\x19\n" +
+	"\buser_ids\x18\x01 \x03(\tR\auserIds\x129\n" +
+	"\n" +
+	"field_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\tfieldMask\"\xc4\x02\n" +
+	"\rPresenceDelta\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x123\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x1f.presence.v1.PresenceDelta.TypeR\x04type\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x121\n" +
+	"\bpresence\x18\x04 \x01(\v2\x15.presence.v1.PresenceR\bpresence\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1a\n" +
+	"\brevision\x18\x06 \x01(\x04R\brevision\"@\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fTYPE_UPDATED\x10\x01\x12\x10\n" +
+	"\fTYPE_DELETED\x10\x022\xe5\x03\n" +
+	"\x0fPresenceService\x12q\n" +
+	"\vGetPresence\x12\x1f.presence.v1.GetPresenceRequest\x1a\x1d.presence.v1.PresenceResponse\"\"\x82\xd3\xe4\x93\x02\x1c\x12\x1a/api/v2/presence/{user_id}\x12t\n" +
+	"\vSetPresence\x12\x1f.presence.v1.SetPresenceRequest\x1a\x1d.presence.v1.PresenceResponse\"%\x82\xd3\xe4\x93\x02\x1f:\x01*\x1a\x1a/api/v2/presence/{user_id}\x12\x96\x01\n" +
+	"\x14GetMultiplePresences\x12(.presence.v1.GetMultiplePresencesRequest\x1a\x1d.presence.v1.PresenceResponse\"5\x82\xd3\xe4\x93\x02/Z\x1b:\x01*\"\x16/api/v2/presence/batch\x12\x10/api/v2/presence\x12P\n" +
+	"\rWatchPresence\x12!.presence.v1.WatchPresenceRequest\x1a\x1a.presence.v1.PresenceDelta0\x01B/Z-gopresence/internal/pb/presence/v1;presencev1b\x06proto3"
+
+var (
+	file_presence_v1_presence_proto_rawDescOnce sync.Once
+	file_presence_v1_presence_proto_rawDescData []byte
+)
+
+func file_presence_v1_presence_proto_rawDescGZIP() []byte {
+	file_presence_v1_presence_proto_rawDescOnce.Do(func() {
+		file_presence_v1_presence_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_presence_v1_presence_proto_rawDesc), len(file_presence_v1_presence_proto_rawDesc)))
+	})
+	return file_presence_v1_presence_proto_rawDescData
+}
+
+var file_presence_v1_presence_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_presence_v1_presence_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_presence_v1_presence_proto_goTypes = []any{
+	(PresenceDelta_Type)(0),             // 0: presence.v1.PresenceDelta.Type
+	(*GetPresenceRequest)(nil),          // 1: presence.v1.GetPresenceRequest
+	(*SetPresenceRequest)(nil),          // 2: presence.v1.SetPresenceRequest
+	(*GetMultiplePresencesRequest)(nil), // 3: presence.v1.GetMultiplePresencesRequest
+	(*WatchPresenceRequest)(nil),        // 4: presence.v1.WatchPresenceRequest
+	(*PresenceDelta)(nil),               // 5: presence.v1.PresenceDelta
+	(*ClientInfo)(nil),                  // 6: presence.v1.ClientInfo
+	(*fieldmaskpb.FieldMask)(nil),       // 7: google.protobuf.FieldMask
+	(*Presence)(nil),                    // 8: presence.v1.Presence
+	(*timestamppb.Timestamp)(nil),       // 9: google.protobuf.Timestamp
+	(*PresenceResponse)(nil),            // 10: presence.v1.PresenceResponse
+}
+var file_presence_v1_presence_proto_depIdxs = []int32{
+	6,  // 0: presence.v1.SetPresenceRequest.client:type_name -> presence.v1.ClientInfo
+	7,  // 1: presence.v1.WatchPresenceRequest.field_mask:type_name -> google.protobuf.FieldMask
+	0,  // 2: presence.v1.PresenceDelta.type:type_name -> presence.v1.PresenceDelta.Type
+	8,  // 3: presence.v1.PresenceDelta.presence:type_name -> presence.v1.Presence
+	9,  // 4: presence.v1.PresenceDelta.timestamp:type_name -> google.protobuf.Timestamp
+	1,  // 5: presence.v1.PresenceService.GetPresence:input_type -> presence.v1.GetPresenceRequest
+	2,  // 6: presence.v1.PresenceService.SetPresence:input_type -> presence.v1.SetPresenceRequest
+	3,  // 7: presence.v1.PresenceService.GetMultiplePresences:input_type -> presence.v1.GetMultiplePresencesRequest
+	4,  // 8: presence.v1.PresenceService.WatchPresence:input_type -> presence.v1.WatchPresenceRequest
+	10, // 9: presence.v1.PresenceService.GetPresence:output_type -> presence.v1.PresenceResponse
+	10, // 10: presence.v1.PresenceService.SetPresence:output_type -> presence.v1.PresenceResponse
+	10, // 11: presence.v1.PresenceService.GetMultiplePresences:output_type -> presence.v1.PresenceResponse
+	5,  // 12: presence.v1.PresenceService.WatchPresence:output_type -> presence.v1.PresenceDelta
+	9,  // [9:13] is the sub-list for method output_type
+	5,  // [5:9] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_presence_v1_presence_proto_init() }
+func file_presence_v1_presence_proto_init() {
+	if File_presence_v1_presence_proto != nil {
+		return
+	}
+	file_presence_v1_models_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_presence_v1_presence_proto_rawDesc), len(file_presence_v1_presence_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_presence_v1_presence_proto_goTypes,
+		DependencyIndexes: file_presence_v1_presence_proto_depIdxs,
+		EnumInfos:         file_presence_v1_presence_proto_enumTypes,
+		MessageInfos:      file_presence_v1_presence_proto_msgTypes,
+	}.Build()
+	File_presence_v1_presence_proto = out.File
+	file_presence_v1_presence_proto_goTypes = nil
+	file_presence_v1_presence_proto_depIdxs = nil
+}
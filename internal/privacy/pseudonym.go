@@ -0,0 +1,43 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Pseudonymizer maps user IDs to keyed HMAC-SHA256 pseudonyms.
+// The key is only known to the API layer, so the KV bucket and any events
+// derived from it never contain directly identifying user IDs.
+type Pseudonymizer struct {
+	key []byte
+}
+
+// NewPseudonymizer creates a new Pseudonymizer with the given secret key
+func NewPseudonymizer(key string) (*Pseudonymizer, error) {
+	if key == "" {
+		return nil, errors.New("pseudonym key is required")
+	}
+	return &Pseudonymizer{key: []byte(key)}, nil
+}
+
+// Pseudonymize returns the stable pseudonym for a user ID
+func (p *Pseudonymizer) Pseudonymize(userID string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// PseudonymizeAll returns pseudonyms for the given user IDs along with a
+// reverse mapping from pseudonym back to the original user ID
+func (p *Pseudonymizer) PseudonymizeAll(userIDs []string) ([]string, map[string]string) {
+	ids := make([]string, 0, len(userIDs))
+	reverse := make(map[string]string, len(userIDs))
+	for _, userID := range userIDs {
+		pseudonym := p.Pseudonymize(userID)
+		ids = append(ids, pseudonym)
+		reverse[pseudonym] = userID
+	}
+	return ids, reverse
+}
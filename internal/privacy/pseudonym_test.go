@@ -0,0 +1,42 @@
+package privacy
+
+import "testing"
+
+func TestNewPseudonymizer_RequiresKey(t *testing.T) {
+	if _, err := NewPseudonymizer(""); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+}
+
+func TestPseudonymize_StableAndKeyed(t *testing.T) {
+	p1, _ := NewPseudonymizer("k1")
+	p2, _ := NewPseudonymizer("k2")
+
+	a := p1.Pseudonymize("alice")
+	if a != p1.Pseudonymize("alice") {
+		t.Fatal("expected stable pseudonym for same key and user")
+	}
+	if a == "alice" {
+		t.Fatal("pseudonym must not equal the user ID")
+	}
+	if a == p1.Pseudonymize("bob") {
+		t.Fatal("expected different pseudonyms for different users")
+	}
+	if a == p2.Pseudonymize("alice") {
+		t.Fatal("expected different pseudonyms for different keys")
+	}
+	if len(a) != 64 {
+		t.Fatalf("expected 64 hex chars, got %d", len(a))
+	}
+}
+
+func TestPseudonymizeAll_ReverseMapping(t *testing.T) {
+	p, _ := NewPseudonymizer("k")
+	ids, reverse := p.PseudonymizeAll([]string{"u1", "u2"})
+	if len(ids) != 2 || len(reverse) != 2 {
+		t.Fatalf("unexpected sizes: %d ids, %d reverse", len(ids), len(reverse))
+	}
+	if reverse[ids[0]] != "u1" || reverse[ids[1]] != "u2" {
+		t.Fatalf("reverse mapping mismatch: %v", reverse)
+	}
+}
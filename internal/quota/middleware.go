@@ -0,0 +1,57 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/i18n"
+	"gopresence/internal/metrics"
+)
+
+// CodeQuotaExceeded is the error code of requests rejected for quota, so
+// callers can tell them apart from other 429s
+const CodeQuotaExceeded = "quota_exceeded"
+
+// Middleware counts requests to route against the caller's tenant and
+// answers 429 with code quota_exceeded once a quota is used up. It must run
+// inside the authentication middleware; anonymous requests are not counted.
+func (t *Tracker) Middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := auth.GetTenantFromContext(r.Context())
+		if tenant == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var exceeded *ExceededError
+		if err := t.Consume(tenant, route); errors.As(err, &exceeded) {
+			metrics.ObserveQuotaRejection(route, exceeded.Scope)
+			writeExceeded(w, r, exceeded, t.now())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeExceeded(w http.ResponseWriter, r *http.Request, e *ExceededError, now time.Time) {
+	retry := int64(e.ResetAt.Sub(now) / time.Second)
+	if retry < 1 {
+		retry = 1
+	}
+	// Messages are keyed by scope, e.g. quota_exceeded.monthly
+	message := i18n.Localize(w, r, CodeQuotaExceeded+"."+e.Scope, e.Limit, e.Route)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  false,
+		"error":    message,
+		"code":     CodeQuotaExceeded,
+		"scope":    e.Scope,
+		"limit":    e.Limit,
+		"reset_at": e.ResetAt,
+	})
+}
@@ -0,0 +1,262 @@
+// Package quota accounts requests per tenant and route against daily and
+// monthly quotas. Counts accumulate in memory and are flushed periodically
+// to counters shared by every node, so a request never waits on the store;
+// a tenant can overshoot a quota by what the fleet serves between flushes.
+package quota
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists usage counters shared by every node; *nats.Counters
+// implements it
+type Store interface {
+	Add(ctx context.Context, key string, delta int64) (int64, error)
+	List(ctx context.Context, filter string) (map[string]int64, error)
+}
+
+// Limits are request quotas per tenant; zero means unlimited
+type Limits struct {
+	Daily      int64            // Requests per UTC day across routes
+	Monthly    int64            // Requests per UTC month across routes
+	RouteDaily map[string]int64 // Requests per UTC day on one route
+}
+
+// Quota scopes, as reported in ExceededError
+const (
+	ScopeDaily   = "daily"
+	ScopeMonthly = "monthly"
+	ScopeRoute   = "route_daily"
+)
+
+// ExceededError reports a request rejected because a quota is used up
+type ExceededError struct {
+	Tenant  string
+	Scope   string // ScopeDaily, ScopeMonthly or ScopeRoute
+	Route   string // Set for ScopeRoute
+	Limit   int64
+	ResetAt time.Time // Start of the next period
+}
+
+func (e *ExceededError) Error() string {
+	if e.Scope == ScopeRoute {
+		return fmt.Sprintf("daily quota of %d requests for %s exceeded", e.Limit, e.Route)
+	}
+	return fmt.Sprintf("%s quota of %d requests exceeded", e.Scope, e.Limit)
+}
+
+// Tracker counts requests and enforces Limits
+type Tracker struct {
+	store  Store
+	limits Limits
+	now    func() time.Time
+
+	mu      sync.Mutex
+	known   map[string]int64 // Counter values last read back from the store
+	pending map[string]int64 // Local counts not yet flushed
+}
+
+// NewTracker returns a Tracker persisting counts to store
+func NewTracker(store Store, limits Limits) *Tracker {
+	return &Tracker{
+		store:   store,
+		limits:  limits,
+		now:     time.Now,
+		known:   map[string]int64{},
+		pending: map[string]int64{},
+	}
+}
+
+// Consume counts one request by tenant on route, or returns an
+// *ExceededError without counting it if one of the tenant's quotas is used up
+func (t *Tracker) Consume(tenant, route string) error {
+	now := t.now().UTC()
+	day, month := dayPeriod(now), monthPeriod(now)
+	keys := []string{
+		totalKey(tenant, day), totalKey(tenant, month),
+		routeKey(tenant, day, route), routeKey(tenant, month, route),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	checks := []struct {
+		key, scope string
+		limit      int64
+		resetAt    time.Time
+	}{
+		{keys[0], ScopeDaily, t.limits.Daily, nextDay(now)},
+		{keys[1], ScopeMonthly, t.limits.Monthly, nextMonth(now)},
+		{keys[2], ScopeRoute, t.limits.RouteDaily[route], nextDay(now)},
+	}
+	for _, c := range checks {
+		if c.limit > 0 && t.known[c.key]+t.pending[c.key] >= c.limit {
+			e := &ExceededError{Tenant: tenant, Scope: c.scope, Limit: c.limit, ResetAt: c.resetAt}
+			if c.scope == ScopeRoute {
+				e.Route = route
+			}
+			return e
+		}
+	}
+	for _, key := range keys {
+		t.pending[key]++
+	}
+	return nil
+}
+
+// Flush adds the local counts to the shared counters. Counts that fail to
+// flush are kept for the next attempt.
+func (t *Tracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = map[string]int64{}
+	t.mu.Unlock()
+
+	var firstErr error
+	flushed := make(map[string]int64, len(pending))
+	for key, delta := range pending {
+		v, err := t.store.Add(ctx, key, delta)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to flush quota counter %s: %w", key, err)
+			}
+			t.mu.Lock()
+			t.pending[key] += delta
+			t.mu.Unlock()
+			continue
+		}
+		flushed[key] = v
+	}
+
+	now := t.now().UTC()
+	day, month := dayPeriod(now), monthPeriod(now)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Values read back include this node's flushed counts and every other node's
+	for key, v := range flushed {
+		t.known[key] = v
+	}
+	// Forget counters of periods that have ended
+	for key := range t.known {
+		if p := keyPeriod(key); p != day && p != month {
+			delete(t.known, key)
+		}
+	}
+	return firstErr
+}
+
+// Run flushes every interval until ctx is done, then flushes once more
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := t.Flush(flushCtx); err != nil {
+				log.Printf("quota: final flush: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				log.Printf("quota: %v", err)
+			}
+		}
+	}
+}
+
+// PeriodUsage is a tenant's usage in one day or month
+type PeriodUsage struct {
+	Period string           `json:"period"` // "2006-01-02" or "2006-01"
+	Total  int64            `json:"total"`
+	Limit  int64            `json:"limit,omitempty"` // Zero if unlimited
+	Routes map[string]int64 `json:"routes,omitempty"`
+}
+
+// Usage is a tenant's usage in the day and month containing a date
+type Usage struct {
+	Tenant string      `json:"tenant"`
+	Day    PeriodUsage `json:"day"`
+	Month  PeriodUsage `json:"month"`
+}
+
+// Usage reports tenant's usage on the UTC day of at and in its month, from
+// the shared counters plus this node's unflushed counts
+func (t *Tracker) Usage(ctx context.Context, tenant string, at time.Time) (Usage, error) {
+	at = at.UTC()
+	u := Usage{Tenant: tenant}
+	for _, p := range []struct {
+		out    *PeriodUsage
+		period string
+		label  string
+		limit  int64
+	}{
+		{&u.Day, dayPeriod(at), at.Format("2006-01-02"), t.limits.Daily},
+		{&u.Month, monthPeriod(at), at.Format("2006-01"), t.limits.Monthly},
+	} {
+		prefix := tenantKey(tenant) + "." + p.period + "."
+		counts, err := t.store.List(ctx, prefix+">")
+		if err != nil {
+			return Usage{}, err
+		}
+		t.mu.Lock()
+		for key, n := range t.pending {
+			if strings.HasPrefix(key, prefix) {
+				counts[key] += n
+			}
+		}
+		t.mu.Unlock()
+
+		*p.out = PeriodUsage{Period: p.label, Limit: p.limit, Total: counts[prefix+"total"]}
+		for key, n := range counts {
+			if route, ok := strings.CutPrefix(key, prefix+"route."); ok {
+				if p.out.Routes == nil {
+					p.out.Routes = map[string]int64{}
+				}
+				p.out.Routes[route] = n
+			}
+		}
+	}
+	return u, nil
+}
+
+// Counter keys are "<tenant>.<period>.total" and
+// "<tenant>.<period>.route.<route>". Tenants are base64url-encoded to fit
+// the KV key alphabet; periods are "dYYYYMMDD" or "mYYYYMM".
+
+func tenantKey(tenant string) string {
+	return "t" + base64.RawURLEncoding.EncodeToString([]byte(tenant))
+}
+
+func totalKey(tenant, period string) string {
+	return tenantKey(tenant) + "." + period + ".total"
+}
+
+func routeKey(tenant, period, route string) string {
+	return tenantKey(tenant) + "." + period + ".route." + route
+}
+
+func keyPeriod(key string) string {
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func dayPeriod(t time.Time) string   { return t.Format("d20060102") }
+func monthPeriod(t time.Time) string { return t.Format("m200601") }
+
+func nextDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
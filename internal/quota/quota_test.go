@@ -0,0 +1,168 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	err    error
+}
+
+func newMemStore() *memStore { return &memStore{counts: map[string]int64{}} }
+
+func (m *memStore) Add(ctx context.Context, key string, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.counts[key] += delta
+	return m.counts[key], nil
+}
+
+func (m *memStore) List(ctx context.Context, filter string) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string]int64{}
+	for k, v := range m.counts {
+		if strings.HasPrefix(k, strings.TrimSuffix(filter, ">")) {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+func newTestTracker(store Store, limits Limits, now time.Time) *Tracker {
+	t := NewTracker(store, limits)
+	t.now = func() time.Time { return now }
+	return t
+}
+
+func TestTracker_EnforcesLimits(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tr := newTestTracker(newMemStore(), Limits{Daily: 3, RouteDaily: map[string]int64{"presence.batch": 1}}, now)
+
+	if err := tr.Consume("acme", "presence.batch"); err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+	var exceeded *ExceededError
+	if err := tr.Consume("acme", "presence.batch"); !errors.As(err, &exceeded) || exceeded.Scope != ScopeRoute || exceeded.Route != "presence.batch" {
+		t.Fatalf("expected route quota error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := tr.Consume("acme", "presence.user"); err != nil {
+			t.Fatalf("user request %d: %v", i, err)
+		}
+	}
+	if err := tr.Consume("acme", "presence.user"); !errors.As(err, &exceeded) || exceeded.Scope != ScopeDaily {
+		t.Fatalf("expected daily quota error, got %v", err)
+	}
+	if !exceeded.ResetAt.Equal(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected reset at next UTC midnight, got %v", exceeded.ResetAt)
+	}
+	// Tenants are accounted separately
+	if err := tr.Consume("other", "presence.user"); err != nil {
+		t.Fatalf("other tenant: %v", err)
+	}
+}
+
+func TestTracker_FlushSharesCountsAcrossNodes(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store := newMemStore()
+	a := newTestTracker(store, Limits{Monthly: 3}, now)
+	b := newTestTracker(store, Limits{Monthly: 3}, now)
+
+	for i := 0; i < 2; i++ {
+		if err := a.Consume("acme", "presence.user"); err != nil {
+			t.Fatalf("node a: %v", err)
+		}
+	}
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatalf("flush a: %v", err)
+	}
+	if err := b.Consume("acme", "presence.multi"); err != nil {
+		t.Fatalf("node b: %v", err)
+	}
+	// b learns a's counts when it flushes its own
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("flush b: %v", err)
+	}
+	if err := b.Consume("acme", "presence.multi"); err == nil {
+		t.Fatal("expected node b to enforce the shared monthly quota")
+	}
+
+	u, err := b.Usage(context.Background(), "acme", now)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if u.Day.Period != "2026-10-16" || u.Day.Total != 3 || u.Month.Period != "2026-10" || u.Month.Total != 3 || u.Month.Limit != 3 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+	if u.Month.Routes["presence.user"] != 2 || u.Month.Routes["presence.multi"] != 1 {
+		t.Fatalf("unexpected route usage %+v", u.Month.Routes)
+	}
+}
+
+func TestTracker_FlushKeepsFailedCounts(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store := newMemStore()
+	tr := newTestTracker(store, Limits{}, now)
+	tr.Consume("acme", "presence.user")
+
+	store.err = errors.New("store down")
+	if err := tr.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+	store.err = nil
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if u, _ := tr.Usage(context.Background(), "acme", now); u.Day.Total != 1 {
+		t.Fatalf("expected the retried count to land once, got %+v", u)
+	}
+}
+
+func TestMiddleware_RejectsOverQuota(t *testing.T) {
+	now := time.Date(2026, 10, 16, 23, 59, 0, 0, time.UTC)
+	tr := newTestTracker(newMemStore(), Limits{Daily: 1}, now)
+	h := tr.Middleware("presence.user", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/presence/u1", nil)
+		if tenant != "" {
+			req = req.WithContext(auth.SetTenantInContext(req.Context(), tenant))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := serve("acme"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	rr := serve("acme")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected 429 with Retry-After 60, got %d %v", rr.Code, rr.Header())
+	}
+	var body map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body["code"] != CodeQuotaExceeded || body["scope"] != ScopeDaily {
+		t.Fatalf("unexpected body %v", body)
+	}
+	// Anonymous requests are not counted
+	if rr := serve(""); rr.Code != http.StatusOK {
+		t.Fatalf("expected anonymous request through, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/i18n"
+	"gopresence/internal/metrics"
+)
+
+// CodeRateLimited is the error code of requests rejected by the limiter, so
+// callers can tell them apart from quota 429s
+const CodeRateLimited = "rate_limited"
+
+// Response headers, set on every limited request
+const (
+	LimitHeader     = "X-RateLimit-Limit"     // Burst of the client's bucket
+	RemainingHeader = "X-RateLimit-Remaining" // Requests left right now
+	ResetHeader     = "X-RateLimit-Reset"     // Seconds until the bucket is full again
+)
+
+// Middleware limits requests to route per client and answers 429 with code
+// rate_limited once a client's bucket is empty. It must run inside the
+// authentication middleware to key authenticated clients by user ID.
+func (l *Limiter) Middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		kind, key := "user", auth.GetUserIDFromContext(r.Context())
+		if key == "" {
+			kind, key = "ip", l.clientIP(r)
+		}
+		d := l.Allow(kind + ":" + key)
+		h := w.Header()
+		h.Set(LimitHeader, strconv.Itoa(d.Limit))
+		h.Set(RemainingHeader, strconv.Itoa(d.Remaining))
+		h.Set(ResetHeader, strconv.FormatInt(seconds(d.Reset), 10))
+		if !d.Allowed {
+			metrics.ObserveRateLimited(route, kind)
+			writeLimited(w, r, d)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP is the address anonymous requests are keyed by
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.trustForwarded {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeLimited(w http.ResponseWriter, r *http.Request, d Decision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.FormatInt(max(seconds(d.RetryAfter), 1), 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   i18n.Localize(w, r, CodeRateLimited),
+		"code":    CodeRateLimited,
+		"limit":   d.Limit,
+	})
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
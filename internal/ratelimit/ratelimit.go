@@ -0,0 +1,128 @@
+// Package ratelimit bounds the request rate of each client with a token
+// bucket, so a misbehaving client's write storm is turned away at the edge
+// instead of reaching NATS. Clients are keyed by their authenticated user ID,
+// or by their IP address when anonymous. Buckets are per node.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits configure the token buckets
+type Limits struct {
+	Rate  float64 // Tokens added per second
+	Burst int     // Bucket size: requests allowed at once after an idle period
+}
+
+// Decision is the outcome of one request
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Burst of the bucket
+	Remaining  int           // Whole tokens left after the request
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next request is allowed; 0 if allowed
+}
+
+// Limiter holds a token bucket per client
+type Limiter struct {
+	limits         Limits
+	trustForwarded bool
+	now            func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Option configures a Limiter
+type Option func(*Limiter)
+
+// WithTrustedProxy keys anonymous clients by the last X-Forwarded-For
+// address, the one the proxy in front of the service saw, instead of the
+// connection's. Only use it behind a proxy that sets the header.
+func WithTrustedProxy() Option {
+	return func(l *Limiter) { l.trustForwarded = true }
+}
+
+// New returns a limiter of limits
+func New(limits Limits, opts ...Option) *Limiter {
+	l := &Limiter{limits: limits, now: time.Now, buckets: map[string]*bucket{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Allow takes a token from key's bucket if it has one
+func (l *Limiter) Allow(key string) Decision {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key, now)
+	d := Decision{Limit: l.limits.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.until(1 - b.tokens)
+	}
+	d.Remaining = int(math.Floor(b.tokens))
+	d.Reset = l.until(float64(l.limits.Burst) - b.tokens)
+	return d
+}
+
+// Run drops the buckets of idle clients every interval until ctx is done;
+// a full bucket holds nothing a new one wouldn't
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *Limiter) sweep() {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key := range l.buckets {
+		if b := l.refill(key, now); b.tokens >= float64(l.limits.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refill returns key's bucket with the tokens added since it was last seen
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limits.Burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.limits.Burst), b.tokens+elapsed*l.limits.Rate)
+		b.last = now
+	}
+	return b
+}
+
+// until is the time it takes to add tokens
+func (l *Limiter) until(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.limits.Rate * float64(time.Second))
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopresence/internal/auth"
+)
+
+func newTestLimiter(limits Limits, now *time.Time, opts ...Option) *Limiter {
+	l := New(limits, opts...)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limits{Rate: 2, Burst: 3}, &now)
+
+	for i := 0; i < 3; i++ {
+		if d := l.Allow("user:alice"); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: expected to be allowed with %d left, got %+v", i+1, 2-i, d)
+		}
+	}
+	d := l.Allow("user:alice")
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != 1500*time.Millisecond {
+		t.Fatalf("expected an empty bucket refilled at 2/s, got %+v", d)
+	}
+	if !l.Allow("user:bob").Allowed {
+		t.Fatal("expected other clients to have their own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d := l.Allow("user:alice"); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected a token after 500ms, got %+v", d)
+	}
+
+	// Buckets refilled to the burst are dropped, others kept
+	now = now.Add(time.Second)
+	l.sweep()
+	if len(l.buckets) != 1 {
+		t.Fatalf("expected only alice's partial bucket to be kept, got %d", len(l.buckets))
+	}
+	now = now.Add(time.Second)
+	l.sweep()
+	if len(l.buckets) != 0 {
+		t.Fatalf("expected idle buckets to be dropped, got %d", len(l.buckets))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limits{Rate: 0.5, Burst: 1}, &now)
+	h := l.Middleware("presence.user", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(userID, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v2/presence/alice", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = req.WithContext(auth.SetUserIDInContext(req.Context(), userID))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("alice", "10.0.0.1:5000")
+	if rec.Code != http.StatusOK || rec.Header().Get(LimitHeader) != "1" || rec.Header().Get(RemainingHeader) != "0" || rec.Header().Get(ResetHeader) != "2" {
+		t.Fatalf("unexpected first response %d %v", rec.Code, rec.Header())
+	}
+	rec = serve("alice", "10.0.0.2:5000")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected 429 with Retry-After 2, got %d %v", rec.Code, rec.Header())
+	}
+	// Anonymous clients are keyed by IP, apart from the user on the same address
+	if rec := serve("", "10.0.0.1:5001"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the anonymous client's own bucket, got %d", rec.Code)
+	}
+	if rec := serve("", "10.0.0.1:5002"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the IP's bucket to be empty, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_TrustedProxy(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limits{Rate: 1, Burst: 1}, &now, WithTrustedProxy())
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/presence", nil)
+	req.RemoteAddr = "10.0.0.9:443"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.7")
+	if got := l.clientIP(req); got != "203.0.113.7" {
+		t.Fatalf("expected the address the proxy saw, got %q", got)
+	}
+}
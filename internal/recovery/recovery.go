@@ -0,0 +1,136 @@
+// Package recovery turns panics in HTTP handlers into 500 responses, so one
+// bad request can't take the process down, and hands them to a pluggable
+// reporter such as an error tracker.
+package recovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"gopresence/internal/i18n"
+	"gopresence/internal/metrics"
+	"gopresence/internal/requestid"
+)
+
+// CodeInternalError is the error code of responses to requests that panicked
+const CodeInternalError = "internal_error"
+
+// Panic describes a panic recovered from a request
+type Panic struct {
+	Value     any
+	Stack     []byte
+	RequestID string
+	Method    string
+	Path      string
+	Time      time.Time
+}
+
+// Error formats the panic value
+func (p Panic) Error() string { return fmt.Sprint(p.Value) }
+
+// Reporter receives recovered panics, e.g. to forward them to Sentry.
+// Report runs on the request's goroutine once the response is written, so
+// it should hand slow work off.
+type Reporter interface {
+	Report(ctx context.Context, p Panic)
+}
+
+// ReporterFunc adapts a function to a Reporter
+type ReporterFunc func(ctx context.Context, p Panic)
+
+// Report implements Reporter
+func (f ReporterFunc) Report(ctx context.Context, p Panic) { f(ctx, p) }
+
+// Middleware recovers panics from next. Each one is logged with its stack,
+// counted in http_panics_total and passed to reporter, if not nil. The
+// caller gets a 500 with the request ID, unless the response had already
+// started, in which case the connection is just closed. Panics with
+// http.ErrAbortHandler are left to net/http, which aborts the response
+// without logging.
+func Middleware(reporter Reporter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			p := Panic{
+				Value:     v,
+				Stack:     debug.Stack(),
+				RequestID: requestid.FromContext(r.Context()),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Time:      time.Now().UTC(),
+			}
+			slog.ErrorContext(r.Context(), "panic serving request",
+				slog.String("panic", p.Error()),
+				slog.String("method", p.Method),
+				slog.String("path", p.Path),
+				slog.String("stack", string(p.Stack)),
+			)
+			metrics.ObservePanic()
+			if rw.started {
+				// Part of the response is out; a 500 can't follow it
+				defer panic(http.ErrAbortHandler)
+			} else {
+				writeError(rw, r, p.RequestID)
+			}
+			if reporter != nil {
+				reporter.Report(r.Context(), p)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	message := i18n.Localize(w, r, CodeInternalError)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error":      message,
+		"code":       CodeInternalError,
+		"request_id": id,
+	})
+}
+
+// responseWriter records whether the response has started
+type responseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Hijack hands the connection to WebSocket upgrades, which assert
+// http.Hijacker rather than use http.ResponseController. A hijacked
+// connection is no longer the server's to answer on.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.started = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
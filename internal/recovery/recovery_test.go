@@ -0,0 +1,73 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopresence/internal/requestid"
+)
+
+func TestMiddleware_RecoversPanics(t *testing.T) {
+	var reported []Panic
+	reporter := ReporterFunc(func(ctx context.Context, p Panic) { reported = append(reported, p) })
+	h := requestid.Middleware(Middleware(reporter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/presence/alice", nil)
+	req.Header.Set(requestid.Header, "req-1")
+	req.Header.Set("Accept-Language", "de")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a JSON 500, got %d %q", rr.Code, rr.Body.String())
+	}
+	if body["code"] != CodeInternalError || body["request_id"] != "req-1" || body["error"] != "interner Serverfehler" {
+		t.Fatalf("unexpected body %v", body)
+	}
+	if len(reported) != 1 || reported[0].Error() != "nil map" || reported[0].RequestID != "req-1" || reported[0].Path != "/api/v2/presence/alice" || len(reported[0].Stack) == 0 {
+		t.Fatalf("unexpected reports %+v", reported)
+	}
+}
+
+func TestMiddleware_StartedResponseIsAborted(t *testing.T) {
+	h := Middleware(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic(errors.New("halfway"))
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("expected the response to be aborted, got %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestHTTPReporter(t *testing.T) {
+	events := make(chan panicEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev panicEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer server.Close()
+
+	NewHTTPReporter(server.URL, time.Second, "node-1").Report(context.Background(), Panic{
+		Value: "boom", Stack: []byte("goroutine 1"), RequestID: "req-1", Method: "PUT", Path: "/api/v2/presence/alice", Time: time.Now(),
+	})
+	select {
+	case ev := <-events:
+		if ev.Message != "boom" || ev.Node != "node-1" || ev.RequestID != "req-1" || ev.Stack != "goroutine 1" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the panic to be reported")
+	}
+}
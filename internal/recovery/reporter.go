@@ -0,0 +1,96 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxReportsInFlight bounds the reports being delivered at once; a burst of
+// panics beyond it is logged but not reported
+const maxReportsInFlight = 8
+
+// HTTPReporter POSTs each panic as a JSON event to an error tracker's
+// ingestion endpoint, or a relay in front of one:
+// {"message", "stack", "request_id", "method", "path", "node", "timestamp"}.
+// Reports are delivered in the background.
+type HTTPReporter struct {
+	url      string
+	node     string
+	client   *http.Client
+	inFlight chan struct{}
+}
+
+// NewHTTPReporter returns a reporter posting to url, each delivery bounded
+// by timeout; node names the reporting node in every event
+func NewHTTPReporter(url string, timeout time.Duration, node string) *HTTPReporter {
+	return &HTTPReporter{
+		url:      url,
+		node:     node,
+		client:   &http.Client{Timeout: timeout},
+		inFlight: make(chan struct{}, maxReportsInFlight),
+	}
+}
+
+// panicEvent is the body of a report
+type panicEvent struct {
+	Message   string    `json:"message"`
+	Stack     string    `json:"stack"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Node      string    `json:"node,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Report implements Reporter
+func (h *HTTPReporter) Report(_ context.Context, p Panic) {
+	select {
+	case h.inFlight <- struct{}{}:
+	default:
+		log.Printf("panic report dropped: %d reports already in flight", maxReportsInFlight)
+		return
+	}
+	go func() {
+		defer func() { <-h.inFlight }()
+		if err := h.send(p); err != nil {
+			log.Printf("panic report failed: %v", err)
+		}
+	}()
+}
+
+func (h *HTTPReporter) send(p Panic) error {
+	body, err := json.Marshal(panicEvent{
+		Message:   p.Error(),
+		Stack:     string(p.Stack),
+		RequestID: p.RequestID,
+		Method:    p.Method,
+		Path:      p.Path,
+		Node:      h.node,
+		Timestamp: p.Time,
+	})
+	if err != nil {
+		return err
+	}
+	// The request that panicked is over; the report outlives its context
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error tracker returned %s", resp.Status)
+	}
+	return nil
+}
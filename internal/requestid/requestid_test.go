@@ -0,0 +1,35 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware_ReusesOrGeneratesID(t *testing.T) {
+	var seen string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(Header, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen != "abc-123" || rec.Header().Get(Header) != "abc-123" {
+		t.Fatalf("expected caller ID to be reused, got ctx=%q header=%q", seen, rec.Header().Get(Header))
+	}
+
+	for _, bad := range []string{"", "has space", strings.Repeat("x", maxLen+1)} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		if bad != "" {
+			req.Header.Set(Header, bad)
+		}
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if seen == bad || len(seen) != 32 || rec.Header().Get(Header) != seen {
+			t.Fatalf("expected generated ID for %q, got ctx=%q header=%q", bad, seen, rec.Header().Get(Header))
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package resultcache keeps computed query results, such as the presences of
+// a user's contacts or the presence stats, for a short window. Dashboards
+// refresh these every few seconds, and recomputing them each time costs
+// contact lookups and store reads for answers that rarely changed.
+package resultcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache holds results for a fixed window. A result can name the users whose
+// presences it was computed from; a change to any of them drops it early.
+type Cache struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]entry
+	// Keys of the results computed from each user's presence
+	byMember map[string]map[string]struct{}
+}
+
+type entry struct {
+	value   any
+	members []string
+	expires time.Time
+}
+
+// New creates a cache keeping results for window
+func New(window time.Duration) *Cache {
+	return &Cache{
+		window:   window,
+		entries:  make(map[string]entry),
+		byMember: make(map[string]map[string]struct{}),
+	}
+}
+
+// Get returns the result cached under key, if any is still current
+func (c *Cache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !time.Now().Before(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set caches value under key for the window, or until until if that is
+// sooner and not zero. The result is dropped as soon as Invalidate is called
+// for one of members. value is shared by every Get, so it must not be
+// modified afterwards.
+func (c *Cache) Set(key string, value any, until time.Time, members ...string) {
+	expires := time.Now().Add(c.window)
+	if !until.IsZero() && until.Before(expires) {
+		expires = until
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(key)
+	c.entries[key] = entry{value: value, members: members, expires: expires}
+	for _, m := range members {
+		keys, ok := c.byMember[m]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.byMember[m] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// Invalidate drops the results computed from member's presence, e.g. when
+// a watch event reports it changed
+func (c *Cache) Invalidate(member string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.byMember[member] {
+		c.drop(key)
+	}
+}
+
+// Len returns the number of results held, including expired ones not yet
+// pruned
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Prune drops expired results
+func (c *Cache) Prune() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			c.drop(key)
+		}
+	}
+}
+
+// Run prunes expired results every interval until ctx is done
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Prune()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drop removes the result under key and its member references; callers
+// hold c.mu
+func (c *Cache) drop(key string) {
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	for _, m := range e.members {
+		if keys := c.byMember[m]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(c.byMember, m)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package resultcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_SetGetInvalidate(t *testing.T) {
+	c := New(time.Minute)
+	c.Set("contacts:alice", "alice's contacts", time.Time{}, "bob", "carol")
+	c.Set("contacts:dave", "dave's contacts", time.Time{}, "bob")
+	c.Set("stats", "stats", time.Time{})
+
+	if v, ok := c.Get("contacts:alice"); !ok || v != "alice's contacts" {
+		t.Fatalf("expected the cached result, got %v %v", v, ok)
+	}
+	c.Invalidate("carol")
+	if _, ok := c.Get("contacts:alice"); ok {
+		t.Fatal("expected the result dropped when a member changed")
+	}
+	if _, ok := c.Get("contacts:dave"); !ok {
+		t.Fatal("expected results without the member kept")
+	}
+	c.Invalidate("bob")
+	if _, ok := c.Get("contacts:dave"); ok || c.Len() != 1 {
+		t.Fatalf("expected only the stats left, got %d results", c.Len())
+	}
+	if len(c.byMember) != 0 {
+		t.Fatalf("expected no member references left, got %v", c.byMember)
+	}
+
+	// Replacing a result drops the members of the old one
+	c.Set("contacts:alice", "v1", time.Time{}, "bob")
+	c.Set("contacts:alice", "v2", time.Time{}, "carol")
+	c.Invalidate("bob")
+	if v, ok := c.Get("contacts:alice"); !ok || v != "v2" {
+		t.Fatalf("expected the replacement kept, got %v %v", v, ok)
+	}
+}
+
+func TestCache_Expiry(t *testing.T) {
+	c := New(time.Minute)
+	c.Set("soon", 1, time.Now().Add(-time.Second), "bob")
+	c.Set("later", 2, time.Now().Add(time.Hour))
+	if _, ok := c.Get("soon"); ok {
+		t.Fatal("expected a result past its own deadline to miss")
+	}
+	if _, ok := c.Get("later"); !ok {
+		t.Fatal("expected a result within the window to hit")
+	}
+
+	c = New(0)
+	c.Set("stats", 1, time.Time{})
+	if _, ok := c.Get("stats"); ok {
+		t.Fatal("expected nothing kept with a zero window")
+	}
+	c.Prune()
+	if c.Len() != 0 {
+		t.Fatalf("expected expired results pruned, got %d", c.Len())
+	}
+}
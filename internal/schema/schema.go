@@ -0,0 +1,201 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"gopresence/internal/models"
+)
+
+// Schema names for request and response bodies
+const (
+	SetPresenceRequest   = "set-presence-request"
+	PatchPresenceRequest = "patch-presence-request"
+	BatchPresenceRequest = "batch-presence-request"
+	BatchSetRequest      = "batch-set-request"
+	Presence             = "presence"
+	PresenceResponse     = "presence-response"
+	PresenceEvent        = "presence-event"
+	PresenceEventV2      = "presence-event-v2"
+	ClientInfo           = "client-info"
+)
+
+// maxBodyBytes bounds request bodies read for validation
+const maxBodyBytes = 1 << 20
+
+//go:embed schemas/*.json
+var files embed.FS
+
+// baseURL is the location schemas are compiled under. Cross-schema $refs are
+// relative, so they resolve the same way for clients fetching /api/v2/schemas/.
+const baseURL = "https://presence.local/api/v2/schemas/"
+
+// Registry holds the published JSON Schemas, compiled for validation
+type Registry struct {
+	raw      map[string][]byte
+	compiled map[string]*jsonschema.Schema
+	printer  *message.Printer
+}
+
+// NewRegistry compiles the embedded schemas. Status enums list the statuses
+// of the state machine installed with models.SetStateMachine, so install it
+// first.
+func NewRegistry() (*Registry, error) {
+	entries, err := files.ReadDir("schemas")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schemas: %w", err)
+	}
+
+	r := &Registry{
+		raw:      make(map[string][]byte),
+		compiled: make(map[string]*jsonschema.Schema),
+		printer:  message.NewPrinter(language.English),
+	}
+	c := jsonschema.NewCompiler()
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("schemas", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema %s: %w", e.Name(), err)
+		}
+		if data, err = withStatuses(data); err != nil {
+			return nil, fmt.Errorf("failed to extend schema %s: %w", e.Name(), err)
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema %s: %w", e.Name(), err)
+		}
+		if err := c.AddResource(baseURL+e.Name(), doc); err != nil {
+			return nil, fmt.Errorf("failed to add schema %s: %w", e.Name(), err)
+		}
+		r.raw[strings.TrimSuffix(e.Name(), ".json")] = data
+	}
+	for name := range r.raw {
+		sch, err := c.Compile(baseURL + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile schema %s: %w", name, err)
+		}
+		r.compiled[name] = sch
+	}
+	return r, nil
+}
+
+// withStatuses rewrites the status enum of a schema to the statuses the
+// deployment accepts; schemas are returned unchanged when only the core
+// statuses are configured
+func withStatuses(data []byte) ([]byte, error) {
+	m := models.CurrentStateMachine()
+	if len(m.Custom()) == 0 {
+		return data, nil
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	props, _ := doc["properties"].(map[string]any)
+	status, _ := props["status"].(map[string]any)
+	if _, ok := status["enum"]; !ok {
+		return data, nil
+	}
+	status["enum"] = m.Statuses()
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Names returns the published schema names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.raw))
+	for name := range r.raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks a JSON document against the named schema
+func (r *Registry) Validate(name string, body []byte) error {
+	sch, ok := r.compiled[name]
+	if !ok {
+		return fmt.Errorf("unknown schema %s", name)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid JSON")
+	}
+	if err := sch.Validate(doc); err != nil {
+		if ve, ok := err.(*jsonschema.ValidationError); ok {
+			return fmt.Errorf("invalid request body at %s", r.describe(ve))
+		}
+		return err
+	}
+	return nil
+}
+
+// describe flattens a validation error to its first leaf, e.g. "/status: value must be one of ..."
+func (r *Registry) describe(ve *jsonschema.ValidationError) string {
+	for len(ve.Causes) > 0 {
+		ve = ve.Causes[0]
+	}
+	return "/" + strings.Join(ve.InstanceLocation, "/") + ": " + ve.ErrorKind.LocalizedString(r.printer)
+}
+
+// ValidateBody rejects PUT/POST/PATCH requests whose body does not match the
+// named schema with 400 and the API's error envelope; other methods pass through
+func (r *Registry) ValidateBody(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodPut, http.MethodPost, http.MethodPatch:
+		default:
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxBodyBytes))
+		req.Body.Close()
+		if err != nil {
+			writeError(w, "failed to read request body")
+			return
+		}
+		if err := r.Validate(name, body); err != nil {
+			writeError(w, err.Error())
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Handler serves GET /api/v2/schemas (index) and /api/v2/schemas/{name}[.json]
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimSuffix(mux.Vars(req)["name"], ".json")
+		if name == "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string][]string{"schemas": r.Names()})
+			return
+		}
+		data, ok := r.raw[name]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(data)
+	})
+}
+
+func writeError(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(models.PresenceResponse{Success: false, Error: message})
+}
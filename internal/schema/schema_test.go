@@ -0,0 +1,177 @@
+package schema
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+func newRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := NewRegistry()
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	return r
+}
+
+func TestRegistry_ValidateRequests(t *testing.T) {
+	r := newRegistry(t)
+
+	cases := []struct {
+		schema string
+		body   string
+		ok     bool
+	}{
+		{SetPresenceRequest, `{"status":"online","message":"hi","ttl":60}`, true},
+		{SetPresenceRequest, `{"status":"sleeping"}`, false},
+		{SetPresenceRequest, `{"message":"no status"}`, false},
+		{SetPresenceRequest, `{"status":"online","ttl":-1}`, false},
+		{SetPresenceRequest, `{bad json`, false},
+		{SetPresenceRequest, `{"status":"online","client":{"platform":"ios","capabilities":["video-capable"]}}`, true},
+		{SetPresenceRequest, `{"status":"online","client":{"capabilities":["Video Capable"]}}`, false},
+		{PatchPresenceRequest, `{"message":"in a meeting"}`, true},
+		{PatchPresenceRequest, `{"status":"sleeping"}`, false},
+		{PatchPresenceRequest, `{}`, false},
+		{BatchPresenceRequest, `{"user_ids":["u1","u2"]}`, true},
+		{BatchPresenceRequest, `{"user_ids":[]}`, false},
+		{BatchPresenceRequest, `{"user_ids":"u1"}`, false},
+		{BatchSetRequest, `{"presences":[{"user_id":"u1","status":"online","ttl":60}]}`, true},
+		{BatchSetRequest, `{"presences":[{"user_id":"u1"}]}`, false},
+		{BatchSetRequest, `{"presences":[]}`, false},
+	}
+	for _, tc := range cases {
+		err := r.Validate(tc.schema, []byte(tc.body))
+		if (err == nil) != tc.ok {
+			t.Errorf("Validate(%s, %s) = %v, want ok=%v", tc.schema, tc.body, err, tc.ok)
+		}
+	}
+	if err := r.Validate(SetPresenceRequest, []byte(`{"status":"sleeping"}`)); err == nil || !strings.Contains(err.Error(), "/status") {
+		t.Fatalf("expected error to point at /status, got %v", err)
+	}
+}
+
+// The published response schemas must accept what the service actually emits
+func TestRegistry_MatchesEmittedPayloads(t *testing.T) {
+	r := newRegistry(t)
+	now := time.Now().UTC()
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, LastSeen: now, UpdatedAt: now, NodeID: "n1", TTL: time.Minute}
+
+	resp, _ := json.Marshal(models.PresenceResponse{Success: true, Data: map[string]models.Presence{"u1": p}})
+	if err := r.Validate(PresenceResponse, resp); err != nil {
+		t.Fatalf("response does not match schema: %v", err)
+	}
+	errResp, _ := json.Marshal(models.PresenceResponse{Error: "boom"})
+	if err := r.Validate(PresenceResponse, errResp); err != nil {
+		t.Fatalf("error response does not match schema: %v", err)
+	}
+	ev, _ := json.Marshal(events.Event{Type: events.EventUpdated, UserID: "u1", Presence: &p, Timestamp: now})
+	if err := r.Validate(PresenceEvent, ev); err != nil {
+		t.Fatalf("event does not match schema: %v", err)
+	}
+	for version, name := range map[string]string{events.PayloadV1: PresenceEvent, events.PayloadV2: PresenceEventV2} {
+		for _, e := range []events.Event{
+			{Type: events.EventUpdated, UserID: "u1", Presence: &p, Revision: 3, Timestamp: now},
+			{Type: events.EventDeleted, UserID: "u1", Revision: 4, Timestamp: now},
+		} {
+			payload, err := events.EncodePayload(e, version)
+			if err != nil {
+				t.Fatalf("encode %s: %v", version, err)
+			}
+			if err := r.Validate(name, payload); err != nil {
+				t.Fatalf("%s payload does not match %s: %v", version, name, err)
+			}
+			if schema, _ := events.PayloadSchema(version); schema != name {
+				t.Fatalf("expected %s to name schema %s, got %s", version, name, schema)
+			}
+		}
+	}
+}
+
+func TestRegistry_ValidateBodyMiddleware(t *testing.T) {
+	r := newRegistry(t)
+	var reached string
+	h := r.ValidateBody(SetPresenceRequest, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]any
+		json.NewDecoder(req.Body).Decode(&body)
+		reached, _ = body["status"].(string)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"status":"nope"}`)))
+	if w.Code != http.StatusBadRequest || reached != "" {
+		t.Fatalf("expected 400 before handler, got %d", w.Code)
+	}
+	var resp models.PresenceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Success || resp.Error == "" {
+		t.Fatalf("expected error envelope, got %s", w.Body.String())
+	}
+
+	// Valid bodies are replayed to the handler
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"status":"away"}`)))
+	if w.Code != http.StatusOK || reached != "away" {
+		t.Fatalf("expected handler to see body, got %d %q", w.Code, reached)
+	}
+
+	// Reads are not validated
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected GET to pass through, got %d", w.Code)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := newRegistry(t)
+	router := mux.NewRouter()
+	router.Handle("/api/v2/schemas", r.Handler())
+	router.Handle("/api/v2/schemas/{name}", r.Handler())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/schemas", nil))
+	var index map[string][]string
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil || len(index["schemas"]) != 9 {
+		t.Fatalf("unexpected index: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/schemas/presence.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/schema+json" || !strings.Contains(w.Body.String(), `"title": "Presence"`) {
+		t.Fatalf("unexpected schema response %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/schemas/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestRegistry_ConfiguredStatuses(t *testing.T) {
+	m, err := models.NewStateMachine([]models.PresenceStatus{"in-call"}, nil)
+	if err != nil {
+		t.Fatalf("NewStateMachine: %v", err)
+	}
+	models.SetStateMachine(m)
+	t.Cleanup(func() { models.SetStateMachine(nil) })
+
+	r := newRegistry(t)
+	if err := r.Validate(SetPresenceRequest, []byte(`{"status":"in-call"}`)); err != nil {
+		t.Fatalf("expected the configured status to validate: %v", err)
+	}
+	if err := r.Validate(SetPresenceRequest, []byte(`{"status":"sleeping"}`)); err == nil {
+		t.Fatal("expected an unknown status to be rejected")
+	}
+	if !strings.Contains(string(r.raw[Presence]), `"in-call"`) {
+		t.Fatal("expected the published presence schema to list in-call")
+	}
+}
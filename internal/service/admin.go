@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"gopresence/internal/nats"
+	"gopresence/internal/timing"
+)
+
+// NodeStatus is this node's view of its cache and store, reported to
+// operators by GET /api/v2/admin/status
+type NodeStatus struct {
+	NodeID            string             `json:"node_id"`
+	Connected         bool               `json:"connected"`
+	ConnectionError   string             `json:"connection_error,omitempty"`
+	CacheEntries      int                `json:"cache_entries"`
+	CacheHits         uint64             `json:"cache_hits"`
+	CacheMisses       uint64             `json:"cache_misses"`
+	WriteBehindQueued int                `json:"write_behind_queued,omitempty"`
+	Store             *nats.BucketHealth `json:"store,omitempty"`
+	StoreError        string             `json:"store_error,omitempty"`
+}
+
+// DeletePresence removes a user's presence from the store and this node's
+// cache. Other nodes drop it from their indexes on the watch event; their
+// caches serve it until it expires there.
+func (s *PresenceService) DeletePresence(ctx context.Context, userID string) error {
+	// A held refresh must not bring the presence back
+	if s.coalesce != nil {
+		s.coalesce.forget(userID)
+	}
+	done := timing.Start(ctx, timing.Store)
+	err := s.store.Delete(ctx, userID)
+	done()
+	if err != nil {
+		return fmt.Errorf("failed to delete presence: %w", err)
+	}
+	s.cache.Delete(userID)
+	s.freshness.forget(userID)
+	return nil
+}
+
+// FlushCache empties this node's cache, so every presence is read from the
+// store again, and returns about how many entries it held
+func (s *PresenceService) FlushCache() int {
+	n := s.cache.Size()
+	s.cache.Clear()
+	s.freshness.reset()
+	return n
+}
+
+// Status reports the node's NATS connection, cache and write-behind queue,
+// and reads the bucket's replication state afresh, as a NodeStatus
+func (s *PresenceService) Status(ctx context.Context) any {
+	cm := s.cache.Metrics()
+	st := NodeStatus{
+		NodeID:       s.nodeID,
+		Connected:    true,
+		CacheEntries: s.cache.Size(),
+		CacheHits:    cm.Hits,
+		CacheMisses:  cm.Misses,
+	}
+	if s.conn != nil {
+		if err := s.conn.check(); err != nil {
+			st.Connected, st.ConnectionError = false, err.Error()
+		}
+	}
+	if s.behind != nil {
+		st.WriteBehindQueued = s.behind.Len()
+	}
+	if h, err := s.RefreshStoreHealth(ctx); err != nil {
+		st.StoreError = err.Error()
+	} else {
+		st.Store = &h
+	}
+	return st
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+func TestDeletePresence_DropsCachedPresence(t *testing.T) {
+	var deleted string
+	store := &deleteStore{fakeStore: fakeStore{}, delete: func(userID string) error { deleted = userID; return nil }}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	s.cache.Set("u1", models.Presence{UserID: "u1", Status: models.StatusOnline}, time.Minute)
+
+	if err := s.DeletePresence(context.Background(), "u1"); err != nil {
+		t.Fatalf("DeletePresence: %v", err)
+	}
+	if _, ok := s.cache.Get("u1"); ok || deleted != "u1" {
+		t.Fatalf("expected u1 deleted from store and cache, deleted %q", deleted)
+	}
+
+	store.delete = func(string) error { return errors.New("store down") }
+	if err := s.DeletePresence(context.Background(), "u2"); err == nil {
+		t.Fatal("expected the store error")
+	}
+}
+
+type deleteStore struct {
+	fakeStore
+	delete func(userID string) error
+}
+
+func (d *deleteStore) Delete(ctx context.Context, userID string) error { return d.delete(userID) }
+
+func TestFlushCacheAndStatus(t *testing.T) {
+	store := &healthStore{health: nats.BucketHealth{Bucket: "presence", Cluster: "east", Leader: "s1"}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	s.cache.Set("u1", models.Presence{UserID: "u1", Status: models.StatusOnline}, time.Minute)
+
+	st := s.Status(context.Background()).(NodeStatus)
+	if st.NodeID != "n1" || !st.Connected || st.Store == nil || st.Store.Leader != "s1" || st.StoreError != "" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	s.FlushCache()
+	if _, ok := s.cache.Get("u1"); ok {
+		t.Fatal("expected the cache to be empty after a flush")
+	}
+
+	store.err = errors.New("stream unavailable")
+	if st := s.Status(context.Background()).(NodeStatus); st.Store != nil || st.StoreError != "stream unavailable" {
+		t.Fatalf("expected the store error to be reported, got %+v", st)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import "gopresence/internal/models"
+
+// AnnotationView looks up the annotations trusted services attached to a
+// user, keyed "namespace:key"; *annotations.Store implements it
+type AnnotationView interface {
+	Lookup(userID string) map[string]string
+}
+
+// EnableAnnotations merges the annotations of v into every presence read.
+// They are kept apart from the stored presence, so the presence a user
+// writes never carries or clears them.
+func (s *PresenceService) EnableAnnotations(v AnnotationView) {
+	s.annotations = v
+}
+
+// annotate sets the annotations of the presences read, keyed by user ID
+func (s *PresenceService) annotate(presences map[string]models.Presence) {
+	if s.annotations == nil {
+		return
+	}
+	for userID, presence := range presences {
+		if values := s.annotations.Lookup(userID); values != nil {
+			presence.Annotations = values
+			presences[userID] = presence
+		}
+	}
+}
+
+// annotated returns presence, read for userID, with its annotations set
+func (s *PresenceService) annotated(userID string, presence models.Presence) models.Presence {
+	if s.annotations != nil {
+		presence.Annotations = s.annotations.Lookup(userID)
+	}
+	return presence
+}
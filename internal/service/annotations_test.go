@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+)
+
+// annotationMap is an AnnotationView backed by a map
+type annotationMap map[string]map[string]string
+
+func (m annotationMap) Lookup(userID string) map[string]string { return m[userID] }
+
+func TestAnnotations_MergedIntoReads(t *testing.T) {
+	var stored models.Presence
+	fs := &fakeStore{
+		get: func(ctx context.Context, userID string) (models.Presence, error) { return stored, nil },
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			stored = p
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	s.EnableAnnotations(annotationMap{"alice": {"pager:on-call": "true"}})
+	ctx := context.Background()
+
+	// A write can't set annotations of its own
+	if err := s.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusBusy, Annotations: map[string]string{"pager:on-call": "false"}}); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+	if stored.Annotations != nil {
+		t.Fatalf("expected annotations not to be stored, got %v", stored.Annotations)
+	}
+
+	p, err := s.GetPresence(ctx, "alice")
+	if err != nil || p.Annotations["pager:on-call"] != "true" {
+		t.Fatalf("expected the annotation on a single read, got %+v (%v)", p, err)
+	}
+	many, err := s.GetMultiplePresences(ctx, []string{"alice"})
+	if err != nil || many["alice"].Annotations["pager:on-call"] != "true" {
+		t.Fatalf("expected the annotation on a batch read, got %+v (%v)", many, err)
+	}
+	many, _, err = s.GetMultiplePresencesStale(ctx, []string{"alice"}, time.Minute)
+	if err != nil || many["alice"].Annotations["pager:on-call"] != "true" {
+		t.Fatalf("expected the annotation on a stale read, got %+v (%v)", many, err)
+	}
+	// The cached copy stays as written
+	if cached, _ := s.cache.Get("alice"); cached.Annotations != nil {
+		t.Fatalf("expected the cache to hold the presence without annotations, got %v", cached.Annotations)
+	}
+}
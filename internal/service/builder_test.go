@@ -38,3 +38,31 @@ func TestServiceBuilder_LegacyPath(t *testing.T) {
 	// quick smoke for cache path equivalence
 	_ = cache.NewMemoryCache(5, 2*time.Second)
 }
+
+func TestServiceBuilder_ResourcesInEnvironment(t *testing.T) {
+	cfg := &config.Config{
+		NATS:     config.NATSConfig{KVBucket: "presence", KVTTL: "10m", KVHistory: 2, KVReplicas: 3, Environment: "staging"},
+		Quota:    config.QuotaConfig{Enabled: true, Bucket: "presence_quota", Retention: "24h"},
+		Sinks:    config.SinksConfig{Specs: "audit,nats,presence.audit,at-least-once;crm,webhook,https://crm.example.com,at-least-once;log,nats,presence.log"},
+		Webhooks: config.WebhooksConfig{Endpoints: "billing,https://billing.example.com/hooks", Secret: "s3cret"},
+	}
+	res, err := NewServiceBuilder(cfg).resources()
+	if err != nil {
+		t.Fatalf("resources: %v", err)
+	}
+	if len(res.Buckets) != 2 {
+		t.Fatalf("expected the presence and quota buckets, got %+v", res.Buckets)
+	}
+	if b := res.Buckets[0]; b.Name != "staging_presence" || b.TTL != 10*time.Minute || b.History != 2 || b.Replicas != 3 {
+		t.Fatalf("unexpected presence bucket %+v", b)
+	}
+	if b := res.Buckets[1]; b.Name != "staging_presence_quota" || b.TTL != 24*time.Hour {
+		t.Fatalf("unexpected quota bucket %+v", b)
+	}
+	if len(res.Consumers) != 3 || res.Consumers[0] != "sink_audit" || res.Consumers[1] != "sink_crm" || res.Consumers[2] != "webhook_billing" {
+		t.Fatalf("expected consumers of the at-least-once sinks and webhooks, got %v", res.Consumers)
+	}
+	if len(res.Streams) != 1 || res.Streams[0].Name != "staging_SINK_audit" || res.Streams[0].Subjects[0] != "staging.presence.audit" {
+		t.Fatalf("expected a stream for the acked NATS sink, got %+v", res.Streams)
+	}
+}
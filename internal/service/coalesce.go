@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// closeFlushTimeout bounds the store writes of held refreshes on Close
+const closeFlushTimeout = 5 * time.Second
+
+// coalescer holds back presence refreshes, writes that leave everything but
+// a user's timestamps as last stored, so a client heartbeating every second
+// costs one store write per interval. Changes are never held.
+type coalescer struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	users map[string]*coalesced
+}
+
+// coalesced is one user's last store write and the refresh held since
+type coalesced struct {
+	written time.Time
+	stored  models.Presence
+	held    *models.Presence // Refreshes since, merged, waiting for the next write
+}
+
+// EnableWriteCoalescing holds back refreshes of a user written within
+// interval of the user's last store write. The cache is updated at once; the
+// newest held refresh is written by RunWriteCoalescing once interval has
+// passed, so other nodes see a heartbeating user's last_seen up to interval
+// late. Writes that change more than the timestamps, such as the status,
+// message or client, writes with a correlation ID, and writes with a TTL no
+// longer than interval always go straight to the store.
+func (s *PresenceService) EnableWriteCoalescing(interval time.Duration) {
+	s.coalesce = &coalescer{interval: interval, users: make(map[string]*coalesced)}
+}
+
+// hold keeps presence back if it refreshes what was written for userID less
+// than interval ago, giving it the stored revision, and reports whether it
+// did. A refresh held already is merged with presence.
+func (c *coalescer) hold(userID string, presence *models.Presence) bool {
+	if presence.TTL > 0 && presence.TTL <= c.interval {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[userID]
+	if !ok || time.Since(u.written) >= c.interval || !refreshes(u.stored, *presence) {
+		return false
+	}
+	presence.Revision = u.stored.Revision
+	held := *presence
+	if u.held != nil {
+		held = merged(*u.held, *presence)
+	}
+	u.held = &held
+	return true
+}
+
+// refreshes reports whether presence only refreshes stored: all it persists
+// but its timestamps and source is as stored, and it carries no correlation
+// ID, which has to reach the events of its own write
+func refreshes(stored, presence models.Presence) bool {
+	return presence.CorrelationID == "" && presence.Status == stored.Status && presence.Message == stored.Message &&
+		presence.TTL == stored.TTL && presence.TimeZone == stored.TimeZone && reflect.DeepEqual(presence.Client, stored.Client)
+}
+
+// merged returns the held refresh moved on by refresh, keeping the later of
+// their timestamps in case they were made out of order
+func merged(held, refresh models.Presence) models.Presence {
+	if refresh.UpdatedAt.After(held.UpdatedAt) {
+		held.UpdatedAt, held.Source, held.NodeID = refresh.UpdatedAt, refresh.Source, refresh.NodeID
+	}
+	if refresh.LastSeen.After(held.LastSeen) {
+		held.LastSeen = refresh.LastSeen
+	}
+	return held
+}
+
+// wrote records a store write of presence for userID, which replaces any
+// refresh held before it
+func (c *coalescer) wrote(userID string, presence models.Presence) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[userID]
+	if !ok {
+		u = &coalesced{}
+		c.users[userID] = u
+	}
+	if u.held != nil && u.held.UpdatedAt.After(presence.UpdatedAt) && refreshes(presence, *u.held) {
+		// A refresh of this write held while it was in flight still has to go out
+		u.written, u.stored = time.Now(), presence
+		return
+	}
+	u.written, u.stored, u.held = time.Now(), presence, nil
+}
+
+// forget drops userID's held refresh, e.g. once the presence is deleted
+func (c *coalescer) forget(userID string) {
+	c.mu.Lock()
+	delete(c.users, userID)
+	c.mu.Unlock()
+}
+
+// pending reports whether userID has a held refresh
+func (c *coalescer) pending(userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[userID]
+	return ok && u.held != nil
+}
+
+// due takes the held refreshes whose interval has passed, or all of them if
+// all is set, and drops users idle for longer than interval
+func (c *coalescer) due(all bool) map[string]models.Presence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	due := make(map[string]models.Presence)
+	for userID, u := range c.users {
+		elapsed := time.Since(u.written) >= c.interval
+		switch {
+		case u.held != nil && (all || elapsed):
+			// The refresh is written at the revision of the last write, which
+			// a direct write made after it was held may have moved
+			held := *u.held
+			held.Revision = u.stored.Revision
+			due[userID] = held
+			u.held = nil
+		case u.held == nil && elapsed:
+			// The next write of an idle user goes straight to the store anyway
+			delete(c.users, userID)
+		}
+	}
+	return due
+}
+
+// FlushCoalesced writes the held refreshes whose interval has passed, or all
+// of them if all is set, and returns how many it wrote. A refresh is only
+// written if the user's entry is still at the revision of this node's last
+// write; if another node wrote since, its write wins and the refresh is
+// dropped. A refresh that fails to write otherwise is held again unless a
+// newer write replaced it.
+func (s *PresenceService) FlushCoalesced(ctx context.Context, all bool) (int, error) {
+	if s.coalesce == nil {
+		return 0, nil
+	}
+	var written int
+	var firstErr error
+	for userID, presence := range s.coalesce.due(all) {
+		if presence.IsExpired() {
+			continue
+		}
+		revision := presence.Revision
+		if err := s.flush(ctx, userID, &presence, revision); err != nil {
+			if apperrors.IsRevisionMismatch(err) {
+				s.dropConflicted(userID, presence, revision)
+				continue
+			}
+			s.coalesce.requeue(userID, presence)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		s.coalesce.wrote(userID, presence)
+		// Give the cached copy its revision, unless a newer write replaced it
+		if cached, ok := s.cache.Get(userID); ok && cached.UpdatedAt.Equal(presence.UpdatedAt) {
+			s.cache.Set(userID, presence, presence.TTL)
+		}
+		written++
+	}
+	return written, firstErr
+}
+
+// flush writes a held refresh at revision. A presence without one, e.g.
+// because the store doesn't report revisions, is written as before.
+func (s *PresenceService) flush(ctx context.Context, userID string, presence *models.Presence, revision uint64) error {
+	if revision == 0 {
+		return s.write(ctx, userID, presence)
+	}
+	return s.putAtRevision(ctx, userID, presence, revision)
+}
+
+// dropConflicted forgets a refresh held for userID that lost to another
+// node's write, along with the cached copy it left, so the next read loads
+// the winning write from the store
+func (s *PresenceService) dropConflicted(userID string, presence models.Presence, revision uint64) {
+	s.coalesce.conflicted(userID, revision)
+	if cached, ok := s.cache.Get(userID); ok && cached.UpdatedAt.Equal(presence.UpdatedAt) {
+		s.cache.Delete(userID)
+		s.freshness.forget(userID)
+	}
+}
+
+// conflicted forgets userID's last write if it is still the one at revision,
+// so the next write isn't held against a revision the store has moved past
+func (c *coalescer) conflicted(userID string, revision uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if u, ok := c.users[userID]; ok && u.stored.Revision == revision {
+		delete(c.users, userID)
+	}
+}
+
+// requeue holds presence again after its write failed, unless a newer
+// refresh or write came in meanwhile
+func (c *coalescer) requeue(userID string, presence models.Presence) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[userID]
+	if !ok || u.held != nil || u.stored.UpdatedAt.After(presence.UpdatedAt) {
+		return
+	}
+	u.held = &presence
+}
+
+// RunWriteCoalescing writes held refreshes as their interval passes, until
+// ctx is done
+func (s *PresenceService) RunWriteCoalescing(ctx context.Context) {
+	if s.coalesce == nil {
+		return
+	}
+	// Checking four times per interval holds a refresh at most 1.25 intervals
+	ticker := time.NewTicker(max(s.coalesce.interval/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if _, err := s.FlushCoalesced(ctx, false); err != nil && ctx.Err() == nil {
+			log.Printf("coalesced presence writes failed: %v", err)
+		}
+	}
+}
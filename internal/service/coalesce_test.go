@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+)
+
+func TestWriteCoalescing_HoldsRefreshes(t *testing.T) {
+	var writes []models.Presence
+	fs := &fakeStore{
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			writes = append(writes, p)
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	s.EnableWriteCoalescing(time.Hour)
+	ctx := context.Background()
+	set := func(status models.PresenceStatus, message string) {
+		t.Helper()
+		if err := s.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: status, Message: message}); err != nil {
+			t.Fatalf("SetPresence: %v", err)
+		}
+	}
+
+	set(models.StatusOnline, "")
+	for i := 0; i < 5; i++ {
+		set(models.StatusOnline, "")
+	}
+	if len(writes) != 1 {
+		t.Fatalf("expected the refreshes held after the first write, got %d writes", len(writes))
+	}
+	cached, err := s.GetPresence(ctx, "alice")
+	if err != nil || !cached.UpdatedAt.After(writes[0].UpdatedAt) {
+		t.Fatalf("expected the cache to serve the latest refresh, got %+v %v", cached, err)
+	}
+	if n, _ := s.FlushCoalesced(ctx, false); n != 0 {
+		t.Fatalf("expected nothing due within the interval, got %d", n)
+	}
+
+	// A change goes straight through and replaces the held refresh
+	set(models.StatusBusy, "")
+	set(models.StatusBusy, "in a meeting")
+	if len(writes) != 3 || s.coalesce.pending("alice") {
+		t.Fatalf("expected changes written at once, got %d writes", len(writes))
+	}
+
+	set(models.StatusBusy, "in a meeting")
+	if n, err := s.FlushCoalesced(ctx, true); n != 1 || err != nil || len(writes) != 4 {
+		t.Fatalf("expected the held refresh flushed, got %d %v after %d writes", n, err, len(writes))
+	}
+	cached, _ = s.GetPresence(ctx, "alice")
+	if last := writes[3]; last.Message != "in a meeting" || !last.UpdatedAt.Equal(cached.UpdatedAt) {
+		t.Fatalf("unexpected flushed presence %+v", last)
+	}
+
+	// Writes changing more than the timestamps, or carrying a correlation
+	// ID, go straight through too
+	writeThrough := func(p models.Presence, what string) {
+		t.Helper()
+		before := len(writes)
+		if err := s.SetPresence(ctx, "alice", p); err != nil {
+			t.Fatalf("SetPresence: %v", err)
+		}
+		if len(writes) != before+1 || s.coalesce.pending("alice") {
+			t.Fatalf("expected a write %s written at once, got %d writes", what, len(writes)-before)
+		}
+	}
+	meeting := models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "in a meeting"}
+	withClient := meeting
+	withClient.Client = &models.ClientInfo{Platform: "ios"}
+	writeThrough(withClient, "setting the client")
+	withZone := withClient
+	withZone.TimeZone = "Europe/Paris"
+	writeThrough(withZone, "setting the time zone")
+	withCorrelation := withZone
+	withCorrelation.CorrelationID = "c1"
+	writeThrough(withCorrelation, "with a correlation ID")
+	if got := writes[len(writes)-1]; got.CorrelationID != "c1" || got.Client == nil || got.TimeZone != "Europe/Paris" {
+		t.Fatalf("expected the write stored as sent, got %+v", got)
+	}
+	set(models.StatusBusy, "in a meeting")
+	if last := writes[len(writes)-1]; last.Client != nil || s.coalesce.pending("alice") {
+		t.Fatalf("expected the write clearing the client written at once, got %+v", last)
+	}
+
+	// A deleted user's held refresh is dropped
+	set(models.StatusBusy, "in a meeting")
+	if err := s.DeletePresence(ctx, "alice"); err != nil {
+		t.Fatalf("DeletePresence: %v", err)
+	}
+	if n, _ := s.FlushCoalesced(ctx, true); n != 0 {
+		t.Fatalf("expected no write after the delete, got %d", n)
+	}
+}
+
+func TestCoalescer_MergesHeldRefreshes(t *testing.T) {
+	c := &coalescer{interval: time.Hour, users: make(map[string]*coalesced)}
+	now := time.Now().UTC()
+	c.wrote("alice", models.Presence{UserID: "alice", Status: models.StatusOnline, UpdatedAt: now, LastSeen: now, Revision: 7})
+
+	later := models.Presence{UserID: "alice", Status: models.StatusOnline, UpdatedAt: now.Add(2 * time.Second), LastSeen: now.Add(2 * time.Second), Source: models.SourceHeartbeat}
+	earlier := models.Presence{UserID: "alice", Status: models.StatusOnline, UpdatedAt: now.Add(time.Second), LastSeen: now.Add(time.Second), Source: models.SourceAPI}
+	if !c.hold("alice", &later) || !c.hold("alice", &earlier) || earlier.Revision != 7 {
+		t.Fatal("expected both refreshes held at the stored revision")
+	}
+	held := c.due(true)["alice"]
+	if !held.UpdatedAt.Equal(later.UpdatedAt) || !held.LastSeen.Equal(later.LastSeen) || held.Source != models.SourceHeartbeat || held.Revision != 7 {
+		t.Fatalf("expected the refreshes merged to the later one, got %+v", held)
+	}
+}
+
+func TestWriteCoalescing_ShortTTLWritesThrough(t *testing.T) {
+	writes := 0
+	fs := &fakeStore{set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+		writes++
+		return nil
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	s.EnableWriteCoalescing(time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := s.SetPresence(context.Background(), "bob", models.Presence{UserID: "bob", Status: models.StatusOnline, TTL: 30 * time.Second}); err != nil {
+			t.Fatalf("SetPresence: %v", err)
+		}
+	}
+	if writes != 3 {
+		t.Fatalf("expected presences that could lapse while held written at once, got %d writes", writes)
+	}
+}
+
+func TestWriteCoalescing_DropsRefreshOverwrittenElsewhere(t *testing.T) {
+	store := newTransitionStore(t)
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	s.EnableWriteCoalescing(time.Hour)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := s.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusOnline, TTL: 2 * time.Hour}); err != nil {
+			t.Fatalf("SetPresence: %v", err)
+		}
+	}
+	if !s.coalesce.pending("alice") {
+		t.Fatal("expected the refresh held")
+	}
+
+	other := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n2")
+	if err := other.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "in a meeting", TTL: 2 * time.Hour}); err != nil {
+		t.Fatalf("SetPresence on the other node: %v", err)
+	}
+	if n, err := s.FlushCoalesced(ctx, true); n != 0 || err != nil {
+		t.Fatalf("expected the stale refresh dropped, got %d %v", n, err)
+	}
+	if got, err := store.Get(ctx, "alice"); err != nil || got.Status != models.StatusBusy || got.NodeID != "n2" {
+		t.Fatalf("expected the other node's write kept, got %+v (%v)", got, err)
+	}
+	if got, err := s.GetPresence(ctx, "alice"); err != nil || got.Status != models.StatusBusy {
+		t.Fatalf("expected the cache to give way to the other node's write, got %+v (%v)", got, err)
+	}
+
+	// The next refresh goes straight to the store instead of being held
+	if err := s.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "in a meeting", TTL: 2 * time.Hour}); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+	if got, err := store.Get(ctx, "alice"); err != nil || got.NodeID != "n1" || s.coalesce.pending("alice") {
+		t.Fatalf("expected the refresh written through, got %+v (%v)", got, err)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+	"gopresence/internal/timing"
+)
+
+// SetPresenceAtRevision writes presence like SetPresence and returns what it
+// stored, with the revision the write created if the store reports one. With
+// a nonzero revision the write only lands if userID's entry is still at that
+// revision, and fails with ErrRevisionMismatch otherwise, so two devices of a
+// user can't silently overwrite each other. Conditional writes always go
+// straight to the store, since neither write coalescing nor write-behind
+// could check the revision. Stores that can't write conditionally, like a
+// proxy node's, get the revision checked by a read just before the write,
+// which narrows the race without closing it.
+func (s *PresenceService) SetPresenceAtRevision(ctx context.Context, userID string, presence models.Presence, revision uint64) (models.Presence, error) {
+	if err := s.prepare(ctx, userID, &presence); err != nil {
+		return models.Presence{}, err
+	}
+	if err := s.commitAtRevision(ctx, userID, &presence, revision); err != nil {
+		return models.Presence{}, err
+	}
+	return presence, nil
+}
+
+// commitAtRevision commits a prepared presence like commit, but with a
+// nonzero revision straight to the store and only if userID's entry is at
+// that revision
+func (s *PresenceService) commitAtRevision(ctx context.Context, userID string, presence *models.Presence, revision uint64) error {
+	if revision == 0 {
+		return s.commit(ctx, userID, presence)
+	}
+
+	if s.seen != nil {
+		s.seen.add(userID)
+	}
+	if err := s.putAtRevision(ctx, userID, presence, revision); err != nil {
+		if apperrors.IsRevisionMismatch(err) {
+			// The caller's revision may have come from a stale cached copy
+			s.cache.Delete(userID)
+			s.freshness.forget(userID)
+		}
+		return fmt.Errorf("failed to store presence: %w", err)
+	}
+	if s.coalesce != nil {
+		s.coalesce.wrote(userID, *presence)
+	}
+	s.cache.Set(userID, *presence, presence.TTL)
+	s.freshness.loaded(userID, presence.TTL)
+	return nil
+}
+
+// putAtRevision writes presence to the store if userID's entry is at
+// revision, recording the new revision on it
+func (s *PresenceService) putAtRevision(ctx context.Context, userID string, presence *models.Presence, revision uint64) error {
+	ru, ok := s.store.(nats.RevisionUpdater)
+	if !ok {
+		current, err := s.store.Get(ctx, userID)
+		switch {
+		case apperrors.IsNotFound(err):
+			return fmt.Errorf("no presence for %s: %w", userID, apperrors.ErrRevisionMismatch)
+		case err != nil:
+			return err
+		case current.Revision != revision:
+			return fmt.Errorf("presence of %s is at revision %d: %w", userID, current.Revision, apperrors.ErrRevisionMismatch)
+		}
+		return s.put(ctx, userID, presence)
+	}
+	defer timing.Start(ctx, timing.Store)()
+	rev, err := ru.UpdateAtRevision(ctx, userID, *presence, presence.TTL, revision)
+	if err != nil {
+		return err
+	}
+	presence.Revision = rev
+	return nil
+}
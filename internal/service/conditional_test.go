@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+func TestSetPresenceAtRevision(t *testing.T) {
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), newTransitionStore(t), "n1")
+	ctx := context.Background()
+	first, err := s.SetPresenceAtRevision(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusOnline}, 0)
+	if err != nil || first.Revision == 0 {
+		t.Fatalf("expected an unconditional write with its revision, got %+v (%v)", first, err)
+	}
+
+	// Two devices read the same revision; the second write must not land
+	phone, err := s.SetPresenceAtRevision(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusBusy}, first.Revision)
+	if err != nil || phone.Revision <= first.Revision {
+		t.Fatalf("expected the conditional write at the current revision, got %+v (%v)", phone, err)
+	}
+	if _, err := s.SetPresenceAtRevision(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusAway}, first.Revision); !apperrors.IsRevisionMismatch(err) {
+		t.Fatalf("expected a revision mismatch, got %v", err)
+	}
+	got, err := s.GetPresence(ctx, "u1")
+	if err != nil || got.Status != models.StatusBusy || got.Revision != phone.Revision {
+		t.Fatalf("expected the first device's write kept, got %+v (%v)", got, err)
+	}
+
+	if _, err := s.SetPresenceAtRevision(ctx, "nobody", models.Presence{UserID: "nobody", Status: models.StatusOnline}, first.Revision); !apperrors.IsRevisionMismatch(err) {
+		t.Fatalf("expected a revision mismatch for a user without a presence, got %v", err)
+	}
+}
+
+func TestSetPresenceAtRevision_ChecksByReadWithoutConditionalStore(t *testing.T) {
+	writes := 0
+	fs := &fakeStore{
+		get: func(ctx context.Context, userID string) (models.Presence, error) {
+			return models.Presence{UserID: userID, Status: models.StatusOnline, Revision: 7}, nil
+		},
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			writes++
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	if _, err := s.SetPresenceAtRevision(context.Background(), "u1", models.Presence{UserID: "u1", Status: models.StatusBusy}, 6); !apperrors.IsRevisionMismatch(err) || writes != 0 {
+		t.Fatalf("expected a mismatch and no write, got %v after %d writes", err, writes)
+	}
+	if _, err := s.SetPresenceAtRevision(context.Background(), "u1", models.Presence{UserID: "u1", Status: models.StatusBusy}, 7); err != nil || writes != 1 {
+		t.Fatalf("expected the write at the current revision, got %v after %d writes", err, writes)
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"gopresence/internal/nats"
+)
+
+// connectionState tracks NATS connectivity so readiness fails while the
+// store is unreachable instead of waiting for requests to time out
+type connectionState struct {
+	mu  sync.RWMutex
+	err error // non-nil while disconnected
+}
+
+// ConnectionChanged implements nats.ConnectionObserver
+func (c *connectionState) ConnectionChanged(ev nats.ConnectionEvent) {
+	var err error
+	switch ev.Type {
+	case nats.ConnectionConnected, nats.ConnectionReconnected:
+		log.Printf("nats %s: %s", ev.Type, ev.URL)
+	case nats.ConnectionDisconnected:
+		if ev.Err != nil {
+			err = fmt.Errorf("nats disconnected: %w", ev.Err)
+		} else {
+			err = errors.New("nats disconnected")
+		}
+		log.Printf("%v; reconnecting", err)
+	case nats.ConnectionClosed:
+		err = errors.New("nats connection closed")
+		log.Printf("%v", err)
+	default:
+		return
+	}
+
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+func (c *connectionState) check() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err
+}
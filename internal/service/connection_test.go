@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/nats"
+)
+
+func TestReady_FollowsConnectionEvents(t *testing.T) {
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), &fakeStore{}, "n1")
+	s.conn = &connectionState{}
+	ctx := context.Background()
+
+	if err := s.Ready(ctx); err != nil {
+		t.Fatalf("expected ready, got %v", err)
+	}
+	s.conn.ConnectionChanged(nats.ConnectionEvent{Type: nats.ConnectionDisconnected, Err: errors.New("eof")})
+	if err := s.Ready(ctx); err == nil {
+		t.Fatalf("expected unready while disconnected")
+	}
+	s.conn.ConnectionChanged(nats.ConnectionEvent{Type: nats.ConnectionReconnected, URL: "nats://x"})
+	if err := s.Ready(ctx); err != nil {
+		t.Fatalf("expected ready after reconnect, got %v", err)
+	}
+	s.conn.ConnectionChanged(nats.ConnectionEvent{Type: nats.ConnectionClosed})
+	if err := s.Ready(ctx); err == nil {
+		t.Fatalf("expected unready once closed")
+	}
+}
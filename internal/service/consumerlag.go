@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gopresence/internal/metrics"
+	"gopresence/internal/nats"
+)
+
+// errNoConsumerLag is returned when the store can't report consumer lag
+var errNoConsumerLag = errors.New("store does not report consumer lag")
+
+// ConsumerLag reads the lag of the bucket's durable consumers, most behind
+// first, and exports it as event_consumer_* metrics
+func (s *PresenceService) ConsumerLag(ctx context.Context) ([]nats.ConsumerLag, error) {
+	lr, ok := s.store.(nats.LagReporter)
+	if !ok {
+		return nil, errNoConsumerLag
+	}
+	lags, err := lr.ConsumerLag(ctx)
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]metrics.EventConsumer, len(lags))
+	for i, l := range lags {
+		consumers[i] = metrics.EventConsumer{Name: l.Name, Pending: l.Pending, AckPending: l.AckPending, Redelivered: l.Redelivered}
+		// A caught-up consumer's checkpoint is current however long ago it moved
+		if l.Lag > 0 && !l.Checkpoint.IsZero() {
+			consumers[i].CheckpointAge = time.Since(l.Checkpoint)
+		}
+	}
+	metrics.ObserveConsumerLag(consumers)
+	return lags, nil
+}
+
+// RunConsumerLag refreshes the consumer lag metrics now and then every
+// interval until ctx is done
+func (s *PresenceService) RunConsumerLag(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.ConsumerLag(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("consumer lag check failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"math"
+	"sync"
+
+	apperrors "gopresence/internal/errors"
+)
+
+// missRatioWeight is the weight of each batch read in the miss ratio average
+const missRatioWeight = 0.1
+
+// missRatio is an exponentially weighted average of the cache miss ratio of
+// batch reads. It reads 1 until the first batch is observed: a cold cache
+// misses everything.
+type missRatio struct {
+	mu       sync.Mutex
+	value    float64
+	observed bool
+}
+
+func (m *missRatio) observe(lookups, misses int) {
+	if lookups == 0 {
+		return
+	}
+	ratio := float64(misses) / float64(lookups)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.observed {
+		m.value, m.observed = ratio, true
+		return
+	}
+	m.value += missRatioWeight * (ratio - m.value)
+}
+
+func (m *missRatio) get() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.observed {
+		return 1
+	}
+	return m.value
+}
+
+// BatchCost is the projected store cost of a batch read
+type BatchCost struct {
+	Users          int     `json:"users"`           // Distinct users requested
+	MissRatio      float64 `json:"miss_ratio"`      // Recent cache miss ratio of batch reads
+	EstimatedReads int     `json:"estimated_reads"` // Users times MissRatio, rounded up
+	Budget         int     `json:"budget,omitempty"`
+	MaxBatchSize   int     `json:"max_batch_size,omitempty"` // Largest batch projected to fit Budget
+}
+
+// SetBatchReadBudget caps the store reads a batch read may be projected to
+// need; larger batches fail with an apperrors.BudgetExceededError naming the
+// batch size that would fit. Zero disables the check.
+func (s *PresenceService) SetBatchReadBudget(budget int) {
+	s.batchBudget = budget
+}
+
+// EstimateBatchCost projects the store reads needed to read userIDs: the
+// distinct users times the recent cache miss ratio of batch reads
+func (s *PresenceService) EstimateBatchCost(userIDs []string) BatchCost {
+	distinct := make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		distinct[id] = struct{}{}
+	}
+	ratio := s.misses.get()
+	cost := BatchCost{
+		Users:          len(distinct),
+		MissRatio:      ratio,
+		EstimatedReads: int(math.Ceil(float64(len(distinct)) * ratio)),
+		Budget:         s.batchBudget,
+	}
+	if s.batchBudget > 0 && ratio > 0 {
+		cost.MaxBatchSize = int(float64(s.batchBudget) / ratio)
+	}
+	return cost
+}
+
+// CheckBatchBudget rejects a batch read projected to exceed the budget. Batch
+// reads check it themselves; callers that split a batch into several reads
+// check the whole batch up front.
+func (s *PresenceService) CheckBatchBudget(userIDs []string) error {
+	if s.batchBudget <= 0 || len(userIDs) <= s.batchBudget {
+		return nil
+	}
+	cost := s.EstimateBatchCost(userIDs)
+	if cost.EstimatedReads <= cost.Budget {
+		return nil
+	}
+	// The average may be stale, or still the cold cache's 1 if every batch
+	// so far was over the budget and so never read. Before refusing, count
+	// what this batch would miss; a refused batch is never read, so its
+	// misses are observed here for the average to catch up.
+	misses := s.uncached(userIDs)
+	if misses <= s.batchBudget {
+		return nil
+	}
+	s.misses.observe(cost.Users, misses)
+	return &apperrors.BudgetExceededError{
+		Users:          cost.Users,
+		EstimatedReads: misses,
+		Budget:         cost.Budget,
+		MaxBatchSize:   s.batchBudget * cost.Users / misses,
+	}
+}
+
+// uncached counts the distinct users among userIDs a batch read would have
+// to read from the store
+func (s *PresenceService) uncached(userIDs []string) int {
+	distinct := make(map[string]struct{}, len(userIDs))
+	misses := 0
+	for _, id := range userIDs {
+		if _, dup := distinct[id]; dup {
+			continue
+		}
+		distinct[id] = struct{}{}
+		if !s.neverSeen(id) && !s.freshness.cached(id) {
+			misses++
+		}
+	}
+	return misses
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+func userIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("u%d", i)
+	}
+	return ids
+}
+
+func TestBatchReadBudget(t *testing.T) {
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), &fakeStore{}, "n1")
+	s.SetBatchReadBudget(10)
+	ctx := context.Background()
+
+	// A cold cache is assumed to miss everything
+	_, err := s.GetMultiplePresences(ctx, userIDs(20))
+	var be *apperrors.BudgetExceededError
+	if !errors.As(err, &be) || be.Users != 20 || be.EstimatedReads != 20 || be.MaxBatchSize != 10 {
+		t.Fatalf("expected budget error with max batch 10, got %v", err)
+	}
+	if _, err := s.GetMultiplePresences(ctx, userIDs(10)); err != nil {
+		t.Fatalf("batch within budget: %v", err)
+	}
+
+	// At a 25% miss ratio, 40 users fit a budget of 10 reads
+	s.misses = missRatio{value: 0.25, observed: true}
+	if cost := s.EstimateBatchCost(append(userIDs(40), "u1", "u2")); cost.Users != 40 || cost.EstimatedReads != 10 || cost.MaxBatchSize != 40 {
+		t.Fatalf("unexpected cost %+v", cost)
+	}
+	if _, _, err := s.GetMultiplePresencesStale(ctx, userIDs(41), time.Minute); !apperrors.IsBudgetExceeded(err) {
+		t.Fatalf("expected stale read over budget to be rejected, got %v", err)
+	}
+
+	s.SetBatchReadBudget(0)
+	if _, err := s.GetMultiplePresences(ctx, userIDs(100)); err != nil {
+		t.Fatalf("expected no limit with budget disabled: %v", err)
+	}
+}
+
+func TestBatchReadBudget_CountsRejectedBatches(t *testing.T) {
+	fs := &fakeStore{set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error { return nil }}
+	s := NewPresenceService(cache.NewMemoryCache(100, time.Minute), fs, "n1")
+	s.SetBatchReadBudget(10)
+	ctx := context.Background()
+	for _, id := range userIDs(15) {
+		if err := s.SetPresence(ctx, id, models.Presence{UserID: id, Status: models.StatusOnline, TTL: time.Minute}); err != nil {
+			t.Fatalf("SetPresence: %v", err)
+		}
+	}
+
+	// No batch was read yet, but this one only misses 5 users
+	if _, err := s.GetMultiplePresences(ctx, userIDs(20)); err != nil {
+		t.Fatalf("expected a mostly cached batch within budget: %v", err)
+	}
+	var be *apperrors.BudgetExceededError
+	if _, err := s.GetMultiplePresences(ctx, userIDs(60)); !errors.As(err, &be) || be.EstimatedReads != 45 || be.MaxBatchSize != 13 {
+		t.Fatalf("expected 45 projected reads and a max batch of 13, got %v", err)
+	}
+	// 0.25 from the first batch, moved toward the rejected batch's 0.75
+	if got := s.misses.get(); got < 0.299 || got > 0.301 {
+		t.Fatalf("expected the rejected batch observed, got ratio %v", got)
+	}
+}
+
+func TestMissRatio_Average(t *testing.T) {
+	var m missRatio
+	if m.get() != 1 {
+		t.Fatalf("expected 1 before any observation, got %v", m.get())
+	}
+	m.observe(10, 0)
+	m.observe(10, 10)
+	if got := m.get(); got < 0.099 || got > 0.101 {
+		t.Fatalf("expected 0.1, got %v", got)
+	}
+}
+
+func TestGetMultiplePresences_ReadsRepeatedIDsOnce(t *testing.T) {
+	var fetched []string
+	fs := &fakeStore{multi: func(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+		fetched = append(fetched, ids...)
+		return map[string]models.Presence{}, nil
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	s.SetBatchReadBudget(2)
+
+	if _, err := s.GetMultiplePresences(context.Background(), []string{"a", "b", "a", "b", "a"}); err != nil {
+		t.Fatalf("expected repeats not to count against the budget: %v", err)
+	}
+	if len(fetched) != 2 || fetched[0] != "a" || fetched[1] != "b" {
+		t.Fatalf("expected a and b fetched once each, got %v", fetched)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gopresence/internal/metrics"
+	"gopresence/internal/nats"
+)
+
+// errStandby is returned by Ready while this node stands by for its primary:
+// its bucket is a read-only mirror until it takes over
+var errStandby = errors.New("standby center: presence bucket is a read-only mirror of the primary")
+
+// CenterStatus returns this node's part in a standby pair, or false if it
+// has none
+func (s *PresenceService) CenterStatus() (nats.CenterStatus, bool) {
+	sc, ok := s.store.(nats.StandbyCenter)
+	if !ok {
+		return nats.CenterStatus{}, false
+	}
+	return sc.CenterStatus()
+}
+
+// Standby reports whether this node is a standby center that has not taken
+// over from its primary
+func (s *PresenceService) Standby() bool {
+	st, ok := s.CenterStatus()
+	return ok && st.Role == nats.CenterStandby
+}
+
+// Failover promotes a standby center once its primary has been unreachable
+// for at least after. It reports whether this call promoted the node.
+func (s *PresenceService) Failover(ctx context.Context, after time.Duration) (bool, error) {
+	st, ok := s.CenterStatus()
+	if !ok || st.Role != nats.CenterStandby {
+		return false, nil
+	}
+	metrics.SetCenterPrimaryConnected(st.PrimaryConnected)
+	if st.PrimaryConnected || time.Since(st.PrimaryLostAt) < after {
+		return false, nil
+	}
+	if err := s.store.(nats.StandbyCenter).Promote(ctx); err != nil {
+		return false, err
+	}
+	metrics.ObserveCenterPromotion()
+	// Entries were rewritten at new revisions
+	s.FlushCache()
+	return true, nil
+}
+
+// RunFailover checks the primary of a standby center every interval until
+// ctx is done or the node takes over
+func (s *PresenceService) RunFailover(ctx context.Context, interval, after time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	fenced := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		promoted, err := s.Failover(ctx, after)
+		switch {
+		case errors.Is(err, nats.ErrPrimaryReachable):
+			// Logged once while it lasts, not every interval
+			if !fenced {
+				log.Printf("leaf link to the primary center down for %s, but the primary still accepts connections; not taking over", after)
+			}
+			fenced = true
+			continue
+		case err != nil && ctx.Err() == nil:
+			log.Printf("standby failover failed: %v", err)
+		case promoted:
+			log.Printf("primary center unreachable for %s; this standby took over", after)
+			return
+		}
+		fenced = false
+		if !s.Standby() {
+			return
+		}
+	}
+}
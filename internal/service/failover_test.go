@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+type standbyStore struct {
+	fakeStore
+	status   nats.CenterStatus
+	promotes int
+}
+
+func (s *standbyStore) CenterStatus() (nats.CenterStatus, bool) { return s.status, true }
+
+func (s *standbyStore) Promote(ctx context.Context) error {
+	s.promotes++
+	s.status.Role, s.status.PromotedAt = nats.CenterPromoted, time.Now()
+	return nil
+}
+
+func TestFailover_PromotesAfterPrimaryLost(t *testing.T) {
+	store := &standbyStore{
+		fakeStore: fakeStore{multi: func(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+			return map[string]models.Presence{}, nil
+		}},
+		status: nats.CenterStatus{Role: nats.CenterStandby, PrimaryConnected: true},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	ctx := context.Background()
+
+	if err := s.Ready(ctx); !errors.Is(err, errStandby) {
+		t.Fatalf("expected a standby not ready, got %v", err)
+	}
+	if promoted, err := s.Failover(ctx, time.Minute); promoted || err != nil {
+		t.Fatalf("expected no promotion while the primary is up, got %v %v", promoted, err)
+	}
+	store.status.PrimaryConnected, store.status.PrimaryLostAt = false, time.Now()
+	if promoted, _ := s.Failover(ctx, time.Minute); promoted {
+		t.Fatal("expected no promotion before the failover delay")
+	}
+	store.status.PrimaryLostAt = time.Now().Add(-2 * time.Minute)
+	if promoted, err := s.Failover(ctx, time.Minute); !promoted || err != nil || store.promotes != 1 {
+		t.Fatalf("expected a promotion, got %v %v after %d", promoted, err, store.promotes)
+	}
+	if s.Standby() {
+		t.Fatal("expected the promoted node to no longer stand by")
+	}
+	if err := s.Ready(ctx); err != nil {
+		t.Fatalf("expected the promoted node ready, got %v", err)
+	}
+	if d := s.HealthDetails(ctx).(HealthDetails); d.Center == nil || d.Center.Role != nats.CenterPromoted {
+		t.Fatalf("expected the center status in the health details, got %+v", d)
+	}
+	if promoted, _ := s.Failover(ctx, time.Minute); promoted || store.promotes != 1 {
+		t.Fatal("expected a promoted node not to be promoted again")
+	}
+}
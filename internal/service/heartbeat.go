@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+)
+
+// Heartbeat refreshes userID's presence as a client keep-alive and returns
+// it: last_seen and updated_at move to now and, if ttl is positive, the TTL
+// is replaced, while the status, message and client info are kept. The
+// current presence is read through the cache, and with write coalescing a
+// refresh within the interval is held like any other, so a cached user's
+// heartbeat usually costs no store access at all. Otherwise the refresh is
+// written only if the entry is still at the revision read; if another write
+// landed in between, the presence is read again from the store, up to
+// maxPatchAttempts times. A user without a live presence gets a NotFound
+// error, since a heartbeat can't bring back a lapsed presence.
+func (s *PresenceService) Heartbeat(ctx context.Context, userID string, ttl time.Duration) (models.Presence, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := s.GetPresence(ctx, userID)
+		if err != nil {
+			return models.Presence{}, err
+		}
+		presence := s.refreshed(current, ttl)
+		// The status doesn't change, so no transition needs checking
+		if err := presence.Validate(); err != nil {
+			return models.Presence{}, fmt.Errorf("invalid presence: %w", err)
+		}
+		// A held refresh is written later, at the revision of this node's
+		// last write
+		if s.coalesce != nil && s.coalesce.hold(userID, &presence) {
+			metrics.ObserveCoalescedWrite()
+			s.cache.Set(userID, presence, presence.TTL)
+			s.freshness.loaded(userID, presence.TTL)
+			return s.annotated(userID, presence), nil
+		}
+		// Stores that don't report revisions get the refresh written as is
+		err = s.commitAtRevision(ctx, userID, &presence, current.Revision)
+		if err == nil {
+			return s.annotated(userID, presence), nil
+		}
+		// A mismatch dropped the cached copy, so the next attempt reads the store
+		if !apperrors.IsRevisionMismatch(err) || attempt == maxPatchAttempts {
+			return models.Presence{}, err
+		}
+	}
+}
+
+// refreshed returns current as refreshed by a heartbeat of this node
+func (s *PresenceService) refreshed(current models.Presence, ttl time.Duration) models.Presence {
+	presence := current
+	presence.NodeID = s.nodeID
+	presence.UpdatedAt = time.Now().UTC()
+	presence.LastSeen = presence.UpdatedAt
+	presence.Source = models.SourceHeartbeat
+	// The rest belongs to the write that set the presence, or to the store
+	presence.CorrelationID = ""
+	presence.Annotations = nil
+	presence.Revision, presence.StoredAt = 0, time.Time{}
+	if ttl > 0 {
+		presence.TTL = ttl
+	}
+	return presence
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+func TestHeartbeat(t *testing.T) {
+	reads := 0
+	var writes []models.Presence
+	fs := &fakeStore{
+		get: func(ctx context.Context, userID string) (models.Presence, error) {
+			reads++
+			for i := len(writes) - 1; i >= 0; i-- {
+				if writes[i].UserID == userID {
+					return writes[i], nil
+				}
+			}
+			return models.Presence{}, apperrors.NotFound(userID)
+		},
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			writes = append(writes, p)
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	ctx := context.Background()
+	if err := s.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "focus", TTL: time.Minute, CorrelationID: "c1"}); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+	set := writes[0]
+
+	p, err := s.Heartbeat(ctx, "alice", 0)
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if reads != 0 || len(writes) != 2 {
+		t.Fatalf("expected a cached heartbeat to write without reading, got %d reads and %d writes", reads, len(writes))
+	}
+	if p.Status != models.StatusBusy || p.Message != "focus" || p.TTL != time.Minute || p.Source != models.SourceHeartbeat ||
+		p.CorrelationID != "" || !p.LastSeen.After(set.LastSeen) || writes[1].LastSeen != p.LastSeen {
+		t.Fatalf("unexpected refreshed presence %+v", p)
+	}
+	if p, _ = s.Heartbeat(ctx, "alice", 5*time.Minute); p.TTL != 5*time.Minute {
+		t.Fatalf("expected the TTL replaced, got %v", p.TTL)
+	}
+
+	// With coalescing, heartbeats within the interval don't reach the store
+	s.EnableWriteCoalescing(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := s.Heartbeat(ctx, "alice", 0); err != nil {
+			t.Fatalf("Heartbeat: %v", err)
+		}
+	}
+	if len(writes) != 4 {
+		t.Fatalf("expected one write for the coalesced heartbeats, got %d writes", len(writes))
+	}
+
+	if _, err := s.Heartbeat(ctx, "bob", 0); !apperrors.IsNotFound(err) {
+		t.Fatalf("expected NotFound for a user without a presence, got %v", err)
+	}
+}
+
+func TestHeartbeat_ReadsBehindCache(t *testing.T) {
+	store := newTransitionStore(t)
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	ctx := context.Background()
+	if err := s.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusOnline, TTL: time.Hour}); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+
+	// Another node changes the status behind this node's cache; the heartbeat
+	// fails to write at the cached revision, and refreshes that write instead
+	// of writing back the cached one
+	other := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n2")
+	if err := other.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "in a meeting", TTL: time.Hour}); err != nil {
+		t.Fatalf("SetPresence on the other node: %v", err)
+	}
+	p, err := s.Heartbeat(ctx, "alice", 0)
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	got, err := store.Get(ctx, "alice")
+	if err != nil || got.Status != models.StatusBusy || got.Message != "in a meeting" || got.Source != models.SourceHeartbeat || got.Revision != p.Revision {
+		t.Fatalf("expected the other node's write refreshed, got %+v (%v)", got, err)
+	}
+	if cached, err := s.GetPresence(ctx, "alice"); err != nil || cached.Status != models.StatusBusy || cached.Revision != p.Revision {
+		t.Fatalf("expected the refreshed presence cached, got %+v (%v)", cached, err)
+	}
+}
+
+func TestHeartbeat_CoalescesAtStoredRevision(t *testing.T) {
+	store := newTransitionStore(t)
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	s.EnableWriteCoalescing(time.Hour)
+	ctx := context.Background()
+	set, err := s.SetPresenceAtRevision(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusOnline, TTL: 2 * time.Hour}, 0)
+	if err != nil {
+		t.Fatalf("SetPresenceAtRevision: %v", err)
+	}
+
+	p, err := s.Heartbeat(ctx, "alice", 0)
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if got, err := store.Get(ctx, "alice"); err != nil || got.Revision != set.Revision || !s.coalesce.pending("alice") || p.Revision != set.Revision {
+		t.Fatalf("expected the heartbeat held at revision %d, got %+v (%v)", set.Revision, got, err)
+	}
+	if n, err := s.FlushCoalesced(ctx, true); n != 1 || err != nil {
+		t.Fatalf("expected the held heartbeat flushed, got %d %v", n, err)
+	}
+	got, err := store.Get(ctx, "alice")
+	if err != nil || got.Source != models.SourceHeartbeat || !got.LastSeen.Equal(p.LastSeen) || got.Revision <= set.Revision {
+		t.Fatalf("expected the heartbeat written at the next revision, got %+v (%v)", got, err)
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"gopresence/internal/nats"
+)
+
+// errNoKeyAudit is returned when the store can't audit its keys
+var errNoKeyAudit = errors.New("store does not audit keys")
+
+// AuditKeys scans the bucket for keys reads skip, repairing or deleting
+// them as mode asks. Changes made by a repair or delete reach other nodes as
+// watch events, but this node's cache is flushed so it serves none of the
+// presences it held under the old keys.
+func (s *PresenceService) AuditKeys(ctx context.Context, mode string) (nats.KeyAudit, error) {
+	auditor, ok := s.store.(nats.KeyAuditor)
+	if !ok {
+		return nats.KeyAudit{}, errNoKeyAudit
+	}
+	audit, err := auditor.AuditKeys(ctx, mode)
+	if audit.Repaired+audit.Deleted > 0 {
+		s.FlushCache()
+	}
+	return audit, err
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// maxPatchAttempts bounds how often PatchPresence merges again after another
+// write changed the presence between its read and its write
+const maxPatchAttempts = 3
+
+// PatchPresence merges patch into userID's current presence and returns
+// what it stored, so a client can change only its message, say, without
+// resending the status or resetting the TTL. The merge is a read-modify-write:
+// the presence is read through the cache and written back only if its entry
+// is still at the revision read, and a write landing in between makes it read
+// and merge again, up to maxPatchAttempts times. With a nonzero revision the
+// presence must also be at that revision, or the patch fails with
+// ErrRevisionMismatch. A user without a live presence gets a NotFound error,
+// since there is nothing to merge into.
+func (s *PresenceService) PatchPresence(ctx context.Context, userID string, patch models.PresencePatch, revision uint64) (models.Presence, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := s.GetPresence(ctx, userID)
+		if err != nil {
+			return models.Presence{}, err
+		}
+		if revision != 0 && current.Revision != revision {
+			err = fmt.Errorf("presence of %s is at revision %d: %w", userID, current.Revision, apperrors.ErrRevisionMismatch)
+		} else {
+			presence := s.patched(current, patch)
+			if err = s.checkPatch(current, presence); err != nil {
+				return models.Presence{}, err
+			}
+			// A presence only written to the cache so far has no revision,
+			// and is committed the way it was
+			if err = s.commitAtRevision(ctx, userID, &presence, current.Revision); err == nil {
+				return s.annotated(userID, presence), nil
+			}
+		}
+		if !apperrors.IsRevisionMismatch(err) || attempt == maxPatchAttempts {
+			return models.Presence{}, err
+		}
+		// Read the store next time, not a possibly stale cached copy
+		s.cache.Delete(userID)
+		s.freshness.forget(userID)
+	}
+}
+
+// patched returns current with patch merged in, as a write of this node
+func (s *PresenceService) patched(current models.Presence, patch models.PresencePatch) models.Presence {
+	presence := current
+	patch.Apply(&presence, time.Now().UTC())
+	presence.NodeID = s.nodeID
+	presence.Source = models.SourceAPI
+	// The rest belongs to the annotation store, or to the store
+	presence.Annotations = nil
+	presence.Revision, presence.StoredAt = 0, time.Time{}
+	return presence
+}
+
+// checkPatch checks a patched presence is valid, and that the state machine
+// allows its status change
+func (s *PresenceService) checkPatch(current, presence models.Presence) error {
+	if err := presence.Validate(); err != nil {
+		return fmt.Errorf("invalid presence: %w", err)
+	}
+	if m := models.CurrentStateMachine(); m.Restricted() && !m.Allows(current.Status, presence.Status) {
+		return &apperrors.TransitionError{UserID: presence.UserID, From: string(current.Status), To: string(presence.Status)}
+	}
+	return nil
+}
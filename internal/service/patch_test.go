@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+func TestPatchPresence(t *testing.T) {
+	store := newTransitionStore(t)
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	ctx := context.Background()
+	set, err := s.SetPresenceAtRevision(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusBusy, Message: "focus", TTL: time.Hour, CorrelationID: "c1"}, 0)
+	if err != nil {
+		t.Fatalf("SetPresenceAtRevision: %v", err)
+	}
+
+	message := "back at 3pm"
+	p, err := s.PatchPresence(ctx, "alice", models.PresencePatch{Message: &message}, 0)
+	if err != nil {
+		t.Fatalf("PatchPresence: %v", err)
+	}
+	if p.Status != models.StatusBusy || p.Message != message || p.TTL != time.Hour || !p.LastSeen.Equal(set.LastSeen) ||
+		!p.UpdatedAt.After(set.UpdatedAt) || p.CorrelationID != "" || p.Revision <= set.Revision {
+		t.Fatalf("expected only the message and updated_at changed, got %+v", p)
+	}
+
+	status := models.StatusOnline
+	if p, err = s.PatchPresence(ctx, "alice", models.PresencePatch{Status: &status}, p.Revision); err != nil {
+		t.Fatalf("PatchPresence at the current revision: %v", err)
+	}
+	if p.Status != models.StatusOnline || p.Message != message || !p.LastSeen.After(set.LastSeen) {
+		t.Fatalf("expected the status changed and last_seen moved, got %+v", p)
+	}
+	if _, err := s.PatchPresence(ctx, "alice", models.PresencePatch{Status: &status}, set.Revision); !apperrors.IsRevisionMismatch(err) {
+		t.Fatalf("expected a revision mismatch, got %v", err)
+	}
+
+	// Another node writes behind this node's cache; the patch merges into its write
+	other := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n2")
+	if err := other.SetPresence(ctx, "alice", models.Presence{UserID: "alice", Status: models.StatusAway, Message: "lunch", TTL: time.Hour}); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+	if p, err = s.PatchPresence(ctx, "alice", models.PresencePatch{TTL: 2 * time.Hour}, 0); err != nil {
+		t.Fatalf("PatchPresence after a concurrent write: %v", err)
+	}
+	got, err := store.Get(ctx, "alice")
+	if err != nil || got.Status != models.StatusAway || got.Message != "lunch" || got.TTL != 2*time.Hour || got.Revision != p.Revision {
+		t.Fatalf("expected the patch merged into the other node's write, got %+v (%v)", got, err)
+	}
+
+	if _, err := s.PatchPresence(ctx, "bob", models.PresencePatch{Message: &message}, 0); !apperrors.IsNotFound(err) {
+		t.Fatalf("expected NotFound for a user without a presence, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gopresence/internal/index"
+	"gopresence/internal/nats"
+)
+
+// resyncBatch is the number of presences read from KV at a time while
+// resyncing the index
+const resyncBatch = 500
+
+// resyncProgressInterval spaces the progress records of a long resync
+const resyncProgressInterval = 5 * time.Second
+
+// ResyncIndex loads every stored presence into idx and marks it synced. The
+// watch feeding idx must already be running, so changes made during the
+// resync are not missed; idx keeps whichever of a change and a read is newer.
+// Stores that can't list keys, such as a proxy's, have nothing to resync
+// from and leave the index to the watch.
+func (s *PresenceService) ResyncIndex(ctx context.Context, idx *index.Index) error {
+	lister, ok := s.store.(nats.KeyLister)
+	if !ok {
+		idx.MarkSynced()
+		return nil
+	}
+	start := time.Now()
+	keys, err := lister.Keys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list presences: %w", err)
+	}
+	slog.Info("index resync started", "keys", len(keys))
+	loaded, lastProgress := 0, start
+	for i := 0; i < len(keys); i += resyncBatch {
+		stored, err := s.store.GetMultiple(ctx, keys[i:min(i+resyncBatch, len(keys))])
+		if err != nil {
+			return fmt.Errorf("failed to read presences: %w", err)
+		}
+		idx.Load(stored)
+		loaded += len(stored)
+		if time.Since(lastProgress) >= resyncProgressInterval {
+			lastProgress = time.Now()
+			slog.Info("index resync progress", "read", min(i+resyncBatch, len(keys)), "keys", len(keys), "loaded", loaded)
+		}
+	}
+	idx.MarkSynced()
+	slog.Info("index resync completed", "loaded", loaded, "duration", time.Since(start))
+	return nil
+}
+
+// RunIndexResync runs ResyncIndex, retrying every interval until it succeeds
+// or ctx is done
+func (s *PresenceService) RunIndexResync(ctx context.Context, idx *index.Index, interval time.Duration) {
+	for {
+		err := s.ResyncIndex(ctx, idx)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		slog.Warn("index resync failed", "error", err, "retry_in", interval)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/index"
+	"gopresence/internal/models"
+)
+
+func TestResyncIndex(t *testing.T) {
+	keys := make([]string, resyncBatch+3)
+	for i := range keys {
+		keys[i] = "u" + strconv.Itoa(i)
+	}
+	store := newListingStore(keys...)
+	batches := 0
+	store.multi = func(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+		batches++
+		out := make(map[string]models.Presence, len(ids))
+		for _, id := range ids {
+			out[id] = models.Presence{UserID: id, Status: models.StatusOnline, UpdatedAt: time.Now().UTC(), Revision: 1}
+		}
+		return out, nil
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	idx := index.New(time.Hour)
+
+	if err := s.ResyncIndex(context.Background(), idx); err != nil {
+		t.Fatalf("ResyncIndex: %v", err)
+	}
+	if batches != 2 || idx.Stats().Total != len(keys) {
+		t.Fatalf("expected %d presences in 2 batches, got %d in %d", len(keys), idx.Stats().Total, batches)
+	}
+	if err := idx.Ready(context.Background()); err != nil {
+		t.Fatalf("expected the index to be ready, got %v", err)
+	}
+
+	// A failed read leaves the index unready
+	store.multi = func(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+		return nil, errors.New("store down")
+	}
+	idx = index.New(time.Hour)
+	if err := s.ResyncIndex(context.Background(), idx); err == nil {
+		t.Fatal("expected the read error")
+	}
+	if err := idx.Ready(context.Background()); !errors.Is(err, index.ErrNotSynced) {
+		t.Fatalf("expected the index to stay unready, got %v", err)
+	}
+
+	// Stores that can't list keys leave the index to the watch
+	idx = index.New(time.Hour)
+	s = NewPresenceService(cache.NewMemoryCache(10, time.Minute), &fakeStore{}, "n1")
+	if err := s.ResyncIndex(context.Background(), idx); err != nil || idx.Ready(context.Background()) != nil {
+		t.Fatalf("expected an index without a resync source to be ready, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gopresence/internal/bloom"
+	"gopresence/internal/metrics"
+	"gopresence/internal/nats"
+)
+
+// seenFilter is a bloom filter of every user ID that has ever been stored,
+// letting lookups for never-seen users skip the cache and KV entirely. It
+// stays permissive (answers "maybe") until its first build from KV keys.
+type seenFilter struct {
+	size   int
+	fpRate float64
+
+	mu    sync.RWMutex
+	cur   *bloom.Filter
+	next  *bloom.Filter // being rebuilt; receives concurrent adds too
+	ready bool
+}
+
+func (f *seenFilter) add(userID string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.cur != nil {
+		f.cur.Add(userID)
+	}
+	if f.next != nil {
+		f.next.Add(userID)
+	}
+}
+
+func (f *seenFilter) mayContain(userID string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !f.ready || f.cur.MayContain(userID)
+}
+
+// EnableSeenFilter turns on the never-seen-user fast path. expectedUsers and
+// fpRate size the bloom filter; call RebuildSeenFilter to arm it.
+func (s *PresenceService) EnableSeenFilter(expectedUsers int, fpRate float64) error {
+	if _, ok := s.store.(nats.KeyLister); !ok {
+		return fmt.Errorf("store cannot list keys")
+	}
+	s.seen = &seenFilter{size: expectedUsers, fpRate: fpRate}
+	return nil
+}
+
+// RebuildSeenFilter rebuilds the filter from the keys in KV, dropping users
+// whose presence has since expired. Users stored or observed while the
+// rebuild runs are added to both the old and the new filter.
+func (s *PresenceService) RebuildSeenFilter(ctx context.Context) error {
+	f := s.seen
+	if f == nil {
+		return nil
+	}
+	next := bloom.New(f.size, f.fpRate)
+	f.mu.Lock()
+	f.next = next
+	f.mu.Unlock()
+
+	keys, err := s.store.(nats.KeyLister).Keys(ctx)
+	if err != nil {
+		f.mu.Lock()
+		f.next = nil
+		f.mu.Unlock()
+		return err
+	}
+	for _, userID := range keys {
+		next.Add(userID)
+	}
+
+	f.mu.Lock()
+	f.cur, f.next, f.ready = next, nil, true
+	f.mu.Unlock()
+	return nil
+}
+
+// RunSeenFilter rebuilds the filter now and then every interval until ctx is done
+func (s *PresenceService) RunSeenFilter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.RebuildSeenFilter(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("seen filter rebuild failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ObserveWatchEvent records users written on any node, keeping the filter
+// current between rebuilds
+func (s *PresenceService) ObserveWatchEvent(we nats.WatchEvent) {
+	if s.seen != nil && we.Type == nats.WatchEventPut {
+		s.seen.add(strings.TrimPrefix(we.Key, "user."))
+	}
+}
+
+// neverSeen reports whether userID is certainly absent from the store
+func (s *PresenceService) neverSeen(userID string) bool {
+	if s.seen == nil || s.seen.mayContain(userID) {
+		return false
+	}
+	metrics.ObserveSeenFilterSkip()
+	return true
+}
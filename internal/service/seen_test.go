@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+// listingStore is a fakeStore that can also list its keys
+type listingStore struct {
+	fakeStore
+	keys  []string
+	reads int
+}
+
+func (f *listingStore) Keys(ctx context.Context) ([]string, error) { return f.keys, nil }
+
+func newListingStore(keys ...string) *listingStore {
+	ls := &listingStore{keys: keys}
+	ls.get = func(ctx context.Context, userID string) (models.Presence, error) {
+		ls.reads++
+		return models.Presence{UserID: userID, Status: models.StatusOnline, UpdatedAt: time.Now().UTC()}, nil
+	}
+	ls.set = func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error { return nil }
+	return ls
+}
+
+func TestSeenFilter_ShortCircuitsNeverSeenUsers(t *testing.T) {
+	store := newListingStore("u1")
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	if err := s.EnableSeenFilter(1000, 0.001); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	ctx := context.Background()
+
+	// Not armed until the first rebuild: lookups pass through
+	if _, err := s.GetPresence(ctx, "ghost"); err != nil || store.reads != 1 {
+		t.Fatalf("expected pass-through before rebuild, err=%v reads=%d", err, store.reads)
+	}
+
+	if err := s.RebuildSeenFilter(ctx); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	store.reads = 0
+	_, err := s.GetPresence(ctx, "ghost2")
+	var nf *PresenceNotFoundError
+	if !errors.As(err, &nf) || store.reads != 0 {
+		t.Fatalf("expected not found without a store read, err=%v reads=%d", err, store.reads)
+	}
+	if _, err := s.GetPresence(ctx, "u1"); err != nil || store.reads != 1 {
+		t.Fatalf("expected known user to be read, err=%v reads=%d", err, store.reads)
+	}
+}
+
+func TestSeenFilter_LearnsFromWritesAndWatch(t *testing.T) {
+	store := newListingStore()
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	if err := s.EnableSeenFilter(1000, 0.001); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.RebuildSeenFilter(ctx); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+
+	if err := s.SetPresence(ctx, "local", models.Presence{UserID: "local", Status: models.StatusOnline, TTL: time.Minute}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	s.ObserveWatchEvent(nats.WatchEvent{Key: "user.remote", Type: nats.WatchEventPut})
+
+	if s.neverSeen("local") || s.neverSeen("remote") {
+		t.Fatalf("expected written and watched users to be recorded")
+	}
+	if !s.neverSeen("ghost") {
+		t.Fatalf("expected unknown user to be filtered")
+	}
+}
+
+func TestEnableSeenFilter_RequiresKeyLister(t *testing.T) {
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), &fakeStore{}, "n1")
+	if err := s.EnableSeenFilter(1000, 0.01); err == nil {
+		t.Fatalf("expected error for a store without key listing")
+	}
+}
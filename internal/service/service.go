@@ -3,12 +3,21 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"gopresence/internal/cache"
 	"gopresence/internal/config"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/metrics"
 	"gopresence/internal/models"
 	"gopresence/internal/nats"
+	"gopresence/internal/sinks"
+	"gopresence/internal/webhooks"
+	"gopresence/internal/timing"
+	"gopresence/internal/writebehind"
 )
 
 // PresenceService implements the core business logic for presence management
@@ -16,10 +25,30 @@ type PresenceService struct {
 	cache cache.MemoryCache
 	store nats.KVStore
 	nodeID string
+	freshness *freshness
+	seen *seenFilter // optional never-seen-user fast path
+	conn *connectionState // NATS connectivity, when built with an observer
+	health storeHealth // latest bucket replication snapshot
+	misses missRatio // cache miss ratio of batch reads, for cost estimates
+	batchBudget int // max projected store reads per batch read (0: unlimited)
+	behind *writebehind.Queue // optional offline write-behind queue
+	shadow *shadowReads // optional candidate store compared on reads
+	annotations AnnotationView // optional annotations merged into reads
+	reads singleflight.Group // collapses concurrent store reads of one user
+	coalesce *coalescer // optional hold-back of presence refreshes
 }
 
 // Ready checks whether dependencies are available (e.g., KV store)
 func (s *PresenceService) Ready(ctx context.Context) error {
+	// With write-behind, writes and cached reads keep working while offline
+	if s.conn != nil && s.behind == nil {
+		if err := s.conn.check(); err != nil {
+			return err
+		}
+	}
+	if s.Standby() {
+		return errStandby
+	}
 	// Use a lightweight call to validate store connectivity
 	_, err := s.store.GetMultiple(ctx, []string{})
 	return err
@@ -28,110 +57,315 @@ func (s *PresenceService) Ready(ctx context.Context) error {
 // NewPresenceService creates a new presence service
 func NewPresenceService(cache cache.MemoryCache, store nats.KVStore, nodeID string) *PresenceService {
 	return &PresenceService{
-		cache:  cache,
-		store:  store,
-		nodeID: nodeID,
+		cache:     cache,
+		store:     store,
+		nodeID:    nodeID,
+		freshness: newFreshness(),
 	}
 }
 
 // GetPresence retrieves a user's presence, checking cache first
 func (s *PresenceService) GetPresence(ctx context.Context, userID string) (models.Presence, error) {
+	if s.neverSeen(userID) {
+		return models.Presence{}, apperrors.NotFound(userID)
+	}
+
 	// Try cache first
-	if presence, found := s.cache.Get(userID); found {
+	done := timing.Start(ctx, timing.Cache)
+	presence, found := s.cache.Get(userID)
+	done()
+	if found {
 		// Check if expired
 		if !presence.IsExpired() {
-			return presence, nil
+			return s.annotated(userID, presence), nil
 		}
 		// Remove expired entry from cache
 		s.cache.Delete(userID)
+		s.freshness.forget(userID)
 	}
 
 	// Fall back to KV store
-	presence, err := s.store.Get(ctx, userID)
+	done = timing.Start(ctx, timing.Store)
+	presence, err := s.load(ctx, userID)
+	done()
 	if err != nil {
-		return models.Presence{}, &PresenceNotFoundError{UserID: userID}
+		return models.Presence{}, err
 	}
+	return s.annotated(userID, presence), nil
+}
 
-	// Cache the result
-	s.cache.Set(userID, presence, presence.TTL)
+// load reads a user's presence from the store into the cache. Concurrent
+// cache misses for the same user share a single store read, so a popular
+// user's entry expiring doesn't send every reader to KV at once. The shared
+// read isn't canceled with the caller that started it; each caller stops
+// waiting when its own context is done.
+func (s *PresenceService) load(ctx context.Context, userID string) (models.Presence, error) {
+	ch := s.reads.DoChan(userID, func() (interface{}, error) {
+		presence, err := s.store.Get(context.WithoutCancel(ctx), userID)
+		if err != nil {
+			if apperrors.IsNotFound(err) {
+				s.shadowRead([]string{userID}, nil)
+				return nil, apperrors.NotFound(userID)
+			}
+			return nil, err
+		}
+		s.shadowRead([]string{userID}, map[string]models.Presence{userID: presence})
 
-	return presence, nil
+		// Cache the result
+		s.cache.Set(userID, presence, presence.TTL)
+		s.freshness.loaded(userID, presence.TTL)
+		return presence, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Shared {
+			metrics.ObserveSharedRead()
+		}
+		if res.Err != nil {
+			return models.Presence{}, res.Err
+		}
+		return res.Val.(models.Presence), nil
+	case <-ctx.Done():
+		return models.Presence{}, ctx.Err()
+	}
 }
 
 // SetPresence sets a user's presence in both cache and store
 func (s *PresenceService) SetPresence(ctx context.Context, userID string, presence models.Presence) error {
+	if err := s.prepare(ctx, userID, &presence); err != nil {
+		return err
+	}
+	return s.commit(ctx, userID, &presence)
+}
+
+// commit stores a prepared presence in both cache and store
+func (s *PresenceService) commit(ctx context.Context, userID string, presence *models.Presence) error {
+	// Record the user before the write lands so a concurrent read can't be short-circuited
+	if s.seen != nil {
+		s.seen.add(userID)
+	}
+
+	// Store in KV store first; refreshes within the coalescing interval only
+	// reach the cache for now
+	if s.coalesce != nil && s.coalesce.hold(userID, presence) {
+		metrics.ObserveCoalescedWrite()
+	} else {
+		if err := s.write(ctx, userID, presence); err != nil {
+			return fmt.Errorf("failed to store presence: %w", err)
+		}
+		if s.coalesce != nil {
+			s.coalesce.wrote(userID, *presence)
+		}
+	}
+
+	// Update cache
+	done := timing.Start(ctx, timing.Cache)
+	s.cache.Set(userID, *presence, presence.TTL)
+	done()
+	s.freshness.loaded(userID, presence.TTL)
+
+	return nil
+}
+
+// CheckPresence runs the checks of SetPresence without writing anything, and
+// returns the presence SetPresence would store
+func (s *PresenceService) CheckPresence(ctx context.Context, userID string, presence models.Presence) (models.Presence, error) {
+	if err := s.prepare(ctx, userID, &presence); err != nil {
+		return models.Presence{}, err
+	}
+	return presence, nil
+}
+
+// prepare stamps presence with this node and the time of the write, and
+// checks it is valid and allowed
+func (s *PresenceService) prepare(ctx context.Context, userID string, presence *models.Presence) error {
 	// Set node ID and timestamps
 	presence.NodeID = s.nodeID
 	presence.UpdatedAt = time.Now().UTC()
 	presence.LastSeen = presence.UpdatedAt
+	// Writes that don't say otherwise come from the public API
+	if presence.Source == "" {
+		presence.Source = models.SourceAPI
+	}
+	// Annotations are the annotation store's, never written with the presence
+	presence.Annotations = nil
 
 	// Validate presence
 	if err := presence.Validate(); err != nil {
 		return fmt.Errorf("invalid presence: %w", err)
 	}
+	return s.checkTransition(ctx, userID, *presence)
+}
 
-	// Store in KV store first
-	if err := s.store.Set(ctx, userID, presence, presence.TTL); err != nil {
-		return fmt.Errorf("failed to store presence: %w", err)
+// checkTransition rejects a status change the configured state machine does
+// not allow. A user without a presence counts as offline, and administrators
+// may force any change.
+func (s *PresenceService) checkTransition(ctx context.Context, userID string, presence models.Presence) error {
+	m := models.CurrentStateMachine()
+	if !m.Restricted() || presence.Source == models.SourceAdmin {
+		return nil
 	}
+	from := models.StatusOffline
+	current, err := s.GetPresence(ctx, userID)
+	switch {
+	case err == nil:
+		from = current.Status
+	case !apperrors.IsNotFound(err):
+		return fmt.Errorf("failed to read current status: %w", err)
+	}
+	if !m.Allows(from, presence.Status) {
+		return &apperrors.TransitionError{UserID: userID, From: string(from), To: string(presence.Status)}
+	}
+	return nil
+}
 
-	// Update cache
-	s.cache.Set(userID, presence, presence.TTL)
-
+// put writes presence to the store, recording the new revision on it when
+// the store reports one so cached reads still expose the entry's revision
+func (s *PresenceService) put(ctx context.Context, userID string, presence *models.Presence) error {
+	defer timing.Start(ctx, timing.Store)()
+	rs, ok := s.store.(nats.RevisionSetter)
+	if !ok {
+		return s.store.Set(ctx, userID, *presence, presence.TTL)
+	}
+	rev, err := rs.SetWithRevision(ctx, userID, *presence, presence.TTL)
+	if err != nil {
+		return err
+	}
+	presence.Revision = rev
 	return nil
 }
 
-// GetMultiplePresences retrieves multiple users' presences
+// GetMultiplePresences retrieves multiple users' presences; repeated IDs are
+// read once
 func (s *PresenceService) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	userIDs = uniqueIDs(userIDs)
+	if err := s.CheckBatchBudget(userIDs); err != nil {
+		return nil, err
+	}
 	result := make(map[string]models.Presence)
 	var missingUsers []string
 
 	// Check cache first
+	done := timing.Start(ctx, timing.Cache)
 	for _, userID := range userIDs {
+		if s.neverSeen(userID) {
+			continue
+		}
 		if presence, found := s.cache.Get(userID); found && !presence.IsExpired() {
 			result[userID] = presence
 		} else {
 			if found && presence.IsExpired() {
 				s.cache.Delete(userID)
+				s.freshness.forget(userID)
 			}
 			missingUsers = append(missingUsers, userID)
 		}
 	}
 
+	done()
+	s.misses.observe(len(userIDs), len(missingUsers))
+
 	// Fetch missing users from store
 	if len(missingUsers) > 0 {
+		done := timing.Start(ctx, timing.Store)
 		storeResults, err := s.store.GetMultiple(ctx, missingUsers)
+		done()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get presences from store: %w", err)
 		}
+		s.shadowRead(missingUsers, storeResults)
 
 		// Add store results to final result and cache them
 		for userID, presence := range storeResults {
 			result[userID] = presence
 			s.cache.Set(userID, presence, presence.TTL)
+			s.freshness.loaded(userID, presence.TTL)
 		}
 	}
 
+	s.annotate(result)
 	return result, nil
 }
 
+// uniqueIDs returns userIDs without repeats, keeping first occurrences in order
+func uniqueIDs(userIDs []string) []string {
+	seen := make(map[string]struct{}, len(userIDs))
+	unique := userIDs[:0:0]
+	for _, id := range userIDs {
+		if _, dup := seen[id]; !dup {
+			seen[id] = struct{}{}
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// Watch subscribes to store changes, delivering them to callback until ctx is done
+func (s *PresenceService) Watch(ctx context.Context, callback func(nats.WatchEvent)) error {
+	return s.store.Watch(ctx, callback)
+}
+
+// OpenCounters opens a bucket of counters shared through the store, such as
+// the quota usage counters
+func (s *PresenceService) OpenCounters(ctx context.Context, bucket string) (*nats.Counters, error) {
+	co, ok := s.store.(nats.CounterOpener)
+	if !ok {
+		return nil, fmt.Errorf("store does not support counters")
+	}
+	return co.OpenCounters(ctx, bucket)
+}
+
+// OpenAnnotations opens the bucket of presence annotations shared through the store
+func (s *PresenceService) OpenAnnotations(ctx context.Context, bucket string) (*nats.Annotations, error) {
+	ao, ok := s.store.(nats.AnnotationOpener)
+	if !ok {
+		return nil, fmt.Errorf("store does not support annotations")
+	}
+	return ao.OpenAnnotations(ctx, bucket)
+}
+
+// ServeProxy answers the store requests of proxy nodes from this node's
+// bucket until ctx is done
+func (s *PresenceService) ServeProxy(ctx context.Context) error {
+	ps, ok := s.store.(nats.ProxyServer)
+	if !ok {
+		return fmt.Errorf("store does not serve proxy nodes")
+	}
+	return ps.ServeProxy(ctx)
+}
+
+// EventBus returns the store's change stream for event sinks
+func (s *PresenceService) EventBus() (nats.EventBus, error) {
+	bus, ok := s.store.(nats.EventBus)
+	if !ok {
+		return nil, fmt.Errorf("store does not support event sinks")
+	}
+	return bus, nil
+}
+
 // Close closes the service and its dependencies
 func (s *PresenceService) Close() error {
+	if s.coalesce != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+		if _, err := s.FlushCoalesced(ctx, true); err != nil {
+			log.Printf("coalesced presence writes lost on close: %v", err)
+		}
+		cancel()
+	}
 	if err := s.store.Close(); err != nil {
 		return fmt.Errorf("failed to close store: %w", err)
 	}
+	if s.shadow != nil {
+		if err := s.shadow.store.Close(); err != nil {
+			return fmt.Errorf("failed to close shadow store: %w", err)
+		}
+	}
 	s.cache.Clear()
 	return nil
 }
 
 // PresenceNotFoundError represents an error when a presence is not found
-type PresenceNotFoundError struct {
-	UserID string
-}
-
-func (e *PresenceNotFoundError) Error() string {
-	return fmt.Sprintf("presence not found for user %s", e.UserID)
-}
+type PresenceNotFoundError = apperrors.NotFoundError
 
 // ServiceBuilder helps build a complete presence service
 type ServiceBuilder struct {
@@ -169,18 +403,12 @@ func (b *ServiceBuilder) Build() (*PresenceService, error) {
 		memCache = cache.NewMemoryCache(b.config.Cache.MaxSize, cacheTTL)
 	}
 
-	// Create NATS KV store
-	natsConfig := nats.KVConfig{
-		ServerURL:    b.config.NATS.ServerURL,
-		BucketName:   b.config.NATS.KVBucket,
-		Embedded:     b.config.NATS.Embedded,
-		DataDir:      b.config.NATS.DataDir,
-		NodeType:     b.config.Service.NodeType,
-		CenterURL:    b.config.NATS.CenterURL,
-		LeafPort:     b.config.NATS.LeafPort,
-		ClusterPort:  b.config.NATS.ClusterPort,
-		StartTimeout: b.config.NATS.StartTimeout,
+	natsConfig, err := b.kvConfig()
+	if err != nil {
+		return nil, err
 	}
+	conn := &connectionState{}
+	natsConfig.Observer = conn
 
 	store, err := nats.NewKVStore(natsConfig)
 	if err != nil {
@@ -189,6 +417,155 @@ func (b *ServiceBuilder) Build() (*PresenceService, error) {
 
 	// Create presence service
 	service := NewPresenceService(memCache, store, b.config.Service.NodeID)
+	service.conn = conn
+	service.SetBatchReadBudget(b.config.API.BatchReadBudget)
+
+	// Shadow reads against the candidate store of a migration, opened as a
+	// leaf so that nothing is declared on the candidate cluster
+	if b.config.NATS.ShadowURL != "" {
+		candidate, err := nats.NewKVStore(nats.KVConfig{
+			CenterURL:        b.config.NATS.ShadowURL,
+			BucketName:       b.config.NATS.Scoped(b.config.NATS.GetShadowBucket()),
+			NodeType:         "leaf",
+			ReconnectWait:    natsConfig.ReconnectWait,
+			ReconnectMaxWait: natsConfig.ReconnectMaxWait,
+			MaxReconnects:    natsConfig.MaxReconnects,
+			ReadTimeout:      natsConfig.ReadTimeout,
+			WriteTimeout:     natsConfig.WriteTimeout,
+			WatchTimeout:     natsConfig.WatchTimeout,
+		})
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("failed to open shadow store: %w", err)
+		}
+		service.EnableShadowReads(candidate, b.config.NATS.ShadowSampleRate)
+	}
 
 	return service, nil
 }
+
+// Bootstrap declares the JetStream resources of the configuration on the
+// NATS server and returns, without building the service; provisioning
+// pipelines run it ahead of the nodes
+func (b *ServiceBuilder) Bootstrap(ctx context.Context) error {
+	natsConfig, err := b.kvConfig()
+	if err != nil {
+		return err
+	}
+	if natsConfig.Embedded || (natsConfig.NodeType != "" && natsConfig.NodeType != "center") {
+		return fmt.Errorf("bootstrap needs a center node type and an external NATS server (NATS_EMBEDDED=false)")
+	}
+	return nats.Bootstrap(ctx, natsConfig)
+}
+
+// kvConfig maps the NATS configuration to the store's
+func (b *ServiceBuilder) kvConfig() (nats.KVConfig, error) {
+	resources, err := b.resources()
+	if err != nil {
+		return nats.KVConfig{}, err
+	}
+	reconnectWait, err := b.config.NATS.GetReconnectWait()
+	if err != nil {
+		return nats.KVConfig{}, fmt.Errorf("invalid NATS reconnect wait: %w", err)
+	}
+	reconnectMaxWait, err := b.config.NATS.GetReconnectMaxWait()
+	if err != nil {
+		return nats.KVConfig{}, fmt.Errorf("invalid NATS reconnect max wait: %w", err)
+	}
+	readTimeout, writeTimeout, watchTimeout, err := b.config.NATS.GetOpTimeouts()
+	if err != nil {
+		return nats.KVConfig{}, fmt.Errorf("invalid NATS operation timeout: %w", err)
+	}
+	watchOverflow, err := nats.ParseOverflowPolicy(b.config.NATS.WatchOverflow)
+	if err != nil {
+		return nats.KVConfig{}, fmt.Errorf("invalid NATS watch overflow policy: %w", err)
+	}
+	formerKeyPrefixes, err := b.config.NATS.GetFormerKeyPrefixes()
+	if err != nil {
+		return nats.KVConfig{}, fmt.Errorf("invalid NATS former key prefixes: %w", err)
+	}
+	return nats.KVConfig{
+		ServerURL:    b.config.NATS.ServerURL,
+		BucketName:   b.config.NATS.Scoped(b.config.NATS.KVBucket),
+		Embedded:     b.config.NATS.Embedded,
+		DataDir:      b.config.NATS.DataDir,
+		NodeType:     b.config.Service.NodeType,
+		CenterURL:    b.config.NATS.CenterURL,
+		LeafPort:     b.config.NATS.LeafPort,
+		ClusterPort:  b.config.NATS.ClusterPort,
+		StartTimeout: b.config.NATS.StartTimeout,
+
+		Domain:        b.config.NATS.JetStreamDomain,
+		PrimaryURL:    b.config.NATS.PrimaryURL,
+		PrimaryDomain: b.config.NATS.PrimaryDomain,
+
+		ClusterRoutes:      b.config.NATS.GetClusterRoutes(),
+		JetStreamMaxMemory: b.config.NATS.JetStreamMaxMemory,
+		JetStreamMaxStore:  b.config.NATS.JetStreamMaxStore,
+		Resources:          resources,
+
+		ReconnectWait:    reconnectWait,
+		ReconnectMaxWait: reconnectMaxWait,
+		MaxReconnects:    b.config.NATS.MaxReconnects,
+
+		ReadTimeout:     readTimeout,
+		WriteTimeout:    writeTimeout,
+		WatchTimeout:    watchTimeout,
+		ReadConcurrency: b.config.NATS.ReadConcurrency,
+
+		FormerKeyPrefixes: formerKeyPrefixes,
+
+		WatchBuffer:   b.config.NATS.WatchBuffer,
+		WatchOverflow: watchOverflow,
+
+		ServerDebug: b.config.NATS.ServerDebug,
+		ServerTrace: b.config.NATS.ServerTrace,
+	}, nil
+}
+
+// resources are the JetStream resources the configured features need: the
+// presence bucket, the quota and annotation buckets when enabled, the
+// consumers of webhooks, and the consumers and streams of at-least-once event
+// sinks, named in the configured environment
+func (b *ServiceBuilder) resources() (nats.Resources, error) {
+	kvTTL, err := b.config.NATS.GetKVTTL()
+	if err != nil {
+		return nats.Resources{}, fmt.Errorf("invalid NATS KV TTL: %w", err)
+	}
+	if kvTTL <= 0 {
+		kvTTL = time.Hour // The presence bucket always expires entries
+	}
+	replicas := b.config.NATS.KVReplicas
+	res := nats.Resources{Buckets: []nats.BucketSpec{{Name: b.config.NATS.Scoped(b.config.NATS.KVBucket), TTL: kvTTL, History: uint8(b.config.NATS.KVHistory), Replicas: replicas}}}
+	if b.config.Quota.Enabled {
+		retention, err := b.config.Quota.GetRetention()
+		if err != nil {
+			return nats.Resources{}, fmt.Errorf("invalid quota retention: %w", err)
+		}
+		res.Buckets = append(res.Buckets, nats.BucketSpec{Name: b.config.NATS.Scoped(b.config.Quota.Bucket), TTL: retention, Replicas: replicas})
+	}
+	if len(b.config.Annotations.GetNamespaces()) > 0 {
+		res.Buckets = append(res.Buckets, nats.BucketSpec{Name: b.config.NATS.Scoped(b.config.Annotations.Bucket), Replicas: replicas})
+	}
+	sinkConfigs, err := b.config.Sinks.GetSinks()
+	if err != nil {
+		return nats.Resources{}, fmt.Errorf("invalid event sinks: %w", err)
+	}
+	for _, sc := range sinkConfigs {
+		if sinks.Mode(sc.Mode) != sinks.AtLeastOnce {
+			continue
+		}
+		res.Consumers = append(res.Consumers, sinks.ConsumerName(sc.Name))
+		if sc.Kind == sinks.KindNATS {
+			res.Streams = append(res.Streams, nats.StreamSpec{Name: b.config.NATS.Scoped(sinks.StreamName(sc.Name)), Subjects: []string{b.config.NATS.ScopedSubject(sc.Target)}, Replicas: replicas})
+		}
+	}
+	hooks, err := b.config.Webhooks.GetEndpoints()
+	if err != nil {
+		return nats.Resources{}, fmt.Errorf("invalid webhooks: %w", err)
+	}
+	for _, hook := range hooks {
+		res.Consumers = append(res.Consumers, webhooks.ConsumerName(hook.Name))
+	}
+	return res, nil
+}
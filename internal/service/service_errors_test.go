@@ -3,18 +3,24 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
 	"gopresence/internal/models"
 	"gopresence/internal/nats"
+	"gopresence/internal/timing"
 )
 
 type fakeStore struct {
 	get   func(ctx context.Context, userID string) (models.Presence, error)
 	set   func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error
 	close func() error
+	multi func(ctx context.Context, ids []string) (map[string]models.Presence, error)
 }
 
 func (f *fakeStore) Get(ctx context.Context, userID string) (models.Presence, error) {
@@ -25,6 +31,9 @@ func (f *fakeStore) Set(ctx context.Context, userID string, p models.Presence, t
 }
 func (f *fakeStore) Delete(ctx context.Context, userID string) error { return nil }
 func (f *fakeStore) GetMultiple(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+	if f.multi != nil {
+		return f.multi(ctx, ids)
+	}
 	return map[string]models.Presence{}, nil
 }
 func (f *fakeStore) Watch(ctx context.Context, cb func(nats.WatchEvent)) error { return nil }
@@ -49,6 +58,119 @@ func TestGetPresence_CacheExpiredFallsBack(t *testing.T) {
 	}
 }
 
+func TestGetPresence_ClassifiesStoreErrors(t *testing.T) {
+	down := errors.New("store down")
+	fs := &fakeStore{get: func(ctx context.Context, userID string) (models.Presence, error) {
+		if userID == "missing" {
+			return models.Presence{}, fmt.Errorf("get: %w", apperrors.NotFound(userID))
+		}
+		return models.Presence{}, down
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+
+	_, err := s.GetPresence(context.Background(), "missing")
+	var nf *PresenceNotFoundError
+	if !errors.As(err, &nf) || nf.UserID != "missing" {
+		t.Fatalf("expected PresenceNotFoundError, got %v", err)
+	}
+	// Store failures are no longer reported as a missing presence
+	if _, err := s.GetPresence(context.Background(), "u1"); !errors.Is(err, down) || apperrors.IsNotFound(err) {
+		t.Fatalf("expected store error to propagate, got %v", err)
+	}
+}
+
+func TestGetPresence_CollapsesConcurrentMisses(t *testing.T) {
+	var reads atomic.Int32
+	release := make(chan struct{})
+	fs := &fakeStore{get: func(ctx context.Context, userID string) (models.Presence, error) {
+		reads.Add(1)
+		<-release
+		return models.Presence{UserID: userID, Status: models.StatusOnline, UpdatedAt: time.Now().UTC()}, nil
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+
+	// A reader that gives up stops waiting without failing the shared read
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.GetPresence(ctx, "celebrity")
+		errs <- err
+	}()
+	for reads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p, err := s.GetPresence(context.Background(), "celebrity"); err != nil || p.UserID != "celebrity" {
+				t.Errorf("GetPresence: %+v %v", p, err)
+			}
+		}()
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the canceled reader to stop waiting, got %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := reads.Load(); n != 1 {
+		t.Fatalf("expected 1 store read, got %d", n)
+	}
+}
+
+type revisionStore struct {
+	fakeStore
+	rev uint64
+}
+
+func (r *revisionStore) SetWithRevision(ctx context.Context, userID string, p models.Presence, ttl time.Duration) (uint64, error) {
+	r.rev++
+	return r.rev, nil
+}
+
+func TestSetPresence_CachesStoreRevision(t *testing.T) {
+	store := &revisionStore{}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline, TTL: time.Minute}
+	for i := 0; i < 2; i++ {
+		if err := s.SetPresence(context.Background(), "u1", p); err != nil {
+			t.Fatalf("SetPresence: %v", err)
+		}
+	}
+	// Served from cache: the store's Get would panic on the nil func
+	got, err := s.GetPresence(context.Background(), "u1")
+	if err != nil || got.Revision != 2 {
+		t.Fatalf("expected cached revision 2, got %d (%v)", got.Revision, err)
+	}
+}
+
+func TestSetPresence_RecordsSource(t *testing.T) {
+	var stored []models.PresenceSource
+	fs := &fakeStore{set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+		stored = append(stored, p.Source)
+		return nil
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	p := models.Presence{UserID: "u1", Status: models.StatusOnline}
+	if err := s.SetPresence(context.Background(), "u1", p); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+	p.Source = models.SourceAutoAway
+	if err := s.SetPresence(context.Background(), "u1", p); err != nil {
+		t.Fatalf("SetPresence: %v", err)
+	}
+	if len(stored) != 2 || stored[0] != models.SourceAPI || stored[1] != models.SourceAutoAway {
+		t.Fatalf("expected api then auto-away, got %v", stored)
+	}
+	p.Source = "import"
+	if err := s.SetPresence(context.Background(), "u1", p); err == nil {
+		t.Fatal("expected unknown source to be rejected")
+	}
+}
+
 func TestSetPresence_ValidateAndStoreErrors(t *testing.T) {
 	mc := cache.NewMemoryCache(10, time.Minute)
 	// invalid presence (empty user id inside presence after service sets id) won't fail Validate, so use invalid status
@@ -78,3 +200,102 @@ func TestClose_StoreCloseError(t *testing.T) {
 		t.Fatalf("expected close error")
 	}
 }
+
+func TestSetPresence_EnforcesTransitions(t *testing.T) {
+	m, err := models.NewStateMachine([]models.PresenceStatus{"in-call"}, map[models.PresenceStatus][]models.PresenceStatus{
+		"in-call":            {models.StatusOnline, models.StatusBusy},
+		models.StatusOffline: {models.StatusOnline},
+	})
+	if err != nil {
+		t.Fatalf("NewStateMachine: %v", err)
+	}
+	models.SetStateMachine(m)
+	t.Cleanup(func() { models.SetStateMachine(nil) })
+
+	stored := map[string]models.Presence{}
+	fs := &fakeStore{
+		get: func(ctx context.Context, userID string) (models.Presence, error) {
+			if p, ok := stored[userID]; ok {
+				return p, nil
+			}
+			return models.Presence{}, apperrors.NotFound(userID)
+		},
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			stored[userID] = p
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	set := func(status models.PresenceStatus, source models.PresenceSource) error {
+		return s.SetPresence(context.Background(), "u1", models.Presence{UserID: "u1", Status: status, Source: source})
+	}
+
+	// A user without a presence is offline, which may only go online
+	var te *apperrors.TransitionError
+	if err := set("in-call", ""); !errors.As(err, &te) || te.From != "offline" || te.To != "in-call" {
+		t.Fatalf("expected offline -> in-call to be rejected, got %v", err)
+	}
+	if err := set(models.StatusOnline, ""); err != nil {
+		t.Fatalf("offline -> online: %v", err)
+	}
+	if err := set("in-call", ""); err != nil {
+		t.Fatalf("online -> in-call: %v", err)
+	}
+	if err := set(models.StatusAway, models.SourceAutoAway); !apperrors.IsInvalidTransition(err) {
+		t.Fatalf("expected in-call -> away to be rejected, got %v", err)
+	}
+	// Administrators may force any change
+	if err := set(models.StatusAway, models.SourceAdmin); err != nil {
+		t.Fatalf("admin in-call -> away: %v", err)
+	}
+}
+
+func TestCheckPresence_DoesNotWrite(t *testing.T) {
+	m, err := models.NewStateMachine(nil, map[models.PresenceStatus][]models.PresenceStatus{
+		models.StatusOffline: {models.StatusOnline},
+	})
+	if err != nil {
+		t.Fatalf("NewStateMachine: %v", err)
+	}
+	models.SetStateMachine(m)
+	t.Cleanup(func() { models.SetStateMachine(nil) })
+
+	writes := 0
+	fs := &fakeStore{
+		get: func(ctx context.Context, userID string) (models.Presence, error) {
+			return models.Presence{}, apperrors.NotFound(userID)
+		},
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			writes++
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	ctx := context.Background()
+
+	p, err := s.CheckPresence(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusOnline})
+	if err != nil || p.NodeID != "n1" || p.Source != models.SourceAPI || p.UpdatedAt.IsZero() {
+		t.Fatalf("expected the presence a write would store, got %+v, %v", p, err)
+	}
+	if _, err := s.CheckPresence(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusBusy}); !apperrors.IsInvalidTransition(err) {
+		t.Fatalf("expected the transition check to run, got %v", err)
+	}
+	if _, err := s.GetPresence(ctx, "u1"); !apperrors.IsNotFound(err) || writes != 0 {
+		t.Fatalf("expected nothing written or cached, got %d writes, %v", writes, err)
+	}
+}
+
+func TestGetPresence_RecordsTimings(t *testing.T) {
+	fs := &fakeStore{get: func(ctx context.Context, userID string) (models.Presence, error) {
+		time.Sleep(2 * time.Millisecond)
+		return models.Presence{UserID: userID, Status: models.StatusOnline, UpdatedAt: time.Now().UTC()}, nil
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	tm := &timing.Timings{}
+	if _, err := s.GetPresence(timing.NewContext(context.Background(), tm), "u1"); err != nil {
+		t.Fatalf("GetPresence: %v", err)
+	}
+	if tm.Spent(timing.Store) < 2*time.Millisecond {
+		t.Fatalf("expected the store read to be timed, got %s", tm.Spent(timing.Store))
+	}
+}
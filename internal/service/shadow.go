@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+)
+
+// shadowTimeout bounds a candidate store read
+const shadowTimeout = 5 * time.Second
+
+// maxShadowReads caps candidate store reads in flight; reads past the cap
+// are skipped rather than queued, so a slow candidate never backs up the
+// primary path
+const maxShadowReads = 64
+
+// Shadow read results, the values of the store_shadow_reads_total result label
+const (
+	ShadowMatch      = "match"      // Both stores hold the same presence
+	ShadowMismatch   = "mismatch"   // Both hold the user, with different presences
+	ShadowMissing    = "missing"    // Only the primary holds the user
+	ShadowUnexpected = "unexpected" // Only the candidate holds the user
+	ShadowError      = "error"      // The candidate read failed
+	ShadowSkipped    = "skipped"    // Not compared: too many candidate reads in flight
+)
+
+// ShadowStore is the candidate store of a backend migration, read alongside
+// the primary to validate it before cutover
+type ShadowStore interface {
+	GetMultiple(ctx context.Context, userIDs []string) (map[string]models.Presence, error)
+	Close() error
+}
+
+// shadowReads compares primary store reads against a candidate store
+type shadowReads struct {
+	store  ShadowStore
+	sample float64       // fraction of primary reads compared
+	slots  chan struct{} // candidate reads in flight
+}
+
+// EnableShadowReads turns on shadow reads: a sampleRate fraction of the reads
+// served from the primary store are repeated against candidate in the
+// background, and the outcome per user is counted in
+// store_shadow_reads_total. Responses always come from the primary.
+func (s *PresenceService) EnableShadowReads(candidate ShadowStore, sampleRate float64) {
+	s.shadow = &shadowReads{store: candidate, sample: sampleRate, slots: make(chan struct{}, maxShadowReads)}
+}
+
+// shadowRead compares the primary's answer for userIDs against the
+// candidate without blocking the caller. primary holds the users the primary
+// store returned; the others were not found there.
+func (s *PresenceService) shadowRead(userIDs []string, primary map[string]models.Presence) {
+	sh := s.shadow
+	if sh == nil || len(userIDs) == 0 || (sh.sample < 1 && rand.Float64() >= sh.sample) {
+		return
+	}
+	select {
+	case sh.slots <- struct{}{}:
+	default:
+		metrics.ObserveShadowRead(ShadowSkipped, len(userIDs))
+		return
+	}
+	// The primary's map may be changed by the caller once returned
+	want := make(map[string]models.Presence, len(primary))
+	for id, p := range primary {
+		want[id] = p
+	}
+	ids := append([]string(nil), userIDs...)
+	go func() {
+		defer func() { <-sh.slots }()
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+		got, err := sh.store.GetMultiple(ctx, ids)
+		if err != nil {
+			slog.Debug("shadow read failed", "users", len(ids), "error", err)
+			metrics.ObserveShadowRead(ShadowError, len(ids))
+			return
+		}
+		for _, id := range ids {
+			result := compareShadow(want, got, id)
+			if result != ShadowMatch {
+				slog.Debug("shadow read differs", "user_id", id, "result", result)
+			}
+			metrics.ObserveShadowRead(result, 1)
+		}
+	}()
+}
+
+// compareShadow classifies the candidate's answer for userID
+func compareShadow(primary, candidate map[string]models.Presence, userID string) string {
+	p, inPrimary := primary[userID]
+	c, inCandidate := candidate[userID]
+	switch {
+	case inPrimary && inCandidate:
+		if p.Status == c.Status && p.Message == c.Message && p.UpdatedAt.Equal(c.UpdatedAt) {
+			return ShadowMatch
+		}
+		return ShadowMismatch
+	case inPrimary:
+		return ShadowMissing
+	case inCandidate:
+		return ShadowUnexpected
+	}
+	return ShadowMatch
+}
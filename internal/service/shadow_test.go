@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+)
+
+// candidateStore answers shadow reads from a map and reports each read
+type candidateStore struct {
+	presences map[string]models.Presence
+	reads     chan []string
+}
+
+func (c *candidateStore) GetMultiple(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+	out := make(map[string]models.Presence)
+	for _, id := range ids {
+		if p, ok := c.presences[id]; ok {
+			out[id] = p
+		}
+	}
+	c.reads <- ids
+	return out, nil
+}
+
+func (c *candidateStore) Close() error { return nil }
+
+func TestShadowReads_ComparesStoreReads(t *testing.T) {
+	now := time.Now().UTC()
+	primary := map[string]models.Presence{"u1": {UserID: "u1", Status: models.StatusOnline, UpdatedAt: now}}
+	fs := &fakeStore{get: func(ctx context.Context, userID string) (models.Presence, error) {
+		if p, ok := primary[userID]; ok {
+			return p, nil
+		}
+		return models.Presence{}, apperrors.NotFound(userID)
+	}}
+	candidate := &candidateStore{presences: primary, reads: make(chan []string, 4)}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	s.EnableShadowReads(candidate, 1)
+
+	if _, err := s.GetPresence(context.Background(), "u1"); err != nil {
+		t.Fatalf("GetPresence: %v", err)
+	}
+	if _, err := s.GetPresence(context.Background(), "ghost"); !apperrors.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	for _, want := range []string{"u1", "ghost"} {
+		select {
+		case ids := <-candidate.reads:
+			if len(ids) != 1 || ids[0] != want {
+				t.Fatalf("expected a shadow read of %s, got %v", want, ids)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected a shadow read of %s", want)
+		}
+	}
+
+	// Cache hits don't reach the primary store, so they aren't compared
+	if _, err := s.GetPresence(context.Background(), "u1"); err != nil {
+		t.Fatalf("GetPresence: %v", err)
+	}
+	select {
+	case ids := <-candidate.reads:
+		t.Fatalf("unexpected shadow read of %v", ids)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCompareShadow(t *testing.T) {
+	now := time.Now().UTC()
+	p := models.Presence{Status: models.StatusOnline, Message: "hi", UpdatedAt: now}
+	changed := p
+	changed.Status = models.StatusAway
+	primary := map[string]models.Presence{"same": p, "diff": p, "gone": p}
+	candidate := map[string]models.Presence{"same": p, "diff": changed, "extra": p}
+	cases := map[string]string{
+		"same":  ShadowMatch,
+		"diff":  ShadowMismatch,
+		"gone":  ShadowMissing,
+		"extra": ShadowUnexpected,
+		"none":  ShadowMatch,
+	}
+	for id, want := range cases {
+		if got := compareShadow(primary, candidate, id); got != want {
+			t.Errorf("compareShadow(%s) = %s, want %s", id, got, want)
+		}
+	}
+}
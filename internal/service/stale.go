@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"gopresence/internal/models"
+	"gopresence/internal/timing"
+)
+
+// revalidateTimeout bounds a background cache refresh
+const revalidateTimeout = 5 * time.Second
+
+const (
+	// freshnessPruneInterval is how often loading a presence also drops the
+	// load times of presences whose TTL has run out
+	freshnessPruneInterval = time.Minute
+	// maxFreshnessEntries bounds the load times kept. The cache evicts by
+	// cost without telling the service, so presences without a TTL may be
+	// long gone from it; forgetting one only costs a store read.
+	maxFreshnessEntries = 100000
+)
+
+// freshness tracks when cached presences were loaded, so stale-tolerant reads
+// can report their age, and which users have a background refresh in flight
+type freshness struct {
+	mu         sync.Mutex
+	loadedAt   map[string]loadTime
+	prunedAt   time.Time
+	refreshing map[string]struct{}
+}
+
+// loadTime is when a presence was cached, and when its TTL runs out; a zero
+// expires never does
+type loadTime struct {
+	at, expires time.Time
+}
+
+func (lt loadTime) expired(now time.Time) bool {
+	return !lt.expires.IsZero() && !now.Before(lt.expires)
+}
+
+func newFreshness() *freshness {
+	return &freshness{
+		loadedAt:   make(map[string]loadTime),
+		prunedAt:   time.Now(),
+		refreshing: make(map[string]struct{}),
+	}
+}
+
+// loaded records that userID was cached now with the given TTL
+func (f *freshness) loaded(userID string, ttl time.Duration) {
+	now := time.Now()
+	lt := loadTime{at: now}
+	if ttl > 0 {
+		lt.expires = now.Add(ttl)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loadedAt[userID] = lt
+	if now.Sub(f.prunedAt) >= freshnessPruneInterval || len(f.loadedAt) > maxFreshnessEntries {
+		f.prune(now)
+	}
+}
+
+// prune drops expired load times and, past maxFreshnessEntries, arbitrary
+// ones down to nine tenths of it, so a full map isn't pruned on every load;
+// callers hold f.mu
+func (f *freshness) prune(now time.Time) {
+	f.prunedAt = now
+	for id, lt := range f.loadedAt {
+		if lt.expired(now) {
+			delete(f.loadedAt, id)
+		}
+	}
+	for id := range f.loadedAt {
+		if len(f.loadedAt) <= maxFreshnessEntries*9/10 {
+			break
+		}
+		delete(f.loadedAt, id)
+	}
+}
+
+func (f *freshness) forget(userID string) {
+	f.mu.Lock()
+	delete(f.loadedAt, userID)
+	f.mu.Unlock()
+}
+
+func (f *freshness) reset() {
+	f.mu.Lock()
+	clear(f.loadedAt)
+	f.mu.Unlock()
+}
+
+// sample returns up to n random users with a cached presence
+func (f *freshness) sample(n int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	picked := make([]string, 0, min(n, len(f.loadedAt)))
+	seen := 0
+	for id, lt := range f.loadedAt {
+		if lt.expired(now) {
+			continue
+		}
+		// Reservoir sampling, so every cached user is equally likely
+		if seen < n {
+			picked = append(picked, id)
+		} else if j := rand.IntN(seen + 1); j < n {
+			picked[j] = id
+		}
+		seen++
+	}
+	return picked
+}
+
+// age returns how long ago userID was loaded into the cache
+func (f *freshness) age(userID string) (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lt, ok := f.loadedAt[userID]
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	if lt.expired(now) {
+		delete(f.loadedAt, userID)
+		return 0, false
+	}
+	return now.Sub(lt.at), true
+}
+
+// cached reports whether userID was loaded into the cache and hasn't expired
+// since. The cache may still have evicted it.
+func (f *freshness) cached(userID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lt, ok := f.loadedAt[userID]
+	return ok && !lt.expired(time.Now())
+}
+
+// claim marks userIDs as refreshing and returns those not already in flight
+func (f *freshness) claim(userIDs []string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	claimed := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, busy := f.refreshing[id]; !busy {
+			f.refreshing[id] = struct{}{}
+			claimed = append(claimed, id)
+		}
+	}
+	return claimed
+}
+
+func (f *freshness) release(userIDs []string) {
+	f.mu.Lock()
+	for _, id := range userIDs {
+		delete(f.refreshing, id)
+	}
+	f.mu.Unlock()
+}
+
+// GetMultiplePresencesStale is a stale-while-revalidate read: cached presences
+// loaded within maxStale are served as-is, and those older than half of
+// maxStale are refreshed from the store in the background. Anything missing
+// or older than maxStale is read from the store before returning. The second
+// result is the age of the oldest cached presence served.
+func (s *PresenceService) GetMultiplePresencesStale(ctx context.Context, userIDs []string, maxStale time.Duration) (map[string]models.Presence, time.Duration, error) {
+	userIDs = uniqueIDs(userIDs)
+	if err := s.CheckBatchBudget(userIDs); err != nil {
+		return nil, 0, err
+	}
+	result := make(map[string]models.Presence, len(userIDs))
+	var missing, revalidate []string
+	var maxAge time.Duration
+
+	done := timing.Start(ctx, timing.Cache)
+	for _, userID := range userIDs {
+		if s.neverSeen(userID) {
+			continue
+		}
+		presence, found := s.cache.Get(userID)
+		age, known := s.freshness.age(userID)
+		if !found || !known || age > maxStale || presence.IsExpired() {
+			missing = append(missing, userID)
+			continue
+		}
+		result[userID] = presence
+		if age > maxAge {
+			maxAge = age
+		}
+		if age > maxStale/2 {
+			revalidate = append(revalidate, userID)
+		}
+	}
+
+	done()
+	s.misses.observe(len(userIDs), len(missing))
+
+	if len(missing) > 0 {
+		// Bypass the cache: it may hold copies older than maxStale
+		done := timing.Start(ctx, timing.Store)
+		fetched, err := s.store.GetMultiple(ctx, missing)
+		done()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get presences from store: %w", err)
+		}
+		s.shadowRead(missing, fetched)
+		for userID, presence := range fetched {
+			result[userID] = presence
+			s.cache.Set(userID, presence, presence.TTL)
+			s.freshness.loaded(userID, presence.TTL)
+		}
+	}
+
+	if claimed := s.freshness.claim(revalidate); len(claimed) > 0 {
+		go s.revalidate(claimed)
+	}
+	s.annotate(result)
+	return result, maxAge, nil
+}
+
+// revalidate reloads userIDs from the store into the cache
+func (s *PresenceService) revalidate(userIDs []string) {
+	defer s.freshness.release(userIDs)
+	ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+	defer cancel()
+
+	fetched, err := s.store.GetMultiple(ctx, userIDs)
+	if err != nil {
+		log.Printf("presence revalidation failed: %v", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if presence, ok := fetched[userID]; ok {
+			s.cache.Set(userID, presence, presence.TTL)
+			s.freshness.loaded(userID, presence.TTL)
+		} else {
+			// Gone from the store: drop the cached copy
+			s.cache.Delete(userID)
+			s.freshness.forget(userID)
+		}
+	}
+}
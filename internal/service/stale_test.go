@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+// versionedStore returns presences whose Message changes on every read
+type versionedStore struct {
+	mu    sync.Mutex
+	reads int
+}
+
+func (f *versionedStore) read(ids []string) map[string]models.Presence {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	m := map[string]models.Presence{}
+	for _, id := range ids {
+		m[id] = models.Presence{UserID: id, Status: models.StatusOnline, Message: string(rune('a' + f.reads)), UpdatedAt: time.Now().UTC()}
+	}
+	return m
+}
+
+func (f *versionedStore) Get(ctx context.Context, userID string) (models.Presence, error) {
+	return f.read([]string{userID})[userID], nil
+}
+func (f *versionedStore) Set(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+	return nil
+}
+func (f *versionedStore) Delete(ctx context.Context, userID string) error { return nil }
+func (f *versionedStore) GetMultiple(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+	return f.read(ids), nil
+}
+func (f *versionedStore) Watch(ctx context.Context, cb func(nats.WatchEvent)) error { return nil }
+func (f *versionedStore) Close() error                                              { return nil }
+
+func (f *versionedStore) readCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+func backdate(s *PresenceService, userID string, age time.Duration) {
+	s.freshness.mu.Lock()
+	lt := s.freshness.loadedAt[userID]
+	lt.at = time.Now().Add(-age)
+	s.freshness.loadedAt[userID] = lt
+	s.freshness.mu.Unlock()
+}
+
+func TestGetMultiplePresencesStale_ServesCachedWithinBound(t *testing.T) {
+	store := &versionedStore{}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	ctx := context.Background()
+
+	// Miss: loaded synchronously
+	got, age, err := s.GetMultiplePresencesStale(ctx, []string{"u1"}, 10*time.Second)
+	if err != nil || got["u1"].Message != "b" || age != 0 || store.readCount() != 1 {
+		t.Fatalf("unexpected first read: %+v age=%v err=%v reads=%d", got, age, err, store.readCount())
+	}
+
+	// Young entry: served from cache without touching the store
+	backdate(s, "u1", 2*time.Second)
+	got, age, _ = s.GetMultiplePresencesStale(ctx, []string{"u1"}, 10*time.Second)
+	if got["u1"].Message != "b" || age < 2*time.Second || store.readCount() != 1 {
+		t.Fatalf("expected cached read, got %+v age=%v reads=%d", got, age, store.readCount())
+	}
+
+	// Past maxStale: reloaded before returning, bypassing the cached copy
+	backdate(s, "u1", 20*time.Second)
+	got, age, _ = s.GetMultiplePresencesStale(ctx, []string{"u1"}, 10*time.Second)
+	if got["u1"].Message != "c" || age != 0 {
+		t.Fatalf("expected synchronous reload, got %+v age=%v", got, age)
+	}
+}
+
+func TestGetMultiplePresencesStale_RevalidatesInBackground(t *testing.T) {
+	store := &versionedStore{}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	ctx := context.Background()
+
+	s.GetMultiplePresencesStale(ctx, []string{"u1"}, 10*time.Second)
+	backdate(s, "u1", 7*time.Second)
+
+	// Stale copy is served immediately while a refresh runs
+	got, age, _ := s.GetMultiplePresencesStale(ctx, []string{"u1"}, 10*time.Second)
+	if got["u1"].Message != "b" || age < 7*time.Second {
+		t.Fatalf("expected stale copy, got %+v age=%v", got, age)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if p, ok := s.cache.Get("u1"); ok && p.Message == "c" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected background revalidation to refresh the cache")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a, _ := s.freshness.age("u1"); a > time.Second {
+		t.Fatalf("expected load time to be reset, age=%v", a)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gopresence/internal/metrics"
+	"gopresence/internal/nats"
+)
+
+// errNoStoreHealth is returned when the store can't describe its bucket
+var errNoStoreHealth = errors.New("store does not report bucket health")
+
+// storeHealth holds the most recent bucket health snapshot
+type storeHealth struct {
+	mu   sync.RWMutex
+	last *nats.BucketHealth
+	err  error
+}
+
+// HealthDetails is the dependency detail reported by /health/details
+type HealthDetails struct {
+	Store      *nats.BucketHealth `json:"store,omitempty"`
+	StoreError string             `json:"store_error,omitempty"`
+	Center     *nats.CenterStatus `json:"center,omitempty"` // Embedded centers with a JetStream domain
+}
+
+// RefreshStoreHealth reads the bucket's replication state, exports it as
+// kv_sync_* metrics and keeps it for HealthDetails
+func (s *PresenceService) RefreshStoreHealth(ctx context.Context) (nats.BucketHealth, error) {
+	hr, ok := s.store.(nats.HealthReporter)
+	if !ok {
+		return nats.BucketHealth{}, errNoStoreHealth
+	}
+	h, err := hr.BucketHealth(ctx)
+
+	s.health.mu.Lock()
+	s.health.err = err
+	if err == nil {
+		s.health.last = &h
+	}
+	s.health.mu.Unlock()
+	if err != nil {
+		return nats.BucketHealth{}, err
+	}
+
+	peers := make([]metrics.KVSync, len(h.Sync))
+	for i, st := range h.Sync {
+		peers[i] = metrics.KVSync{Kind: st.Kind, Peer: st.Name, Lag: st.Lag, LastSync: st.LastSync}
+	}
+	metrics.ObserveKVSync(h.Bucket, h.LastUpdate, peers)
+	return h, nil
+}
+
+// RunStoreHealth refreshes the bucket health now and then every interval
+// until ctx is done
+func (s *PresenceService) RunStoreHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RefreshStoreHealth(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("store health check failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HealthDetails returns the latest bucket health, reading it on demand if
+// no background refresh has completed yet
+func (s *PresenceService) HealthDetails(ctx context.Context) any {
+	s.health.mu.RLock()
+	last, err := s.health.last, s.health.err
+	s.health.mu.RUnlock()
+
+	if last == nil && err == nil {
+		if h, rerr := s.RefreshStoreHealth(ctx); rerr == nil {
+			last = &h
+		} else {
+			err = rerr
+		}
+	}
+
+	var d HealthDetails
+	if last != nil {
+		d.Store = last
+	}
+	if err != nil {
+		d.StoreError = err.Error()
+	}
+	if st, ok := s.CenterStatus(); ok {
+		d.Center = &st
+	}
+	return d
+}
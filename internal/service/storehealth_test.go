@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/nats"
+)
+
+type healthStore struct {
+	fakeStore
+	health nats.BucketHealth
+	err    error
+	calls  int
+}
+
+func (h *healthStore) BucketHealth(ctx context.Context) (nats.BucketHealth, error) {
+	h.calls++
+	return h.health, h.err
+}
+
+func TestHealthDetails_ReportsBucketSync(t *testing.T) {
+	store := &healthStore{health: nats.BucketHealth{
+		Bucket: "presence",
+		Sync:   []nats.SyncStatus{{Kind: nats.SyncMirror, Name: "KV_presence", Lag: 3}},
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+
+	// Read on demand before any background refresh
+	d := s.HealthDetails(context.Background()).(HealthDetails)
+	if d.Store == nil || d.Store.Sync[0].Lag != 3 || d.StoreError != "" {
+		t.Fatalf("unexpected details: %+v", d)
+	}
+
+	// A failed refresh keeps the last snapshot alongside the error
+	store.err = errors.New("stream unavailable")
+	if _, err := s.RefreshStoreHealth(context.Background()); err == nil {
+		t.Fatalf("expected refresh error")
+	}
+	d = s.HealthDetails(context.Background()).(HealthDetails)
+	if d.Store == nil || d.StoreError != "stream unavailable" || store.calls != 2 {
+		t.Fatalf("expected cached snapshot with error, got %+v after %d calls", d, store.calls)
+	}
+}
+
+func TestHealthDetails_StoreWithoutHealth(t *testing.T) {
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), &fakeStore{}, "n1")
+	if _, err := s.RefreshStoreHealth(context.Background()); !errors.Is(err, errNoStoreHealth) {
+		t.Fatalf("expected errNoStoreHealth, got %v", err)
+	}
+	if d := s.HealthDetails(context.Background()).(HealthDetails); d.Store != nil || d.StoreError == "" {
+		t.Fatalf("unexpected details: %+v", d)
+	}
+}
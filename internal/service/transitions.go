@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+// transitionBatch is the number of presences read from KV at a time while
+// scanning for transitions
+const transitionBatch = 500
+
+// TransitionReport is the outcome of one transition scan
+type TransitionReport struct {
+	Scanned   int `json:"scanned"`
+	Away      int `json:"away"`      // Online users marked away after the idle window
+	Offline   int `json:"offline"`   // Users marked offline once their TTL lapsed
+	Conflicts int `json:"conflicts"` // Transitions skipped as the user changed meanwhile
+}
+
+// TransitionPresences scans KV for presences due an automatic change: online
+// users not seen for idle become away, and users whose TTL has lapsed become
+// offline, so watchers see an explicit event instead of a silent expiry. An
+// idle of 0 disables the away transition. Transitions are written with the
+// auto-away source, keep the user's last_seen and, for away, the original
+// expiry.
+func (s *PresenceService) TransitionPresences(ctx context.Context, idle time.Duration) (TransitionReport, error) {
+	var report TransitionReport
+	lister, ok := s.store.(nats.KeyLister)
+	if !ok {
+		return report, fmt.Errorf("store cannot list keys")
+	}
+	keys, err := lister.Keys(ctx)
+	if err != nil {
+		return report, err
+	}
+	for start := 0; start < len(keys); start += transitionBatch {
+		batch := keys[start:min(start+transitionBatch, len(keys))]
+		stored, err := s.store.GetMultiple(ctx, batch)
+		if err != nil {
+			return report, fmt.Errorf("failed to read presences: %w", err)
+		}
+		now := time.Now().UTC()
+		for userID, current := range stored {
+			report.Scanned++
+			next, ok := autoTransition(current, idle, now)
+			if !ok {
+				continue
+			}
+			next.NodeID = s.nodeID
+			if err := s.writeTransition(ctx, userID, current.Revision, &next); err != nil {
+				if errors.Is(err, nats.ErrRevisionMismatch) {
+					report.Conflicts++
+					continue
+				}
+				return report, fmt.Errorf("failed to mark %s %s: %w", userID, next.Status, err)
+			}
+			slog.Debug("presence transitioned", "user_id", userID, "from", current.Status, "to", next.Status)
+			metrics.ObservePresenceTransition(string(next.Status))
+			if next.Status == models.StatusOffline {
+				report.Offline++
+			} else {
+				report.Away++
+			}
+		}
+	}
+	return report, nil
+}
+
+// autoTransition returns the presence p is due to change to at now, if any
+func autoTransition(p models.Presence, idle time.Duration, now time.Time) (models.Presence, bool) {
+	if p.Status == models.StatusOffline {
+		return p, false
+	}
+	next := p
+	next.Source = models.SourceAutoAway
+	next.CorrelationID = "" // The client didn't make this change
+	next.UpdatedAt = now
+	next.Revision, next.StoredAt = 0, time.Time{}
+	expiry := p.UpdatedAt.Add(p.TTL)
+	switch {
+	case p.TTL > 0 && now.After(expiry):
+		// Offline is what a lapsed presence already reads as, so the state
+		// machine has no say
+		next.Status, next.Message, next.TTL = models.StatusOffline, "", 0
+		return next, true
+	case idle > 0 && p.Status == models.StatusOnline && now.Sub(p.LastSeen) > idle:
+		if !models.CurrentStateMachine().Allows(p.Status, models.StatusAway) {
+			return p, false
+		}
+		next.Status = models.StatusAway
+		if p.TTL > 0 {
+			next.TTL = expiry.Sub(now)
+		}
+		return next, true
+	}
+	return p, false
+}
+
+// writeTransition stores an automatic transition and updates the cache. When
+// the store supports it the write only lands if the entry is still at
+// revision, so a user's own update is never overwritten.
+func (s *PresenceService) writeTransition(ctx context.Context, userID string, revision uint64, presence *models.Presence) error {
+	if ru, ok := s.store.(nats.RevisionUpdater); ok && revision != 0 {
+		rev, err := ru.UpdateAtRevision(ctx, userID, *presence, presence.TTL, revision)
+		if err != nil {
+			return err
+		}
+		presence.Revision = rev
+	} else if err := s.put(ctx, userID, presence); err != nil {
+		return err
+	}
+	s.cache.Set(userID, *presence, presence.TTL)
+	s.freshness.loaded(userID, presence.TTL)
+	return nil
+}
+
+// RunPresenceTransitions runs TransitionPresences every interval until ctx is
+// done
+func (s *PresenceService) RunPresenceTransitions(ctx context.Context, interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		// A standby's mirror takes no writes; its primary runs the transitions
+		if s.Standby() {
+			continue
+		}
+		if _, err := s.TransitionPresences(ctx, idle); err != nil && ctx.Err() == nil {
+			log.Printf("presence transitions failed: %v", err)
+		}
+	}
+}
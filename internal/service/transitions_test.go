@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+)
+
+func TestAutoTransition(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name string
+		p    models.Presence
+		want models.PresenceStatus // "" for no transition
+	}{
+		{"active", models.Presence{Status: models.StatusOnline, UpdatedAt: now, LastSeen: now, TTL: time.Hour}, ""},
+		{"idle", models.Presence{Status: models.StatusOnline, UpdatedAt: now.Add(-10 * time.Minute), LastSeen: now.Add(-10 * time.Minute), TTL: time.Hour}, models.StatusAway},
+		{"idle busy", models.Presence{Status: models.StatusBusy, UpdatedAt: now.Add(-10 * time.Minute), LastSeen: now.Add(-10 * time.Minute), TTL: time.Hour}, ""},
+		{"lapsed", models.Presence{Status: models.StatusBusy, UpdatedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-2 * time.Hour), TTL: time.Hour}, models.StatusOffline},
+		{"no ttl", models.Presence{Status: models.StatusAway, UpdatedAt: now.Add(-48 * time.Hour), LastSeen: now.Add(-48 * time.Hour)}, ""},
+		{"offline", models.Presence{Status: models.StatusOffline, UpdatedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-2 * time.Hour), TTL: time.Hour}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			next, ok := autoTransition(tc.p, 5*time.Minute, now)
+			if got := models.PresenceStatus(""); ok {
+				got = next.Status
+				if got != tc.want {
+					t.Fatalf("expected %q, got %q", tc.want, got)
+				}
+			} else if tc.want != "" {
+				t.Fatalf("expected %q, got no transition", tc.want)
+			}
+			if ok && (next.Source != models.SourceAutoAway || !next.LastSeen.Equal(tc.p.LastSeen)) {
+				t.Fatalf("expected an auto-away write keeping last_seen, got %+v", next)
+			}
+		})
+	}
+
+	// The away write keeps the original expiry
+	idle := tests[1].p
+	next, _ := autoTransition(idle, 5*time.Minute, now)
+	if got, want := next.UpdatedAt.Add(next.TTL), idle.UpdatedAt.Add(idle.TTL); !got.Equal(want) {
+		t.Fatalf("expected expiry %s, got %s", want, got)
+	}
+	// The client's correlation ID doesn't carry over to the server's write
+	idle.CorrelationID = "evt-1"
+	if next, _ := autoTransition(idle, 5*time.Minute, now); next.CorrelationID != "" {
+		t.Fatalf("expected the correlation ID to be cleared, got %q", next.CorrelationID)
+	}
+	// Idle 0 disables away
+	if _, ok := autoTransition(idle, 0, now); ok {
+		t.Fatal("expected no away transition with idle 0")
+	}
+}
+
+func TestAutoTransition_HonorsStateMachine(t *testing.T) {
+	m, err := models.NewStateMachine(nil, map[models.PresenceStatus][]models.PresenceStatus{
+		models.StatusOnline: {models.StatusBusy, models.StatusOffline},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.SetStateMachine(m)
+	defer models.SetStateMachine(nil)
+
+	now := time.Now().UTC()
+	idle := models.Presence{Status: models.StatusOnline, UpdatedAt: now.Add(-10 * time.Minute), LastSeen: now.Add(-10 * time.Minute), TTL: time.Hour}
+	if _, ok := autoTransition(idle, 5*time.Minute, now); ok {
+		t.Fatal("expected online->away to be refused")
+	}
+	// A lapsed presence goes offline whatever the rules
+	idle.UpdatedAt = now.Add(-2 * time.Hour)
+	if next, ok := autoTransition(idle, 5*time.Minute, now); !ok || next.Status != models.StatusOffline {
+		t.Fatalf("expected offline, got %+v (%v)", next, ok)
+	}
+}
+
+func newTransitionStore(t *testing.T) nats.KVStore {
+	t.Helper()
+	store, err := nats.NewKVStore(nats.KVConfig{Embedded: true, BucketName: "test-transitions", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewKVStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestTransitionPresences(t *testing.T) {
+	store := newTransitionStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	seed := map[string]models.Presence{
+		"idle":    {Status: models.StatusOnline, Message: "hi", UpdatedAt: now.Add(-10 * time.Minute), LastSeen: now.Add(-10 * time.Minute), TTL: time.Hour},
+		"lapsed":  {Status: models.StatusBusy, UpdatedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-2 * time.Hour), TTL: time.Hour},
+		"active":  {Status: models.StatusOnline, UpdatedAt: now, LastSeen: now, TTL: time.Hour},
+		"offline": {Status: models.StatusOffline, UpdatedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-2 * time.Hour)},
+	}
+	for id, p := range seed {
+		p.UserID, p.NodeID = id, "other"
+		if err := store.Set(ctx, id, p, p.TTL); err != nil {
+			t.Fatalf("Set(%s): %v", id, err)
+		}
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+
+	report, err := s.TransitionPresences(ctx, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("TransitionPresences: %v", err)
+	}
+	if report.Scanned != 4 || report.Away != 1 || report.Offline != 1 || report.Conflicts != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for id, want := range map[string]models.PresenceStatus{"idle": models.StatusAway, "lapsed": models.StatusOffline, "active": models.StatusOnline, "offline": models.StatusOffline} {
+		got, err := store.Get(ctx, id)
+		if err != nil || got.Status != want {
+			t.Errorf("%s: expected %s, got %+v (%v)", id, want, got, err)
+		}
+	}
+	away, _ := store.Get(ctx, "idle")
+	if away.Message != "hi" || away.Source != models.SourceAutoAway || away.NodeID != "n1" || !away.LastSeen.Equal(seed["idle"].LastSeen) {
+		t.Fatalf("unexpected away presence %+v", away)
+	}
+	if cached, ok := s.cache.Get("lapsed"); !ok || cached.Status != models.StatusOffline {
+		t.Fatalf("expected the cache to hold the offline presence, got %+v (%v)", cached, ok)
+	}
+
+	// Nothing is due on the next scan
+	if report, err := s.TransitionPresences(ctx, 5*time.Minute); err != nil || report.Away+report.Offline != 0 {
+		t.Fatalf("expected no further transitions, got %+v (%v)", report, err)
+	}
+}
+
+// racingStore lets a user write land between the transition scan's read and
+// its write
+type racingStore struct {
+	nats.KVStore
+	race func()
+}
+
+func (r *racingStore) Keys(ctx context.Context) ([]string, error) {
+	return r.KVStore.(nats.KeyLister).Keys(ctx)
+}
+
+func (r *racingStore) UpdateAtRevision(ctx context.Context, userID string, p models.Presence, ttl time.Duration, rev uint64) (uint64, error) {
+	return r.KVStore.(nats.RevisionUpdater).UpdateAtRevision(ctx, userID, p, ttl, rev)
+}
+
+func (r *racingStore) GetMultiple(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+	got, err := r.KVStore.GetMultiple(ctx, ids)
+	r.race()
+	return got, err
+}
+
+func TestTransitionPresences_KeepsConcurrentWrites(t *testing.T) {
+	inner := newTransitionStore(t)
+	ctx := context.Background()
+	then := time.Now().UTC().Add(-10 * time.Minute)
+	idle := models.Presence{UserID: "u1", Status: models.StatusOnline, NodeID: "other", UpdatedAt: then, LastSeen: then, TTL: time.Hour}
+	if err := inner.Set(ctx, "u1", idle, idle.TTL); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	store := &racingStore{KVStore: inner}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "n1")
+	store.race = func() {
+		if err := s.SetPresence(ctx, "u1", models.Presence{UserID: "u1", Status: models.StatusBusy, TTL: time.Hour}); err != nil {
+			t.Errorf("SetPresence: %v", err)
+		}
+	}
+
+	report, err := s.TransitionPresences(ctx, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("TransitionPresences: %v", err)
+	}
+	if report.Away != 0 || report.Conflicts != 1 {
+		t.Fatalf("expected one conflict, got %+v", report)
+	}
+	if got, err := inner.Get(ctx, "u1"); err != nil || got.Status != models.StatusBusy {
+		t.Fatalf("expected the user's busy write to survive, got %+v (%v)", got, err)
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+)
+
+// Cache verification results, the values of the cache_integrity_checks_total
+// result label
+const (
+	CacheMatch    = "match"    // The cached copy is the stored presence
+	CacheStale    = "stale"    // KV holds a newer write than the cache
+	CacheOrphaned = "orphaned" // The cache holds a presence KV no longer has
+	CacheConflict = "conflict" // The cache differs from KV without being older
+)
+
+// CacheReport is the outcome of one cache verification run
+type CacheReport struct {
+	Sampled  int            `json:"sampled"`
+	Results  map[string]int `json:"results"`
+	MaxStale time.Duration  `json:"max_stale"`
+}
+
+// VerifyCache compares up to n random cached presences against KV. An entry
+// superseded by a KV write younger than grace is skipped, as its update may
+// still be on the way. Divergent entries are dropped from the cache so the
+// next read reloads them.
+func (s *PresenceService) VerifyCache(ctx context.Context, n int, grace time.Duration) (CacheReport, error) {
+	report := CacheReport{Results: make(map[string]int)}
+	cached := make(map[string]models.Presence)
+	for _, id := range s.freshness.sample(n) {
+		// A held refresh is ahead of KV on purpose
+		if s.coalesce != nil && s.coalesce.pending(id) {
+			continue
+		}
+		if p, ok := s.cache.Get(id); ok && !p.IsExpired() {
+			cached[id] = p
+		}
+	}
+	if len(cached) == 0 {
+		metrics.SetCacheStaleness(0)
+		return report, nil
+	}
+	ids := make([]string, 0, len(cached))
+	for id := range cached {
+		ids = append(ids, id)
+	}
+	stored, err := s.store.GetMultiple(ctx, ids)
+	if err != nil {
+		return report, fmt.Errorf("failed to read sampled presences: %w", err)
+	}
+
+	now := time.Now()
+	for id, c := range cached {
+		p, ok := stored[id]
+		result, staleFor := compareCached(c, p, ok, now)
+		if result == CacheStale && staleFor < grace {
+			continue
+		}
+		report.Sampled++
+		report.Results[result]++
+		metrics.ObserveCacheCheck(result)
+		if result == CacheMatch {
+			continue
+		}
+		slog.Debug("cache diverged from store", "user_id", id, "result", result, "stale_for", staleFor)
+		if staleFor > report.MaxStale {
+			report.MaxStale = staleFor
+		}
+		s.cache.Delete(id)
+		s.freshness.forget(id)
+	}
+	metrics.SetCacheStaleness(report.MaxStale)
+	return report, nil
+}
+
+// compareCached classifies a cached presence against the stored one, and for
+// stale entries reports how long ago KV moved on
+func compareCached(cached, stored models.Presence, inStore bool, now time.Time) (string, time.Duration) {
+	if !inStore {
+		return CacheOrphaned, 0
+	}
+	same := cached.UpdatedAt.Equal(stored.UpdatedAt)
+	newer := stored.UpdatedAt.After(cached.UpdatedAt)
+	// Revisions order writes exactly when both sides know them
+	if cached.Revision != 0 && stored.Revision != 0 {
+		same, newer = cached.Revision == stored.Revision, stored.Revision > cached.Revision
+	}
+	switch {
+	case same && cached.Status == stored.Status && cached.Message == stored.Message:
+		return CacheMatch, 0
+	case newer:
+		return CacheStale, now.Sub(stored.UpdatedAt)
+	}
+	return CacheConflict, 0
+}
+
+// RunCacheVerifier verifies n sampled cache entries every interval until
+// ctx is done
+func (s *PresenceService) RunCacheVerifier(ctx context.Context, interval time.Duration, n int, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if _, err := s.VerifyCache(ctx, n, grace); err != nil && ctx.Err() == nil {
+			log.Printf("cache verification failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	"gopresence/internal/models"
+)
+
+func TestVerifyCache_DropsDivergentEntries(t *testing.T) {
+	old := time.Now().UTC().Add(-time.Minute)
+	stored := map[string]models.Presence{
+		"same":   {UserID: "same", Status: models.StatusOnline, UpdatedAt: old, Revision: 1},
+		"stale":  {UserID: "stale", Status: models.StatusAway, UpdatedAt: old, Revision: 5},
+		"recent": {UserID: "recent", Status: models.StatusAway, UpdatedAt: time.Now().UTC(), Revision: 7},
+	}
+	fs := &fakeStore{multi: func(ctx context.Context, ids []string) (map[string]models.Presence, error) {
+		out := make(map[string]models.Presence)
+		for _, id := range ids {
+			if p, ok := stored[id]; ok {
+				out[id] = p
+			}
+		}
+		return out, nil
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "n1")
+	cached := map[string]models.Presence{
+		"same":   stored["same"],
+		"stale":  {UserID: "stale", Status: models.StatusOnline, UpdatedAt: old.Add(-time.Minute), Revision: 4},
+		"recent": {UserID: "recent", Status: models.StatusOnline, UpdatedAt: old, Revision: 6},
+		"gone":   {UserID: "gone", Status: models.StatusBusy, UpdatedAt: old, Revision: 2},
+	}
+	for id, p := range cached {
+		p.TTL = time.Hour
+		s.cache.Set(id, p, p.TTL)
+		s.freshness.loaded(id, p.TTL)
+	}
+
+	report, err := s.VerifyCache(context.Background(), 10, 5*time.Second)
+	if err != nil {
+		t.Fatalf("VerifyCache: %v", err)
+	}
+	// "recent" was superseded within the grace period and isn't judged yet
+	if report.Sampled != 3 || report.Results[CacheMatch] != 1 || report.Results[CacheStale] != 1 || report.Results[CacheOrphaned] != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.MaxStale < time.Minute {
+		t.Fatalf("expected a minute of staleness, got %s", report.MaxStale)
+	}
+	for id, want := range map[string]bool{"same": true, "recent": true, "stale": false, "gone": false} {
+		if _, ok := s.cache.Get(id); ok != want {
+			t.Errorf("cached %s = %v, want %v", id, ok, want)
+		}
+	}
+}
+
+func TestFreshness_Sample(t *testing.T) {
+	f := newFreshness()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		f.loaded(id, 0)
+	}
+	if got := f.sample(2); len(got) != 2 || got[0] == got[1] {
+		t.Fatalf("expected two distinct users, got %v", got)
+	}
+	if got := f.sample(10); len(got) != 4 {
+		t.Fatalf("expected every user, got %v", got)
+	}
+}
+
+func TestFreshness_ForgetsExpired(t *testing.T) {
+	f := newFreshness()
+	f.loaded("short", time.Millisecond)
+	f.loaded("long", time.Hour)
+	f.loaded("forever", 0)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := f.age("short"); ok {
+		t.Fatal("expected no age for an expired presence")
+	}
+	if got := f.sample(10); len(got) != 2 {
+		t.Fatalf("expected only live presences sampled, got %v", got)
+	}
+
+	f.loaded("other", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	f.mu.Lock()
+	f.prunedAt = time.Now().Add(-freshnessPruneInterval)
+	f.mu.Unlock()
+	f.loaded("new", time.Hour)
+	if _, ok := f.loadedAt["other"]; ok || len(f.loadedAt) != 3 {
+		t.Fatalf("expected expired load times pruned, got %v", f.loadedAt)
+	}
+
+	for i := range maxFreshnessEntries + 1 {
+		f.loaded(fmt.Sprintf("u%d", i), 0)
+	}
+	if n := len(f.loadedAt); n > maxFreshnessEntries {
+		t.Fatalf("expected at most %d load times, got %d", maxFreshnessEntries, n)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/metrics"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+	"gopresence/internal/writebehind"
+)
+
+// Replay results, as counted by presence_write_behind_replays_total
+const (
+	replayApplied  = "applied"
+	replayConflict = "conflict" // The store had a newer write, or got one during the replay
+	replayExpired  = "expired"  // The presence's TTL ran out while queued
+)
+
+// EnableWriteBehind turns on offline write-behind: writes that can't reach
+// the store are accepted into q and the cache, and replayed by
+// ReplayWriteBehind once the store is back
+func (s *PresenceService) EnableWriteBehind(q *writebehind.Queue) {
+	s.behind = q
+	metrics.SetWriteBehindDepth(q.Len())
+}
+
+// offline reports whether the NATS connection is known to be down
+func (s *PresenceService) offline() bool {
+	return s.conn != nil && s.conn.check() != nil
+}
+
+// write stores presence. With write-behind enabled, a write the store can't
+// take because it is unreachable is queued instead; while the connection is
+// known to be down the store isn't even tried.
+func (s *PresenceService) write(ctx context.Context, userID string, presence *models.Presence) error {
+	if s.behind == nil {
+		return s.put(ctx, userID, presence)
+	}
+	if !s.offline() {
+		err := s.put(ctx, userID, presence)
+		if err == nil || !nats.IsUnavailable(err) {
+			return err
+		}
+	}
+	if err := s.behind.Push(userID, *presence); err != nil {
+		return err
+	}
+	metrics.SetWriteBehindDepth(s.behind.Len())
+	return nil
+}
+
+// ReplayWriteBehind replays queued writes to the store in the order they were
+// accepted. Conflicts resolve by last write wins: a queued write is dropped
+// if the store holds one updated later, e.g. from another node while this one
+// was cut off, as is a write whose TTL ran out while queued. The write is
+// conditional on the entry read for that check, so one landing in between
+// wins as well. Replay stops at the first store error, keeping the rest
+// queued.
+func (s *PresenceService) ReplayWriteBehind(ctx context.Context) (int, error) {
+	if s.behind == nil || s.behind.Len() == 0 {
+		return 0, nil
+	}
+	n, err := s.behind.Replay(func(e writebehind.Entry) error {
+		presence := e.Presence
+		if presence.IsExpired() {
+			metrics.ObserveWriteBehindReplay(replayExpired)
+			return nil
+		}
+		current, err := s.store.Get(ctx, e.UserID)
+		if err != nil && !apperrors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && current.UpdatedAt.After(presence.UpdatedAt) {
+			// Serve the winner rather than the local write
+			s.cache.Set(e.UserID, current, current.TTL)
+			s.freshness.loaded(e.UserID, current.TTL)
+			metrics.ObserveWriteBehindReplay(replayConflict)
+			return nil
+		}
+		err = s.replayPut(ctx, e.UserID, &presence, current.Revision)
+		if apperrors.IsRevisionMismatch(err) {
+			// The next read loads the winner
+			s.cache.Delete(e.UserID)
+			s.freshness.forget(e.UserID)
+			metrics.ObserveWriteBehindReplay(replayConflict)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		metrics.ObserveWriteBehindReplay(replayApplied)
+		return nil
+	})
+	metrics.SetWriteBehindDepth(s.behind.Len())
+	return n, err
+}
+
+// replayPut writes a replayed presence only if userID's entry is still at
+// revision, or still missing if revision is 0, and fails with
+// ErrRevisionMismatch otherwise. A missing presence may have left a delete
+// marker, which a create can't replace; with no live write there to lose
+// to, the presence is then written anyway. Stores that can't write
+// conditionally get a plain write.
+func (s *PresenceService) replayPut(ctx context.Context, userID string, presence *models.Presence, revision uint64) error {
+	ru, ok := s.store.(nats.RevisionUpdater)
+	if !ok {
+		return s.put(ctx, userID, presence)
+	}
+	// Revision 0 expects no entry at all, making the update a create
+	rev, err := ru.UpdateAtRevision(ctx, userID, *presence, presence.TTL, revision)
+	if revision == 0 && apperrors.IsRevisionMismatch(err) {
+		if _, err := s.store.Get(ctx, userID); !apperrors.IsNotFound(err) {
+			if err == nil {
+				return fmt.Errorf("presence of %s was written meanwhile: %w", userID, apperrors.ErrRevisionMismatch)
+			}
+			return err
+		}
+		return s.put(ctx, userID, presence)
+	}
+	if err != nil {
+		return err
+	}
+	presence.Revision = rev
+	return nil
+}
+
+// RunWriteBehind replays queued writes every interval while connected, until
+// ctx is done
+func (s *PresenceService) RunWriteBehind(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.offline() {
+				continue
+			}
+			if n, err := s.ReplayWriteBehind(ctx); err != nil {
+				log.Printf("write-behind replay stopped after %d writes: %v", n, err)
+			} else if n > 0 {
+				log.Printf("write-behind replayed %d writes", n)
+			}
+		}
+	}
+}
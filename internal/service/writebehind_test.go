@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopresence/internal/cache"
+	apperrors "gopresence/internal/errors"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+	"gopresence/internal/writebehind"
+)
+
+func TestWriteBehind_QueuesWhileUnreachableAndReplays(t *testing.T) {
+	stored := map[string]models.Presence{}
+	down := true
+	fs := &fakeStore{
+		get: func(ctx context.Context, userID string) (models.Presence, error) {
+			if p, ok := stored[userID]; ok {
+				return p, nil
+			}
+			return models.Presence{}, apperrors.NotFound(userID)
+		},
+		set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+			if down {
+				return &nats.TimeoutError{Op: "set", Err: context.DeadlineExceeded}
+			}
+			stored[userID] = p
+			return nil
+		},
+	}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "leaf1")
+	q, err := writebehind.Open(filepath.Join(t.TempDir(), "queue.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	s.EnableWriteBehind(q)
+	ctx := context.Background()
+
+	for _, user := range []string{"a", "b"} {
+		if err := s.SetPresence(ctx, user, models.Presence{UserID: user, Status: models.StatusOnline}); err != nil {
+			t.Fatalf("expected the write to be queued, got %v", err)
+		}
+	}
+	if p, err := s.GetPresence(ctx, "a"); err != nil || p.Status != models.StatusOnline {
+		t.Fatalf("expected the queued write to be served locally, got %v %v", p, err)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 queued writes, got %d", q.Len())
+	}
+
+	// Another node wrote b after this node queued its write
+	down = false
+	stored["b"] = models.Presence{UserID: "b", Status: models.StatusBusy, UpdatedAt: time.Now().Add(time.Second)}
+
+	n, err := s.ReplayWriteBehind(ctx)
+	if err != nil || n != 2 || q.Len() != 0 {
+		t.Fatalf("expected both writes replayed, got %d %v (len %d)", n, err, q.Len())
+	}
+	if stored["a"].Status != models.StatusOnline {
+		t.Fatalf("expected a's queued write to be applied, got %v", stored["a"])
+	}
+	if stored["b"].Status != models.StatusBusy {
+		t.Fatalf("expected the newer write to b to win, got %v", stored["b"])
+	}
+	if p, _ := s.GetPresence(ctx, "b"); p.Status != models.StatusBusy {
+		t.Fatalf("expected the cache to serve the winning write, got %v", p.Status)
+	}
+}
+
+func TestWriteBehind_RejectedWritesAreNotQueued(t *testing.T) {
+	fs := &fakeStore{set: func(ctx context.Context, userID string, p models.Presence, ttl time.Duration) error {
+		return errors.New("invalid key")
+	}}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), fs, "leaf1")
+	q, err := writebehind.Open(filepath.Join(t.TempDir(), "queue.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	s.EnableWriteBehind(q)
+
+	if err := s.SetPresence(context.Background(), "a", models.Presence{UserID: "a", Status: models.StatusOnline}); err == nil || q.Len() != 0 {
+		t.Fatalf("expected the error to surface without queueing, got %v (len %d)", err, q.Len())
+	}
+}
+
+// readRacingStore has another node write right after each single read
+type readRacingStore struct {
+	nats.KVStore
+	race func(userID string)
+}
+
+func (r *readRacingStore) Get(ctx context.Context, userID string) (models.Presence, error) {
+	p, err := r.KVStore.Get(ctx, userID)
+	if r.race != nil {
+		r.race(userID)
+	}
+	return p, err
+}
+
+func (r *readRacingStore) UpdateAtRevision(ctx context.Context, userID string, p models.Presence, ttl time.Duration, revision uint64) (uint64, error) {
+	return r.KVStore.(nats.RevisionUpdater).UpdateAtRevision(ctx, userID, p, ttl, revision)
+}
+
+func TestWriteBehind_ReplayLosesToWritesLandingAfterItsRead(t *testing.T) {
+	kv := newTransitionStore(t)
+	store := &readRacingStore{KVStore: kv}
+	s := NewPresenceService(cache.NewMemoryCache(10, time.Minute), store, "leaf1")
+	q, err := writebehind.Open(filepath.Join(t.TempDir(), "queue.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	s.EnableWriteBehind(q)
+	ctx := context.Background()
+
+	old := time.Now().UTC().Add(-time.Minute)
+	for _, user := range []string{"a", "c"} {
+		if err := kv.Set(ctx, user, models.Presence{UserID: user, Status: models.StatusAway, NodeID: "n2", UpdatedAt: old, LastSeen: old, TTL: time.Hour}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kv.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	queued := time.Now().UTC()
+	for _, user := range []string{"a", "b", "c"} {
+		if err := q.Push(user, models.Presence{UserID: user, Status: models.StatusOnline, NodeID: "leaf1", UpdatedAt: queued, LastSeen: queued, TTL: time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another node writes a and b between the replay's read and its write
+	store.race = func(userID string) {
+		if userID == "c" {
+			return
+		}
+		later := time.Now().UTC()
+		if err := kv.Set(ctx, userID, models.Presence{UserID: userID, Status: models.StatusBusy, NodeID: "n2", UpdatedAt: later, LastSeen: later, TTL: time.Hour}, time.Hour); err != nil {
+			t.Error(err)
+		}
+	}
+	if n, err := s.ReplayWriteBehind(ctx); err != nil || n != 3 || q.Len() != 0 {
+		t.Fatalf("expected all writes replayed, got %d %v (len %d)", n, err, q.Len())
+	}
+	store.race = nil
+	for user, want := range map[string]models.PresenceStatus{"a": models.StatusBusy, "b": models.StatusBusy, "c": models.StatusOnline} {
+		if got, err := kv.Get(ctx, user); err != nil || got.Status != want {
+			t.Errorf("%s: expected %s stored, got %+v (%v)", user, want, got, err)
+		}
+	}
+}
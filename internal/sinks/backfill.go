@@ -0,0 +1,67 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gopresence/internal/events"
+	"gopresence/internal/nats"
+)
+
+// ErrNoBackfill is returned for a sink that doesn't keep a stream to
+// backfill: only at-least-once NATS sinks publish to one
+var ErrNoBackfill = errors.New("sink has no history stream to backfill")
+
+// Backfiller publishes changes from another system's history to the streams
+// of at-least-once NATS sinks, next to the changes the sinks deliver. Nothing
+// goes through the bucket, so current presences, watchers and other sinks
+// never see a backfilled change.
+type Backfiller struct {
+	bus   nats.EventBus
+	specs map[string]Spec
+}
+
+// NewBackfiller returns a backfiller of the at-least-once NATS sinks among
+// specs
+func NewBackfiller(bus nats.EventBus, specs []Spec) *Backfiller {
+	b := &Backfiller{bus: bus, specs: make(map[string]Spec)}
+	for _, spec := range specs {
+		if spec.Kind == KindNATS && spec.Mode == AtLeastOnce {
+			b.specs[spec.Name] = spec
+		}
+	}
+	return b
+}
+
+// Sinks returns the names of the sinks that can be backfilled, sorted
+func (b *Backfiller) Sinks() []string {
+	names := make([]string, 0, len(b.specs))
+	for name := range b.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Backfill publishes evs to the stream of the sink named sink, in the sink's
+// payload version, and returns how many were stored. Publishing stops at the
+// first failure; the events before it stay in the stream.
+func (b *Backfiller) Backfill(ctx context.Context, sink string, evs []events.Event) (int, error) {
+	spec, ok := b.specs[sink]
+	if !ok {
+		return 0, ErrNoBackfill
+	}
+	version := payloadVersion(spec)
+	for i, ev := range evs {
+		payload, err := events.EncodeBackfillPayload(ev, version)
+		if err != nil {
+			return i, err
+		}
+		if err := b.bus.Publish(ctx, spec.Target, payload, true); err != nil {
+			return i, fmt.Errorf("failed to backfill event %d: %w", i, err)
+		}
+	}
+	return len(evs), nil
+}
@@ -0,0 +1,140 @@
+// Package sinks forwards presence changes to external systems such as
+// webhooks and NATS subjects. Each sink declares a delivery mode; either way
+// the fleet shares one consumer per sink, so a change is delivered by one
+// node rather than by every node.
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/metrics"
+	"gopresence/internal/nats"
+	"gopresence/internal/requestid"
+)
+
+// Mode is a sink's delivery guarantee
+type Mode string
+
+const (
+	// AtMostOnce delivers changes over core NATS: nothing is retried, and
+	// changes made while no node is running the sink are lost
+	AtMostOnce Mode = "at-most-once"
+	// AtLeastOnce delivers changes through a durable JetStream consumer,
+	// one at a time and in order, retrying until the sink accepts each one.
+	// A change can reach the sink more than once.
+	AtLeastOnce Mode = "at-least-once"
+)
+
+// Sink kinds
+const (
+	KindWebhook = "webhook" // POSTs each event as JSON to a URL
+	KindNATS    = "nats"    // Publishes each event as JSON to a subject
+)
+
+// deliveryTimeout bounds one delivery attempt
+const deliveryTimeout = 10 * time.Second
+
+// Sink delivers one encoded event to an external system
+type Sink interface {
+	Deliver(ctx context.Context, payload []byte) error
+}
+
+// Spec describes a configured sink
+type Spec struct {
+	Name    string // Unique; names the consumer shared by the fleet
+	Kind    string // KindWebhook or KindNATS
+	Target  string // Webhook URL or NATS subject
+	Mode    Mode   // Defaults to AtMostOnce
+	Version string // Event payload version, events.DefaultPayloadVersion unless set
+}
+
+// ConsumerName is the consumer, shared by the fleet, that the sink named
+// name reads changes through
+func ConsumerName(name string) string { return "sink_" + name }
+
+// StreamName is the stream declared for the acked publishes of the NATS sink
+// named name, unless a stream already captures its subject
+func StreamName(name string) string { return "SINK_" + name }
+
+// New returns the sink spec describes
+func New(spec Spec, bus nats.EventBus) (Sink, error) {
+	switch spec.Kind {
+	case KindWebhook:
+		schema, ok := events.PayloadSchema(payloadVersion(spec))
+		if !ok {
+			return nil, fmt.Errorf("unknown event payload version %q", spec.Version)
+		}
+		return NewWebhook(spec.Target, schema), nil
+	case KindNATS:
+		return &subjectSink{bus: bus, subject: spec.Target, acked: spec.Mode == AtLeastOnce}, nil
+	}
+	return nil, fmt.Errorf("unknown sink kind %q", spec.Kind)
+}
+
+// Start delivers presence changes to the sink described by spec until ctx is
+// done
+func Start(ctx context.Context, bus nats.EventBus, spec Spec) error {
+	sink, err := New(spec, bus)
+	if err != nil {
+		return err
+	}
+	return Run(ctx, bus, spec, sink)
+}
+
+// Run delivers presence changes to sink, with the name and mode of spec,
+// until ctx is done
+func Run(ctx context.Context, bus nats.EventBus, spec Spec, sink Sink) error {
+	if spec.Mode == "" {
+		spec.Mode = AtMostOnce
+	}
+	version := payloadVersion(spec)
+	if _, ok := events.PayloadSchema(version); !ok {
+		return fmt.Errorf("unknown event payload version %q", version)
+	}
+	consumer := ConsumerName(spec.Name)
+	deliver := func(we nats.WatchEvent) error {
+		if we.Deliveries > 1 {
+			metrics.ObserveSinkRedelivery(spec.Name)
+		}
+		payload, err := events.EncodePayload(events.FromWatchEvent(we), version)
+		if err != nil {
+			return err
+		}
+		dctx, cancel := context.WithTimeout(requestid.NewContext(ctx, we.RequestID), deliveryTimeout)
+		defer cancel()
+		err = sink.Deliver(dctx, payload)
+		metrics.ObserveSinkDelivery(spec.Name, string(spec.Mode), err)
+		return err
+	}
+
+	switch spec.Mode {
+	case AtMostOnce:
+		return bus.SubscribeChanges(ctx, consumer, func(we nats.WatchEvent) { deliver(we) })
+	case AtLeastOnce:
+		return bus.WatchDurable(ctx, consumer, deliver)
+	}
+	return fmt.Errorf("unknown delivery mode %q", spec.Mode)
+}
+
+// payloadVersion is the event payload version spec asks for
+func payloadVersion(spec Spec) string {
+	if spec.Version == "" {
+		return events.DefaultPayloadVersion
+	}
+	return spec.Version
+}
+
+// subjectSink publishes events to a NATS subject; acked publishes go through
+// JetStream and need a stream capturing the subject
+type subjectSink struct {
+	bus     nats.EventBus
+	subject string
+	acked   bool
+}
+
+func (s *subjectSink) Deliver(ctx context.Context, payload []byte) error {
+	return s.bus.Publish(ctx, s.subject, payload, s.acked)
+}
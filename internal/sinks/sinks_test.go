@@ -0,0 +1,209 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+	"gopresence/internal/requestid"
+)
+
+// fakeBus hands the registered callbacks to the test
+type fakeBus struct {
+	mu        sync.Mutex
+	group     string
+	core      func(nats.WatchEvent)
+	durable   func(nats.WatchEvent) error
+	published []string
+}
+
+func (b *fakeBus) SubscribeChanges(ctx context.Context, group string, cb func(nats.WatchEvent)) error {
+	b.group, b.core = group, cb
+	return nil
+}
+
+func (b *fakeBus) WatchDurable(ctx context.Context, name string, cb func(nats.WatchEvent) error) error {
+	b.group, b.durable = name, cb
+	return nil
+}
+
+func (b *fakeBus) Publish(ctx context.Context, subject string, data []byte, acked bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, subject)
+	if acked {
+		return errors.New("no stream")
+	}
+	return nil
+}
+
+type sinkFunc func(ctx context.Context, payload []byte) error
+
+func (f sinkFunc) Deliver(ctx context.Context, payload []byte) error { return f(ctx, payload) }
+
+func change(userID string, deliveries uint64) nats.WatchEvent {
+	p := models.Presence{UserID: userID, Status: models.StatusOnline, UpdatedAt: time.Now().UTC()}
+	return nats.WatchEvent{Key: "user." + userID, Presence: &p, Deliveries: deliveries}
+}
+
+func TestRun_Modes(t *testing.T) {
+	var got []events.Event
+	fail := true
+	sink := sinkFunc(func(ctx context.Context, payload []byte) error {
+		var ev events.Event
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			t.Fatalf("payload is not an event: %v", err)
+		}
+		got = append(got, ev)
+		if fail {
+			return errors.New("sink down")
+		}
+		return nil
+	})
+
+	bus := &fakeBus{}
+	if err := Run(context.Background(), bus, Spec{Name: "crm"}, sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if bus.core == nil || bus.durable != nil || bus.group != "sink_crm" {
+		t.Fatalf("expected a core subscription in group sink_crm, got %+v", bus)
+	}
+	bus.core(change("alice", 0))
+	if len(got) != 1 || got[0].UserID != "alice" || got[0].Type != events.EventUpdated {
+		t.Fatalf("unexpected delivery %+v", got)
+	}
+
+	bus = &fakeBus{}
+	if err := Run(context.Background(), bus, Spec{Name: "audit", Mode: AtLeastOnce}, sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if bus.durable == nil || bus.core != nil {
+		t.Fatalf("expected a durable consumer, got %+v", bus)
+	}
+	// A failed delivery is reported so the change is redelivered
+	if err := bus.durable(change("bob", 1)); err == nil {
+		t.Fatal("expected the sink error to be returned for redelivery")
+	}
+	fail = false
+	if err := bus.durable(change("bob", 2)); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+
+	if err := Run(context.Background(), &fakeBus{}, Spec{Name: "x", Mode: "exactly-once"}, sink); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+}
+
+func TestRun_PayloadVersion(t *testing.T) {
+	var payload map[string]any
+	var requestID string
+	sink := sinkFunc(func(ctx context.Context, data []byte) error {
+		requestID = requestid.FromContext(ctx)
+		return json.Unmarshal(data, &payload)
+	})
+
+	bus := &fakeBus{}
+	if err := Run(context.Background(), bus, Spec{Name: "bi", Version: events.PayloadV2}, sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	we := change("alice", 0)
+	we.Revision = 7
+	we.RequestID = "req-7"
+	bus.core(we)
+	if payload["schema"] != "presence-event-v2" || payload["id"] != "alice:7" || payload["request_id"] != "req-7" {
+		t.Fatalf("expected a v2 payload, got %v", payload)
+	}
+	if requestID != "req-7" {
+		t.Fatalf("expected the delivery context to carry the change's request ID, got %q", requestID)
+	}
+
+	// Sinks without a version keep getting v1
+	bus = &fakeBus{}
+	if err := Run(context.Background(), bus, Spec{Name: "crm"}, sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	payload = nil
+	bus.core(we)
+	if _, ok := payload["schema"]; ok || payload["user_id"] != "alice" || payload["timestamp"] == nil {
+		t.Fatalf("expected a v1 payload, got %v", payload)
+	}
+
+	if err := Run(context.Background(), &fakeBus{}, Spec{Name: "x", Version: "v9"}, sink); err == nil {
+		t.Fatal("expected an unknown version to be rejected")
+	}
+}
+
+func TestNew_SubjectSinkAcksOnlyAtLeastOnce(t *testing.T) {
+	bus := &fakeBus{}
+	for mode, wantErr := range map[Mode]bool{AtMostOnce: false, AtLeastOnce: true} {
+		sink, err := New(Spec{Name: "n", Kind: KindNATS, Target: "presence.out", Mode: mode}, bus)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if err := sink.Deliver(context.Background(), []byte("{}")); (err != nil) != wantErr {
+			t.Errorf("%s: unexpected error %v", mode, err)
+		}
+	}
+	if _, err := New(Spec{Name: "k", Kind: "kafka"}, bus); err == nil {
+		t.Fatal("expected an unknown kind to be rejected")
+	}
+}
+
+func TestWebhook_Deliver(t *testing.T) {
+	status := http.StatusNoContent
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || r.Header.Get(SchemaHeader) != "presence-event-v2" || r.Header.Get(requestid.Header) != "req-1" {
+			t.Errorf("unexpected request %s %v", r.Method, r.Header)
+		}
+		body = make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	wh, err := New(Spec{Name: "crm", Kind: KindWebhook, Target: srv.URL, Version: events.PayloadV2}, &fakeBus{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	if err := wh.Deliver(ctx, []byte(`{"user_id":"alice"}`)); err != nil || string(body) != `{"user_id":"alice"}` {
+		t.Fatalf("expected delivery, got %q %v", body, err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := wh.Deliver(ctx, []byte("{}")); err == nil {
+		t.Fatal("expected a non-2xx response to fail the delivery")
+	}
+}
+
+func TestBackfiller(t *testing.T) {
+	bus := &fakeBus{}
+	b := NewBackfiller(bus, []Spec{
+		{Name: "stream", Kind: KindNATS, Target: "presence.out", Mode: AtLeastOnce},
+		{Name: "fanout", Kind: KindNATS, Target: "presence.fan", Mode: AtMostOnce},
+		{Name: "crm", Kind: KindWebhook, Target: "http://crm", Mode: AtLeastOnce},
+	})
+	if got := b.Sinks(); len(got) != 1 || got[0] != "stream" {
+		t.Fatalf("expected only the at-least-once NATS sink, got %v", got)
+	}
+	if _, err := b.Backfill(context.Background(), "fanout", nil); !errors.Is(err, ErrNoBackfill) {
+		t.Fatalf("expected ErrNoBackfill, got %v", err)
+	}
+	p := models.Presence{UserID: "alice", Status: models.StatusAway, UpdatedAt: time.Now().Add(-time.Hour)}
+	evs := []events.Event{{Type: events.EventUpdated, UserID: "alice", Presence: &p}}
+	// fakeBus has no stream to ack the publish
+	if n, err := b.Backfill(context.Background(), "stream", evs); n != 0 || err == nil {
+		t.Fatalf("expected the failed publish reported, got %d %v", n, err)
+	}
+	if len(bus.published) != 1 || bus.published[0] != "presence.out" {
+		t.Fatalf("expected a publish to the sink's subject, got %v", bus.published)
+	}
+}
@@ -0,0 +1,58 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gopresence/internal/requestid"
+)
+
+// SchemaHeader names the JSON Schema of a webhook's payload, as published
+// under /api/v2/schemas/
+const SchemaHeader = "X-Event-Schema"
+
+// Webhook POSTs events as JSON to a URL; any 2xx response accepts the event.
+// The X-Request-ID of the change, when known, is sent along.
+type Webhook struct {
+	url    string
+	schema string
+	client *http.Client
+}
+
+// NewWebhook returns a webhook sink posting to url payloads matching the
+// named schema
+func NewWebhook(url, schema string) *Webhook {
+	return NewWebhookClient(url, schema, &http.Client{})
+}
+
+// NewWebhookClient is NewWebhook delivering through client, e.g. one that
+// refuses to connect to internal addresses
+func NewWebhookClient(url, schema string, client *http.Client) *Webhook {
+	return &Webhook{url: url, schema: schema, client: client}
+}
+
+// Deliver implements Sink
+func (w *Webhook) Deliver(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SchemaHeader, w.schema)
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
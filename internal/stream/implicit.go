@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+// PresenceWriter sets presences for connection-based implicit presence
+type PresenceWriter interface {
+	SetPresence(ctx context.Context, userID string, presence models.Presence) error
+}
+
+// implicitWriteTimeout bounds one implicit presence read or write
+const implicitWriteTimeout = 5 * time.Second
+
+// WithImplicitPresence treats open sessions of authenticated callers as
+// proof of liveness. The caller is marked online on connect and the
+// presence is rewritten with ttl every ttl/2 while any of their sessions on
+// this node is connected. Once the last one disconnects and none reconnects
+// within debounce, the caller is marked offline.
+func WithImplicitPresence(writer PresenceWriter, ttl, debounce time.Duration) Option {
+	return func(h *Handler) {
+		h.implicit = &implicitPresence{
+			writer:   writer,
+			ttl:      ttl,
+			debounce: debounce,
+			users:    make(map[string]*liveUser),
+			writing:  make(map[string]*userLock),
+		}
+	}
+}
+
+// implicitPresence tracks which callers have connected sessions on this node
+type implicitPresence struct {
+	writer   PresenceWriter
+	reader   PresenceReader
+	ttl      time.Duration
+	debounce time.Duration
+
+	mu    sync.Mutex
+	users map[string]*liveUser // store ID -> connections
+	// Serializes each caller's refreshes and offline write, so an offline
+	// can't be overtaken by a refresh already in flight, nor a reconnect's
+	// refresh by the offline of the connections before it
+	writing map[string]*userLock
+}
+
+type userLock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters; the lock is dropped at zero
+}
+
+type liveUser struct {
+	conns   int
+	stop    chan struct{} // closes the refresh loop
+	offline *time.Timer   // pending offline after the last disconnect
+	gen     uint64        // bumped per scheduled offline, so stale timers are ignored
+}
+
+// connected records a new connection of a caller
+func (ip *implicitPresence) connected(storeID string) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	u, ok := ip.users[storeID]
+	if !ok {
+		u = &liveUser{stop: make(chan struct{})}
+		ip.users[storeID] = u
+		go ip.refresh(storeID, u.stop)
+	}
+	u.conns++
+	if u.offline != nil {
+		u.offline.Stop()
+		u.offline = nil
+	}
+}
+
+// disconnected records a closed connection, scheduling the caller offline
+// after the last one; revoked connections skip the debounce
+func (ip *implicitPresence) disconnected(storeID string, revoked bool) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	u, ok := ip.users[storeID]
+	if !ok {
+		return
+	}
+	if u.conns--; u.conns > 0 {
+		return
+	}
+	delay := ip.debounce
+	if revoked {
+		delay = 0
+	}
+	u.gen++
+	gen := u.gen
+	u.offline = time.AfterFunc(delay, func() { ip.expire(storeID, u, gen) })
+}
+
+// expedite marks the caller offline now rather than after the debounce, if
+// they have no connection left and are only waiting for it
+func (ip *implicitPresence) expedite(storeID string) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	u, ok := ip.users[storeID]
+	if !ok || u.conns > 0 || u.offline == nil {
+		return
+	}
+	u.offline.Stop()
+	u.gen++
+	gen := u.gen
+	u.offline = time.AfterFunc(0, func() { ip.expire(storeID, u, gen) })
+}
+
+// lockUser takes the write lock of a caller, returning its release
+func (ip *implicitPresence) lockUser(storeID string) func() {
+	ip.mu.Lock()
+	l, ok := ip.writing[storeID]
+	if !ok {
+		l = &userLock{}
+		ip.writing[storeID] = l
+	}
+	l.refs++
+	ip.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		ip.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(ip.writing, storeID)
+		}
+		ip.mu.Unlock()
+	}
+}
+
+// expire marks the caller offline unless they reconnected meanwhile
+func (ip *implicitPresence) expire(storeID string, u *liveUser, gen uint64) {
+	unlock := ip.lockUser(storeID)
+	defer unlock()
+	ip.mu.Lock()
+	if ip.users[storeID] != u || u.conns > 0 || u.gen != gen {
+		ip.mu.Unlock()
+		return
+	}
+	delete(ip.users, storeID)
+	close(u.stop)
+	ip.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), implicitWriteTimeout)
+	defer cancel()
+	if cur, ok := ip.current(ctx, storeID); ok && cur.Status == models.StatusOffline {
+		return
+	}
+	p := models.Presence{UserID: storeID, Status: models.StatusOffline, TTL: ip.ttl, Source: models.SourceConnection}
+	if err := ip.writer.SetPresence(ctx, storeID, p); err != nil {
+		log.Printf("implicit presence: failed to mark %s offline: %v", storeID, err)
+	}
+}
+
+// refresh keeps the caller's presence alive until stop is closed
+func (ip *implicitPresence) refresh(storeID string, stop chan struct{}) {
+	ticker := time.NewTicker(max(ip.ttl/2, time.Second))
+	defer ticker.Stop()
+	for {
+		ip.touch(storeID, stop)
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// touch rewrites the caller's presence with a fresh TTL, unless stop was
+// closed meanwhile. A missing presence, or an offline one this node implied,
+// becomes online; a status the caller chose is kept, except an explicit
+// offline, which is left alone.
+func (ip *implicitPresence) touch(storeID string, stop chan struct{}) {
+	unlock := ip.lockUser(storeID)
+	defer unlock()
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), implicitWriteTimeout)
+	defer cancel()
+	p := models.Presence{UserID: storeID, Status: models.StatusOnline, TTL: ip.ttl, Source: models.SourceConnection}
+	if cur, ok := ip.current(ctx, storeID); ok {
+		switch {
+		case cur.Status == models.StatusOffline && cur.Source != models.SourceConnection:
+			return
+		case cur.Status != models.StatusOffline:
+			p.Status, p.Message = cur.Status, cur.Message
+		}
+	}
+	if err := ip.writer.SetPresence(ctx, storeID, p); err != nil {
+		log.Printf("implicit presence: failed to refresh %s: %v", storeID, err)
+	}
+}
+
+func (ip *implicitPresence) current(ctx context.Context, storeID string) (models.Presence, bool) {
+	presences, err := ip.reader.GetMultiplePresences(ctx, []string{storeID})
+	if err != nil {
+		return models.Presence{}, false
+	}
+	p, ok := presences[storeID]
+	return p, ok
+}
@@ -0,0 +1,198 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+// memPresences is an in-memory presence store for implicit presence tests
+type memPresences struct {
+	mu     sync.Mutex
+	data   map[string]models.Presence
+	writes []models.Presence
+}
+
+func (m *memPresences) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]models.Presence)
+	for _, id := range userIDs {
+		if p, ok := m.data[id]; ok {
+			out[id] = p
+		}
+	}
+	return out, nil
+}
+
+func (m *memPresences) SetPresence(ctx context.Context, userID string, p models.Presence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[userID] = p
+	m.writes = append(m.writes, p)
+	return nil
+}
+
+func (m *memPresences) get(userID string) (models.Presence, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[userID], len(m.writes)
+}
+
+func TestImplicitPresence_OnlineWhileConnected(t *testing.T) {
+	store := &memPresences{data: map[string]models.Presence{}}
+	h := NewHandler(events.NewHub(), store, Config{}, WithImplicitPresence(store, 10*time.Second, 100*time.Millisecond))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(auth.SetUserIDInContext(r.Context(), r.Header.Get("X-Test-User"))))
+	}))
+	defer srv.Close()
+	dialAs := func(user string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):], http.Header{"X-Test-User": {user}})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		readMsg(t, conn) // welcome
+		return conn
+	}
+
+	first := dialAs("alice")
+	waitFor(t, func() bool { p, _ := store.get("alice"); return p.Status == models.StatusOnline })
+	if p, _ := store.get("alice"); p.Source != models.SourceConnection || p.TTL != 10*time.Second {
+		t.Fatalf("expected a connection-sourced presence, got %+v", p)
+	}
+	second := dialAs("alice")
+
+	// Closing one of two connections keeps the caller online
+	first.Close()
+	time.Sleep(250 * time.Millisecond)
+	if p, _ := store.get("alice"); p.Status != models.StatusOnline {
+		t.Fatalf("expected alice to stay online, got %+v", p)
+	}
+
+	// Reconnecting within the debounce cancels the pending offline
+	second.Close()
+	third := dialAs("alice")
+	time.Sleep(250 * time.Millisecond)
+	if p, _ := store.get("alice"); p.Status != models.StatusOnline {
+		t.Fatalf("expected the reconnect to cancel going offline, got %+v", p)
+	}
+
+	third.Close()
+	waitFor(t, func() bool { p, _ := store.get("alice"); return p.Status == models.StatusOffline })
+	if p, _ := store.get("alice"); p.Source != models.SourceConnection {
+		t.Fatalf("expected a connection-sourced offline, got %+v", p)
+	}
+}
+
+func TestImplicitPresence_KeepsChosenStatus(t *testing.T) {
+	store := &memPresences{data: map[string]models.Presence{
+		"bob":   {UserID: "bob", Status: models.StatusBusy, Message: "focus", Source: models.SourceAPI},
+		"carol": {UserID: "carol", Status: models.StatusOffline, Source: models.SourceAPI},
+	}}
+	ip := &implicitPresence{writer: store, reader: store, ttl: 10 * time.Second, users: map[string]*liveUser{}, writing: map[string]*userLock{}}
+
+	ip.touch("bob", nil)
+	if p, _ := store.get("bob"); p.Status != models.StatusBusy || p.Message != "focus" || p.TTL != 10*time.Second {
+		t.Fatalf("expected busy refreshed with the implicit TTL, got %+v", p)
+	}
+	// An explicit offline is not overridden by an open connection
+	ip.touch("carol", nil)
+	if p, n := store.get("carol"); p.Status != models.StatusOffline || n != 1 {
+		t.Fatalf("expected carol left offline, got %+v after %d writes", p, n)
+	}
+}
+
+// gatedWriter holds up online writes until gate is closed
+type gatedWriter struct {
+	*memPresences
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (g *gatedWriter) SetPresence(ctx context.Context, userID string, p models.Presence) error {
+	if p.Status == models.StatusOnline {
+		g.entered <- struct{}{}
+		<-g.gate
+	}
+	return g.memPresences.SetPresence(ctx, userID, p)
+}
+
+func TestImplicitPresence_OfflineWaitsForRefreshInFlight(t *testing.T) {
+	store := &memPresences{data: map[string]models.Presence{}}
+	writer := &gatedWriter{memPresences: store, entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	ip := &implicitPresence{writer: writer, reader: store, ttl: 10 * time.Second, users: map[string]*liveUser{}, writing: map[string]*userLock{}}
+	u := &liveUser{stop: make(chan struct{}), gen: 1}
+	ip.users["alice"] = u
+
+	go ip.touch("alice", u.stop)
+	<-writer.entered
+	expired := make(chan struct{})
+	go func() {
+		ip.expire("alice", u, 1)
+		close(expired)
+	}()
+	select {
+	case <-expired:
+		t.Fatal("expected the offline write to wait for the refresh")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(writer.gate)
+	<-expired
+	if p, _ := store.get("alice"); p.Status != models.StatusOffline {
+		t.Fatalf("expected the offline written last, got %+v", p)
+	}
+
+	// A refresh of the closed connections doesn't bring alice back
+	ip.touch("alice", u.stop)
+	if p, n := store.get("alice"); p.Status != models.StatusOffline || n != 2 {
+		t.Fatalf("expected alice left offline, got %+v after %d writes", p, n)
+	}
+}
+
+func TestImplicitPresence_RevokeSkipsDebounce(t *testing.T) {
+	store := &memPresences{data: map[string]models.Presence{}}
+	h := NewHandler(events.NewHub(), store, Config{}, WithImplicitPresence(store, 10*time.Second, time.Minute))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(auth.SetUserIDInContext(r.Context(), "alice")))
+	}))
+	defer srv.Close()
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):], nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		readMsg(t, conn) // welcome
+	}
+	waitFor(t, func() bool { p, _ := store.get("alice"); return p.Status == models.StatusOnline })
+	sessions := h.ListSessions("alice")
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+
+	// Revoking one device leaves alice online through the other
+	if !h.Revoke(sessions[0].ID) {
+		t.Fatal("expected the session to be revoked")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if p, _ := store.get("alice"); p.Status != models.StatusOnline {
+		t.Fatalf("expected alice to stay online, got %+v", p)
+	}
+
+	// Revoking the last one marks her offline without waiting a minute
+	h.Revoke(sessions[1].ID)
+	waitFor(t, func() bool { p, _ := store.get("alice"); return p.Status == models.StatusOffline })
+	if h.Revoke(sessions[1].ID) {
+		t.Fatal("expected a revoked session to be gone")
+	}
+}
@@ -0,0 +1,241 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"gopresence/internal/auth"
+)
+
+// SessionInfo describes a stream session for operators
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id,omitempty"` // Authenticated caller; empty for anonymous sessions
+	NodeID        string    `json:"node_id,omitempty"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	ConnectedAt   time.Time `json:"connected_at,omitzero"` // Current connection; zero while awaiting resume
+	Connected     bool      `json:"connected"`
+	Subscriptions []string  `json:"subscriptions"` // Watched user IDs, as the caller sent them
+	Transport     string    `json:"transport"`     // TransportWebSocket or TransportSSE
+
+	// Presence subscription streamed over SSE; its users aren't listed
+	SubscriptionID string `json:"subscription_id,omitempty"`
+}
+
+// Transports of stream sessions
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// tracked is a stream served by another handler and registered by Track, so
+// it is listed and closed with the WebSocket sessions
+type tracked struct {
+	info  SessionInfo
+	close context.CancelFunc
+}
+
+// Track registers the server-sent event streams of next, such as a presence
+// subscription's events, as sessions: they are listed with the WebSocket
+// sessions, closed by Disconnect, Revoke and Drain, and refused while the
+// node drains. Closing one cancels its request's context, which next must
+// end the stream on. SSE sessions can't be resumed.
+func (h *Handler) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.draining.Load() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "node is draining", http.StatusServiceUnavailable)
+			return
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		now := time.Now().UTC()
+		t := &tracked{
+			info: SessionInfo{
+				ID:             newSessionID(),
+				UserID:         auth.GetUserIDFromContext(r.Context()),
+				NodeID:         h.nodeID,
+				RemoteAddr:     r.RemoteAddr,
+				CreatedAt:      now,
+				ConnectedAt:    now,
+				Connected:      true,
+				Subscriptions:  []string{},
+				Transport:      TransportSSE,
+				SubscriptionID: mux.Vars(r)["subscription_id"],
+			},
+			close: cancel,
+		}
+		h.mu.Lock()
+		h.tracked[t.info.ID] = t
+		h.mu.Unlock()
+		defer func() {
+			h.mu.Lock()
+			delete(h.tracked, t.info.ID)
+			h.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithNodeID records the node serving sessions in SessionInfo
+func WithNodeID(id string) Option {
+	return func(h *Handler) { h.nodeID = id }
+}
+
+// ListSessions returns the node's live sessions, attached or resumable,
+// oldest first; with userID set, only that caller's sessions
+func (h *Handler) ListSessions(userID string) []SessionInfo {
+	h.mu.Lock()
+	sessions := make([]*session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	infos := []SessionInfo{}
+	for _, t := range h.tracked {
+		if userID == "" || t.info.UserID == userID {
+			infos = append(infos, t.info)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, s := range sessions {
+		if userID != "" && s.userID != userID {
+			continue
+		}
+		infos = append(infos, s.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.Before(infos[j].CreatedAt) })
+	return infos
+}
+
+// Disconnect closes a session and its connection, if any. The session
+// can't be resumed; the client has to start a new one. It reports whether
+// the session existed.
+func (h *Handler) Disconnect(id string) bool {
+	s := h.lookup(id)
+	if s == nil {
+		return h.closeTracked(id)
+	}
+	s.terminate(websocket.ClosePolicyViolation, "session closed by an administrator")
+	return true
+}
+
+// Revoke closes a session like Disconnect, e.g. for a lost device. With
+// implicit presence on, a caller left without connections on this node is
+// marked offline at once instead of after the debounce; one still connected
+// elsewhere stays online. An SSE session is just closed, since it doesn't
+// imply presence. It reports whether the session existed.
+func (h *Handler) Revoke(id string) bool {
+	s := h.lookup(id)
+	if s == nil {
+		return h.closeTracked(id)
+	}
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.revoked.Store(true)
+	}
+	s.mu.Unlock()
+	s.terminate(websocket.ClosePolicyViolation, "session revoked by an administrator")
+	if h.implicit != nil && s.userID != "" {
+		h.implicit.expedite(h.storeID(s.userID))
+	}
+	return true
+}
+
+// DisconnectUser closes every session of a caller, returning how many
+// were closed
+func (h *Handler) DisconnectUser(userID string) int {
+	n := 0
+	for _, info := range h.ListSessions(userID) {
+		if h.Disconnect(info.ID) {
+			n++
+		}
+	}
+	return n
+}
+
+// closeTracked ends a tracked SSE session, reporting whether it existed
+func (h *Handler) closeTracked(id string) bool {
+	h.mu.Lock()
+	t := h.tracked[id]
+	h.mu.Unlock()
+	if t == nil {
+		return false
+	}
+	t.close()
+	return true
+}
+
+func (s *session) info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := SessionInfo{
+		ID:            s.id,
+		UserID:        s.userID,
+		NodeID:        s.h.nodeID,
+		RemoteAddr:    s.remoteAddr,
+		CreatedAt:     s.createdAt,
+		Connected:     s.conn != nil,
+		Subscriptions: make([]string, 0, len(s.watched)),
+		Transport:     TransportWebSocket,
+	}
+	if s.conn != nil {
+		info.ConnectedAt = s.conn.connectedAt
+	}
+	for _, userID := range s.watched {
+		info.Subscriptions = append(info.Subscriptions, userID)
+	}
+	sort.Strings(info.Subscriptions)
+	return info
+}
+
+// Drain stops accepting new stream connections and closes every session
+// with "going away", so clients reconnect to another node. Sessions can't
+// be resumed afterwards.
+func (h *Handler) Drain(ctx context.Context) error {
+	h.draining.Store(true)
+	h.mu.Lock()
+	sessions := make([]*session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	for _, t := range h.tracked {
+		t.close()
+	}
+	h.mu.Unlock()
+
+	for _, s := range sessions {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.terminate(websocket.CloseGoingAway, "node is draining")
+	}
+	return nil
+}
+
+// terminate closes the session for good, telling an attached client why
+func (s *session) terminate(code int, reason string) {
+	s.mu.Lock()
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	c := s.conn
+	s.conn = nil
+	s.mu.Unlock()
+
+	s.h.remove(s.id)
+	s.sub.Close()
+	if c != nil {
+		msg := websocket.FormatCloseMessage(code, reason)
+		c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.config.WriteTimeout))
+		c.close()
+		c.ws.Close()
+	}
+}
@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+)
+
+func TestRegistry_ListAndDisconnect(t *testing.T) {
+	hub := events.NewHub()
+	h := NewHandler(hub, &fakeReader{}, Config{ResumeWindow: time.Minute}, WithNodeID("n1"))
+	// Stand in for the JWT middleware: the caller is named by a header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(auth.SetUserIDInContext(r.Context(), r.Header.Get("X-Test-User"))))
+	}))
+	defer srv.Close()
+	dialAs := func(user, query string) *websocket.Conn {
+		t.Helper()
+		url := "ws" + srv.URL[len("http"):] + "/ws" + query
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Test-User": {user}})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	alice := dialAs("alice", "?users=u2,u1")
+	defer alice.Close()
+	welcome := readMsg(t, alice)
+	readMsg(t, alice) // subscribed
+	bob := dialAs("bob", "")
+	defer bob.Close()
+	readMsg(t, bob) // welcome
+
+	sessions := h.ListSessions("")
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	a := h.ListSessions("alice")
+	if len(a) != 1 || a[0].ID != welcome.SessionID || a[0].NodeID != "n1" || !a[0].Connected || a[0].ConnectedAt.IsZero() {
+		t.Fatalf("unexpected alice session %+v", a)
+	}
+	if subs := a[0].Subscriptions; len(subs) != 2 || subs[0] != "u1" || subs[1] != "u2" {
+		t.Fatalf("expected sorted subscriptions, got %v", subs)
+	}
+
+	if n := h.DisconnectUser("alice"); n != 1 {
+		t.Fatalf("expected 1 session closed, got %d", n)
+	}
+	alice.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := alice.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("expected a policy violation close, got %v", err)
+			}
+			break
+		}
+	}
+	if h.Disconnect(welcome.SessionID) {
+		t.Fatal("expected the closed session to be gone")
+	}
+
+	// A closed session can't be resumed; the client gets a new one
+	again := dialAs("alice", "?session_id="+welcome.SessionID+"&last_seq=0")
+	defer again.Close()
+	if msg := readMsg(t, again); msg.Type != MsgWelcome || msg.SessionID == welcome.SessionID {
+		t.Fatalf("expected a new session, got %+v", msg)
+	}
+	if got := h.ListSessions("bob"); len(got) != 1 {
+		t.Fatalf("expected bob's session untouched, got %+v", got)
+	}
+}
+
+func TestDrain_ClosesSessionsAndRefusesNewOnes(t *testing.T) {
+	h := NewHandler(events.NewHub(), &fakeReader{}, Config{})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn := dial(t, srv, "?users=u1")
+	defer conn.Close()
+	readMsg(t, conn) // welcome
+
+	if err := h.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("expected a going-away close, got %v", err)
+			}
+			break
+		}
+	}
+	if n := h.Sessions(); n != 0 {
+		t.Fatalf("expected no sessions left, got %d", n)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/ws", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected new connections to be refused with 503, got %v", err)
+	}
+}
+
+func TestTrack_ListsAndClosesSSEStreams(t *testing.T) {
+	h := NewHandler(events.NewHub(), &fakeReader{}, Config{}, WithNodeID("n1"))
+	started := make(chan struct{}, 2)
+	router := mux.NewRouter()
+	router.Handle("/subscriptions/{subscription_id}/events", h.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+	})))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r.WithContext(auth.SetUserIDInContext(r.Context(), "alice")))
+	}))
+	defer srv.Close()
+	open := func() *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/subscriptions/s1/events")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		<-started
+		return resp
+	}
+
+	resp := open()
+	defer resp.Body.Close()
+	got := h.ListSessions("alice")
+	if len(got) != 1 || got[0].Transport != TransportSSE || got[0].SubscriptionID != "s1" || got[0].NodeID != "n1" || !got[0].Connected {
+		t.Fatalf("expected the SSE stream listed, got %+v", got)
+	}
+	if !h.Disconnect(got[0].ID) {
+		t.Fatal("expected the SSE session closed")
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("expected the stream to end, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.ListSessions("")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the session gone, got %+v", h.ListSessions(""))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Draining ends open streams and refuses new ones
+	resp = open()
+	defer resp.Body.Close()
+	if err := h.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("expected the stream to end on drain, got %v", err)
+	}
+	if resp, err := http.Get(srv.URL + "/subscriptions/s1/events"); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %v %v", resp, err)
+	}
+}
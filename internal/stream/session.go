@@ -0,0 +1,299 @@
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+// session is a server-side stream session. It outlives individual connections:
+// while detached it keeps buffering events so a reconnecting client can
+// resume from its last sequence number.
+type session struct {
+	id  string
+	h   *Handler
+	sub *events.Subscription
+
+	userID     string // Authenticated caller that opened the session
+	createdAt  time.Time
+	remoteAddr string // Of the current or last connection
+
+	mu      sync.Mutex
+	conn    *connection
+	watched map[string]string // store ID -> caller user ID
+	seq     uint64
+	buffer  []ServerMessage // most recent events, oldest first
+	expiry  *time.Timer
+
+	// Events of users whose snapshot is being loaded wait here so they are
+	// sent after it, never before
+	snapshotting map[string]bool // store IDs
+	held         []events.Event  // oldest first
+}
+
+func (h *Handler) newSession(userID, remoteAddr string) *session {
+	s := &session{
+		id:         newSessionID(),
+		h:          h,
+		sub:        h.hub.Subscribe(h.config.SendBuffer),
+		userID:     userID,
+		createdAt:  time.Now().UTC(),
+		remoteAddr: remoteAddr,
+		watched:    make(map[string]string),
+
+		snapshotting: make(map[string]bool),
+	}
+	h.mu.Lock()
+	h.sessions[s.id] = s
+	h.mu.Unlock()
+
+	go s.pump()
+	return s
+}
+
+// pump sequences hub events for this session and forwards them to the attached connection
+func (s *session) pump() {
+	for ev := range s.sub.Events() {
+		s.mu.Lock()
+		if s.snapshotting[ev.UserID] {
+			s.held = append(s.held, ev)
+			s.mu.Unlock()
+			continue
+		}
+		msg, ok := s.sequence(ev)
+		c := s.conn
+		s.mu.Unlock()
+
+		if ok && c != nil {
+			c.send(msg)
+		}
+	}
+}
+
+// sequence numbers a watched user's event and keeps it for replay.
+// Callers must hold s.mu.
+func (s *session) sequence(ev events.Event) (ServerMessage, bool) {
+	msg, ok := s.eventMessage(ev)
+	if !ok {
+		return ServerMessage{}, false
+	}
+	s.seq++
+	msg.Seq = s.seq
+	s.buffer = append(s.buffer, msg)
+	if over := len(s.buffer) - s.h.config.ResumeBuffer; over > 0 {
+		s.buffer = s.buffer[over:]
+	}
+	return msg, true
+}
+
+// attach binds a connection to the session, replacing any previous one
+func (s *session) attach(c *connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	if s.conn != nil && s.conn != c {
+		s.conn.close()
+		s.conn.ws.Close()
+	}
+	s.conn = c
+}
+
+// detach unbinds a connection and schedules session expiry after the resume window
+func (s *session) detach(c *connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != c {
+		// Already replaced by a resumed connection
+		return
+	}
+	s.conn = nil
+	s.expiry = time.AfterFunc(s.h.config.ResumeWindow, s.expire)
+}
+
+func (s *session) expire() {
+	s.mu.Lock()
+	attached := s.conn != nil
+	s.mu.Unlock()
+	if attached {
+		return
+	}
+	s.h.remove(s.id)
+	s.sub.Close()
+}
+
+// resume attaches a reconnecting client and replays events after lastSeq.
+// If the gap is no longer covered by the buffer the client is told to resync
+// and receives a fresh snapshot of its watched users.
+func (s *session) resume(ctx context.Context, c *connection, lastSeq uint64) {
+	s.mu.Lock()
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	if s.conn != nil {
+		s.conn.close()
+		s.conn.ws.Close()
+	}
+
+	covered := lastSeq >= s.seq || (len(s.buffer) > 0 && s.buffer[0].Seq <= lastSeq+1)
+	var missed []ServerMessage
+	if covered {
+		for _, msg := range s.buffer {
+			if msg.Seq > lastSeq {
+				missed = append(missed, msg)
+			}
+		}
+	}
+	watched := make(map[string]string, len(s.watched))
+	for k, v := range s.watched {
+		watched[k] = v
+		if !covered {
+			s.snapshotting[k] = true
+		}
+	}
+	seq := s.seq
+
+	// Queue the welcome and replay before attaching so live events are ordered after them
+	c.send(ServerMessage{Type: MsgWelcome, SessionID: s.id, Seq: seq, Subscriptions: len(watched)})
+	for _, msg := range missed {
+		c.send(msg)
+	}
+	s.conn = c
+	s.remoteAddr = c.remoteAddr
+	s.mu.Unlock()
+
+	if !covered {
+		c.send(ServerMessage{Type: MsgResync, SessionID: s.id, Seq: seq})
+		if len(watched) > 0 {
+			s.snapshot(ctx, c, watched)
+		}
+	}
+}
+
+// subscribe adds user IDs to the watch set and pushes a snapshot of their current state
+func (s *session) subscribe(ctx context.Context, c *connection, userIDs []string) {
+	if len(userIDs) == 0 {
+		c.send(ServerMessage{Type: MsgError, Error: "user_ids is required"})
+		return
+	}
+
+	added := make(map[string]string)
+	s.mu.Lock()
+	for _, userID := range userIDs {
+		storeID := s.h.storeID(userID)
+		if _, ok := s.watched[storeID]; !ok {
+			added[storeID] = userID
+		}
+	}
+	if len(s.watched)+len(added) > s.h.config.MaxSubscriptions {
+		s.mu.Unlock()
+		c.send(ServerMessage{Type: MsgError, Error: "subscription limit exceeded", Subscriptions: s.h.config.MaxSubscriptions})
+		return
+	}
+	for storeID, userID := range added {
+		s.watched[storeID] = userID
+		s.snapshotting[storeID] = true
+	}
+	count := len(s.watched)
+	s.mu.Unlock()
+
+	c.send(ServerMessage{Type: MsgSubscribed, UserIDs: userIDs, Subscriptions: count})
+	if len(added) > 0 {
+		s.snapshot(ctx, c, added)
+	}
+}
+
+// unsubscribe removes user IDs from the watch set
+func (s *session) unsubscribe(c *connection, userIDs []string) {
+	s.mu.Lock()
+	for _, userID := range userIDs {
+		delete(s.watched, s.h.storeID(userID))
+	}
+	count := len(s.watched)
+	s.mu.Unlock()
+
+	c.send(ServerMessage{Type: MsgUnsubscribed, UserIDs: userIDs, Subscriptions: count})
+}
+
+// snapshot pushes the current state of the given users (store ID -> caller
+// ID), which must be marked as snapshotting. Their events that arrived while
+// it loaded follow it, minus any the snapshot already covers.
+func (s *session) snapshot(ctx context.Context, c *connection, users map[string]string) {
+	ids := make([]string, 0, len(users))
+	for storeID := range users {
+		ids = append(ids, storeID)
+	}
+	presences, err := s.h.reader.GetMultiplePresences(ctx, ids)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		c.send(ServerMessage{Type: MsgError, Error: "failed to load snapshot"})
+	} else {
+		data := make(map[string]models.Presence, len(presences))
+		for storeID, presence := range presences {
+			if userID, ok := users[storeID]; ok {
+				presence.UserID = userID
+				data[userID] = presence
+			}
+		}
+		// Events after the snapshot carry a higher seq
+		c.send(ServerMessage{Type: MsgSnapshot, Seq: s.seq, Data: data})
+	}
+	s.release(c, users, presences)
+}
+
+// release sends the events held for users while their snapshot loaded,
+// dropping those at or below the revision the snapshot already reported.
+// Callers must hold s.mu.
+func (s *session) release(c *connection, users map[string]string, snapshot map[string]models.Presence) {
+	for storeID := range users {
+		delete(s.snapshotting, storeID)
+	}
+	kept := s.held[:0]
+	for _, ev := range s.held {
+		if _, ok := users[ev.UserID]; !ok {
+			kept = append(kept, ev)
+			continue
+		}
+		if p, ok := snapshot[ev.UserID]; ok && ev.Revision != 0 && ev.Revision <= p.Revision {
+			continue
+		}
+		if msg, ok := s.sequence(ev); ok {
+			c.send(msg)
+		}
+	}
+	clear(s.held[len(kept):])
+	s.held = kept
+}
+
+// eventMessage filters a hub event against the watch set and maps it to caller IDs.
+// Callers must hold s.mu.
+func (s *session) eventMessage(ev events.Event) (ServerMessage, bool) {
+	userID, ok := s.watched[ev.UserID]
+	if !ok {
+		return ServerMessage{}, false
+	}
+
+	ev.UserID = userID
+	if ev.Presence != nil {
+		p := *ev.Presence
+		p.UserID = userID
+		ev.Presence = &p
+	}
+	return ServerMessage{Type: MsgEvent, Event: &ev}, true
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,353 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gopresence/internal/auth"
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	"gopresence/internal/privacy"
+)
+
+// Client -> server message types
+const (
+	MsgSubscribe   = "subscribe"
+	MsgUnsubscribe = "unsubscribe"
+)
+
+// Server -> client message types
+const (
+	MsgWelcome      = "welcome"
+	MsgSnapshot     = "snapshot"
+	MsgEvent        = "event"
+	MsgSubscribed   = "subscribed"
+	MsgUnsubscribed = "unsubscribed"
+	MsgResync       = "resync"
+	MsgError        = "error"
+)
+
+// PresenceReader provides current presence state for subscription snapshots
+type PresenceReader interface {
+	GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error)
+}
+
+// RosterLookup resolves a caller's presence subscription to the user IDs it
+// watches
+type RosterLookup interface {
+	Roster(id, owner string) ([]string, error)
+}
+
+// Config holds WebSocket session settings
+type Config struct {
+	MaxSubscriptions int           // Max watched user IDs per connection
+	SendBuffer       int           // Buffered outbound messages per connection
+	WriteTimeout     time.Duration // Deadline for a single frame write
+	PingInterval     time.Duration // Interval between server pings
+	PongWait         time.Duration // Max time to wait for any client frame (incl. pong)
+	ResumeWindow     time.Duration // How long a disconnected session can be resumed
+	ResumeBuffer     int           // Max events retained for replay on resume
+}
+
+// ClientMessage is a control message sent by the client
+type ClientMessage struct {
+	Type    string   `json:"type"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// ServerMessage is a message pushed to the client
+type ServerMessage struct {
+	Type          string                     `json:"type"`
+	SessionID     string                     `json:"session_id,omitempty"`
+	Seq           uint64                     `json:"seq,omitempty"`
+	UserIDs       []string                   `json:"user_ids,omitempty"`
+	Subscriptions int                        `json:"subscriptions,omitempty"`
+	Data          map[string]models.Presence `json:"data,omitempty"`
+	Event         *events.Event              `json:"event,omitempty"`
+	Error         string                     `json:"error,omitempty"`
+}
+
+// Handler upgrades HTTP requests to WebSocket presence sessions
+type Handler struct {
+	hub           *events.Hub
+	reader        PresenceReader
+	config        Config
+	upgrader      websocket.Upgrader
+	pseudonymizer *privacy.Pseudonymizer
+	nodeID        string
+	implicit      *implicitPresence // nil unless connection-based presence is on
+	rosters       RosterLookup      // nil unless presence subscriptions are on
+	draining      atomic.Bool       // set by Drain; new connections are refused
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	tracked  map[string]*tracked // SSE streams, by session ID
+}
+
+// Option configures optional Handler behavior
+type Option func(*Handler)
+
+// WithPseudonymizer maps watched user IDs to pseudonyms, matching the REST handlers
+func WithPseudonymizer(p *privacy.Pseudonymizer) Option {
+	return func(h *Handler) { h.pseudonymizer = p }
+}
+
+// WithRosters lets new sessions pass ?subscription_id= to watch the users of
+// one of the caller's presence subscriptions
+func WithRosters(r RosterLookup) Option {
+	return func(h *Handler) { h.rosters = r }
+}
+
+// NewHandler creates a new WebSocket handler
+func NewHandler(hub *events.Hub, reader PresenceReader, config Config, opts ...Option) *Handler {
+	if config.MaxSubscriptions <= 0 {
+		config.MaxSubscriptions = 500
+	}
+	if config.SendBuffer <= 0 {
+		config.SendBuffer = 256
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = 30 * time.Second
+	}
+	if config.PongWait <= config.PingInterval {
+		config.PongWait = config.PingInterval * 2
+	}
+	if config.ResumeWindow <= 0 {
+		config.ResumeWindow = 2 * time.Minute
+	}
+	if config.ResumeBuffer <= 0 {
+		config.ResumeBuffer = 256
+	}
+	h := &Handler{
+		hub:    hub,
+		reader: reader,
+		config: config,
+		upgrader: websocket.Upgrader{
+			// Origin policy is enforced by the CORS middleware in front of this handler
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		sessions: make(map[string]*session),
+		tracked:  make(map[string]*tracked),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.implicit != nil {
+		h.implicit.reader = reader
+	}
+	return h
+}
+
+// ServeHTTP handles GET /api/v2/stream/ws.
+// New sessions may pass ?users=user1,user2 or ?subscription_id=...;
+// reconnecting clients pass ?session_id=...&last_seq=N to receive the events
+// they missed.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "node is draining", http.StatusServiceUnavailable)
+		return
+	}
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		return
+	}
+	c := newConnection(ws, h.config)
+	c.remoteAddr = r.RemoteAddr
+
+	q := r.URL.Query()
+	var s *session
+	if id := q.Get("session_id"); id != "" {
+		s = h.lookup(id)
+	}
+
+	if s != nil {
+		lastSeq, _ := strconv.ParseUint(q.Get("last_seq"), 10, 64)
+		s.resume(r.Context(), c, lastSeq)
+	} else {
+		s = h.newSession(auth.GetUserIDFromContext(r.Context()), r.RemoteAddr)
+		s.attach(c)
+		c.send(ServerMessage{Type: MsgWelcome, SessionID: s.id})
+		if users := q.Get("users"); users != "" {
+			s.subscribe(r.Context(), c, splitUserIDs(users))
+		}
+		if id := q.Get("subscription_id"); id != "" {
+			h.subscribeRoster(r.Context(), s, c, id)
+		}
+	}
+
+	// Open connections of authenticated callers imply they are online
+	if caller := auth.GetUserIDFromContext(r.Context()); h.implicit != nil && caller != "" {
+		storeID := h.storeID(caller)
+		h.implicit.connected(storeID)
+		defer func() { h.implicit.disconnected(storeID, c.revoked.Load()) }()
+	}
+
+	c.run(func(ctx context.Context, msg ClientMessage) {
+		switch msg.Type {
+		case MsgSubscribe:
+			s.subscribe(ctx, c, msg.UserIDs)
+		case MsgUnsubscribe:
+			s.unsubscribe(c, msg.UserIDs)
+		default:
+			c.send(ServerMessage{Type: MsgError, Error: "unknown message type"})
+		}
+	})
+	s.detach(c)
+}
+
+// subscribeRoster watches the users of the caller's presence subscription id
+func (h *Handler) subscribeRoster(ctx context.Context, s *session, c *connection, id string) {
+	if h.rosters == nil {
+		c.send(ServerMessage{Type: MsgError, Error: "presence subscriptions are disabled"})
+		return
+	}
+	userIDs, err := h.rosters.Roster(id, s.userID)
+	if err != nil {
+		c.send(ServerMessage{Type: MsgError, Error: err.Error()})
+		return
+	}
+	s.subscribe(ctx, c, userIDs)
+}
+
+// Sessions returns the number of live (attached or resumable) sessions
+func (h *Handler) Sessions() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sessions)
+}
+
+func (h *Handler) lookup(id string) *session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sessions[id]
+}
+
+func (h *Handler) remove(id string) {
+	h.mu.Lock()
+	delete(h.sessions, id)
+	h.mu.Unlock()
+}
+
+func (h *Handler) storeID(userID string) string {
+	if h.pseudonymizer == nil {
+		return userID
+	}
+	return h.pseudonymizer.Pseudonymize(userID)
+}
+
+// connection is a single attached WebSocket connection
+type connection struct {
+	ws          *websocket.Conn
+	config      Config
+	out         chan ServerMessage
+	done        chan struct{}
+	once        sync.Once
+	connectedAt time.Time
+	remoteAddr  string
+	revoked     atomic.Bool // closed by Revoke, so implicit presence goes offline at once
+}
+
+func newConnection(ws *websocket.Conn, config Config) *connection {
+	return &connection{
+		ws:          ws,
+		config:      config,
+		out:         make(chan ServerMessage, config.SendBuffer+config.ResumeBuffer),
+		done:        make(chan struct{}),
+		connectedAt: time.Now().UTC(),
+	}
+}
+
+// run starts the write loop and blocks in the read loop until the connection closes
+func (c *connection) run(handle func(context.Context, ClientMessage)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.writeLoop()
+	}()
+
+	// Any frame from the client, including pongs, keeps the connection alive
+	c.ws.SetReadDeadline(time.Now().Add(c.config.PongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(c.config.PongWait))
+	})
+	for {
+		var msg ClientMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			break
+		}
+		c.ws.SetReadDeadline(time.Now().Add(c.config.PongWait))
+		handle(ctx, msg)
+	}
+
+	c.close()
+	wg.Wait()
+	c.ws.Close()
+}
+
+func (c *connection) writeLoop() {
+	ticker := time.NewTicker(c.config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-c.out:
+			c.ws.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.close()
+				c.ws.Close()
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(c.config.WriteTimeout)
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.close()
+				c.ws.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send queues a message; a connection that cannot keep up is closed so the
+// client can resume from its last sequence instead of silently losing events
+func (c *connection) send(msg ServerMessage) {
+	select {
+	case c.out <- msg:
+	case <-c.done:
+	default:
+		c.close()
+		c.ws.Close()
+	}
+}
+
+func (c *connection) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func splitUserIDs(param string) []string {
+	parts := strings.Split(param, ",")
+	ids := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			ids = append(ids, p)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,327 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+)
+
+type fakeReader struct {
+	presences map[string]models.Presence
+}
+
+func (f *fakeReader) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	out := make(map[string]models.Presence)
+	for _, id := range userIDs {
+		if p, ok := f.presences[id]; ok {
+			out[id] = p
+		}
+	}
+	return out, nil
+}
+
+func dial(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return conn
+}
+
+func readMsg(t *testing.T, conn *websocket.Conn) ServerMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg ServerMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestWebSocket_SubscribeSnapshotAndEvents(t *testing.T) {
+	hub := events.NewHub()
+	reader := &fakeReader{presences: map[string]models.Presence{
+		"u1": {UserID: "u1", Status: models.StatusOnline},
+	}}
+	srv := httptest.NewServer(NewHandler(hub, reader, Config{MaxSubscriptions: 2}))
+	defer srv.Close()
+
+	conn := dial(t, srv, "?users=u1")
+	defer conn.Close()
+
+	if msg := readMsg(t, conn); msg.Type != MsgWelcome || msg.SessionID == "" {
+		t.Fatalf("expected welcome with session id, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Type != MsgSubscribed || msg.Subscriptions != 1 {
+		t.Fatalf("expected subscribed ack, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Type != MsgSnapshot || msg.Data["u1"].Status != models.StatusOnline {
+		t.Fatalf("expected snapshot with u1, got %+v", msg)
+	}
+
+	// Events for unwatched users are filtered out
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "other"})
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1", Presence: &models.Presence{UserID: "u1", Status: models.StatusAway}})
+	if msg := readMsg(t, conn); msg.Type != MsgEvent || msg.Event.UserID != "u1" {
+		t.Fatalf("expected u1 event, got %+v", msg)
+	}
+
+	// Dynamic add within the limit
+	conn.WriteJSON(ClientMessage{Type: MsgSubscribe, UserIDs: []string{"u2"}})
+	if msg := readMsg(t, conn); msg.Type != MsgSubscribed || msg.Subscriptions != 2 {
+		t.Fatalf("expected 2 subscriptions, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Type != MsgSnapshot {
+		t.Fatalf("expected snapshot, got %+v", msg)
+	}
+
+	// Exceeding the limit is rejected
+	conn.WriteJSON(ClientMessage{Type: MsgSubscribe, UserIDs: []string{"u3"}})
+	if msg := readMsg(t, conn); msg.Type != MsgError {
+		t.Fatalf("expected limit error, got %+v", msg)
+	}
+
+	// Remove and verify events stop
+	conn.WriteJSON(ClientMessage{Type: MsgUnsubscribe, UserIDs: []string{"u1"}})
+	if msg := readMsg(t, conn); msg.Type != MsgUnsubscribed || msg.Subscriptions != 1 {
+		t.Fatalf("expected unsubscribed ack, got %+v", msg)
+	}
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1"})
+	hub.Publish(events.Event{Type: events.EventDeleted, UserID: "u2"})
+	if msg := readMsg(t, conn); msg.Type != MsgEvent || msg.Event.UserID != "u2" {
+		t.Fatalf("expected only u2 event, got %+v", msg)
+	}
+}
+
+// gatedReader blocks snapshot reads until released
+type gatedReader struct {
+	fakeReader
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedReader) GetMultiplePresences(ctx context.Context, userIDs []string) (map[string]models.Presence, error) {
+	close(g.loading)
+	<-g.release
+	return g.fakeReader.GetMultiplePresences(ctx, userIDs)
+}
+
+func TestWebSocket_SnapshotPrecedesLiveEvents(t *testing.T) {
+	hub := events.NewHub()
+	reader := &gatedReader{
+		fakeReader: fakeReader{presences: map[string]models.Presence{
+			"u1": {UserID: "u1", Status: models.StatusOnline, Revision: 5},
+		}},
+		loading: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	h := NewHandler(hub, reader, Config{})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn := dial(t, srv, "?users=u1")
+	defer conn.Close()
+
+	// Changes landing while the snapshot loads wait for it
+	<-reader.loading
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1", Revision: 4, Presence: &models.Presence{Status: models.StatusAway}})
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1", Revision: 6, Presence: &models.Presence{Status: models.StatusBusy}})
+	waitFor(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, s := range h.sessions {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return len(s.held) == 2
+		}
+		return false
+	})
+	close(reader.release)
+
+	readMsg(t, conn) // welcome
+	readMsg(t, conn) // subscribed
+	if msg := readMsg(t, conn); msg.Type != MsgSnapshot || msg.Data["u1"].Revision != 5 || msg.Seq != 0 {
+		t.Fatalf("expected the snapshot first, got %+v", msg)
+	}
+	// Revision 4 is older than the snapshot and is dropped
+	if msg := readMsg(t, conn); msg.Type != MsgEvent || msg.Event.Revision != 6 || msg.Seq != 1 {
+		t.Fatalf("expected only the newer event after the snapshot, got %+v", msg)
+	}
+	hub.Publish(events.Event{Type: events.EventDeleted, UserID: "u1", Revision: 7})
+	if msg := readMsg(t, conn); msg.Type != MsgEvent || msg.Event.Revision != 7 || msg.Seq != 2 {
+		t.Fatalf("expected live events to resume, got %+v", msg)
+	}
+}
+
+func TestWebSocket_UnknownMessageAndCleanup(t *testing.T) {
+	hub := events.NewHub()
+	srv := httptest.NewServer(NewHandler(hub, &fakeReader{}, Config{ResumeWindow: 50 * time.Millisecond}))
+	defer srv.Close()
+
+	conn := dial(t, srv, "")
+	readMsg(t, conn) // welcome
+	conn.WriteJSON(ClientMessage{Type: "bogus"})
+	if msg := readMsg(t, conn); msg.Type != MsgError {
+		t.Fatalf("expected error, got %+v", msg)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Subscribers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Subscribers() != 0 {
+		t.Fatalf("expected hub subscription released on disconnect")
+	}
+}
+
+func TestWebSocket_ResumeReplaysMissedEvents(t *testing.T) {
+	hub := events.NewHub()
+	h := NewHandler(hub, &fakeReader{}, Config{ResumeWindow: time.Minute, ResumeBuffer: 2})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn := dial(t, srv, "?users=u1")
+	welcome := readMsg(t, conn)
+	readMsg(t, conn) // subscribed
+	readMsg(t, conn) // snapshot
+
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1"})
+	first := readMsg(t, conn)
+	if first.Seq != 1 {
+		t.Fatalf("expected seq 1, got %+v", first)
+	}
+	conn.Close()
+
+	// Events published while disconnected are buffered for the session
+	waitFor(t, func() bool { return hubSessionDetached(h, welcome.SessionID) })
+	hub.Publish(events.Event{Type: events.EventUpdated, UserID: "u1"})
+	hub.Publish(events.Event{Type: events.EventDeleted, UserID: "u1"})
+	waitFor(t, func() bool { return sessionSeq(h, welcome.SessionID) == 3 })
+
+	conn = dial(t, srv, "?session_id="+welcome.SessionID+"&last_seq=1")
+	defer conn.Close()
+	if msg := readMsg(t, conn); msg.Type != MsgWelcome || msg.SessionID != welcome.SessionID || msg.Seq != 3 {
+		t.Fatalf("expected resumed welcome, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Seq != 2 || msg.Event.Type != events.EventUpdated {
+		t.Fatalf("expected replay of seq 2, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Seq != 3 || msg.Event.Type != events.EventDeleted {
+		t.Fatalf("expected replay of seq 3, got %+v", msg)
+	}
+	conn.Close()
+
+	// A gap older than the buffer forces a resync
+	waitFor(t, func() bool { return hubSessionDetached(h, welcome.SessionID) })
+	conn = dial(t, srv, "?session_id="+welcome.SessionID+"&last_seq=0")
+	defer conn.Close()
+	readMsg(t, conn) // welcome
+	if msg := readMsg(t, conn); msg.Type != MsgResync {
+		t.Fatalf("expected resync, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Type != MsgSnapshot {
+		t.Fatalf("expected snapshot after resync, got %+v", msg)
+	}
+}
+
+func TestWebSocket_ServerPings(t *testing.T) {
+	hub := events.NewHub()
+	srv := httptest.NewServer(NewHandler(hub, &fakeReader{}, Config{PingInterval: 20 * time.Millisecond}))
+	defer srv.Close()
+
+	conn := dial(t, srv, "")
+	defer conn.Close()
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pinged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected server ping")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func hubSessionDetached(h *Handler, id string) bool {
+	s := h.lookup(id)
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn == nil
+}
+
+func sessionSeq(h *Handler, id string) uint64 {
+	s := h.lookup(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// fakeRosters serves one subscription, owned by the anonymous caller
+type fakeRosters map[string][]string
+
+func (f fakeRosters) Roster(id, owner string) ([]string, error) {
+	if ids, ok := f[id]; ok && owner == "" {
+		return ids, nil
+	}
+	return nil, errors.New("subscription not found")
+}
+
+func TestWebSocket_SubscriptionRoster(t *testing.T) {
+	hub := events.NewHub()
+	reader := &fakeReader{presences: map[string]models.Presence{"u1": {UserID: "u1", Status: models.StatusBusy}}}
+	srv := httptest.NewServer(NewHandler(hub, reader, Config{}, WithRosters(fakeRosters{"sub1": {"u1", "u2"}})))
+	defer srv.Close()
+
+	conn := dial(t, srv, "?subscription_id=sub1")
+	defer conn.Close()
+	readMsg(t, conn) // welcome
+	if msg := readMsg(t, conn); msg.Type != MsgSubscribed || msg.Subscriptions != 2 {
+		t.Fatalf("expected the roster's two users, got %+v", msg)
+	}
+	if msg := readMsg(t, conn); msg.Type != MsgSnapshot || msg.Data["u1"].Status != models.StatusBusy {
+		t.Fatalf("expected snapshot with u1, got %+v", msg)
+	}
+
+	unknown := dial(t, srv, "?subscription_id=nope")
+	defer unknown.Close()
+	readMsg(t, unknown) // welcome
+	if msg := readMsg(t, unknown); msg.Type != MsgError || msg.Error != "subscription not found" {
+		t.Fatalf("expected an unknown subscription error, got %+v", msg)
+	}
+}
@@ -0,0 +1,476 @@
+// Package subscriptions keeps rosters of watched users that clients register
+// once and then receive pushed changes for, over server-sent events, the
+// WebSocket stream or a webhook, instead of polling. Subscriptions live on
+// the node that registered them and lapse unless renewed.
+package subscriptions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/metrics"
+	"gopresence/internal/privacy"
+	"gopresence/internal/sinks"
+)
+
+const (
+	// sweepInterval is how often lapsed subscriptions are removed
+	sweepInterval = 30 * time.Second
+	// webhookBuffer is the number of events queued per webhook before new
+	// ones are dropped
+	webhookBuffer = 256
+	// webhookTimeout bounds one webhook delivery
+	webhookTimeout = 10 * time.Second
+)
+
+var (
+	// ErrNotFound reports an unknown or lapsed subscription, or one owned by
+	// another caller
+	ErrNotFound = errors.New("subscription not found")
+	// ErrTooMany reports an owner at the subscription limit
+	ErrTooMany = errors.New("subscription limit reached")
+	// ErrWebhooksDisabled reports a webhook on a registry without webhooks
+	ErrWebhooksDisabled = errors.New("webhook subscriptions are disabled")
+	// ErrNoOwner reports a subscription created without an authenticated
+	// caller to own it
+	ErrNoOwner = errors.New("subscriptions require an authenticated caller")
+)
+
+// Limits bound what one owner can register
+type Limits struct {
+	MaxPerOwner int           // Live subscriptions per owner
+	MaxUsers    int           // Watched users per subscription
+	DefaultTTL  time.Duration // Lifetime when none is requested
+	MaxTTL      time.Duration // Longest lifetime, on creation or renewal
+}
+
+// Subscription is a registered roster
+type Subscription struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner,omitempty"` // Authenticated caller that registered it
+	UserIDs    []string  `json:"user_ids"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	NodeID     string    `json:"node_id,omitempty"` // Node holding the subscription
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// entry is a live subscription and its push channels
+type entry struct {
+	Subscription
+	users     map[string]string // store ID -> user ID as registered
+	listeners map[*Listener]struct{}
+	webhook   chan events.Event // nil without a webhook
+}
+
+// Registry holds the node's subscriptions and fans hub events out to them
+type Registry struct {
+	limits        Limits
+	nodeID        string
+	pseudonymizer *privacy.Pseudonymizer
+	newWebhook    func(url string) sinks.Sink // nil disables webhooks
+	webhookGuard  *WebhookGuard
+	now           func() time.Time
+
+	mu       sync.Mutex
+	subs     map[string]*entry
+	watchers map[string]map[*entry]struct{} // store ID -> subscriptions watching it
+}
+
+// Option configures optional Registry behavior
+type Option func(*Registry)
+
+// WithNodeID records the node holding subscriptions in Subscription
+func WithNodeID(id string) Option {
+	return func(r *Registry) { r.nodeID = id }
+}
+
+// WithPseudonymizer maps watched user IDs to pseudonyms, matching the REST
+// handlers
+func WithPseudonymizer(p *privacy.Pseudonymizer) Option {
+	return func(r *Registry) { r.pseudonymizer = p }
+}
+
+// WithWebhooks lets subscriptions name a webhook URL, delivered to through
+// the sinks newWebhook returns
+func WithWebhooks(newWebhook func(url string) sinks.Sink) Option {
+	return func(r *Registry) { r.newWebhook = newWebhook }
+}
+
+// WithWebhookGuard restricts the hosts webhooks may name; by default any
+// public host is allowed. The guard's Client should deliver them too.
+func WithWebhookGuard(g *WebhookGuard) Option {
+	return func(r *Registry) { r.webhookGuard = g }
+}
+
+// NewRegistry creates an empty registry; zero limits take their defaults
+func NewRegistry(limits Limits, opts ...Option) *Registry {
+	if limits.MaxPerOwner <= 0 {
+		limits.MaxPerOwner = 10
+	}
+	if limits.MaxUsers <= 0 {
+		limits.MaxUsers = 500
+	}
+	if limits.DefaultTTL <= 0 {
+		limits.DefaultTTL = time.Hour
+	}
+	if limits.MaxTTL < limits.DefaultTTL {
+		limits.MaxTTL = max(24*time.Hour, limits.DefaultTTL)
+	}
+	r := &Registry{
+		limits:       limits,
+		webhookGuard: NewWebhookGuard(nil),
+		now:          func() time.Time { return time.Now().UTC() },
+		subs:         make(map[string]*entry),
+		watchers:     make(map[string]map[*entry]struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Limits returns the registry's limits, defaults applied
+func (r *Registry) Limits() Limits { return r.limits }
+
+// Create registers a roster for owner, which must be an authenticated
+// caller. A ttl of 0 takes the default lifetime; webhookURL is optional and
+// must pass the registry's webhook guard.
+func (r *Registry) Create(owner string, userIDs []string, ttl time.Duration, webhookURL string) (Subscription, error) {
+	if owner == "" {
+		return Subscription{}, ErrNoOwner
+	}
+	users := make(map[string]string, len(userIDs))
+	var unique []string
+	for _, id := range userIDs {
+		if storeID := r.storeID(id); users[storeID] == "" {
+			users[storeID] = id
+			unique = append(unique, id)
+		}
+	}
+	switch {
+	case len(unique) == 0:
+		return Subscription{}, errors.New("user_ids is required")
+	case len(unique) > r.limits.MaxUsers:
+		return Subscription{}, fmt.Errorf("at most %d user_ids per subscription", r.limits.MaxUsers)
+	}
+	ttl, err := r.lifetime(ttl)
+	if err != nil {
+		return Subscription{}, err
+	}
+	var sink sinks.Sink
+	if webhookURL != "" {
+		if r.newWebhook == nil {
+			return Subscription{}, ErrWebhooksDisabled
+		}
+		u, err := url.Parse(webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Subscription{}, errors.New("webhook_url must be an http or https URL")
+		}
+		if err := r.webhookGuard.Check(context.Background(), u); err != nil {
+			return Subscription{}, err
+		}
+		sink = r.newWebhook(webhookURL)
+	}
+
+	now := r.now()
+	e := &entry{
+		Subscription: Subscription{
+			ID:         newID(),
+			Owner:      owner,
+			UserIDs:    unique,
+			WebhookURL: webhookURL,
+			NodeID:     r.nodeID,
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(ttl),
+		},
+		users:     users,
+		listeners: make(map[*Listener]struct{}),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owned := 0
+	for _, other := range r.subs {
+		if other.Owner == owner && now.Before(other.ExpiresAt) {
+			owned++
+		}
+	}
+	if owned >= r.limits.MaxPerOwner {
+		return Subscription{}, ErrTooMany
+	}
+	if sink != nil {
+		e.webhook = make(chan events.Event, webhookBuffer)
+		go deliver(e.ID, sink, e.webhook)
+	}
+	r.subs[e.ID] = e
+	for storeID := range users {
+		if r.watchers[storeID] == nil {
+			r.watchers[storeID] = make(map[*entry]struct{})
+		}
+		r.watchers[storeID][e] = struct{}{}
+	}
+	metrics.SetSubscriptions(len(r.subs))
+	return e.copy(), nil
+}
+
+// Get returns owner's subscription id
+func (r *Registry) Get(id, owner string) (Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.lookup(id, owner)
+	if err != nil {
+		return Subscription{}, err
+	}
+	return e.copy(), nil
+}
+
+// List returns owner's live subscriptions, oldest first
+func (r *Registry) List(owner string) []Subscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	subs := []Subscription{}
+	for _, e := range r.subs {
+		if e.Owner == owner && now.Before(e.ExpiresAt) {
+			subs = append(subs, e.copy())
+		}
+	}
+	slices.SortFunc(subs, func(a, b Subscription) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return subs
+}
+
+// Renew extends owner's subscription id to ttl from now; a ttl of 0 takes
+// the default lifetime
+func (r *Registry) Renew(id, owner string, ttl time.Duration) (Subscription, error) {
+	ttl, err := r.lifetime(ttl)
+	if err != nil {
+		return Subscription{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.lookup(id, owner)
+	if err != nil {
+		return Subscription{}, err
+	}
+	e.ExpiresAt = r.now().Add(ttl)
+	return e.copy(), nil
+}
+
+// Delete ends owner's subscription id, closing its listeners
+func (r *Registry) Delete(id, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.lookup(id, owner)
+	if err != nil {
+		return err
+	}
+	r.remove(e)
+	return nil
+}
+
+// Roster returns the user IDs owner's subscription id watches
+func (r *Registry) Roster(id, owner string) ([]string, error) {
+	sub, err := r.Get(id, owner)
+	return sub.UserIDs, err
+}
+
+// Listen registers a listener for owner's subscription id, receiving up to
+// buffer events ahead of its reader
+func (r *Registry) Listen(id, owner string, buffer int) (*Listener, error) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.lookup(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{r: r, e: e, ch: make(chan events.Event, buffer), Users: maps.Clone(e.users)}
+	e.listeners[l] = struct{}{}
+	return l, nil
+}
+
+// Publish delivers a hub event to the subscriptions watching its user
+func (r *Registry) Publish(ev events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for e := range r.watchers[ev.UserID] {
+		mapped := ev
+		mapped.UserID = e.users[ev.UserID]
+		if ev.Presence != nil {
+			p := *ev.Presence
+			p.UserID = mapped.UserID
+			mapped.Presence = &p
+		}
+		for l := range e.listeners {
+			select {
+			case l.ch <- mapped:
+			default:
+				// A listener that cannot keep up is closed; its client
+				// reconnects and starts from a fresh snapshot
+				delete(e.listeners, l)
+				close(l.ch)
+			}
+		}
+		if e.webhook != nil {
+			select {
+			case e.webhook <- mapped:
+			default:
+				metrics.ObserveSubscriptionWebhook("dropped")
+			}
+		}
+	}
+}
+
+// Run feeds hub events to the subscriptions and removes lapsed ones until
+// ctx is done
+func (r *Registry) Run(ctx context.Context, hub *events.Hub) {
+	sub := hub.Subscribe(webhookBuffer)
+	defer sub.Close()
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			r.Publish(ev)
+		case <-ticker.C:
+			r.Sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep removes lapsed subscriptions, returning how many
+func (r *Registry) Sweep() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	n := 0
+	for _, e := range r.subs {
+		if !now.Before(e.ExpiresAt) {
+			r.remove(e)
+			n++
+		}
+	}
+	return n
+}
+
+// lookup returns owner's live subscription id. Callers must hold r.mu.
+func (r *Registry) lookup(id, owner string) (*entry, error) {
+	e, ok := r.subs[id]
+	if !ok || e.Owner != owner || !r.now().Before(e.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// remove ends a subscription. Callers must hold r.mu.
+func (r *Registry) remove(e *entry) {
+	delete(r.subs, e.ID)
+	for storeID := range e.users {
+		delete(r.watchers[storeID], e)
+		if len(r.watchers[storeID]) == 0 {
+			delete(r.watchers, storeID)
+		}
+	}
+	for l := range e.listeners {
+		close(l.ch)
+	}
+	clear(e.listeners)
+	if e.webhook != nil {
+		close(e.webhook)
+	}
+	metrics.SetSubscriptions(len(r.subs))
+}
+
+func (r *Registry) lifetime(ttl time.Duration) (time.Duration, error) {
+	switch {
+	case ttl < 0:
+		return 0, errors.New("ttl must not be negative")
+	case ttl == 0:
+		return r.limits.DefaultTTL, nil
+	case ttl > r.limits.MaxTTL:
+		return 0, fmt.Errorf("ttl must be at most %s", r.limits.MaxTTL)
+	}
+	return ttl, nil
+}
+
+func (r *Registry) storeID(userID string) string {
+	if r.pseudonymizer == nil {
+		return userID
+	}
+	return r.pseudonymizer.Pseudonymize(userID)
+}
+
+func (e *entry) copy() Subscription {
+	sub := e.Subscription
+	sub.UserIDs = slices.Clone(e.UserIDs)
+	return sub
+}
+
+// Listener receives the events of one subscription
+type Listener struct {
+	r  *Registry
+	e  *entry
+	ch chan events.Event
+	// Users maps the store IDs watched to the user IDs as registered, for
+	// loading a snapshot
+	Users map[string]string
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription ends, the listener falls behind or Close is called.
+func (l *Listener) Events() <-chan events.Event { return l.ch }
+
+// Close unregisters the listener
+func (l *Listener) Close() {
+	l.r.mu.Lock()
+	defer l.r.mu.Unlock()
+	if _, ok := l.e.listeners[l]; ok {
+		delete(l.e.listeners, l)
+		close(l.ch)
+	}
+}
+
+// deliver posts queued events to a subscription's webhook until the queue is
+// closed. Delivery is at most once: a failed post is counted, not retried.
+func deliver(id string, sink sinks.Sink, queue <-chan events.Event) {
+	for ev := range queue {
+		payload, err := events.EncodePayload(ev, events.DefaultPayloadVersion)
+		if err != nil {
+			slog.Error("subscription webhook encode failed", "subscription_id", id, "error", err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		err = sink.Deliver(ctx, payload)
+		cancel()
+		if err != nil {
+			slog.Warn("subscription webhook delivery failed", "subscription_id", id, "error", err)
+			metrics.ObserveSubscriptionWebhook("failed")
+			continue
+		}
+		metrics.ObserveSubscriptionWebhook("delivered")
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,228 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/models"
+	"gopresence/internal/sinks"
+)
+
+func updated(userID string, status models.PresenceStatus, rev uint64) events.Event {
+	return events.Event{Type: events.EventUpdated, UserID: userID, Revision: rev, Presence: &models.Presence{UserID: userID, Status: status, Revision: rev}}
+}
+
+func TestRegistry_Lifecycle(t *testing.T) {
+	r := NewRegistry(Limits{}, WithNodeID("n1"))
+	sub, err := r.Create("alice", []string{"bob", "carol", "bob"}, 0, "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if len(sub.UserIDs) != 2 || sub.NodeID != "n1" || !sub.ExpiresAt.Equal(sub.CreatedAt.Add(time.Hour)) {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+	if _, err := r.Get(sub.ID, "mallory"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected another owner to get ErrNotFound, got %v", err)
+	}
+	if got := r.List("alice"); len(got) != 1 || got[0].ID != sub.ID {
+		t.Fatalf("unexpected list %+v", got)
+	}
+
+	renewed, err := r.Renew(sub.ID, "alice", 2*time.Hour)
+	if err != nil || !renewed.ExpiresAt.After(sub.ExpiresAt) {
+		t.Fatalf("Renew: %+v (%v)", renewed, err)
+	}
+	if _, err := r.Renew(sub.ID, "alice", 48*time.Hour); err == nil {
+		t.Fatal("expected a ttl past the maximum to fail")
+	}
+
+	if err := r.Delete(sub.ID, "alice"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := r.Get(sub.ID, "alice"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Delete, got %v", err)
+	}
+}
+
+func TestRegistry_Limits(t *testing.T) {
+	r := NewRegistry(Limits{MaxPerOwner: 2, MaxUsers: 2})
+	if _, err := r.Create("alice", nil, 0, ""); err == nil {
+		t.Fatal("expected an empty roster to fail")
+	}
+	if _, err := r.Create("alice", []string{"a", "b", "c"}, 0, ""); err == nil {
+		t.Fatal("expected a roster over MaxUsers to fail")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Create("alice", []string{"a"}, 0, ""); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+	if _, err := r.Create("alice", []string{"a"}, 0, ""); !errors.Is(err, ErrTooMany) {
+		t.Fatalf("expected ErrTooMany, got %v", err)
+	}
+	if _, err := r.Create("bob", []string{"a"}, 0, ""); err != nil {
+		t.Fatalf("expected the limit to be per owner, got %v", err)
+	}
+	if _, err := r.Create("bob", []string{"a"}, 0, "https://example.com/hook"); !errors.Is(err, ErrWebhooksDisabled) {
+		t.Fatalf("expected ErrWebhooksDisabled, got %v", err)
+	}
+}
+
+func TestRegistry_Expiry(t *testing.T) {
+	now := time.Now().UTC()
+	r := NewRegistry(Limits{MaxPerOwner: 1})
+	r.now = func() time.Time { return now }
+	sub, err := r.Create("alice", []string{"bob"}, time.Minute, "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	l, err := r.Listen(sub.ID, "alice", 1)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := r.Get(sub.ID, "alice"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a lapsed subscription to read as not found, got %v", err)
+	}
+	// A lapsed subscription no longer counts against the limit
+	if _, err := r.Create("alice", []string{"bob"}, 0, ""); err != nil {
+		t.Fatalf("Create after expiry: %v", err)
+	}
+	if n := r.Sweep(); n != 1 {
+		t.Fatalf("expected one subscription swept, got %d", n)
+	}
+	if _, ok := <-l.Events(); ok {
+		t.Fatal("expected the listener to be closed when its subscription lapsed")
+	}
+}
+
+func TestRegistry_Publish(t *testing.T) {
+	r := NewRegistry(Limits{})
+	sub, _ := r.Create("alice", []string{"bob"}, 0, "")
+	l, err := r.Listen(sub.ID, "alice", 1)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	r.Publish(updated("carol", models.StatusOnline, 1))
+	r.Publish(updated("bob", models.StatusBusy, 2))
+	if ev := <-l.Events(); ev.UserID != "bob" || ev.Presence.Status != models.StatusBusy {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	// A listener that falls behind is closed
+	r.Publish(updated("bob", models.StatusAway, 3))
+	r.Publish(updated("bob", models.StatusOnline, 4))
+	<-l.Events()
+	if _, ok := <-l.Events(); ok {
+		t.Fatal("expected a listener that fell behind to be closed")
+	}
+	l.Close() // closing again is a no-op
+}
+
+// recordingSink records delivered payloads
+type recordingSink struct {
+	mu       sync.Mutex
+	payloads [][]byte
+	got      chan struct{}
+}
+
+func (s *recordingSink) Deliver(_ context.Context, payload []byte) error {
+	s.mu.Lock()
+	s.payloads = append(s.payloads, payload)
+	s.mu.Unlock()
+	s.got <- struct{}{}
+	return nil
+}
+
+func TestRegistry_Webhook(t *testing.T) {
+	sink := &recordingSink{got: make(chan struct{}, 1)}
+	var target string
+	r := NewRegistry(Limits{}, WithWebhookGuard(NewWebhookGuard([]string{"example.com"})), WithWebhooks(func(url string) sinks.Sink {
+		target = url
+		return sink
+	}))
+	if _, err := r.Create("alice", []string{"bob"}, 0, "ftp://example.com"); err == nil {
+		t.Fatal("expected a non-http webhook URL to fail")
+	}
+	if _, err := r.Create("alice", []string{"bob"}, 0, "https://internal.example.org/hook"); !errors.Is(err, ErrWebhookHost) {
+		t.Fatalf("expected a host off the allowlist to fail, got %v", err)
+	}
+	if _, err := r.Create("", []string{"bob"}, 0, "https://example.com/hook"); !errors.Is(err, ErrNoOwner) {
+		t.Fatalf("expected a subscription without an owner to fail, got %v", err)
+	}
+	if _, err := r.Create("alice", []string{"bob"}, 0, "https://example.com/hook"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if target != "https://example.com/hook" {
+		t.Fatalf("expected a sink for the webhook URL, got %q", target)
+	}
+
+	r.Publish(updated("bob", models.StatusAway, 7))
+	select {
+	case <-sink.got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	var ev events.Event
+	if err := json.Unmarshal(sink.payloads[0], &ev); err != nil || ev.UserID != "bob" || ev.Revision != 7 {
+		t.Fatalf("unexpected payload %s (%v)", sink.payloads[0], err)
+	}
+}
+
+func TestWebhookGuard(t *testing.T) {
+	check := func(g *WebhookGuard, raw string) error {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("parse %s: %v", raw, err)
+		}
+		return g.Check(context.Background(), u)
+	}
+
+	public := NewWebhookGuard(nil)
+	for _, raw := range []string{"http://127.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/", "http://[::1]:8080/", "http://100.64.0.1/", "http://0.0.0.0/"} {
+		if err := check(public, raw); !errors.Is(err, ErrWebhookHost) {
+			t.Errorf("%s: expected an internal address to fail, got %v", raw, err)
+		}
+	}
+	if err := check(public, "https://93.184.215.14/hook"); err != nil {
+		t.Errorf("expected a public address to pass, got %v", err)
+	}
+
+	listed := NewWebhookGuard([]string{"hooks.example.com", "*.partner.example"})
+	for raw, ok := range map[string]bool{
+		"https://hooks.example.com/a":  true,
+		"https://HOOKS.example.com/a":  true,
+		"https://a.partner.example/b":  true,
+		"https://partner.example/b":    false,
+		"https://example.com/a":        false,
+		"http://169.254.169.254/a":     false,
+		"https://evilpartner.example/": false,
+	} {
+		if err := check(listed, raw); (err == nil) != ok {
+			t.Errorf("%s: expected allowed=%v, got %v", raw, ok, err)
+		}
+	}
+
+	// Delivery refuses to connect to internal addresses, wherever it's sent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	resp, err := public.Client().Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrWebhookHost) {
+		t.Fatalf("expected the client to refuse a loopback server, got %v", err)
+	}
+}
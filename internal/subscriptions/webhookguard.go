@@ -0,0 +1,123 @@
+package subscriptions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// webhookResolveTimeout bounds resolving a webhook host on creation
+	webhookResolveTimeout = 5 * time.Second
+	// webhookDialTimeout bounds connecting to a webhook
+	webhookDialTimeout = 10 * time.Second
+)
+
+// ErrWebhookHost reports a webhook URL whose host deliveries may not go to
+var ErrWebhookHost = errors.New("webhook_url host is not allowed")
+
+// WebhookGuard restricts where subscription webhooks are delivered. Any
+// subscriber names its webhook URL, so without it a caller could have the
+// service POST to internal addresses. With an allowlist, only the listed
+// hosts are accepted; without one, any host resolving to public addresses
+// only, which is checked again on every connection so a host can't be
+// repointed at an internal address after it was accepted.
+type WebhookGuard struct {
+	hosts    []string // Allowed hosts; "*.example.com" also allows its subdomains
+	resolver *net.Resolver
+}
+
+// NewWebhookGuard creates a guard allowing hosts, or any public host if
+// hosts is empty
+func NewWebhookGuard(hosts []string) *WebhookGuard {
+	g := &WebhookGuard{resolver: net.DefaultResolver}
+	for _, h := range hosts {
+		g.hosts = append(g.hosts, strings.ToLower(h))
+	}
+	return g
+}
+
+// Check reports whether webhooks may be delivered to u
+func (g *WebhookGuard) Check(ctx context.Context, u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	if len(g.hosts) > 0 {
+		if g.listed(host) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrWebhookHost, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return checkPublic(ip)
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookResolveTimeout)
+	defer cancel()
+	addrs, err := g.resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: %s doesn't resolve", ErrWebhookHost, host)
+	}
+	for _, addr := range addrs {
+		if err := checkPublic(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Client returns the HTTP client to deliver webhooks with. Without an
+// allowlist it refuses to connect to anything but public addresses,
+// redirects and proxies included.
+func (g *WebhookGuard) Client() *http.Client {
+	if len(g.hosts) > 0 {
+		return &http.Client{}
+	}
+	dialer := &net.Dialer{
+		Timeout: webhookDialTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", ErrWebhookHost, host)
+			}
+			return checkPublic(ip)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+func (g *WebhookGuard) listed(host string) bool {
+	for _, allowed := range g.hosts {
+		if host == allowed {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cgnat is the shared address space of carrier-grade NAT (RFC 6598),
+// internal to the provider's network
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkPublic fails for loopback, private, link-local (cloud metadata
+// included), shared, unspecified and multicast addresses
+func checkPublic(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnat.Contains(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrWebhookHost, ip)
+	}
+	return nil
+}
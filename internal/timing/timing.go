@@ -0,0 +1,146 @@
+// Package timing breaks a request's latency down by phase, so slow requests
+// can be localized without full tracing.
+package timing
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the request header asking for a timing breakdown
+const Header = "X-Debug-Timing"
+
+// Phases recorded by the service
+const (
+	Cache = "cache" // Cache lookups and updates
+	Store = "store" // KV store reads and writes
+)
+
+// phases lists the recorded phases in Server-Timing order
+var phases = []string{Cache, Store}
+
+type ctxKey struct{}
+
+// Timings accumulates time spent per phase. It is safe for concurrent use.
+type Timings struct {
+	mu    sync.Mutex
+	spent map[string]time.Duration
+}
+
+// NewContext returns a copy of ctx recording into t
+func NewContext(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext returns the Timings ctx records into, or nil
+func FromContext(ctx context.Context) *Timings {
+	t, _ := ctx.Value(ctxKey{}).(*Timings)
+	return t
+}
+
+// Start begins timing phase for the request of ctx; call the returned func
+// when the phase ends. It costs nothing when the request didn't ask for
+// timings.
+func Start(ctx context.Context, phase string) func() {
+	t := FromContext(ctx)
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.Add(phase, time.Since(start)) }
+}
+
+// Add records d spent in phase
+func (t *Timings) Add(phase string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.spent == nil {
+		t.spent = make(map[string]time.Duration)
+	}
+	t.spent[phase] += d
+}
+
+// Spent returns the time recorded for phase
+func (t *Timings) Spent(phase string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spent[phase]
+}
+
+// ServerTiming formats the phases and total as a Server-Timing header
+// value, in milliseconds
+func (t *Timings) ServerTiming(total time.Duration) string {
+	parts := make([]string, 0, len(phases)+1)
+	for _, phase := range phases {
+		parts = append(parts, metric(phase, t.Spent(phase)))
+	}
+	parts = append(parts, metric("total", total))
+	return strings.Join(parts, ", ")
+}
+
+func metric(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d)/float64(time.Millisecond))
+}
+
+// Requested reports whether r asks for a timing breakdown
+func Requested(r *http.Request) bool {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(Header))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// Middleware answers requests sent with X-Debug-Timing: true with a
+// Server-Timing header: time spent in the cache and the store, and the
+// total up to the response headers
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Requested(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t := &Timings{}
+		tw := &timingWriter{ResponseWriter: w, timings: t, start: time.Now()}
+		next.ServeHTTP(tw, r.WithContext(NewContext(r.Context(), t)))
+	})
+}
+
+// timingWriter adds the Server-Timing header when the response starts
+type timingWriter struct {
+	http.ResponseWriter
+	timings *Timings
+	start   time.Time
+	written bool
+}
+
+func (w *timingWriter) WriteHeader(code int) {
+	if !w.written {
+		w.written = true
+		w.Header().Set("Server-Timing", w.timings.ServerTiming(time.Since(w.start)))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses
+func (w *timingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Hijack hands the connection to WebSocket upgrades, which assert
+// http.Hijacker rather than use http.ResponseController
+func (w *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
@@ -0,0 +1,53 @@
+package timing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_ServerTiming(t *testing.T) {
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Add(Store, 1500*time.Microsecond)
+		done := Start(r.Context(), Cache)
+		done()
+		w.Write([]byte("ok"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/presence/u1", nil)
+	req.Header.Set(Header, "true")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	got := rr.Header().Get("Server-Timing")
+	if !strings.HasPrefix(got, "cache;dur=") || !strings.Contains(got, "store;dur=1.500") || !strings.Contains(got, "total;dur=") {
+		t.Fatalf("unexpected Server-Timing %q", got)
+	}
+
+	// Without the header nothing is recorded or reported
+	rr = httptest.NewRecorder()
+	Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) != nil {
+			t.Error("expected no timings without the debug header")
+		}
+		Start(r.Context(), Store)()
+	})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Header().Get("Server-Timing") != "" {
+		t.Fatal("expected no Server-Timing header")
+	}
+}
+
+func TestTimings_AccumulatesPhases(t *testing.T) {
+	var tm Timings
+	ctx := NewContext(context.Background(), &tm)
+	tm.Add(Store, time.Millisecond)
+	tm.Add(Store, 2*time.Millisecond)
+	if got := FromContext(ctx).Spent(Store); got != 3*time.Millisecond {
+		t.Fatalf("expected 3ms in store, got %s", got)
+	}
+	if got := tm.ServerTiming(5 * time.Millisecond); got != "cache;dur=0.000, store;dur=3.000, total;dur=5.000" {
+		t.Fatalf("unexpected header %q", got)
+	}
+}
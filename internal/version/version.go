@@ -0,0 +1,33 @@
+// Package version holds the build information embedded at link time, e.g.
+//
+//	go build -ldflags "-X gopresence/internal/version.Version=v2.1.0 \
+//	  -X gopresence/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X gopresence/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import "runtime"
+
+// Set via -ldflags -X; unset values report as "unknown" ("dev" for Version)
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's information
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
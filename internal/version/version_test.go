@@ -0,0 +1,16 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v2.1.0", "abc1234", "2026-10-01T00:00:00Z"
+
+	want := Info{Version: "v2.1.0", Commit: "abc1234", BuildDate: "2026-10-01T00:00:00Z", GoVersion: runtime.Version()}
+	if got := Get(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
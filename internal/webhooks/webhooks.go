@@ -0,0 +1,220 @@
+// Package webhooks notifies backend services of presence changes without
+// them connecting to NATS: each change is POSTed as JSON to every configured
+// endpoint, signed with the endpoint's HMAC secret. Each endpoint reads the
+// changes through its own durable consumer, so its position survives
+// restarts. Failed deliveries are retried with exponential backoff; a change
+// that exhausts its attempts is dead-lettered, that is logged, counted and
+// dropped.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopresence/internal/events"
+	"gopresence/internal/metrics"
+	"gopresence/internal/nats"
+	"gopresence/internal/requestid"
+	"gopresence/internal/sinks"
+)
+
+// Request headers
+const (
+	// SignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>", the
+	// HMAC being of "<t>.<body>" under the endpoint's secret
+	SignatureHeader = "X-Presence-Signature"
+	// DeliveryHeader carries the change's KV revision, so receivers can
+	// discard duplicates. Changes arrive through a durable consumer, which
+	// reads the revision from the stream, so it is the same on every attempt;
+	// core NATS change notifications carry none. A change without one is
+	// sent without the header rather than as a revision 0 shared by all.
+	DeliveryHeader = "X-Presence-Delivery"
+)
+
+// ConsumerName is the durable consumer, shared by the fleet, that the
+// endpoint named name reads changes through
+func ConsumerName(name string) string { return "webhook_" + name }
+
+// Endpoint is a configured webhook
+type Endpoint struct {
+	Name   string // Labels metrics and logs, and names the endpoint's consumer
+	URL    string
+	Secret string // HMAC key of the signature
+}
+
+// Policy bounds delivery to an endpoint
+type Policy struct {
+	MaxAttempts int           // Attempts per change, including the first
+	Backoff     time.Duration // Delay before the first retry, doubled for each further one
+	MaxBackoff  time.Duration // Delay cap
+	Timeout     time.Duration // Bound on one attempt
+}
+
+// DefaultPolicy is the delivery policy of New when none is given
+var DefaultPolicy = Policy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: time.Minute, Timeout: 10 * time.Second}
+
+// Dispatcher delivers presence changes to the configured endpoints. Each
+// endpoint has its own durable consumer, so a slow endpoint delays only its
+// own deliveries, which stay in order, and a restarted fleet resumes each
+// endpoint after the last change it finished.
+type Dispatcher struct {
+	endpoints []Endpoint
+	policy    Policy
+	schema    string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// New returns a dispatcher for endpoints; zero fields of policy take their
+// DefaultPolicy values
+func New(endpoints []Endpoint, policy Policy) *Dispatcher {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultPolicy.MaxAttempts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = DefaultPolicy.Backoff
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = max(DefaultPolicy.MaxBackoff, policy.Backoff)
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = DefaultPolicy.Timeout
+	}
+	schema, _ := events.PayloadSchema(events.DefaultPayloadVersion)
+	return &Dispatcher{endpoints: endpoints, policy: policy, schema: schema, client: &http.Client{Timeout: policy.Timeout}, now: time.Now}
+}
+
+// Run dispatches the bucket's changes until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, bus nats.EventBus) error {
+	for _, e := range d.endpoints {
+		err := bus.WatchDurable(ctx, ConsumerName(e.Name), func(we nats.WatchEvent) error {
+			return d.handle(ctx, e, we)
+		})
+		if err != nil {
+			return fmt.Errorf("webhook %s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// handle makes one attempt at delivering a change to e. A failed attempt is
+// retried by the consumer after the policy's backoff; a change that runs out
+// of attempts or is refused for good is dead-lettered and acknowledged.
+func (d *Dispatcher) handle(ctx context.Context, e Endpoint, we nats.WatchEvent) error {
+	ev := events.FromWatchEvent(we)
+	payload, err := events.EncodePayload(ev, events.DefaultPayloadVersion)
+	if err != nil {
+		slog.Error("webhook payload encoding failed", "user_id", ev.UserID, "error", err)
+		return nil
+	}
+	attempt := max(int(we.Deliveries), 1)
+	err = d.post(ctx, e, ev, payload)
+	if err == nil {
+		metrics.ObserveWebhookDelivery(e.Name, "delivered")
+		return nil
+	}
+	metrics.ObserveWebhookDelivery(e.Name, "failed")
+	if errors.Is(err, errPermanent) || attempt >= d.policy.MaxAttempts {
+		d.deadLetter(e, ev, err)
+		return nil
+	}
+	return nats.RetryAfter(err, d.backoff(attempt))
+}
+
+// backoff is the delay before the nth retry
+func (d *Dispatcher) backoff(n int) time.Duration {
+	delay := d.policy.Backoff
+	for i := 1; i < n && delay < d.policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.policy.MaxBackoff)
+}
+
+// errPermanent marks responses that retrying will not change
+var errPermanent = errors.New("permanent failure")
+
+func (d *Dispatcher) post(ctx context.Context, e Endpoint, ev events.Event, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(sinks.SchemaHeader, d.schema)
+	if ev.Revision != 0 {
+		req.Header.Set(DeliveryHeader, strconv.FormatUint(ev.Revision, 10))
+	}
+	req.Header.Set(SignatureHeader, Sign(e.Secret, d.now(), payload))
+	if ev.RequestID != "" {
+		req.Header.Set(requestid.Header, ev.RequestID)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return fmt.Errorf("%w: webhook returned %s", errPermanent, resp.Status)
+}
+
+func (d *Dispatcher) deadLetter(e Endpoint, ev events.Event, err error) {
+	metrics.ObserveWebhookDeadLetter(e.Name)
+	slog.Warn("webhook change dead-lettered", "webhook", e.Name, "revision", ev.Revision, "request_id", ev.RequestID, "error", err)
+}
+
+// Sign returns the SignatureHeader value of payload sent at t
+func Sign(secret string, t time.Time, payload []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, payload)
+}
+
+// Verify checks a SignatureHeader value against payload, rejecting
+// signatures older than tolerance (0 skips the age check). Receivers written
+// in Go can use it as is.
+func Verify(secret, header string, payload []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("malformed signature header")
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, payload))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	if tolerance > 0 && time.Since(time.Unix(secs, 0)) > tolerance {
+		return fmt.Errorf("signature expired")
+	}
+	return nil
+}
+
+func signature(secret, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
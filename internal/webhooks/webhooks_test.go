@@ -0,0 +1,155 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gopresence/internal/models"
+	"gopresence/internal/nats"
+	"gopresence/internal/requestid"
+)
+
+func TestSignVerify(t *testing.T) {
+	payload := []byte(`{"user_id":"bob"}`)
+	header := Sign("s3cret", time.Now(), payload)
+	if err := Verify("s3cret", header, payload, time.Minute); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := Verify("other", header, payload, time.Minute); err == nil {
+		t.Fatal("expected another secret to fail")
+	}
+	if err := Verify("s3cret", header, []byte(`{"user_id":"eve"}`), time.Minute); err == nil {
+		t.Fatal("expected a tampered payload to fail")
+	}
+	if err := Verify("s3cret", Sign("s3cret", time.Now().Add(-time.Hour), payload), payload, time.Minute); err == nil {
+		t.Fatal("expected an old signature to fail")
+	}
+	if err := Verify("s3cret", "v1=abc", payload, 0); err == nil {
+		t.Fatal("expected a header without a timestamp to fail")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := New(nil, Policy{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := d.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+// recorder answers each request with the next of its statuses, 200 once they
+// run out, and records what it received
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	rec.requests = append(rec.requests, r)
+	rec.bodies = append(rec.bodies, body)
+	status := http.StatusOK
+	if len(rec.statuses) > 0 {
+		status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+	}
+	rec.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+// durableBus hands each change to a durable watch until it is acknowledged,
+// as a JetStream consumer would, recording the requested redelivery delays
+type durableBus struct {
+	nats.EventBus
+	watches map[string]func(nats.WatchEvent) error
+	delays  map[string][]time.Duration
+}
+
+func (b *durableBus) WatchDurable(_ context.Context, name string, callback func(nats.WatchEvent) error) error {
+	b.watches[name] = callback
+	return nil
+}
+
+func (b *durableBus) deliver(t *testing.T, name string, we nats.WatchEvent) {
+	t.Helper()
+	for we.Deliveries = 1; we.Deliveries <= 10; we.Deliveries++ {
+		err := b.watches[name](we)
+		if err == nil {
+			return
+		}
+		var retry *nats.RetryError
+		if !errors.As(err, &retry) {
+			t.Fatalf("%s: expected a retry delay, got %v", name, err)
+		}
+		b.delays[name] = append(b.delays[name], retry.Delay)
+	}
+	t.Fatalf("%s: change never acknowledged", name)
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	retried := &recorder{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	refused := &recorder{statuses: []int{http.StatusBadRequest}}
+	down := &recorder{statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}}
+	srvRetried, srvRefused, srvDown := httptest.NewServer(retried), httptest.NewServer(refused), httptest.NewServer(down)
+	defer srvRetried.Close()
+	defer srvRefused.Close()
+	defer srvDown.Close()
+
+	d := New([]Endpoint{
+		{Name: "retried", URL: srvRetried.URL, Secret: "a"},
+		{Name: "refused", URL: srvRefused.URL, Secret: "b"},
+		{Name: "down", URL: srvDown.URL, Secret: "c"},
+	}, Policy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	bus := &durableBus{watches: map[string]func(nats.WatchEvent) error{}, delays: map[string][]time.Duration{}}
+	if err := d.Run(ctx, bus); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(bus.watches) != 3 || bus.watches[ConsumerName("retried")] == nil {
+		t.Fatalf("expected a durable consumer per endpoint, got %d", len(bus.watches))
+	}
+	we := nats.WatchEvent{Key: "bob", Type: nats.WatchEventPut, Revision: 42, RequestID: "req-42", Presence: &models.Presence{UserID: "bob", Status: models.StatusAway}}
+	for _, name := range []string{"retried", "refused", "down"} {
+		bus.deliver(t, ConsumerName(name), we)
+	}
+
+	if len(retried.requests) != 3 {
+		t.Fatalf("expected two retries, got %d requests", len(retried.requests))
+	}
+	if got := bus.delays[ConsumerName("retried")]; len(got) != 2 || got[0] != time.Millisecond || got[1] != 2*time.Millisecond {
+		t.Fatalf("expected retries after 1ms and 2ms, got %v", got)
+	}
+	for i, r := range retried.requests {
+		if r.Header.Get(DeliveryHeader) != "42" || r.Header.Get(requestid.Header) != "req-42" {
+			t.Errorf("attempt %d: expected delivery 42 of request req-42, got %v", i, r.Header)
+		}
+		if err := Verify("a", r.Header.Get(SignatureHeader), retried.bodies[i], time.Minute); err != nil {
+			t.Errorf("attempt %d: %v", i, err)
+		}
+	}
+	// A 4xx is not retried
+	if len(refused.requests) != 1 {
+		t.Fatalf("expected a refused change not to be retried, got %d requests", len(refused.requests))
+	}
+	// A change is dead-lettered and acknowledged once its attempts run out
+	if len(down.requests) != 3 {
+		t.Fatalf("expected delivery to stop after 3 attempts, got %d requests", len(down.requests))
+	}
+
+	// A change without a revision can't be told apart from others by it
+	we.Revision = 0
+	bus.deliver(t, ConsumerName("refused"), we)
+	if got := refused.requests[len(refused.requests)-1].Header; got.Get(DeliveryHeader) != "" {
+		t.Fatalf("expected no delivery header without a revision, got %q", got.Get(DeliveryHeader))
+	}
+}
@@ -0,0 +1,223 @@
+// Package writebehind keeps presence writes that couldn't reach the store
+// in a durable local queue until they can be replayed. Only the latest
+// queued write per user is kept: replaying older ones would be overwritten
+// anyway.
+package writebehind
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopresence/internal/models"
+)
+
+// Entry is a queued presence write
+type Entry struct {
+	Seq      uint64          `json:"seq"`
+	UserID   string          `json:"user_id"`
+	Presence models.Presence `json:"presence"`
+	QueuedAt time.Time       `json:"queued_at"`
+}
+
+// Queue is a durable queue of presence writes, journaled to a file of one
+// JSON entry per line. Every Push is synced to disk before it returns, so an
+// accepted write survives a crash; the journal is compacted after replays.
+type Queue struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	seq     uint64
+	entries map[string]Entry // Latest write per user
+}
+
+// Open opens the queue journaled at path, creating it if needed and loading
+// any writes left from a previous run
+func Open(path string) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create write-behind directory: %w", err)
+	}
+	q := &Queue{path: path, entries: map[string]Entry{}}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-behind journal: %w", err)
+	}
+	q.file = f
+	return q, nil
+}
+
+// load replays the journal into memory. A torn last line, left by a crash
+// mid-append, is ignored.
+func (q *Queue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read write-behind journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		q.add(e)
+	}
+	return scanner.Err()
+}
+
+func (q *Queue) add(e Entry) {
+	if e.Seq > q.seq {
+		q.seq = e.Seq
+	}
+	if cur, ok := q.entries[e.UserID]; !ok || e.Seq > cur.Seq {
+		q.entries[e.UserID] = e
+	}
+}
+
+// Push queues a write of presence for userID, replacing any write already
+// queued for that user
+func (q *Queue) Push(userID string, presence models.Presence) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return os.ErrClosed
+	}
+
+	e := Entry{Seq: q.seq + 1, UserID: userID, Presence: presence, QueuedAt: time.Now().UTC()}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued presence: %w", err)
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to queue presence: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to queue presence: %w", err)
+	}
+	q.add(e)
+	return nil
+}
+
+// Len returns the number of queued writes
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Replay calls apply on the queued writes in the order they were queued,
+// removing each one apply accepts unless it was superseded by a newer Push
+// meanwhile. It stops at the first error, which it returns, leaving that
+// write and later ones queued. The journal is then compacted.
+func (q *Queue) Replay(apply func(Entry) error) (int, error) {
+	q.mu.Lock()
+	pending := make([]Entry, 0, len(q.entries))
+	for _, e := range q.entries {
+		pending = append(pending, e)
+	}
+	q.mu.Unlock()
+	sortBySeq(pending)
+
+	var replayed int
+	var applyErr error
+	for _, e := range pending {
+		if applyErr = apply(e); applyErr != nil {
+			break
+		}
+		q.mu.Lock()
+		if q.entries[e.UserID].Seq == e.Seq {
+			delete(q.entries, e.UserID)
+		}
+		q.mu.Unlock()
+		replayed++
+	}
+	if replayed == 0 {
+		return 0, applyErr
+	}
+	if err := q.compact(); err != nil && applyErr == nil {
+		applyErr = err
+	}
+	return replayed, applyErr
+}
+
+// compact rewrites the journal to hold only the queued writes
+func (q *Queue) compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return os.ErrClosed
+	}
+
+	entries := make([]Entry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, e)
+	}
+	sortBySeq(entries)
+
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to compact write-behind journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact write-behind journal: %w", err)
+	}
+
+	// Keep appending to the compacted journal
+	q.file.Close()
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen write-behind journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal; queued writes stay in it for the next Open
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+func sortBySeq(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+}
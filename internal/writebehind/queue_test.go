@@ -0,0 +1,87 @@
+package writebehind
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopresence/internal/models"
+)
+
+func TestQueue_PersistsAndCoalesces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []struct {
+		user   string
+		status models.PresenceStatus
+	}{{"a", models.StatusOnline}, {"b", models.StatusOnline}, {"a", models.StatusAway}} {
+		if err := q.Push(w.user, models.Presence{UserID: w.user, Status: w.status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+
+	// A crash can leave half a line behind
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"seq":4,"user_id":"c"`)
+	f.Close()
+
+	q, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 users queued, got %d", q.Len())
+	}
+
+	var order []string
+	n, err := q.Replay(func(e Entry) error {
+		order = append(order, e.UserID+":"+string(e.Presence.Status))
+		return nil
+	})
+	if err != nil || n != 2 || len(order) != 2 || order[0] != "b:online" || order[1] != "a:away" {
+		t.Fatalf("expected b then the latest a, got %v (%d, %v)", order, n, err)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("expected an empty queue, got %d", q.Len())
+	}
+}
+
+func TestQueue_ReplayStopsAtError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"a", "b", "c"} {
+		q.Push(user, models.Presence{UserID: user, Status: models.StatusOnline})
+	}
+
+	unreachable := errors.New("unreachable")
+	n, err := q.Replay(func(e Entry) error {
+		if e.UserID == "b" {
+			return unreachable
+		}
+		return nil
+	})
+	if n != 1 || !errors.Is(err, unreachable) || q.Len() != 2 {
+		t.Fatalf("expected a replayed and b, c kept, got %d %v len %d", n, err, q.Len())
+	}
+
+	// The compacted journal holds only what is still queued, and still accepts writes
+	q.Push("d", models.Presence{UserID: "d", Status: models.StatusBusy})
+	q.Close()
+	q, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != 3 {
+		t.Fatalf("expected b, c and d after reopening, got %d", q.Len())
+	}
+}
@@ -0,0 +1,48 @@
+# Presence access rules, evaluated by an OPA server for AUTHZ_MODE=opa.
+# The service queries data.presence.authz.allow with:
+#
+#   subject      {id, scopes, tenant} of the caller; id is "" if anonymous
+#   action       presence.read, presence.write or admin
+#   resource     the target of the action, e.g. a user ID
+#   route        method and path template, e.g. "PUT /api/v2/presence/{user_id}"
+#   target_user  the {user_id} of the path, if any
+#
+# Edit these rules and reload OPA (or serve them as a bundle) to change
+# access without redeploying the service.
+package presence.authz
+
+import rego.v1
+
+default allow := false
+
+# Admins may do anything
+allow if is_admin
+
+# Authenticated callers may read anyone's presence
+allow if {
+	authenticated
+	input.action == "presence.read"
+}
+
+# Callers may write only their own presence, on any single-user write route
+# (PUT, PATCH, heartbeat, /me); the resource of those is the target user.
+# Batch writes have no single target and need the service scope.
+allow if {
+	authenticated
+	input.action == "presence.write"
+	input.resource == input.subject.id
+}
+
+# Trusted services may set anyone's presence, including in batches
+allow if {
+	authenticated
+	input.action == "presence.write"
+	"presence:service" in input.subject.scopes
+}
+
+authenticated if input.subject.id != ""
+
+is_admin if {
+	authenticated
+	"admin" in input.subject.scopes
+}
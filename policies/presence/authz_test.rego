@@ -0,0 +1,45 @@
+package presence.authz_test
+
+import rego.v1
+
+import data.presence.authz
+
+alice := {"id": "alice", "scopes": ["presence:read"]}
+
+test_authenticated_read_allowed if {
+	authz.allow with input as {"subject": alice, "action": "presence.read", "route": "GET /api/v2/presence/{user_id}", "target_user": "bob"}
+}
+
+test_anonymous_read_denied if {
+	not authz.allow with input as {"subject": {"id": "", "scopes": []}, "action": "presence.read", "route": "GET /api/v2/presence"}
+}
+
+test_own_write_allowed if {
+	authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "alice", "route": "PUT /api/v2/presence/{user_id}", "target_user": "alice"}
+	authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "alice", "route": "PATCH /api/v2/presence/{user_id}", "target_user": "alice"}
+	authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "alice", "route": "POST /api/v2/presence/{user_id}/heartbeat", "target_user": "alice"}
+	authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "alice", "route": "PUT /api/v2/presence/me", "target_user": "alice"}
+}
+
+test_other_write_denied if {
+	not authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "bob", "route": "PUT /api/v2/presence/{user_id}", "target_user": "bob"}
+	not authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "bob", "route": "PATCH /api/v2/presence/{user_id}", "target_user": "bob"}
+	not authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "bob", "route": "POST /api/v2/presence/{user_id}/heartbeat", "target_user": "bob"}
+	not authz.allow with input as {"subject": alice, "action": "presence.write", "resource": "", "route": "POST /api/v2/presence/batch-set"}
+}
+
+test_anonymous_write_denied if {
+	not authz.allow with input as {"subject": {"id": "", "scopes": []}, "action": "presence.write", "resource": "", "route": "POST /api/v2/presence/batch-set"}
+}
+
+test_service_scope_writes_for_others if {
+	svc := {"id": "chat-backend", "scopes": ["presence:service"]}
+	authz.allow with input as {"subject": svc, "action": "presence.write", "resource": "bob", "route": "PUT /api/v2/presence/{user_id}", "target_user": "bob"}
+	authz.allow with input as {"subject": svc, "action": "presence.write", "route": "POST /api/v2/presence/batch-set"}
+	not authz.allow with input as {"subject": svc, "action": "admin", "route": "GET /api/v2/admin/consumers", "resource": "consumers"}
+}
+
+test_admin_api_needs_admin_scope if {
+	not authz.allow with input as {"subject": alice, "action": "admin", "route": "GET /api/v2/admin/consumers", "resource": "consumers"}
+	authz.allow with input as {"subject": {"id": "ops", "scopes": ["admin"]}, "action": "admin", "route": "GET /api/v2/admin/consumers", "resource": "consumers"}
+}